@@ -17,6 +17,10 @@
 //
 // - a pxelinux.0, in which case we will ignore the pxelinux and try to parse
 //   pxelinux.cfg/<files>
+//
+// If the kernel command line configures the network with ip=, pxeboot honors
+// it: statically configured interfaces boot the -file from the ip= server
+// without DHCP, and DHCP is only requested on the interfaces ip= asks it for.
 package main
 
 import (
@@ -32,7 +36,9 @@ import (
 	"github.com/u-root/u-root/pkg/boot/netboot"
 	"github.com/u-root/u-root/pkg/curl"
 	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/netconfig"
 	"github.com/u-root/u-root/pkg/ulog"
+	"github.com/vishvananda/netlink"
 )
 
 var (
@@ -41,6 +47,7 @@ var (
 	noExec      = flag.Bool("no-exec", false, "download boot configuration, but do not exec it")
 	noNetConfig = flag.Bool("no-net-config", false, "get DHCP response, but do not apply the network config it to the kernel interface")
 	verbose     = flag.Bool("v", false, "Verbose output")
+	bootFile    = flag.String("file", "pxelinux.0", "Boot file or URL for interfaces configured statically by ip= on the kernel command line")
 )
 
 const (
@@ -50,10 +57,30 @@ const (
 
 // NetbootImages requests DHCP on every ifaceNames interface, and parses
 // netboot images from the DHCP leases. Returns bootable OSes.
+//
+// If the kernel command line's network config gives interfaces addresses, it
+// is used instead of ifaceNames.
 func NetbootImages(ifaceNames string) ([]boot.OSImage, error) {
-	filteredIfs, err := dhclient.Interfaces(ifaceNames)
+	var filteredIfs []netlink.Link
+	nc, err := netconfig.Cmdline()
 	if err != nil {
-		return nil, err
+		log.Printf("Ignoring the kernel command line's network config: %v", err)
+	}
+	if nc != nil {
+		var imgs []boot.OSImage
+		imgs, filteredIfs = staticImages(nc)
+		if len(imgs) > 0 {
+			return imgs, nil
+		}
+		if len(filteredIfs) == 0 && addressed(nc) {
+			return nil, fmt.Errorf("nothing bootable found with the kernel command line's network config")
+		}
+	}
+	// A config of only, e.g., nameservers or VLANs leaves DHCP to us.
+	if len(filteredIfs) == 0 {
+		if filteredIfs, err = dhclient.Interfaces(ifaceNames); err != nil {
+			return nil, err
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), (1<<dhcpTries)*dhcpTimeout)
@@ -104,6 +131,57 @@ func NetbootImages(ifaceNames string) ([]boot.OSImage, error) {
 	}
 }
 
+// addressed returns whether nc gives any interface an address, statically or
+// with DHCP.
+func addressed(nc *netconfig.Config) bool {
+	for _, i := range nc.Interfaces {
+		if i.Static() || i.DHCP4 || i.DHCP6 {
+			return true
+		}
+	}
+	return false
+}
+
+// staticImages parses netboot images from the interfaces that nc configures
+// statically, and returns the interfaces that nc wants DHCP on.
+func staticImages(nc *netconfig.Config) ([]boot.OSImage, []netlink.Link) {
+	if *noNetConfig {
+		log.Printf("Skipping configuring the network with the kernel command line's config")
+	} else if err := netconfig.Apply(context.Background(), nc.WithoutDHCP()); err != nil {
+		// Boot further regardless, as with DHCP leases.
+		log.Printf("Failed to configure the network: %v", err)
+	}
+
+	var dhcpIfs []netlink.Link
+	for _, i := range nc.Interfaces {
+		links, err := i.Links()
+		if err != nil {
+			log.Printf("Could not find interface: %v", err)
+			continue
+		}
+		if i.DHCP4 || i.DHCP6 {
+			dhcpIfs = append(dhcpIfs, links...)
+		}
+		for _, link := range links {
+			lease, err := nc.Lease(i, link, *bootFile)
+			if err != nil {
+				log.Printf("Could not make a lease for %s: %v", link.Attrs().Name, err)
+				continue
+			}
+			if lease == nil {
+				continue
+			}
+			imgs, err := netboot.BootImages(context.Background(), ulog.Log, curl.DefaultSchemes, lease)
+			if err != nil {
+				log.Printf("Failed to boot static config %v: %v", lease, err)
+				continue
+			}
+			return imgs, nil
+		}
+	}
+	return nil, dhcpIfs
+}
+
 func main() {
 	flag.Parse()
 	if len(flag.Args()) > 1 {
@@ -7,15 +7,17 @@
 //
 //
 // Synopsis:
-//     cpio
+//     cpio [-v] [-H format] {i|o|t}
 //
 // Description:
 //
 // Options:
 //     o: output an archive to stdout given a pattern
 //     i: output files from a stdin stream
-//     t: print table of contents
+//     t: print table of contents, in long format
 //     -v: debug prints
+//     -H: archive format: newc, crc, odc or bin. By default, i and t
+//         detect the format and o writes newc.
 //
 // Bugs: in i mode, it can't use non-seekable stdin, i.e. a pipe. Yep, this sucks.
 // But if we implement seek on such things, we have to do it by reading, which
@@ -34,12 +36,13 @@ import (
 	"os"
 
 	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/ls"
 )
 
 var (
 	debug  = func(string, ...interface{}) {}
 	d      = flag.Bool("v", false, "Debug prints")
-	format = flag.String("H", "newc", "format")
+	format = flag.String("H", "", "format (newc, crc, odc or bin); detected by default when reading")
 )
 
 func usage() {
@@ -59,9 +62,21 @@ func main() {
 	}
 	op := a[0]
 
-	archiver, err := cpio.Format(*format)
-	if err != nil {
-		log.Fatalf("Format %q not supported: %v", *format, err)
+	var archiver cpio.RecordFormat
+	var err error
+	switch {
+	case *format != "":
+		archiver, err = cpio.Format(*format)
+		if err != nil {
+			log.Fatalf("Format %q not supported: %v", *format, err)
+		}
+	case op == "o":
+		archiver = cpio.Newc
+	default:
+		archiver, err = cpio.Detect(os.Stdin)
+		if err != nil {
+			log.Fatalf("Detecting archive format: %v", err)
+		}
 	}
 
 	switch op {
@@ -121,6 +136,7 @@ func main() {
 		}
 
 	case "t":
+		s := ls.LongStringer{Name: ls.NameStringer{}}
 		rr := archiver.Reader(os.Stdin)
 		for {
 			rec, err := rr.ReadRecord()
@@ -130,7 +146,7 @@ func main() {
 			if err != nil {
 				log.Fatalf("error reading records: %v", err)
 			}
-			fmt.Println(rec)
+			fmt.Println(s.FileString(cpio.LSInfoFromRecord(rec)))
 		}
 
 	default:
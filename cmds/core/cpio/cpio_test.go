@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 
@@ -162,6 +163,53 @@ func TestCpio(t *testing.T) {
 	}
 }
 
+func TestListFormats(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "TestListFormats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := ioutil.WriteFile(filepath.Join(tempDir, "file1"), []byte("Hello World"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"newc", "crc", "odc", "bin"} {
+		t.Run(format, func(t *testing.T) {
+			c := testutil.Command(t, "-H", format, "o")
+			c.Dir = tempDir
+			c.Stdin = strings.NewReader("file1\n")
+			archive, err := c.Output()
+			if err != nil {
+				t.Fatalf("%s %v", c.Stderr, err)
+			}
+
+			archiveFile, err := ioutil.TempFile("", "archive.cpio")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(archiveFile.Name())
+			defer archiveFile.Close()
+			if _, err := archiveFile.Write(archive); err != nil {
+				t.Fatal(err)
+			}
+
+			// The format is detected.
+			c = testutil.Command(t, "t")
+			c.Stdin = archiveFile
+			out, err := c.Output()
+			if err != nil {
+				t.Fatalf("%s %v", c.Stderr, err)
+			}
+			// E.g. -rw-r--r--	root	root	11	Oct 17 02:32	file1
+			f := strings.Split(strings.TrimSpace(string(out)), "\t")
+			if len(f) != 6 || f[0] != "-rw-r--r--" || f[3] != "11" || f[5] != "file1" {
+				t.Errorf("listing is %q, want a long listing of file1", out)
+			}
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	testutil.Run(m, main)
 }
@@ -13,6 +13,8 @@
 //     -timeout:  lease timeout in seconds
 //     -renewals: number of DHCP renewals before exiting
 //     -verbose:  verbose output
+//     -d:        keep running, renewing leases until SIGINT or SIGTERM, and
+//                release them on exit
 package main
 
 import (
@@ -20,6 +22,9 @@ import (
 	"flag"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
@@ -37,6 +42,7 @@ var (
 	vverbose = flag.Bool("vv", false, "Really verbose output (print all message options for each DHCP message sent/received)")
 	ipv4     = flag.Bool("ipv4", true, "use IPV4")
 	ipv6     = flag.Bool("ipv6", true, "use IPV6")
+	daemon   = flag.Bool("d", false, "Keep running, renewing leases and releasing them on exit")
 
 	v6Port   = flag.Int("v6-port", dhcpv6.DefaultServerPort, "DHCPv6 server port to send to")
 	v6Server = flag.String("v6-server", "ff02::1:2", "DHCPv6 server address to send to (multicast or unicast)")
@@ -54,15 +60,25 @@ func main() {
 		ifName = flag.Args()[0]
 	}
 
+	if *daemon && *dryRun {
+		log.Fatalf("-d and -dry-run are mutually exclusive")
+	}
+
 	filteredIfs, err := dhclient.Interfaces(ifName)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *daemon {
+		if err := runDaemon(filteredIfs); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	configureAll(filteredIfs)
 }
 
-func configureAll(ifs []netlink.Link) {
+func config() dhclient.Config {
 	packetTimeout := time.Duration(*timeout) * time.Second
 
 	c := dhclient.Config{
@@ -83,7 +99,11 @@ func configureAll(ifs []netlink.Link) {
 	if *vverbose {
 		c.LogLevel = dhclient.LogDebug
 	}
-	r := dhclient.SendRequests(context.Background(), ifs, *ipv4, *ipv6, c, 30*time.Second)
+	return c
+}
+
+func configureAll(ifs []netlink.Link) {
+	r := dhclient.SendRequests(context.Background(), ifs, *ipv4, *ipv6, config(), 30*time.Second)
 
 	for result := range r {
 		if result.Err != nil {
@@ -98,3 +118,29 @@ func configureAll(ifs []netlink.Link) {
 	}
 	log.Printf("Finished trying to configure all interfaces.")
 }
+
+// runDaemon keeps leases on ifs until the process is interrupted.
+func runDaemon(ifs []netlink.Link) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sigs
+		log.Printf("Got %v, releasing leases", s)
+		cancel()
+	}()
+
+	m := dhclient.NewLeaseManager(ifs, *ipv4, *ipv6, config(), 30*time.Second)
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		for e := range m.Events() {
+			log.Print(e)
+		}
+	}()
+	err := m.Run(ctx)
+	<-logged
+	return err
+}
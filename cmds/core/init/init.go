@@ -5,9 +5,10 @@
 // init is u-root's standard userspace init process.
 //
 // init is intended to be the first process run by the kernel when it boots up.
-// init does some basic initialization (mount file systems, turn on loopback)
-// and then tries to execute, in order, /inito, a uinit (either in /bin, /bbin,
-// or /ubin), and then a shell (/bin/defaultsh and /bin/sh).
+// init does some basic initialization (mount file systems, turn on loopback,
+// configure the network as /etc/netconfig.yaml and ip= on the kernel command
+// line say) and then tries to execute, in order, /inito, a uinit (either in
+// /bin, /bbin, or /ubin), and then a shell (/bin/defaultsh and /bin/sh).
 package main
 
 import (
@@ -55,6 +56,9 @@ func main() {
 
 	libinit.SetEnv()
 	libinit.CreateRootfs()
+	if err := libinit.SwitchRootImage(); err != nil {
+		log.Printf("Switching root to the root image: %v", err)
+	}
 	libinit.NetInit()
 
 	// osInitGo wraps all the kernel-specific (i.e. non-portable) stuff.
@@ -3,23 +3,48 @@
 // license that can be found in the LICENSE file.
 
 // ip manipulates network addresses, interfaces, routing, and other config.
+//
+// Synopsis:
+//     ip [OPTIONS] {address|link|route|rule|neigh} [COMMAND...]
+//
+// Options:
+//     -4, -6:        only show or use IPv4 or IPv6
+//     -s, -stats:    show link statistics; twice for error details
+//     -j, -json:     show output as JSON, in iproute2's schema
+//     -p, -pretty:   indent JSON output
+//
+// Commands:
+//     ip addr [show [dev] DEV]
+//     ip addr {add|del} CIDR dev DEV
+//     ip link [show [dev] DEV]
+//     ip link set [dev] DEV {up|down|address LLADDR|mtu MTU|name NAME|master DEV|nomaster}...
+//     ip link add [link DEV] [name] NAME [address LLADDR] [mtu MTU] [txqueuelen N] type TYPE [ARGS]
+//         bridge
+//         bond [mode MODE] [miimon MS]
+//         vlan id ID [protocol {802.1q|802.1ad}]
+//         veth [peer [name] NAME]
+//         macvlan [mode {private|vepa|bridge|passthru|source}]
+//         dummy
+//     ip link del [dev] DEV
+//     ip route [show [table TABLE]]
+//     ip route {add|del|replace} {default|PREFIX} [via GW] [dev DEV] [src IP] [metric N] [table TABLE]
+//     ip rule [show]
+//     ip rule {add|del} [not] [from PREFIX] [to PREFIX] [iif DEV] [oif DEV] [fwmark MARK[/MASK]] [priority N] [table TABLE]
+//     ip neigh [show]
 package main
 
 import (
-	"errors"
 	"fmt"
 	l "log"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 
-	flag "github.com/spf13/pflag"
-
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
-var inet6 = flag.BoolP("6", "6", false, "use ipv6")
-
 // The language implemented by the standard 'ip' is not super consistent
 // and has lots of convenience shortcuts.
 // The BNF the standard ip  shows you doesn't show many of these short cuts, and
@@ -47,6 +72,13 @@ var (
 	whatIWant []string
 	log       = l.New(os.Stdout, "", 0)
 
+	// The options. They are parsed the way iproute2 does, rather than
+	// with the flag package, so that -json and -s -s work.
+	family  int
+	stats   int
+	jsonOut bool
+	pretty  bool
+
 	addrScopes = map[netlink.Scope]string{
 		netlink.SCOPE_UNIVERSE: "global",
 		netlink.SCOPE_HOST:     "host",
@@ -79,6 +111,37 @@ func one(cmd string, cmds []string) string {
 	return ""
 }
 
+// options parses the options before the object, and returns the rest of
+// args. Like iproute2, options take one or two dashes and may be
+// abbreviated.
+func options(args []string) ([]string, error) {
+	family, stats, jsonOut, pretty = netlink.FAMILY_ALL, 0, false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+		switch {
+		case opt == "4":
+			family = netlink.FAMILY_V4
+		case opt == "6":
+			family = netlink.FAMILY_V6
+		case opt != "" && (strings.HasPrefix("stats", opt) || strings.HasPrefix("statistics", opt)):
+			stats++
+		case opt != "" && strings.HasPrefix("json", opt):
+			jsonOut = true
+		case opt != "" && strings.HasPrefix("pretty", opt):
+			pretty = true
+		default:
+			return nil, fmt.Errorf("option %q is unknown", args[0])
+		}
+		args = args[1:]
+	}
+	return args, nil
+}
+
+// more returns whether there are arguments after the cursor.
+func more() bool {
+	return cursor+1 < len(arg)
+}
+
 // in the ip command, turns out 'dev' is a noise word.
 // The BNF it shows is not right in that case.
 // Always make 'dev' optional.
@@ -102,18 +165,86 @@ func maybename() (string, error) {
 	return arg[cursor], nil
 }
 
+// integer parses the next argument as a number of what.
+func integer(what string) (int, error) {
+	cursor++
+	whatIWant = []string{what}
+	n, err := strconv.ParseUint(arg[cursor], 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", what, arg[cursor])
+	}
+	return int(n), nil
+}
+
+// prefix parses the next argument as an address or a CIDR prefix. Addresses
+// get a host prefix.
+func prefix() (*net.IPNet, error) {
+	cursor++
+	whatIWant = []string{"CIDR format address"}
+	if strings.Contains(arg[cursor], "/") {
+		ip, n, err := net.ParseCIDR(arg[cursor])
+		if err != nil {
+			return nil, err
+		}
+		if ip.To4() != nil {
+			ip = ip.To4()
+		}
+		return &net.IPNet{IP: ip.Mask(n.Mask), Mask: n.Mask}, nil
+	}
+	ip := net.ParseIP(arg[cursor])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", arg[cursor])
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// routing tables with names, as in /etc/iproute2/rt_tables.
+var tableNames = map[int]string{
+	unix.RT_TABLE_DEFAULT: "default",
+	unix.RT_TABLE_MAIN:    "main",
+	unix.RT_TABLE_LOCAL:   "local",
+}
+
+// table parses the next argument as a routing table. all is 0.
+func table() (int, error) {
+	cursor++
+	whatIWant = []string{"main", "local", "default", "all", "table number"}
+	if arg[cursor] == "all" {
+		return unix.RT_TABLE_UNSPEC, nil
+	}
+	for t, name := range tableNames {
+		if arg[cursor] == name {
+			return t, nil
+		}
+	}
+	cursor--
+	return integer("table number")
+}
+
+func tableName(t int) string {
+	if name, ok := tableNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(t)
+}
+
 func addrip() error {
 	var err error
 	var addr *netlink.Addr
 	if len(arg) == 1 {
-		return showLinks(os.Stdout, true)
+		return showLinks(os.Stdout, nil, true)
 	}
 	cursor++
-	whatIWant = []string{"add", "del"}
+	whatIWant = []string{"add", "del", "show", "list"}
 	cmd := arg[cursor]
 
 	c := one(cmd, whatIWant)
 	switch c {
+	case "show", "list":
+		return linkshow(true)
 	case "add", "del":
 		cursor++
 		whatIWant = []string{"CIDR format address"}
@@ -144,200 +275,263 @@ func addrip() error {
 }
 
 func neigh() error {
-	if len(arg) != 1 {
-		return errors.New("neigh subcommands not supported yet")
-	}
-	return showNeighbours(os.Stdout, true)
-}
-
-func linkshow() error {
 	cursor++
-	whatIWant = []string{"<nothing>", "<device name>"}
+	whatIWant = []string{"show", "list"}
 	if len(arg[cursor:]) == 0 {
-		return showLinks(os.Stdout, false)
+		return showNeighbours(os.Stdout)
 	}
-	return nil
-}
-
-func setHardwareAddress(iface netlink.Link) error {
-	cursor++
-	hwAddr, err := net.ParseMAC(arg[cursor])
-	if err != nil {
-		return fmt.Errorf("%v cant parse mac addr %v: %v", iface.Attrs().Name, hwAddr, err)
-	}
-	err = netlink.LinkSetHardwareAddr(iface, hwAddr)
-	if err != nil {
-		return fmt.Errorf("%v cant set mac addr %v: %v", iface.Attrs().Name, hwAddr, err)
+	switch one(arg[cursor], whatIWant) {
+	case "show", "list":
+		return showNeighbours(os.Stdout)
 	}
-	return nil
+	return usage()
 }
 
-func linkset() error {
-	iface, err := dev()
-	if err != nil {
-		return err
-	}
-
-	cursor++
-	whatIWant = []string{"address", "up", "down", "master"}
-	switch one(arg[cursor], whatIWant) {
-	case "address":
-		return setHardwareAddress(iface)
-	case "up":
-		if err := netlink.LinkSetUp(iface); err != nil {
-			return fmt.Errorf("%v can't make it up: %v", iface.Attrs().Name, err)
-		}
-	case "down":
-		if err := netlink.LinkSetDown(iface); err != nil {
-			return fmt.Errorf("%v can't make it down: %v", iface.Attrs().Name, err)
-		}
-	case "master":
+func routeshow() error {
+	t := unix.RT_TABLE_MAIN
+	for more() {
 		cursor++
-		whatIWant = []string{"device name"}
-		master, err := netlink.LinkByName(arg[cursor])
-		if err != nil {
+		whatIWant = []string{"table"}
+		if arg[cursor] != "table" {
+			return usage()
+		}
+		var err error
+		if t, err = table(); err != nil {
 			return err
 		}
-		return netlink.LinkSetMaster(iface, master)
-	default:
-		return usage()
 	}
-	return nil
+	return showRoutes(os.Stdout, t)
 }
 
-func linkadd() error {
-	name, err := maybename()
-	if err != nil {
-		return err
-	}
-	attrs := netlink.LinkAttrs{Name: name}
-
+func nodespec() string {
 	cursor++
-	whatIWant = []string{"type"}
-	if arg[cursor] != "type" {
-		return usage()
-	}
+	whatIWant = []string{"default", "CIDR"}
+	return arg[cursor]
+}
 
+// gateway parses the next argument as a gateway. A CIDR prefix length is
+// ignored.
+func gateway() (net.IP, error) {
 	cursor++
-	whatIWant = []string{"bridge"}
-	if arg[cursor] != "bridge" {
-		return usage()
+	whatIWant = []string{"Gateway IP"}
+	gw := arg[cursor]
+	if i := strings.Index(gw, "/"); i >= 0 {
+		gw = gw[:i]
 	}
-	return netlink.LinkAdd(&netlink.Bridge{LinkAttrs: attrs})
+	ip := net.ParseIP(gw)
+	if ip == nil {
+		return nil, fmt.Errorf("failed to parse gateway %q", arg[cursor])
+	}
+	return ip, nil
 }
 
-func link() error {
-	if len(arg) == 1 {
-		return linkshow()
+// routespec parses a route, as in ip route add and del.
+func routespec() (*netlink.Route, error) {
+	r := &netlink.Route{}
+	switch ns := nodespec(); ns {
+	case "default":
+		if family == netlink.FAMILY_V6 {
+			r.Dst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)}
+		}
+	default:
+		cursor--
+		dst, err := prefix()
+		if err != nil {
+			return nil, err
+		}
+		r.Dst = dst
 	}
 
-	cursor++
-	whatIWant = []string{"show", "set", "add"}
-	cmd := arg[cursor]
-
-	switch one(cmd, whatIWant) {
-	case "show":
-		return linkshow()
-	case "set":
-		return linkset()
-	case "add":
-		return linkadd()
+	for more() {
+		cursor++
+		whatIWant = []string{"via", "dev", "src", "metric", "table"}
+		switch arg[cursor] {
+		case "via":
+			gw, err := gateway()
+			if err != nil {
+				return nil, err
+			}
+			r.Gw = gw
+		case "dev":
+			cursor--
+			d, err := dev()
+			if err != nil {
+				return nil, err
+			}
+			r.LinkIndex = d.Attrs().Index
+		case "src":
+			cursor++
+			whatIWant = []string{"source IP"}
+			if r.Src = net.ParseIP(arg[cursor]); r.Src == nil {
+				return nil, fmt.Errorf("invalid source %q", arg[cursor])
+			}
+		case "metric", "priority", "preference":
+			n, err := integer("metric")
+			if err != nil {
+				return nil, err
+			}
+			r.Priority = n
+		case "table":
+			t, err := table()
+			if err != nil {
+				return nil, err
+			}
+			r.Table = t
+		default:
+			return nil, usage()
+		}
 	}
-	return usage()
-}
-
-func routeshow() error {
-	return showRoutes(*inet6)
-}
-
-func nodespec() string {
-	cursor++
-	whatIWant = []string{"default", "CIDR"}
-	return arg[cursor]
+	if r.Gw == nil && r.LinkIndex != 0 {
+		r.Scope = netlink.SCOPE_LINK
+	}
+	return r, nil
 }
 
-func nexthop() (string, *netlink.Addr, error) {
+func route() error {
 	cursor++
-	whatIWant = []string{"via"}
-	if arg[cursor] != "via" {
-		return "", nil, usage()
+	if len(arg[cursor:]) == 0 {
+		return routeshow()
 	}
-	nh := arg[cursor]
-	cursor++
-	whatIWant = []string{"Gateway CIDR"}
-	addr, err := netlink.ParseAddr(arg[cursor])
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to parse gateway CIDR: %v", err)
+
+	whatIWant = []string{"show", "list", "add", "del", "replace"}
+	cmd := one(arg[cursor], whatIWant)
+	switch cmd {
+	case "show", "list":
+		return routeshow()
+	case "add", "del", "replace":
+	default:
+		return usage()
 	}
-	return nh, addr, nil
-}
 
-func routeadddefault() error {
-	nh, nhval, err := nexthop()
+	r, err := routespec()
 	if err != nil {
 		return err
 	}
-	// TODO: NHFLAGS.
-	l, err := dev()
-	if err != nil {
-		return err
+	switch cmd {
+	case "add":
+		err = netlink.RouteAdd(r)
+	case "del":
+		err = netlink.RouteDel(r)
+	case "replace":
+		err = netlink.RouteReplace(r)
 	}
-	switch nh {
-	case "via":
-		log.Printf("Add default route %v via %v", nhval, l.Attrs().Name)
-		r := &netlink.Route{LinkIndex: l.Attrs().Index, Gw: nhval.IPNet.IP}
-		if err := netlink.RouteAdd(r); err != nil {
-			return fmt.Errorf("error adding default route to %v: %v", l.Attrs().Name, err)
-		}
-		return nil
+	if err != nil {
+		return fmt.Errorf("%s route %s: %v", cmd, strings.Join(arg[2:], " "), err)
 	}
-	return usage()
+	return nil
 }
 
-func routeadd() error {
-	ns := nodespec()
-	switch ns {
-	case "default":
-		return routeadddefault()
-	default:
-		addr, err := netlink.ParseAddr(arg[cursor])
-		if err != nil {
-			return usage()
+// rulespec parses a rule, as in ip rule add and del.
+func rulespec() (*netlink.Rule, error) {
+	r := netlink.NewRule()
+	if family != netlink.FAMILY_ALL {
+		r.Family = family
+	}
+	for more() {
+		cursor++
+		whatIWant = []string{"not", "from", "to", "iif", "oif", "fwmark", "priority", "table"}
+		var err error
+		switch arg[cursor] {
+		case "not":
+			r.Invert = true
+		case "from", "to":
+			dir := arg[cursor]
+			cursor++
+			whatIWant = []string{"all", "CIDR format address"}
+			if arg[cursor] == "all" {
+				continue
+			}
+			cursor--
+			var p *net.IPNet
+			if p, err = prefix(); err == nil && dir == "from" {
+				r.Src = p
+			} else if err == nil {
+				r.Dst = p
+			}
+		case "iif", "dev":
+			cursor++
+			whatIWant = []string{"device name"}
+			r.IifName = arg[cursor]
+		case "oif":
+			cursor++
+			whatIWant = []string{"device name"}
+			r.OifName = arg[cursor]
+		case "fwmark":
+			cursor++
+			whatIWant = []string{"MARK[/MASK]"}
+			mark := strings.SplitN(arg[cursor], "/", 2)
+			var n uint64
+			if n, err = strconv.ParseUint(mark[0], 0, 32); err != nil {
+				return nil, fmt.Errorf("invalid fwmark %q", arg[cursor])
+			}
+			r.Mark = int(n)
+			if len(mark) == 2 {
+				if n, err = strconv.ParseUint(mark[1], 0, 32); err != nil {
+					return nil, fmt.Errorf("invalid fwmark %q", arg[cursor])
+				}
+				r.Mask = int(n)
+			}
+		case "priority", "preference", "pref", "prio", "order":
+			r.Priority, err = integer("priority")
+		case "table", "lookup":
+			r.Table, err = table()
+		default:
+			return nil, usage()
 		}
-		d, err := dev()
 		if err != nil {
-			return usage()
-		}
-		r := &netlink.Route{LinkIndex: d.Attrs().Index, Dst: addr.IPNet}
-		if err := netlink.RouteAdd(r); err != nil {
-			return fmt.Errorf("error adding route %s -> %s: %v", addr, d.Attrs().Name, err)
+			return nil, err
 		}
-		return nil
 	}
+	return r, nil
 }
 
-func route() error {
+func rule() error {
 	cursor++
 	if len(arg[cursor:]) == 0 {
-		return routeshow()
+		return showRules(os.Stdout)
 	}
 
-	whatIWant = []string{"show", "add"}
-	switch one(arg[cursor], whatIWant) {
-	case "show":
-		return routeshow()
+	whatIWant = []string{"show", "list", "add", "del"}
+	cmd := one(arg[cursor], whatIWant)
+	switch cmd {
+	case "show", "list":
+		return showRules(os.Stdout)
 	case "add":
-		return routeadd()
+		r, err := rulespec()
+		if err != nil {
+			return err
+		}
+		if r.Table == unix.RT_TABLE_UNSPEC {
+			r.Table = unix.RT_TABLE_MAIN
+		}
+		if err := netlink.RuleAdd(r); err != nil {
+			return fmt.Errorf("add rule %s: %v", strings.Join(arg[2:], " "), err)
+		}
+		return nil
+	case "del":
+		r, err := rulespec()
+		if err != nil {
+			return err
+		}
+		if err := netlink.RuleDel(r); err != nil {
+			return fmt.Errorf("delete rule %s: %v", strings.Join(arg[2:], " "), err)
+		}
+		return nil
 	}
 	return usage()
 }
 
 func main() {
 	// When this is embedded in busybox we need to reinit some things.
-	whatIWant = []string{"addr", "route", "link", "neigh"}
+	whatIWant = []string{"address", "route", "link", "neigh", "rule"}
 	cursor = 0
-	flag.Parse()
-	arg = flag.Args()
+	var err error
+	if arg, err = options(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	if len(arg) == 0 {
+		log.Fatalf("Usage: ip [OPTIONS] {%s}", strings.Join(whatIWant, "|"))
+	}
 
 	defer func() {
 		switch err := recover().(type) {
@@ -356,9 +550,8 @@ func main() {
 
 	// The ip command doesn't actually follow the BNF it prints on error.
 	// There are lots of handy shortcuts that people will expect.
-	var err error
 	switch one(arg[cursor], whatIWant) {
-	case "addr":
+	case "address":
 		err = addrip()
 	case "link":
 		err = link()
@@ -366,8 +559,10 @@ func main() {
 		err = route()
 	case "neigh":
 		err = neigh()
+	case "rule":
+		err = rule()
 	default:
-		usage()
+		err = usage()
 	}
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,196 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestOptions(t *testing.T) {
+	for _, tt := range []struct {
+		args    []string
+		rest    []string
+		family  int
+		stats   int
+		json    bool
+		pretty  bool
+		wantErr bool
+	}{
+		{args: []string{"link"}, rest: []string{"link"}, family: netlink.FAMILY_ALL},
+		{args: []string{"-6", "route"}, rest: []string{"route"}, family: netlink.FAMILY_V6},
+		{args: []string{"-4", "-s", "-s", "link"}, rest: []string{"link"}, family: netlink.FAMILY_V4, stats: 2},
+		{args: []string{"--json", "-p", "addr"}, rest: []string{"addr"}, family: netlink.FAMILY_ALL, json: true, pretty: true},
+		{args: []string{"-j", "-stat"}, rest: []string{}, family: netlink.FAMILY_ALL, stats: 1, json: true},
+		{args: []string{"-x", "link"}, wantErr: true},
+		{args: []string{"-", "link"}, wantErr: true},
+	} {
+		rest, err := options(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("options(%q) = %v, want error %t", tt.args, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if !reflect.DeepEqual(rest, tt.rest) || family != tt.family || stats != tt.stats || jsonOut != tt.json || pretty != tt.pretty {
+			t.Errorf("options(%q) = %q, family %d, stats %d, json %t, pretty %t; want %q, %d, %d, %t, %t",
+				tt.args, rest, family, stats, jsonOut, pretty, tt.rest, tt.family, tt.stats, tt.json, tt.pretty)
+		}
+	}
+}
+
+func TestLinkFlags(t *testing.T) {
+	for _, tt := range []struct {
+		raw  uint32
+		want []string
+	}{
+		{0, []string{}},
+		{unix.IFF_LOOPBACK | unix.IFF_UP | unix.IFF_RUNNING | unix.IFF_LOWER_UP, []string{"LOOPBACK", "UP", "LOWER_UP"}},
+		{unix.IFF_BROADCAST | unix.IFF_MULTICAST | unix.IFF_UP, []string{"NO-CARRIER", "BROADCAST", "MULTICAST", "UP"}},
+		{unix.IFF_BROADCAST | unix.IFF_MULTICAST | unix.IFF_SLAVE, []string{"BROADCAST", "MULTICAST", "SLAVE"}},
+	} {
+		if got := linkFlags(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("linkFlags(%#x) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestLinkInfo(t *testing.T) {
+	stats = 1
+	defer func() { stats = 0 }()
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	l := &netlink.LinkAttrs{
+		Index:        3,
+		Name:         "eth0.100",
+		ParentIndex:  2,
+		MasterIndex:  4,
+		RawFlags:     unix.IFF_BROADCAST | unix.IFF_MULTICAST | unix.IFF_UP | unix.IFF_RUNNING | unix.IFF_LOWER_UP,
+		MTU:          1500,
+		TxQLen:       1000,
+		EncapType:    "ether",
+		HardwareAddr: mac,
+		OperState:    netlink.OperLowerLayerDown,
+		Statistics:   &netlink.LinkStatistics{RxBytes: 10, TxPackets: 2},
+	}
+	li := newLinkInfo(l, map[int]string{2: "eth0", 4: "br0"})
+
+	b, err := json.Marshal(li)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ifindex":3,"ifname":"eth0.100","link":"eth0","flags":["BROADCAST","MULTICAST","UP","LOWER_UP"],"mtu":1500,"master":"br0","operstate":"LOWERLAYERDOWN","group":"default","txqlen":1000,"link_type":"ether","address":"52:54:00:12:34:56","stats64":{"rx":{"bytes":10,"packets":0,"errors":0,"dropped":0,"over_errors":0,"multicast":0},"tx":{"bytes":0,"packets":2,"errors":0,"dropped":0,"carrier_errors":0,"collisions":0}}}`
+	if string(b) != want {
+		t.Errorf("json.Marshal(linkInfo) = \n%s, want \n%s", b, want)
+	}
+
+	var buf bytes.Buffer
+	printLink(&buf, li)
+	wantText := "3: eth0.100@eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 master br0 state LOWERLAYERDOWN\n" +
+		"    link/ether 52:54:00:12:34:56\n" +
+		"    RX: bytes  packets  errors  dropped overrun mcast\n" +
+		"    10         0        0       0       0       0      \n" +
+		"    TX: bytes  packets  errors  dropped carrier collsns\n" +
+		"    0          2        0       0       0       0      \n"
+	if buf.String() != wantText {
+		t.Errorf("printLink = \n%q, want \n%q", buf.String(), wantText)
+	}
+}
+
+func TestRouteInfo(t *testing.T) {
+	names := map[int]string{2: "eth0"}
+	_, dst, _ := net.ParseCIDR("10.0.0.0/8")
+	_, host, _ := net.ParseCIDR("10.1.2.3/32")
+	for _, tt := range []struct {
+		r    netlink.Route
+		text string
+		json string
+	}{
+		{
+			r:    netlink.Route{Gw: net.ParseIP("192.168.0.1"), LinkIndex: 2, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_DHCP, Priority: 100},
+			text: "default via 192.168.0.1 dev eth0 proto dhcp metric 100",
+			json: `{"dst":"default","gateway":"192.168.0.1","dev":"eth0","protocol":"dhcp","metric":100,"flags":[]}`,
+		},
+		{
+			r:    netlink.Route{Dst: dst, LinkIndex: 2, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_KERNEL, Scope: netlink.SCOPE_LINK, Src: net.ParseIP("10.0.0.2")},
+			text: "10.0.0.0/8 dev eth0 proto kernel scope link src 10.0.0.2",
+			json: `{"dst":"10.0.0.0/8","dev":"eth0","protocol":"kernel","scope":"link","prefsrc":"10.0.0.2","flags":[]}`,
+		},
+		{
+			r:    netlink.Route{Dst: host, Type: unix.RTN_BLACKHOLE, Table: 100, Protocol: unix.RTPROT_BOOT},
+			text: "blackhole 10.1.2.3 table 100",
+			json: `{"type":"blackhole","dst":"10.1.2.3","table":"100","flags":[]}`,
+		},
+	} {
+		ri := newRouteInfo(tt.r, names)
+		if got := formatRoute(ri); got != tt.text {
+			t.Errorf("formatRoute(%v) = %q, want %q", tt.r, got, tt.text)
+		}
+		b, err := json.Marshal(ri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.json {
+			t.Errorf("json.Marshal(routeInfo(%v)) = %s, want %s", tt.r, b, tt.json)
+		}
+	}
+}
+
+func TestRuleInfo(t *testing.T) {
+	_, src, _ := net.ParseCIDR("10.0.0.0/8")
+	_, dst, _ := net.ParseCIDR("192.168.1.1/32")
+	for _, tt := range []struct {
+		r    netlink.Rule
+		text string
+		json string
+	}{
+		{
+			r:    netlink.Rule{Priority: -1, Table: unix.RT_TABLE_LOCAL, Mark: -1, Mask: -1},
+			text: "0:\tfrom all lookup local",
+			json: `{"priority":0,"src":"all","table":"local"}`,
+		},
+		{
+			r:    netlink.Rule{Priority: 100, Src: src, Dst: dst, IifName: "eth0", Table: 200, Mark: 0x10, Mask: 0xff},
+			text: "100:\tfrom 10.0.0.0/8 to 192.168.1.1 fwmark 0x10/0xff iif eth0 lookup 200",
+			json: `{"priority":100,"src":"10.0.0.0","srclen":8,"dst":"192.168.1.1","iif":"eth0","fwmark":"0x10","fwmask":"0xff","table":"200"}`,
+		},
+		{
+			r:    netlink.Rule{Priority: 32766, Invert: true, Table: unix.RT_TABLE_MAIN, Mark: 1, Mask: -1},
+			text: "32766:\tnot from all fwmark 0x1 lookup main",
+			json: `{"priority":32766,"not":null,"src":"all","fwmark":"0x1","table":"main"}`,
+		},
+	} {
+		ri := newRuleInfo(tt.r)
+		if got := formatRule(ri); got != tt.text {
+			t.Errorf("formatRule(%v) = %q, want %q", tt.r, got, tt.text)
+		}
+		b, err := json.Marshal(ri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.json {
+			t.Errorf("json.Marshal(ruleInfo(%v)) = %s, want %s", tt.r, b, tt.json)
+		}
+	}
+}
+
+func TestNeighInfo(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	n := netlink.Neigh{IP: net.ParseIP("10.0.0.1"), HardwareAddr: mac, State: netlink.NUD_REACHABLE, Flags: netlink.NTF_ROUTER}
+	b, err := json.Marshal(newNeighInfo(n, "eth0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"dst":"10.0.0.1","dev":"eth0","lladdr":"52:54:00:12:34:56","router":null,"state":["REACHABLE"]}`
+	if string(b) != want {
+		t.Errorf("json.Marshal(neighInfo) = %s, want %s", b, want)
+	}
+}
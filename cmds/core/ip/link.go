@@ -0,0 +1,316 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/vishvananda/netlink"
+)
+
+func linkshow(withAddresses bool) error {
+	cursor++
+	whatIWant = []string{"<nothing>", "<device name>"}
+	if len(arg[cursor:]) == 0 {
+		return showLinks(os.Stdout, nil, withAddresses)
+	}
+	cursor--
+	iface, err := dev()
+	if err != nil {
+		return err
+	}
+	return showLinks(os.Stdout, iface, withAddresses)
+}
+
+func setHardwareAddress(iface netlink.Link) error {
+	cursor++
+	hwAddr, err := net.ParseMAC(arg[cursor])
+	if err != nil {
+		return fmt.Errorf("%v cant parse mac addr %v: %v", iface.Attrs().Name, hwAddr, err)
+	}
+	err = netlink.LinkSetHardwareAddr(iface, hwAddr)
+	if err != nil {
+		return fmt.Errorf("%v cant set mac addr %v: %v", iface.Attrs().Name, hwAddr, err)
+	}
+	return nil
+}
+
+func linkset() error {
+	iface, err := dev()
+	if err != nil {
+		return err
+	}
+
+	// Like iproute2, take any number of settings.
+	cursor++
+	for {
+		whatIWant = []string{"address", "up", "down", "mtu", "name", "master", "nomaster"}
+		switch one(arg[cursor], whatIWant) {
+		case "address":
+			if err := setHardwareAddress(iface); err != nil {
+				return err
+			}
+		case "up":
+			if err := netlink.LinkSetUp(iface); err != nil {
+				return fmt.Errorf("%v can't make it up: %v", iface.Attrs().Name, err)
+			}
+		case "down":
+			if err := netlink.LinkSetDown(iface); err != nil {
+				return fmt.Errorf("%v can't make it down: %v", iface.Attrs().Name, err)
+			}
+		case "mtu":
+			mtu, err := integer("MTU")
+			if err != nil {
+				return err
+			}
+			if err := netlink.LinkSetMTU(iface, mtu); err != nil {
+				return fmt.Errorf("%v can't set MTU %d: %v", iface.Attrs().Name, mtu, err)
+			}
+		case "name":
+			cursor++
+			whatIWant = []string{"device name"}
+			if err := netlink.LinkSetName(iface, arg[cursor]); err != nil {
+				return fmt.Errorf("%v can't rename to %v: %v", iface.Attrs().Name, arg[cursor], err)
+			}
+		case "master":
+			cursor++
+			whatIWant = []string{"device name"}
+			master, err := netlink.LinkByName(arg[cursor])
+			if err != nil {
+				return err
+			}
+			if err := netlink.LinkSetMaster(iface, master); err != nil {
+				return fmt.Errorf("%v can't set master %v: %v", iface.Attrs().Name, arg[cursor], err)
+			}
+		case "nomaster":
+			if err := netlink.LinkSetNoMaster(iface); err != nil {
+				return fmt.Errorf("%v can't remove master: %v", iface.Attrs().Name, err)
+			}
+		default:
+			return usage()
+		}
+		if !more() {
+			return nil
+		}
+		cursor++
+	}
+}
+
+func linkadd() error {
+	attrs := netlink.NewLinkAttrs()
+	var parent string
+	for {
+		cursor++
+		whatIWant = []string{"link", "name", "address", "mtu", "txqueuelen", "type", "device name"}
+		switch arg[cursor] {
+		case "link":
+			cursor++
+			whatIWant = []string{"device name"}
+			parent = arg[cursor]
+		case "name":
+			cursor--
+			name, err := maybename()
+			if err != nil {
+				return err
+			}
+			attrs.Name = name
+		case "address":
+			cursor++
+			whatIWant = []string{"MAC address"}
+			hwAddr, err := net.ParseMAC(arg[cursor])
+			if err != nil {
+				return fmt.Errorf("can't parse mac addr %v: %v", arg[cursor], err)
+			}
+			attrs.HardwareAddr = hwAddr
+		case "mtu":
+			mtu, err := integer("MTU")
+			if err != nil {
+				return err
+			}
+			attrs.MTU = mtu
+		case "txqueuelen", "txqlen":
+			n, err := integer("queue length")
+			if err != nil {
+				return err
+			}
+			attrs.TxQLen = n
+		case "type":
+			if attrs.Name == "" {
+				return fmt.Errorf("link add: no device name")
+			}
+			if parent != "" {
+				p, err := netlink.LinkByName(parent)
+				if err != nil {
+					return err
+				}
+				attrs.ParentIndex = p.Attrs().Index
+			}
+			link, err := linktype(attrs)
+			if err != nil {
+				return err
+			}
+			if err := netlink.LinkAdd(link); err != nil {
+				return fmt.Errorf("can't add %s: %v", attrs.Name, err)
+			}
+			return nil
+		default:
+			if attrs.Name != "" {
+				return usage()
+			}
+			attrs.Name = arg[cursor]
+		}
+	}
+}
+
+var macvlanModes = map[string]netlink.MacvlanMode{
+	"private":  netlink.MACVLAN_MODE_PRIVATE,
+	"vepa":     netlink.MACVLAN_MODE_VEPA,
+	"bridge":   netlink.MACVLAN_MODE_BRIDGE,
+	"passthru": netlink.MACVLAN_MODE_PASSTHRU,
+	"source":   netlink.MACVLAN_MODE_SOURCE,
+}
+
+// linktype parses the type of ip link add and its arguments.
+func linktype(attrs netlink.LinkAttrs) (netlink.Link, error) {
+	cursor++
+	whatIWant = []string{"bridge", "bond", "vlan", "veth", "macvlan", "dummy"}
+	switch arg[cursor] {
+	case "bridge":
+		return &netlink.Bridge{LinkAttrs: attrs}, nil
+
+	case "dummy":
+		return &netlink.Dummy{LinkAttrs: attrs}, nil
+
+	case "bond":
+		b := netlink.NewLinkBond(attrs)
+		for more() {
+			cursor++
+			whatIWant = []string{"mode", "miimon"}
+			switch arg[cursor] {
+			case "mode":
+				cursor++
+				whatIWant = []string{"balance-rr", "active-backup", "balance-xor", "broadcast", "802.3ad", "balance-tlb", "balance-alb"}
+				b.Mode = netlink.StringToBondMode(arg[cursor])
+				if b.Mode == netlink.BOND_MODE_UNKNOWN {
+					return nil, usage()
+				}
+			case "miimon":
+				n, err := integer("miimon")
+				if err != nil {
+					return nil, err
+				}
+				b.Miimon = n
+			default:
+				return nil, usage()
+			}
+		}
+		return b, nil
+
+	case "vlan":
+		if attrs.ParentIndex == 0 {
+			return nil, fmt.Errorf("vlan: no link given")
+		}
+		v := &netlink.Vlan{LinkAttrs: attrs, VlanId: -1}
+		for more() {
+			cursor++
+			whatIWant = []string{"id", "protocol"}
+			switch arg[cursor] {
+			case "id":
+				id, err := integer("VLAN ID")
+				if err != nil {
+					return nil, err
+				}
+				v.VlanId = id
+			case "protocol":
+				cursor++
+				whatIWant = []string{"802.1q", "802.1ad"}
+				v.VlanProtocol = netlink.StringToVlanProtocol(arg[cursor])
+				if v.VlanProtocol == netlink.VLAN_PROTOCOL_UNKNOWN {
+					return nil, usage()
+				}
+			default:
+				return nil, usage()
+			}
+		}
+		if v.VlanId < 0 {
+			return nil, fmt.Errorf("vlan: no id given")
+		}
+		return v, nil
+
+	case "veth":
+		// The kernel numbers the peer if it has no name.
+		v := &netlink.Veth{LinkAttrs: attrs, PeerName: "veth%d"}
+		if more() {
+			cursor++
+			whatIWant = []string{"peer"}
+			if arg[cursor] != "peer" {
+				return nil, usage()
+			}
+			name, err := maybename()
+			if err != nil {
+				return nil, err
+			}
+			v.PeerName = name
+		}
+		return v, nil
+
+	case "macvlan":
+		if attrs.ParentIndex == 0 {
+			return nil, fmt.Errorf("macvlan: no link given")
+		}
+		m := &netlink.Macvlan{LinkAttrs: attrs}
+		if more() {
+			cursor++
+			whatIWant = []string{"mode"}
+			if arg[cursor] != "mode" {
+				return nil, usage()
+			}
+			cursor++
+			whatIWant = []string{"private", "vepa", "bridge", "passthru", "source"}
+			mode, ok := macvlanModes[arg[cursor]]
+			if !ok {
+				return nil, usage()
+			}
+			m.Mode = mode
+		}
+		return m, nil
+	}
+	return nil, usage()
+}
+
+func linkdel() error {
+	iface, err := dev()
+	if err != nil {
+		return err
+	}
+	if err := netlink.LinkDel(iface); err != nil {
+		return fmt.Errorf("can't delete %s: %v", iface.Attrs().Name, err)
+	}
+	return nil
+}
+
+func link() error {
+	if len(arg) == 1 {
+		return linkshow(false)
+	}
+
+	cursor++
+	whatIWant = []string{"show", "list", "set", "add", "delete"}
+	cmd := arg[cursor]
+
+	switch one(cmd, whatIWant) {
+	case "show", "list":
+		return linkshow(false)
+	case "set":
+		return linkset()
+	case "add":
+		return linkadd()
+	case "delete":
+		return linkdel()
+	}
+	return usage()
+}
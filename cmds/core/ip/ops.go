@@ -5,9 +5,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"net"
 	"strings"
 
@@ -15,138 +15,397 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func showLinks(w io.Writer, withAddresses bool) error {
+// The show commands gather what they show in these types, which marshal to
+// the JSON that iproute2 prints with -json, and print them as text
+// otherwise.
+
+// present is a JSON attribute that is there or not, like iproute2's null
+// attributes.
+type present bool
+
+// MarshalJSON implements json.Marshaler.
+func (present) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// printJSON prints v as JSON, indented with -pretty.
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	if pretty {
+		enc.SetIndent("", "    ")
+	}
+	return enc.Encode(v)
+}
+
+type linkInfo struct {
+	IfIndex   int        `json:"ifindex"`
+	IfName    string     `json:"ifname"`
+	Link      string     `json:"link,omitempty"`
+	Flags     []string   `json:"flags"`
+	MTU       int        `json:"mtu"`
+	Master    string     `json:"master,omitempty"`
+	OperState string     `json:"operstate"`
+	Group     string     `json:"group"`
+	TxQLen    int        `json:"txqlen,omitempty"`
+	LinkType  string     `json:"link_type"`
+	Address   string     `json:"address,omitempty"`
+	Stats64   *linkStats `json:"stats64,omitempty"`
+	AddrInfo  []addrInfo `json:"addr_info,omitempty"`
+}
+
+type linkStats struct {
+	RX rxStats `json:"rx"`
+	TX txStats `json:"tx"`
+}
+
+type rxStats struct {
+	Bytes      uint64 `json:"bytes"`
+	Packets    uint64 `json:"packets"`
+	Errors     uint64 `json:"errors"`
+	Dropped    uint64 `json:"dropped"`
+	OverErrors uint64 `json:"over_errors"`
+	Multicast  uint64 `json:"multicast"`
+
+	// With -s -s.
+	*rxErrors
+}
+
+type rxErrors struct {
+	LengthErrors uint64 `json:"length_errors"`
+	CRCErrors    uint64 `json:"crc_errors"`
+	FrameErrors  uint64 `json:"frame_errors"`
+	FIFOErrors   uint64 `json:"fifo_errors"`
+	MissedErrors uint64 `json:"missed_errors"`
+}
+
+type txStats struct {
+	Bytes         uint64 `json:"bytes"`
+	Packets       uint64 `json:"packets"`
+	Errors        uint64 `json:"errors"`
+	Dropped       uint64 `json:"dropped"`
+	CarrierErrors uint64 `json:"carrier_errors"`
+	Collisions    uint64 `json:"collisions"`
+
+	// With -s -s.
+	*txErrors
+}
+
+type txErrors struct {
+	AbortedErrors   uint64 `json:"aborted_errors"`
+	FIFOErrors      uint64 `json:"fifo_errors"`
+	WindowErrors    uint64 `json:"window_errors"`
+	HeartbeatErrors uint64 `json:"heartbeat_errors"`
+}
+
+type addrInfo struct {
+	Family            string `json:"family"`
+	Local             string `json:"local"`
+	PrefixLen         int    `json:"prefixlen"`
+	Broadcast         string `json:"broadcast,omitempty"`
+	Scope             string `json:"scope"`
+	Label             string `json:"label,omitempty"`
+	ValidLifeTime     uint32 `json:"valid_life_time"`
+	PreferredLifeTime uint32 `json:"preferred_life_time"`
+}
+
+// linkFlagNames are the interface flags in the order iproute2 shows them.
+var linkFlagNames = []struct {
+	flag uint32
+	name string
+}{
+	{unix.IFF_LOOPBACK, "LOOPBACK"},
+	{unix.IFF_BROADCAST, "BROADCAST"},
+	{unix.IFF_POINTOPOINT, "POINTOPOINT"},
+	{unix.IFF_MULTICAST, "MULTICAST"},
+	{unix.IFF_NOARP, "NOARP"},
+	{unix.IFF_ALLMULTI, "ALLMULTI"},
+	{unix.IFF_PROMISC, "PROMISC"},
+	{unix.IFF_NOTRAILERS, "NOTRAILERS"},
+	{unix.IFF_DEBUG, "DEBUG"},
+	{unix.IFF_DYNAMIC, "DYNAMIC"},
+	{unix.IFF_AUTOMEDIA, "AUTOMEDIA"},
+	{unix.IFF_PORTSEL, "PORTSEL"},
+	{unix.IFF_MASTER, "MASTER"},
+	{unix.IFF_SLAVE, "SLAVE"},
+	{unix.IFF_UP, "UP"},
+	{unix.IFF_LOWER_UP, "LOWER_UP"},
+	{unix.IFF_DORMANT, "DORMANT"},
+	{unix.IFF_ECHO, "ECHO"},
+}
+
+func linkFlags(raw uint32) []string {
+	flags := []string{}
+	if raw&unix.IFF_UP != 0 && raw&unix.IFF_RUNNING == 0 {
+		flags = append(flags, "NO-CARRIER")
+	}
+	for _, f := range linkFlagNames {
+		if raw&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
+// newLinkInfo returns what ip link shows about l. names are the names of
+// the links by index.
+func newLinkInfo(l *netlink.LinkAttrs, names map[int]string) linkInfo {
+	li := linkInfo{
+		IfIndex:   l.Index,
+		IfName:    l.Name,
+		Flags:     linkFlags(l.RawFlags),
+		MTU:       l.MTU,
+		Master:    names[l.MasterIndex],
+		OperState: strings.ToUpper(strings.Replace(l.OperState.String(), "-", "", -1)),
+		Group:     "default",
+		TxQLen:    l.TxQLen,
+		LinkType:  l.EncapType,
+		Address:   l.HardwareAddr.String(),
+	}
+	if l.ParentIndex != 0 {
+		if li.Link = names[l.ParentIndex]; li.Link == "" {
+			li.Link = "NONE"
+		}
+	}
+	if l.Group != 0 {
+		li.Group = fmt.Sprint(l.Group)
+	}
+	if stats > 0 && l.Statistics != nil {
+		s := l.Statistics
+		li.Stats64 = &linkStats{
+			RX: rxStats{
+				Bytes:      s.RxBytes,
+				Packets:    s.RxPackets,
+				Errors:     s.RxErrors,
+				Dropped:    s.RxDropped,
+				OverErrors: s.RxOverErrors,
+				Multicast:  s.Multicast,
+			},
+			TX: txStats{
+				Bytes:         s.TxBytes,
+				Packets:       s.TxPackets,
+				Errors:        s.TxErrors,
+				Dropped:       s.TxDropped,
+				CarrierErrors: s.TxCarrierErrors,
+				Collisions:    s.Collisions,
+			},
+		}
+		if stats > 1 {
+			li.Stats64.RX.rxErrors = &rxErrors{
+				LengthErrors: s.RxLengthErrors,
+				CRCErrors:    s.RxCrcErrors,
+				FrameErrors:  s.RxFrameErrors,
+				FIFOErrors:   s.RxFifoErrors,
+				MissedErrors: s.RxMissedErrors,
+			}
+			li.Stats64.TX.txErrors = &txErrors{
+				AbortedErrors:   s.TxAbortedErrors,
+				FIFOErrors:      s.TxFifoErrors,
+				WindowErrors:    s.TxWindowErrors,
+				HeartbeatErrors: s.TxHeartbeatErrors,
+			}
+		}
+	}
+	return li
+}
+
+func newAddrInfo(addr netlink.Addr) addrInfo {
+	ai := addrInfo{
+		Family:            "inet",
+		Local:             addr.IP.String(),
+		Scope:             addrScopes[netlink.Scope(addr.Scope)],
+		Label:             addr.Label,
+		ValidLifeTime:     uint32(addr.ValidLft),
+		PreferredLifeTime: uint32(addr.PreferedLft),
+	}
+	if addr.IP.To4() == nil {
+		ai.Family = "inet6"
+	}
+	ai.PrefixLen, _ = addr.Mask.Size()
+	if addr.Broadcast != nil {
+		ai.Broadcast = addr.Broadcast.String()
+	}
+	return ai
+}
+
+// showLinks shows only, or all links if only is nil.
+func showLinks(w io.Writer, only netlink.Link, withAddresses bool) error {
 	ifaces, err := netlink.LinkList()
 	if err != nil {
 		return fmt.Errorf("can't enumerate interfaces: %v", err)
 	}
-
+	names := make(map[int]string)
 	for _, v := range ifaces {
-		l := v.Attrs()
+		names[v.Attrs().Index] = v.Attrs().Name
+	}
 
-		master := ""
-		if l.MasterIndex != 0 {
-			link, err := netlink.LinkByIndex(l.MasterIndex)
+	links := []linkInfo{}
+	for _, v := range ifaces {
+		if only != nil && v.Attrs().Index != only.Attrs().Index {
+			continue
+		}
+		li := newLinkInfo(v.Attrs(), names)
+		if withAddresses {
+			addrs, err := netlink.AddrList(v, family)
 			if err != nil {
-				return fmt.Errorf("can't get link with index %d: %v", l.MasterIndex, err)
+				return fmt.Errorf("can't enumerate addresses: %v", err)
+			}
+			for _, addr := range addrs {
+				li.AddrInfo = append(li.AddrInfo, newAddrInfo(addr))
+			}
+			// Like iproute2, only show links with addresses of the
+			// family asked for.
+			if family != netlink.FAMILY_ALL && len(li.AddrInfo) == 0 {
+				continue
 			}
-			master = fmt.Sprintf("master %s ", link.Attrs().Name)
 		}
-		fmt.Fprintf(w, "%d: %s: <%s> mtu %d %sstate %s\n", l.Index, l.Name,
-			strings.Replace(strings.ToUpper(l.Flags.String()), "|", ",", -1),
-			l.MTU, master, strings.ToUpper(l.OperState.String()))
-
-		fmt.Fprintf(w, "    link/%s %s\n", l.EncapType, l.HardwareAddr)
+		links = append(links, li)
+	}
 
-		if withAddresses {
-			showLinkAddresses(w, v)
-		}
+	if jsonOut {
+		return printJSON(w, links)
+	}
+	for _, li := range links {
+		printLink(w, li)
 	}
 	return nil
 }
 
-func showLinkAddresses(w io.Writer, link netlink.Link) error {
-	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
-	if err != nil {
-		return fmt.Errorf("can't enumerate addresses: %v", err)
+func printLink(w io.Writer, li linkInfo) {
+	name := li.IfName
+	if li.Link != "" {
+		name += "@" + li.Link
 	}
+	master := ""
+	if li.Master != "" {
+		master = fmt.Sprintf("master %s ", li.Master)
+	}
+	fmt.Fprintf(w, "%d: %s: <%s> mtu %d %sstate %s\n", li.IfIndex, name,
+		strings.Join(li.Flags, ","), li.MTU, master, li.OperState)
 
-	for _, addr := range addrs {
+	fmt.Fprintf(w, "    link/%s %s\n", li.LinkType, li.Address)
 
-		var inet string
-		switch len(addr.IPNet.IP) {
-		case 4:
-			inet = "inet"
-		case 16:
-			inet = "inet6"
-		default:
-			return fmt.Errorf("can't figure out IP protocol version: IP length is %d", len(addr.IPNet.IP))
+	if s := li.Stats64; s != nil {
+		fmt.Fprintf(w, "    RX: bytes  packets  errors  dropped overrun mcast\n")
+		fmt.Fprintf(w, "    %-10d %-8d %-7d %-7d %-7d %-7d\n", s.RX.Bytes, s.RX.Packets, s.RX.Errors, s.RX.Dropped, s.RX.OverErrors, s.RX.Multicast)
+		if e := s.RX.rxErrors; e != nil {
+			fmt.Fprintf(w, "    RX errors: length   crc     frame   fifo    missed\n")
+			fmt.Fprintf(w, "               %-8d %-7d %-7d %-7d %-7d\n", e.LengthErrors, e.CRCErrors, e.FrameErrors, e.FIFOErrors, e.MissedErrors)
 		}
-
-		fmt.Fprintf(w, "    %s %s", inet, addr.IP)
-		if addr.Broadcast != nil {
-			fmt.Fprintf(w, " brd %s", addr.Broadcast)
+		fmt.Fprintf(w, "    TX: bytes  packets  errors  dropped carrier collsns\n")
+		fmt.Fprintf(w, "    %-10d %-8d %-7d %-7d %-7d %-7d\n", s.TX.Bytes, s.TX.Packets, s.TX.Errors, s.TX.Dropped, s.TX.CarrierErrors, s.TX.Collisions)
+		if e := s.TX.txErrors; e != nil {
+			fmt.Fprintf(w, "    TX errors: aborted  fifo   window heartbeat\n")
+			fmt.Fprintf(w, "               %-8d %-7d %-7d %-7d\n", e.AbortedErrors, e.FIFOErrors, e.WindowErrors, e.HeartbeatErrors)
 		}
-		fmt.Fprintf(w, " scope %s %s\n", addrScopes[netlink.Scope(addr.Scope)], addr.Label)
+	}
 
-		var validLft, preferredLft string
-		// TODO: fix vishnavanda/netlink. *Lft should be uint32, not int.
-		if uint32(addr.PreferedLft) == math.MaxUint32 {
-			preferredLft = "forever"
-		} else {
-			preferredLft = fmt.Sprintf("%dsec", addr.PreferedLft)
+	for _, ai := range li.AddrInfo {
+		fmt.Fprintf(w, "    %s %s/%d", ai.Family, ai.Local, ai.PrefixLen)
+		if ai.Broadcast != "" {
+			fmt.Fprintf(w, " brd %s", ai.Broadcast)
 		}
-		if uint32(addr.ValidLft) == math.MaxUint32 {
-			validLft = "forever"
-		} else {
-			validLft = fmt.Sprintf("%dsec", addr.ValidLft)
-		}
-		fmt.Fprintf(w, "       valid_lft %s preferred_lft %s\n", validLft, preferredLft)
+		fmt.Fprintf(w, " scope %s %s\n", ai.Scope, ai.Label)
+		fmt.Fprintf(w, "       valid_lft %s preferred_lft %s\n", lifetime(ai.ValidLifeTime), lifetime(ai.PreferredLifeTime))
 	}
-	return nil
 }
 
-var neighStates = map[int]string{
-	netlink.NUD_NONE:       "NONE",
-	netlink.NUD_INCOMPLETE: "INCOMPLETE",
-	netlink.NUD_REACHABLE:  "REACHABLE",
-	netlink.NUD_STALE:      "STALE",
-	netlink.NUD_DELAY:      "DELAY",
-	netlink.NUD_PROBE:      "PROBE",
-	netlink.NUD_FAILED:     "FAILED",
-	netlink.NUD_NOARP:      "NOARP",
-	netlink.NUD_PERMANENT:  "PERMANENT",
+func lifetime(t uint32) string {
+	// TODO: fix vishnavanda/netlink. *Lft should be uint32, not int.
+	if t == ^uint32(0) {
+		return "forever"
+	}
+	return fmt.Sprintf("%dsec", t)
+}
+
+// neighStates are the neighbour states in the order iproute2 shows them.
+var neighStates = []struct {
+	state int
+	name  string
+}{
+	{netlink.NUD_INCOMPLETE, "INCOMPLETE"},
+	{netlink.NUD_REACHABLE, "REACHABLE"},
+	{netlink.NUD_STALE, "STALE"},
+	{netlink.NUD_DELAY, "DELAY"},
+	{netlink.NUD_PROBE, "PROBE"},
+	{netlink.NUD_FAILED, "FAILED"},
+	{netlink.NUD_NOARP, "NOARP"},
+	{netlink.NUD_PERMANENT, "PERMANENT"},
 }
 
-func getState(state int) string {
-	ret := make([]string, 0)
-	for st, name := range neighStates {
-		if state&st != 0 {
-			ret = append(ret, name)
+func getState(state int) []string {
+	ret := []string{}
+	for _, st := range neighStates {
+		if state&st.state != 0 {
+			ret = append(ret, st.name)
 		}
 	}
 	if len(ret) == 0 {
-		return "UNKNOWN"
+		if state == netlink.NUD_NONE {
+			return []string{"NONE"}
+		}
+		return []string{"UNKNOWN"}
 	}
-	return strings.Join(ret, ",")
+	return ret
 }
 
-func showNeighbours(w io.Writer, withAddresses bool) error {
+type neighInfo struct {
+	Dst    string   `json:"dst"`
+	Dev    string   `json:"dev"`
+	LLAddr string   `json:"lladdr,omitempty"`
+	Router present  `json:"router,omitempty"`
+	State  []string `json:"state"`
+}
+
+func newNeighInfo(n netlink.Neigh, dev string) neighInfo {
+	ni := neighInfo{
+		Dst:    n.IP.String(),
+		Dev:    dev,
+		Router: n.Flags&netlink.NTF_ROUTER != 0,
+		State:  getState(n.State),
+	}
+	if n.HardwareAddr != nil {
+		ni.LLAddr = n.HardwareAddr.String()
+	}
+	return ni
+}
+
+func showNeighbours(w io.Writer) error {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return err
 	}
+	neighs := []neighInfo{}
 	for _, iface := range ifaces {
-		neighs, err := netlink.NeighList(iface.Index, 0)
+		list, err := netlink.NeighList(iface.Index, family)
 		if err != nil {
 			return fmt.Errorf("can't list neighbours: %v", err)
 		}
 
-		for _, v := range neighs {
+		for _, v := range list {
 			if v.State&netlink.NUD_NOARP != 0 {
 				continue
 			}
-			entry := fmt.Sprintf("%s dev %s", v.IP.String(), iface.Name)
-			if v.HardwareAddr != nil {
-				entry += fmt.Sprintf(" lladdr %s", v.HardwareAddr)
-			}
-			if v.Flags&netlink.NTF_ROUTER != 0 {
-				entry += " router"
-			}
-			entry += " " + getState(v.State)
-			fmt.Println(entry)
+			neighs = append(neighs, newNeighInfo(v, iface.Name))
+		}
+	}
+
+	if jsonOut {
+		return printJSON(w, neighs)
+	}
+	for _, n := range neighs {
+		entry := fmt.Sprintf("%s dev %s", n.Dst, n.Dev)
+		if n.LLAddr != "" {
+			entry += fmt.Sprintf(" lladdr %s", n.LLAddr)
+		}
+		if n.Router {
+			entry += " router"
 		}
+		entry += " " + strings.Join(n.State, ",")
+		fmt.Fprintln(w, entry)
 	}
 	return nil
 }
 
-const (
-	defaultFmt   = "default via %v dev %s proto %s metric %d\n"
-	routeFmt     = "%v dev %s proto %s scope %s src %s metric %d\n"
-	route6Fmt    = "%s dev %s proto %s metric %d\n"
-	routeVia6Fmt = "%s via %s dev %s proto %s metric %d\n"
-)
-
 // routing protocol identifier
 // specified in Linux Kernel header: include/uapi/linux/rtnetlink.h
 // See man IP-ROUTE(8) and RTNETLINK(7)
@@ -174,56 +433,227 @@ var rtProto = map[int]string{
 	unix.RTPROT_ZEBRA:    "zebra",
 }
 
-func showRoutes(inet6 bool) error {
-	var f int
-	if inet6 {
-		f = netlink.FAMILY_V6
-	} else {
-		f = netlink.FAMILY_V4
+// route types other than unicast.
+var rtTypes = map[int]string{
+	unix.RTN_LOCAL:       "local",
+	unix.RTN_BROADCAST:   "broadcast",
+	unix.RTN_ANYCAST:     "anycast",
+	unix.RTN_MULTICAST:   "multicast",
+	unix.RTN_BLACKHOLE:   "blackhole",
+	unix.RTN_UNREACHABLE: "unreachable",
+	unix.RTN_PROHIBIT:    "prohibit",
+	unix.RTN_THROW:       "throw",
+	unix.RTN_NAT:         "nat",
+}
+
+type routeInfo struct {
+	Type     string   `json:"type,omitempty"`
+	Dst      string   `json:"dst"`
+	Gateway  string   `json:"gateway,omitempty"`
+	Dev      string   `json:"dev,omitempty"`
+	Table    string   `json:"table,omitempty"`
+	Protocol string   `json:"protocol,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	PrefSrc  string   `json:"prefsrc,omitempty"`
+	Metric   int      `json:"metric,omitempty"`
+	Flags    []string `json:"flags"`
+}
+
+// newRouteInfo returns what ip route shows about r. names are the names of
+// the links by index.
+func newRouteInfo(r netlink.Route, names map[int]string) routeInfo {
+	ri := routeInfo{
+		Type:   rtTypes[r.Type],
+		Dst:    "default",
+		Dev:    names[r.LinkIndex],
+		Metric: r.Priority,
+		Flags:  append([]string{}, r.ListFlags()...),
+	}
+	if r.Dst != nil {
+		if ones, bits := r.Dst.Mask.Size(); ones == bits {
+			ri.Dst = r.Dst.IP.String()
+		} else {
+			ri.Dst = r.Dst.String()
+		}
+	}
+	if r.Gw != nil {
+		ri.Gateway = r.Gw.String()
 	}
+	if r.Table != unix.RT_TABLE_MAIN && r.Table != unix.RT_TABLE_UNSPEC {
+		ri.Table = tableName(r.Table)
+	}
+	if r.Protocol != unix.RTPROT_BOOT {
+		ri.Protocol = rtProto[r.Protocol]
+	}
+	if r.Scope != netlink.SCOPE_UNIVERSE {
+		ri.Scope = addrScopes[r.Scope]
+	}
+	if r.Src != nil {
+		ri.PrefSrc = r.Src.String()
+	}
+	return ri
+}
 
-	routes, err := netlink.RouteList(nil, f)
+func formatRoute(r routeInfo) string {
+	var s []string
+	if r.Type != "" {
+		s = append(s, r.Type)
+	}
+	s = append(s, r.Dst)
+	add := func(name, value string) {
+		if value != "" {
+			s = append(s, name, value)
+		}
+	}
+	add("via", r.Gateway)
+	add("dev", r.Dev)
+	add("table", r.Table)
+	add("proto", r.Protocol)
+	add("scope", r.Scope)
+	add("src", r.PrefSrc)
+	if r.Metric != 0 {
+		add("metric", fmt.Sprint(r.Metric))
+	}
+	s = append(s, r.Flags...)
+	return strings.Join(s, " ")
+}
+
+// showRoutes shows the routes of table t, or of all tables if t is 0.
+func showRoutes(w io.Writer, t int) error {
+	f := family
+	if f == netlink.FAMILY_ALL {
+		f = netlink.FAMILY_V4
+	}
+	routes, err := netlink.RouteListFiltered(f, &netlink.Route{Table: t}, netlink.RT_FILTER_TABLE)
 	if err != nil {
 		return err
 	}
-	for _, route := range routes {
-		link, err := netlink.LinkByIndex(route.LinkIndex)
-		if err != nil {
-			return err
-		}
-		if route.Dst == nil {
-			defaultRoute(route, link)
-		} else {
-			showRoute(route, link, f)
-		}
+	links, err := netlink.LinkList()
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string)
+	for _, l := range links {
+		names[l.Attrs().Index] = l.Attrs().Name
+	}
+
+	infos := []routeInfo{}
+	for _, r := range routes {
+		infos = append(infos, newRouteInfo(r, names))
+	}
+	if jsonOut {
+		return printJSON(w, infos)
+	}
+	for _, r := range infos {
+		fmt.Fprintln(w, formatRoute(r))
 	}
 	return nil
 }
 
-func defaultRoute(r netlink.Route, l netlink.Link) {
-	gw := r.Gw
-	name := l.Attrs().Name
-	proto := rtProto[r.Protocol]
-	metric := r.Priority
-	fmt.Printf(defaultFmt, gw, name, proto, metric)
-}
-
-func showRoute(r netlink.Route, l netlink.Link, f int) {
-	dest := r.Dst
-	name := l.Attrs().Name
-	proto := rtProto[r.Protocol]
-	metric := r.Priority
-	switch f {
-	case netlink.FAMILY_V4:
-		scope := addrScopes[r.Scope]
-		src := r.Src
-		fmt.Printf(routeFmt, dest, name, proto, scope, src, metric)
-	case netlink.FAMILY_V6:
-		if r.Gw != nil {
-			gw := r.Gw
-			fmt.Printf(routeVia6Fmt, dest, gw, name, proto, metric)
-		} else {
-			fmt.Printf(route6Fmt, dest, name, proto, metric)
+type ruleInfo struct {
+	Priority int     `json:"priority"`
+	Not      present `json:"not,omitempty"`
+	Src      string  `json:"src"`
+	SrcLen   int     `json:"srclen,omitempty"`
+	Dst      string  `json:"dst,omitempty"`
+	DstLen   int     `json:"dstlen,omitempty"`
+	IIf      string  `json:"iif,omitempty"`
+	OIf      string  `json:"oif,omitempty"`
+	FwMark   string  `json:"fwmark,omitempty"`
+	FwMask   string  `json:"fwmask,omitempty"`
+	Table    string  `json:"table,omitempty"`
+}
+
+// rulePrefix returns the address and prefix length of a rule's source or
+// destination. The length is 0 for single addresses.
+func rulePrefix(n *net.IPNet) (string, int) {
+	ones, bits := n.Mask.Size()
+	if ones == bits {
+		return n.IP.String(), 0
+	}
+	return n.IP.String(), ones
+}
+
+func newRuleInfo(r netlink.Rule) ruleInfo {
+	ri := ruleInfo{
+		Not: present(r.Invert),
+		Src: "all",
+		IIf: r.IifName,
+		OIf: r.OifName,
+	}
+	// The kernel leaves out priority 0.
+	if r.Priority > 0 {
+		ri.Priority = r.Priority
+	}
+	if r.Src != nil {
+		ri.Src, ri.SrcLen = rulePrefix(r.Src)
+	}
+	if r.Dst != nil {
+		ri.Dst, ri.DstLen = rulePrefix(r.Dst)
+	}
+	if r.Mark > 0 {
+		ri.FwMark = fmt.Sprintf("%#x", r.Mark)
+		if r.Mask > 0 && uint32(r.Mask) != ^uint32(0) {
+			ri.FwMask = fmt.Sprintf("%#x", r.Mask)
 		}
 	}
+	if r.Table > 0 {
+		ri.Table = tableName(r.Table)
+	}
+	return ri
+}
+
+func formatRule(r ruleInfo) string {
+	s := fmt.Sprintf("%d:\t", r.Priority)
+	if r.Not {
+		s += "not "
+	}
+	s += "from " + r.Src
+	if r.SrcLen > 0 {
+		s += fmt.Sprintf("/%d", r.SrcLen)
+	}
+	if r.Dst != "" {
+		s += " to " + r.Dst
+		if r.DstLen > 0 {
+			s += fmt.Sprintf("/%d", r.DstLen)
+		}
+	}
+	if r.FwMark != "" {
+		s += " fwmark " + r.FwMark
+		if r.FwMask != "" {
+			s += "/" + r.FwMask
+		}
+	}
+	if r.IIf != "" {
+		s += " iif " + r.IIf
+	}
+	if r.OIf != "" {
+		s += " oif " + r.OIf
+	}
+	if r.Table != "" {
+		s += " lookup " + r.Table
+	}
+	return s
+}
+
+func showRules(w io.Writer) error {
+	f := family
+	if f == netlink.FAMILY_ALL {
+		f = netlink.FAMILY_V4
+	}
+	rules, err := netlink.RuleList(f)
+	if err != nil {
+		return fmt.Errorf("can't list rules: %v", err)
+	}
+	infos := []ruleInfo{}
+	for _, r := range rules {
+		infos = append(infos, newRuleInfo(r))
+	}
+	if jsonOut {
+		return printJSON(w, infos)
+	}
+	for _, r := range infos {
+		fmt.Fprintln(w, formatRule(r))
+	}
+	return nil
 }
@@ -5,7 +5,7 @@
 // kexec executes a new kernel over the running kernel (u-root).
 //
 // Synopsis:
-//     kexec [--initrd=FILE] [--command-line=STRING] [-l] [-e] [KERNELIMAGE]
+//     kexec [--initrd=FILE] [--dtb=FILE] [--command-line=STRING] [-l] [-e] [KERNELIMAGE]
 //
 // Description:
 //		 Loads a kernel for later execution.
@@ -14,6 +14,7 @@
 //     --cmdline=STRING or -c=STRING: Set the kernel command line
 //     --reuse-commandline:           Use the kernel command line from running system
 //     --i=FILE or --initrd=FILE:     Use file as the kernel's initial ramdisk
+//     --dtb=FILE:                    Use file as the kernel's device tree (arm64)
 //     -l or --load:                  Load the new kernel into the current kernel
 //     -e or --exec:                  Execute a currently loaded kernel
 package main
@@ -36,6 +37,7 @@ type options struct {
 	cmdline      string
 	reuseCmdline bool
 	initramfs    string
+	dtb          string
 	load         bool
 	exec         bool
 	debug        bool
@@ -49,6 +51,7 @@ func registerFlags() *options {
 	flag.BoolVar(&o.reuseCmdline, "reuse-cmdline", false, "Use the kernel command line from running system")
 	flag.StringVarP(&o.initramfs, "initrd", "i", "", "Use file as the kernel's initial ramdisk")
 	flag.StringVar(&o.initramfs, "initramfs", "", "Use file as the kernel's initial ramdisk")
+	flag.StringVar(&o.dtb, "dtb", "", "Use file as the kernel's device tree (arm64)")
 	flag.BoolVarP(&o.load, "load", "l", false, "Load the new kernel into the current kernel")
 	flag.BoolVarP(&o.exec, "exec", "e", false, "Execute a currently loaded kernel")
 	flag.BoolVarP(&o.debug, "debug", "d", false, "Print debug info")
@@ -104,10 +107,15 @@ func main() {
 			if opts.initramfs != "" {
 				i = uio.NewLazyFile(opts.initramfs)
 			}
+			var dtb io.ReaderAt
+			if opts.dtb != "" {
+				dtb = uio.NewLazyFile(opts.dtb)
+			}
 			image = &boot.LinuxImage{
 				Kernel:  uio.NewLazyFile(kernelpath),
 				Initrd:  i,
 				Cmdline: newCmdline,
+				DTB:     dtb,
 			}
 		}
 		if err := image.Load(opts.debug); err != nil {
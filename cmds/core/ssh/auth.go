@@ -0,0 +1,173 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/termios"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ttyOnce sync.Once
+	tty     *termios.TTYIO
+	ttyIn   *bufio.Reader
+	ttyErr  error
+)
+
+// prompt asks question on the terminal, which need not be stdin, and
+// returns the answer. Unless echo is set, the answer is not shown.
+func prompt(question string, echo bool) (string, error) {
+	ttyOnce.Do(func() {
+		if tty, ttyErr = termios.New(); ttyErr == nil {
+			ttyIn = bufio.NewReader(tty)
+		}
+	})
+	if ttyErr != nil {
+		return "", fmt.Errorf("no terminal: %v", ttyErr)
+	}
+
+	if !echo {
+		old, err := tty.Get()
+		if err != nil {
+			return "", err
+		}
+		noEcho := *old.Termios
+		noEcho.Lflag &^= unix.ECHO
+		if err := tty.Set(&termios.Termios{Termios: &noEcho}); err != nil {
+			return "", err
+		}
+		defer func() {
+			tty.Set(old)
+			// The newline was not echoed either.
+			fmt.Fprintln(tty)
+		}()
+	}
+
+	fmt.Fprint(tty, question)
+	answer, err := ttyIn.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(answer, "\r\n"), nil
+}
+
+// signers returns the keys in files, or in the default key files if there
+// are none.
+func signers(files []string) []ssh.Signer {
+	explicit := len(files) > 0
+	if !explicit {
+		for _, k := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			files = append(files, filepath.Join(sshDir(), k))
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			if explicit || !os.IsNotExist(err) {
+				log.Print(err)
+			}
+			continue
+		}
+		s, err := ssh.ParsePrivateKey(b)
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			var pass string
+			if pass, err = prompt(fmt.Sprintf("Enter passphrase for key '%s': ", file), false); err == nil {
+				s, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(pass))
+			}
+		}
+		if err != nil {
+			log.Printf("%s: %v", file, err)
+			continue
+		}
+		signers = append(signers, s)
+	}
+	return signers
+}
+
+// authMethods returns the ways to log in as user on host: keys first, and
+// then passwords.
+func authMethods(user, host string) []ssh.AuthMethod {
+	return []ssh.AuthMethod{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			return signers(identities), nil
+		}),
+		ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+			return prompt(fmt.Sprintf("%s@%s's password: ", user, host), false)
+		}), 3),
+		ssh.RetryableAuthMethod(ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			if name != "" {
+				fmt.Fprintln(os.Stderr, name)
+			}
+			if instruction != "" {
+				fmt.Fprintln(os.Stderr, instruction)
+			}
+			answers := make([]string, len(questions))
+			for i, q := range questions {
+				var err error
+				if answers[i], err = prompt(q, echos[i]); err != nil {
+					return nil, err
+				}
+			}
+			return answers, nil
+		}), 3),
+	}
+}
+
+// hostKeyCallback checks host keys against those in the known_hosts file.
+// It asks whether to add the keys of unknown hosts, and refuses keys that
+// do not match.
+func hostKeyCallback(file string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		check, err := knownhosts.New(file)
+		if err == nil {
+			err = check(hostname, remote, key)
+		} else if os.IsNotExist(err) {
+			err = &knownhosts.KeyError{}
+		}
+		var ke *knownhosts.KeyError
+		if !errors.As(err, &ke) || len(ke.Want) > 0 {
+			// Nil, a mismatch, a revoked key or a bad file.
+			return err
+		}
+
+		fp := ssh.FingerprintSHA256(key)
+		answer, err := prompt(fmt.Sprintf("The authenticity of host '%s' can't be established.\n%s key fingerprint is %s.\nAre you sure you want to continue connecting (yes/no)? ", hostname, key.Type(), fp), true)
+		if err != nil {
+			return fmt.Errorf("host key %s of %s is not in %s, and there is %v", fp, hostname, file, err)
+		}
+		if answer != "yes" {
+			return fmt.Errorf("host key verification failed")
+		}
+
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: Permanently added '%s' (%s) to the list of known hosts.\n", hostname, key.Type())
+		return nil
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// ssh logs in to a remote machine and runs commands there.
+//
+// Synopsis:
+//     ssh [OPTIONS] [USER@]HOST [COMMAND [ARGS]...]
+//
+// Description:
+//     ssh runs COMMAND on HOST, or a shell if there is no COMMAND. Shells
+//     get a pty when ssh runs on a terminal.
+//
+//     ssh logs in with the -i keys, or ~/.ssh/id_ed25519, id_ecdsa and
+//     id_rsa, and then asks for a password. It checks the host key of HOST
+//     against ~/.ssh/known_hosts, and asks whether to add unknown keys.
+//
+//     The exit status is that of COMMAND, or 255 if ssh fails.
+//
+// Options:
+//     -i:          private key file; may be repeated
+//     -l:          user to log in as
+//     -p:          port to connect to
+//     -L:          [BIND_ADDRESS:]PORT:HOST:HOSTPORT forwards local PORT to
+//                  HOST:HOSTPORT on the remote side; may be repeated
+//     -N:          do not run a command, just forward ports
+//     -t:          request a pty, even without a terminal
+//     -T:          do not request a pty
+//     -knownhosts: known_hosts file
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/termios"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sys/unix"
+)
+
+// list is a flag that may be repeated.
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+var (
+	identities list
+	forwards   list
+	login      = flag.String("l", "", "User to log in as")
+	port       = flag.String("p", "22", "Port to connect to")
+	noCommand  = flag.Bool("N", false, "Do not run a command, just forward ports")
+	forcePTY   = flag.Bool("t", false, "Request a pty, even without a terminal")
+	noPTY      = flag.Bool("T", false, "Do not request a pty")
+	knownHosts = flag.String("knownhosts", filepath.Join(sshDir(), "known_hosts"), "known_hosts file")
+)
+
+func init() {
+	flag.Var(&identities, "i", "Private key file; may be repeated")
+	flag.Var(&forwards, "L", "[BIND_ADDRESS:]PORT:HOST:HOSTPORT forwards local PORT to HOST:HOSTPORT on the remote side; may be repeated")
+}
+
+func sshDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "/"
+	}
+	return filepath.Join(home, ".ssh")
+}
+
+// isTerminal returns whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	_, err := termios.GetTermios(f.Fd())
+	return err == nil
+}
+
+// userHost splits [USER@]HOST, with the user from -l or the environment if
+// there is none.
+func userHost(arg string) (string, string) {
+	if i := strings.LastIndex(arg, "@"); i >= 0 {
+		return arg[:i], arg[i+1:]
+	}
+	if *login != "" {
+		return *login, arg
+	}
+	if u := os.Getenv("USER"); u != "" {
+		return u, arg
+	}
+	return "root", arg
+}
+
+// splitForward splits a forward at colons, but not at those of IPv6
+// addresses in brackets, which it takes off.
+func splitForward(spec string) []string {
+	var parts []string
+	var part []byte
+	bracket := false
+	for i := 0; i < len(spec); i++ {
+		switch c := spec[i]; {
+		case c == '[':
+			bracket = true
+		case c == ']':
+			bracket = false
+		case c == ':' && !bracket:
+			parts = append(parts, string(part))
+			part = nil
+		default:
+			part = append(part, c)
+		}
+	}
+	return append(parts, string(part))
+}
+
+// parseForward parses a -L forward, and returns the local address to listen
+// on and the remote address to connect to.
+func parseForward(spec string) (string, string, error) {
+	parts := splitForward(spec)
+	bind := "localhost"
+	switch len(parts) {
+	case 3:
+	case 4:
+		bind, parts = parts[0], parts[1:]
+		if bind == "*" {
+			bind = ""
+		}
+	default:
+		return "", "", fmt.Errorf("bad forward %q: want [BIND_ADDRESS:]PORT:HOST:HOSTPORT", spec)
+	}
+	return net.JoinHostPort(bind, parts[0]), net.JoinHostPort(parts[1], parts[2]), nil
+}
+
+// relay copies between a and b both ways until both are done.
+func relay(a, b net.Conn) {
+	type closeWriter interface {
+		CloseWrite() error
+	}
+	done := make(chan struct{})
+	cp := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if cw, ok := dst.(closeWriter); ok {
+			cw.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+	<-done
+	a.Close()
+	b.Close()
+}
+
+// forward accepts connections on l and relays them to remote through
+// client.
+func forward(client *ssh.Client, l net.Listener, remote string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			rc, err := client.Dial("tcp", remote)
+			if err != nil {
+				log.Printf("Could not forward %v to %s: %v", conn.RemoteAddr(), remote, err)
+				conn.Close()
+				return
+			}
+			relay(conn, rc)
+		}()
+	}
+}
+
+// session runs command, or a shell if command is empty.
+func session(client *ssh.Client, command string, pty bool) error {
+	s, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	s.Stdin, s.Stdout, s.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	if pty {
+		tty, err := termios.New()
+		if err != nil {
+			return err
+		}
+		ws, err := tty.GetWinSize()
+		if err != nil {
+			return err
+		}
+		term := os.Getenv("TERM")
+		if term == "" {
+			term = "vt100"
+		}
+		if err := s.RequestPty(term, int(ws.Row), int(ws.Col), ssh.TerminalModes{}); err != nil {
+			return err
+		}
+		restorer, err := tty.Raw()
+		if err != nil {
+			return err
+		}
+		defer tty.Set(restorer)
+
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, unix.SIGWINCH)
+		defer signal.Stop(winch)
+		go func() {
+			for range winch {
+				if ws, err := tty.GetWinSize(); err == nil {
+					s.WindowChange(int(ws.Row), int(ws.Col))
+				}
+			}
+		}()
+	}
+
+	if command == "" {
+		err = s.Shell()
+	} else {
+		err = s.Start(command)
+	}
+	if err != nil {
+		return err
+	}
+	return s.Wait()
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(255)
+	}
+	user, host := userHost(args[0])
+	command := strings.Join(args[1:], " ")
+
+	var locals, remotes []string
+	for _, f := range forwards {
+		local, remote, err := parseForward(f)
+		if err != nil {
+			return err
+		}
+		locals, remotes = append(locals, local), append(remotes, remote)
+	}
+
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            authMethods(user, host),
+		HostKeyCallback: hostKeyCallback(*knownHosts),
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(host, *port), config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for i, local := range locals {
+		l, err := net.Listen("tcp", local)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		go forward(client, l, remotes[i])
+	}
+
+	if *noCommand {
+		return client.Wait()
+	}
+	// Like OpenSSH, shells get a pty on a terminal, commands only with -t.
+	pty := *forcePTY || (command == "" && isTerminal(os.Stdin))
+	return session(client, command, pty && !*noPTY)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ssh: ")
+	flag.Parse()
+	err := run(flag.Args())
+	if e, ok := err.(*ssh.ExitError); ok {
+		os.Exit(e.ExitStatus())
+	}
+	if err != nil {
+		log.Print(err)
+		os.Exit(255)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/golang"
+	"github.com/u-root/u-root/pkg/testutil"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestParseForward(t *testing.T) {
+	for _, tt := range []struct {
+		spec   string
+		local  string
+		remote string
+		err    bool
+	}{
+		{spec: "8080:example.com:80", local: "localhost:8080", remote: "example.com:80"},
+		{spec: "127.0.0.1:8080:example.com:80", local: "127.0.0.1:8080", remote: "example.com:80"},
+		{spec: "*:8080:example.com:80", local: ":8080", remote: "example.com:80"},
+		{spec: "[::1]:8080:[fe80::1]:80", local: "[::1]:8080", remote: "[fe80::1]:80"},
+		{spec: "8080:example.com", err: true},
+		{spec: "a:b:c:d:e", err: true},
+	} {
+		local, remote, err := parseForward(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("parseForward(%q): got %v, want error %t", tt.spec, err, tt.err)
+			continue
+		}
+		if local != tt.local || remote != tt.remote {
+			t.Errorf("parseForward(%q): got %q, %q, want %q, %q", tt.spec, local, remote, tt.local, tt.remote)
+		}
+	}
+}
+
+func TestUserHost(t *testing.T) {
+	defer func(l string) { *login = l }(*login)
+	defer os.Setenv("USER", os.Getenv("USER"))
+	os.Setenv("USER", "env")
+
+	for _, tt := range []struct {
+		arg   string
+		login string
+		user  string
+		host  string
+	}{
+		{arg: "root@host", login: "flag", user: "root", host: "host"},
+		{arg: "a@b@host", user: "a@b", host: "host"},
+		{arg: "host", login: "flag", user: "flag", host: "host"},
+		{arg: "host", user: "env", host: "host"},
+	} {
+		*login = tt.login
+		if user, host := userHost(tt.arg); user != tt.user || host != tt.host {
+			t.Errorf("userHost(%q) with -l %q: got %q, %q, want %q, %q", tt.arg, tt.login, user, host, tt.user, tt.host)
+		}
+	}
+}
+
+// writeKey writes a new private key to file, and returns its signer.
+func writeKey(t *testing.T, file string) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// waitDial dials addr until something listens there.
+func waitDial(t *testing.T, addr string) net.Conn {
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			return conn
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// server is the in-tree sshd, running on the loopback.
+type server struct {
+	dir      string
+	port     string
+	identity string
+	hostKey  ssh.PublicKey
+}
+
+func startServer(t *testing.T) (*server, func()) {
+	testutil.SkipIfInVMTest(t)
+	dir, err := ioutil.TempDir("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshd := filepath.Join(dir, "sshd")
+	if err := golang.Default().BuildDir("../sshd", sshd, golang.BuildOpts{}); err != nil {
+		os.RemoveAll(dir)
+		t.Skipf("Could not build sshd: %v", err)
+	}
+
+	s := &server{
+		dir:      dir,
+		port:     freePort(t),
+		identity: filepath.Join(dir, "id_ed25519"),
+	}
+	user := writeKey(t, s.identity)
+	hostKeyFile := filepath.Join(dir, "ssh_host_key")
+	s.hostKey = writeKey(t, hostKeyFile).PublicKey()
+	authorized := filepath.Join(dir, "authorized_keys")
+	if err := ioutil.WriteFile(authorized, ssh.MarshalAuthorizedKey(user.PublicKey()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := exec.Command(sshd, "-ip", "127.0.0.1", "-port", s.port, "-keys", authorized, "-privatekey", hostKeyFile)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitDial(t, net.JoinHostPort("127.0.0.1", s.port)).Close()
+	return s, func() {
+		c.Process.Kill()
+		c.Wait()
+		os.RemoveAll(dir)
+	}
+}
+
+// knownHosts writes a known_hosts file with key for the server.
+func (s *server) knownHosts(t *testing.T, name string, key ssh.PublicKey) string {
+	file := filepath.Join(s.dir, name)
+	line := knownhosts.Line([]string{knownhosts.Normalize(net.JoinHostPort("127.0.0.1", s.port))}, key)
+	if err := ioutil.WriteFile(file, []byte(line+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// command returns ssh with args, without a terminal to ask questions on.
+func (s *server) command(t *testing.T, knownHosts string, args ...string) *exec.Cmd {
+	c := testutil.Command(t, append([]string{"-i", s.identity, "-knownhosts", knownHosts, "-p", s.port}, args...)...)
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return c
+}
+
+func TestLoopback(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip(err)
+	}
+	s, stop := startServer(t)
+	defer stop()
+	known := s.knownHosts(t, "known_hosts", s.hostKey)
+
+	t.Run("exec", func(t *testing.T) {
+		out, err := s.command(t, known, "root@127.0.0.1", "echo", "hello;", "exit 3").Output()
+		if err := testutil.IsExitCode(err, 3); err != nil {
+			t.Error(err)
+		}
+		if string(out) != "hello\n" {
+			t.Errorf("output: got %q, want %q", out, "hello\n")
+		}
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		empty := filepath.Join(s.dir, "empty")
+		out, err := s.command(t, empty, "127.0.0.1", "true").CombinedOutput()
+		if err := testutil.IsExitCode(err, 255); err != nil {
+			t.Errorf("%v: %s", err, out)
+		}
+		if _, err := os.Stat(empty); !os.IsNotExist(err) {
+			t.Errorf("ssh wrote %s without asking", empty)
+		}
+	})
+
+	t.Run("changed host key", func(t *testing.T) {
+		other := s.knownHosts(t, "other", writeKey(t, filepath.Join(s.dir, "other_key")).PublicKey())
+		out, err := s.command(t, other, "127.0.0.1", "true").CombinedOutput()
+		if err := testutil.IsExitCode(err, 255); err != nil {
+			t.Errorf("%v: %s", err, out)
+		}
+	})
+
+	t.Run("forward", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					io.Copy(conn, conn)
+					conn.Close()
+				}()
+			}
+		}()
+
+		local := net.JoinHostPort("127.0.0.1", freePort(t))
+		c := s.command(t, known, "-N", "-L", fmt.Sprintf("%s:%s", local, l.Addr()), "127.0.0.1")
+		if err := c.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			c.Process.Kill()
+			c.Wait()
+		}()
+
+		conn := waitDial(t, local)
+		defer conn.Close()
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "ping" {
+			t.Errorf("forward: got %q, want %q", b, "ping")
+		}
+	})
+}
+
+func TestMain(m *testing.M) {
+	testutil.Run(m, main)
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type (
+	// tcpipReq is the extra data of "direct-tcpip" and
+	// "forwarded-tcpip" channels.
+	tcpipReq struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	tcpipForwardReq struct {
+		BindAddr string
+		BindPort uint32
+	}
+	tcpipForwardReply struct {
+		Port uint32
+	}
+)
+
+// relay copies between c and conn both ways until both are done.
+func relay(c ssh.Channel, conn net.Conn) {
+	defer c.Close()
+	defer conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(c, conn)
+		c.CloseWrite()
+		close(done)
+	}()
+	io.Copy(conn, c)
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.CloseWrite()
+	}
+	<-done
+}
+
+// directTCPIP connects a "direct-tcpip" channel, as for ssh -L, to the
+// host it asks for.
+func directTCPIP(nc ssh.NewChannel) {
+	r := &tcpipReq{}
+	if err := ssh.Unmarshal(nc.ExtraData(), r); err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	addr := net.JoinHostPort(r.Host, strconv.Itoa(int(r.Port)))
+	dprintf("direct-tcpip from %s:%d to %s", r.OriginHost, r.OriginPort, addr)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	c, reqs, err := nc.Accept()
+	if err != nil {
+		log.Printf("Could not accept channel: %v", err)
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	relay(c, conn)
+}
+
+// forward accepts connections on l, as for ssh -R, and relays them through
+// "forwarded-tcpip" channels.
+func forward(conn *ssh.ServerConn, l net.Listener, addr string, port uint32) {
+	for {
+		lc, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			r := tcpipReq{Host: addr, Port: port}
+			if ra, ok := lc.RemoteAddr().(*net.TCPAddr); ok {
+				r.OriginHost, r.OriginPort = ra.IP.String(), uint32(ra.Port)
+			}
+			c, reqs, err := conn.OpenChannel("forwarded-tcpip", ssh.Marshal(r))
+			if err != nil {
+				dprintf("forwarded-tcpip to %s: %v", conn.RemoteAddr(), err)
+				lc.Close()
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			relay(c, lc)
+		}()
+	}
+}
+
+// listenAddr returns the address to listen on for a "tcpip-forward" request
+// of bindAddr and port. As with OpenSSH's GatewayPorts=no, forwarded ports
+// are only reachable from this machine unless the client asks for an
+// address explicitly.
+func listenAddr(bindAddr string, port uint32) string {
+	if bindAddr == "" {
+		bindAddr = "127.0.0.1"
+	}
+	return net.JoinHostPort(bindAddr, strconv.Itoa(int(port)))
+}
+
+// globalRequests serves the requests of a connection, which are to forward
+// ports, until the connection is gone.
+func globalRequests(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := map[string]net.Listener{}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	for req := range reqs {
+		dprintf("Global request %v", req.Type)
+		switch req.Type {
+		case "tcpip-forward":
+			r := &tcpipForwardReq{}
+			if err := ssh.Unmarshal(req.Payload, r); err != nil {
+				log.Printf("sshd: %v", err)
+				req.Reply(false, nil)
+				break
+			}
+			l, err := net.Listen("tcp", listenAddr(r.BindAddr, r.BindPort))
+			if err != nil {
+				log.Printf("sshd: %v", err)
+				req.Reply(false, nil)
+				break
+			}
+			// The client asks for port 0 to get any port, and cancels
+			// with the port it got.
+			port := uint32(l.Addr().(*net.TCPAddr).Port)
+			listeners[net.JoinHostPort(r.BindAddr, strconv.Itoa(int(port)))] = l
+			go forward(conn, l, r.BindAddr, port)
+			if r.BindPort == 0 {
+				req.Reply(true, ssh.Marshal(tcpipForwardReply{port}))
+			} else {
+				req.Reply(true, nil)
+			}
+		case "cancel-tcpip-forward":
+			r := &tcpipForwardReq{}
+			if err := ssh.Unmarshal(req.Payload, r); err != nil {
+				req.Reply(false, nil)
+				break
+			}
+			key := net.JoinHostPort(r.BindAddr, strconv.Itoa(int(r.BindPort)))
+			l, ok := listeners[key]
+			if ok {
+				l.Close()
+				delete(listeners, key)
+			}
+			req.Reply(ok, nil)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
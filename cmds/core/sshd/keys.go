@@ -0,0 +1,121 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/cmdline"
+	"github.com/u-root/u-root/pkg/vpd"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// cmdlineKeys is the kernel command line variable with authorized
+	// keys, separated by commas.
+	cmdlineKeys = "sshd.authorized_keys"
+
+	// vpdKeys is the VPD variable with authorized keys, in the format of
+	// an authorized_keys file.
+	vpdKeys = "ssh_authorized_keys"
+)
+
+// parseAuthorizedKeys adds the keys in b, in the format of an
+// authorized_keys file, to keys.
+func parseAuthorizedKeys(keys map[string]bool, b []byte) error {
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", i+1, err)
+		}
+		keys[string(pubKey.Marshal())] = true
+	}
+	return nil
+}
+
+// authorizedKeys returns the keys that may log in, from file, the kernel
+// command line and VPD. It is an error if there are none.
+func authorizedKeys(file string) (map[string]bool, error) {
+	keys := map[string]bool{}
+	b, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := parseAuthorizedKeys(keys, b); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	if v, ok := cmdline.Flag(cmdlineKeys); ok {
+		if err := parseAuthorizedKeys(keys, []byte(strings.Replace(v, ",", "\n", -1))); err != nil {
+			return nil, fmt.Errorf("kernel command line %s: %v", cmdlineKeys, err)
+		}
+	}
+
+	for _, readOnly := range []bool{true, false} {
+		b, err := vpd.Get(vpdKeys, readOnly)
+		if err != nil {
+			continue
+		}
+		if err := parseAuthorizedKeys(keys, b); err != nil {
+			return nil, fmt.Errorf("VPD %s: %v", vpdKeys, err)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no authorized keys in %s, the kernel command line (%s) or VPD (%s)", file, cmdlineKeys, vpdKeys)
+	}
+	return keys, nil
+}
+
+// hostKey reads the host key from file. If there is no file, hostKey
+// generates a key and writes it there, with the public key in file.pub.
+func hostKey(file string) (ssh.Signer, error) {
+	b, err := ioutil.ReadFile(file)
+	if err == nil {
+		return ssh.ParsePrivateKey(b)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(file+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		return nil, err
+	}
+	log.Printf("Generated host key %s: %s", file, ssh.FingerprintSHA256(signer.PublicKey()))
+	return signer, nil
+}
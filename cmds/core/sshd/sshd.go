@@ -2,19 +2,46 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// sshd is a small SSH server.
+//
+// Synopsis:
+//     sshd [OPTIONS]
+//
+// Description:
+//     sshd runs shells and commands, with or without a pty, serves the
+//     "sftp" subsystem, and forwards TCP connections both ways (ssh -L and
+//     ssh -R). It passes the environment variables clients send on to
+//     commands.
+//
+//     Clients log in with public keys only. sshd takes the keys from the
+//     -keys file, from the kernel command line, as a comma-separated list
+//     in sshd.authorized_keys="...", and from the VPD variable
+//     ssh_authorized_keys.
+//
+//     If the -privatekey file does not exist, sshd generates an ed25519
+//     host key in it on its first start, and writes the public key next to
+//     it.
+//
+// Options:
+//     -d:          enable debug prints
+//     -keys:       path to the authorized_keys file
+//     -privatekey: path of the host key
+//     -ip:         ip address to listen on
+//     -port:       port to listen on
 package main
 
 import (
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net"
 	"os"
 	"os/exec"
 
 	"github.com/u-root/u-root/pkg/pty"
+	"github.com/u-root/u-root/pkg/sftp"
+	"github.com/u-root/u-root/pkg/termios"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -28,9 +55,22 @@ type (
 		Ypixel uint32
 		Modes  string //encoded terminal modes
 	}
+	windowChangeReq struct {
+		Col    uint32
+		Row    uint32
+		Xpixel uint32
+		Ypixel uint32
+	}
+	envReq struct {
+		Name  string
+		Value string
+	}
 	execReq struct {
 		Command string
 	}
+	subsystemReq struct {
+		Name string
+	}
 	exitStatusReq struct {
 		ExitStatus uint32
 	}
@@ -47,34 +87,63 @@ var (
 	dprintf = func(string, ...interface{}) {}
 )
 
-// start a command
-// TODO: use /etc/passwd, but the Go support for that is incomplete
-func runCommand(c ssh.Channel, p *pty.Pty, cmd string, args ...string) error {
-	var ps *os.ProcessState
-	defer c.Close()
+// session is a "session" channel, which runs one command.
+type session struct {
+	c   ssh.Channel
+	pty *pty.Pty
+	env []string
+}
 
-	if p != nil {
+// start starts a command, which exits with the channel.
+// TODO: use /etc/passwd, but the Go support for that is incomplete
+func (s *session) start(cmd string, args ...string) error {
+	var e *exec.Cmd
+	var stdin io.WriteCloser
+	if s.pty != nil {
 		log.Printf("Executing PTY command %s %v", cmd, args)
-		p.Command(cmd, args...)
-		if err := p.C.Start(); err != nil {
-			dprintf("Failed to execute: %v", err)
-			return err
-		}
-		defer p.C.Wait()
-		go io.Copy(p.Ptm, c)
-		go io.Copy(c, p.Ptm)
-		ps, _ = p.C.Process.Wait()
+		s.pty.Command(cmd, args...)
+		e = s.pty.C
+		stdin = s.pty.Ptm
 	} else {
-		e := exec.Command(cmd, args...)
-		e.Stdin, e.Stdout, e.Stderr = c, c, c
 		log.Printf("Executing non-PTY command %s %v", cmd, args)
-		if err := e.Start(); err != nil {
-			dprintf("Failed to execute: %v", err)
+		e = exec.Command(cmd, args...)
+		e.Stdout, e.Stderr = s.c, s.c.Stderr()
+		// Wait would wait for the client to close stdin if it were the
+		// channel.
+		var err error
+		if stdin, err = e.StdinPipe(); err != nil {
 			return err
 		}
-		ps, _ = e.Process.Wait()
+	}
+	e.Env = append(os.Environ(), s.env...)
+	if err := e.Start(); err != nil {
+		dprintf("Failed to execute: %v", err)
+		return err
 	}
 
+	go func() {
+		io.Copy(stdin, s.c)
+		if s.pty == nil {
+			stdin.Close()
+		}
+	}()
+	go func() {
+		defer s.c.Close()
+		if s.pty != nil {
+			// The command has the Pts now. Without our copy, reading
+			// the Ptm ends when the command is gone.
+			s.pty.Pts.Close()
+			defer s.pty.Ptm.Close()
+			io.Copy(s.c, s.pty.Ptm)
+		}
+		e.Wait()
+		s.exit(e.ProcessState)
+	}()
+	return nil
+}
+
+// exit sends the exit status of a command.
+func (s *session) exit(ps *os.ProcessState) {
 	// TODO(bluecmd): If somebody wants we can send exit-signal to return
 	// information about signal termination, but leave it until somebody needs
 	// it.
@@ -83,39 +152,59 @@ func runCommand(c ssh.Channel, p *pty.Pty, cmd string, args ...string) error {
 	if ps.Exited() {
 		code := uint32(ps.ExitCode())
 		dprintf("Exit status %v", code)
-		c.SendRequest("exit-status", false, ssh.Marshal(exitStatusReq{code}))
+		s.c.SendRequest("exit-status", false, ssh.Marshal(exitStatusReq{code}))
 	}
-	return nil
 }
 
-func newPTY(b []byte) (*pty.Pty, error) {
+// sftp serves the "sftp" subsystem.
+func (s *session) sftp() {
+	defer s.c.Close()
+	code := uint32(0)
+	if err := sftp.NewServer(s.c).Serve(); err != nil {
+		log.Printf("sftp: %v", err)
+		code = 1
+	}
+	s.c.SendRequest("exit-status", false, ssh.Marshal(exitStatusReq{code}))
+}
+
+func newPTY(b []byte) (*pty.Pty, string, error) {
 	ptyReq := &ptyReq{}
 	err := ssh.Unmarshal(b, ptyReq)
 	dprintf("newPTY: %q", ptyReq)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	p, err := pty.New()
 	if err != nil {
-		return nil, err
-	}
-	ws, err := p.TTY.GetWinSize()
-	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	ws := &termios.Winsize{}
 	ws.Row = uint16(ptyReq.Row)
 	ws.Ypixel = uint16(ptyReq.Ypixel)
 	ws.Col = uint16(ptyReq.Col)
 	ws.Xpixel = uint16(ptyReq.Xpixel)
 	dprintf("newPTY: Set winsizes to %v", ws)
-	if err := p.TTY.SetWinSize(ws); err != nil {
-		return nil, err
+	if err := p.SetWinSize(ws); err != nil {
+		return nil, "", err
 	}
-	dprintf("newPTY: set TERM to %q", ptyReq.TERM)
-	if err := os.Setenv("TERM", ptyReq.TERM); err != nil {
-		return nil, err
+	return p, ptyReq.TERM, nil
+}
+
+func (s *session) windowChange(b []byte) error {
+	if s.pty == nil {
+		return fmt.Errorf("no pty")
+	}
+	wc := &windowChangeReq{}
+	if err := ssh.Unmarshal(b, wc); err != nil {
+		return err
 	}
-	return p, nil
+	ws := &termios.Winsize{}
+	ws.Row = uint16(wc.Row)
+	ws.Ypixel = uint16(wc.Ypixel)
+	ws.Col = uint16(wc.Col)
+	ws.Xpixel = uint16(wc.Xpixel)
+	dprintf("windowChange: Set winsizes to %v", ws)
+	return s.pty.SetWinSize(ws)
 }
 
 func init() {
@@ -126,15 +215,79 @@ func init() {
 	}
 }
 
-func session(chans <-chan ssh.NewChannel) {
-	var p *pty.Pty
+// requests serves the requests of a session. Commands run in the
+// background, so that their window changes come through.
+func (s *session) requests(in <-chan *ssh.Request) {
+	for req := range in {
+		dprintf("Request %v", req.Type)
+		switch req.Type {
+		case "shell":
+			err := s.start(shell)
+			req.Reply(err == nil, nil)
+		case "exec":
+			e := &execReq{}
+			if err := ssh.Unmarshal(req.Payload, e); err != nil {
+				log.Printf("sshd: %v", err)
+				req.Reply(false, nil)
+				break
+			}
+			// Execute command using user's shell. This is what OpenSSH does
+			// so it's the least surprising to the user.
+			err := s.start(shell, "-c", e.Command)
+			req.Reply(err == nil, nil)
+		case "subsystem":
+			e := &subsystemReq{}
+			if err := ssh.Unmarshal(req.Payload, e); err != nil || e.Name != "sftp" {
+				log.Printf("sshd: no subsystem %q", e.Name)
+				req.Reply(false, nil)
+				break
+			}
+			req.Reply(true, nil)
+			go s.sftp()
+		case "pty-req":
+			p, term, err := newPTY(req.Payload)
+			if err != nil {
+				log.Printf("sshd: %v", err)
+			} else {
+				s.pty = p
+				s.env = append(s.env, "TERM="+term)
+			}
+			req.Reply(err == nil, nil)
+		case "window-change":
+			err := s.windowChange(req.Payload)
+			if err != nil {
+				dprintf("window-change: %v", err)
+			}
+			req.Reply(err == nil, nil)
+		case "env":
+			e := &envReq{}
+			if err := ssh.Unmarshal(req.Payload, e); err != nil {
+				log.Printf("sshd: %v", err)
+				req.Reply(false, nil)
+				break
+			}
+			dprintf("env: %s=%s", e.Name, e.Value)
+			s.env = append(s.env, e.Name+"="+e.Value)
+			req.Reply(true, nil)
+		default:
+			log.Printf("Not handling req %v %q", req, string(req.Payload))
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func channels(chans <-chan ssh.NewChannel) {
 	// Service the incoming Channel channel.
 	for newChannel := range chans {
 		// Channels have a type, depending on the application level
 		// protocol intended. In the case of a shell, the type is
-		// "session" and ServerShell may be used to present a simple
-		// terminal interface.
-		if newChannel.ChannelType() != "session" {
+		// "session", and ssh -L opens "direct-tcpip" channels.
+		switch newChannel.ChannelType() {
+		case "session":
+		case "direct-tcpip":
+			go directTCPIP(newChannel)
+			continue
+		default:
 			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
 			continue
 		}
@@ -144,69 +297,45 @@ func session(chans <-chan ssh.NewChannel) {
 			continue
 		}
 
-		// Sessions have out-of-band requests such as "shell",
-		// "pty-req" and "env".  Here we handle only the
-		// "shell" request.
-		go func(in <-chan *ssh.Request) {
-			for req := range in {
-				dprintf("Request %v", req.Type)
-				switch req.Type {
-				case "shell":
-					err := runCommand(channel, p, shell)
-					req.Reply(true, []byte(fmt.Sprintf("%v", err)))
-				case "exec":
-					e := &execReq{}
-					if err := ssh.Unmarshal(req.Payload, e); err != nil {
-						log.Printf("sshd: %v", err)
-						break
-					}
-					// Execute command using user's shell. This is what OpenSSH does
-					// so it's the least surprising to the user.
-					err := runCommand(channel, p, shell, "-c", e.Command)
-					req.Reply(true, []byte(fmt.Sprintf("%v", err)))
-				case "pty-req":
-					p, err = newPTY(req.Payload)
-					req.Reply(err == nil, nil)
-				default:
-					log.Printf("Not handling req %v %q", req, string(req.Payload))
-					req.Reply(false, nil)
-				}
-			}
-		}(requests)
-
+		s := &session{c: channel}
+		go s.requests(requests)
 	}
 }
 
-func main() {
-	flag.Parse()
-	if *debug {
-		dprintf = log.Printf
-	}
-	// Public key authentication is done by comparing
-	// the public key of a received connection
-	// with the entries in the authorized_keys file.
-	authorizedKeysBytes, err := ioutil.ReadFile(*keys)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	authorizedKeysMap := map[string]bool{}
-	for len(authorizedKeysBytes) > 0 {
-		pubKey, _, _, rest, err := ssh.ParseAuthorizedKey(authorizedKeysBytes)
+// serve serves SSH connections on l.
+func serve(l net.Listener, config *ssh.ServerConfig) error {
+	for {
+		nConn, err := l.Accept()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		authorizedKeysMap[string(pubKey.Marshal())] = true
-		authorizedKeysBytes = rest
+		go func() {
+			// Before use, a handshake must be performed on the incoming
+			// net.Conn.
+			conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
+			if err != nil {
+				log.Printf("failed to handshake: %v", err)
+				return
+			}
+			log.Printf("%v logged in with key %s", conn.RemoteAddr(), conn.Permissions.Extensions["pubkey-fp"])
+
+			// The incoming Request channel must be serviced.
+			go globalRequests(conn, reqs)
+
+			channels(chans)
+		}()
 	}
+}
 
+// newConfig returns a server configuration that lets in authorized keys.
+func newConfig(authorized map[string]bool, hostKey ssh.Signer) *ssh.ServerConfig {
 	// An SSH server is represented by a ServerConfig, which holds
 	// certificate details and handles authentication of ServerConns.
 	config := &ssh.ServerConfig{
 		// Remove to disable public key auth.
 		PublicKeyCallback: func(c ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
-			if authorizedKeysMap[string(pubKey.Marshal())] {
+			if authorized[string(pubKey.Marshal())] {
 				return &ssh.Permissions{
 					// Record the public key used for authentication.
 					Extensions: map[string]string{
@@ -217,44 +346,33 @@ func main() {
 			return nil, fmt.Errorf("unknown public key for %q", c.User())
 		},
 	}
+	config.AddHostKey(hostKey)
+	return config
+}
 
-	privateBytes, err := ioutil.ReadFile(*privkey)
+func main() {
+	flag.Parse()
+	if *debug {
+		dprintf = log.Printf
+	}
+	// Public key authentication is done by comparing
+	// the public key of a received connection
+	// with the authorized keys.
+	authorized, err := authorizedKeys(*keys)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	private, err := ssh.ParsePrivateKey(privateBytes)
+	private, err := hostKey(*privkey)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	config.AddHostKey(private)
-
 	// Once a ServerConfig has been configured, connections can be
 	// accepted.
 	listener, err := net.Listen("tcp", net.JoinHostPort(*ip, *port))
 	if err != nil {
 		log.Fatal(err)
 	}
-	for {
-		nConn, err := listener.Accept()
-		if err != nil {
-			log.Printf("failed to accept incoming connection: %s", err)
-			continue
-		}
-
-		// Before use, a handshake must be performed on the incoming
-		// net.Conn.
-		conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
-		if err != nil {
-			log.Printf("failed to handshake: %v", err)
-			continue
-		}
-		log.Printf("%v logged in with key %s", conn.RemoteAddr(), conn.Permissions.Extensions["pubkey-fp"])
-
-		// The incoming Request channel must be serviced.
-		go ssh.DiscardRequests(reqs)
-
-		go session(chans)
-	}
+	log.Fatal(serve(listener, newConfig(authorized, private)))
 }
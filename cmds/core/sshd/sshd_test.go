@@ -0,0 +1,311 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/vpd"
+	"golang.org/x/crypto/ssh"
+)
+
+func newKey(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAuthorizedKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileKey, vpdKey := newKey(t).PublicKey(), newKey(t).PublicKey()
+	file := filepath.Join(dir, "authorized_keys")
+	b := append([]byte("# comment\n\n"), ssh.MarshalAuthorizedKey(fileKey)...)
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(dir string) { vpd.VpdDir = dir }(vpd.VpdDir)
+	vpd.VpdDir = dir
+	if err := os.Mkdir(filepath.Join(dir, "rw"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "rw", vpdKeys), ssh.MarshalAuthorizedKey(vpdKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := authorizedKeys(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []ssh.PublicKey{fileKey, vpdKey} {
+		if !keys[string(k.Marshal())] {
+			t.Errorf("authorizedKeys(%s) does not have %s", file, ssh.FingerprintSHA256(k))
+		}
+	}
+
+	if err := ioutil.WriteFile(file, []byte("ssh-ed25519 garbage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authorizedKeys(file); err == nil {
+		t.Errorf("authorizedKeys(%s) with a bad key: got nil, want error", file)
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "etc", "ssh_host_key")
+	generated, err := hostKey(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := hostKey(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated.PublicKey().Marshal(), read.PublicKey().Marshal()) {
+		t.Errorf("hostKey(%s) read a different key than it generated", file)
+	}
+	pub, err := ioutil.ReadFile(file + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ssh.MarshalAuthorizedKey(generated.PublicKey()); !bytes.Equal(pub, want) {
+		t.Errorf("%s.pub is %q, want %q", file, pub, want)
+	}
+}
+
+// dial starts a server and returns a client logged in to it.
+func dial(t *testing.T) *ssh.Client {
+	user, host := newKey(t), newKey(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(l, newConfig(map[string]bool{string(user.PublicKey().Marshal()): true}, host))
+
+	c, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(user)},
+		HostKeyCallback: ssh.FixedHostKey(host.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestExec(t *testing.T) {
+	shell = "/bin/sh"
+	if _, err := os.Stat(shell); err != nil {
+		t.Skip(err)
+	}
+	c := dial(t)
+	defer c.Close()
+
+	s, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Setenv("SSHD_TEST", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	s.Stdin = bytes.NewBufferString("world\n")
+	out, err := s.Output("echo $SSHD_TEST; cat; exit 3")
+	if e, ok := err.(*ssh.ExitError); !ok || e.ExitStatus() != 3 {
+		t.Errorf("exit: got %v, want exit status 3", err)
+	}
+	if string(out) != "hello\nworld\n" {
+		t.Errorf("output: got %q, want %q", out, "hello\nworld\n")
+	}
+}
+
+func TestSFTP(t *testing.T) {
+	c := dial(t)
+	defer c.Close()
+
+	s, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := s.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RequestSubsystem("sftp"); err != nil {
+		t.Fatal(err)
+	}
+
+	// SSH_FXP_INIT, version 3.
+	if _, err := w.Write([]byte{0, 0, 0, 5, 1, 0, 0, 0, 3}); err != nil {
+		t.Fatal(err)
+	}
+	var l [4]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, binary.BigEndian.Uint32(l[:]))
+	if _, err := io.ReadFull(r, p); err != nil {
+		t.Fatal(err)
+	}
+	if typ, version := p[0], binary.BigEndian.Uint32(p[1:]); typ != 2 || version != 3 {
+		t.Errorf("sftp: got packet type %d version %d, want SSH_FXP_VERSION 3", typ, version)
+	}
+	// The server is done when the client is.
+	w.Close()
+	if b, err := ioutil.ReadAll(r); err != nil || len(b) > 0 {
+		t.Errorf("sftp after close: got %q, %v, want EOF", b, err)
+	}
+
+	s, err = c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RequestSubsystem("nonesuch"); err == nil {
+		t.Errorf("subsystem nonesuch: got nil, want error")
+	}
+}
+
+func echoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return l
+}
+
+func echo(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "ping" {
+		t.Errorf("echo: got %q, want %q", b, "ping")
+	}
+}
+
+func TestDirectTCPIP(t *testing.T) {
+	l := echoServer(t)
+	defer l.Close()
+	c := dial(t)
+	defer c.Close()
+
+	conn, err := c.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, conn)
+
+	if _, err := c.Dial("tcp", "127.0.0.1:1"); err == nil {
+		t.Errorf("direct-tcpip to a closed port: got nil, want error")
+	}
+}
+
+func TestTCPIPForward(t *testing.T) {
+	c := dial(t)
+	defer c.Close()
+
+	// Echo what comes in through the server.
+	rl, err := c.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := rl.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	addr := rl.Addr().(*net.TCPAddr)
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(addr.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, conn)
+
+	if err := rl.Close(); err != nil {
+		t.Errorf("cancel-tcpip-forward: got %v, want nil", err)
+	}
+}
+
+func TestTCPIPForwardLoopback(t *testing.T) {
+	if got, want := listenAddr("", 22), "127.0.0.1:22"; got != want {
+		t.Errorf("listenAddr(\"\", 22) = %q, want %q", got, want)
+	}
+	if got, want := listenAddr("0.0.0.0", 22), "0.0.0.0:22"; got != want {
+		t.Errorf("listenAddr(\"0.0.0.0\", 22) = %q, want %q", got, want)
+	}
+
+	c := dial(t)
+	defer c.Close()
+
+	// A request without an address, as for ssh -R 0:host:port.
+	ok, reply, err := c.SendRequest("tcpip-forward", true, ssh.Marshal(tcpipForwardReq{BindAddr: "", BindPort: 0}))
+	if err != nil || !ok {
+		t.Fatalf("tcpip-forward: got %v, %v, want true, nil", ok, err)
+	}
+	var r tcpipForwardReply
+	if err := ssh.Unmarshal(reply, &r); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(r.Port))))
+	if err != nil {
+		t.Fatalf("forwarded port is not on loopback: %v", err)
+	}
+	conn.Close()
+}
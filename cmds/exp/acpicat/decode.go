@@ -0,0 +1,124 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/acpi"
+)
+
+// decodeTable decodes t, or only its header if acpi cannot decode it.
+func decodeTable(t acpi.Table) (interface{}, error) {
+	d, err := acpi.Decode(t)
+	if errors.Is(err, acpi.ErrUnsupported) {
+		return acpi.NewHeader(t)
+	}
+	return d, err
+}
+
+func printJSON(w io.Writer, tabs []acpi.Table) error {
+	var out []interface{}
+	for _, t := range tabs {
+		d, err := decodeTable(t)
+		if err != nil {
+			return fmt.Errorf("%s: %v", t.Sig(), err)
+		}
+		out = append(out, d)
+	}
+	b, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func printDecoded(w io.Writer, tabs []acpi.Table) error {
+	var b strings.Builder
+	for _, t := range tabs {
+		fmt.Fprintf(&b, "%s\n", acpi.String(t))
+		d, err := acpi.Decode(t)
+		if errors.Is(err, acpi.ErrUnsupported) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", t.Sig(), err)
+		}
+		printFields(&b, reflect.ValueOf(d).Elem(), "    ")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// printFields prints the exported fields of the struct v, one per line,
+// leaving out the header, which acpi.String already printed.
+func printFields(b *strings.Builder, v reflect.Value, indent string) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		switch {
+		case f.PkgPath != "" || f.Type == reflect.TypeOf(acpi.Header{}):
+		case f.Anonymous:
+			printFields(b, fv, indent)
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8:
+			fmt.Fprintf(b, "%s%s:\n", indent, f.Name)
+			for j := 0; j < fv.Len(); j++ {
+				fmt.Fprintf(b, "%s    %s\n", indent, formatValue(fv.Index(j)))
+			}
+		default:
+			fmt.Fprintf(b, "%s%s: %s\n", indent, f.Name, formatValue(fv))
+		}
+	}
+}
+
+// formatValue formats v on a single line: numbers in hex, structs as their
+// fields and subtables with their type.
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "<nil>"
+		}
+		e := v.Elem()
+		if v.Kind() == reflect.Interface {
+			return formatValue(e)
+		}
+		return e.Type().Name() + " " + formatValue(e)
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("%#x", v.Uint())
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return fmt.Sprintf("%#x", b)
+		}
+		var s []string
+		for i := 0; i < v.Len(); i++ {
+			s = append(s, formatValue(v.Index(i)))
+		}
+		return "[" + strings.Join(s, " ") + "]"
+	case reflect.Struct:
+		var s []string
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.PkgPath == "" {
+				s = append(s, f.Name+"="+formatValue(v.Field(i)))
+			}
+		}
+		return "{" + strings.Join(s, " ") + "}"
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/acpi"
+)
+
+func testTables(t *testing.T) []acpi.Table {
+	var tabs []acpi.Table
+	for _, d := range []acpi.Decoded{
+		&acpi.MCFG{
+			Header:  acpi.Header{Signature: "MCFG", Revision: 1, OEMID: "UROOT "},
+			Entries: []acpi.MCFGEntry{{BaseAddress: 0xb0000000, EndBus: 0xff}},
+		},
+		&acpi.MADT{
+			Header:           acpi.Header{Signature: "APIC", Revision: 5, OEMID: "UROOT "},
+			LocalAPICAddress: 0xfee00000,
+			Entries: acpi.Subtables{
+				&acpi.MADTLocalAPIC{ACPIProcessorUID: 1, APICID: 2, Flags: acpi.MADTEnabled},
+				&acpi.UnknownSubtable{Type: 0x7f, Data: []byte{1, 2}},
+			},
+		},
+	} {
+		tab, err := d.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tabs = append(tabs, tab)
+	}
+	// A table that is not decoded.
+	raw, err := acpi.NewRaw(append([]byte("SSDT\x24\x00\x00\x00\x02"), make([]byte, 27)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(tabs, raw...)
+}
+
+func TestPrintDecoded(t *testing.T) {
+	var b bytes.Buffer
+	if err := printDecoded(&b, testTables(t)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"MCFG@0x0 60 1",
+		"    Entries:\n        segment 0 busses 0x00-0xff at 0xb0000000\n",
+		"APIC@0x0 56 5",
+		"    LocalAPICAddress: 0xfee00000\n    Flags: 0x0\n",
+		"        MADTLocalAPIC {ACPIProcessorUID=0x1 APICID=0x2 Flags=0x1}\n",
+		"        UnknownSubtable {Type=0x7f Data=0x0102}\n",
+		"SSDT@0x0 36 2",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("printDecoded() =\n%s\nwant it to contain\n%s", b.String(), want)
+		}
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := printJSON(&b, testTables(t)); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("printJSON() printed bad JSON: %v\n%s", err, b.String())
+	}
+	if len(got) != 3 {
+		t.Fatalf("printJSON() printed %d tables, want 3", len(got))
+	}
+	for i, sig := range []string{"MCFG", "APIC", "SSDT"} {
+		if got[i]["Signature"] != sig {
+			t.Errorf("table %d is %v, want %s", i, got[i]["Signature"], sig)
+		}
+	}
+	entries := got[1]["Entries"].([]interface{})
+	if typ := entries[0].(map[string]interface{})["Type"]; typ != "MADTLocalAPIC" {
+		t.Errorf("first MADT entry is a %v, want MADTLocalAPIC", typ)
+	}
+}
@@ -6,6 +6,20 @@
 // The default method is "files", commonly provided in Linux via /sys.
 // Other methods are available depending on the platform.
 // Further selection of which tables are used can be done with acpigrep.
+//
+// Synopsis:
+//     acpicat [-s source] [-d] [-decode [-json]]
+//
+// Description:
+//     With -decode, the FADT, MADT, MCFG, HPET, SRAT and DMAR are printed
+//     in a human-readable form, or as JSON with -json, rather than as
+//     binary. Other tables are printed as just their header.
+//
+// Options:
+//     -s:      source of the tables
+//     -d:      enable debug prints
+//     -decode: print the tables in a human-readable form
+//     -json:   with -decode, print JSON
 package main
 
 import (
@@ -19,6 +33,8 @@ import (
 var (
 	source = flag.String("s", acpi.DefaultMethod, "source of the tables")
 	debug  = flag.Bool("d", false, "Enable debug prints")
+	decode = flag.Bool("decode", false, "Print the tables in a human-readable form")
+	asJSON = flag.Bool("json", false, "With -decode, print JSON")
 )
 
 func main() {
@@ -33,7 +49,15 @@ func main() {
 	if len(t) == 0 {
 		log.Fatalf("%s: no tables read", *source)
 	}
-	if err := acpi.WriteTables(os.Stdout, t[0], t[1:]...); err != nil {
+	switch {
+	case *decode && *asJSON:
+		err = printJSON(os.Stdout, t)
+	case *decode:
+		err = printDecoded(os.Stdout, t)
+	default:
+		err = acpi.WriteTables(os.Stdout, t[0], t[1:]...)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -30,7 +30,7 @@ func getData(textOut io.Writer, dumpFile, sysfsPath string) ([]byte, []byte, err
 		entry = data[:32]
 		data = data[32:]
 	} else {
-		fmt.Fprintf(textOut, "Reading SMBIOS/DMI data from sysfs.\n")
+		fmt.Fprintf(textOut, "Getting SMBIOS data from sysfs.\n")
 		entry, err = ioutil.ReadFile(filepath.Join(sysfsPath, "smbios_entry_point"))
 		if err != nil {
 			return nil, nil, fmt.Errorf("error reading DMI data: %v", err)
@@ -5,8 +5,11 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -19,7 +22,10 @@ import (
 var (
 	flagDumpBin  = flag.String("dump-bin", "", `Do not decode the entries, instead dump the DMI data to a file in binary form. The generated file is suitable to pass to --from-dump later.`)
 	flagFromDump = flag.String("from-dump", "", `Read the DMI data from a binary file previously generated using --dump-bin.`)
+	flagQuiet    = flag.BoolP("quiet", "q", false, `Be less verbose. Unknown, inactive and OEM-specific entries are not displayed. Meta-data and handle references are hidden.`)
+	flagString   = flag.StringP("string", "s", "", `Only display the value of the DMI string identified by KEYWORD. It must be a keyword from the following list: `+strings.Join(stringKeywordNames(), ", ")+`.`)
 	flagType     = flag.StringSliceP("type", "t", nil, `Only  display  the  entries of type TYPE. TYPE can be either a DMI type number, or a comma-separated list of type numbers, or a keyword from the following list: bios, system, baseboard, chassis, processor, memory, cache, connector, slot. If this option is used more than once, the set of displayed entries will be the union of all the given types. If TYPE is not provided or not valid, a list of all valid keywords is printed and dmidecode exits with an error.`)
+	flagDump     = flag.BoolP("dump", "u", false, `Do not decode the entries, dump their contents as hexadecimal instead.`)
 	// NB: When adding flags, update resetFlags in dmidecode_test.
 )
 
@@ -35,8 +41,51 @@ var (
 		"connector": {8},
 		"slot":      {9},
 	}
+	typeGroupNames = []string{"bios", "system", "baseboard", "chassis", "processor", "memory", "cache", "connector", "slot"}
+
+	// stringKeywords are the keywords accepted by --string, in the order
+	// dmidecode(8) lists them.
+	stringKeywords = []stringKeyword{
+		{"bios-vendor", smbios.TableTypeBIOSInfo, 0x04},
+		{"bios-version", smbios.TableTypeBIOSInfo, 0x05},
+		{"bios-release-date", smbios.TableTypeBIOSInfo, 0x08},
+		{"system-manufacturer", smbios.TableTypeSystemInfo, 0x04},
+		{"system-product-name", smbios.TableTypeSystemInfo, 0x05},
+		{"system-version", smbios.TableTypeSystemInfo, 0x06},
+		{"system-serial-number", smbios.TableTypeSystemInfo, 0x07},
+		{"system-uuid", smbios.TableTypeSystemInfo, 0x08},
+		{"baseboard-manufacturer", smbios.TableTypeBaseboardInfo, 0x04},
+		{"baseboard-product-name", smbios.TableTypeBaseboardInfo, 0x05},
+		{"baseboard-version", smbios.TableTypeBaseboardInfo, 0x06},
+		{"baseboard-serial-number", smbios.TableTypeBaseboardInfo, 0x07},
+		{"baseboard-asset-tag", smbios.TableTypeBaseboardInfo, 0x08},
+		{"chassis-manufacturer", smbios.TableTypeChassisInfo, 0x04},
+		{"chassis-type", smbios.TableTypeChassisInfo, 0x05},
+		{"chassis-version", smbios.TableTypeChassisInfo, 0x06},
+		{"chassis-serial-number", smbios.TableTypeChassisInfo, 0x07},
+		{"chassis-asset-tag", smbios.TableTypeChassisInfo, 0x08},
+		{"processor-family", smbios.TableTypeProcessorInfo, 0x06},
+		{"processor-manufacturer", smbios.TableTypeProcessorInfo, 0x07},
+		{"processor-version", smbios.TableTypeProcessorInfo, 0x10},
+		{"processor-frequency", smbios.TableTypeProcessorInfo, 0x16},
+	}
 )
 
+// stringKeyword is a --string keyword, identifying a field of a table type.
+type stringKeyword struct {
+	name   string
+	tt     smbios.TableType
+	offset int
+}
+
+func stringKeywordNames() []string {
+	var names []string
+	for _, k := range stringKeywords {
+		names = append(names, k.name)
+	}
+	return names
+}
+
 type dmiDecodeError struct {
 	error
 	code int
@@ -50,17 +99,106 @@ func parseTypeFilter(typeStrings []string) (map[smbios.TableType]bool, error) {
 			for _, t := range tg {
 				types[smbios.TableType(t)] = true
 			}
-		} else {
-			u, err := strconv.ParseUint(ts, 0, 8)
-			if err != nil {
-				return nil, fmt.Errorf("Invalid type: %s", ts)
-			}
-			types[smbios.TableType(uint8(u))] = true
+			continue
 		}
+		u, err := strconv.ParseUint(ts, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid type keyword: %s\nValid type keywords are:\n  %s", ts, strings.Join(typeGroupNames, "\n  "))
+		}
+		if u > 0xff {
+			return nil, fmt.Errorf("Invalid type number: %d", u)
+		}
+		types[smbios.TableType(u)] = true
 	}
 	return types, nil
 }
 
+// parseStringKeyword parses the --string argument.
+func parseStringKeyword(s string) (*stringKeyword, error) {
+	for _, k := range stringKeywords {
+		if strings.EqualFold(k.name, s) {
+			return &k, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid string keyword: %s\nValid string keywords are:\n  %s", s, strings.Join(stringKeywordNames(), "\n  "))
+}
+
+// tableString returns the value of the field identified by k in t.
+func tableString(t *smbios.Table, k *stringKeyword) (string, error) {
+	switch k.name {
+	case "system-uuid":
+		si, err := smbios.ParseSystemInfo(t)
+		if err != nil {
+			return "", err
+		}
+		return si.GetUUIDString(), nil
+	case "chassis-type":
+		ci, err := smbios.ParseChassisInfo(t)
+		if err != nil {
+			return "", err
+		}
+		return ci.Type.String(), nil
+	case "processor-family":
+		pi, err := smbios.ParseProcessorInfo(t)
+		if err != nil {
+			return "", err
+		}
+		return pi.GetFamily().String(), nil
+	case "processor-frequency":
+		pi, err := smbios.ParseProcessorInfo(t)
+		if err != nil {
+			return "", err
+		}
+		if pi.CurrentSpeed == 0 {
+			return "Unknown", nil
+		}
+		return fmt.Sprintf("%d MHz", pi.CurrentSpeed), nil
+	}
+	// The index may be bad, which is reported in the string.
+	s, _ := t.GetStringAt(k.offset)
+	return s, nil
+}
+
+// hexRows formats data as rows of up to 16 hex bytes, the way dmidecode(8) does.
+func hexRows(data []byte) []string {
+	var rows []string
+	for len(data) > 0 {
+		n := len(data)
+		if n > 16 {
+			n = 16
+		}
+		row := make([]string, n)
+		for i, b := range data[:n] {
+			row[i] = fmt.Sprintf("%02X", b)
+		}
+		rows = append(rows, "\t\t"+strings.Join(row, " "))
+		data = data[n:]
+	}
+	return rows
+}
+
+// dumpTable returns the contents of t in hex, including the strings, for --dump.
+func dumpTable(t *smbios.Table) (string, error) {
+	b, err := t.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	lines := []string{
+		fmt.Sprintf("Handle 0x%04X, DMI type %d, %d bytes", t.Handle, t.Type, t.Length),
+		"\tHeader and Data:",
+	}
+	lines = append(lines, hexRows(b[:t.Length])...)
+	strs := bytes.Split(bytes.TrimSuffix(b[t.Length:], []byte{0, 0}), []byte{0})
+	if len(strs[0]) > 0 {
+		lines = append(lines, "\tStrings:")
+		for _, s := range strs {
+			lines = append(lines, hexRows(append(s, 0))...)
+			lines = append(lines, "\t\t"+string(s))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
 func dumpBin(textOut io.Writer, entryData, tableData []byte, fileName string) *dmiDecodeError {
 	// Need to rewrite address to be compatible with dmidecode(8).
 	e32, e64, err := smbios.ParseEntry(entryData)
@@ -76,66 +214,146 @@ func dumpBin(textOut io.Writer, entryData, tableData []byte, fileName string) *d
 		e64.StructTableAddr = 0x20
 		edata, _ = e64.MarshalBinary()
 	}
-	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return &dmiDecodeError{code: 1, error: fmt.Errorf("error opening file for writing: %v", err)}
 	}
 	defer f.Close()
-	fmt.Fprintf(textOut, "# Writing %d bytes to %s.\n", len(edata), fileName)
-	if _, err := f.Write(edata); err != nil {
-		return &dmiDecodeError{code: 1, error: fmt.Errorf("error writing entry: %v", err)}
-	}
-	for i := len(edata); i < 0x20; i++ {
-		if _, err := f.Write([]byte{0}); err != nil {
-			return &dmiDecodeError{code: 1, error: fmt.Errorf("error writing entry: %v", err)}
-		}
-	}
+	// Like dmidecode(8), write the tables first, then the entry point.
 	fmt.Fprintf(textOut, "# Writing %d bytes to %s.\n", len(tableData), fileName)
-	if _, err := f.Write(tableData); err != nil {
+	if _, err := f.WriteAt(tableData, 0x20); err != nil {
 		return &dmiDecodeError{code: 1, error: fmt.Errorf("error writing table data: %v", err)}
 	}
+	fmt.Fprintf(textOut, "# Writing %d bytes to %s.\n", len(edata), fileName)
+	if _, err := f.WriteAt(edata, 0); err != nil {
+		return &dmiDecodeError{code: 1, error: fmt.Errorf("error writing entry: %v", err)}
+	}
 	return nil
 }
 
 func dmiDecode(textOut io.Writer) *dmiDecodeError {
 	typeFilter, err := parseTypeFilter(*flagType)
 	if err != nil {
-		return &dmiDecodeError{code: 2, error: fmt.Errorf("invalid --type: %v", err)}
+		return &dmiDecodeError{code: 2, error: err}
 	}
-	fmt.Fprintf(textOut, "# dmidecode-go\n") // TODO: version.
-	entryData, tableData, err := getData(textOut, *flagFromDump, "/sys/firmware/dmi/tables")
+	var sk *stringKeyword
+	if *flagString != "" {
+		if sk, err = parseStringKeyword(*flagString); err != nil {
+			return &dmiDecodeError{code: 2, error: err}
+		}
+	}
+	n := 0
+	for _, set := range []bool{sk != nil, len(typeFilter) != 0, *flagDumpBin != ""} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return &dmiDecodeError{code: 2, error: errors.New("Options --string, --type and --dump-bin are mutually exclusive")}
+	}
+	// --string implies --quiet.
+	quiet := *flagQuiet || sk != nil
+	// Meta-data goes here, it is left out in quiet mode.
+	metaOut := textOut
+	if quiet {
+		metaOut = ioutil.Discard
+	}
+
+	fmt.Fprintf(metaOut, "# dmidecode-go\n") // TODO: version.
+	entryData, tableData, err := getData(metaOut, *flagFromDump, "/sys/firmware/dmi/tables")
 	if err != nil {
 		return &dmiDecodeError{code: 1, error: fmt.Errorf("error parsing loading data: %v", err)}
 	}
-	if *flagDumpBin != "" {
-		return dumpBin(textOut, entryData, tableData, *flagDumpBin)
-	}
 	si, err := smbios.ParseInfo(entryData, tableData)
 	if err != nil {
 		return &dmiDecodeError{code: 1, error: fmt.Errorf("error parsing data: %v", err)}
 	}
 	if si.Entry64 != nil {
-		fmt.Fprintf(textOut, "SMBIOS %d.%d.%d present.\n", si.MajorVersion(), si.MinorVersion(), si.DocRev())
+		fmt.Fprintf(metaOut, "SMBIOS %d.%d.%d present.\n", si.MajorVersion(), si.MinorVersion(), si.DocRev())
 	} else {
-		fmt.Fprintf(textOut, "SMBIOS %d.%d present.\n", si.MajorVersion(), si.MinorVersion())
+		major, minor := si.MajorVersion(), si.MinorVersion()
+		// Some BIOSes report weird versions, fix them up like dmidecode(8) does.
+		switch {
+		case major == 2 && (minor == 0x1f || minor == 0x21):
+			fmt.Fprintf(metaOut, "SMBIOS version fixup (2.%d -> 2.%d).\n", minor, 3)
+			minor = 3
+		case major == 2 && minor == 0x33:
+			fmt.Fprintf(metaOut, "SMBIOS version fixup (2.%d -> 2.%d).\n", 51, 6)
+			minor = 6
+		}
+		fmt.Fprintf(metaOut, "SMBIOS %d.%d present.\n", major, minor)
 	}
-	if si.Entry32 != nil {
-		fmt.Fprintf(textOut, "%d structures occupying %d bytes.\n", si.Entry32.NumberOfStructs, si.Entry32.StructTableLength)
+	if len(typeFilter) == 0 {
+		if e := si.Entry64; e != nil {
+			if *flagFromDump == "" {
+				fmt.Fprintf(metaOut, "Table at 0x%08X.\n", e.StructTableAddr)
+			}
+		} else if e := si.Entry32; e != nil {
+			if e.NumberOfStructs != 0 {
+				fmt.Fprintf(metaOut, "%d structures occupying %d bytes.\n", e.NumberOfStructs, e.StructTableLength)
+			}
+			if *flagFromDump == "" {
+				fmt.Fprintf(metaOut, "Table at 0x%08X.\n", e.StructTableAddr)
+			}
+		}
+	}
+	fmt.Fprintf(metaOut, "\n")
+	if *flagDumpBin != "" {
+		return dumpBin(metaOut, entryData, tableData, *flagDumpBin)
 	}
-	fmt.Fprintf(textOut, "\n")
 	for _, t := range si.Tables {
+		// In quiet mode, stop at the end of table marker.
+		if quiet && t.Type == smbios.TableTypeEndOfTable {
+			break
+		}
+		if sk != nil {
+			if t.Type != sk.tt || sk.offset >= int(t.Length) {
+				continue
+			}
+			s, err := tableString(t, sk)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				continue
+			}
+			fmt.Fprintf(textOut, "%s\n", s)
+			continue
+		}
 		if len(typeFilter) != 0 && !typeFilter[t.Type] {
 			continue
 		}
+		if quiet && t.Type == smbios.TableTypeInactive {
+			continue
+		}
+		if *flagDump {
+			s, err := dumpTable(t)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				continue
+			}
+			fmt.Fprintf(textOut, "%s\n\n", s)
+			continue
+		}
+		var s string
 		pt, err := smbios.ParseTypedTable(t)
 		if err != nil {
 			if err != smbios.ErrUnsupportedTableType {
 				fmt.Fprintf(os.Stderr, "%s\n", err)
 			}
+			// dmidecode(8) does not show types it does not know in
+			// quiet mode. We do show those it knows and we do not.
+			if quiet && t.Type >= 0x80 {
+				continue
+			}
 			// Print as raw table
-			pt = t
+			s = t.String()
+		} else {
+			s = pt.String()
+		}
+		if quiet {
+			// Leave out the handle.
+			s = s[strings.Index(s, "\n")+1:]
 		}
-		fmt.Fprintf(textOut, "%s\n\n", pt)
+		fmt.Fprintf(textOut, "%s\n\n", s)
 	}
 	return nil
 }
@@ -23,23 +23,32 @@ const (
 )
 
 func resetFlags() {
+	*flagDumpBin = ""
 	*flagFromDump = ""
+	*flagQuiet = false
+	*flagString = ""
 	*flagType = nil
+	*flagDump = false
 }
 
-func testOutput(t *testing.T, dumpFile string, args []string, expectedOutFile string) {
-	actualOutFile := fmt.Sprintf("%s.actual", expectedOutFile)
-	os.Remove(actualOutFile)
+func runDMIDecode(dumpFile string, args []string) ([]byte, *dmiDecodeError) {
 	os.Args = []string{os.Args[0], "--from-dump", dumpFile}
 	os.Args = append(os.Args, args...)
 	flag.Parse()
 	defer resetFlags()
 	out := &bytes.Buffer{}
-	if err := dmiDecode(out); err != nil {
-		t.Errorf("%+v %+v %+v: error: %v", dumpFile, args, expectedOutFile, err)
+	err := dmiDecode(out)
+	return out.Bytes(), err
+}
+
+func testOutput(t *testing.T, dumpFile string, args []string, expectedOutFile string) {
+	actualOutFile := fmt.Sprintf("%s.actual", expectedOutFile)
+	os.Remove(actualOutFile)
+	actualOut, derr := runDMIDecode(dumpFile, args)
+	if derr != nil {
+		t.Errorf("%+v %+v %+v: error: %v", dumpFile, args, expectedOutFile, derr)
 		return
 	}
-	actualOut := out.Bytes()
 	expectedOut, err := ioutil.ReadFile(expectedOutFile)
 	if err != nil {
 		t.Errorf("%+v %+v %+v: failed to load %s: %v", dumpFile, args, expectedOutFile, expectedOutFile, err)
@@ -69,6 +78,92 @@ func TestDMIDecodeTypeFilters(t *testing.T) {
 	testOutput(t, "testdata/Asus-UX307LA.bin", []string{"-t", "1,131"}, "testdata/Asus-UX307LA.1_131.txt")
 }
 
+func TestDMIDecodeQuiet(t *testing.T) {
+	testOutput(t, "testdata/Lenovo-ThinkPad-T480.bin", []string{"-q"}, "testdata/Lenovo-ThinkPad-T480.q.txt")
+	testOutput(t, "testdata/Asus-UX307LA.bin", []string{"-q", "-t", "system"}, "testdata/Asus-UX307LA.q_system.txt")
+}
+
+func TestDMIDecodeDump(t *testing.T) {
+	testOutput(t, "testdata/Asus-UX307LA.bin", []string{"-u", "-t", "1,131"}, "testdata/Asus-UX307LA.u_1_131.txt")
+}
+
+func TestDMIDecodeString(t *testing.T) {
+	for _, tt := range []struct {
+		dumpFile string
+		keyword  string
+		want     string
+	}{
+		{"testdata/SuperMicro-X9DBL.bin", "bios-release-date", "12/06/2013\n"},
+		{"testdata/SuperMicro-X9DBL.bin", "system-serial-number", "9000116105\n"},
+		{"testdata/SuperMicro-X9DBL.bin", "system-uuid", "00000000-0000-0000-0000-0cc47a133878\n"},
+		{"testdata/SuperMicro-X9DBL.bin", "baseboard-asset-tag", "To be filled by O.E.M.\n"},
+		{"testdata/SuperMicro-X9DBL.bin", "chassis-type", "Main Server Chassis\n"},
+		// One line per processor.
+		{"testdata/SuperMicro-X9DBL.bin", "processor-family", "Xeon\nXeon\n"},
+		{"testdata/SuperMicro-X9DBL.bin", "processor-frequency", "1800 MHz\n1800 MHz\n"},
+		{"testdata/SuperMicro-X9DBL.bin", "processor-version", "Intel(R) Xeon(R) CPU E5-2403 v2 @ 1.80GHz\nIntel(R) Xeon(R) CPU E5-2403 v2 @ 1.80GHz\n"},
+		// Trailing spaces are kept.
+		{"testdata/Asus-UX307LA.bin", "system-version", "1.0       \n"},
+		{"testdata/Asus-UX307LA.bin", "SYSTEM-UUID", "850f3e82-9f38-694a-8840-2f8b0cf5d3d0\n"},
+		// SMBIOS 2.4, the UUID is not byte-swapped.
+		{"testdata/Gigabyte-GA-MA74GMT-S2.bin", "system-uuid", "31433646-3635-3532-3445-3546ffffffff\n"},
+	} {
+		out, err := runDMIDecode(tt.dumpFile, []string{"-s", tt.keyword})
+		if err != nil {
+			t.Errorf("%s -s %s: error: %v", tt.dumpFile, tt.keyword, err)
+			continue
+		}
+		if string(out) != tt.want {
+			t.Errorf("%s -s %s: got %q, want %q", tt.dumpFile, tt.keyword, out, tt.want)
+		}
+	}
+}
+
+func TestDMIDecodeBadArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"-s", "foo"},
+		{"-t", "foo"},
+		{"-t", "256"},
+		{"-s", "bios-vendor", "-t", "bios"},
+		{"-t", "bios", "--dump-bin", "foo.bin"},
+	} {
+		if _, err := runDMIDecode("testdata/Asus-UX307LA.bin", args); err == nil || err.code != 2 {
+			t.Errorf("%v: got %v, want an error with code 2", args, err)
+		}
+	}
+}
+
+func TestDMIDecodeDumpBinRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmidecode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bf, err := filepath.Glob("testdata/*.bin")
+	if err != nil {
+		t.Fatalf("glob failed: %v", err)
+	}
+	for _, dumpFile := range bf {
+		// The dumps were written by dmidecode(8) --dump-bin, ours must be the same.
+		outFile := filepath.Join(dir, filepath.Base(dumpFile))
+		if _, err := runDMIDecode(dumpFile, []string{"--dump-bin", outFile}); err != nil {
+			t.Errorf("%s: error: %v", dumpFile, err)
+			continue
+		}
+		want, err := ioutil.ReadFile(dumpFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(outFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: dump differs", dumpFile)
+		}
+	}
+}
+
 func testDumpBin(t *testing.T, entryData, expectedOutData []byte) {
 	tmpfile, err := ioutil.TempFile("", "dmidecode")
 	if err != nil {
@@ -10,10 +10,19 @@
 // Options:
 //     -chassis : Print chassis power status.
 //     -sel     : Print SEL information.
+//     -sellist : Print SEL entries.
+//     -selclear: Clear the SEL.
+//     -sensor  : Print sensor readings.
+//     -sdr     : Print SDR repository records.
+//     -fru     : Print FRU inventory of the given devices, 0 by default.
 //     -lan     : Print IP information.
 //     -device  : Print device information.
 //     -raw     : Send raw command and print response.
 //     -help    : Print help message.
+//     -H       : Talk to the BMC at this host over RMCP+ instead of /dev/ipmi0.
+//     -U       : RMCP+ user name.
+//     -P       : RMCP+ password, $IPMI_PASSWORD by default.
+//     -C       : RMCP+ cipher suite, 3 or 17.
 package main
 
 import (
@@ -32,10 +41,20 @@ const cmd = "ipmidump [options] "
 var (
 	flagChassis = flag.Bool("chassis", false, "print chassis power status")
 	flagSEL     = flag.Bool("sel", false, "print SEL information")
+	flagSELList = flag.Bool("sellist", false, "print SEL entries")
+	flagSELClr  = flag.Bool("selclear", false, "clear the SEL")
+	flagSensor  = flag.Bool("sensor", false, "print sensor readings")
+	flagSDR     = flag.Bool("sdr", false, "print SDR repository records")
+	flagFRU     = flag.Bool("fru", false, "print FRU inventory of the devices given as arguments, 0 by default")
 	flagLan     = flag.Bool("lan", false, "Print IP address")
 	flagRaw     = flag.Bool("raw", false, "Send IPMI raw command")
 	flagHelp    = flag.Bool("help", false, "print help message")
 	flagDev     = flag.Bool("device", false, "print device information")
+
+	flagHost     = flag.String("H", "", "talk to the BMC at this host[:port] over RMCP+ instead of /dev/ipmi0")
+	flagUser     = flag.String("U", "", "RMCP+ user name")
+	flagPassword = flag.String("P", "", "RMCP+ password, $IPMI_PASSWORD by default")
+	flagCipher   = flag.Int("C", 3, "RMCP+ cipher suite, 3 or 17")
 )
 
 func itob(i int) bool { return i != 0 }
@@ -48,6 +67,26 @@ func init() {
 	}
 }
 
+// open opens /dev/ipmi0, or an RMCP+ session with the BMC given by -H.
+func open() (*ipmi.IPMI, error) {
+	if *flagHost == "" {
+		return ipmi.Open(0)
+	}
+	password := *flagPassword
+	if password == "" {
+		password = os.Getenv("IPMI_PASSWORD")
+	}
+	l, err := ipmi.DialLAN(*flagHost, &ipmi.LANConfig{
+		Username:    *flagUser,
+		Password:    password,
+		CipherSuite: ipmi.CipherSuite(*flagCipher),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ipmi.New(l), nil
+}
+
 func main() {
 	flag.Parse()
 
@@ -64,6 +103,26 @@ func main() {
 		selInfo()
 	}
 
+	if *flagSELList {
+		selList()
+	}
+
+	if *flagSELClr {
+		selClear()
+	}
+
+	if *flagSensor {
+		sensors()
+	}
+
+	if *flagSDR {
+		sdrList()
+	}
+
+	if *flagFRU {
+		fruInfo(flag.Args())
+	}
+
 	if *flagLan {
 		lanConfig()
 	}
@@ -98,7 +157,7 @@ func chassisInfo() {
 		0x00: "none",
 	}
 
-	ipmi, err := ipmi.Open(0)
+	ipmi, err := open()
 	if err != nil {
 		fmt.Printf("Failed to open ipmi device: %v\n", err)
 	}
@@ -156,7 +215,7 @@ func chassisInfo() {
 func selInfo() {
 	support := map[bool]string{true: "supported", false: "unsupported"}
 
-	ipmi, err := ipmi.Open(0)
+	ipmi, err := open()
 	if err != nil {
 		fmt.Printf("Failed to open ipmi device: %v\n", err)
 	}
@@ -215,6 +274,170 @@ func selInfo() {
 	}
 }
 
+func selList() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	events, err := ipmi.SELEntries()
+	for _, e := range events {
+		fmt.Println(e)
+	}
+	if err != nil {
+		fmt.Printf("Failed to get SEL entries: %v\n", err)
+	} else if len(events) == 0 {
+		fmt.Println("SEL has no entries")
+	}
+}
+
+func selClear() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	if err := ipmi.ClearSEL(); err != nil {
+		fmt.Printf("Failed to clear SEL: %v\n", err)
+	} else {
+		fmt.Println("SEL cleared")
+	}
+}
+
+// thresholdStatus abbreviates the threshold comparison status of a reading
+// the way ipmitool does.
+func thresholdStatus(r *ipmi.SensorReading) string {
+	switch {
+	case r.State&ipmi.AboveUpperNonRecoverable != 0:
+		return "nr"
+	case r.State&ipmi.BelowLowerNonRecoverable != 0:
+		return "nr"
+	case r.State&ipmi.AboveUpperCritical != 0:
+		return "cr"
+	case r.State&ipmi.BelowLowerCritical != 0:
+		return "cr"
+	case r.State&(ipmi.AboveUpperNonCritical|ipmi.BelowLowerNonCritical) != 0:
+		return "nc"
+	}
+	return "ok"
+}
+
+func sensors() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	sdrs, err := ipmi.SDRs()
+	if err != nil {
+		fmt.Printf("Failed to read SDR repository: %v\n", err)
+	}
+	for _, sdr := range sdrs {
+		r, err := sdr.SensorRecord()
+		if err != nil {
+			continue
+		}
+
+		value, unit, status := "na", "", "na"
+		switch reading, err := ipmi.GetSensorReading(r); {
+		case err != nil, reading.Unavailable, reading.ScanningDisabled:
+		case reading.Converted:
+			value = fmt.Sprintf("%.3f", reading.Value)
+			unit = r.Unit()
+			if r.EventReadingType == 0x01 {
+				status = thresholdStatus(reading)
+			}
+		default:
+			value = fmt.Sprintf("0x%x", reading.Raw)
+			unit = "discrete"
+			status = fmt.Sprintf("0x%04x", reading.State)
+		}
+		fmt.Printf("%-16s | %-10s | %-10s | %s\n", r.Name, value, unit, status)
+	}
+}
+
+func sdrList() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	sdrs, err := ipmi.SDRs()
+	for _, sdr := range sdrs {
+		fmt.Printf("Record 0x%04x: version 0x%02x, type 0x%02x", sdr.RecordID, sdr.Version, uint8(sdr.Type))
+		if r, err := sdr.SensorRecord(); err == nil {
+			fmt.Printf(", sensor 0x%02x %q (%s)", r.Number, r.Name, r.SensorType)
+		}
+		fmt.Println()
+	}
+	if err != nil {
+		fmt.Printf("Failed to read SDR repository: %v\n", err)
+	}
+}
+
+func fruInfo(ids []string) {
+	if len(ids) == 0 {
+		ids = []string{"0"}
+	}
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	for _, arg := range ids {
+		id, err := strconv.ParseUint(arg, 0, 8)
+		if err != nil {
+			fmt.Printf("Invalid FRU device ID: \"%s\"\n", arg)
+			return
+		}
+
+		fru, err := ipmi.GetFRU(uint8(id))
+		if err != nil {
+			fmt.Printf("Failed to get FRU %d: %v\n", id, err)
+			continue
+		}
+
+		fmt.Printf("FRU Device %d\n", id)
+		if c := fru.Chassis; c != nil {
+			fmt.Printf("%-22s: 0x%02x\n", "Chassis Type", c.Type)
+			fmt.Printf("%-22s: %s\n", "Chassis Part Number", c.PartNumber)
+			fmt.Printf("%-22s: %s\n", "Chassis Serial", c.SerialNumber)
+			for _, s := range c.Custom {
+				fmt.Printf("%-22s: %s\n", "Chassis Extra", s)
+			}
+		}
+		if b := fru.Board; b != nil {
+			if !b.MfgDate.IsZero() {
+				fmt.Printf("%-22s: %s\n", "Board Mfg Date", b.MfgDate.Format(time.ANSIC))
+			}
+			fmt.Printf("%-22s: %s\n", "Board Mfg", b.Manufacturer)
+			fmt.Printf("%-22s: %s\n", "Board Product", b.ProductName)
+			fmt.Printf("%-22s: %s\n", "Board Serial", b.SerialNumber)
+			fmt.Printf("%-22s: %s\n", "Board Part Number", b.PartNumber)
+			for _, s := range b.Custom {
+				fmt.Printf("%-22s: %s\n", "Board Extra", s)
+			}
+		}
+		if p := fru.Product; p != nil {
+			fmt.Printf("%-22s: %s\n", "Product Manufacturer", p.Manufacturer)
+			fmt.Printf("%-22s: %s\n", "Product Name", p.Name)
+			fmt.Printf("%-22s: %s\n", "Product Part Number", p.PartNumber)
+			fmt.Printf("%-22s: %s\n", "Product Version", p.Version)
+			fmt.Printf("%-22s: %s\n", "Product Serial", p.SerialNumber)
+			fmt.Printf("%-22s: %s\n", "Product Asset Tag", p.AssetTag)
+			for _, s := range p.Custom {
+				fmt.Printf("%-22s: %s\n", "Product Extra", s)
+			}
+		}
+	}
+}
+
 func lanConfig() {
 	const (
 		setInProgress byte = iota
@@ -233,7 +456,7 @@ func lanConfig() {
 		"Unspecified", "Static Address", "DHCP Address", "BIOS Assigned Address",
 	}
 
-	ipmi, err := ipmi.Open(0)
+	ipmi, err := open()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -311,7 +534,7 @@ func deviceID() {
 		"Chassis Device",        /* bit 7 */
 	}
 
-	ipmi, err := ipmi.Open(0)
+	ipmi, err := open()
 	if err != nil {
 		fmt.Printf("Failed to open ipmi device: %v\n", err)
 	}
@@ -363,7 +586,7 @@ func deviceID() {
 }
 
 func sendRawCmd(cmds []string) {
-	ipmi, err := ipmi.Open(0)
+	ipmi, err := open()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -32,6 +32,7 @@ require (
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.5.1
 	github.com/u-root/iscsinl v0.0.0-20200619005400-ee1a8f979f68
+	github.com/ulikunitz/xz v0.5.11
 	github.com/vishvananda/netlink v1.1.1-0.20200221165523-c79a4b7b4066
 	github.com/vishvananda/netns v0.0.0-20200520041808-52d707b772fe
 	github.com/vtolstov/go-ioctl v0.0.0-20151206205506-6be9cced4810
@@ -45,5 +46,6 @@ require (
 	google.golang.org/grpc v1.29.1
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/yaml.v2 v2.3.0
+	gopkg.in/yaml.v3 v3.0.0-20200506231410-2ff61e1afc86
 	pack.ag/tftp v1.0.1-0.20181129014014-07909dfbde3c
 )
@@ -0,0 +1,23 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !race
+
+package integration
+
+import (
+	"testing"
+
+	"github.com/u-root/u-root/pkg/vmtest"
+)
+
+// TestArchMatrix boots the core commands on every arch with a kernel in
+// $UROOT_KERNEL_<GOARCH>.
+func TestArchMatrix(t *testing.T) {
+	vmtest.ArchMatrixTest(t, nil, []string{
+		"echo HELLO WORLD",
+		"ls /bbin",
+		"cat /proc/cpuinfo",
+	}, nil)
+}
@@ -0,0 +1,345 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acpi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Decoded tables. Raw tables are fine for copying tables around, but to
+// look inside them, e.g. for the CPUs in the MADT or the PCIe ECAM windows
+// in the MCFG, they need to be decoded. Decoded tables can be modified and
+// marshaled back to a Table for WriteTables.
+
+// ErrUnsupported is returned by Decode for tables it cannot decode.
+var ErrUnsupported = errors.New("table type not supported")
+
+// Decoded is a table decoded into a Go struct.
+type Decoded interface {
+	// Marshal encodes the table, recomputing its length and checksum.
+	Marshal() (Table, error)
+}
+
+var decoders = map[string]func(Table) (Decoded, error){
+	"FACP": func(t Table) (Decoded, error) { return NewFADT(t) },
+	"APIC": func(t Table) (Decoded, error) { return NewMADT(t) },
+	"MCFG": func(t Table) (Decoded, error) { return NewMCFG(t) },
+	"HPET": func(t Table) (Decoded, error) { return NewHPET(t) },
+	"SRAT": func(t Table) (Decoded, error) { return NewSRAT(t) },
+	"DMAR": func(t Table) (Decoded, error) { return NewDMAR(t) },
+}
+
+// Decode decodes a table. It returns ErrUnsupported for tables other than
+// the FADT, MADT, MCFG, HPET, SRAT and DMAR.
+func Decode(t Table) (Decoded, error) {
+	if len(t.Data()) < 4 {
+		return nil, fmt.Errorf("table is only %d bytes", len(t.Data()))
+	}
+	d, ok := decoders[t.Sig()]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", t.Sig(), ErrUnsupported)
+	}
+	return d(t)
+}
+
+// Header is the decoded header common to all tables but the RSDP.
+//
+// OEMID and OEMTableID are kept as they are, padding included.
+type Header struct {
+	Signature       string
+	Length          uint32
+	Revision        uint8
+	Checksum        uint8
+	OEMID           string
+	OEMTableID      string
+	OEMRevision     uint32
+	CreatorID       uint32
+	CreatorRevision uint32
+}
+
+// NewHeader decodes the header of any table but the RSDP.
+func NewHeader(t Table) (*Header, error) {
+	if len(t.Data()) < 4 {
+		return nil, fmt.Errorf("table is only %d bytes", len(t.Data()))
+	}
+	h, _, err := decodeHeader(t, t.Sig())
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// rawHeader is the binary layout of Header.
+type rawHeader struct {
+	Signature       [4]byte
+	Length          uint32
+	Revision        uint8
+	Checksum        uint8
+	OEMID           [6]byte
+	OEMTableID      [8]byte
+	OEMRevision     uint32
+	CreatorID       uint32
+	CreatorRevision uint32
+}
+
+// decodeHeader decodes the header of t, checks it has the signature sig and
+// returns the data after it.
+func decodeHeader(t Table, sig string) (Header, []byte, error) {
+	b := t.Data()
+	var r rawHeader
+	if len(b) < headerLength {
+		return Header{}, nil, fmt.Errorf("%s: table is only %d bytes", sig, len(b))
+	}
+	binary.Read(bytes.NewReader(b), binary.LittleEndian, &r)
+	if string(r.Signature[:]) != sig {
+		return Header{}, nil, fmt.Errorf("table signature is %q, not %q", r.Signature[:], sig)
+	}
+	if int(r.Length) != len(b) {
+		return Header{}, nil, fmt.Errorf("%s: length is %d, but table is %d bytes", sig, r.Length, len(b))
+	}
+	h := Header{
+		Signature:       sig,
+		Length:          r.Length,
+		Revision:        r.Revision,
+		Checksum:        r.Checksum,
+		OEMID:           string(r.OEMID[:]),
+		OEMTableID:      string(r.OEMTableID[:]),
+		OEMRevision:     r.OEMRevision,
+		CreatorID:       r.CreatorID,
+		CreatorRevision: r.CreatorRevision,
+	}
+	return h, b[headerLength:], nil
+}
+
+// marshal returns a table with header h and the given data, updating the
+// length and checksum in h.
+func (h *Header) marshal(data []byte) Table {
+	r := rawHeader{
+		Revision:        h.Revision,
+		OEMRevision:     h.OEMRevision,
+		CreatorID:       h.CreatorID,
+		CreatorRevision: h.CreatorRevision,
+	}
+	copy(r.Signature[:], h.Signature)
+	copy(r.OEMID[:], h.OEMID)
+	copy(r.OEMTableID[:], h.OEMTableID)
+	h.Length = uint32(headerLength + len(data))
+	r.Length = h.Length
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, &r)
+	b.Write(data)
+	t := b.Bytes()
+	h.Checksum = gencsum(t)
+	t[cSUMOffset] = h.Checksum
+	return &Raw{data: t}
+}
+
+// marshalFixed marshals a table whose data is a fixed-size struct.
+func (h *Header) marshalFixed(v interface{}, extra []byte) (Table, error) {
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, v); err != nil {
+		return nil, fmt.Errorf("%s: %v", h.Signature, err)
+	}
+	b.Write(extra)
+	return h.marshal(b.Bytes()), nil
+}
+
+// decodeFixed decodes b into the fixed-size struct v and returns the bytes
+// after it.
+func decodeFixed(b []byte, v interface{}) ([]byte, error) {
+	n := binary.Size(v)
+	if len(b) < n {
+		return nil, fmt.Errorf("%d bytes is too short for %T, want %d", len(b), v, n)
+	}
+	if err := binary.Read(bytes.NewReader(b[:n]), binary.LittleEndian, v); err != nil {
+		return nil, err
+	}
+	return b[n:], nil
+}
+
+// GenericAddress is an ACPI Generic Address Structure, describing a
+// register.
+type GenericAddress struct {
+	// SpaceID is the address space: 0 for system memory, 1 for system
+	// I/O, 2 for PCI configuration space, etc.
+	SpaceID    uint8
+	BitWidth   uint8
+	BitOffset  uint8
+	AccessSize uint8
+	Address    uint64
+}
+
+// Address spaces of a GenericAddress.
+const (
+	AddressSpaceMemory = 0
+	AddressSpaceIO     = 1
+	AddressSpacePCI    = 2
+)
+
+// String implements fmt.Stringer.
+func (g GenericAddress) String() string {
+	space := fmt.Sprintf("space %d", g.SpaceID)
+	switch g.SpaceID {
+	case AddressSpaceMemory:
+		space = "mem"
+	case AddressSpaceIO:
+		space = "io"
+	case AddressSpacePCI:
+		space = "pci"
+	}
+	return fmt.Sprintf("%s %#x [%d bits at %d, access size %d]", space, g.Address, g.BitWidth, g.BitOffset, g.AccessSize)
+}
+
+// Subtable is one of the variable-length structures following the fixed
+// part of the MADT, SRAT and DMAR, such as a CPU's local APIC.
+//
+// Structures of unknown type or size are kept as UnknownSubtable.
+type Subtable interface {
+	// SubtableType returns the type of the structure.
+	SubtableType() uint16
+}
+
+// UnknownSubtable is a Subtable that is not decoded.
+type UnknownSubtable struct {
+	Type uint16
+	// Data is the structure after its type and length.
+	Data []byte
+}
+
+// SubtableType implements Subtable.
+func (u *UnknownSubtable) SubtableType() uint16 {
+	return u.Type
+}
+
+func (u *UnknownSubtable) marshalSubtable() ([]byte, error) {
+	return u.Data, nil
+}
+
+// Subtables is a list of subtables.
+type Subtables []Subtable
+
+// MarshalJSON implements json.Marshaler, adding the name of the type of
+// each subtable.
+func (s Subtables) MarshalJSON() ([]byte, error) {
+	type typed struct {
+		Type  string
+		Value Subtable
+	}
+	out := make([]typed, len(s))
+	for i, st := range s {
+		out[i] = typed{reflect.Indirect(reflect.ValueOf(st)).Type().Name(), st}
+	}
+	return json.Marshal(out)
+}
+
+// subtableFormat describes how subtables are encoded in a table.
+type subtableFormat struct {
+	// wide means the type and length are 16 bits, rather than 8.
+	wide bool
+
+	// fixed returns a new fixed-size subtable of the given type, if there
+	// is one.
+	fixed func(typ uint16) Subtable
+
+	// decode decodes a variable-size subtable of the given type, if there
+	// is one.
+	decode func(typ uint16, data []byte) (Subtable, bool, error)
+}
+
+func (f subtableFormat) headerLen() int {
+	if f.wide {
+		return 4
+	}
+	return 2
+}
+
+func (f subtableFormat) parse(b []byte) (Subtables, error) {
+	var s Subtables
+	hl := f.headerLen()
+	for len(b) > 0 {
+		if len(b) < hl {
+			return nil, fmt.Errorf("%d bytes left over after subtables", len(b))
+		}
+		var typ uint16
+		var length int
+		if f.wide {
+			typ = binary.LittleEndian.Uint16(b)
+			length = int(binary.LittleEndian.Uint16(b[2:]))
+		} else {
+			typ, length = uint16(b[0]), int(b[1])
+		}
+		if length < hl || length > len(b) {
+			return nil, fmt.Errorf("subtable of type %d has bad length %d", typ, length)
+		}
+		data := b[hl:length]
+		b = b[length:]
+
+		if f.decode != nil {
+			st, ok, err := f.decode(typ, data)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				s = append(s, st)
+				continue
+			}
+		}
+		if f.fixed != nil {
+			if st := f.fixed(typ); st != nil && binary.Size(st) == len(data) {
+				if _, err := decodeFixed(data, st); err != nil {
+					return nil, err
+				}
+				s = append(s, st)
+				continue
+			}
+		}
+		s = append(s, &UnknownSubtable{Type: typ, Data: append([]byte(nil), data...)})
+	}
+	return s, nil
+}
+
+func (f subtableFormat) marshal(s Subtables) ([]byte, error) {
+	var b bytes.Buffer
+	for _, st := range s {
+		var data []byte
+		if m, ok := st.(interface{ marshalSubtable() ([]byte, error) }); ok {
+			d, err := m.marshalSubtable()
+			if err != nil {
+				return nil, err
+			}
+			data = d
+		} else {
+			var d bytes.Buffer
+			if err := binary.Write(&d, binary.LittleEndian, st); err != nil {
+				return nil, fmt.Errorf("%T: %v", st, err)
+			}
+			data = d.Bytes()
+		}
+
+		length := f.headerLen() + len(data)
+		if f.wide {
+			if length > 0xffff {
+				return nil, fmt.Errorf("%T is %d bytes, too long", st, length)
+			}
+			binary.Write(&b, binary.LittleEndian, [2]uint16{st.SubtableType(), uint16(length)})
+		} else {
+			if length > 0xff {
+				return nil, fmt.Errorf("%T is %d bytes, too long", st, length)
+			}
+			if st.SubtableType() > 0xff {
+				return nil, fmt.Errorf("%T has type %d, too large", st, st.SubtableType())
+			}
+			b.Write([]byte{uint8(st.SubtableType()), uint8(length)})
+		}
+		b.Write(data)
+	}
+	return b.Bytes(), nil
+}
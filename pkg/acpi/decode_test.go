@@ -0,0 +1,353 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acpi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// le encodes values little-endian, back to back.
+func le(v ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, x := range v {
+		if err := binary.Write(&b, binary.LittleEndian, x); err != nil {
+			panic(err)
+		}
+	}
+	return b.Bytes()
+}
+
+// testTable returns a table with a valid header and checksum.
+func testTable(sig string, rev uint8, data []byte) Table {
+	h := &Header{
+		Signature:       sig,
+		Revision:        rev,
+		OEMID:           "UROOT ",
+		OEMTableID:      "TESTTBL ",
+		OEMRevision:     1,
+		CreatorID:       0x4c544e49,
+		CreatorRevision: 0x20200101,
+	}
+	return h.marshal(data)
+}
+
+// checkRoundTrip checks that d marshals back to t.
+func checkRoundTrip(t *testing.T, tab Table, d Decoded) {
+	t.Helper()
+	got, err := d.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	if !bytes.Equal(got.Data(), tab.Data()) {
+		t.Errorf("Marshal() = %#x, want %#x", got.Data(), tab.Data())
+	}
+	if gencsum(got.Data()) != 0 {
+		t.Errorf("Marshal() has a bad checksum")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	tab := testTable("HPET", 1, make([]byte, 16))
+	if tab.Sig() != "HPET" || tab.Len() != 52 || tab.OEMID() != `"UROOT "` || gencsum(tab.Data()) != 0 {
+		t.Errorf("testTable() = %s", String(tab))
+	}
+
+	if _, err := NewMADT(tab); err == nil || !strings.Contains(err.Error(), `not "APIC"`) {
+		t.Errorf("NewMADT(HPET) = %v, want signature error", err)
+	}
+	if _, err := NewHPET(tab); err == nil || !strings.Contains(err.Error(), "too short") {
+		t.Errorf("NewHPET(short) = %v, want too short error", err)
+	}
+	if _, err := Decode(testTable("DSDT", 2, nil)); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Decode(DSDT) = %v, want %v", err, ErrUnsupported)
+	}
+	truncated := &Raw{data: tab.Data()[:40]}
+	if _, err := NewHPET(truncated); err == nil || !strings.Contains(err.Error(), "length is 52") {
+		t.Errorf("NewHPET(truncated) = %v, want length error", err)
+	}
+}
+
+func TestMADT(t *testing.T) {
+	tab := testTable("APIC", 5, bytes.Join([][]byte{
+		le(uint32(0xfee00000), uint32(1)),
+		le(uint8(0), uint8(8), uint8(0), uint8(0), uint32(MADTEnabled)),
+		le(uint8(0), uint8(8), uint8(1), uint8(2), uint32(MADTOnlineCapable)),
+		le(uint8(1), uint8(12), uint8(3), uint8(0), uint32(0xfec00000), uint32(0)),
+		le(uint8(2), uint8(10), uint8(0), uint8(0), uint32(2), uint16(0)),
+		le(uint8(4), uint8(6), uint8(0xff), uint16(5), uint8(1)),
+		le(uint8(9), uint8(16), uint16(0), uint32(256), uint32(MADTEnabled), uint32(2)),
+		// Unknown type.
+		le(uint8(0x7f), uint8(4), uint16(0xabcd)),
+		// Known type with an unexpected length.
+		le(uint8(0), uint8(10), uint8(3), uint8(3), uint32(MADTEnabled), uint16(0)),
+	}, nil))
+
+	d, err := Decode(tab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := d.(*MADT)
+	if m.Signature != "APIC" || m.Revision != 5 || m.OEMTableID != "TESTTBL " || m.LocalAPICAddress != 0xfee00000 || m.Flags != 1 {
+		t.Errorf("NewMADT() = %+v", m)
+	}
+	want := Subtables{
+		&MADTLocalAPIC{ACPIProcessorUID: 0, APICID: 0, Flags: MADTEnabled},
+		&MADTLocalAPIC{ACPIProcessorUID: 1, APICID: 2, Flags: MADTOnlineCapable},
+		&MADTIOAPIC{IOAPICID: 3, Address: 0xfec00000},
+		&MADTInterruptOverride{GSI: 2},
+		&MADTLocalAPICNMI{ACPIProcessorUID: 0xff, Flags: 5, LINT: 1},
+		&MADTLocalX2APIC{X2APICID: 256, Flags: MADTEnabled, ACPIProcessorUID: 2},
+		&UnknownSubtable{Type: 0x7f, Data: []byte{0xcd, 0xab}},
+		&UnknownSubtable{Type: 0, Data: []byte{3, 3, 1, 0, 0, 0, 0, 0}},
+	}
+	if !reflect.DeepEqual(m.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", m.Entries, want)
+	}
+	wantCPUs := []CPU{
+		{ACPIProcessorUID: 0, ID: 0, Enabled: true},
+		{ACPIProcessorUID: 1, ID: 2, Enabled: false},
+		{ACPIProcessorUID: 2, ID: 256, Enabled: true},
+	}
+	if got := m.CPUs(); !reflect.DeepEqual(got, wantCPUs) {
+		t.Errorf("CPUs() = %+v, want %+v", got, wantCPUs)
+	}
+	checkRoundTrip(t, tab, m)
+
+	// Modify and marshal.
+	m.Entries = append(m.Entries[:1], m.Entries[2:]...)
+	m.Entries[0].(*MADTLocalAPIC).APICID = 4
+	mod, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mod.Len() != tab.Len()-8 || m.Length != mod.Len() || gencsum(mod.Data()) != 0 {
+		t.Errorf("modified MADT is %d bytes, want %d", mod.Len(), tab.Len()-8)
+	}
+	m2, err := NewMADT(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m2.CPUs(); len(got) != 2 || got[0].ID != 4 {
+		t.Errorf("CPUs() of modified MADT = %+v", got)
+	}
+
+	j, err := json.Marshal(m.Entries[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"Type":"MADTLocalAPIC","Value":{"ACPIProcessorUID":0,"APICID":4,"Flags":1}}]`; string(j) != want {
+		t.Errorf("JSON = %s, want %s", j, want)
+	}
+
+	bad := testTable("APIC", 5, le(uint32(0), uint32(0), uint8(0), uint8(1)))
+	if _, err := NewMADT(bad); err == nil || !strings.Contains(err.Error(), "bad length 1") {
+		t.Errorf("NewMADT(bad length) = %v", err)
+	}
+}
+
+func TestMCFG(t *testing.T) {
+	tab := testTable("MCFG", 1, bytes.Join([][]byte{
+		make([]byte, 8),
+		le(uint64(0xb0000000), uint16(0), uint8(0), uint8(0xff), uint32(0)),
+		le(uint64(0x3f000000000), uint16(1), uint8(0x80), uint8(0x8f), uint32(0)),
+	}, nil))
+	d, err := Decode(tab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := d.(*MCFG)
+	want := []MCFGEntry{
+		{BaseAddress: 0xb0000000, EndBus: 0xff},
+		{BaseAddress: 0x3f000000000, Segment: 1, StartBus: 0x80, EndBus: 0x8f},
+	}
+	if !reflect.DeepEqual(m.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", m.Entries, want)
+	}
+	if got := m.Entries[1].String(); got != "segment 1 busses 0x80-0x8f at 0x3f000000000" {
+		t.Errorf("String() = %q", got)
+	}
+	checkRoundTrip(t, tab, m)
+
+	if _, err := NewMCFG(testTable("MCFG", 1, make([]byte, 12))); err == nil {
+		t.Errorf("NewMCFG() accepted a partial entry")
+	}
+}
+
+func TestHPET(t *testing.T) {
+	tab := testTable("HPET", 1, le(
+		uint32(0x8086a201),
+		GenericAddress{SpaceID: AddressSpaceMemory, BitWidth: 64, Address: 0xfed00000},
+		uint8(0), uint16(128), uint8(0),
+	))
+	d, err := Decode(tab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := d.(*HPET)
+	if h.EventTimerBlockID != 0x8086a201 || h.BaseAddress.Address != 0xfed00000 || h.MinClockTick != 128 {
+		t.Errorf("NewHPET() = %+v", h)
+	}
+	if got := h.BaseAddress.String(); got != "mem 0xfed00000 [64 bits at 0, access size 0]" {
+		t.Errorf("String() = %q", got)
+	}
+	checkRoundTrip(t, tab, h)
+}
+
+func TestFADT(t *testing.T) {
+	full := FADTData{
+		DSDT:          0x7ffe0040,
+		SCIInterrupt:  9,
+		PMTimerBlock:  0x608,
+		PMTimerLength: 4,
+		Flags:         FADTHardwareReducedACPI,
+		ResetRegister: GenericAddress{SpaceID: AddressSpaceIO, BitWidth: 8, Address: 0xcf9},
+		ResetValue:    6,
+		XDSDT:         0x7ffe0040,
+		MinorVersion:  1,
+	}
+	for _, tt := range []struct {
+		name string
+		size int
+		rev  uint8
+	}{
+		{"ACPI 1.0", 80, 1},
+		{"ACPI 5.0", 232, 5},
+		{"ACPI 6.4", 240, 6},
+		{"longer", 250, 7},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data := le(&full)
+			if tt.size <= len(data) {
+				data = data[:tt.size]
+			} else {
+				data = append(data, bytes.Repeat([]byte{0xaa}, tt.size-len(data))...)
+			}
+			tab := testTable("FACP", tt.rev, data)
+			d, err := Decode(tab)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := d.(*FADT)
+			if f.DSDTAddress() != 0x7ffe0040 || f.SCIInterrupt != 9 || f.PMTimerBlock != 0x608 {
+				t.Errorf("NewFADT() = %+v", f)
+			}
+			if tt.size > 80 && (f.ResetRegister.Address != 0xcf9 || f.Flags != FADTHardwareReducedACPI) {
+				t.Errorf("NewFADT() = %+v", f)
+			}
+			if tt.size == 80 && f.XDSDT != 0 {
+				t.Errorf("ACPI 1.0 FADT has 64-bit DSDT address %#x", f.XDSDT)
+			}
+			if tt.size > 240 && len(f.Extra) != tt.size-240 {
+				t.Errorf("Extra is %d bytes, want %d", len(f.Extra), tt.size-240)
+			}
+			checkRoundTrip(t, tab, f)
+		})
+	}
+}
+
+func TestSRAT(t *testing.T) {
+	tab := testTable("SRAT", 3, bytes.Join([][]byte{
+		le(uint32(1), uint64(0)),
+		le(uint8(0), uint8(16), uint8(1), uint8(2), uint32(SRATEnabled), uint8(0), [3]uint8{0, 1, 0}, uint32(0)),
+		le(uint8(1), uint8(40), uint32(0), uint16(0), uint64(0), uint64(0xa0000), uint32(0), uint32(SRATEnabled), uint64(0)),
+		le(uint8(1), uint8(40), uint32(1), uint16(0), uint64(0x100000000), uint64(0x80000000), uint32(0), uint32(SRATEnabled|SRATHotPluggable), uint64(0)),
+		le(uint8(1), uint8(40), uint32(1), uint16(0), uint64(0x200000000), uint64(0x80000000), uint32(0), uint32(0), uint64(0)),
+		le(uint8(2), uint8(24), uint16(0), uint32(1), uint32(300), uint32(SRATEnabled), uint32(0), uint32(0)),
+		le(uint8(3), uint8(18), uint32(1), uint32(4), uint32(SRATEnabled), uint32(0)),
+	}, nil))
+	d, err := Decode(tab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.(*SRAT)
+	if len(s.Entries) != 6 {
+		t.Fatalf("entries = %+v", s.Entries)
+	}
+	if p, ok := s.Entries[0].(*SRATProcessorAffinity); !ok || p.ProximityDomain() != 0x10001 || p.APICID != 2 {
+		t.Errorf("processor affinity = %+v", s.Entries[0])
+	}
+	if x, ok := s.Entries[4].(*SRATX2APICAffinity); !ok || x.X2APICID != 300 || x.ProximityDomain != 1 {
+		t.Errorf("x2APIC affinity = %+v", s.Entries[4])
+	}
+	if g, ok := s.Entries[5].(*SRATGICCAffinity); !ok || g.ACPIProcessorUID != 4 {
+		t.Errorf("GICC affinity = %+v", s.Entries[5])
+	}
+	mem := s.MemoryAffinity()
+	if len(mem) != 2 || mem[1].BaseAddress != 0x100000000 || mem[1].ProximityDomain != 1 || mem[1].Flags&SRATHotPluggable == 0 {
+		t.Errorf("MemoryAffinity() = %+v", mem)
+	}
+	checkRoundTrip(t, tab, s)
+
+	// A new SRAT gets the reserved 1.
+	n := &SRAT{Header: Header{Signature: "SRAT", Revision: 3}}
+	nt, err := n.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nt.TableData(), le(uint32(1), uint64(0))) {
+		t.Errorf("new SRAT data = %#x", nt.TableData())
+	}
+}
+
+func TestDMAR(t *testing.T) {
+	tab := testTable("DMAR", 1, bytes.Join([][]byte{
+		{38, 1}, make([]byte, 10),
+		// DRHD with an IOAPIC and an HPET.
+		le(uint16(0), uint16(32), uint8(1), uint8(0), uint16(0), uint64(0xfed90000)),
+		le(uint8(3), uint8(8), uint16(0), uint8(2), uint8(0xf0), uint8(0x1f), uint8(0)),
+		le(uint8(4), uint8(8), uint16(0), uint8(0), uint8(0), uint8(0x1f), uint8(7)),
+		// RMRR for a USB controller behind a bridge.
+		le(uint16(1), uint16(34), uint16(0), uint16(0), uint64(0x7c000000), uint64(0x7c7fffff)),
+		le(uint8(1), uint8(10), uint16(0), uint8(0), uint8(0), uint8(0x1c), uint8(0), uint8(0), uint8(0)),
+		// ATSR for all ports.
+		le(uint16(2), uint16(8), uint8(1), uint8(0), uint16(0)),
+		// RHSA.
+		le(uint16(3), uint16(20), uint32(0), uint64(0xfed90000), uint32(1)),
+		// ANDD.
+		le(uint16(4), uint16(17), [3]uint8{}, uint8(1)), []byte("\\_SB.I2C\x00"),
+		// Unknown.
+		le(uint16(5), uint16(6), uint16(0x1234)),
+	}, nil))
+	d, err := Decode(tab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := d.(*DMAR)
+	if m.HostAddressWidth != 38 || m.Flags != 1 {
+		t.Errorf("NewDMAR() = %+v", m)
+	}
+	want := Subtables{
+		&DMARDRHD{Flags: 1, RegisterBaseAddress: 0xfed90000, Scopes: []DMARDeviceScope{
+			{Type: 3, EnumerationID: 2, StartBus: 0xf0, Path: []DMARPathEntry{{0x1f, 0}}},
+			{Type: 4, StartBus: 0, Path: []DMARPathEntry{{0x1f, 7}}},
+		}},
+		&DMARRMRR{BaseAddress: 0x7c000000, LimitAddress: 0x7c7fffff, Scopes: []DMARDeviceScope{
+			{Type: 1, Path: []DMARPathEntry{{0x1c, 0}, {0, 0}}},
+		}},
+		&DMARATSR{Flags: 1},
+		&DMARRHSA{RegisterBaseAddress: 0xfed90000, ProximityDomain: 1},
+		&DMARANDD{ACPIDeviceNumber: 1, ObjectName: `\_SB.I2C`},
+		&UnknownSubtable{Type: 5, Data: []byte{0x34, 0x12}},
+	}
+	if !reflect.DeepEqual(m.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", m.Entries, want)
+	}
+	checkRoundTrip(t, tab, m)
+
+	bad := testTable("DMAR", 1, bytes.Join([][]byte{
+		{38, 1}, make([]byte, 10),
+		le(uint16(0), uint16(18), uint8(1), uint8(0), uint16(0), uint64(0xfed90000)),
+		le(uint8(3), uint8(7)),
+	}, nil))
+	if _, err := NewDMAR(bad); err == nil || !strings.Contains(err.Error(), "bad device scope") {
+		t.Errorf("NewDMAR(bad scope) = %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acpi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// DMAR is the DMA Remapping table, signature "DMAR". It describes Intel VT-d
+// IOMMUs and the devices behind them.
+type DMAR struct {
+	Header
+	// HostAddressWidth is the maximum DMA physical address width minus 1.
+	HostAddressWidth uint8
+	// Flags bit 0 means interrupt remapping is supported.
+	Flags   uint8
+	Entries Subtables
+}
+
+// dmarReserved is the size of the reserved field before the entries.
+const dmarReserved = 10
+
+// DMARDeviceScope is a device, or the devices below a bridge, that a
+// remapping structure applies to.
+type DMARDeviceScope struct {
+	// Type is 1 for a PCI endpoint, 2 for a PCI bridge, 3 for an
+	// IOAPIC, 4 for an HPET and 5 for an ACPI namespace device.
+	Type          uint8
+	EnumerationID uint8
+	StartBus      uint8
+	// Path is the device and function numbers of the bridges to the
+	// device, followed by those of the device.
+	Path []DMARPathEntry
+}
+
+// DMARPathEntry is a hop in a DMARDeviceScope's path.
+type DMARPathEntry struct {
+	Device   uint8
+	Function uint8
+}
+
+// DMARDRHD is a DMA remapping hardware unit, i.e. an IOMMU, type 0.
+type DMARDRHD struct {
+	// Flags bit 0 means the unit covers all devices of the segment not
+	// covered by another.
+	Flags               uint8
+	Size                uint8
+	Segment             uint16
+	RegisterBaseAddress uint64
+	Scopes              []DMARDeviceScope
+}
+
+// DMARRMRR is a memory range devices use for DMA that must stay identity
+// mapped, type 1.
+type DMARRMRR struct {
+	Segment      uint16
+	BaseAddress  uint64
+	LimitAddress uint64
+	Scopes       []DMARDeviceScope
+}
+
+// DMARATSR lists root ports supporting Address Translation Services, type
+// 2.
+type DMARATSR struct {
+	// Flags bit 0 means all root ports of the segment support it.
+	Flags   uint8
+	Segment uint16
+	Scopes  []DMARDeviceScope
+}
+
+// DMARRHSA is the proximity domain of a remapping hardware unit, type 3.
+type DMARRHSA struct {
+	_                   uint32
+	RegisterBaseAddress uint64
+	ProximityDomain     uint32
+}
+
+// DMARANDD is an ACPI namespace device, type 4.
+type DMARANDD struct {
+	ACPIDeviceNumber uint8
+	ObjectName       string
+}
+
+// SubtableType implements Subtable.
+func (*DMARDRHD) SubtableType() uint16 { return 0 }
+
+// SubtableType implements Subtable.
+func (*DMARRMRR) SubtableType() uint16 { return 1 }
+
+// SubtableType implements Subtable.
+func (*DMARATSR) SubtableType() uint16 { return 2 }
+
+// SubtableType implements Subtable.
+func (*DMARRHSA) SubtableType() uint16 { return 3 }
+
+// SubtableType implements Subtable.
+func (*DMARANDD) SubtableType() uint16 { return 4 }
+
+var dmarFormat = subtableFormat{
+	wide: true,
+	fixed: func(typ uint16) Subtable {
+		if typ == 3 {
+			return &DMARRHSA{}
+		}
+		return nil
+	},
+	decode: decodeDMARSubtable,
+}
+
+func decodeDMARSubtable(typ uint16, b []byte) (Subtable, bool, error) {
+	var (
+		s   Subtable
+		err error
+	)
+	switch typ {
+	case 0:
+		var h struct {
+			Flags, Size uint8
+			Segment     uint16
+			Base        uint64
+		}
+		if b, err = decodeFixed(b, &h); err != nil {
+			return nil, false, fmt.Errorf("DRHD: %v", err)
+		}
+		d := &DMARDRHD{Flags: h.Flags, Size: h.Size, Segment: h.Segment, RegisterBaseAddress: h.Base}
+		d.Scopes, err = decodeDMARScopes(b)
+		s = d
+	case 1:
+		var h struct {
+			_           uint16
+			Segment     uint16
+			Base, Limit uint64
+		}
+		if b, err = decodeFixed(b, &h); err != nil {
+			return nil, false, fmt.Errorf("RMRR: %v", err)
+		}
+		r := &DMARRMRR{Segment: h.Segment, BaseAddress: h.Base, LimitAddress: h.Limit}
+		r.Scopes, err = decodeDMARScopes(b)
+		s = r
+	case 2:
+		var h struct {
+			Flags   uint8
+			_       uint8
+			Segment uint16
+		}
+		if b, err = decodeFixed(b, &h); err != nil {
+			return nil, false, fmt.Errorf("ATSR: %v", err)
+		}
+		a := &DMARATSR{Flags: h.Flags, Segment: h.Segment}
+		a.Scopes, err = decodeDMARScopes(b)
+		s = a
+	case 4:
+		if len(b) < 5 || b[len(b)-1] != 0 {
+			return nil, false, fmt.Errorf("ANDD: object name is not NUL-terminated")
+		}
+		s = &DMARANDD{ACPIDeviceNumber: b[3], ObjectName: string(b[4 : len(b)-1])}
+	default:
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return s, true, nil
+}
+
+func decodeDMARScopes(b []byte) ([]DMARDeviceScope, error) {
+	var scopes []DMARDeviceScope
+	for len(b) > 0 {
+		if len(b) < 6 || int(b[1]) < 6 || int(b[1]) > len(b) || b[1]%2 != 0 {
+			return nil, fmt.Errorf("bad device scope %#x", b)
+		}
+		s := DMARDeviceScope{Type: b[0], EnumerationID: b[4], StartBus: b[5]}
+		for i := 6; i < int(b[1]); i += 2 {
+			s.Path = append(s.Path, DMARPathEntry{Device: b[i], Function: b[i+1]})
+		}
+		scopes = append(scopes, s)
+		b = b[b[1]:]
+	}
+	return scopes, nil
+}
+
+func marshalDMARScopes(w *bytes.Buffer, scopes []DMARDeviceScope) error {
+	for _, s := range scopes {
+		length := 6 + 2*len(s.Path)
+		if length > 0xff {
+			return fmt.Errorf("device scope path %v is too long", s.Path)
+		}
+		w.Write([]byte{s.Type, uint8(length), 0, 0, s.EnumerationID, s.StartBus})
+		for _, p := range s.Path {
+			w.Write([]byte{p.Device, p.Function})
+		}
+	}
+	return nil
+}
+
+func (d *DMARDRHD) marshalSubtable() ([]byte, error) {
+	var b bytes.Buffer
+	b.Write([]byte{d.Flags, d.Size})
+	binary.Write(&b, binary.LittleEndian, d.Segment)
+	binary.Write(&b, binary.LittleEndian, d.RegisterBaseAddress)
+	err := marshalDMARScopes(&b, d.Scopes)
+	return b.Bytes(), err
+}
+
+func (r *DMARRMRR) marshalSubtable() ([]byte, error) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, [2]uint16{0, r.Segment})
+	binary.Write(&b, binary.LittleEndian, [2]uint64{r.BaseAddress, r.LimitAddress})
+	err := marshalDMARScopes(&b, r.Scopes)
+	return b.Bytes(), err
+}
+
+func (a *DMARATSR) marshalSubtable() ([]byte, error) {
+	var b bytes.Buffer
+	b.Write([]byte{a.Flags, 0})
+	binary.Write(&b, binary.LittleEndian, a.Segment)
+	err := marshalDMARScopes(&b, a.Scopes)
+	return b.Bytes(), err
+}
+
+func (a *DMARANDD) marshalSubtable() ([]byte, error) {
+	b := []byte{0, 0, 0, a.ACPIDeviceNumber}
+	b = append(b, a.ObjectName...)
+	return append(b, 0), nil
+}
+
+// NewDMAR decodes a DMAR.
+func NewDMAR(t Table) (*DMAR, error) {
+	h, b, err := decodeHeader(t, "DMAR")
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 2+dmarReserved {
+		return nil, fmt.Errorf("DMAR: table is too short")
+	}
+	d := &DMAR{Header: h, HostAddressWidth: b[0], Flags: b[1]}
+	if d.Entries, err = dmarFormat.parse(b[2+dmarReserved:]); err != nil {
+		return nil, fmt.Errorf("DMAR: %v", err)
+	}
+	return d, nil
+}
+
+// Marshal implements Decoded.
+func (d *DMAR) Marshal() (Table, error) {
+	entries, err := dmarFormat.marshal(d.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("DMAR: %v", err)
+	}
+	b := append([]byte{d.HostAddressWidth, d.Flags}, make([]byte, dmarReserved)...)
+	return d.Header.marshal(append(b, entries...)), nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acpi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// FADT is the Fixed ACPI Description Table, signature "FACP". It describes
+// the fixed hardware registers, e.g. for power management, and points to the
+// DSDT.
+//
+// Tables from before ACPI 6 are shorter; the missing fields are zero, and
+// are left out again by Marshal.
+type FADT struct {
+	Header
+	FADTData
+
+	// Extra is any data after the fields of FADTData.
+	Extra []byte `json:",omitempty"`
+
+	// size is the size of the data the table was decoded from, if it is
+	// shorter than FADTData.
+	size int
+}
+
+// FADTData is the data of the FADT after the header, as of ACPI 6.4.
+type FADTData struct {
+	FirmwareCtrl       uint32
+	DSDT               uint32
+	_                  uint8
+	PreferredPMProfile uint8
+	SCIInterrupt       uint16
+	SMICommand         uint32
+	ACPIEnable         uint8
+	ACPIDisable        uint8
+	S4BIOSRequest      uint8
+	PStateControl      uint8
+	PM1aEventBlock     uint32
+	PM1bEventBlock     uint32
+	PM1aControlBlock   uint32
+	PM1bControlBlock   uint32
+	PM2ControlBlock    uint32
+	PMTimerBlock       uint32
+	GPE0Block          uint32
+	GPE1Block          uint32
+	PM1EventLength     uint8
+	PM1ControlLength   uint8
+	PM2ControlLength   uint8
+	PMTimerLength      uint8
+	GPE0BlockLength    uint8
+	GPE1BlockLength    uint8
+	GPE1Base           uint8
+	CStateControl      uint8
+	C2Latency          uint16
+	C3Latency          uint16
+	FlushSize          uint16
+	FlushStride        uint16
+	DutyOffset         uint8
+	DutyWidth          uint8
+	DayAlarm           uint8
+	MonthAlarm         uint8
+	Century            uint8
+	IAPCBootArch       uint16
+	_                  uint8
+	Flags              uint32
+	ResetRegister      GenericAddress
+	ResetValue         uint8
+	ARMBootArch        uint16
+	MinorVersion       uint8
+
+	// The 64-bit fields replace the 32-bit ones when they are set.
+	XFirmwareCtrl     uint64
+	XDSDT             uint64
+	XPM1aEventBlock   GenericAddress
+	XPM1bEventBlock   GenericAddress
+	XPM1aControlBlock GenericAddress
+	XPM1bControlBlock GenericAddress
+	XPM2ControlBlock  GenericAddress
+	XPMTimerBlock     GenericAddress
+	XGPE0Block        GenericAddress
+	XGPE1Block        GenericAddress
+
+	SleepControlRegister GenericAddress
+	SleepStatusRegister  GenericAddress
+	HypervisorVendorID   uint64
+}
+
+// Flags of the FADT.
+const (
+	// FADTHardwareReducedACPI means there is no fixed hardware, as on
+	// arm64.
+	FADTHardwareReducedACPI = 1 << 20
+	// FADTLowPowerS0Idle means S0 idle is better than S3.
+	FADTLowPowerS0Idle = 1 << 21
+)
+
+// NewFADT decodes a FADT.
+func NewFADT(t Table) (*FADT, error) {
+	h, b, err := decodeHeader(t, "FACP")
+	if err != nil {
+		return nil, err
+	}
+	f := &FADT{Header: h}
+	full := binary.Size(&f.FADTData)
+	data := b
+	if len(b) < full {
+		f.size = len(b)
+		data = append(append([]byte(nil), b...), make([]byte, full-len(b))...)
+	}
+	rest, err := decodeFixed(data, &f.FADTData)
+	if err != nil {
+		return nil, fmt.Errorf("FACP: %v", err)
+	}
+	if len(rest) > 0 {
+		f.Extra = append([]byte(nil), rest...)
+	}
+	return f, nil
+}
+
+// Marshal implements Decoded.
+func (f *FADT) Marshal() (Table, error) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, &f.FADTData)
+	data := b.Bytes()
+	if f.size > 0 && f.size < len(data) {
+		data = data[:f.size]
+	}
+	return f.Header.marshal(append(data, f.Extra...)), nil
+}
+
+// DSDTAddress returns the address of the DSDT, preferring the 64-bit one.
+func (f *FADT) DSDTAddress() uint64 {
+	if f.XDSDT != 0 {
+		return f.XDSDT
+	}
+	return uint64(f.DSDT)
+}
+
+// FACSAddress returns the address of the FACS, preferring the 64-bit one.
+func (f *FADT) FACSAddress() uint64 {
+	if f.XFirmwareCtrl != 0 {
+		return f.XFirmwareCtrl
+	}
+	return uint64(f.FirmwareCtrl)
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acpi
+
+import "fmt"
+
+// HPET is the High Precision Event Timer table, signature "HPET".
+type HPET struct {
+	Header
+	HPETData
+}
+
+// HPETData is the data of the HPET after the header.
+type HPETData struct {
+	// EventTimerBlockID is the HPET's capabilities register: the PCI
+	// vendor ID of the hardware in bits 16-31, the number of
+	// comparators minus one in bits 8-12, and its revision in bits 0-7.
+	EventTimerBlockID uint32
+	BaseAddress       GenericAddress
+	HPETNumber        uint8
+	// MinClockTick is the minimum number of ticks in periodic mode.
+	MinClockTick   uint16
+	PageProtection uint8
+}
+
+// NewHPET decodes an HPET table.
+func NewHPET(t Table) (*HPET, error) {
+	h, b, err := decodeHeader(t, "HPET")
+	if err != nil {
+		return nil, err
+	}
+	hpet := &HPET{Header: h}
+	if _, err := decodeFixed(b, &hpet.HPETData); err != nil {
+		return nil, fmt.Errorf("HPET: %v", err)
+	}
+	return hpet, nil
+}
+
+// Marshal implements Decoded.
+func (h *HPET) Marshal() (Table, error) {
+	return h.Header.marshalFixed(&h.HPETData, nil)
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acpi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// MADT is the Multiple APIC Description Table, signature "APIC". It lists
+// the interrupt controllers, and hence the CPUs, of the system.
+type MADT struct {
+	Header
+	LocalAPICAddress uint32
+	// Flags bit 0 means the system has 8259 PICs too.
+	Flags   uint32
+	Entries Subtables
+}
+
+// Flags of the MADT processor structures.
+const (
+	// MADTEnabled means the processor is usable.
+	MADTEnabled = 1 << 0
+	// MADTOnlineCapable means the processor can be enabled at run time.
+	MADTOnlineCapable = 1 << 1
+)
+
+// MADTLocalAPIC is a processor's local APIC, type 0.
+type MADTLocalAPIC struct {
+	ACPIProcessorUID uint8
+	APICID           uint8
+	Flags            uint32
+}
+
+// MADTIOAPIC is an I/O APIC, type 1.
+type MADTIOAPIC struct {
+	IOAPICID uint8
+	_        uint8
+	Address  uint32
+	GSIBase  uint32
+}
+
+// MADTInterruptOverride is an interrupt source override, type 2: an ISA
+// interrupt that is not identity-mapped to a global system interrupt.
+type MADTInterruptOverride struct {
+	Bus    uint8
+	Source uint8
+	GSI    uint32
+	Flags  uint16
+}
+
+// MADTNMISource is a non-maskable interrupt source, type 3.
+type MADTNMISource struct {
+	Flags uint16
+	GSI   uint32
+}
+
+// MADTLocalAPICNMI is the LINT pin of processors' local APICs an NMI is
+// connected to, type 4. A UID of 0xff means all processors.
+type MADTLocalAPICNMI struct {
+	ACPIProcessorUID uint8
+	Flags            uint16
+	LINT             uint8
+}
+
+// MADTLocalAPICAddressOverride is the 64-bit address of the local APICs,
+// type 5.
+type MADTLocalAPICAddressOverride struct {
+	_       uint16
+	Address uint64
+}
+
+// MADTLocalX2APIC is a processor's local x2APIC, type 9, used for APIC IDs
+// of 255 and above.
+type MADTLocalX2APIC struct {
+	_                uint16
+	X2APICID         uint32
+	Flags            uint32
+	ACPIProcessorUID uint32
+}
+
+// MADTLocalX2APICNMI is the LINT pin of processors' local x2APICs an NMI is
+// connected to, type 10.
+type MADTLocalX2APICNMI struct {
+	Flags            uint16
+	ACPIProcessorUID uint32
+	LINT             uint8
+	_                [3]uint8
+}
+
+// MADTGICC is an arm64 GIC CPU interface, i.e. a processor, type 11, as of
+// ACPI 6.3.
+type MADTGICC struct {
+	_                             uint16
+	CPUInterfaceNumber            uint32
+	ACPIProcessorUID              uint32
+	Flags                         uint32
+	ParkingProtocolVersion        uint32
+	PerformanceInterruptGSIV      uint32
+	ParkedAddress                 uint64
+	PhysicalBaseAddress           uint64
+	GICV                          uint64
+	GICH                          uint64
+	VGICMaintenanceInterrupt      uint32
+	GICRBaseAddress               uint64
+	MPIDR                         uint64
+	ProcessorPowerEfficiencyClass uint8
+	_                             uint8
+	SPEOverflowInterrupt          uint16
+}
+
+// MADTGICD is an arm64 GIC distributor, type 12.
+type MADTGICD struct {
+	_                   uint16
+	GICID               uint32
+	PhysicalBaseAddress uint64
+	SystemVectorBase    uint32
+	GICVersion          uint8
+	_                   [3]uint8
+}
+
+// SubtableType implements Subtable.
+func (*MADTLocalAPIC) SubtableType() uint16 { return 0 }
+
+// SubtableType implements Subtable.
+func (*MADTIOAPIC) SubtableType() uint16 { return 1 }
+
+// SubtableType implements Subtable.
+func (*MADTInterruptOverride) SubtableType() uint16 { return 2 }
+
+// SubtableType implements Subtable.
+func (*MADTNMISource) SubtableType() uint16 { return 3 }
+
+// SubtableType implements Subtable.
+func (*MADTLocalAPICNMI) SubtableType() uint16 { return 4 }
+
+// SubtableType implements Subtable.
+func (*MADTLocalAPICAddressOverride) SubtableType() uint16 { return 5 }
+
+// SubtableType implements Subtable.
+func (*MADTLocalX2APIC) SubtableType() uint16 { return 9 }
+
+// SubtableType implements Subtable.
+func (*MADTLocalX2APICNMI) SubtableType() uint16 { return 10 }
+
+// SubtableType implements Subtable.
+func (*MADTGICC) SubtableType() uint16 { return 11 }
+
+// SubtableType implements Subtable.
+func (*MADTGICD) SubtableType() uint16 { return 12 }
+
+var madtFormat = subtableFormat{
+	fixed: func(typ uint16) Subtable {
+		switch typ {
+		case 0:
+			return &MADTLocalAPIC{}
+		case 1:
+			return &MADTIOAPIC{}
+		case 2:
+			return &MADTInterruptOverride{}
+		case 3:
+			return &MADTNMISource{}
+		case 4:
+			return &MADTLocalAPICNMI{}
+		case 5:
+			return &MADTLocalAPICAddressOverride{}
+		case 9:
+			return &MADTLocalX2APIC{}
+		case 10:
+			return &MADTLocalX2APICNMI{}
+		case 11:
+			return &MADTGICC{}
+		case 12:
+			return &MADTGICD{}
+		}
+		return nil
+	},
+}
+
+// NewMADT decodes a MADT.
+func NewMADT(t Table) (*MADT, error) {
+	h, b, err := decodeHeader(t, "APIC")
+	if err != nil {
+		return nil, err
+	}
+	m := &MADT{Header: h}
+	fixed := struct{ LocalAPICAddress, Flags uint32 }{}
+	if b, err = decodeFixed(b, &fixed); err != nil {
+		return nil, fmt.Errorf("MADT: %v", err)
+	}
+	m.LocalAPICAddress, m.Flags = fixed.LocalAPICAddress, fixed.Flags
+	if m.Entries, err = madtFormat.parse(b); err != nil {
+		return nil, fmt.Errorf("MADT: %v", err)
+	}
+	return m, nil
+}
+
+// Marshal implements Decoded.
+func (m *MADT) Marshal() (Table, error) {
+	entries, err := madtFormat.marshal(m.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("MADT: %v", err)
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, [2]uint32{m.LocalAPICAddress, m.Flags})
+	b.Write(entries)
+	return m.Header.marshal(b.Bytes()), nil
+}
+
+// CPU is a processor listed in the MADT.
+type CPU struct {
+	// ACPIProcessorUID matches the processor to its object in the DSDT.
+	ACPIProcessorUID uint32
+	// ID is the APIC or x2APIC ID on x86, and the MPIDR on arm64.
+	ID      uint64
+	Enabled bool
+}
+
+// CPUs returns the processors in the MADT, enabled or not, in order.
+func (m *MADT) CPUs() []CPU {
+	var cpus []CPU
+	for _, e := range m.Entries {
+		switch e := e.(type) {
+		case *MADTLocalAPIC:
+			cpus = append(cpus, CPU{uint32(e.ACPIProcessorUID), uint64(e.APICID), e.Flags&MADTEnabled != 0})
+		case *MADTLocalX2APIC:
+			cpus = append(cpus, CPU{e.ACPIProcessorUID, uint64(e.X2APICID), e.Flags&MADTEnabled != 0})
+		case *MADTGICC:
+			cpus = append(cpus, CPU{e.ACPIProcessorUID, e.MPIDR, e.Flags&MADTEnabled != 0})
+		}
+	}
+	return cpus
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acpi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// MCFG is the PCI Express memory-mapped configuration space table,
+// signature "MCFG". It gives the ECAM window of each PCI segment group.
+type MCFG struct {
+	Header
+	Entries []MCFGEntry
+}
+
+// MCFGEntry is the ECAM window of the busses StartBus to EndBus of a PCI
+// segment group.
+type MCFGEntry struct {
+	BaseAddress uint64
+	Segment     uint16
+	StartBus    uint8
+	EndBus      uint8
+	_           uint32
+}
+
+// mcfgReserved is the size of the reserved field before the entries.
+const mcfgReserved = 8
+
+// NewMCFG decodes an MCFG.
+func NewMCFG(t Table) (*MCFG, error) {
+	h, b, err := decodeHeader(t, "MCFG")
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < mcfgReserved || (len(b)-mcfgReserved)%binary.Size(MCFGEntry{}) != 0 {
+		return nil, fmt.Errorf("MCFG: %d bytes of entries is not a whole number of entries", len(b)-mcfgReserved)
+	}
+	m := &MCFG{
+		Header:  h,
+		Entries: make([]MCFGEntry, (len(b)-mcfgReserved)/binary.Size(MCFGEntry{})),
+	}
+	if _, err := decodeFixed(b[mcfgReserved:], m.Entries); err != nil {
+		return nil, fmt.Errorf("MCFG: %v", err)
+	}
+	return m, nil
+}
+
+// Marshal implements Decoded.
+func (m *MCFG) Marshal() (Table, error) {
+	var b bytes.Buffer
+	b.Write(make([]byte, mcfgReserved))
+	binary.Write(&b, binary.LittleEndian, m.Entries)
+	return m.Header.marshal(b.Bytes()), nil
+}
+
+// String implements fmt.Stringer.
+func (e MCFGEntry) String() string {
+	return fmt.Sprintf("segment %d busses %#02x-%#02x at %#x", e.Segment, e.StartBus, e.EndBus, e.BaseAddress)
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acpi
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SRAT is the System Resource Affinity Table, signature "SRAT". It gives the
+// NUMA proximity domain of processors and memory.
+type SRAT struct {
+	Header
+	Entries Subtables
+
+	// reserved is the data before the entries: a 32-bit 1 for backward
+	// compatibility and 8 reserved bytes.
+	reserved [12]byte
+}
+
+// Flags of the SRAT structures.
+const (
+	// SRATEnabled means the structure is to be used.
+	SRATEnabled = 1 << 0
+	// SRATHotPluggable means the memory can be hot-plugged.
+	SRATHotPluggable = 1 << 1
+	// SRATNonVolatile means the memory is non-volatile.
+	SRATNonVolatile = 1 << 2
+)
+
+// SRATProcessorAffinity is the proximity domain of a processor's local APIC,
+// type 0.
+type SRATProcessorAffinity struct {
+	ProximityDomainLow  uint8
+	APICID              uint8
+	Flags               uint32
+	LocalSAPICEID       uint8
+	ProximityDomainHigh [3]uint8
+	ClockDomain         uint32
+}
+
+// ProximityDomain returns the full proximity domain.
+func (s *SRATProcessorAffinity) ProximityDomain() uint32 {
+	h := s.ProximityDomainHigh
+	return uint32(s.ProximityDomainLow) | uint32(h[0])<<8 | uint32(h[1])<<16 | uint32(h[2])<<24
+}
+
+// SRATMemoryAffinity is the proximity domain of a memory range, type 1.
+type SRATMemoryAffinity struct {
+	ProximityDomain uint32
+	_               uint16
+	BaseAddress     uint64
+	Length          uint64
+	_               uint32
+	Flags           uint32
+	_               uint64
+}
+
+// SRATX2APICAffinity is the proximity domain of a processor's local x2APIC,
+// type 2.
+type SRATX2APICAffinity struct {
+	_               uint16
+	ProximityDomain uint32
+	X2APICID        uint32
+	Flags           uint32
+	ClockDomain     uint32
+	_               uint32
+}
+
+// SRATGICCAffinity is the proximity domain of an arm64 processor, type 3.
+type SRATGICCAffinity struct {
+	ProximityDomain  uint32
+	ACPIProcessorUID uint32
+	Flags            uint32
+	ClockDomain      uint32
+}
+
+// SubtableType implements Subtable.
+func (*SRATProcessorAffinity) SubtableType() uint16 { return 0 }
+
+// SubtableType implements Subtable.
+func (*SRATMemoryAffinity) SubtableType() uint16 { return 1 }
+
+// SubtableType implements Subtable.
+func (*SRATX2APICAffinity) SubtableType() uint16 { return 2 }
+
+// SubtableType implements Subtable.
+func (*SRATGICCAffinity) SubtableType() uint16 { return 3 }
+
+var sratFormat = subtableFormat{
+	fixed: func(typ uint16) Subtable {
+		switch typ {
+		case 0:
+			return &SRATProcessorAffinity{}
+		case 1:
+			return &SRATMemoryAffinity{}
+		case 2:
+			return &SRATX2APICAffinity{}
+		case 3:
+			return &SRATGICCAffinity{}
+		}
+		return nil
+	},
+}
+
+// NewSRAT decodes a SRAT.
+func NewSRAT(t Table) (*SRAT, error) {
+	h, b, err := decodeHeader(t, "SRAT")
+	if err != nil {
+		return nil, err
+	}
+	s := &SRAT{Header: h}
+	if b, err = decodeFixed(b, &s.reserved); err != nil {
+		return nil, fmt.Errorf("SRAT: %v", err)
+	}
+	if s.Entries, err = sratFormat.parse(b); err != nil {
+		return nil, fmt.Errorf("SRAT: %v", err)
+	}
+	return s, nil
+}
+
+// Marshal implements Decoded.
+func (s *SRAT) Marshal() (Table, error) {
+	entries, err := sratFormat.marshal(s.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("SRAT: %v", err)
+	}
+	reserved := s.reserved
+	if reserved == [12]byte{} {
+		reserved[0] = 1
+	}
+	var b bytes.Buffer
+	b.Write(reserved[:])
+	b.Write(entries)
+	return s.Header.marshal(b.Bytes()), nil
+}
+
+// MemoryAffinity returns the enabled memory ranges and their proximity
+// domains.
+func (s *SRAT) MemoryAffinity() []SRATMemoryAffinity {
+	var m []SRATMemoryAffinity
+	for _, e := range s.Entries {
+		if e, ok := e.(*SRATMemoryAffinity); ok && e.Flags&SRATEnabled != 0 {
+			m = append(m, *e)
+		}
+	}
+	return m
+}
@@ -34,6 +34,7 @@ import (
 	"go/parser"
 	"go/token"
 	"go/types"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -44,6 +45,7 @@ import (
 	"time"
 
 	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/imports"
 
 	"github.com/u-root/u-root/pkg/golang"
@@ -80,82 +82,249 @@ func getBBLock(bblock string) (*lockfile.Lockfile, error) {
 	}
 }
 
+const (
+	// bbImportPath is the package commands register themselves with.
+	bbImportPath = "github.com/u-root/u-root/pkg/bb/bbmain"
+
+	// bbTemplate is the main package of the busybox.
+	bbTemplate = "github.com/u-root/u-root/pkg/bb/bbmain/cmd"
+)
+
 // BuildBusybox builds a busybox of the given Go packages.
 //
-// pkgs is a list of Go import paths. If nil is returned, binaryPath will hold
-// the busybox-style binary.
-func BuildBusybox(env golang.Environ, pkgs []string, noStrip bool, binaryPath string) error {
-	urootPkg, err := env.Package("github.com/u-root/u-root")
-	if err != nil {
-		return err
-	}
-
-	bblock := filepath.Join(urootPkg.Dir, "bblock")
+// pkgs is a list of Go import paths, resolved from the current directory, or
+// module@version/path specifiers of packages in other modules. If nil is
+// returned, binaryPath will hold the busybox-style binary.
+//
+// Rewritten packages are written to a .bb directory next to the package's
+// source. If all packages are in GOPATH or the main module, the busybox is
+// built in place, in the .bb directory of the bb template. Otherwise, it is
+// built in a workspace module (see golang.Workspace) that requires the
+// modules of all packages, and packages in the module cache are built from
+// a copy of their module in the workspace.
+//
+// If cacheDir is not empty, rewritten packages are kept there and only
+// packages whose source or dependencies changed are rewritten again, and
+// compiled packages are reused from Go's build cache. The returned stats
+// count the commands found in the cache.
+func BuildBusybox(env golang.Environ, pkgs []string, opts golang.BuildOpts, cacheDir, binaryPath string) (CacheStats, error) {
 	// Only one busybox can be compiled at a time.
 	//
-	// Since busybox files all get rewritten in
-	// GOPATH/src/github.com/u-root/u-root/bb/..., no more than one source
-	// transformation can be in progress at the same time. Otherwise,
-	// different bb processes will write a different set of files to the
-	// "bb" directory at the same time, potentially producing an unintended
-	// bb binary.
-	//
-	// Doing each rewrite in a temporary unique directory is not an option
-	// as that kills reproducible builds.
-	l, err := getBBLock(bblock)
+	// Since busybox files all get rewritten into the .bb directory of each
+	// command, no more than one source transformation can be in progress
+	// at the same time. Otherwise, different bb processes will write a
+	// different set of files to the same directories at the same time,
+	// potentially producing an unintended bb binary.
+	l, err := getBBLock(filepath.Join(os.TempDir(), "u-root-bblock"))
 	if err != nil {
-		return err
+		return CacheStats{}, err
 	}
 	defer l.Unlock()
 
-	bbDir := filepath.Join(urootPkg.Dir, "bb")
-	// Blow bb away before trying to re-create it.
-	if err := os.RemoveAll(bbDir); err != nil {
-		return err
-	}
-	if err := os.MkdirAll(bbDir, 0755); err != nil {
-		return err
-	}
-
-	var bbPackages []string
-	// Move and rewrite package files.
-	importer := importer.For("source", nil)
+	var cmds []string
 	seenPackages := map[string]bool{}
 	for _, pkg := range pkgs {
-		basePkg := path.Base(pkg)
+		basePkg := golang.CommandName(pkg)
 		if _, ok := skip[basePkg]; ok {
 			continue
 		}
-		if _, ok := seenPackages[path.Base(pkg)]; ok {
-			return fmt.Errorf("failed to build with bb: found duplicate pkgs %s", basePkg)
+		if _, ok := seenPackages[basePkg]; ok {
+			return CacheStats{}, fmt.Errorf("failed to build with bb: found duplicate pkgs %s", basePkg)
 		}
 		seenPackages[basePkg] = true
+		cmds = append(cmds, pkg)
+	}
 
-		// TODO: use bbDir to derive import path below or vice versa.
-		if err := RewritePackage(env, pkg, "github.com/u-root/u-root/pkg/bb/bbmain", importer); err != nil {
-			return err
+	// Packages in GOPATH or the main module are rewritten and built in
+	// place, so that the go command resolves their dependencies as it
+	// always does, vendor directory included. Anything else is built in a
+	// workspace.
+	specs := append([]string{bbTemplate}, cmds...)
+	inTree, err := env.InTree(specs)
+	if err != nil {
+		return CacheStats{}, err
+	}
+	importPaths := specs
+	lookup := func(mode packages.LoadMode, patterns ...string) ([]*packages.Package, error) {
+		return env.Lookup(mode, "", patterns...)
+	}
+	var ws *golang.Workspace
+	if !inTree {
+		dir, err := ioutil.TempDir("", "bb-workspace")
+		if err != nil {
+			return CacheStats{}, err
+		}
+		defer os.RemoveAll(dir)
+		ws, importPaths, err = env.NewWorkspace(dir, specs)
+		if err != nil {
+			return CacheStats{}, err
+		}
+		lookup = ws.Lookup
+	}
+	loaded, err := lookup(packages.NeedName|packages.NeedFiles|packages.NeedModule|packages.NeedImports|packages.NeedDeps, importPaths...)
+	if err != nil {
+		return CacheStats{}, err
+	}
+	byPath := make(map[string]*packages.Package)
+	for _, p := range loaded {
+		byPath[p.PkgPath] = p
+	}
+	template, importPaths := byPath[importPaths[0]], importPaths[1:]
+	if template == nil {
+		return CacheStats{}, fmt.Errorf("bb cmd template missing")
+	}
+	var cmdPkgs []*packages.Package
+	for _, importPath := range importPaths {
+		p, ok := byPath[importPath]
+		if !ok {
+			return CacheStats{}, fmt.Errorf("failed to build with bb: %s was not loaded", importPath)
+		}
+		cmdPkgs = append(cmdPkgs, p)
+	}
+
+	// Module cache directories are read-only, so modules from there are
+	// copied into the workspace to rewrite their packages.
+	copies := make(map[string]string)
+	if ws != nil {
+		for _, p := range cmdPkgs {
+			m := p.Module
+			if m == nil || (m.Replace != nil && m.Replace.Version == "") {
+				continue
+			}
+			if _, ok := copies[m.Path]; ok {
+				continue
+			}
+			dst := filepath.Join(ws.Dir, "mod", m.Path+"@"+m.Version)
+			if err := copyTree(m.Dir, dst); err != nil {
+				return CacheStats{}, err
+			}
+			if err := ws.Override(m.Path, dst); err != nil {
+				return CacheStats{}, err
+			}
+			copies[m.Path] = dst
+		}
+		if err := ws.WriteModFile(); err != nil {
+			return CacheStats{}, err
+		}
+	}
+
+	var c *cache
+	if cacheDir != "" {
+		c, err = newCache(env, cacheDir)
+		if err != nil {
+			return CacheStats{}, err
+		}
+		opts.Incremental = true
+	}
+
+	// Copy cached packages, and collect the others to rewrite.
+	var bbPackages []string
+	var rewrite []*packages.Package
+	dests := make(map[*packages.Package]string)
+	keys := make(map[*packages.Package]string)
+	for _, p := range cmdPkgs {
+		dest := filepath.Join(filepath.Dir(p.GoFiles[0]), ".bb")
+		if p.Module != nil {
+			if d, ok := copies[p.Module.Path]; ok {
+				dest = filepath.Join(d, strings.TrimPrefix(p.PkgPath, p.Module.Path), ".bb")
+			}
 		}
+		dests[p] = dest
+		bbPackages = append(bbPackages, path.Join(p.PkgPath, ".bb"))
 
-		bbPackages = append(bbPackages, path.Join(pkg, ".bb"))
+		if c != nil {
+			key, err := c.key(p, bbImportPath)
+			if err != nil {
+				return CacheStats{}, err
+			}
+			if ok, err := c.get(key, dest); err != nil {
+				return CacheStats{}, err
+			} else if ok {
+				continue
+			}
+			keys[p] = key
+		}
+		rewrite = append(rewrite, p)
+	}
+
+	// Rewriting needs type information, for which the go command compiles
+	// the dependencies of the packages being rewritten.
+	if len(rewrite) > 0 {
+		var paths []string
+		for _, p := range rewrite {
+			paths = append(paths, p.PkgPath)
+		}
+		typed, err := lookup(packages.NeedName|packages.NeedImports|packages.NeedDeps|packages.NeedExportsFile, paths...)
+		if err != nil {
+			return CacheStats{}, err
+		}
+		importer := exportImporter(typed)
+		for _, p := range rewrite {
+			if err := rewritePackage(p, dests[p], bbImportPath, importer); err != nil {
+				return CacheStats{}, err
+			}
+			if c != nil {
+				if err := c.put(keys[p], dests[p]); err != nil {
+					return CacheStats{}, err
+				}
+			}
+		}
 	}
 
-	bb, err := NewPackageFromEnv(env, "github.com/u-root/u-root/pkg/bb/bbmain/cmd", importer)
+	fset, astp, err := ParseAST(template.GoFiles)
 	if err != nil {
-		return err
+		return CacheStats{}, fmt.Errorf("bb cmd template: %v", err)
 	}
-	if bb == nil {
-		return fmt.Errorf("bb cmd template missing")
+	if len(astp.Files) != 1 {
+		return CacheStats{}, fmt.Errorf("bb cmd template is supposed to only have one file")
 	}
-	if len(bb.ast.Files) != 1 {
-		return fmt.Errorf("bb cmd template is supposed to only have one file")
+	// Create bb main.go, in place next to the template or as the
+	// workspace's main package.
+	mainDir := filepath.Join(filepath.Dir(template.GoFiles[0]), ".bb")
+	if ws != nil {
+		mainDir = ws.Dir
 	}
-	// Create bb main.go.
-	if err := CreateBBMainSource(bb.fset, bb.ast, bbPackages, bbDir); err != nil {
-		return err
+	if err := os.MkdirAll(mainDir, 0755); err != nil {
+		return CacheStats{}, err
+	}
+	if err := CreateBBMainSource(fset, astp, bbPackages, mainDir); err != nil {
+		return CacheStats{}, err
 	}
 
 	// Compile bb.
-	return env.Build("github.com/u-root/u-root/bb", binaryPath, golang.BuildOpts{NoStrip: noStrip})
+	var stats CacheStats
+	if c != nil {
+		stats = c.CacheStats
+	}
+	if ws == nil {
+		return stats, env.BuildDir(mainDir, binaryPath, opts)
+	}
+	return stats, ws.Build(golang.WorkspaceModule, binaryPath, opts)
+}
+
+// copyTree copies the directory tree src to dst.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, 0755)
+		case fi.Mode().IsRegular():
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(target, b, 0644)
+		}
+		return nil
+	})
 }
 
 // CreateBBMainSource creates a bb Go command that imports all given pkgs.
@@ -231,11 +400,12 @@ type Package struct {
 // NewPackageFromEnv finds the package identified by importPath, and gathers
 // AST, type, and token information.
 func NewPackageFromEnv(env golang.Environ, importPath string, importer types.Importer) (*Package, error) {
-	p, err := env.Package(importPath)
+	pkgs, err := env.Lookup(packages.NeedName|packages.NeedFiles, "", importPath)
 	if err != nil {
 		return nil, err
 	}
-	return NewPackage(filepath.Base(p.Dir), p.ImportPath, SrcFiles(p), importer)
+	p := pkgs[0]
+	return NewPackage(path.Base(p.PkgPath), p.PkgPath, p.GoFiles, importer)
 }
 
 // ParseAST parses the given files for a package named main.
@@ -276,16 +446,65 @@ func SrcFiles(p *build.Package) []string {
 // the file system destination of the written files and bbImportPath is the Go
 // import path of the bb package to register with.
 func RewritePackage(env golang.Environ, pkgPath, bbImportPath string, importer types.Importer) error {
-	buildp, err := env.Package(pkgPath)
+	p, err := NewPackageFromEnv(env, pkgPath, importer)
 	if err != nil {
 		return err
 	}
+	pkgs, err := env.Lookup(packages.NeedFiles, "", pkgPath)
+	if err != nil {
+		return err
+	}
+	return writePackage(p, filepath.Join(filepath.Dir(pkgs[0].GoFiles[0]), ".bb"), bbImportPath)
+}
 
-	p, err := NewPackage(filepath.Base(buildp.Dir), buildp.ImportPath, SrcFiles(buildp), importer)
+// exportImporter returns an importer of the export data the go command
+// compiled for pkgs and their dependencies, which must have been loaded with
+// packages.NeedExportsFile.
+func exportImporter(pkgs []*packages.Package) types.Importer {
+	exports := make(map[string]string)
+	// Imports of vendored packages name a different package path than
+	// the one in export data.
+	paths := make(map[string]string)
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		exports[p.PkgPath] = p.ExportFile
+		for path, ip := range p.Imports {
+			paths[path] = ip.PkgPath
+		}
+	})
+	imp := importer.ForCompiler(token.NewFileSet(), "gc", func(path string) (io.ReadCloser, error) {
+		f := exports[path]
+		if f == "" {
+			return nil, fmt.Errorf("no export data for package %q", path)
+		}
+		return os.Open(f)
+	})
+	return importerFunc(func(path string) (*types.Package, error) {
+		if p, ok := paths[path]; ok {
+			path = p
+		}
+		return imp.Import(path)
+	})
+}
+
+// importerFunc implements types.Importer with a function.
+type importerFunc func(path string) (*types.Package, error)
+
+// Import implements types.Importer.Import.
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// rewritePackage rewrites p into dest, resolving its imports with importer.
+func rewritePackage(p *packages.Package, dest, bbImportPath string, importer types.Importer) error {
+	bbp, err := NewPackage(path.Base(p.PkgPath), p.PkgPath, p.GoFiles, importer)
 	if err != nil {
 		return err
 	}
-	dest := filepath.Join(buildp.Dir, ".bb")
+	return writePackage(bbp, dest, bbImportPath)
+}
+
+// writePackage writes the rewritten p to dest.
+func writePackage(p *Package, dest, bbImportPath string) error {
 	// If .bb directory already exists, delete it. This will prevent stale
 	// files from being included in the build.
 	if err := os.RemoveAll(dest); err != nil {
@@ -5,12 +5,16 @@
 package bb
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"golang.org/x/tools/go/packages"
+
 	"github.com/u-root/u-root/pkg/golang"
 )
 
@@ -22,7 +26,7 @@ func TestPackageRewriteFile(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	bin := filepath.Join(dir, "foo")
-	if err := BuildBusybox(golang.Default(), []string{"github.com/u-root/u-root/pkg/uroot/test/foo"}, false, bin); err != nil {
+	if _, err := BuildBusybox(golang.Default(), []string{"github.com/u-root/u-root/pkg/uroot/test/foo"}, golang.BuildOpts{}, "", bin); err != nil {
 		t.Fatal(err)
 	}
 
@@ -32,3 +36,188 @@ func TestPackageRewriteFile(t *testing.T) {
 		t.Fatalf("foo failed: %v %v", string(o), err)
 	}
 }
+
+func TestBuildBusyboxCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "u-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := golang.Default()
+	pkgs := []string{"github.com/u-root/u-root/pkg/uroot/test/foo"}
+	cacheDir := filepath.Join(dir, "cache")
+	for i, want := range []CacheStats{{Misses: 1}, {Hits: 1}} {
+		bin := filepath.Join(dir, "foo")
+		stats, err := BuildBusybox(env, pkgs, golang.BuildOpts{}, cacheDir, bin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats != want {
+			t.Errorf("build %d: got cache stats %+v, want %+v", i, stats, want)
+		}
+		if o, err := exec.Command(bin).CombinedOutput(); err != nil {
+			t.Fatalf("foo failed: %v %v", string(o), err)
+		}
+	}
+
+	// Both builds above used the same entry.
+	entries, err := ioutil.ReadDir(filepath.Join(cacheDir, "bb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("cache has %d entries, want 1", len(entries))
+	}
+}
+
+// rewriteCached rewrites the command in dir into dir/.bb, unless c has it.
+func rewriteCached(t *testing.T, env golang.Environ, c *cache, dir string) {
+	t.Helper()
+	loaded, err := env.Lookup(packages.NeedName|packages.NeedFiles|packages.NeedModule|packages.NeedImports|packages.NeedDeps|packages.NeedExportsFile, dir, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, dest := loaded[0], filepath.Join(dir, ".bb")
+	key, err := c.key(p, bbImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.get(key, dest); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		return
+	}
+	if err := rewritePackage(p, dest, bbImportPath, exportImporter(loaded)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.put(key, dest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheSourceChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "u-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mod := filepath.Join(dir, "foo")
+	if err := os.MkdirAll(mod, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mod, "go.mod"), []byte("module example.com/foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeMain := func(msg string) {
+		src := fmt.Sprintf("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(%q)\n}\n", msg)
+		if err := ioutil.WriteFile(filepath.Join(mod, "main.go"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := golang.Default()
+	rewrite := func(c *cache) {
+		rewriteCached(t, env, c, mod)
+	}
+
+	c, err := newCache(env, filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeMain("hello")
+	rewrite(c)
+	rewrite(c)
+	writeMain("goodbye")
+	rewrite(c)
+	if want := (CacheStats{Hits: 1, Misses: 2}); c.CacheStats != want {
+		t.Errorf("got cache stats %+v, want %+v", c.CacheStats, want)
+	}
+
+	// The rewritten package is from the changed source.
+	b, err := ioutil.ReadFile(filepath.Join(mod, ".bb", "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "goodbye") {
+		t.Errorf("rewritten package is stale:\n%s", b)
+	}
+}
+
+// TestCacheDependencyChange checks that changing a dependency in GOPATH,
+// where no package has a module, invalidates the commands using it.
+func TestCacheDependencyChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "u-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer os.Setenv("GO111MODULE", os.Getenv("GO111MODULE"))
+	if err := os.Setenv("GO111MODULE", "off"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := filepath.Join(dir, "src", "example.com", "foo")
+	dep := filepath.Join(dir, "src", "example.com", "bar")
+	for _, d := range []string{cmd, dep} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := "package main\n\nimport \"example.com/bar\"\n\nvar b bar.T\n\nfunc main() {\n\tb.F()\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(cmd, "main.go"), []byte(main), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The rewrite declares b with bar's types, so a change to them
+	// changes the rewritten command.
+	writeDep := func(typ string) {
+		src := fmt.Sprintf("package bar\n\ntype T %s\n\nfunc (T) F() {}\n", typ)
+		if err := ioutil.WriteFile(filepath.Join(dep, "bar.go"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := golang.Default()
+	env.GOPATH = dir
+	c, err := newCache(env, filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeDep("int")
+	rewriteCached(t, env, c, cmd)
+	rewriteCached(t, env, c, cmd)
+	writeDep("string")
+	rewriteCached(t, env, c, cmd)
+	if want := (CacheStats{Hits: 1, Misses: 2}); c.CacheStats != want {
+		t.Errorf("got cache stats %+v, want %+v", c.CacheStats, want)
+	}
+}
+
+func TestBuildBusyboxCacheArches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "u-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pkgs := []string{"github.com/u-root/u-root/pkg/uroot/test/foo"}
+	cacheDir := filepath.Join(dir, "cache")
+	for _, arch := range []string{"amd64", "arm64", "riscv64", "arm"} {
+		env := golang.Default()
+		env.GOARCH = arch
+		if _, err := BuildBusybox(env, pkgs, golang.BuildOpts{}, cacheDir, filepath.Join(dir, "foo-"+arch)); err != nil {
+			t.Fatalf("building for %s: %v", arch, err)
+		}
+	}
+
+	// foo builds the same files everywhere, so the 64-bit arches share an
+	// entry, and 32-bit arm has its own.
+	entries, err := ioutil.ReadDir(filepath.Join(cacheDir, "bb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("cache has %d entries, want 2", len(entries))
+	}
+}
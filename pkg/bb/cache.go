@@ -0,0 +1,207 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bb
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/u-root/u-root/pkg/golang"
+)
+
+// cacheVersion changes whenever the rewritten packages change for the same
+// input, invalidating all cache entries.
+const cacheVersion = "bb-rewrite-3"
+
+// cache stores rewritten packages in a directory, keyed by the hash of
+// everything the rewrite depends on: the package's source, the source of
+// its non-standard-library dependencies, and the Go version and build
+// environment.
+type cache struct {
+	env golang.Environ
+	dir string
+
+	// goVersion stands in for the standard library's source.
+	goVersion string
+
+	// CacheStats counts cache lookups.
+	CacheStats
+}
+
+func newCache(env golang.Environ, dir string) (*cache, error) {
+	v, err := env.Version()
+	if err != nil {
+		return nil, fmt.Errorf("could not get Go version for bb cache: %v", err)
+	}
+	dir = filepath.Join(dir, "bb")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &cache{env: env, dir: dir, goVersion: v}, nil
+}
+
+// inGOROOT returns whether p is in the standard library, i.e. its source is
+// in GOROOT.
+//
+// Module can not tell: packages outside of any module have none, whether
+// they are in the standard library or in GOPATH.
+func (c *cache) inGOROOT(p *packages.Package) bool {
+	files := p.GoFiles
+	if len(files) == 0 {
+		files = p.OtherFiles
+	}
+	if len(files) == 0 {
+		return false
+	}
+	src := filepath.Join(c.env.GOROOT, "src") + string(filepath.Separator)
+	return strings.HasPrefix(files[0], src)
+}
+
+// hashFiles adds the names and contents of p's source files to h, and the
+// names of the source files of the standard library packages p imports.
+//
+// The standard library's source is fixed by the Go version, but which of its
+// files are built depends on GOARCH, and so can the types p gets from it.
+func (c *cache) hashFiles(h io.Writer, p *packages.Package) error {
+	fmt.Fprintf(h, "package %s\n", p.PkgPath)
+	imports := make([]string, 0, len(p.Imports))
+	for path, ip := range p.Imports {
+		if c.inGOROOT(ip) {
+			imports = append(imports, path)
+		}
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(h, "import %s\n", path)
+		for _, f := range p.Imports[path].GoFiles {
+			fmt.Fprintf(h, "file %s\n", filepath.Base(f))
+		}
+	}
+	for _, f := range p.GoFiles {
+		fmt.Fprintf(h, "file %s\n", filepath.Base(f))
+		r, err := os.Open(f)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envKey describes the build environment in cache keys.
+//
+// GOARCH only changes a rewrite through the files selected for a package
+// and its dependencies, which key hashes, and through the sizes of types.
+// So instead of GOARCH, envKey has the word size and alignment, and arches
+// that build the same files share entries: most commands are rewritten once
+// for all arches of a multi-arch build.
+func (c *cache) envKey() string {
+	env := c.env
+	arch := env.GOARCH
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	sizes := types.SizesFor("gc", arch)
+	if sizes == nil {
+		return env.String()
+	}
+	env.GOARCH = ""
+	return fmt.Sprintf("%s sizes %d/%d", env, sizes.Sizeof(types.Typ[types.Uintptr]), sizes.Alignof(types.Typ[types.Int64]))
+}
+
+// key returns the cache key of the rewrite of p, which must have been
+// loaded with its files and dependencies. Computing it does not need type
+// information, so a hit costs no compilation.
+func (c *cache) key(p *packages.Package, bbImportPath string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\ntags %v\nbb %s\n", cacheVersion, c.goVersion, c.envKey(), c.env.BuildTags, bbImportPath)
+	if err := c.hashFiles(h, p); err != nil {
+		return "", err
+	}
+
+	deps := make(map[string]*packages.Package)
+	packages.Visit([]*packages.Package{p}, nil, func(dp *packages.Package) {
+		if dp != p && !c.inGOROOT(dp) {
+			deps[dp.PkgPath] = dp
+		}
+	})
+	paths := make([]string, 0, len(deps))
+	for path := range deps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := c.hashFiles(h, deps[path]); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// CacheStats counts the commands of a busybox build that were found in the
+// bb cache and those that had to be rewritten.
+type CacheStats struct {
+	Hits, Misses int
+}
+
+// String implements fmt.Stringer.
+func (s CacheStats) String() string {
+	n := s.Hits + s.Misses
+	if n == 0 {
+		return "no commands"
+	}
+	return fmt.Sprintf("%d of %d commands cached (%d%%)", s.Hits, n, 100*s.Hits/n)
+}
+
+// get copies the rewritten package cached under key to dest, and reports
+// whether the cache had it.
+func (c *cache) get(key, dest string) (bool, error) {
+	entry := filepath.Join(c.dir, key)
+	if _, err := os.Stat(entry); err != nil {
+		c.Misses++
+		return false, nil
+	}
+	c.Hits++
+	if err := os.RemoveAll(dest); err != nil {
+		return false, fmt.Errorf("error removing stale directory %q: %v", dest, err)
+	}
+	return true, copyTree(entry, dest)
+}
+
+// put adds the rewritten package in dest to the cache under key.
+func (c *cache) put(key, dest string) error {
+	// Fill in the entry under a temporary name and rename it, so other
+	// builds sharing the cache never see a partial entry.
+	tmp, err := ioutil.TempDir(c.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := copyTree(dest, tmp); err != nil {
+		return err
+	}
+	entry := filepath.Join(c.dir, key)
+	if err := os.Rename(tmp, entry); err != nil {
+		// Someone else may have added the same entry in the meantime.
+		if _, serr := os.Stat(entry); serr != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -169,10 +169,11 @@ func parseLinuxImage(vals map[string]string, fsRoot string) (boot.OSImage, error
 			linux.Initrd = f
 
 		case "devicetree":
-			// Explicitly return an error rather than ignore this,
-			// because the intended kernel likely won't boot
-			// correctly if we silently ignore this attribute.
-			return nil, fmt.Errorf("devicetree attribute unsupported for Linux entries")
+			f, err := os.Open(filePath(fsRoot, val))
+			if err != nil {
+				return nil, err
+			}
+			linux.DTB = f
 
 		// options may appear more than once.
 		case "options":
@@ -0,0 +1,335 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fit parses U-Boot Flattened Image Tree (FIT) images.
+//
+// A FIT image is a device tree with images -- kernels, ramdisks, device
+// trees -- under /images, and configurations combining them under
+// /configurations. The format is described in
+// https://gitlab.denx.de/u-boot/u-boot/-/blob/master/doc/uImage.FIT/source_file_format.txt.
+package fit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io/ioutil"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+// ErrNotFIT is returned for files that are not FIT images.
+var ErrNotFIT = errors.New("not a FIT image")
+
+// Image is one of the images in a FIT, with its data checked against all
+// its hashes.
+type Image struct {
+	Name        string
+	Description string
+
+	// Type is e.g. "kernel", "ramdisk" or "flat_dt".
+	Type        string
+	Arch        string
+	OS          string
+	Compression string
+
+	// Data is the image as stored, i.e. compressed.
+	Data []byte
+}
+
+// Uncompressed returns the uncompressed image data.
+func (i *Image) Uncompressed() ([]byte, error) {
+	switch i.Compression {
+	case "", "none":
+		return i.Data, nil
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(i.Data))
+		if err != nil {
+			return nil, fmt.Errorf("image %q: %v", i.Name, err)
+		}
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("image %q: compression %q not supported", i.Name, i.Compression)
+}
+
+// Config is a configuration: the names of the images to boot together.
+type Config struct {
+	Name        string
+	Description string
+	Kernel      string
+	Ramdisk     string
+
+	// FDT is the base device tree followed by any overlays.
+	FDT []string
+}
+
+// FIT is a parsed FIT image.
+type FIT struct {
+	Description   string
+	DefaultConfig string
+	Images        map[string]*Image
+	Configs       map[string]*Config
+}
+
+// IsFIT returns whether b starts like a FIT image, i.e. a device tree.
+func IsFIT(b []byte) bool {
+	return len(b) >= 4 && binary.BigEndian.Uint32(b) == dt.Magic
+}
+
+// Parse parses a FIT image and verifies the hashes of all its images.
+func Parse(b []byte) (*FIT, error) {
+	if !IsFIT(b) {
+		return nil, ErrNotFIT
+	}
+	fdt, err := dt.ReadFDT(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotFIT, err)
+	}
+	root := fdt.RootNode
+	images, ok := root.Child("images")
+	if !ok {
+		return nil, fmt.Errorf("%w: no /images node", ErrNotFIT)
+	}
+
+	f := &FIT{
+		Description: stringProperty(root, "description"),
+		Images:      make(map[string]*Image),
+		Configs:     make(map[string]*Config),
+	}
+
+	// Images built with mkimage -E keep their data after the device tree.
+	var external []byte
+	if end := int(fdt.Header.TotalSize+3) &^ 3; end <= len(b) {
+		external = b[end:]
+	}
+	for _, n := range images.Children {
+		i, err := parseImage(n, b, external)
+		if err != nil {
+			return nil, err
+		}
+		f.Images[i.Name] = i
+	}
+
+	if configs, ok := root.Child("configurations"); ok {
+		f.DefaultConfig = stringProperty(configs, "default")
+		for _, n := range configs.Children {
+			c := &Config{
+				Name:        n.Name,
+				Description: stringProperty(n, "description"),
+				Kernel:      stringProperty(n, "kernel"),
+				Ramdisk:     stringProperty(n, "ramdisk"),
+			}
+			if p, ok := n.LookProperty("fdt"); ok {
+				if c.FDT, err = p.AsStringList(); err != nil {
+					return nil, fmt.Errorf("configuration %q: %v", n.Name, err)
+				}
+			}
+			f.Configs[c.Name] = c
+		}
+	}
+	return f, nil
+}
+
+func stringProperty(n *dt.Node, name string) string {
+	p, ok := n.LookProperty(name)
+	if !ok {
+		return ""
+	}
+	s, err := p.AsString()
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+func u32Property(n *dt.Node, name string) (uint32, bool, error) {
+	p, ok := n.LookProperty(name)
+	if !ok {
+		return 0, false, nil
+	}
+	v, err := p.AsU32()
+	return v, true, err
+}
+
+// parseImage reads an image node and checks its hashes.
+func parseImage(n *dt.Node, fit, external []byte) (*Image, error) {
+	i := &Image{
+		Name:        n.Name,
+		Description: stringProperty(n, "description"),
+		Type:        stringProperty(n, "type"),
+		Arch:        stringProperty(n, "arch"),
+		OS:          stringProperty(n, "os"),
+		Compression: stringProperty(n, "compression"),
+	}
+
+	if p, ok := n.LookProperty("data"); ok {
+		i.Data = p.Value
+	} else {
+		size, ok, err := u32Property(n, "data-size")
+		if err != nil || !ok {
+			return nil, fmt.Errorf("image %q has no data", n.Name)
+		}
+		// data-offset is relative to the end of the device tree,
+		// data-position to the start of the file.
+		data := external
+		off, ok, err := u32Property(n, "data-offset")
+		if !ok && err == nil {
+			data = fit
+			off, ok, err = u32Property(n, "data-position")
+		}
+		if err != nil || !ok {
+			return nil, fmt.Errorf("image %q has no data", n.Name)
+		}
+		if uint64(off)+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("image %q: data at %#x, size %#x is beyond the end of the file", n.Name, off, size)
+		}
+		i.Data = data[off : off+size]
+	}
+
+	for _, h := range n.Children {
+		if !strings.HasPrefix(h.Name, "hash") {
+			continue
+		}
+		if err := checkHash(h, i.Data); err != nil {
+			return nil, fmt.Errorf("image %q: %v", n.Name, err)
+		}
+	}
+	return i, nil
+}
+
+var hashes = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// checkHash checks data against a hash node.
+func checkHash(n *dt.Node, data []byte) error {
+	algo := stringProperty(n, "algo")
+	newHash, ok := hashes[algo]
+	if !ok {
+		return fmt.Errorf("%s: hash algorithm %q not supported", n.Name, algo)
+	}
+	want, ok := n.LookProperty("value")
+	if !ok {
+		return fmt.Errorf("%s: no hash value", n.Name)
+	}
+	h := newHash()
+	h.Write(data)
+	if got := h.Sum(nil); !bytes.Equal(got, want.Value) {
+		return fmt.Errorf("%s: %s hash is %x, want %x", n.Name, algo, got, want.Value)
+	}
+	return nil
+}
+
+// Config returns the configuration with the given name, or the default one
+// if name is empty.
+func (f *FIT) Config(name string) (*Config, error) {
+	if name == "" {
+		name = f.DefaultConfig
+	}
+	if name == "" {
+		return nil, fmt.Errorf("FIT image has no default configuration")
+	}
+	c, ok := f.Configs[name]
+	if !ok {
+		return nil, fmt.Errorf("FIT image has no configuration %q", name)
+	}
+	return c, nil
+}
+
+// Image returns the named image, checking that it has the given type.
+func (f *FIT) Image(name, typ string) (*Image, error) {
+	i, ok := f.Images[name]
+	if !ok {
+		return nil, fmt.Errorf("FIT image has no image %q", name)
+	}
+	if i.Type != typ {
+		return nil, fmt.Errorf("image %q is a %s, not a %s", name, i.Type, typ)
+	}
+	return i, nil
+}
+
+// Load returns the uncompressed kernel, ramdisk and device tree of the named
+// configuration, or of the default one if name is empty. ramdisk and fdt are
+// nil if the configuration has none.
+//
+// Device tree overlays in the configuration are applied to the base device
+// tree.
+func (f *FIT) Load(name string) (kernel, ramdisk, fdt []byte, err error) {
+	c, err := f.Config(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	k, err := f.Image(c.Kernel, "kernel")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if kernel, err = k.Uncompressed(); err != nil {
+		return nil, nil, nil, err
+	}
+	if c.Ramdisk != "" {
+		r, err := f.Image(c.Ramdisk, "ramdisk")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		// The kernel decompresses initramfs itself.
+		ramdisk = r.Data
+	}
+	if len(c.FDT) > 0 {
+		if fdt, err = f.deviceTree(c.FDT); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return kernel, ramdisk, fdt, nil
+}
+
+// deviceTree returns the first of the named device trees with the others
+// applied to it as overlays.
+func (f *FIT) deviceTree(names []string) ([]byte, error) {
+	images := make([][]byte, len(names))
+	for i, name := range names {
+		d, err := f.Image(name, "flat_dt")
+		if err != nil {
+			return nil, err
+		}
+		if images[i], err = d.Uncompressed(); err != nil {
+			return nil, err
+		}
+	}
+	if len(images) == 1 {
+		return images[0], nil
+	}
+
+	base, err := dt.ReadFDT(bytes.NewReader(images[0]))
+	if err != nil {
+		return nil, fmt.Errorf("device tree %q: %v", names[0], err)
+	}
+	for i, b := range images[1:] {
+		overlay, err := dt.ReadFDT(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("device tree overlay %q: %v", names[i+1], err)
+		}
+		if err := base.ApplyOverlay(overlay); err != nil {
+			return nil, fmt.Errorf("device tree overlay %q: %v", names[i+1], err)
+		}
+	}
+	var b bytes.Buffer
+	if _, err := base.Write(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,329 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+func str(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func sha256Node(data []byte) *dt.Node {
+	h := sha256.Sum256(data)
+	return &dt.Node{
+		Name: "hash-1",
+		Properties: []dt.Property{
+			{Name: "algo", Value: str("sha256")},
+			{Name: "value", Value: h[:]},
+		},
+	}
+}
+
+func crc32Node(data []byte) *dt.Node {
+	return &dt.Node{
+		Name: "hash-2",
+		Properties: []dt.Property{
+			{Name: "algo", Value: str("crc32")},
+			{Name: "value", Value: u32(crc32.ChecksumIEEE(data))},
+		},
+	}
+}
+
+func imageNode(name, typ, compression string, data []byte, children ...*dt.Node) *dt.Node {
+	return &dt.Node{
+		Name: name,
+		Properties: []dt.Property{
+			{Name: "description", Value: str(name)},
+			{Name: "data", Value: data},
+			{Name: "type", Value: str(typ)},
+			{Name: "arch", Value: str("arm64")},
+			{Name: "compression", Value: str(compression)},
+		},
+		Children: children,
+	}
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func marshal(t *testing.T, root *dt.Node) []byte {
+	var b bytes.Buffer
+	fdt := &dt.FDT{
+		Header: dt.Header{
+			Magic:           dt.Magic,
+			Version:         17,
+			LastCompVersion: 16,
+		},
+		RootNode: root,
+	}
+	if _, err := fdt.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+var (
+	kernel  = []byte("arm64 Image")
+	ramdisk = []byte("070701 initramfs")
+	dtb     = []byte("device tree")
+)
+
+// testFIT returns a FIT with a gzipped kernel, a ramdisk and a device tree
+// in the default configuration, and a configuration with just the kernel.
+func testFIT(t *testing.T) *dt.Node {
+	gz := gzipped(t, kernel)
+	return &dt.Node{
+		Properties: []dt.Property{
+			{Name: "description", Value: str("test FIT")},
+			{Name: "#address-cells", Value: u32(1)},
+		},
+		Children: []*dt.Node{
+			{
+				Name: "images",
+				Children: []*dt.Node{
+					imageNode("kernel-1", "kernel", "gzip", gz, sha256Node(gz), crc32Node(gz)),
+					imageNode("ramdisk-1", "ramdisk", "none", ramdisk, crc32Node(ramdisk)),
+					imageNode("fdt-1", "flat_dt", "none", dtb, sha256Node(dtb)),
+				},
+			},
+			{
+				Name: "configurations",
+				Properties: []dt.Property{
+					{Name: "default", Value: str("conf-1")},
+				},
+				Children: []*dt.Node{
+					{
+						Name: "conf-1",
+						Properties: []dt.Property{
+							{Name: "kernel", Value: str("kernel-1")},
+							{Name: "ramdisk", Value: str("ramdisk-1")},
+							{Name: "fdt", Value: str("fdt-1")},
+						},
+					},
+					{
+						Name: "conf-2",
+						Properties: []dt.Property{
+							{Name: "kernel", Value: str("kernel-1")},
+						},
+					},
+					{
+						Name: "conf-3",
+						Properties: []dt.Property{
+							{Name: "kernel", Value: str("ramdisk-1")},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	f, err := Parse(marshal(t, testFIT(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Description != "test FIT" || f.DefaultConfig != "conf-1" || len(f.Images) != 3 || len(f.Configs) != 3 {
+		t.Errorf("Parse() = %+v", f)
+	}
+
+	k, r, d, err := f.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k, kernel) || !bytes.Equal(r, ramdisk) || !bytes.Equal(d, dtb) {
+		t.Errorf("Load() = %q, %q, %q, want %q, %q, %q", k, r, d, kernel, ramdisk, dtb)
+	}
+
+	k, r, d, err = f.Load("conf-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k, kernel) || r != nil || d != nil {
+		t.Errorf("Load(conf-2) = %q, %q, %q, want %q, nil, nil", k, r, d, kernel)
+	}
+
+	if _, _, _, err := f.Load("conf-3"); err == nil || !strings.Contains(err.Error(), "not a kernel") {
+		t.Errorf("Load(conf-3) = %v, want wrong type error", err)
+	}
+	if _, _, _, err := f.Load("conf-4"); err == nil {
+		t.Errorf("Load(conf-4) succeeded")
+	}
+}
+
+func TestExternalData(t *testing.T) {
+	// As built by mkimage -E: data-offset is relative to the 4-byte
+	// aligned end of the device tree, data-position to the start of the
+	// file.
+	root := testFIT(t)
+	images, _ := root.Child("images")
+	k, _ := images.Child("kernel-1")
+	gz, _ := k.LookProperty("data")
+	kdata := gz.Value
+	k.RemoveProperty("data")
+	k.UpdateProperty("data-offset", u32(0))
+	k.UpdateProperty("data-size", u32(uint32(len(kdata))))
+
+	// The FIT size does not change when data-position gets its value.
+	r, _ := images.Child("ramdisk-1")
+	r.RemoveProperty("data")
+	r.UpdateProperty("data-position", u32(0))
+	r.UpdateProperty("data-size", u32(uint32(len(ramdisk))))
+
+	b := marshal(t, root)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	pos := len(b) + len(kdata)
+	r.UpdateProperty("data-position", u32(uint32(pos)))
+	b = marshal(t, root)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	b = append(b, kdata...)
+	b = append(b, ramdisk...)
+
+	f, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotK, gotR, _, err := f.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotK, kernel) || !bytes.Equal(gotR, ramdisk) {
+		t.Errorf("Load() = %q, %q, want %q, %q", gotK, gotR, kernel, ramdisk)
+	}
+
+	// Truncated.
+	if _, err := Parse(b[:len(b)-1]); err == nil {
+		t.Errorf("Parse() of truncated FIT succeeded")
+	}
+}
+
+func TestBadHash(t *testing.T) {
+	root := testFIT(t)
+	images, _ := root.Child("images")
+	fdt, _ := images.Child("fdt-1")
+	fdt.UpdateProperty("data", []byte("evil device tree"))
+
+	_, err := Parse(marshal(t, root))
+	if err == nil || !strings.Contains(err.Error(), "sha256 hash is") {
+		t.Errorf("Parse() = %v, want hash mismatch", err)
+	}
+
+	hash, _ := fdt.Child("hash-1")
+	hash.UpdateProperty("algo", str("sha3"))
+	if _, err := Parse(marshal(t, root)); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("Parse() = %v, want unsupported algorithm", err)
+	}
+}
+
+func TestNotFIT(t *testing.T) {
+	if _, err := Parse([]byte("MZ not a FIT")); !errors.Is(err, ErrNotFIT) {
+		t.Errorf("Parse() = %v, want %v", err, ErrNotFIT)
+	}
+	if _, err := Parse(marshal(t, &dt.Node{})); !errors.Is(err, ErrNotFIT) {
+		t.Errorf("Parse() = %v, want %v", err, ErrNotFIT)
+	}
+}
+
+func compileDTS(t *testing.T, src string) []byte {
+	fdt, err := dt.ParseDTS(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if _, err := fdt.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestLoadOverlays(t *testing.T) {
+	base := compileDTS(t, `/dts-v1/;
+/ {
+	uart: serial@1000 {
+		status = "disabled";
+	};
+};
+`)
+	overlay := compileDTS(t, `/dts-v1/;
+/plugin/;
+&uart {
+	status = "okay";
+};
+`)
+	root := testFIT(t)
+	images, _ := root.Child("images")
+	images.Children = append(images.Children,
+		imageNode("fdt-2", "flat_dt", "none", base),
+		imageNode("overlay-1", "flat_dt", "gzip", gzipped(t, overlay)),
+	)
+	configs, _ := root.Child("configurations")
+	configs.Children = append(configs.Children, &dt.Node{
+		Name: "conf-4",
+		Properties: []dt.Property{
+			{Name: "kernel", Value: str("kernel-1")},
+			{Name: "fdt", Value: []byte("fdt-2\x00overlay-1\x00")},
+		},
+	}, &dt.Node{
+		Name: "conf-5",
+		Properties: []dt.Property{
+			{Name: "kernel", Value: str("kernel-1")},
+			{Name: "fdt", Value: []byte("fdt-2\x00kernel-1\x00")},
+		},
+	})
+
+	f, err := Parse(marshal(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, d, err := f.Load("conf-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdt, err := dt.ReadFDT(bytes.NewReader(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, ok := fdt.NodeByPath("/serial@1000")
+	if !ok {
+		t.Fatalf("device tree has no /serial@1000")
+	}
+	if p, ok := n.LookProperty("status"); !ok || string(p.Value) != "okay\x00" {
+		t.Errorf("overlay was not applied: status = %v", p)
+	}
+
+	if _, _, _, err := f.Load("conf-5"); err == nil || !strings.Contains(err.Error(), "not a flat_dt") {
+		t.Errorf("Load(conf-5) = %v, want wrong type error", err)
+	}
+}
@@ -24,7 +24,7 @@ func DISABLEDTestGenerateConfigs(t *testing.T) {
 	for _, test := range tests {
 		configPath := strings.TrimRight(test, ".json")
 		t.Run(configPath, func(t *testing.T) {
-			imgs, err := ParseLocalConfig(context.Background(), configPath)
+			imgs, err := ParseLocalConfig(context.Background(), configPath, nil, nil)
 			if err != nil {
 				t.Fatalf("Failed to parse %s: %v", test, err)
 			}
@@ -51,7 +51,7 @@ func TestConfigs(t *testing.T) {
 				t.Errorf("Failed to read test json '%v':%v", test, err)
 			}
 
-			imgs, err := ParseLocalConfig(context.Background(), configPath)
+			imgs, err := ParseLocalConfig(context.Background(), configPath, nil, nil)
 			if err != nil {
 				t.Fatalf("Failed to parse %s: %v", test, err)
 			}
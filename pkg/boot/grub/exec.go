@@ -0,0 +1,891 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/multiboot"
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+// This file contains the GRUB script interpreter and the commands it knows.
+
+// breakError, continueError and returnError unwind the interpreter for the
+// break, continue and return commands.
+type breakError int
+
+func (breakError) Error() string { return "break outside of loop" }
+
+type continueError int
+
+func (continueError) Error() string { return "continue outside of loop" }
+
+type returnError int
+
+func (returnError) Error() string { return "return outside of function" }
+
+// ignoredCommands are GRUB commands that only affect the GRUB user interface
+// or hardware state and are treated as successful no-ops.
+var ignoredCommands = map[string]struct{}{
+	"clear":           {},
+	"export":          {},
+	"insmod":          {},
+	"rmmod":           {},
+	"save_env":        {},
+	"serial":          {},
+	"terminal":        {},
+	"terminal_input":  {},
+	"terminal_output": {},
+}
+
+// expandWord expands the variables in w. Unquoted variables are split into
+// fields at white space, as GRUB does.
+func (c *parser) expandWord(w word) []string {
+	var fields []string
+	var cur strings.Builder
+	// inField is true if cur holds the start of a field, even if it is
+	// still empty (e.g. because of "").
+	inField := false
+	flush := func() {
+		if inField {
+			fields = append(fields, cur.String())
+			cur.Reset()
+			inField = false
+		}
+	}
+	for _, p := range w {
+		if p.isVar && p.quoted && p.text == "@" {
+			// "$@" expands to one field per parameter.
+			for i, param := range c.params {
+				if i > 0 {
+					flush()
+				}
+				cur.WriteString(param)
+				inField = true
+			}
+			continue
+		}
+		if !p.isVar || p.quoted {
+			if p.isVar {
+				cur.WriteString(c.variable(p.text))
+			} else {
+				cur.WriteString(p.text)
+			}
+			inField = true
+			continue
+		}
+
+		// Unquoted variables, including $* and $@, are split.
+		val := c.variable(p.text)
+		if len(val) > 0 && isSpace(val[0]) {
+			flush()
+		}
+		for i, f := range strings.Fields(val) {
+			if i > 0 {
+				flush()
+			}
+			cur.WriteString(f)
+			inField = true
+		}
+		if len(val) > 0 && isSpace(val[len(val)-1]) {
+			flush()
+		}
+	}
+	flush()
+	return fields
+}
+
+func isSpace(c byte) bool {
+	return isBlank(c) || c == '\n'
+}
+
+// expandWords expands all words in ws.
+func (c *parser) expandWords(ws []word) []string {
+	var args []string
+	for _, w := range ws {
+		args = append(args, c.expandWord(w)...)
+	}
+	return args
+}
+
+// variable returns the value of the variable called name.
+func (c *parser) variable(name string) string {
+	switch name {
+	case "?":
+		return strconv.Itoa(c.status)
+	case "#":
+		return strconv.Itoa(len(c.params))
+	case "*", "@":
+		return strings.Join(c.params, " ")
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if n > 0 && n <= len(c.params) {
+			return c.params[n-1]
+		}
+		return ""
+	}
+	return c.vars[name]
+}
+
+func isVarName(s string) bool {
+	if len(s) == 0 || !isVarStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isVarChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// setVar sets the GRUB variable name to value.
+func (c *parser) setVar(name, value string) {
+	c.vars[name] = value
+}
+
+// execList executes a list of commands and returns whether the last one
+// succeeded.
+func (c *parser) execList(ctx context.Context, l list) (bool, error) {
+	ok := true
+	for _, n := range l {
+		var err error
+		ok, err = c.exec(ctx, n)
+		if err != nil {
+			return ok, err
+		}
+		if ok {
+			c.status = 0
+		} else {
+			c.status = 1
+		}
+	}
+	return ok, nil
+}
+
+func (c *parser) exec(ctx context.Context, n node) (bool, error) {
+	if c.steps++; c.steps > maxSteps {
+		return false, errTooManySteps
+	}
+	switch n := n.(type) {
+	case *cmdNode:
+		return c.execCommand(ctx, n)
+
+	case *blockNode:
+		return c.execList(ctx, n.body)
+
+	case *ifNode:
+		for i, cond := range n.conds {
+			ok, err := c.execList(ctx, cond)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return c.execList(ctx, n.bodies[i])
+			}
+		}
+		return c.execList(ctx, n.orElse)
+
+	case *loopNode:
+		ok := true
+		for {
+			cond, err := c.execList(ctx, n.cond)
+			if err != nil {
+				return false, err
+			}
+			if cond == n.until {
+				return ok, nil
+			}
+			ok, err = c.execList(ctx, n.body)
+			if brk, isBreak := err.(breakError); isBreak {
+				if brk > 1 {
+					return ok, brk - 1
+				}
+				return ok, nil
+			}
+			if cnt, isContinue := err.(continueError); isContinue {
+				if cnt > 1 {
+					return ok, cnt - 1
+				}
+				err = nil
+			}
+			if err != nil {
+				return ok, err
+			}
+		}
+
+	case *forNode:
+		ok := true
+		for _, item := range c.expandWords(n.items) {
+			c.setVar(n.name, item)
+			var err error
+			ok, err = c.execList(ctx, n.body)
+			if brk, isBreak := err.(breakError); isBreak {
+				if brk > 1 {
+					return ok, brk - 1
+				}
+				return ok, nil
+			}
+			if cnt, isContinue := err.(continueError); isContinue {
+				if cnt > 1 {
+					return ok, cnt - 1
+				}
+				err = nil
+			}
+			if err != nil {
+				return ok, err
+			}
+		}
+		return ok, nil
+
+	case *funcNode:
+		c.funcs[n.name] = n.body
+		return true, nil
+
+	case *menuNode:
+		return c.menuEntry(ctx, n)
+	}
+	return false, fmt.Errorf("unknown node %T", n)
+}
+
+// call calls the GRUB function body with the given positional parameters.
+func (c *parser) call(ctx context.Context, body list, params []string) (bool, error) {
+	if c.depth >= maxDepth {
+		return false, fmt.Errorf("functions nested too deeply")
+	}
+	c.depth++
+	savedParams := c.params
+	c.params = params
+	defer func() {
+		c.params = savedParams
+		c.depth--
+	}()
+
+	ok, err := c.execList(ctx, body)
+	if ret, isReturn := err.(returnError); isReturn {
+		return ret == 0, nil
+	}
+	return ok, err
+}
+
+// loopCount parses the optional argument of break and continue.
+func loopCount(args []string) int {
+	if len(args) > 1 {
+		if n, err := strconv.Atoi(args[1]); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+func (c *parser) execCommand(ctx context.Context, n *cmdNode) (bool, error) {
+	// Variable assignment, e.g. foo=bar.
+	if len(n.words) == 1 && len(n.words[0]) > 0 {
+		first := n.words[0][0]
+		if i := strings.IndexByte(first.text, '='); !first.isVar && !first.quoted && i > 0 && isVarName(first.text[:i]) {
+			rest := append(word{{text: first.text[i+1:], quoted: true}}, n.words[0][1:]...)
+			// Assignments are not split into fields.
+			for j := range rest {
+				rest[j].quoted = true
+			}
+			c.setVar(first.text[:i], strings.Join(c.expandWord(rest), ""))
+			return true, nil
+		}
+	}
+
+	args := c.expandWords(n.words)
+	if len(args) == 0 {
+		return true, nil
+	}
+	directive := strings.ToLower(args[0])
+
+	switch directive {
+	case "echo":
+		// Used by tests.
+		if c.W != nil {
+			fmt.Fprintf(c.W, "echo:%#v\n", args[1:])
+		}
+		return true, nil
+
+	case "true":
+		return true, nil
+
+	case "false":
+		return false, nil
+
+	case "set":
+		for _, arg := range args[1:] {
+			vals := strings.SplitN(arg, "=", 2)
+			if len(vals) == 2 {
+				c.setVar(vals[0], vals[1])
+			}
+		}
+		return true, nil
+
+	case "unset":
+		for _, name := range args[1:] {
+			delete(c.vars, name)
+		}
+		return true, nil
+
+	case "test", "[":
+		testArgs := args[1:]
+		if directive == "[" {
+			if len(testArgs) == 0 || testArgs[len(testArgs)-1] != "]" {
+				log.Printf("[grub] line %d: missing ]", n.line)
+				return false, nil
+			}
+			testArgs = testArgs[:len(testArgs)-1]
+		}
+		ok, err := c.test(testArgs)
+		if err != nil {
+			log.Printf("[grub] line %d: %v", n.line, err)
+			return false, nil
+		}
+		return ok, nil
+
+	case "break":
+		return false, breakError(loopCount(args))
+
+	case "continue":
+		return false, continueError(loopCount(args))
+
+	case "return":
+		ret := c.status
+		if len(args) > 1 {
+			ret, _ = strconv.Atoi(args[1])
+		}
+		return ret == 0, returnError(ret)
+
+	case "shift":
+		shift := 1
+		if len(args) > 1 {
+			shift, _ = strconv.Atoi(args[1])
+		}
+		if shift < 0 || shift > len(c.params) {
+			return false, nil
+		}
+		c.params = c.params[shift:]
+		return true, nil
+
+	case "setparams":
+		c.params = args[1:]
+		return true, nil
+
+	case "source", ".", "configfile":
+		// TODO: configfile should start a new menu instead of adding to
+		// the current one.
+		if len(args) < 2 {
+			return false, nil
+		}
+		if err := c.appendFile(ctx, args[1]); err != nil {
+			log.Printf("[grub] line %d: failed to read %s: %v", n.line, args[1], err)
+			return false, nil
+		}
+		return true, nil
+
+	case "load_env":
+		return c.loadEnv(ctx, args[1:]), nil
+
+	case "search", "search.fs_uuid", "search.fs_label", "search.file":
+		return c.search(directive, args[1:]), nil
+
+	case "linux", "linux16", "linuxefi":
+		if len(args) < 2 {
+			return false, nil
+		}
+		k, err := c.getFile(args[1])
+		if err != nil {
+			return false, err
+		}
+		// from grub manual: "Any initrd must be reloaded after using this command" so we can replace the entry
+		entry := &boot.LinuxImage{
+			Name:    c.curLabel,
+			Kernel:  k,
+			Cmdline: cmdlineQuote(args[2:]),
+		}
+		c.addLinux(entry)
+		return true, nil
+
+	case "initrd", "initrd16", "initrdefi":
+		e, ok := c.curLinux()
+		if !ok || len(args) < 2 {
+			return false, nil
+		}
+		var initrds []io.ReaderAt
+		for _, name := range args[1:] {
+			i, err := c.getFile(name)
+			if err != nil {
+				return false, err
+			}
+			initrds = append(initrds, i)
+		}
+		if len(initrds) == 1 {
+			e.Initrd = initrds[0]
+		} else {
+			e.Initrd = boot.CatInitrds(initrds...)
+		}
+		return true, nil
+
+	case "devicetree":
+		e, ok := c.curLinux()
+		if !ok || len(args) < 2 {
+			return false, nil
+		}
+		d, err := c.getFile(args[1])
+		if err != nil {
+			return false, err
+		}
+		e.DTB = d
+		return true, nil
+
+	case "multiboot", "multiboot2":
+		kv := args[1:]
+		for len(kv) > 0 && strings.HasPrefix(kv[0], "--quirk") {
+			kv = kv[1:]
+		}
+		if len(kv) < 1 {
+			return false, nil
+		}
+		k, err := c.getFile(kv[0])
+		if err != nil {
+			return false, err
+		}
+		// from grub manual: "Any initrd must be reloaded after using this command" so we can replace the entry
+		entry := &boot.MultibootImage{
+			Name:    c.curLabel,
+			Kernel:  k,
+			Cmdline: cmdlineQuote(kv[1:]),
+		}
+		c.addMultiboot(entry)
+		return true, nil
+
+	case "module", "module2":
+		e, ok := c.curMultiboot()
+		if !ok || len(args) < 2 {
+			return false, nil
+		}
+		// The only allowed arg
+		cmdline := args[1:]
+		if cmdline[0] == "--nounzip" {
+			cmdline = cmdline[1:]
+		}
+		if len(cmdline) < 1 {
+			return false, nil
+		}
+
+		m, err := c.getFile(cmdline[0])
+		if err != nil {
+			return false, err
+		}
+		// TODO: Lasy tryGzipFilter(m)
+		mod := multiboot.Module{
+			Module:  m,
+			Cmdline: cmdlineQuote(cmdline),
+		}
+		e.Modules = append(e.Modules, mod)
+		return true, nil
+	}
+
+	if body, ok := c.funcs[args[0]]; ok {
+		return c.call(ctx, body, args[1:])
+	}
+	if _, ok := ignoredCommands[directive]; ok {
+		return true, nil
+	}
+	// GRUB fails on commands it does not know. Most commands we do not
+	// know only matter for the GRUB UI, but may be used as a condition.
+	return false, nil
+}
+
+// loadEnv implements load_env [-f file] [--skip-sig] [whitelisted vars...].
+func (c *parser) loadEnv(ctx context.Context, args []string) bool {
+	file := c.vars["prefix"] + "/grubenv"
+	var whitelist []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-f" || arg == "--file":
+			if i+1 < len(args) {
+				file = args[i+1]
+			}
+			i++
+		case strings.HasPrefix(arg, "--file="):
+			file = strings.TrimPrefix(arg, "--file=")
+		case arg == "-s" || arg == "--skip-sig":
+		default:
+			whitelist = append(whitelist, arg)
+		}
+	}
+
+	u, err := c.resolve(file)
+	if err != nil {
+		return false
+	}
+	r, err := c.schemes.Fetch(ctx, u)
+	if err != nil {
+		return false
+	}
+	env, err := ParseEnvFile(io.NewSectionReader(r, 0, 1<<20))
+	if err != nil {
+		log.Printf("[grub] Failed to parse %s: %v", u, err)
+		return false
+	}
+	if len(whitelist) == 0 {
+		for k, v := range env.Vars {
+			c.setVar(k, v)
+		}
+		return true
+	}
+	for _, k := range whitelist {
+		if v, ok := env.Vars[k]; ok {
+			c.setVar(k, v)
+		}
+	}
+	return true
+}
+
+// search implements search [--file|--label|--fs-uuid] [--set[=var]] name and
+// its search.file, search.fs_label and search.fs_uuid variants.
+//
+// Devices are looked up in c.devices. The first match is mounted and its name
+// is assigned to the variable, so that paths on it can be resolved.
+func (c *parser) search(directive string, args []string) bool {
+	var kind, varName, name string
+	switch directive {
+	case "search.file", "search.fs_label", "search.fs_uuid":
+		if len(args) < 1 {
+			return false
+		}
+		kind = strings.TrimPrefix(directive, "search.")
+		name, varName = args[0], "root"
+		if len(args) > 1 {
+			varName = args[1]
+		}
+
+	default:
+		kind = "file"
+		for i := 0; i < len(args); i++ {
+			switch arg := args[i]; {
+			case arg == "-f" || arg == "--file":
+				kind = "file"
+			case arg == "-l" || arg == "--label":
+				kind = "fs_label"
+			case arg == "-u" || arg == "--fs-uuid":
+				kind = "fs_uuid"
+			case arg == "-s" || arg == "--set":
+				varName = "root"
+			case strings.HasPrefix(arg, "--set="):
+				varName = strings.TrimPrefix(arg, "--set=")
+			case arg == "-h" || arg == "--hint":
+				// Takes an argument.
+				i++
+			case strings.HasPrefix(arg, "-"):
+				// --no-floppy, --hint-*=, --efidisk-only, ...
+			case len(name) == 0:
+				name = arg
+			}
+		}
+	}
+	if len(name) == 0 {
+		return false
+	}
+
+	var found *block.BlockDev
+	var foundDir *url.URL
+	switch kind {
+	case "fs_uuid":
+		if devs := c.devices.FilterFSUUID(strings.ToLower(name)); len(devs) > 0 {
+			found = devs[0]
+		}
+	case "fs_label":
+		if devs := c.devices.FilterFSLabel(name); len(devs) > 0 {
+			found = devs[0]
+		}
+	case "file":
+		for _, dev := range c.devices {
+			mounted := c.isMounted(dev)
+			dir, err := c.mountDevice(dev)
+			if err != nil {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir.Path, name)); err == nil {
+				found, foundDir = dev, dir
+				break
+			}
+			// Don't keep devices mounted only to look for the file.
+			if !mounted {
+				c.unmountDevice(dev)
+			}
+		}
+	}
+	if found == nil {
+		if len(c.devices) > 0 {
+			log.Printf("[grub] search: no device found for %s %q", kind, name)
+		}
+		return false
+	}
+	if foundDir == nil {
+		dir, err := c.mountDevice(found)
+		if err != nil {
+			log.Printf("[grub] search: %v", err)
+			return false
+		}
+		foundDir = dir
+	}
+	c.rootDirs[found.Name] = foundDir
+	if len(varName) > 0 {
+		c.setVar(varName, found.Name)
+	}
+	return true
+}
+
+// mountDevice mounts dev read-only with the mount pool, records it in
+// c.rootDirs and returns the URL of the mount point.
+func (c *parser) mountDevice(dev *block.BlockDev) (*url.URL, error) {
+	if u, ok := c.rootDirs[dev.Name]; ok {
+		return u, nil
+	}
+	if c.mountPool == nil {
+		return nil, fmt.Errorf("cannot mount %s: no mount pool", dev.Name)
+	}
+	mp, err := c.mountPool.Mount(dev, mount.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	u := &url.URL{Scheme: "file", Path: mp.Path}
+	c.rootDirs[dev.Name] = u
+	return u, nil
+}
+
+// isMounted returns whether dev is already known to c or its mount pool.
+func (c *parser) isMounted(dev *block.BlockDev) bool {
+	if _, ok := c.rootDirs[dev.Name]; ok {
+		return true
+	}
+	if c.mountPool == nil {
+		return false
+	}
+	_, ok := c.mountPool.Lookup(dev)
+	return ok
+}
+
+// unmountDevice releases dev, which mountDevice mounted.
+func (c *parser) unmountDevice(dev *block.BlockDev) {
+	delete(c.rootDirs, dev.Name)
+	if err := c.mountPool.Unmount(dev, 0); err != nil {
+		log.Printf("[grub] search: %v", err)
+	}
+}
+
+// fileInfo returns information about the file at GRUB path p, if it is on a
+// local file system.
+func (c *parser) fileInfo(p string) (os.FileInfo, error) {
+	u, err := c.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("cannot stat %s", u)
+	}
+	return os.Stat(u.Path)
+}
+
+// test implements the GRUB test command.
+//
+// It supports string and integer comparisons, -n, -z, the file tests -e, -f,
+// -d and -s, negation with !, -a, -o and parentheses.
+func (c *parser) test(args []string) (bool, error) {
+	t := &testParser{c: c, args: args}
+	if len(args) == 0 {
+		return false, nil
+	}
+	ok, err := t.or()
+	if err != nil {
+		return false, err
+	}
+	if t.pos < len(args) {
+		return false, fmt.Errorf("test: unexpected argument %q", args[t.pos])
+	}
+	return ok, nil
+}
+
+type testParser struct {
+	c    *parser
+	args []string
+	pos  int
+}
+
+func (t *testParser) peek(i int) (string, bool) {
+	if t.pos+i < len(t.args) {
+		return t.args[t.pos+i], true
+	}
+	return "", false
+}
+
+func (t *testParser) or() (bool, error) {
+	ok, err := t.and()
+	if err != nil {
+		return false, err
+	}
+	for {
+		if op, _ := t.peek(0); op != "-o" {
+			return ok, nil
+		}
+		t.pos++
+		r, err := t.and()
+		if err != nil {
+			return false, err
+		}
+		ok = ok || r
+	}
+}
+
+func (t *testParser) and() (bool, error) {
+	ok, err := t.not()
+	if err != nil {
+		return false, err
+	}
+	for {
+		if op, _ := t.peek(0); op != "-a" {
+			return ok, nil
+		}
+		t.pos++
+		r, err := t.not()
+		if err != nil {
+			return false, err
+		}
+		ok = ok && r
+	}
+}
+
+func (t *testParser) not() (bool, error) {
+	if arg, ok := t.peek(0); ok && arg == "!" {
+		if _, more := t.peek(1); more {
+			t.pos++
+			r, err := t.not()
+			return !r, err
+		}
+	}
+	return t.primary()
+}
+
+func isBinaryOp(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<", "<=", ">", ">=", "-eq", "-ne", "-lt", "-le", "-gt", "-ge":
+		return true
+	}
+	return false
+}
+
+func (t *testParser) primary() (bool, error) {
+	arg, ok := t.peek(0)
+	if !ok {
+		return false, fmt.Errorf("test: missing argument")
+	}
+
+	// Binary operators take precedence, so that e.g. [ -n = -n ] works.
+	if op, ok := t.peek(1); ok && isBinaryOp(op) {
+		if rhs, ok := t.peek(2); ok {
+			t.pos += 3
+			return compare(arg, op, rhs)
+		}
+	}
+
+	switch arg {
+	case "(":
+		t.pos++
+		r, err := t.or()
+		if err != nil {
+			return false, err
+		}
+		if p, _ := t.peek(0); p != ")" {
+			return false, fmt.Errorf("test: missing )")
+		}
+		t.pos++
+		return r, nil
+
+	case "-n", "-z", "-e", "-f", "-d", "-s":
+		operand, ok := t.peek(1)
+		if !ok {
+			break
+		}
+		t.pos += 2
+		switch arg {
+		case "-n":
+			return len(operand) > 0, nil
+		case "-z":
+			return len(operand) == 0, nil
+		}
+		fi, err := t.c.fileInfo(operand)
+		if err != nil {
+			return false, nil
+		}
+		switch arg {
+		case "-f":
+			return fi.Mode().IsRegular(), nil
+		case "-d":
+			return fi.IsDir(), nil
+		case "-s":
+			return fi.Size() > 0, nil
+		}
+		return true, nil
+	}
+
+	// A single string is true if it is not empty.
+	t.pos++
+	return len(arg) > 0, nil
+}
+
+func compare(lhs, op, rhs string) (bool, error) {
+	switch op {
+	case "=", "==":
+		return lhs == rhs, nil
+	case "!=":
+		return lhs != rhs, nil
+	case "<":
+		return lhs < rhs, nil
+	case "<=":
+		return lhs <= rhs, nil
+	case ">":
+		return lhs > rhs, nil
+	case ">=":
+		return lhs >= rhs, nil
+	}
+
+	l, err := strconv.ParseInt(lhs, 0, 64)
+	if err != nil {
+		return false, fmt.Errorf("test: %q is not an integer", lhs)
+	}
+	r, err := strconv.ParseInt(rhs, 0, 64)
+	if err != nil {
+		return false, fmt.Errorf("test: %q is not an integer", rhs)
+	}
+	switch op {
+	case "-eq":
+		return l == r, nil
+	case "-ne":
+		return l != r, nil
+	case "-lt":
+		return l < r, nil
+	case "-le":
+		return l <= r, nil
+	case "-gt":
+		return l > r, nil
+	case "-ge":
+		return l >= r, nil
+	}
+	return false, fmt.Errorf("test: unknown operator %q", op)
+}
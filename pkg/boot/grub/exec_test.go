@@ -0,0 +1,215 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grub
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type wantImage struct {
+	name    string
+	kernel  string
+	initrd  string
+	dtb     string
+	cmdline string
+}
+
+func checkImages(t *testing.T, imgs []boot.OSImage, want []wantImage) {
+	t.Helper()
+	if len(imgs) != len(want) {
+		t.Fatalf("got %d images (%v), want %d", len(imgs), imgs, len(want))
+	}
+	for i, img := range imgs {
+		li, ok := img.(*boot.LinuxImage)
+		if !ok {
+			t.Errorf("image %d is %T, want *boot.LinuxImage", i, img)
+			continue
+		}
+		if li.Name != want[i].name {
+			t.Errorf("image %d name = %q, want %q", i, li.Name, want[i].name)
+		}
+		if li.Cmdline != want[i].cmdline {
+			t.Errorf("image %d cmdline = %q, want %q", i, li.Cmdline, want[i].cmdline)
+		}
+		if got := li.Kernel.(curl.File).URL().Path; got != want[i].kernel {
+			t.Errorf("image %d kernel = %q, want %q", i, got, want[i].kernel)
+		}
+		if len(want[i].initrd) > 0 {
+			if li.Initrd == nil {
+				t.Errorf("image %d has no initrd, want %q", i, want[i].initrd)
+			} else if got := li.Initrd.(curl.File).URL().Path; got != want[i].initrd {
+				t.Errorf("image %d initrd = %q, want %q", i, got, want[i].initrd)
+			}
+		}
+		if len(want[i].dtb) > 0 {
+			if li.DTB == nil {
+				t.Errorf("image %d has no device tree, want %q", i, want[i].dtb)
+			} else if got := li.DTB.(curl.File).URL().Path; got != want[i].dtb {
+				t.Errorf("image %d device tree = %q, want %q", i, got, want[i].dtb)
+			}
+		}
+	}
+}
+
+func TestParseConfigFileScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// other is another partition that search --fs-uuid finds.
+	other := filepath.Join(dir, "other")
+	disk := filepath.Join(dir, "disk")
+
+	writeFiles(t, disk, map[string]string{
+		"boot/grub/grubenv": "# GRUB Environment Block\nsaved_entry=1>Linux old\nkernelopts=root=/dev/sda2 ro\n",
+		"boot/grub/grub.cfg": `
+if [ -s $prefix/grubenv ]; then
+  load_env
+fi
+if [ "${saved_entry}" ]; then
+  set default="${saved_entry}"
+fi
+
+function opts {
+  set extra="quiet $1"
+}
+
+menuentry 'Linux' --id linux {
+  opts splash
+  linux /vmlinuz $kernelopts $extra
+  initrd /initrd.img
+}
+submenu 'Advanced' {
+  menuentry 'Linux new' {
+    linux /vmlinuz-new $kernelopts
+  }
+  menuentry 'Linux old' {
+    search --no-floppy --fs-uuid --set=root ABCD-1234
+    linux /vmlinuz-old $kernelopts
+    initrd ($root)/initrd-old
+  }
+}
+if [ -f ${config_directory}/custom.cfg ]; then
+  source ${config_directory}/custom.cfg
+fi
+`,
+		"boot/grub/custom.cfg": `
+menuentry "Custom" {
+  linux (hd0,gpt1)/vmlinuz-custom console=ttyS0
+  devicetree /dtbs/board.dtb
+}
+`,
+	})
+
+	p := newParser(&url.URL{Scheme: "file", Path: disk}, curl.DefaultSchemes)
+	p.devices = block.BlockDevices{
+		{Name: "sda1", FsUUID: "abcd-1234"},
+	}
+	// Pretend sda1 is already mounted at other.
+	p.rootDirs["sda1"] = &url.URL{Scheme: "file", Path: other}
+
+	imgs, err := p.parseFile(context.Background(), "boot/grub/grub.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImages(t, imgs, []wantImage{
+		{
+			name:    "Linux old",
+			kernel:  filepath.Join(other, "vmlinuz-old"),
+			initrd:  filepath.Join(other, "initrd-old"),
+			cmdline: "root=/dev/sda2 ro",
+		},
+		{
+			name:    "Linux",
+			kernel:  filepath.Join(disk, "vmlinuz"),
+			initrd:  filepath.Join(disk, "initrd.img"),
+			cmdline: "root=/dev/sda2 ro quiet splash",
+		},
+		{
+			name:    "Linux new",
+			kernel:  filepath.Join(disk, "vmlinuz-new"),
+			cmdline: "root=/dev/sda2 ro",
+		},
+		{
+			name:    "Custom",
+			kernel:  filepath.Join(disk, "vmlinuz-custom"),
+			dtb:     filepath.Join(disk, "dtbs/board.dtb"),
+			cmdline: "console=ttyS0",
+		},
+	})
+}
+
+func TestMenuKeys(t *testing.T) {
+	path := []menuLevel{
+		{index: "1", title: "Advanced"},
+		{index: "0", title: "Linux", id: "linux"},
+	}
+	want := map[string]bool{
+		"1>0": true, "1>Linux": true, "1>linux": true,
+		"Advanced>0": true, "Advanced>Linux": true, "Advanced>linux": true,
+	}
+	got := menuKeys(path)
+	if len(got) != len(want) {
+		t.Errorf("menuKeys() = %v, want %v", got, want)
+	}
+	for _, k := range got {
+		if !want[k] {
+			t.Errorf("menuKeys() contains unexpected key %q", k)
+		}
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	for _, script := range []string{
+		"if true; then echo",
+		"menuentry 'foo' {",
+		"echo 'unterminated",
+		"echo \"unterminated",
+		"for i in 1 2; echo $i; done",
+		"function {",
+		"}",
+	} {
+		if _, err := parseScript(script); err == nil {
+			t.Errorf("parseScript(%q) = nil, want error", script)
+		}
+	}
+}
+
+func TestInfiniteLoop(t *testing.T) {
+	for _, config := range []string{
+		"while true; do echo; done",
+		"until false; do echo; done",
+		"function f { echo; }; while true; do f; done",
+	} {
+		p := newParser(&url.URL{Scheme: "file", Path: "/"}, curl.DefaultSchemes)
+		p.W = ioutil.Discard
+		if err := p.append(context.Background(), config); err != errTooManySteps {
+			t.Errorf("append(%q) = %v, want %v", config, err, errTooManySteps)
+		}
+	}
+}
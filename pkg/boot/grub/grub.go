@@ -10,24 +10,29 @@
 // - https://www.gnu.org/software/grub/manual/grub/html_node/Shell_002dlike-scripting.html
 // - https://www.gnu.org/software/grub/manual/grub/html_node/Commands.html
 //
-// Currently, only the linux[16|efi], initrd[16|efi], menuentry and set
-// directives are partially supported.
+// Configs are evaluated by a small GRUB script interpreter that understands
+// variables, if/elif/else, loops, functions, menuentry and submenu blocks.
+// Of the GRUB commands, linux[16|efi], initrd[16|efi], multiboot, module,
+// set, unset, source, configfile, load_env, search and test are supported;
+// most others are ignored.
 package grub
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/url"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/u-root/u-root/pkg/boot"
-	"github.com/u-root/u-root/pkg/boot/multiboot"
 	"github.com/u-root/u-root/pkg/curl"
-	"github.com/u-root/u-root/pkg/shlex"
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/block"
 	"github.com/u-root/u-root/pkg/uio"
 )
 
@@ -41,10 +46,10 @@ var probeGrubFiles = []string{
 // ParseLocalConfig looks for a GRUB config in the disk partition mounted at
 // diskDir and parses out OSes to boot.
 //
-// This... is at best crude, at worst totally wrong, since we fundamentally
-// assume that the kernels we boot are only on this one partition. But so is
-// this whole parser.
-func ParseLocalConfig(ctx context.Context, diskDir string) ([]boot.OSImage, error) {
+// Paths in the config are assumed to be on the partition at diskDir, unless
+// the config uses "search" to select another device. Such devices are looked
+// up in devices and mounted using mountPool. Both may be nil.
+func ParseLocalConfig(ctx context.Context, diskDir string, devices block.BlockDevices, mountPool *mount.Pool) ([]boot.OSImage, error) {
 	wd := &url.URL{
 		Scheme: "file",
 		Path:   diskDir,
@@ -70,7 +75,7 @@ func ParseLocalConfig(ctx context.Context, diskDir string) ([]boot.OSImage, erro
 	}
 
 	for _, relname := range append(relNames, probeGrubFiles...) {
-		c, err := ParseConfigFile(ctx, curl.DefaultSchemes, relname, wd)
+		c, err := ParseConfigFile(ctx, curl.DefaultSchemes, relname, wd, devices, mountPool)
 		if curl.IsURLError(err) {
 			continue
 		}
@@ -82,14 +87,31 @@ func ParseLocalConfig(ctx context.Context, diskDir string) ([]boot.OSImage, erro
 // ParseConfigFile parses a grub configuration as specified in
 // https://www.gnu.org/software/grub/manual/grub/
 //
-// Currently, only the linux[16|efi], initrd[16|efi], menuentry and set
-// directives are partially supported.
-//
 // `wd` is the default scheme, host, and path for any files named as a
 // relative path - e.g. kernel, include, and initramfs paths are requested
-// relative to the wd.
-func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, wd *url.URL) ([]boot.OSImage, error) {
+// relative to the wd. It is also the file system of the initial $root
+// device.
+//
+// `devices` and `mountPool` are used to resolve the "search" command and may
+// be nil.
+func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, wd *url.URL, devices block.BlockDevices, mountPool *mount.Pool) ([]boot.OSImage, error) {
 	p := newParser(wd, s)
+	p.devices = devices
+	p.mountPool = mountPool
+	return p.parseFile(ctx, configFile)
+}
+
+// parseFile evaluates the config file and returns the images of its menu
+// entries, with the default entry first.
+func (p *parser) parseFile(ctx context.Context, configFile string) ([]boot.OSImage, error) {
+	// $prefix is the directory GRUB was loaded from. Without better
+	// knowledge, use the directory of the config file.
+	prefix := path.Dir(configFile)
+	if u, err := url.Parse(configFile); err == nil && len(u.Scheme) == 0 && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	p.vars["prefix"] = prefix
+
 	if err := p.appendFile(ctx, configFile); err != nil {
 		return nil, err
 	}
@@ -100,12 +122,13 @@ func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, wd
 	seenLinux := make(map[*boot.LinuxImage]struct{})
 	seenMB := make(map[*boot.MultibootImage]struct{})
 
-	if len(p.defaultEntry) > 0 {
-		p.labelOrder = append([]string{p.defaultEntry}, p.labelOrder...)
+	labelOrder := p.labelOrder
+	if defaultEntry := p.vars["default"]; len(defaultEntry) > 0 {
+		labelOrder = append([]string{defaultEntry}, labelOrder...)
 	}
 
 	var images []boot.OSImage
-	for _, label := range p.labelOrder {
+	for _, label := range labelOrder {
 		if img, ok := p.linuxEntries[label]; ok {
 			if _, ok := seenLinux[img]; !ok {
 				images = append(images, img)
@@ -123,28 +146,86 @@ func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, wd
 	return images, nil
 }
 
+// menuLevel describes a menu entry or submenu and its position in its
+// parent menu.
+type menuLevel struct {
+	index string
+	title string
+	id    string
+}
+
 type parser struct {
 	linuxEntries map[string]*boot.LinuxImage
 	mbEntries    map[string]*boot.MultibootImage
 
-	labelOrder   []string
-	defaultEntry string
+	labelOrder []string
 
 	W io.Writer
 
-	// parser internals.
+	// Script interpreter state.
+
+	// vars are GRUB environment variables.
+	vars map[string]string
+
+	// params are the positional parameters of the running function or
+	// menu entry.
+	params []string
+
+	funcs map[string]list
+
+	// status is the exit status of the last command, as in $?.
+	status int
+
+	// depth is the function call and file inclusion depth.
+	depth int
+
+	// steps is the number of commands executed so far.
+	steps int
+
+	// Menu state.
+
+	// numEntry is the number of entries in the current menu.
 	numEntry int
 
-	// curEntry is the current entry number as a string.
-	curEntry string
+	// menuPath are the enclosing submenus and, while its body is being
+	// evaluated, the current menu entry.
+	menuPath []menuLevel
 
-	// curLabel is the last parsed label from a "menuentry".
+	// curKeys are the labels under which images of the menu entry being
+	// evaluated are stored. It is nil outside of a menu entry.
+	curKeys []string
+
+	// curLabel is the title of the menu entry being evaluated.
 	curLabel string
 
+	// Device state.
+
+	devices   block.BlockDevices
+	mountPool *mount.Pool
+
+	// rootDirs maps GRUB device names found by "search" to the URL of
+	// the directory they are mounted at.
+	rootDirs map[string]*url.URL
+
 	wd      *url.URL
 	schemes curl.Schemes
 }
 
+// grubFeatures are variables set by GRUB itself that grub-mkconfig generated
+// configs check to find out which commands are available.
+var grubFeatures = map[string]string{
+	"feature_chainloader_bpb":      "y",
+	"feature_ntldr":                "y",
+	"feature_platform_search_hint": "y",
+	"feature_default_font_path":    "y",
+	"feature_all_video_module":     "y",
+	"feature_menuentry_id":         "y",
+	"feature_menuentry_options":    "y",
+	"feature_200_final":            "y",
+	"feature_nativedisk_cmd":       "y",
+	"feature_timeout_style":        "y",
+}
+
 // newParser returns a new grub parser using working directory `wd`
 // and schemes `s`.
 //
@@ -154,9 +235,16 @@ type parser struct {
 //
 // `s` is used to get files referred to by URLs.
 func newParser(wd *url.URL, s curl.Schemes) *parser {
+	vars := make(map[string]string)
+	for k, v := range grubFeatures {
+		vars[k] = v
+	}
 	return &parser{
 		linuxEntries: make(map[string]*boot.LinuxImage),
 		mbEntries:    make(map[string]*boot.MultibootImage),
+		vars:         vars,
+		funcs:        make(map[string]list),
+		rootDirs:     make(map[string]*url.URL),
 		wd:           wd,
 		schemes:      s,
 	}
@@ -180,6 +268,50 @@ func parseURL(surl string, wd *url.URL) (*url.URL, error) {
 	return u, nil
 }
 
+// deviceURL returns the base URL of the files on GRUB device dev.
+//
+// Devices found by "search" map to their mount point, network devices such
+// as (http,host) or (tftp) map to the respective server, and anything else
+// maps to the working directory.
+func (c *parser) deviceURL(dev string) *url.URL {
+	if u, ok := c.rootDirs[dev]; ok {
+		return u
+	}
+	proto, server := dev, ""
+	if i := strings.IndexByte(dev, ','); i >= 0 {
+		proto, server = dev[:i], dev[i+1:]
+	}
+	switch proto {
+	case "http", "https", "tftp":
+		if len(server) == 0 {
+			server = c.wd.Host
+		}
+		return &url.URL{Scheme: proto, Host: server, Path: "/"}
+	}
+	return c.wd
+}
+
+// resolve returns the URL of the GRUB file path p.
+//
+// p may be of the form (device)/path, /path on the $root device, or a URL or
+// path relative to the working directory.
+func (c *parser) resolve(p string) (*url.URL, error) {
+	dev := c.vars["root"]
+	if strings.HasPrefix(p, "(") {
+		end := strings.IndexByte(p, ')')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid device name in %q", p)
+		}
+		dev, p = p[1:end], p[end+1:]
+		if len(p) == 0 {
+			p = "/"
+		}
+	} else if !strings.HasPrefix(p, "/") {
+		return parseURL(p, c.wd)
+	}
+	return parseURL(p, c.deviceURL(dev))
+}
+
 // getFile parses `url` relative to the config's working directory and returns
 // an io.Reader for the requested url.
 //
@@ -187,7 +319,7 @@ func parseURL(surl string, wd *url.URL) (*url.URL, error) {
 // "working directory" of that relative path; the resulting URL is roughly
 // path.Join(wd.String(), url).
 func (c *parser) getFile(url string) (io.ReaderAt, error) {
-	u, err := parseURL(url, c.wd)
+	u, err := c.resolve(url)
 	if err != nil {
 		return nil, err
 	}
@@ -195,9 +327,20 @@ func (c *parser) getFile(url string) (io.ReaderAt, error) {
 	return c.schemes.LazyFetch(u)
 }
 
+const (
+	// maxDepth limits function recursion and file inclusion.
+	maxDepth = 64
+
+	// maxSteps bounds the number of commands executed, as configs may
+	// loop forever.
+	maxSteps = 100000
+)
+
+var errTooManySteps = errors.New("config does not terminate")
+
 // appendFile parses the config file downloaded from `url` and adds it to `c`.
 func (c *parser) appendFile(ctx context.Context, url string) error {
-	u, err := parseURL(url, c.wd)
+	u, err := c.resolve(url)
 	if err != nil {
 		return err
 	}
@@ -218,6 +361,17 @@ func (c *parser) appendFile(ctx context.Context, url string) error {
 	} else {
 		log.Printf("[grub] Got config file %s:\n%s\n", r, string(config))
 	}
+
+	// $config_directory is the directory of the file being read.
+	oldConfigDir, hadConfigDir := c.vars["config_directory"]
+	c.vars["config_directory"] = path.Dir(url)
+	defer func() {
+		if hadConfigDir {
+			c.vars["config_directory"] = oldConfigDir
+		} else {
+			delete(c.vars, "config_directory")
+		}
+	}()
 	return c.append(ctx, string(config))
 }
 
@@ -236,113 +390,169 @@ func cmdlineQuote(args []string) string {
 	return strings.Join(q, " ")
 }
 
-// append parses `config` and adds the respective configuration to `c`.
-//
-// NOTE: This parser has outlived its usefulness already, given that it doesn't
-// even understand the {} scoping in GRUB. But let's get the tests to pass, and
-// then we can do a rewrite.
+// append parses `config` and evaluates it, adding the resulting menu entries
+// to `c`.
 func (c *parser) append(ctx context.Context, config string) error {
-	// Here's a shitty parser.
-	for _, line := range strings.Split(config, "\n") {
-		kv := shlex.Argv(line)
-		if len(kv) < 1 {
-			continue
-		}
-		directive := strings.ToLower(kv[0])
-		// Used by tests (allow no parameters here)
-		if c.W != nil && directive == "echo" {
-			fmt.Fprintf(c.W, "echo:%#v\n", kv[1:])
-		}
+	script, err := parseScript(config)
+	if err != nil {
+		return err
+	}
+	if c.depth >= maxDepth {
+		return fmt.Errorf("config files nested too deeply")
+	}
+	c.depth++
+	defer func() { c.depth-- }()
+
+	_, err = c.execList(ctx, script)
+	switch err.(type) {
+	case breakError, continueError, returnError:
+		// Stray control flow statements just stop the script.
+		return nil
+	}
+	return err
+}
 
-		if len(kv) <= 1 {
-			continue
+// menuKeys returns all labels a GRUB "default" variable may use to refer to
+// the menu entry at the end of path: each level can be referred to by index,
+// title, or id, and levels are separated by '>'.
+func menuKeys(path []menuLevel) []string {
+	if len(path) == 0 {
+		return []string{""}
+	}
+	var keys []string
+	for _, prefix := range menuKeys(path[:len(path)-1]) {
+		last := path[len(path)-1]
+		names := []string{last.index, last.title}
+		if len(last.id) > 0 {
+			names = append(names, last.id)
 		}
-		arg := kv[1]
-
-		switch directive {
-		case "set":
-			vals := strings.SplitN(arg, "=", 2)
-			if len(vals) == 2 {
-				//TODO handle vars? bootVars[vals[0]] = vals[1]
-				//log.Printf("grubvar: %s=%s", vals[0], vals[1])
-				if vals[0] == "default" {
-					c.defaultEntry = vals[1]
-				}
+		for _, name := range names {
+			if len(prefix) > 0 {
+				name = prefix + ">" + name
 			}
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
 
-		case "configfile":
-			// TODO test that
-			if err := c.appendFile(ctx, arg); err != nil {
-				return err
+// menuEntry evaluates a menuentry or submenu definition.
+//
+// GRUB evaluates a menu entry's body when the entry is chosen. Here, it is
+// evaluated right away with a copy of the current variables, so that
+// changes made by the entry do not affect the rest of the config.
+func (c *parser) menuEntry(ctx context.Context, n *menuNode) (bool, error) {
+	args := c.expandWords(n.args)
+
+	var level menuLevel
+	var params []string
+	titleSet := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--unrestricted":
+
+		case arg == "--class" || arg == "--users" || arg == "--hotkey" || arg == "--source":
+			// These take an argument.
+			i++
+
+		case arg == "--id":
+			if i+1 < len(args) {
+				level.id = args[i+1]
 			}
+			i++
 
-		case "menuentry":
-			c.curEntry = strconv.Itoa(c.numEntry)
-			c.curLabel = arg
-			c.numEntry++
-			c.labelOrder = append(c.labelOrder, c.curEntry, c.curLabel)
+		case strings.HasPrefix(arg, "--id="):
+			level.id = strings.TrimPrefix(arg, "--id=")
 
-		case "linux", "linux16", "linuxefi":
-			k, err := c.getFile(arg)
-			if err != nil {
-				return err
-			}
-			// from grub manual: "Any initrd must be reloaded after using this command" so we can replace the entry
-			entry := &boot.LinuxImage{
-				Name:    c.curLabel,
-				Kernel:  k,
-				Cmdline: cmdlineQuote(kv[2:]),
-			}
-			c.linuxEntries[c.curEntry] = entry
-			c.linuxEntries[c.curLabel] = entry
-
-		case "initrd", "initrd16", "initrdefi":
-			if e, ok := c.linuxEntries[c.curEntry]; ok {
-				i, err := c.getFile(arg)
-				if err != nil {
-					return err
-				}
-				e.Initrd = i
-			}
+		case strings.HasPrefix(arg, "--") && strings.Contains(arg, "="):
 
-		case "multiboot":
-			// TODO handle --quirk-* arguments ? (change parsing)
-			k, err := c.getFile(arg)
-			if err != nil {
-				return err
-			}
-			// from grub manual: "Any initrd must be reloaded after using this command" so we can replace the entry
-			entry := &boot.MultibootImage{
-				Name:    c.curLabel,
-				Kernel:  k,
-				Cmdline: cmdlineQuote(kv[2:]),
-			}
-			c.mbEntries[c.curEntry] = entry
-			c.mbEntries[c.curLabel] = entry
-
-		case "module":
-			// TODO handle --nounzip arguments ? (change parsing)
-			if e, ok := c.mbEntries[c.curEntry]; ok {
-				// The only allowed arg
-				cmdline := kv[1:]
-				if arg == "--nounzip" {
-					arg = kv[2]
-					cmdline = kv[2:]
-				}
-
-				m, err := c.getFile(arg)
-				if err != nil {
-					return err
-				}
-				// TODO: Lasy tryGzipFilter(m)
-				mod := multiboot.Module{
-					Module:  m,
-					Cmdline: cmdlineQuote(cmdline),
-				}
-				e.Modules = append(e.Modules, mod)
-			}
+		case !titleSet:
+			level.title = arg
+			titleSet = true
+
+		default:
+			params = append(params, arg)
 		}
 	}
-	return nil
+	if !titleSet {
+		return false, fmt.Errorf("line %d: menu entry without title", n.line)
+	}
+	level.index = strconv.Itoa(c.numEntry)
+	c.numEntry++
+
+	// Save the state that is local to the entry.
+	savedVars := c.vars
+	savedParams := c.params
+	savedNumEntry := c.numEntry
+	savedKeys, savedLabel := c.curKeys, c.curLabel
+	defer func() {
+		c.vars = savedVars
+		c.params = savedParams
+		c.numEntry = savedNumEntry
+		c.curKeys, c.curLabel = savedKeys, savedLabel
+		c.menuPath = c.menuPath[:len(c.menuPath)-1]
+	}()
+
+	c.vars = make(map[string]string, len(savedVars))
+	for k, v := range savedVars {
+		c.vars[k] = v
+	}
+	c.params = params
+	c.menuPath = append(c.menuPath, level)
+	keys := menuKeys(c.menuPath)
+	titles := make([]string, len(c.menuPath))
+	for i, l := range c.menuPath {
+		titles[i] = l.title
+	}
+	c.vars["chosen"] = strings.Join(titles, ">")
+
+	if n.submenu {
+		// Entries of a submenu are numbered starting from zero.
+		c.numEntry = 0
+		c.curKeys = nil
+	} else {
+		c.curKeys = keys
+		c.curLabel = level.title
+		c.labelOrder = append(c.labelOrder, keys...)
+	}
+
+	_, err := c.execList(ctx, n.body)
+	switch err.(type) {
+	case breakError, continueError, returnError:
+		return true, nil
+	}
+	return err == nil, err
+}
 
+// addLinux adds a Linux image to the current menu entry.
+func (c *parser) addLinux(entry *boot.LinuxImage) {
+	for _, k := range c.curKeys {
+		c.linuxEntries[k] = entry
+	}
+}
+
+// addMultiboot adds a multiboot image to the current menu entry.
+func (c *parser) addMultiboot(entry *boot.MultibootImage) {
+	for _, k := range c.curKeys {
+		c.mbEntries[k] = entry
+	}
+}
+
+// curLinux returns the Linux image of the current menu entry, if any.
+func (c *parser) curLinux() (*boot.LinuxImage, bool) {
+	if len(c.curKeys) == 0 {
+		return nil, false
+	}
+	e, ok := c.linuxEntries[c.curKeys[0]]
+	return e, ok
+}
+
+// curMultiboot returns the multiboot image of the current menu entry, if any.
+func (c *parser) curMultiboot() (*boot.MultibootImage, bool) {
+	if len(c.curKeys) == 0 {
+		return nil, false
+	}
+	e, ok := c.mbEntries[c.curKeys[0]]
+	return e, ok
 }
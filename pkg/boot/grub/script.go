@@ -0,0 +1,645 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grub
+
+import (
+	"fmt"
+	"strings"
+)
+
+// This file contains the lexer and parser for the GRUB scripting language.
+//
+// See https://www.gnu.org/software/grub/manual/grub/html_node/Shell_002dlike-scripting.html.
+
+type tokenType int
+
+const (
+	tokWord tokenType = iota
+	// tokNewline is a command separator: a newline or a ';'.
+	tokNewline
+	tokLBrace
+	tokRBrace
+	tokEOF
+)
+
+// wordPart is a piece of a word: either literal text or a variable reference.
+type wordPart struct {
+	text string
+
+	// isVar is true if text is the name of a variable to be expanded.
+	isVar bool
+
+	// quoted is true if the part was quoted or escaped. Quoted variables
+	// are not split into fields, and quoted text is never a keyword.
+	quoted bool
+}
+
+// word is a single shell word before expansion.
+type word []wordPart
+
+// literal returns the text of w if it consists only of unquoted literal text.
+func (w word) literal() (string, bool) {
+	var s strings.Builder
+	for _, p := range w {
+		if p.isVar || p.quoted {
+			return "", false
+		}
+		s.WriteString(p.text)
+	}
+	return s.String(), true
+}
+
+type token struct {
+	typ  tokenType
+	word word
+	line int
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokNewline:
+		return "newline"
+	case tokLBrace:
+		return "{"
+	case tokRBrace:
+		return "}"
+	case tokEOF:
+		return "end of file"
+	}
+	var s strings.Builder
+	for _, p := range t.word {
+		if p.isVar {
+			s.WriteString("${" + p.text + "}")
+		} else {
+			s.WriteString(p.text)
+		}
+	}
+	return s.String()
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+func isVarStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isVarChar(c byte) bool {
+	return isVarStart(c) || (c >= '0' && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type lexer struct {
+	s    string
+	pos  int
+	line int
+	toks []token
+}
+
+// lex splits a GRUB script into tokens.
+func lex(s string) ([]token, error) {
+	l := &lexer{s: s, line: 1}
+	for l.pos < len(l.s) {
+		c := l.s[l.pos]
+		switch {
+		case isBlank(c):
+			l.pos++
+
+		case c == '\n':
+			l.emit(tokNewline, nil)
+			l.line++
+			l.pos++
+
+		case c == ';':
+			l.emit(tokNewline, nil)
+			l.pos++
+
+		case c == '#':
+			// Comments are only recognized at the beginning of a word.
+			for l.pos < len(l.s) && l.s[l.pos] != '\n' {
+				l.pos++
+			}
+
+		case c == '\\' && l.pos+1 < len(l.s) && l.s[l.pos+1] == '\n':
+			// Line continuation.
+			l.pos += 2
+			l.line++
+
+		default:
+			line := l.line
+			w, err := l.word()
+			if err != nil {
+				return nil, err
+			}
+			typ := tokWord
+			if lit, ok := w.literal(); ok {
+				switch lit {
+				case "{":
+					typ = tokLBrace
+				case "}":
+					typ = tokRBrace
+				}
+			}
+			l.toks = append(l.toks, token{typ: typ, word: w, line: line})
+		}
+	}
+	l.emit(tokEOF, nil)
+	return l.toks, nil
+}
+
+func (l *lexer) emit(typ tokenType, w word) {
+	l.toks = append(l.toks, token{typ: typ, word: w, line: l.line})
+}
+
+// wordBuilder accumulates the parts of a word.
+type wordBuilder struct {
+	w      word
+	lit    strings.Builder
+	quoted bool
+}
+
+func (b *wordBuilder) flush() {
+	if b.lit.Len() > 0 {
+		b.w = append(b.w, wordPart{text: b.lit.String(), quoted: b.quoted})
+		b.lit.Reset()
+	}
+}
+
+// add adds literal text, starting a new part if the quoting changes.
+func (b *wordBuilder) add(s string, quoted bool) {
+	if quoted != b.quoted {
+		b.flush()
+		b.quoted = quoted
+	}
+	b.lit.WriteString(s)
+}
+
+func (b *wordBuilder) addVar(name string, quoted bool) {
+	b.flush()
+	b.w = append(b.w, wordPart{text: name, isVar: true, quoted: quoted})
+}
+
+// addEmpty adds an empty quoted part, so that ” and "" still expand to an
+// (empty) argument.
+func (b *wordBuilder) addEmpty() {
+	b.flush()
+	b.w = append(b.w, wordPart{quoted: true})
+}
+
+func (b *wordBuilder) word() word {
+	b.flush()
+	return b.w
+}
+
+// word reads a single word starting at the current position.
+func (l *lexer) word() (word, error) {
+	var b wordBuilder
+	for l.pos < len(l.s) {
+		c := l.s[l.pos]
+		switch {
+		case isBlank(c) || c == '\n' || c == ';':
+			return b.word(), nil
+
+		case c == '\\':
+			l.pos++
+			if l.pos >= len(l.s) {
+				b.add(`\`, false)
+				break
+			}
+			if l.s[l.pos] == '\n' {
+				l.line++
+			} else {
+				b.add(l.s[l.pos:l.pos+1], true)
+			}
+			l.pos++
+
+		case c == '\'':
+			end := strings.IndexByte(l.s[l.pos+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", l.line)
+			}
+			s := l.s[l.pos+1 : l.pos+1+end]
+			l.line += strings.Count(s, "\n")
+			if len(s) == 0 {
+				b.addEmpty()
+			} else {
+				b.add(s, true)
+			}
+			l.pos += end + 2
+
+		case c == '"':
+			if err := l.doubleQuoted(&b); err != nil {
+				return nil, err
+			}
+
+		case c == '$':
+			if name, ok := l.variable(); ok {
+				b.addVar(name, false)
+			} else {
+				b.add("$", false)
+			}
+
+		default:
+			b.add(l.s[l.pos:l.pos+1], false)
+			l.pos++
+		}
+	}
+	return b.word(), nil
+}
+
+// doubleQuoted reads a double-quoted string starting at the current position.
+func (l *lexer) doubleQuoted(b *wordBuilder) error {
+	start := l.line
+	empty := true
+	l.pos++
+	for l.pos < len(l.s) {
+		c := l.s[l.pos]
+		switch c {
+		case '"':
+			if empty {
+				b.addEmpty()
+			}
+			l.pos++
+			return nil
+
+		case '\\':
+			if l.pos+1 < len(l.s) {
+				switch n := l.s[l.pos+1]; n {
+				case '$', '"', '\\':
+					b.add(string(n), true)
+					l.pos += 2
+					empty = false
+					continue
+				case '\n':
+					l.line++
+					l.pos += 2
+					continue
+				}
+			}
+			b.add(`\`, true)
+			l.pos++
+
+		case '$':
+			if name, ok := l.variable(); ok {
+				b.addVar(name, true)
+			} else {
+				b.add("$", true)
+			}
+
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			b.add(l.s[l.pos:l.pos+1], true)
+			l.pos++
+		}
+		empty = false
+	}
+	return fmt.Errorf("line %d: unterminated double quote", start)
+}
+
+// variable reads a variable reference starting at the '$' at the current
+// position. If no valid variable name follows, it consumes only the '$' and
+// returns false.
+func (l *lexer) variable() (string, bool) {
+	l.pos++
+	if l.pos >= len(l.s) {
+		return "", false
+	}
+	c := l.s[l.pos]
+	switch {
+	case c == '{':
+		end := strings.IndexByte(l.s[l.pos:], '}')
+		if end < 0 {
+			return "", false
+		}
+		name := l.s[l.pos+1 : l.pos+end]
+		l.pos += end + 1
+		return name, true
+
+	case isVarStart(c):
+		start := l.pos
+		for l.pos < len(l.s) && isVarChar(l.s[l.pos]) {
+			l.pos++
+		}
+		return l.s[start:l.pos], true
+
+	case isDigit(c):
+		start := l.pos
+		for l.pos < len(l.s) && isDigit(l.s[l.pos]) {
+			l.pos++
+		}
+		return l.s[start:l.pos], true
+
+	case c == '?' || c == '#' || c == '*' || c == '@':
+		l.pos++
+		return string(c), true
+	}
+	return "", false
+}
+
+// node is a GRUB script AST node.
+type node interface{}
+
+// list is a sequence of commands.
+type list []node
+
+// cmdNode is a simple command.
+type cmdNode struct {
+	words []word
+	line  int
+}
+
+// ifNode is an if/elif/else/fi construct. conds[i] guards bodies[i].
+type ifNode struct {
+	conds  []list
+	bodies []list
+	orElse list
+}
+
+// loopNode is a while or until loop.
+type loopNode struct {
+	cond  list
+	body  list
+	until bool
+}
+
+// forNode is a for loop.
+type forNode struct {
+	name  string
+	items []word
+	body  list
+}
+
+// funcNode is a function definition.
+type funcNode struct {
+	name string
+	body list
+}
+
+// menuNode is a menuentry or submenu definition.
+type menuNode struct {
+	submenu bool
+	args    []word
+	body    list
+	line    int
+}
+
+// blockNode is a { ... } block.
+type blockNode struct {
+	body list
+}
+
+type scriptParser struct {
+	toks []token
+	pos  int
+}
+
+// parseScript parses a GRUB script into an AST.
+func parseScript(s string) (list, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &scriptParser{toks: toks}
+	l, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tokEOF {
+		return nil, fmt.Errorf("line %d: unexpected %q", t.line, t)
+	}
+	return l, nil
+}
+
+func (p *scriptParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *scriptParser) next() token {
+	t := p.toks[p.pos]
+	if t.typ != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *scriptParser) skipNewlines() {
+	for p.peek().typ == tokNewline {
+		p.next()
+	}
+}
+
+// keyword returns the keyword at the current position, if any.
+func (p *scriptParser) keyword() string {
+	t := p.peek()
+	if t.typ != tokWord {
+		return ""
+	}
+	lit, _ := t.word.literal()
+	return lit
+}
+
+func (p *scriptParser) expect(kw string) error {
+	p.skipNewlines()
+	if p.keyword() != kw {
+		t := p.peek()
+		return fmt.Errorf("line %d: expected %q, got %q", t.line, kw, t)
+	}
+	p.next()
+	return nil
+}
+
+func (p *scriptParser) expectType(typ tokenType, desc string) error {
+	p.skipNewlines()
+	if t := p.peek(); t.typ != typ {
+		return fmt.Errorf("line %d: expected %q, got %q", t.line, desc, t)
+	}
+	p.next()
+	return nil
+}
+
+// list parses commands until EOF, a '}' or one of the given keywords, none
+// of which are consumed.
+func (p *scriptParser) list(terminators ...string) (list, error) {
+	var l list
+	for {
+		p.skipNewlines()
+		t := p.peek()
+		if t.typ == tokEOF || t.typ == tokRBrace {
+			return l, nil
+		}
+		kw := p.keyword()
+		for _, term := range terminators {
+			if kw == term {
+				return l, nil
+			}
+		}
+		n, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, n)
+	}
+}
+
+// block parses a '{' list '}' construct.
+func (p *scriptParser) block() (list, error) {
+	if err := p.expectType(tokLBrace, "{"); err != nil {
+		return nil, err
+	}
+	body, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectType(tokRBrace, "}"); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (p *scriptParser) command() (node, error) {
+	t := p.peek()
+	if t.typ == tokLBrace {
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return &blockNode{body: body}, nil
+	}
+
+	switch p.keyword() {
+	case "if":
+		return p.ifCommand()
+
+	case "while", "until":
+		until := p.keyword() == "until"
+		p.next()
+		cond, err := p.list("do")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		body, err := p.list("done")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("done"); err != nil {
+			return nil, err
+		}
+		return &loopNode{cond: cond, body: body, until: until}, nil
+
+	case "for":
+		p.next()
+		name, ok := p.next().word.literal()
+		if !ok || len(name) == 0 {
+			return nil, fmt.Errorf("line %d: invalid for loop variable", t.line)
+		}
+		n := &forNode{name: name}
+		if p.keyword() == "in" {
+			p.next()
+			for p.peek().typ == tokWord {
+				n.items = append(n.items, p.next().word)
+			}
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		body, err := p.list("done")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("done"); err != nil {
+			return nil, err
+		}
+		n.body = body
+		return n, nil
+
+	case "function":
+		p.next()
+		name, ok := p.next().word.literal()
+		if !ok || len(name) == 0 {
+			return nil, fmt.Errorf("line %d: invalid function name", t.line)
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return &funcNode{name: name, body: body}, nil
+
+	case "menuentry", "submenu":
+		n := &menuNode{submenu: p.keyword() == "submenu", line: t.line}
+		p.next()
+		for p.peek().typ == tokWord {
+			n.args = append(n.args, p.next().word)
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		n.body = body
+		return n, nil
+	}
+
+	n := &cmdNode{line: t.line}
+	for {
+		t := p.peek()
+		if t.typ == tokWord {
+			n.words = append(n.words, t.word)
+		} else if t.typ == tokLBrace {
+			// A '{' that does not start a block is just a word.
+			n.words = append(n.words, word{{text: "{"}})
+		} else {
+			break
+		}
+		p.next()
+	}
+	return n, nil
+}
+
+func (p *scriptParser) ifCommand() (node, error) {
+	n := &ifNode{}
+	// Consume "if" or "elif".
+	p.next()
+	for {
+		cond, err := p.list("then")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.list("elif", "else", "fi")
+		if err != nil {
+			return nil, err
+		}
+		n.conds = append(n.conds, cond)
+		n.bodies = append(n.bodies, body)
+
+		p.skipNewlines()
+		switch p.keyword() {
+		case "elif":
+			p.next()
+			continue
+
+		case "else":
+			p.next()
+			n.orElse, err = p.list("fi")
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("fi"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+}
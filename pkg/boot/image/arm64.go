@@ -0,0 +1,98 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package image parses kernel image headers that are not x86 bzImages.
+package image
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Arm64Magic is the magic number of the arm64 Image header, "ARM\x64".
+const Arm64Magic = 0x644d5241
+
+// arm64DefaultTextOffset is the text offset of kernels older than 3.17,
+// which have an image size of zero.
+const arm64DefaultTextOffset = 0x80000
+
+// ErrNotArm64Image is returned for files without an arm64 Image header.
+var ErrNotArm64Image = errors.New("not an arm64 Image")
+
+// Arm64Header is the header of an arm64 Linux Image.
+//
+// The format is described in
+// https://www.kernel.org/doc/html/latest/arm64/booting.html.
+type Arm64Header struct {
+	Code0      uint32
+	Code1      uint32
+	TextOffset uint64
+	ImageSize  uint64
+	Flags      uint64
+	Res2       uint64
+	Res3       uint64
+	Res4       uint64
+	Magic      uint32
+	Res5       uint32
+}
+
+// Arm64PageSize is the kernel page size given in the header flags.
+type Arm64PageSize uint8
+
+// Page sizes in the header flags.
+const (
+	Arm64PageSizeUnspecified Arm64PageSize = 0
+	Arm64PageSize4K          Arm64PageSize = 1
+	Arm64PageSize16K         Arm64PageSize = 2
+	Arm64PageSize64K         Arm64PageSize = 3
+)
+
+// String implements fmt.Stringer.
+func (p Arm64PageSize) String() string {
+	switch p {
+	case Arm64PageSize4K:
+		return "4K"
+	case Arm64PageSize16K:
+		return "16K"
+	case Arm64PageSize64K:
+		return "64K"
+	}
+	return "unspecified"
+}
+
+// ParseArm64Header reads the header of an arm64 Image.
+func ParseArm64Header(r io.ReaderAt) (*Arm64Header, error) {
+	var h Arm64Header
+	if err := binary.Read(io.NewSectionReader(r, 0, int64(binary.Size(h))), binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotArm64Image, err)
+	}
+	if h.Magic != Arm64Magic {
+		return nil, ErrNotArm64Image
+	}
+	// Kernels before 3.17 do not give the image size, and always have
+	// the same text offset.
+	if h.ImageSize == 0 {
+		h.TextOffset = arm64DefaultTextOffset
+	}
+	return &h, nil
+}
+
+// BigEndian returns whether the kernel is big-endian.
+func (h *Arm64Header) BigEndian() bool {
+	return h.Flags&(1<<0) != 0
+}
+
+// PageSize returns the kernel's page size.
+func (h *Arm64Header) PageSize() Arm64PageSize {
+	return Arm64PageSize(h.Flags >> 1 & 0x3)
+}
+
+// PlaceAnywhere returns whether the 2MiB aligned base of the kernel may be
+// anywhere in physical memory, rather than as close as possible to the
+// start of DRAM.
+func (h *Arm64Header) PlaceAnywhere() bool {
+	return h.Flags&(1<<3) != 0
+}
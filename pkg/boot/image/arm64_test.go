@@ -0,0 +1,74 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func marshal(h Arm64Header) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, h)
+	return b.Bytes()
+}
+
+func TestParseArm64Header(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		image         []byte
+		want          *Arm64Header
+		err           error
+		pageSize      Arm64PageSize
+		placeAnywhere bool
+	}{
+		{
+			name:          "5.x",
+			image:         marshal(Arm64Header{ImageSize: 0x2000000, Flags: 0xa, Magic: Arm64Magic}),
+			want:          &Arm64Header{ImageSize: 0x2000000, Flags: 0xa, Magic: Arm64Magic},
+			pageSize:      Arm64PageSize4K,
+			placeAnywhere: true,
+		},
+		{
+			name:  "pre-3.17",
+			image: marshal(Arm64Header{TextOffset: 0x1234, Magic: Arm64Magic}),
+			want:  &Arm64Header{TextOffset: 0x80000, Magic: Arm64Magic},
+		},
+		{
+			name:  "bad magic",
+			image: marshal(Arm64Header{ImageSize: 0x2000000, Magic: 0x12345678}),
+			err:   ErrNotArm64Image,
+		},
+		{
+			name:  "short",
+			image: []byte("MZ"),
+			err:   ErrNotArm64Image,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := ParseArm64Header(bytes.NewReader(tt.image))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseArm64Header() = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if *h != *tt.want {
+				t.Errorf("ParseArm64Header() = %+v, want %+v", h, tt.want)
+			}
+			if h.BigEndian() {
+				t.Errorf("BigEndian() = true")
+			}
+			if h.PageSize() != tt.pageSize {
+				t.Errorf("PageSize() = %s, want %s", h.PageSize(), tt.pageSize)
+			}
+			if h.PlaceAnywhere() != tt.placeAnywhere {
+				t.Errorf("PlaceAnywhere() = %t, want %t", h.PlaceAnywhere(), tt.placeAnywhere)
+			}
+		})
+	}
+}
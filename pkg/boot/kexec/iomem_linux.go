@@ -0,0 +1,85 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var iomemPath = "/proc/iomem"
+
+// ParseIOMem reads the physical memory map from /proc/iomem.
+//
+// Unlike ParseMemoryMap, it works on architectures without a firmware
+// memory map, like arm64. Only RAM and reserved ranges are returned; memory
+// reserved within RAM, e.g. for firmware or by the device tree, is
+// reserved in the returned map.
+func ParseIOMem() (MemoryMap, error) {
+	f, err := os.Open(iomemPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseIOMem(f)
+}
+
+func parseIOMem(r io.Reader) (MemoryMap, error) {
+	var m MemoryMap
+	var reserved []Range
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		// Lines look like
+		//
+		//   40000000-bfffffff : System RAM
+		//
+		// with child resources indented.
+		i := strings.Index(line, " : ")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid iomem line %q", line)
+		}
+		addrs, name := strings.TrimSpace(line[:i]), line[i+3:]
+		toplevel := !strings.HasPrefix(line, " ")
+
+		typ, ok := sysfsToRangeType[name]
+		if !ok || (!toplevel && typ != RangeReserved) {
+			continue
+		}
+
+		j := strings.Index(addrs, "-")
+		if j < 0 {
+			return nil, fmt.Errorf("invalid iomem range %q", addrs)
+		}
+		start, err := strconv.ParseUint(addrs[:j], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		end, err := strconv.ParseUint(addrs[j+1:], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		// The end address is inclusive.
+		rng := RangeFromInterval(uintptr(start), uintptr(end+1))
+		if toplevel {
+			m = append(m, TypedRange{Range: rng, Type: typ})
+		} else {
+			reserved = append(reserved, rng)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, r := range reserved {
+		m.Insert(TypedRange{Range: r, Type: RangeReserved})
+	}
+	m.sort()
+	return m, nil
+}
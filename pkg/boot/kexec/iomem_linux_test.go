@@ -0,0 +1,42 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIOMem(t *testing.T) {
+	iomem := `09000000-09000fff : pl011@9000000
+  09000000-09000fff : pl011@9000000
+09010000-09010fff : pl031@9010000
+40000000-bfffffff : System RAM
+  40080000-40f1ffff : Kernel code
+  40f20000-4120ffff : reserved
+  41210000-4170ffff : Kernel data
+  bffff000-bfffffff : reserved
+c0000000-c00fffff : reserved
+`
+	got, err := parseIOMem(strings.NewReader(iomem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MemoryMap{
+		{Range: RangeFromInterval(0x40000000, 0x40f20000), Type: RangeRAM},
+		{Range: RangeFromInterval(0x40f20000, 0x41210000), Type: RangeReserved},
+		{Range: RangeFromInterval(0x41210000, 0xbffff000), Type: RangeRAM},
+		{Range: RangeFromInterval(0xbffff000, 0xc0000000), Type: RangeReserved},
+		{Range: RangeFromInterval(0xc0000000, 0xc0100000), Type: RangeReserved},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIOMem() = %v, want %v", got, want)
+	}
+
+	if _, err := parseIOMem(strings.NewReader("40000000-bfffffff System RAM\n")); err == nil {
+		t.Errorf("parseIOMem() of invalid line succeeded")
+	}
+}
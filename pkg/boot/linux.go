@@ -5,14 +5,20 @@
 package boot
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"runtime"
+	"syscall"
 
+	"github.com/u-root/u-root/pkg/boot/fit"
 	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/boot/linux"
 	"github.com/u-root/u-root/pkg/uio"
 )
 
@@ -23,6 +29,10 @@ type LinuxImage struct {
 	Kernel  io.ReaderAt
 	Initrd  io.ReaderAt
 	Cmdline string
+
+	// DTB is the device tree passed to arm64 kernels. If it is nil, the
+	// running kernel's device tree is passed on.
+	DTB io.ReaderAt
 }
 
 var _ OSImage = &LinuxImage{}
@@ -109,6 +119,29 @@ func (li *LinuxImage) Load(verbose bool) error {
 	}
 	defer k.Close()
 
+	// An initramfs given with the kernel replaces a FIT image's own, so
+	// that is only extracted if there is none.
+	uk, fitInitrd, dtb, err := unpackKernel(k, li.Initrd == nil)
+	if err != nil {
+		return err
+	}
+	if uk != k {
+		defer uk.Close()
+		k = uk
+	}
+	if fitInitrd != nil {
+		defer fitInitrd.Close()
+	}
+	if li.DTB != nil {
+		dtb = li.DTB
+	}
+	if dtb != nil && (runtime.GOARCH == "amd64" || runtime.GOARCH == "386") {
+		// x86 kernels do not take a device tree, but configs shared
+		// with other architectures may name one.
+		log.Printf("Ignoring device tree on %s", runtime.GOARCH)
+		dtb = nil
+	}
+
 	var i *os.File
 	if li.Initrd != nil {
 		i, err = copyToFile(initrd)
@@ -116,6 +149,8 @@ func (li *LinuxImage) Load(verbose bool) error {
 			return err
 		}
 		defer i.Close()
+	} else {
+		i = fitInitrd
 	}
 
 	log.Printf("Kernel: %s", k.Name())
@@ -123,5 +158,89 @@ func (li *LinuxImage) Load(verbose bool) error {
 		log.Printf("Initrd: %s", i.Name())
 	}
 	log.Printf("Command line: %s", li.Cmdline)
-	return kexec.FileLoad(k, i, li.Cmdline)
+
+	// kexec_file_load cannot be given a device tree.
+	if dtb != nil {
+		return linux.KexecLoad(k, i, li.Cmdline, dtb)
+	}
+	err = kexec.FileLoad(k, i, li.Cmdline)
+	if !fileLoadUnavailable(err) {
+		return err
+	}
+
+	// Load the kernel ourselves. The files were read by kexec_file_load,
+	// so rewind them.
+	log.Printf("kexec_file_load failed (%v), falling back to kexec_load", err)
+	if _, err := k.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if i != nil {
+		if _, err := i.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return linux.KexecLoad(k, i, li.Cmdline, nil)
+}
+
+// unpackKernel turns kernels kexec cannot load as they are into ones it
+// can: a FIT image is split into the kernel, initramfs and device tree of
+// its default configuration, and a gzip-compressed arm64 Image is
+// decompressed. Other kernels are returned as they are.
+//
+// initrd and dtb are nil unless k is a FIT image that has them. The FIT
+// image's initrd is only extracted if withInitrd is true.
+func unpackKernel(k *os.File, withInitrd bool) (kernel, initrd *os.File, dtb io.ReaderAt, err error) {
+	magic := make([]byte, 4)
+	if _, err := k.ReadAt(magic, 0); err != nil {
+		// Too short to be anything but a kernel.
+		return k, nil, nil, nil
+	}
+
+	switch {
+	case fit.IsFIT(magic):
+		b, err := ioutil.ReadAll(io.NewSectionReader(k, 0, 1<<62))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		f, err := fit.Parse(b)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		kb, rb, db, err := f.Load("")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if kernel, err = copyToFile(bytes.NewReader(kb)); err != nil {
+			return nil, nil, nil, err
+		}
+		if rb != nil && withInitrd {
+			if initrd, err = copyToFile(bytes.NewReader(rb)); err != nil {
+				kernel.Close()
+				os.Remove(kernel.Name())
+				return nil, nil, nil, err
+			}
+		}
+		if db != nil {
+			dtb = bytes.NewReader(db)
+		}
+		return kernel, initrd, dtb, nil
+
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		z, err := gzip.NewReader(io.NewSectionReader(k, 0, 1<<62))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if kernel, err = copyToFile(z); err != nil {
+			return nil, nil, nil, err
+		}
+		return kernel, nil, nil, nil
+	}
+	return k, nil, nil, nil
+}
+
+// fileLoadUnavailable returns whether err means kexec_file_load cannot load
+// this kernel at all: either the syscall does not exist, or it is not
+// allowed to load unsigned kernels.
+func fileLoadUnavailable(err error) bool {
+	return errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EKEYREJECTED)
 }
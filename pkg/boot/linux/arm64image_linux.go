@@ -0,0 +1,159 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/u-root/u-root/pkg/boot/image"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+const (
+	// arm64KernelAlign is the alignment of the arm64 kernel's base
+	// address. The kernel starts TextOffset bytes after it.
+	arm64KernelAlign = 2 << 20
+
+	// arm64MaxDTBSize is the maximum size of the device tree.
+	arm64MaxDTBSize = 2 << 20
+)
+
+// arm64Purgatory is the arm64 code kexec jumps to. It jumps to the kernel
+// with the device tree address in x0 and x1-x3 zeroed, as the boot protocol
+// requires.
+var arm64Purgatory = []byte{
+	0xc0, 0x00, 0x00, 0x58, // ldr x0, dtb
+	0xe1, 0x03, 0x1f, 0xaa, // mov x1, xzr
+	0xe2, 0x03, 0x1f, 0xaa, // mov x2, xzr
+	0xe3, 0x03, 0x1f, 0xaa, // mov x3, xzr
+	0x84, 0x00, 0x00, 0x58, // ldr x4, kernel
+	0x80, 0x00, 0x1f, 0xd6, // br x4
+	0, 0, 0, 0, 0, 0, 0, 0, // dtb: .quad
+	0, 0, 0, 0, 0, 0, 0, 0, // kernel: .quad
+}
+
+// Offsets of the values patched into the arm64 purgatory.
+const (
+	arm64PurgatoryDTBOff    = 24
+	arm64PurgatoryKernelOff = 32
+)
+
+// newArm64Purgatory returns a copy of the arm64 purgatory that jumps to
+// entry with the given device tree.
+func newArm64Purgatory(entry, dtb uintptr) []byte {
+	p := append([]byte(nil), arm64Purgatory...)
+	binary.LittleEndian.PutUint64(p[arm64PurgatoryDTBOff:], uint64(dtb))
+	binary.LittleEndian.PutUint64(p[arm64PurgatoryKernelOff:], uint64(entry))
+	return p
+}
+
+// loadArm64Image lays out the arm64 Image kernel, its initrd, the device
+// tree with the command line and initrd added to /chosen, and a purgatory
+// that jumps to the kernel, in the physical memory described by phys.
+//
+// It returns the kexec segments and the purgatory's entry point.
+//
+// The boot protocol is described in
+// https://www.kernel.org/doc/html/latest/arm64/booting.html.
+func loadArm64Image(kernel, initrd []byte, cmdline string, fdt *dt.FDT, phys kexec.MemoryMap) (kexec.Segments, uintptr, error) {
+	h, err := image.ParseArm64Header(bytes.NewReader(kernel))
+	if err != nil {
+		return nil, 0, err
+	}
+	if h.BigEndian() {
+		return nil, 0, fmt.Errorf("big-endian arm64 kernels are not supported")
+	}
+
+	mem := &kexec.Memory{Phys: phys}
+	anywhere := kexec.RangeFromInterval(0, kexec.MaxAddr)
+
+	// ImageSize includes the BSS. Kernels that don't give it are
+	// loaded as they are.
+	size := uint(h.ImageSize)
+	if size < uint(len(kernel)) {
+		size = uint(len(kernel))
+	}
+	// Lowest is as close as possible to the start of DRAM, as kernels
+	// that can't be placed anywhere want.
+	base, err := findAligned(mem, uint(h.TextOffset)+size, arm64KernelAlign, anywhere)
+	if err != nil {
+		return nil, 0, fmt.Errorf("kernel: %v", err)
+	}
+	kernelRange := kexec.Range{Start: base.Start + uintptr(h.TextOffset), Size: size}
+	mem.Segments.Insert(kexec.NewSegment(kernel, kernelRange))
+
+	var initrdRange *kexec.Range
+	if len(initrd) > 0 {
+		r, err := addSegment(mem, initrd, anywhere)
+		if err != nil {
+			return nil, 0, fmt.Errorf("initrd: %v", err)
+		}
+		r.Size = uint(len(initrd))
+		initrdRange = &r
+	}
+
+	if err := updateChosen(fdt, cmdline, initrdRange); err != nil {
+		return nil, 0, err
+	}
+	var b bytes.Buffer
+	if _, err := fdt.Write(&b); err != nil {
+		return nil, 0, fmt.Errorf("device tree: %v", err)
+	}
+	if b.Len() > arm64MaxDTBSize {
+		return nil, 0, fmt.Errorf("device tree is %d bytes, the maximum is %d", b.Len(), arm64MaxDTBSize)
+	}
+	dtbRange, err := addSegment(mem, b.Bytes(), anywhere)
+	if err != nil {
+		return nil, 0, fmt.Errorf("device tree: %v", err)
+	}
+
+	p := newArm64Purgatory(kernelRange.Start, dtbRange.Start)
+	purgRange, err := addSegment(mem, p, anywhere)
+	if err != nil {
+		return nil, 0, fmt.Errorf("purgatory: %v", err)
+	}
+	return mem.Segments, purgRange.Start, nil
+}
+
+// updateChosen sets the command line and initrd in the /chosen node of fdt.
+func updateChosen(fdt *dt.FDT, cmdline string, initrd *kexec.Range) error {
+	if fdt.RootNode == nil {
+		return fmt.Errorf("device tree has no root node")
+	}
+	chosen, ok := fdt.RootNode.Child("chosen")
+	if !ok {
+		chosen = &dt.Node{Name: "chosen"}
+		if err := fdt.RootNode.AddChild(chosen); err != nil {
+			return err
+		}
+	}
+
+	chosen.SetString("bootargs", cmdline)
+	if initrd != nil {
+		chosen.SetU64("linux,initrd-start", uint64(initrd.Start))
+		chosen.SetU64("linux,initrd-end", uint64(initrd.End()))
+	} else {
+		chosen.RemoveProperty("linux,initrd-start")
+		chosen.RemoveProperty("linux,initrd-end")
+	}
+
+	// These describe a crash kernel's environment, not ours.
+	chosen.RemoveProperty("linux,elfcorehdr")
+	chosen.RemoveProperty("linux,usable-memory-range")
+
+	// The running kernel wiped the seed it booted with.
+	if _, ok := chosen.LookProperty("kaslr-seed"); ok {
+		var seed uint64
+		if err := binary.Read(rand.Reader, binary.BigEndian, &seed); err != nil {
+			return err
+		}
+		chosen.SetU64("kaslr-seed", seed)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot/image"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+func testArm64Kernel(h image.Arm64Header, code []byte) []byte {
+	h.Magic = image.Arm64Magic
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, h)
+	return append(b.Bytes(), code...)
+}
+
+func testFDT(chosen ...dt.Property) *dt.FDT {
+	return &dt.FDT{
+		Header: dt.Header{
+			Magic:           dt.Magic,
+			Version:         17,
+			LastCompVersion: 16,
+		},
+		RootNode: &dt.Node{
+			Children: []*dt.Node{
+				{Name: "chosen", Properties: chosen},
+			},
+		},
+	}
+}
+
+func TestLoadArm64Image(t *testing.T) {
+	phys := kexec.MemoryMap{
+		{Range: kexec.Range{Start: 0x40000000, Size: 0x80000}, Type: kexec.RangeReserved},
+		{Range: kexec.Range{Start: 0x40080000, Size: 0x3ff80000}, Type: kexec.RangeRAM},
+	}
+	kernel := testArm64Kernel(image.Arm64Header{TextOffset: 0x80000, ImageSize: 0x1000000, Flags: 0xa}, []byte("kernel code"))
+	initrd := []byte("070701 initramfs")
+	cmdline := "console=ttyAMA0"
+	fdt := testFDT(
+		dt.Property{Name: "kaslr-seed", Value: make([]byte, 8)},
+		dt.Property{Name: "linux,elfcorehdr", Value: make([]byte, 16)},
+	)
+
+	segs, entry, err := loadArm64Image(kernel, initrd, cmdline, fdt, phys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 4 {
+		t.Fatalf("got %d segments, want kernel, initrd, device tree and purgatory: %v", len(segs), segs)
+	}
+	for i, s := range segs {
+		if s.Phys.Start%0x1000 != 0 {
+			t.Errorf("segment %v is not page aligned", s)
+		}
+		if i > 0 && segs[i-1].Phys.End() > s.Phys.Start {
+			t.Errorf("segments %v and %v overlap", segs[i-1], s)
+		}
+	}
+
+	// The first 2M aligned base in RAM is 0x40200000, as the 2M region
+	// at 0x40000000 starts with reserved memory.
+	k, err := findSegment(segs, 0x40280000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Phys.Size != 0x1000000 || !bytes.Equal(segmentData(k), kernel) {
+		t.Errorf("kernel segment is %v, want the kernel with 0x1000000 bytes", k)
+	}
+
+	purg, err := findSegment(segs, uint64(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := segmentData(purg)
+	if got := binary.LittleEndian.Uint64(p[arm64PurgatoryKernelOff:]); got != 0x40280000 {
+		t.Errorf("purgatory jumps to %#x, want 0x40280000", got)
+	}
+	dtbSeg, err := findSegment(segs, binary.LittleEndian.Uint64(p[arm64PurgatoryDTBOff:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dt.ReadFDT(bytes.NewReader(segmentData(dtbSeg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chosen, ok := got.RootNode.Child("chosen")
+	if !ok {
+		t.Fatal("device tree has no /chosen")
+	}
+	if p, ok := chosen.LookProperty("bootargs"); !ok || string(p.Value) != cmdline+"\x00" {
+		t.Errorf("bootargs = %v, want %q", p, cmdline)
+	}
+	if _, ok := chosen.LookProperty("linux,elfcorehdr"); ok {
+		t.Errorf("linux,elfcorehdr was not removed")
+	}
+	if p, ok := chosen.LookProperty("kaslr-seed"); !ok || bytes.Equal(p.Value, make([]byte, 8)) {
+		t.Errorf("kaslr-seed = %v, want a new seed", p)
+	}
+
+	start, ok := chosen.LookProperty("linux,initrd-start")
+	if !ok {
+		t.Fatal("no linux,initrd-start")
+	}
+	end, ok := chosen.LookProperty("linux,initrd-end")
+	if !ok {
+		t.Fatal("no linux,initrd-end")
+	}
+	s, _ := start.AsU64()
+	e, _ := end.AsU64()
+	initrdSeg, err := findSegment(segs, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e-s != uint64(len(initrd)) || !bytes.Equal(segmentData(initrdSeg), initrd) {
+		t.Errorf("initrd [%#x, %#x) is not the initrd", s, e)
+	}
+}
+
+func TestLoadArm64ImageNoInitrd(t *testing.T) {
+	phys := kexec.MemoryMap{
+		{Range: kexec.Range{Start: 0x40000000, Size: 0x40000000}, Type: kexec.RangeRAM},
+	}
+	// Pre-3.17 kernels have no image size, and a fixed text offset.
+	kernel := testArm64Kernel(image.Arm64Header{}, []byte("kernel code"))
+	fdt := testFDT(
+		dt.Property{Name: "linux,initrd-start", Value: make([]byte, 8)},
+		dt.Property{Name: "linux,initrd-end", Value: make([]byte, 8)},
+	)
+	segs, _, err := loadArm64Image(kernel, nil, "", fdt, phys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findSegment(segs, 0x40080000); err != nil {
+		t.Error(err)
+	}
+	chosen, _ := fdt.RootNode.Child("chosen")
+	if _, ok := chosen.LookProperty("linux,initrd-start"); ok {
+		t.Errorf("stale linux,initrd-start was not removed")
+	}
+
+	// A device tree without /chosen gets one.
+	fdt = testFDT()
+	fdt.RootNode.Children = nil
+	if _, _, err := loadArm64Image(kernel, nil, "quiet", fdt, phys); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fdt.RootNode.Child("chosen"); !ok {
+		t.Errorf("no /chosen added")
+	}
+
+	if _, _, err := loadArm64Image([]byte("bzImage"), nil, "", testFDT(), phys); err == nil {
+		t.Errorf("loaded a kernel that is not an arm64 Image")
+	}
+}
+
+func TestArm64Purgatory(t *testing.T) {
+	// Check the literal loads against the patched offsets. LDR (literal)
+	// encodes the word offset from the instruction in bits 5-23.
+	for _, tt := range []struct {
+		insn int
+		off  int
+	}{
+		{0, arm64PurgatoryDTBOff},
+		{16, arm64PurgatoryKernelOff},
+	} {
+		i := binary.LittleEndian.Uint32(arm64Purgatory[tt.insn:])
+		if got := tt.insn + int(i>>5&0x7ffff)*4; got != tt.off {
+			t.Errorf("ldr at %d loads from %d, want %d", tt.insn, got, tt.off)
+		}
+	}
+	if len(arm64Purgatory) != arm64PurgatoryKernelOff+8 {
+		t.Errorf("purgatory is %d bytes, want %d", len(arm64Purgatory), arm64PurgatoryKernelOff+8)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package linux loads Linux kernels with kexec_load(2), for kernels that do
+// not support kexec_file_load(2) or refuse the image it is given, and for
+// arm64 kernels that must be given a device tree.
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/u-root/u-root/pkg/boot/bzimage"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+)
+
+// ErrNotBzImage is returned for kernels that are not bzImages.
+var ErrNotBzImage = errors.New("not a bzImage")
+
+const (
+	// zeroPageSize is the size of struct boot_params.
+	zeroPageSize = 4096
+
+	// setupHeaderOff is the offset of the setup header in both the
+	// bzImage and the zero page.
+	setupHeaderOff = 0x1f1
+
+	// setupHeaderMax is the end of the setup header as far as we know it.
+	setupHeaderMax = 0x268
+
+	// acpiRSDPAddrOff is the offset of acpi_rsdp_addr in the zero page.
+	acpiRSDPAddrOff = 0x70
+
+	// startup64Off is the 64-bit entry point's offset into the
+	// protected-mode kernel.
+	startup64Off = 0x200
+
+	// loaderTypeUndefined is the boot loader ID of loaders without an
+	// assigned ID.
+	loaderTypeUndefined = 0xff
+
+	// Boot protocol versions introducing the features we use.
+	protocolInitrdAddrMax = 0x203
+	protocolCmdLineSize   = 0x206
+	protocolXLoadFlags    = 0x20c
+	protocolACPIRSDPAddr  = 0x20e
+
+	// Bits in LinuxHeader.XLoadFlags.
+	xlfKernel64 = 1 << 0
+
+	// Bits in LinuxHeader.Loadflags.
+	loadedHigh = 1 << 0
+
+	// maxAddr32 limits everything the 32-bit boot parameters point to.
+	maxAddr32 = 1<<32 - 1
+)
+
+// getRSDPAddr returns the physical address of the ACPI RSDP, which kernels
+// booted on EFI systems cannot find otherwise. It is a variable so tests
+// can replace it.
+var getRSDPAddr = readRSDPAddr
+
+// loadBzImage lays out the 64-bit bzImage kernel, its initrd, command line
+// and zero page, and a purgatory that jumps to the kernel, in the physical
+// memory described by phys.
+//
+// It returns the kexec segments and the purgatory's entry point.
+//
+// The boot protocol is described in
+// https://www.kernel.org/doc/html/latest/x86/boot.html.
+func loadBzImage(kernel, initrd []byte, cmdline string, phys kexec.MemoryMap) (kexec.Segments, uintptr, error) {
+	var hdr bzimage.LinuxHeader
+	if err := binary.Read(bytes.NewReader(kernel), binary.LittleEndian, &hdr); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrNotBzImage, err)
+	}
+	if hdr.HeaderMagic != bzimage.HeaderMagic {
+		return nil, 0, ErrNotBzImage
+	}
+	if hdr.Protocolversion < protocolXLoadFlags || hdr.XLoadFlags&xlfKernel64 == 0 {
+		return nil, 0, fmt.Errorf("kernel with boot protocol %#x has no 64-bit entry point", hdr.Protocolversion)
+	}
+	if hdr.Loadflags&loadedHigh == 0 {
+		return nil, 0, fmt.Errorf("kernel is not a bzImage (zImages are not supported)")
+	}
+
+	mem := &kexec.Memory{Phys: phys}
+
+	// The protected-mode kernel follows the real-mode setup code.
+	setupSects := int(hdr.SetupSects)
+	if setupSects == 0 {
+		setupSects = 4
+	}
+	codeOff := (setupSects + 1) * 512
+	if codeOff >= len(kernel) {
+		return nil, 0, fmt.Errorf("kernel has %d setup sectors, but is only %d bytes", setupSects, len(kernel))
+	}
+	code := kernel[codeOff:]
+
+	// The kernel decompresses itself in place and needs InitSize bytes
+	// to do so.
+	size := uint(len(code))
+	if uint(hdr.InitSize) > size {
+		size = uint(hdr.InitSize)
+	}
+	kernelRange, err := placeKernel(mem, &hdr, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	mem.Segments.Insert(kexec.NewSegment(code, kernelRange))
+
+	if len(initrd) > 0 {
+		initrdMax := uintptr(bzimage.DefaultInitrdAddrMax)
+		if hdr.Protocolversion >= protocolInitrdAddrMax {
+			initrdMax = uintptr(hdr.InitrdAddrMax)
+		}
+		r, err := addSegment(mem, initrd, kexec.RangeFromInterval(kexec.M1, initrdMax+1))
+		if err != nil {
+			return nil, 0, fmt.Errorf("initrd: %v", err)
+		}
+		hdr.RamDiskImage = uint32(r.Start)
+		hdr.RamDiskSize = uint32(len(initrd))
+	}
+
+	cmdlineSize := bzimage.CommandLineSize - 1
+	if hdr.Protocolversion >= protocolCmdLineSize {
+		cmdlineSize = int(hdr.CmdLineSize)
+	}
+	if len(cmdline) > cmdlineSize {
+		return nil, 0, fmt.Errorf("command line is %d bytes, kernel supports %d", len(cmdline), cmdlineSize)
+	}
+	r, err := addSegment(mem, append([]byte(cmdline), 0), kexec.RangeFromInterval(kexec.M1, maxAddr32))
+	if err != nil {
+		return nil, 0, fmt.Errorf("command line: %v", err)
+	}
+	hdr.Cmdlineptr = uint32(r.Start)
+	hdr.TypeOfLoader = loaderTypeUndefined
+
+	zp, err := zeroPage(kernel, &hdr, phys)
+	if err != nil {
+		return nil, 0, err
+	}
+	zpRange, err := addSegment(mem, zp, kexec.RangeFromInterval(kexec.M1, maxAddr32))
+	if err != nil {
+		return nil, 0, fmt.Errorf("zero page: %v", err)
+	}
+
+	// The purgatory is patched with its own address, so reserve space
+	// first.
+	purgRange, err := findAligned(mem, uint(len(purgatory)), 0x1000, kexec.RangeFromInterval(kexec.M1, maxAddr32))
+	if err != nil {
+		return nil, 0, fmt.Errorf("purgatory: %v", err)
+	}
+	p := newPurgatory(purgRange.Start, kernelRange.Start+startup64Off, zpRange.Start)
+	mem.Segments.Insert(kexec.NewSegment(p, purgRange))
+	return mem.Segments, purgRange.Start, nil
+}
+
+// placeKernel finds size bytes for the protected-mode kernel: at its
+// preferred address if possible, anywhere suitably aligned if it is
+// relocatable.
+func placeKernel(mem *kexec.Memory, hdr *bzimage.LinuxHeader, size uint) (kexec.Range, error) {
+	pref := uintptr(hdr.PrefAddress)
+	if r, err := findAligned(mem, size, 1, kexec.Range{Start: pref, Size: size}); err == nil && r.Start == pref {
+		return r, nil
+	}
+	if hdr.RelocatableKernel == 0 {
+		return kexec.Range{}, fmt.Errorf("kernel is not relocatable and its address %#x is not available", pref)
+	}
+	align := uintptr(hdr.Kernelalignment)
+	if align == 0 {
+		align = 0x1000
+	}
+	r, err := findAligned(mem, size, align, kexec.RangeFromInterval(kexec.M1, maxAddr32))
+	if err != nil {
+		return kexec.Range{}, fmt.Errorf("kernel: %v", err)
+	}
+	return r, nil
+}
+
+// findAligned returns the first sz bytes of available RAM within limit that
+// start at a multiple of align.
+func findAligned(mem *kexec.Memory, sz uint, align uintptr, limit kexec.Range) (kexec.Range, error) {
+	for _, ram := range mem.AvailableRAM() {
+		r := ram.Intersect(limit)
+		if r == nil {
+			continue
+		}
+		start := (r.Start + align - 1) &^ (align - 1)
+		if start >= r.Start && start < r.End() && uint(r.End()-start) >= sz {
+			return kexec.Range{Start: start, Size: sz}, nil
+		}
+	}
+	return kexec.Range{}, kexec.ErrNotEnoughSpace{Size: sz}
+}
+
+// addSegment adds a page-aligned segment with d within limit.
+func addSegment(mem *kexec.Memory, d []byte, limit kexec.Range) (kexec.Range, error) {
+	r, err := findAligned(mem, uint(len(d)), 0x1000, limit)
+	if err != nil {
+		return kexec.Range{}, err
+	}
+	mem.Segments.Insert(kexec.NewSegment(d, r))
+	return r, nil
+}
+
+// zeroPage returns the boot parameters: the kernel's setup header as
+// modified in hdr, and the e820 memory map.
+func zeroPage(kernel []byte, hdr *bzimage.LinuxHeader, phys kexec.MemoryMap) ([]byte, error) {
+	var params bzimage.LinuxParams
+	if len(phys) > bzimage.E820Max {
+		return nil, fmt.Errorf("memory map has %d entries, boot parameters can hold %d", len(phys), bzimage.E820Max)
+	}
+	for i, r := range phys {
+		e := bzimage.E820Entry{
+			Addr:    uint64(r.Start),
+			Size:    uint64(r.Size),
+			MemType: bzimage.Reserved,
+		}
+		switch r.Type {
+		case kexec.RangeRAM:
+			e.MemType = bzimage.Ram
+		case kexec.RangeACPI:
+			e.MemType = bzimage.ACPI
+		case kexec.RangeNVS:
+			e.MemType = bzimage.NVS
+		}
+		params.E820Map[i] = e
+	}
+	params.E820MapNr = uint8(len(phys))
+
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, &params); err != nil {
+		return nil, err
+	}
+	zp := make([]byte, zeroPageSize)
+	copy(zp, b.Bytes())
+
+	// The setup header's length is given by the jump instruction at
+	// 0x200. Copy all of it, including fields we don't know about.
+	hdrEnd := 0x202 + int(kernel[0x201])
+	if hdrEnd > setupHeaderMax {
+		copy(zp[setupHeaderMax:], kernel[setupHeaderMax:hdrEnd])
+		hdrEnd = setupHeaderMax
+	}
+	b.Reset()
+	if err := binary.Write(&b, binary.LittleEndian, hdr); err != nil {
+		return nil, err
+	}
+	copy(zp[setupHeaderOff:hdrEnd], b.Bytes()[setupHeaderOff:])
+
+	if hdr.Protocolversion >= protocolACPIRSDPAddr {
+		if addr, err := getRSDPAddr(); err == nil {
+			binary.LittleEndian.PutUint64(zp[acpiRSDPAddrOff:], addr)
+		}
+	}
+	return zp, nil
+}
@@ -0,0 +1,287 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/u-root/u-root/pkg/boot/bzimage"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+)
+
+var testPhys = kexec.MemoryMap{
+	{Range: kexec.Range{Start: 0, Size: 0x9fc00}, Type: kexec.RangeRAM},
+	{Range: kexec.Range{Start: 0xf0000, Size: 0x10000}, Type: kexec.RangeReserved},
+	{Range: kexec.Range{Start: 0x100000, Size: 0x3ff00000}, Type: kexec.RangeRAM},
+	{Range: kexec.Range{Start: 0x40000000, Size: 0x100000}, Type: kexec.RangeACPI},
+}
+
+// testKernel returns a bzImage with a 2-sector setup and payload as
+// protected-mode code.
+func testKernel(modify func(h *bzimage.LinuxHeader), payload []byte) []byte {
+	h := bzimage.LinuxHeader{
+		SetupSects:        2,
+		Bootsectormagic:   0xaa55,
+		Jump:              0x66eb,
+		HeaderMagic:       bzimage.HeaderMagic,
+		Protocolversion:   0x20f,
+		Loadflags:         loadedHigh,
+		InitrdAddrMax:     0x7fffffff,
+		Kernelalignment:   0x200000,
+		RelocatableKernel: 1,
+		XLoadFlags:        xlfKernel64 | 2,
+		CmdLineSize:       2047,
+		PrefAddress:       0x1000000,
+		InitSize:          0x400000,
+	}
+	if modify != nil {
+		modify(&h)
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, &h)
+	k := make([]byte, 3*512)
+	copy(k, b.Bytes())
+	return append(k, payload...)
+}
+
+// segmentData returns the bytes of s.
+func segmentData(s kexec.Segment) []byte {
+	var data []byte
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&data))
+	sh.Data = s.Buf.Start
+	sh.Len = int(s.Buf.Size)
+	sh.Cap = int(s.Buf.Size)
+	return data
+}
+
+func findSegment(segs kexec.Segments, addr uint64) (kexec.Segment, error) {
+	for _, s := range segs {
+		if s.Phys.Start == uintptr(addr) {
+			return s, nil
+		}
+	}
+	return kexec.Segment{}, fmt.Errorf("no segment at %#x in %v", addr, segs)
+}
+
+func TestLoadBzImage(t *testing.T) {
+	defer func(old func() (uint64, error)) { getRSDPAddr = old }(getRSDPAddr)
+	getRSDPAddr = func() (uint64, error) { return 0xf5000, nil }
+
+	payload := bytes.Repeat([]byte("kernel"), 1000)
+	initrd := bytes.Repeat([]byte("initrd"), 1000)
+	cmdline := "console=ttyS0 earlyprintk=ttyS0"
+
+	segs, entry, err := loadBzImage(testKernel(nil, payload), initrd, cmdline, testPhys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 5 {
+		t.Fatalf("got %d segments, want kernel, initrd, command line, zero page and purgatory: %v", len(segs), segs)
+	}
+	for i, s := range segs {
+		if s.Phys.Start%0x1000 != 0 {
+			t.Errorf("segment %v is not page aligned", s)
+		}
+		if i > 0 && segs[i-1].Phys.End() > s.Phys.Start {
+			t.Errorf("segments %v and %v overlap", segs[i-1], s)
+		}
+		if s.Phys.Start < kexec.M1 || s.Phys.End() > 0x40000000 {
+			t.Errorf("segment %v is not in usable RAM", s)
+		}
+	}
+
+	// The kernel is at its preferred address and has room to decompress.
+	kernel, err := findSegment(segs, 0x1000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kernel.Phys != (kexec.Range{Start: 0x1000000, Size: 0x400000}) {
+		t.Errorf("kernel at %v, want [0x1000000, 0x1400000)", kernel.Phys)
+	}
+	if got := segmentData(kernel); !bytes.Equal(got, payload) {
+		t.Errorf("kernel segment does not contain the protected-mode code")
+	}
+
+	// The purgatory is the entry point.
+	purg, err := findSegment(segs, uint64(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := segmentData(purg)
+	zpAddr := binary.LittleEndian.Uint64(p[purgatoryZeroPageOff:])
+	if got := binary.LittleEndian.Uint64(p[purgatoryEntryOff:]); got != 0x1000200 {
+		t.Errorf("purgatory jumps to %#x, want startup_64 at 0x1000200", got)
+	}
+	if got, want := binary.LittleEndian.Uint64(p[purgatoryGDTBaseOff:]), uint64(entry+purgatoryGDTOff); got != want {
+		t.Errorf("purgatory GDT base is %#x, want %#x", got, want)
+	}
+
+	zpSeg, err := findSegment(segs, zpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zp := segmentData(zpSeg)
+	if len(zp) != zeroPageSize {
+		t.Fatalf("zero page is %d bytes, want %d", len(zp), zeroPageSize)
+	}
+	var params bzimage.LinuxParams
+	if err := binary.Read(bytes.NewReader(zp), binary.LittleEndian, &params); err != nil {
+		t.Fatal(err)
+	}
+
+	if params.Paramblocksignature != bzimage.HeaderMagic {
+		t.Errorf("zero page has no setup header")
+	}
+	if params.LoaderType != loaderTypeUndefined {
+		t.Errorf("loader type = %#x, want %#x", params.LoaderType, loaderTypeUndefined)
+	}
+	if got := binary.LittleEndian.Uint64(zp[acpiRSDPAddrOff:]); got != 0xf5000 {
+		t.Errorf("acpi_rsdp_addr = %#x, want 0xf5000", got)
+	}
+
+	initrdSeg, err := findSegment(segs, uint64(params.Initrdstart))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := segmentData(initrdSeg); !bytes.Equal(got, initrd) || params.Initrdsize != uint32(len(initrd)) {
+		t.Errorf("initrd at %#x (%d bytes) is not the initrd", params.Initrdstart, params.Initrdsize)
+	}
+
+	cmdlineSeg, err := findSegment(segs, uint64(params.CLPtr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(segmentData(cmdlineSeg)); got != cmdline+"\x00" {
+		t.Errorf("command line = %q, want %q", got, cmdline)
+	}
+
+	if params.E820MapNr != uint8(len(testPhys)) {
+		t.Fatalf("e820 has %d entries, want %d", params.E820MapNr, len(testPhys))
+	}
+	for i, want := range []bzimage.E820Entry{
+		{Addr: 0, Size: 0x9fc00, MemType: bzimage.Ram},
+		{Addr: 0xf0000, Size: 0x10000, MemType: bzimage.Reserved},
+		{Addr: 0x100000, Size: 0x3ff00000, MemType: bzimage.Ram},
+		{Addr: 0x40000000, Size: 0x100000, MemType: bzimage.ACPI},
+	} {
+		if params.E820Map[i] != want {
+			t.Errorf("e820[%d] = %+v, want %+v", i, params.E820Map[i], want)
+		}
+	}
+}
+
+func TestLoadBzImageRelocated(t *testing.T) {
+	// Something already occupies the preferred address, and low memory
+	// is too small.
+	phys := kexec.MemoryMap{
+		{Range: kexec.Range{Start: 0x100000, Size: 0x200000}, Type: kexec.RangeRAM},
+		{Range: kexec.Range{Start: 0x300000, Size: 0xd00000}, Type: kexec.RangeReserved},
+		{Range: kexec.Range{Start: 0x1000000, Size: 0x100000}, Type: kexec.RangeReserved},
+		{Range: kexec.Range{Start: 0x1100000, Size: 0x1000000}, Type: kexec.RangeRAM},
+	}
+	segs, _, err := loadBzImage(testKernel(nil, []byte("kernel")), nil, "", phys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first 2M aligned address with room after 16M.
+	if _, err := findSegment(segs, 0x1200000); err != nil {
+		t.Error(err)
+	}
+
+	_, _, err = loadBzImage(testKernel(func(h *bzimage.LinuxHeader) { h.RelocatableKernel = 0 }, []byte("kernel")), nil, "", phys)
+	if err == nil {
+		t.Errorf("loaded a non-relocatable kernel away from its address")
+	}
+}
+
+func TestLoadBzImageErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		kernel  []byte
+		cmdline string
+		want    string
+	}{
+		{
+			name:   "short",
+			kernel: []byte("kernel"),
+			want:   "not a bzImage",
+		},
+		{
+			name:   "bad magic",
+			kernel: testKernel(func(h *bzimage.LinuxHeader) { h.HeaderMagic = [4]byte{} }, []byte("kernel")),
+			want:   "not a bzImage",
+		},
+		{
+			name:   "32-bit",
+			kernel: testKernel(func(h *bzimage.LinuxHeader) { h.XLoadFlags = 0 }, []byte("kernel")),
+			want:   "no 64-bit entry point",
+		},
+		{
+			name:   "old protocol",
+			kernel: testKernel(func(h *bzimage.LinuxHeader) { h.Protocolversion = 0x20a }, []byte("kernel")),
+			want:   "no 64-bit entry point",
+		},
+		{
+			name:   "no protected-mode code",
+			kernel: testKernel(nil, nil),
+			want:   "setup sectors",
+		},
+		{
+			name:    "command line too long",
+			kernel:  testKernel(func(h *bzimage.LinuxHeader) { h.CmdLineSize = 10 }, []byte("kernel")),
+			cmdline: "console=ttyS0",
+			want:    "command line is 13 bytes",
+		},
+		{
+			name:   "no memory",
+			kernel: testKernel(func(h *bzimage.LinuxHeader) { h.InitSize = 0x80000000 }, []byte("kernel")),
+			want:   "kernel:",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := loadBzImage(tt.kernel, nil, tt.cmdline, testPhys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadBzImage() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := loadBzImage([]byte("kernel"), nil, "", testPhys); !errors.Is(err, ErrNotBzImage) {
+		t.Errorf("loadBzImage() = %v, want %v", err, ErrNotBzImage)
+	}
+}
+
+func TestPurgatory(t *testing.T) {
+	// Check the hand-assembled offsets against the code.
+	if len(purgatory) != purgatoryGDTBaseOff+8 {
+		t.Errorf("purgatory is %d bytes, want %d", len(purgatory), purgatoryGDTBaseOff+8)
+	}
+	for _, tt := range []struct {
+		off    int
+		opcode []byte
+	}{
+		{purgatoryZeroPageOff - 2, []byte{0x48, 0xbe}},
+		{purgatoryEntryOff - 2, []byte{0x48, 0xb8}},
+		{purgatoryGDTBaseOff - 2, []byte{0x1f, 0x00}},
+	} {
+		if got := purgatory[tt.off : tt.off+2]; !bytes.Equal(got, tt.opcode) {
+			t.Errorf("purgatory[%d:] = %x, want %x", tt.off, got, tt.opcode)
+		}
+	}
+	// lgdt is RIP-relative to the next instruction.
+	if rel := binary.LittleEndian.Uint32(purgatory[4:]); 8+int(rel) != purgatoryGDTBaseOff-2 {
+		t.Errorf("lgdt points to %d, want gdtr at %d", 8+rel, purgatoryGDTBaseOff-2)
+	}
+	if gdt := binary.LittleEndian.Uint64(purgatory[purgatoryGDTOff+0x10:]); gdt != 0x00af9a000000ffff {
+		t.Errorf("__BOOT_CS = %#x", gdt)
+	}
+}
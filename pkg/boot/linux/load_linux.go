@@ -0,0 +1,18 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"github.com/u-root/u-root/pkg/acpi"
+)
+
+// readRSDPAddr returns the physical address of the ACPI RSDP.
+func readRSDPAddr() (uint64, error) {
+	r, err := acpi.GetRSDP()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(r.RSDPAddr()), nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/u-root/u-root/pkg/boot/kexec"
+)
+
+// KexecLoad loads a bzImage kernel with its initramfs and command line
+// using kexec_load(2).
+//
+// ramfs may be nil. dtb must be nil; x86 kernels do not take a device tree.
+func KexecLoad(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt) error {
+	if dtb != nil {
+		return errors.New("device trees are not supported on x86")
+	}
+	k, err := ioutil.ReadAll(kernel)
+	if err != nil {
+		return err
+	}
+	var initrd []byte
+	if ramfs != nil {
+		if initrd, err = ioutil.ReadAll(ramfs); err != nil {
+			return err
+		}
+	}
+
+	phys, err := kexec.ParseMemoryMap()
+	if err != nil {
+		return err
+	}
+	segments, entry, err := loadBzImage(k, initrd, cmdline, phys)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("kexec_load entry point: %#x", entry)
+	log.Printf("kexec_load segments: %s", segments)
+	return kexec.Load(entry, segments, 0)
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/dt"
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// currentDTB is the device tree the running kernel was booted with.
+const currentDTB = "/sys/firmware/fdt"
+
+// KexecLoad loads an arm64 Image kernel with its initramfs, command line
+// and device tree using kexec_load(2).
+//
+// ramfs may be nil. If dtb is nil, the device tree the running kernel was
+// booted with is used.
+func KexecLoad(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt) error {
+	k, err := ioutil.ReadAll(kernel)
+	if err != nil {
+		return err
+	}
+	var initrd []byte
+	if ramfs != nil {
+		if initrd, err = ioutil.ReadAll(ramfs); err != nil {
+			return err
+		}
+	}
+
+	var d []byte
+	if dtb != nil {
+		d, err = uio.ReadAll(dtb)
+	} else {
+		d, err = ioutil.ReadFile(currentDTB)
+	}
+	if err != nil {
+		return err
+	}
+	fdt, err := dt.ReadFDT(bytes.NewReader(d))
+	if err != nil {
+		return err
+	}
+
+	phys, err := kexec.ParseIOMem()
+	if err != nil {
+		return err
+	}
+	segments, entry, err := loadArm64Image(k, initrd, cmdline, fdt, phys)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("kexec_load entry point: %#x", entry)
+	log.Printf("kexec_load segments: %s", segments)
+	return kexec.Load(entry, segments, 0)
+}
@@ -0,0 +1,18 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !amd64,!arm64
+
+package linux
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// KexecLoad is only implemented for x86-64 bzImages and arm64 Images.
+func KexecLoad(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt) error {
+	return syscall.ENOSYS
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"encoding/binary"
+)
+
+// purgatory is the x86-64 code kexec jumps to. kexec enters it in 64-bit
+// mode with identity-mapped page tables; it sets up the segments the 64-bit
+// boot protocol requires and jumps to the kernel with the zero page address
+// in RSI.
+var purgatory = []byte{
+	0xfa,                                     // cli
+	0x0f, 0x01, 0x15, 0x58, 0x00, 0x00, 0x00, // lgdt gdtr(%rip)
+	0xb8, 0x18, 0x00, 0x00, 0x00, // mov $0x18, %eax
+	0x8e, 0xd8, // mov %eax, %ds
+	0x8e, 0xc0, // mov %eax, %es
+	0x8e, 0xd0, // mov %eax, %ss
+	0x8e, 0xe0, // mov %eax, %fs
+	0x8e, 0xe8, // mov %eax, %gs
+
+	// Reload CS with a far return to the next instruction.
+	0x48, 0x8d, 0x05, 0x05, 0x00, 0x00, 0x00, // lea 1f(%rip), %rax
+	0x6a, 0x10, // push $0x10
+	0x50,       // push %rax
+	0x48, 0xcb, // lretq
+
+	// 1:
+	0x48, 0xbe, 0, 0, 0, 0, 0, 0, 0, 0, // movabs $zeropage, %rsi
+	0x48, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, // movabs $entry, %rax
+	0x31, 0xed, // xor %ebp, %ebp
+	0x31, 0xff, // xor %edi, %edi
+	0x31, 0xdb, // xor %ebx, %ebx
+	0xff, 0xe0, // jmp *%rax
+	0x00, // padding
+
+	// gdt: the boot protocol wants __BOOT_CS at 0x10 and __BOOT_DS
+	// at 0x18.
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0xaf, 0x00, // 64-bit code
+	0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0xcf, 0x00, // data
+
+	// gdtr
+	0x1f, 0x00, // limit
+	0, 0, 0, 0, 0, 0, 0, 0, // base
+}
+
+// Offsets of the values patched into the purgatory.
+const (
+	purgatoryZeroPageOff = 37
+	purgatoryEntryOff    = 47
+	purgatoryGDTOff      = 64
+	purgatoryGDTBaseOff  = 98
+)
+
+// newPurgatory returns a copy of the purgatory to be loaded at addr that
+// jumps to entry with the given zero page.
+func newPurgatory(addr, entry, zeroPage uintptr) []byte {
+	p := append([]byte(nil), purgatory...)
+	binary.LittleEndian.PutUint64(p[purgatoryZeroPageOff:], uint64(zeroPage))
+	binary.LittleEndian.PutUint64(p[purgatoryEntryOff:], uint64(entry))
+	binary.LittleEndian.PutUint64(p[purgatoryGDTBaseOff:], uint64(addr+purgatoryGDTOff))
+	return p
+}
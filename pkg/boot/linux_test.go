@@ -5,7 +5,10 @@
 package boot
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
@@ -13,6 +16,7 @@ import (
 	"testing"
 
 	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/dt"
 	"github.com/u-root/u-root/pkg/uio"
 	"github.com/u-root/u-root/pkg/vfile"
 )
@@ -104,3 +108,115 @@ func TestLinuxLabel(t *testing.T) {
 		})
 	}
 }
+
+func TestUnpackKernel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := func(name string, b []byte) *os.File {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	contents := func(f *os.File) string {
+		b, err := ioutil.ReadAll(io.NewSectionReader(f, 0, 1<<62))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	plain := file("bzImage", []byte("MZ kernel"))
+	k, i, d, err := unpackKernel(plain, true)
+	if err != nil || k != plain || i != nil || d != nil {
+		t.Errorf("unpackKernel(plain) = %v, %v, %v, %v, want the kernel as it is", k, i, d, err)
+	}
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("arm64 Image"))
+	w.Close()
+	k, _, _, err = unpackKernel(file("Image.gz", gz.Bytes()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(k); got != "arm64 Image" {
+		t.Errorf("unpackKernel(Image.gz) = %q, want %q", got, "arm64 Image")
+	}
+
+	image := func(name, typ, data string) *dt.Node {
+		return &dt.Node{
+			Name: name,
+			Properties: []dt.Property{
+				{Name: "type", Value: []byte(typ + "\x00")},
+				{Name: "data", Value: []byte(data)},
+			},
+		}
+	}
+	fdt := &dt.FDT{
+		Header: dt.Header{Magic: dt.Magic, Version: 17, LastCompVersion: 16},
+		RootNode: &dt.Node{
+			Children: []*dt.Node{
+				{
+					Name: "images",
+					Children: []*dt.Node{
+						image("kernel", "kernel", "fit kernel"),
+						image("ramdisk", "ramdisk", "fit ramdisk"),
+						image("fdt", "flat_dt", "fit dtb"),
+					},
+				},
+				{
+					Name:       "configurations",
+					Properties: []dt.Property{{Name: "default", Value: []byte("conf\x00")}},
+					Children: []*dt.Node{
+						{
+							Name: "conf",
+							Properties: []dt.Property{
+								{Name: "kernel", Value: []byte("kernel\x00")},
+								{Name: "ramdisk", Value: []byte("ramdisk\x00")},
+								{Name: "fdt", Value: []byte("fdt\x00")},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	var itb bytes.Buffer
+	if _, err := fdt.Write(&itb); err != nil {
+		t.Fatal(err)
+	}
+	k, i, d, err = unpackKernel(file("image.itb", itb.Bytes()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i == nil || d == nil {
+		t.Fatalf("unpackKernel(FIT) = %v, %v, %v, want kernel, initrd and device tree", k, i, d)
+	}
+	dtb, err := uio.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents(k) != "fit kernel" || contents(i) != "fit ramdisk" || string(dtb) != "fit dtb" {
+		t.Errorf("unpackKernel(FIT) = %q, %q, %q", contents(k), contents(i), dtb)
+	}
+
+	// An initrd given separately replaces the FIT image's, which is not
+	// extracted then.
+	k, i, d, err = unpackKernel(file("image.itb", itb.Bytes()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != nil || d == nil {
+		t.Errorf("unpackKernel(FIT, false) = %v, %v, %v, want kernel and device tree", k, i, d)
+	}
+}
@@ -7,10 +7,6 @@ package localboot
 
 import (
 	"context"
-	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 
 	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/boot/bls"
@@ -23,13 +19,16 @@ import (
 )
 
 // parse treats device as a block device with a file system.
-func parse(l ulog.Logger, device *block.BlockDev, mountDir string) []boot.OSImage {
+//
+// devices and mountPool are used to find and mount other partitions that
+// configs refer to.
+func parse(l ulog.Logger, device *block.BlockDev, devices block.BlockDevices, mountDir string, mountPool *mount.Pool) []boot.OSImage {
 	imgs, err := bls.ScanBLSEntries(l, mountDir)
 	if err != nil {
 		l.Printf("No systemd-boot BootLoaderSpec configs found on %s, trying another format...: %v", device, err)
 	}
 
-	grubImgs, err := grub.ParseLocalConfig(context.Background(), mountDir)
+	grubImgs, err := grub.ParseLocalConfig(context.Background(), mountDir, devices, mountPool)
 	if err != nil {
 		l.Printf("No GRUB configs found on %s, trying another format...: %v", device, err)
 	}
@@ -71,32 +70,24 @@ func parseUnmounted(l ulog.Logger, device *block.BlockDev) ([]boot.OSImage, []*m
 
 // Localboot tries to boot from any local filesystem by parsing grub configuration
 func Localboot(l ulog.Logger, blockDevs block.BlockDevices) ([]boot.OSImage, []*mount.MountPoint, error) {
-	mountPoints, err := ioutil.TempDir("", "u-root-boot")
-	if err != nil {
-		return nil, nil, fmt.Errorf("cannot create tmpdir: %v", err)
-	}
+	mountPool := &mount.Pool{}
 
 	var images []boot.OSImage
-	var mps []*mount.MountPoint
 	for _, device := range blockDevs {
 		imgs, mmps := parseUnmounted(l, device)
 		if len(imgs) > 0 {
 			images = append(images, imgs...)
-			mps = append(mps, mmps...)
+			for _, mp := range mmps {
+				mountPool.Add(mp)
+			}
 		} else {
-			dir := filepath.Join(mountPoints, device.Name)
-
-			os.MkdirAll(dir, 0777)
-			mp, err := device.Mount(dir, mount.ReadOnly)
+			mp, err := mountPool.Mount(device, mount.ReadOnly)
 			if err != nil {
-				os.RemoveAll(dir)
 				continue
 			}
-
-			imgs = parse(l, device, dir)
+			imgs = parse(l, device, blockDevs, mp.Path, mountPool)
 			images = append(images, imgs...)
-			mps = append(mps, mp)
 		}
 	}
-	return images, mps, nil
+	return images, mountPool.MountPoints, nil
 }
@@ -15,6 +15,9 @@ import (
 
 // MultibootImage is a multiboot-formated OSImage, such as ESXi, Xen, Akaros,
 // tboot.
+//
+// Load probes whether Kernel is a multiboot v1, Multiboot2 or mutiboot
+// kernel.
 type MultibootImage struct {
 	Name string
 
@@ -0,0 +1,106 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Framebuffer ioctls from linux/fb.h.
+const (
+	fbiogetVScreenInfo = 0x4600
+	fbiogetFScreenInfo = 0x4602
+
+	fbVisualTrueColor = 2
+)
+
+// fbBitfield is struct fb_bitfield.
+type fbBitfield struct {
+	Offset   uint32
+	Length   uint32
+	MSBRight uint32
+}
+
+// fbVarScreenInfo is struct fb_var_screeninfo.
+type fbVarScreenInfo struct {
+	XRes, YRes               uint32
+	XResVirtual, YResVirtual uint32
+	XOffset, YOffset         uint32
+	BitsPerPixel             uint32
+	Grayscale                uint32
+	Red, Green, Blue, Transp fbBitfield
+	NonStd                   uint32
+	Activate                 uint32
+	Height, Width            uint32
+	AccelFlags               uint32
+	PixClock                 uint32
+	LeftMargin, RightMargin  uint32
+	UpperMargin, LowerMargin uint32
+	HSyncLen, VSyncLen       uint32
+	Sync, VMode, Rotate      uint32
+	Colorspace               uint32
+	Reserved                 [4]uint32
+}
+
+// fbFixScreenInfo is struct fb_fix_screeninfo.
+type fbFixScreenInfo struct {
+	ID                            [16]byte
+	SMemStart                     uintptr
+	SMemLen                       uint32
+	Type, TypeAux, Visual         uint32
+	XPanStep, YPanStep, YWrapStep uint16
+	LineLength                    uint32
+	MMIOStart                     uintptr
+	MMIOLen                       uint32
+	Accel                         uint32
+	Capabilities                  uint16
+	Reserved                      [2]uint16
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// readFramebuffer describes the framebuffer Linux uses, so the loaded
+// kernel can keep using it.
+func readFramebuffer() (multiboot2Framebuffer, error) {
+	f, err := os.Open("/dev/fb0")
+	if err != nil {
+		return multiboot2Framebuffer{}, err
+	}
+	defer f.Close()
+
+	var fix fbFixScreenInfo
+	if err := ioctl(f, fbiogetFScreenInfo, unsafe.Pointer(&fix)); err != nil {
+		return multiboot2Framebuffer{}, fmt.Errorf("FBIOGET_FSCREENINFO: %v", err)
+	}
+	var v fbVarScreenInfo
+	if err := ioctl(f, fbiogetVScreenInfo, unsafe.Pointer(&v)); err != nil {
+		return multiboot2Framebuffer{}, fmt.Errorf("FBIOGET_VSCREENINFO: %v", err)
+	}
+	if fix.Visual != fbVisualTrueColor {
+		return multiboot2Framebuffer{}, fmt.Errorf("framebuffer visual %d is not true color", fix.Visual)
+	}
+	return multiboot2Framebuffer{
+		addr:      uint64(fix.SMemStart),
+		pitch:     fix.LineLength,
+		width:     v.XRes,
+		height:    v.YRes,
+		bpp:       uint8(v.BitsPerPixel),
+		redPos:    uint8(v.Red.Offset),
+		redSize:   uint8(v.Red.Length),
+		greenPos:  uint8(v.Green.Offset),
+		greenSize: uint8(v.Green.Length),
+		bluePos:   uint8(v.Blue.Offset),
+		blueSize:  uint8(v.Blue.Length),
+	}, nil
+}
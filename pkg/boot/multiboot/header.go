@@ -69,6 +69,7 @@ type header struct {
 }
 
 type imageType interface {
+	loadKernel(m *multiboot) (uintptr, error)
 	addInfo(m *multiboot) (uintptr, error)
 	name() string
 	bootMagic() uintptr
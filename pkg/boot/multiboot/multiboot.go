@@ -3,7 +3,8 @@
 // license that can be found in the LICENSE file.
 
 // Package multiboot implements bootloading multiboot kernels as defined by
-// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html.
+// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html and
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html.
 //
 // Package multiboot crafts kexec segments that can be used with the kexec_load
 // system call.
@@ -67,6 +68,9 @@ type multiboot struct {
 
 	info          info
 	loadedModules modules
+
+	// loadBase is the lowest address the kernel was loaded at.
+	loadBase uintptr
 }
 
 var (
@@ -131,13 +135,9 @@ func (m memoryMaps) String() string {
 	return strings.Join(s, "\n")
 }
 
-// Probe checks if `kernel` is multiboot v1 or mutiboot kernel.
+// Probe checks if `kernel` is multiboot v1, Multiboot2 or mutiboot kernel.
 func Probe(kernel io.ReaderAt) error {
-	r := tryGzipFilter(kernel)
-	_, err := parseHeader(uio.Reader(r))
-	if err == ErrHeaderNotFound {
-		_, err = parseMutiHeader(uio.Reader(r))
-	}
+	_, err := parseImageHeader(tryGzipFilter(kernel))
 	return err
 }
 
@@ -247,34 +247,18 @@ func (m *multiboot) load(debug bool, ibft *ibft.IBFT) error {
 	// TODO: the kernel is opened like 4 separate times here. Just open it
 	// once and pass it around.
 
-	var header imageType
-	multibootHeader, err := parseHeader(uio.Reader(m.kernel))
-	if err == nil {
-		header = multibootHeader
-	} else if err == ErrHeaderNotFound {
-		var mutibootHeader *mutibootHeader
-		// We don't even need the header at the moment. Just need to
-		// know it's there. Everything that matters is in the ELF.
-		mutibootHeader, err = parseMutiHeader(uio.Reader(m.kernel))
-		header = mutibootHeader
-	}
+	header, err := parseImageHeader(m.kernel)
 	if err != nil {
 		return fmt.Errorf("error parsing headers: %v", err)
 	}
 	log.Printf("Found %s image", header.name())
 
-	log.Printf("Getting kernel entry point")
-	kernelEntry, err := getEntryPoint(m.kernel)
+	kernelEntry, err := header.loadKernel(m)
 	if err != nil {
-		return fmt.Errorf("error getting kernel entry point: %v", err)
+		return err
 	}
 	log.Printf("Kernel entry point at %#x", kernelEntry)
 
-	log.Printf("Parsing ELF segments")
-	if err := m.mem.LoadElfSegments(m.kernel); err != nil {
-		return fmt.Errorf("error loading ELF segments: %v", err)
-	}
-
 	log.Printf("Parsing memory map")
 	if err := m.mem.ParseMemoryMap(); err != nil {
 		return fmt.Errorf("error parsing memory map: %v", err)
@@ -322,6 +306,29 @@ func (m *multiboot) load(debug bool, ibft *ibft.IBFT) error {
 	return nil
 }
 
+// loadELF loads the ELF segments of m.kernel and returns its entry point.
+func (m *multiboot) loadELF() (uintptr, error) {
+	log.Printf("Getting kernel entry point")
+	kernelEntry, err := getEntryPoint(m.kernel)
+	if err != nil {
+		return 0, fmt.Errorf("error getting kernel entry point: %v", err)
+	}
+
+	log.Printf("Parsing ELF segments")
+	if err := m.mem.LoadElfSegments(m.kernel); err != nil {
+		return 0, fmt.Errorf("error loading ELF segments: %v", err)
+	}
+	return kernelEntry, nil
+}
+
+func (h *header) loadKernel(m *multiboot) (uintptr, error) {
+	return m.loadELF()
+}
+
+func (*mutibootHeader) loadKernel(m *multiboot) (uintptr, error) {
+	return m.loadELF()
+}
+
 func getEntryPoint(r io.ReaderAt) (uintptr, error) {
 	f, err := elf.NewFile(r)
 	if err != nil {
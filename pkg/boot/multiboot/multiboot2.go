@@ -0,0 +1,235 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+
+	"github.com/u-root/u-root/pkg/acpi"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// Firmware information passed on to Multiboot2 kernels. These are
+// variables so tests can replace them.
+var (
+	getRSDP           = readRSDP
+	getFramebuffer    = readFramebuffer
+	getEFISystemTable = readEFISystemTable
+)
+
+// loadKernel loads the kernel, either as an ELF file or at the addresses
+// given by the address tag, and returns its entry point.
+func (h *multiboot2Header) loadKernel(m *multiboot) (uintptr, error) {
+	if h.address == nil {
+		entry, err := m.loadELF()
+		if err != nil {
+			return 0, err
+		}
+		if h.entryAddr != 0 {
+			entry = uintptr(h.entryAddr)
+		}
+		if h.relocatable {
+			if m.loadBase, err = elfLoadBase(m.kernel); err != nil {
+				return 0, err
+			}
+		}
+		return entry, nil
+	}
+
+	a := h.address
+	if h.entryAddr == 0 {
+		return 0, fmt.Errorf("multiboot2 address tag without entry address tag")
+	}
+	// The header is at HeaderAddr in memory, so the file offset of
+	// LoadAddr follows from the header's file offset.
+	if a.HeaderAddr < a.LoadAddr || int64(a.HeaderAddr-a.LoadAddr) > h.offset {
+		return 0, fmt.Errorf("multiboot2 load address %#x is not before the header", a.LoadAddr)
+	}
+	off := h.offset - int64(a.HeaderAddr-a.LoadAddr)
+
+	var r io.Reader = io.NewSectionReader(m.kernel, off, 1<<62)
+	if a.LoadEndAddr != 0 {
+		if a.LoadEndAddr < a.LoadAddr {
+			return 0, fmt.Errorf("multiboot2 load end address %#x is before load address %#x", a.LoadEndAddr, a.LoadAddr)
+		}
+		r = io.LimitReader(r, int64(a.LoadEndAddr-a.LoadAddr))
+	}
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	size := uint(len(d))
+	if end := uint(a.BSSEndAddr); end > uint(a.LoadAddr)+size {
+		size = end - uint(a.LoadAddr)
+	}
+	m.mem.Segments.Insert(kexec.NewSegment(d, kexec.Range{
+		Start: uintptr(a.LoadAddr),
+		Size:  size,
+	}))
+	m.loadBase = uintptr(a.LoadAddr)
+	return uintptr(h.entryAddr), nil
+}
+
+// elfLoadBase returns the lowest physical address of the ELF file's
+// loadable segments.
+func elfLoadBase(r io.ReaderAt) (uintptr, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return 0, err
+	}
+	var base uint64
+	found := false
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && (!found || p.Paddr < base) {
+			base, found = p.Paddr, true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("ELF file has no loadable segments")
+	}
+	return uintptr(base), nil
+}
+
+// addInfo collects and adds the Multiboot2 boot information into the
+// segments.
+//
+// The format is described in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#Boot-information-format.
+func (h *multiboot2Header) addInfo(m *multiboot) (addr uintptr, err error) {
+	mi, err := h.newInfo(m)
+	if err != nil {
+		return 0, err
+	}
+	r, err := m.mem.AddKexecSegment(mi.marshal())
+	if err != nil {
+		return 0, err
+	}
+	return r.Start, nil
+}
+
+func (h *multiboot2Header) newInfo(m *multiboot) (*multiboot2Info, error) {
+	lower, upper := m.memoryBoundaries()
+	mi := &multiboot2Info{
+		tags: []multiboot2Tag{
+			multiboot2String{tagType: infoTagCmdline, s: m.cmdLine},
+			multiboot2String{tagType: infoTagBootLoaderName, s: m.bootloader},
+			multiboot2BasicMemInfo{memLower: lower >> 10, memUpper: upper >> 10},
+			multiboot2Mmap(m.memoryMap()),
+		},
+	}
+
+	if len(m.modules) > 0 {
+		mods, err := m.loadModules()
+		if err != nil {
+			return nil, err
+		}
+		for i, mod := range mods {
+			mi.tags = append(mi.tags, multiboot2Module{
+				start:   mod.Start,
+				end:     mod.End,
+				cmdline: m.modules[i].Cmdline,
+			})
+		}
+	}
+
+	if h.relocatable {
+		mi.tags = append(mi.tags, multiboot2LoadBaseAddr(m.loadBase))
+	}
+	mi.tags = append(mi.tags, firmwareTags()...)
+	return mi, nil
+}
+
+// firmwareTags returns the tags describing firmware structures the kernel
+// may need: ACPI RSDP, EFI system table and framebuffer. Whatever cannot be
+// found is left out.
+func firmwareTags() []multiboot2Tag {
+	var tags []multiboot2Tag
+	if rsdp, err := getRSDP(); err != nil {
+		log.Printf("Not passing ACPI RSDP: %v", err)
+	} else {
+		// The ACPI 1.0 RSDP is 20 bytes; revision 2 added the rest.
+		tags = append(tags, multiboot2Bytes{tagType: infoTagACPIOld, b: rsdp[:20]})
+		if rsdp[15] >= 2 {
+			tags = append(tags, multiboot2Bytes{tagType: infoTagACPINew, b: rsdp})
+		}
+	}
+	if st, err := getEFISystemTable(); err == nil {
+		tags = append(tags, multiboot2EFI64(st))
+	}
+	if fb, err := getFramebuffer(); err == nil {
+		tags = append(tags, fb)
+	}
+	return tags
+}
+
+// readRSDP returns a copy of the ACPI RSDP.
+func readRSDP() ([]byte, error) {
+	r, err := acpi.GetRSDP()
+	if err != nil {
+		return nil, err
+	}
+	return r.AllData(), nil
+}
+
+// readEFISystemTable returns the address of the 64-bit EFI system table
+// from the boot parameters Linux was booted with.
+func readEFISystemTable() (uint64, error) {
+	const (
+		efiInfoOff = 0x1c0
+
+		// efiLoaderSignature64 is "EL64".
+		efiLoaderSignature64 = 0x34364c45
+	)
+	b, err := ioutil.ReadFile("/sys/kernel/boot_params/data")
+	if err != nil {
+		return 0, err
+	}
+	if len(b) < efiInfoOff+32 {
+		return 0, fmt.Errorf("boot params too short")
+	}
+	b = b[efiInfoOff:]
+	if binary.LittleEndian.Uint32(b) != efiLoaderSignature64 {
+		return 0, fmt.Errorf("not booted by a 64-bit EFI loader")
+	}
+	st := uint64(binary.LittleEndian.Uint32(b[4:])) | uint64(binary.LittleEndian.Uint32(b[24:]))<<32
+	if st == 0 {
+		return 0, fmt.Errorf("no EFI system table")
+	}
+	return st, nil
+}
+
+// parseImageHeader finds the multiboot, Multiboot2 or mutiboot header of a
+// kernel.
+//
+// Kernels that support both multiboot versions are loaded as Multiboot2,
+// which passes more information, unless their Multiboot2 header asks for
+// something we cannot provide.
+func parseImageHeader(kernel io.ReaderAt) (imageType, error) {
+	mb2, mb2Err := parseMultiboot2Header(uio.Reader(kernel))
+	if mb2Err == nil {
+		return mb2, nil
+	}
+	h, err := parseHeader(uio.Reader(kernel))
+	if err == nil {
+		return h, nil
+	} else if err != ErrHeaderNotFound {
+		return nil, err
+	}
+	mh, err := parseMutiHeader(uio.Reader(kernel))
+	if err == nil {
+		return mh, nil
+	}
+	if err == ErrHeaderNotFound && mb2Err != ErrHeaderNotFound {
+		return nil, mb2Err
+	}
+	return nil, err
+}
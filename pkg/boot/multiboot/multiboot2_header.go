@@ -0,0 +1,233 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/ubinary"
+)
+
+// ErrMultiboot2TagNotSupported indicates that a Multiboot2 header contains a
+// tag that is not optional and that this package cannot satisfy.
+var ErrMultiboot2TagNotSupported = errors.New("multiboot2 header tag not supported")
+
+const (
+	// multiboot2HeaderMagic is the magic value found in a Multiboot2
+	// kernel header.
+	multiboot2HeaderMagic = 0xE85250D6
+
+	// multiboot2BootMagic is the magic expected by the loaded OS in EAX
+	// at boot handover.
+	multiboot2BootMagic = 0x36D76289
+
+	// multiboot2ArchI386 is the 32-bit protected mode i386 architecture.
+	multiboot2ArchI386 = 0
+
+	// multiboot2Search is how far into the OS image the header may be.
+	multiboot2Search = 32768
+)
+
+type multiboot2HeaderTagType uint16
+
+// Multiboot2 header tag types, as defined in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#Header-tags.
+const (
+	headerTagEnd               multiboot2HeaderTagType = 0
+	headerTagInfoRequest       multiboot2HeaderTagType = 1
+	headerTagAddress           multiboot2HeaderTagType = 2
+	headerTagEntryAddress      multiboot2HeaderTagType = 3
+	headerTagConsoleFlags      multiboot2HeaderTagType = 4
+	headerTagFramebuffer       multiboot2HeaderTagType = 5
+	headerTagModuleAlign       multiboot2HeaderTagType = 6
+	headerTagEFIBootServices   multiboot2HeaderTagType = 7
+	headerTagEntryAddressEFI32 multiboot2HeaderTagType = 8
+	headerTagEntryAddressEFI64 multiboot2HeaderTagType = 9
+	headerTagRelocatable       multiboot2HeaderTagType = 10
+
+	// headerTagFlagOptional marks tags the OS can do without.
+	headerTagFlagOptional = 1
+)
+
+var sizeofMultiboot2HeaderFixed = binary.Size(multiboot2HeaderFixed{})
+
+// multiboot2HeaderFixed is the fixed part of a Multiboot2 header.
+type multiboot2HeaderFixed struct {
+	Magic        uint32
+	Architecture uint32
+	HeaderLength uint32
+	Checksum     uint32
+}
+
+// multiboot2HeaderTag starts every Multiboot2 header tag.
+type multiboot2HeaderTag struct {
+	Type  multiboot2HeaderTagType
+	Flags uint16
+	Size  uint32
+}
+
+// multiboot2Address is the address header tag for kernels that are not ELF
+// files.
+type multiboot2Address struct {
+	HeaderAddr  uint32
+	LoadAddr    uint32
+	LoadEndAddr uint32
+	BSSEndAddr  uint32
+}
+
+// multiboot2Header represents a Multiboot2 header loaded from the file.
+type multiboot2Header struct {
+	multiboot2HeaderFixed
+
+	// offset is the offset of the header in the file.
+	offset int64
+
+	// requests are the information tags the OS asked for.
+	requests []multiboot2InfoType
+
+	// address is set for kernels loaded with the address tag.
+	address *multiboot2Address
+
+	// entryAddr overrides the ELF entry point if it is not zero.
+	entryAddr uint32
+
+	// relocatable is set if the kernel may be loaded anywhere. We always
+	// load it where it asks to be, but must tell it where that is.
+	relocatable bool
+}
+
+func (*multiboot2Header) name() string {
+	return "multiboot2"
+}
+
+func (*multiboot2Header) bootMagic() uintptr {
+	return multiboot2BootMagic
+}
+
+// multiboot2Provided are the information tags we can provide.
+var multiboot2Provided = map[multiboot2InfoType]bool{
+	infoTagCmdline:        true,
+	infoTagBootLoaderName: true,
+	infoTagModule:         true,
+	infoTagBasicMemInfo:   true,
+	infoTagMmap:           true,
+	infoTagFramebuffer:    true,
+	infoTagEFI64:          true,
+	infoTagACPIOld:        true,
+	infoTagACPINew:        true,
+	infoTagLoadBaseAddr:   true,
+}
+
+// parseMultiboot2Header parses a Multiboot2 header as defined in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#OS-image-format
+func parseMultiboot2Header(r io.Reader) (*multiboot2Header, error) {
+	// The Multiboot2 header must be contained completely within the
+	// first 32768 bytes of the OS image.
+	buf := make([]byte, multiboot2Search)
+	n, err := io.ReadAtLeast(r, buf, sizeofMultiboot2HeaderFixed)
+	if err != nil {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	// The Multiboot2 header must be 64-bit aligned.
+	for off := 0; off+sizeofMultiboot2HeaderFixed <= len(buf); off += 8 {
+		var hdr multiboot2Header
+		hdr.Magic = ubinary.NativeEndian.Uint32(buf[off:])
+		if hdr.Magic != multiboot2HeaderMagic {
+			continue
+		}
+		hdr.Architecture = ubinary.NativeEndian.Uint32(buf[off+4:])
+		hdr.HeaderLength = ubinary.NativeEndian.Uint32(buf[off+8:])
+		hdr.Checksum = ubinary.NativeEndian.Uint32(buf[off+12:])
+		if hdr.Magic+hdr.Architecture+hdr.HeaderLength+hdr.Checksum != 0 {
+			continue
+		}
+		if int(hdr.HeaderLength) < sizeofMultiboot2HeaderFixed || uint64(off)+uint64(hdr.HeaderLength) > uint64(len(buf)) {
+			return nil, fmt.Errorf("multiboot2 header length %d exceeds the first %d bytes", hdr.HeaderLength, len(buf))
+		}
+		if hdr.Architecture != multiboot2ArchI386 {
+			return nil, fmt.Errorf("multiboot2 architecture %d not supported", hdr.Architecture)
+		}
+		hdr.offset = int64(off)
+		if err := hdr.parseTags(buf[off+sizeofMultiboot2HeaderFixed : off+int(hdr.HeaderLength)]); err != nil {
+			return nil, err
+		}
+		return &hdr, nil
+	}
+	return nil, ErrHeaderNotFound
+}
+
+// parseTags parses the header tags in b.
+func (h *multiboot2Header) parseTags(b []byte) error {
+	const sizeofTag = 8
+	for len(b) >= sizeofTag {
+		tag := multiboot2HeaderTag{
+			Type:  multiboot2HeaderTagType(ubinary.NativeEndian.Uint16(b)),
+			Flags: ubinary.NativeEndian.Uint16(b[2:]),
+			Size:  ubinary.NativeEndian.Uint32(b[4:]),
+		}
+		if tag.Type == headerTagEnd {
+			return nil
+		}
+		if tag.Size < sizeofTag || uint64(tag.Size) > uint64(len(b)) {
+			return fmt.Errorf("multiboot2 header tag %d has invalid size %d", tag.Type, tag.Size)
+		}
+		data := b[sizeofTag:tag.Size]
+		optional := tag.Flags&headerTagFlagOptional != 0
+
+		switch tag.Type {
+		case headerTagInfoRequest:
+			for ; len(data) >= 4; data = data[4:] {
+				typ := multiboot2InfoType(ubinary.NativeEndian.Uint32(data))
+				if !optional && !multiboot2Provided[typ] {
+					return fmt.Errorf("%w: information request %d", ErrMultiboot2TagNotSupported, typ)
+				}
+				h.requests = append(h.requests, typ)
+			}
+
+		case headerTagAddress:
+			var a multiboot2Address
+			if err := binary.Read(bytes.NewReader(data), ubinary.NativeEndian, &a); err != nil {
+				return fmt.Errorf("multiboot2 address tag: %v", err)
+			}
+			h.address = &a
+
+		case headerTagEntryAddress:
+			if len(data) < 4 {
+				return fmt.Errorf("multiboot2 entry address tag too short")
+			}
+			h.entryAddr = ubinary.NativeEndian.Uint32(data)
+
+		case headerTagRelocatable:
+			h.relocatable = true
+
+		case headerTagModuleAlign:
+			// Modules are always page aligned.
+
+		case headerTagConsoleFlags, headerTagFramebuffer, headerTagEntryAddressEFI32, headerTagEntryAddressEFI64:
+			// We pass on the console as it is. The EFI entry points
+			// are only used with EFI boot services, which are gone
+			// once Linux runs.
+
+		default:
+			// This includes EFI boot services.
+			if !optional {
+				return fmt.Errorf("%w: tag %d", ErrMultiboot2TagNotSupported, tag.Type)
+			}
+		}
+		// Tags are padded to 8 bytes.
+		size := (int(tag.Size) + 7) &^ 7
+		if size > len(b) {
+			break
+		}
+		b = b[size:]
+	}
+	return fmt.Errorf("multiboot2 header has no end tag")
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type mb2Tag struct {
+	typ   multiboot2HeaderTagType
+	flags uint16
+	data  []uint32
+}
+
+// createMultiboot2Header returns a Multiboot2 header with tags and an end
+// tag, with a broken checksum if bad is set.
+func createMultiboot2Header(tags []mb2Tag, bad bool) []byte {
+	var body bytes.Buffer
+	for _, t := range append(tags, mb2Tag{typ: headerTagEnd}) {
+		binary.Write(&body, binary.LittleEndian, uint16(t.typ))
+		binary.Write(&body, binary.LittleEndian, t.flags)
+		binary.Write(&body, binary.LittleEndian, uint32(8+4*len(t.data)))
+		binary.Write(&body, binary.LittleEndian, t.data)
+		for body.Len()%8 != 0 {
+			body.WriteByte(0)
+		}
+	}
+
+	length := uint32(16 + body.Len())
+	checksum := -(uint32(multiboot2HeaderMagic) + multiboot2ArchI386 + length)
+	if bad {
+		checksum++
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []uint32{multiboot2HeaderMagic, multiboot2ArchI386, length, checksum})
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+// createImage places hdr at offset in a 16K image.
+func createImage(offset int, hdrs ...[]byte) []byte {
+	img := bytes.Repeat([]byte{0xDE, 0xAD, 0xBE, 0xEF}, 4096)
+	for _, h := range hdrs {
+		copy(img[offset:], h)
+		offset += len(h) + 8 - len(h)%8
+	}
+	return img
+}
+
+func TestParseMultiboot2Header(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		tags   []mb2Tag
+		bad    bool
+		offset int
+		want   *multiboot2Header
+		err    error
+	}{
+		{
+			name: "no tags",
+			want: &multiboot2Header{},
+		},
+		{
+			name:   "misaligned",
+			offset: 4,
+			err:    ErrHeaderNotFound,
+		},
+		{
+			name: "bad checksum",
+			bad:  true,
+			err:  ErrHeaderNotFound,
+		},
+		{
+			name:   "tags",
+			offset: 1024,
+			tags: []mb2Tag{
+				{typ: headerTagInfoRequest, data: []uint32{uint32(infoTagMmap), uint32(infoTagACPINew)}},
+				{typ: headerTagEntryAddress, data: []uint32{0x100040}},
+				{typ: headerTagAddress, data: []uint32{0x100000, 0x100000, 0, 0x200000}},
+				{typ: headerTagModuleAlign},
+				{typ: headerTagRelocatable, flags: headerTagFlagOptional, data: []uint32{0x100000, 0x1000000, 0x1000, 0}},
+				{typ: headerTagEntryAddressEFI64, flags: headerTagFlagOptional, data: []uint32{0x100080}},
+			},
+			want: &multiboot2Header{
+				offset:    1024,
+				requests:  []multiboot2InfoType{infoTagMmap, infoTagACPINew},
+				entryAddr: 0x100040,
+				address: &multiboot2Address{
+					HeaderAddr: 0x100000,
+					LoadAddr:   0x100000,
+					BSSEndAddr: 0x200000,
+				},
+				relocatable: true,
+			},
+		},
+		{
+			name: "optional unknown requests",
+			tags: []mb2Tag{
+				{typ: headerTagInfoRequest, flags: headerTagFlagOptional, data: []uint32{uint32(infoTagAPM)}},
+			},
+			want: &multiboot2Header{
+				requests: []multiboot2InfoType{infoTagAPM},
+			},
+		},
+		{
+			name: "required unknown requests",
+			tags: []mb2Tag{
+				{typ: headerTagInfoRequest, data: []uint32{uint32(infoTagAPM)}},
+			},
+			err: ErrMultiboot2TagNotSupported,
+		},
+		{
+			name: "EFI boot services",
+			tags: []mb2Tag{
+				{typ: headerTagEFIBootServices},
+			},
+			err: ErrMultiboot2TagNotSupported,
+		},
+		{
+			name: "optional EFI boot services",
+			tags: []mb2Tag{
+				{typ: headerTagEFIBootServices, flags: headerTagFlagOptional},
+			},
+			want: &multiboot2Header{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := createMultiboot2Header(tt.tags, tt.bad)
+			got, err := parseMultiboot2Header(bytes.NewReader(createImage(tt.offset, hdr)))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseMultiboot2Header() = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			// The fixed part is checked by finding the header at all.
+			got.multiboot2HeaderFixed = multiboot2HeaderFixed{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMultiboot2Header() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImageHeader(t *testing.T) {
+	v1 := createHeader(flagGood)
+	var v1Buf bytes.Buffer
+	if err := binary.Write(&v1Buf, binary.LittleEndian, v1); err != nil {
+		t.Fatal(err)
+	}
+	v2 := createMultiboot2Header(nil, false)
+	v2Unsupported := createMultiboot2Header([]mb2Tag{{typ: headerTagEFIBootServices}}, false)
+
+	for _, tt := range []struct {
+		name  string
+		image []byte
+		want  string
+		err   error
+	}{
+		{name: "v1", image: createImage(0, v1Buf.Bytes()), want: "multiboot"},
+		{name: "v2", image: createImage(0, v2), want: "multiboot2"},
+		{name: "both", image: createImage(0, v1Buf.Bytes(), v2), want: "multiboot2"},
+		{name: "both, v2 unsupported", image: createImage(0, v1Buf.Bytes(), v2Unsupported), want: "multiboot"},
+		{name: "v2 unsupported", image: createImage(0, v2Unsupported), err: ErrMultiboot2TagNotSupported},
+		{name: "none", image: createImage(0), err: ErrHeaderNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseImageHeader(bytes.NewReader(tt.image))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseImageHeader() = %v, want %v", err, tt.err)
+			}
+			if err == nil && got.name() != tt.want {
+				t.Errorf("parseImageHeader() = %s, want %s", got.name(), tt.want)
+			}
+		})
+	}
+}
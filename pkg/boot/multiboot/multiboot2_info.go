@@ -0,0 +1,225 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"github.com/u-root/u-root/pkg/ubinary"
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+type multiboot2InfoType uint32
+
+// Multiboot2 boot information tag types, as defined in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#Boot-information-format.
+const (
+	infoTagEnd            multiboot2InfoType = 0
+	infoTagCmdline        multiboot2InfoType = 1
+	infoTagBootLoaderName multiboot2InfoType = 2
+	infoTagModule         multiboot2InfoType = 3
+	infoTagBasicMemInfo   multiboot2InfoType = 4
+	infoTagBootDev        multiboot2InfoType = 5
+	infoTagMmap           multiboot2InfoType = 6
+	infoTagVBE            multiboot2InfoType = 7
+	infoTagFramebuffer    multiboot2InfoType = 8
+	infoTagELFSections    multiboot2InfoType = 9
+	infoTagAPM            multiboot2InfoType = 10
+	infoTagEFI32          multiboot2InfoType = 11
+	infoTagEFI64          multiboot2InfoType = 12
+	infoTagSMBIOS         multiboot2InfoType = 13
+	infoTagACPIOld        multiboot2InfoType = 14
+	infoTagACPINew        multiboot2InfoType = 15
+	infoTagNetwork        multiboot2InfoType = 16
+	infoTagEFIMmap        multiboot2InfoType = 17
+	infoTagEFIBS          multiboot2InfoType = 18
+	infoTagEFI32IH        multiboot2InfoType = 19
+	infoTagEFI64IH        multiboot2InfoType = 20
+	infoTagLoadBaseAddr   multiboot2InfoType = 21
+)
+
+// multiboot2Info is the Multiboot2 boot information passed to the loaded
+// kernel: a list of tags.
+type multiboot2Info struct {
+	tags []multiboot2Tag
+}
+
+// multiboot2Tag is a boot information tag.
+type multiboot2Tag interface {
+	typ() multiboot2InfoType
+	marshal() []byte
+}
+
+// marshal writes out the exact bytes of the boot information. Every tag
+// starts at an 8-byte boundary, and an end tag terminates the list.
+func (m *multiboot2Info) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	// total_size is filled in below.
+	buf.Write32(0)
+	buf.Write32(0)
+
+	writeTag := func(typ multiboot2InfoType, b []byte) {
+		buf.Write32(uint32(typ))
+		buf.Write32(uint32(len(b) + 8))
+		buf.WriteBytes(b)
+		buf.Align(8)
+	}
+	for _, t := range m.tags {
+		writeTag(t.typ(), t.marshal())
+	}
+	writeTag(infoTagEnd, nil)
+
+	b := buf.Data()
+	ubinary.NativeEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+// multiboot2String is a tag containing a null-terminated string, like the
+// command line.
+type multiboot2String struct {
+	tagType multiboot2InfoType
+	s       string
+}
+
+func (m multiboot2String) typ() multiboot2InfoType {
+	return m.tagType
+}
+
+func (m multiboot2String) marshal() []byte {
+	return append([]byte(m.s), 0)
+}
+
+// multiboot2Module describes a module.
+type multiboot2Module struct {
+	start   uint32
+	end     uint32
+	cmdline string
+}
+
+func (multiboot2Module) typ() multiboot2InfoType {
+	return infoTagModule
+}
+
+func (m multiboot2Module) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write32(m.start)
+	buf.Write32(m.end)
+	buf.WriteBytes(append([]byte(m.cmdline), 0))
+	return buf.Data()
+}
+
+// multiboot2BasicMemInfo is the amount of lower and upper memory in KiB.
+type multiboot2BasicMemInfo struct {
+	memLower uint32
+	memUpper uint32
+}
+
+func (multiboot2BasicMemInfo) typ() multiboot2InfoType {
+	return infoTagBasicMemInfo
+}
+
+func (m multiboot2BasicMemInfo) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write32(m.memLower)
+	buf.Write32(m.memUpper)
+	return buf.Data()
+}
+
+// multiboot2Mmap is the memory map.
+type multiboot2Mmap memoryMaps
+
+func (multiboot2Mmap) typ() multiboot2InfoType {
+	return infoTagMmap
+}
+
+func (m multiboot2Mmap) marshal() []byte {
+	const sizeofEntry = 24
+
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write32(sizeofEntry)
+	// entry_version
+	buf.Write32(0)
+	for _, mm := range m {
+		buf.Write64(mm.BaseAddr)
+		buf.Write64(mm.Length)
+		buf.Write32(mm.Type)
+		// reserved
+		buf.Write32(0)
+	}
+	return buf.Data()
+}
+
+// multiboot2Framebuffer describes a direct RGB framebuffer.
+type multiboot2Framebuffer struct {
+	addr   uint64
+	pitch  uint32
+	width  uint32
+	height uint32
+	bpp    uint8
+
+	redPos, redSize     uint8
+	greenPos, greenSize uint8
+	bluePos, blueSize   uint8
+}
+
+func (multiboot2Framebuffer) typ() multiboot2InfoType {
+	return infoTagFramebuffer
+}
+
+func (m multiboot2Framebuffer) marshal() []byte {
+	// framebufferTypeRGB means direct RGB color.
+	const framebufferTypeRGB = 1
+
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write64(m.addr)
+	buf.Write32(m.pitch)
+	buf.Write32(m.width)
+	buf.Write32(m.height)
+	buf.Write8(m.bpp)
+	buf.Write8(framebufferTypeRGB)
+	// reserved
+	buf.Write16(0)
+	buf.WriteBytes([]byte{m.redPos, m.redSize, m.greenPos, m.greenSize, m.bluePos, m.blueSize})
+	return buf.Data()
+}
+
+// multiboot2EFI64 is the 64-bit EFI system table pointer.
+type multiboot2EFI64 uint64
+
+func (multiboot2EFI64) typ() multiboot2InfoType {
+	return infoTagEFI64
+}
+
+func (m multiboot2EFI64) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write64(uint64(m))
+	return buf.Data()
+}
+
+// multiboot2Bytes is a tag containing a copy of a firmware structure, like
+// the ACPI RSDP.
+type multiboot2Bytes struct {
+	tagType multiboot2InfoType
+	b       []byte
+}
+
+func (m multiboot2Bytes) typ() multiboot2InfoType {
+	return m.tagType
+}
+
+func (m multiboot2Bytes) marshal() []byte {
+	return m.b
+}
+
+// multiboot2LoadBaseAddr is the physical address the image was loaded at.
+type multiboot2LoadBaseAddr uint32
+
+func (multiboot2LoadBaseAddr) typ() multiboot2InfoType {
+	return infoTagLoadBaseAddr
+}
+
+func (m multiboot2LoadBaseAddr) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write32(uint32(m))
+	return buf.Data()
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot/kexec"
+)
+
+func le32(v ...uint32) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, v)
+	return b.Bytes()
+}
+
+func TestMultiboot2InfoMarshal(t *testing.T) {
+	mi := multiboot2Info{
+		tags: []multiboot2Tag{
+			multiboot2String{tagType: infoTagCmdline, s: "console=ttyS0"},
+			multiboot2BasicMemInfo{memLower: 639, memUpper: 1024},
+			multiboot2Mmap{
+				{BaseAddr: 0, Length: 0x9fc00, Type: 1},
+			},
+			multiboot2Module{start: 0x200000, end: 0x201000, cmdline: "mod"},
+		},
+	}
+
+	var want []byte
+	// total_size, reserved
+	want = append(want, le32(120, 0)...)
+	// cmdline: 14 bytes of string, padded to 16.
+	want = append(want, le32(1, 22)...)
+	want = append(want, "console=ttyS0\x00\x00\x00"...)
+	// basic meminfo
+	want = append(want, le32(4, 16, 639, 1024)...)
+	// mmap
+	want = append(want, le32(6, 40, 24, 0)...)
+	want = append(want, le32(0, 0, 0x9fc00, 0, 1, 0)...)
+	// module: 4 bytes of string, padded.
+	want = append(want, le32(3, 20, 0x200000, 0x201000)...)
+	want = append(want, "mod\x00\x00\x00\x00\x00"...)
+	// end
+	want = append(want, le32(0, 8)...)
+
+	if got := mi.marshal(); !bytes.Equal(got, want) {
+		t.Errorf("marshal() =\n%x\nwant\n%x", got, want)
+	}
+}
+
+func TestMultiboot2Framebuffer(t *testing.T) {
+	fb := multiboot2Framebuffer{
+		addr:      0xfd000000,
+		pitch:     4096,
+		width:     1024,
+		height:    768,
+		bpp:       32,
+		redPos:    16,
+		redSize:   8,
+		greenPos:  8,
+		greenSize: 8,
+		bluePos:   0,
+		blueSize:  8,
+	}
+	want := append(le32(0xfd000000, 0, 4096, 1024, 768), 32, 1, 0, 0, 16, 8, 8, 8, 0, 8)
+	if got := fb.marshal(); !bytes.Equal(got, want) {
+		t.Errorf("marshal() = %x, want %x", got, want)
+	}
+}
+
+// parseMultiboot2Info parses marshaled boot information into type and
+// data of each tag.
+func parseMultiboot2Info(b []byte) ([]multiboot2InfoType, [][]byte, error) {
+	if len(b) < 8 || int(binary.LittleEndian.Uint32(b)) != len(b) {
+		return nil, nil, fmt.Errorf("bad total size")
+	}
+	var types []multiboot2InfoType
+	var data [][]byte
+	for b = b[8:]; len(b) >= 8; {
+		typ := multiboot2InfoType(binary.LittleEndian.Uint32(b))
+		size := int(binary.LittleEndian.Uint32(b[4:]))
+		if size < 8 || size > len(b) {
+			return nil, nil, fmt.Errorf("bad size %d", size)
+		}
+		if typ == infoTagEnd {
+			return types, data, nil
+		}
+		types = append(types, typ)
+		data = append(data, b[8:size])
+		b = b[(size+7)&^7:]
+	}
+	return nil, nil, fmt.Errorf("no end tag")
+}
+
+func TestMultiboot2NewInfo(t *testing.T) {
+	rsdp := make([]byte, 36)
+	copy(rsdp, "RSD PTR ")
+	rsdp[15] = 2
+	defer func(r func() ([]byte, error), e func() (uint64, error), f func() (multiboot2Framebuffer, error)) {
+		getRSDP, getEFISystemTable, getFramebuffer = r, e, f
+	}(getRSDP, getEFISystemTable, getFramebuffer)
+	getRSDP = func() ([]byte, error) { return rsdp, nil }
+	getEFISystemTable = func() (uint64, error) { return 0x7f000000, nil }
+	getFramebuffer = func() (multiboot2Framebuffer, error) { return multiboot2Framebuffer{}, fmt.Errorf("no framebuffer") }
+
+	m := &multiboot{
+		cmdLine:    "dom0_mem=1G",
+		bootloader: bootloader,
+		modules: []Module{
+			{Module: bytes.NewReader([]byte("module data")), Cmdline: "vmlinuz root=/dev/sda1"},
+		},
+		loadBase: 0x100000,
+	}
+	m.mem.Phys = kexec.MemoryMap{
+		{Range: kexec.Range{Start: 0, Size: 0x9fc00}, Type: kexec.RangeRAM},
+		{Range: kexec.Range{Start: 0x100000, Size: 0x7ff00000}, Type: kexec.RangeRAM},
+	}
+	h := &multiboot2Header{relocatable: true}
+
+	mi, err := h.newInfo(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, data, err := parseMultiboot2Info(mi.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTypes := []multiboot2InfoType{
+		infoTagCmdline,
+		infoTagBootLoaderName,
+		infoTagBasicMemInfo,
+		infoTagMmap,
+		infoTagModule,
+		infoTagLoadBaseAddr,
+		infoTagACPIOld,
+		infoTagACPINew,
+		infoTagEFI64,
+	}
+	if !reflect.DeepEqual(types, wantTypes) {
+		t.Fatalf("tags = %v, want %v", types, wantTypes)
+	}
+	for i, want := range [][]byte{
+		[]byte("dom0_mem=1G\x00"),
+		[]byte(bootloader + "\x00"),
+		le32(0x9fc00>>10, 0x7ff00000>>10),
+		nil,
+		nil,
+		le32(0x100000),
+		rsdp[:20],
+		rsdp,
+		le32(0x7f000000, 0),
+	} {
+		if want != nil && !bytes.Equal(data[i], want) {
+			t.Errorf("tag %d = %q, want %q", types[i], data[i], want)
+		}
+	}
+
+	mod := data[4]
+	if start, end := binary.LittleEndian.Uint32(mod), binary.LittleEndian.Uint32(mod[4:]); end-start != uint32(len("module data")) {
+		t.Errorf("module is [%#x, %#x), want %d bytes", start, end, len("module data"))
+	}
+	if got := string(mod[8:]); got != "vmlinuz root=/dev/sda1\x00" {
+		t.Errorf("module cmdline = %q", got)
+	}
+}
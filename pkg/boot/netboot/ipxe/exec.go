@@ -0,0 +1,514 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipxe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+const (
+	// maxSteps bounds the number of lines executed, as scripts may loop
+	// forever waiting for user input.
+	maxSteps = 10000
+
+	// maxDepth bounds the nesting of chained scripts.
+	maxDepth = 16
+)
+
+var errTooManySteps = errors.New("script does not terminate")
+
+// menu is a menu created by the menu command.
+type menu struct {
+	title string
+	items []item
+
+	// chosen is the label of the item chosen.
+	chosen string
+}
+
+// item is a menu item.
+type item struct {
+	label     string
+	text      string
+	isDefault bool
+	gap       bool
+}
+
+// command implements an iPXE command. It returns whether the command
+// succeeded; an error stops all scripts.
+type command func(p *parser, ctx context.Context, sc *script, args []string) (bool, error)
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"set":       (*parser).set,
+		"clear":     (*parser).clear,
+		"inc":       (*parser).inc,
+		"isset":     (*parser).isset,
+		"iseq":      (*parser).iseq,
+		"goto":      (*parser).goTo,
+		"exit":      (*parser).exit,
+		"echo":      (*parser).echo,
+		"kernel":    (*parser).imgselect,
+		"imgselect": (*parser).imgselect,
+		"imgload":   (*parser).imgselect,
+		"initrd":    (*parser).imgfetch,
+		"imgfetch":  (*parser).imgfetch,
+		"module":    (*parser).imgfetch,
+		"imgargs":   (*parser).imgargs,
+		"imgfree":   (*parser).imgfree,
+		"boot":      (*parser).imgexec,
+		"imgexec":   (*parser).imgexec,
+		"chain":     (*parser).imgexec,
+		"menu":      (*parser).menu,
+		"item":      (*parser).item,
+		"choose":    (*parser).choose,
+		"reboot":    (*parser).stop,
+		"poweroff":  (*parser).stop,
+		"shell":     (*parser).stop,
+	}
+}
+
+// ignoredCommands always succeed. They configure the network, which is
+// already up, or interact with the user.
+var ignoredCommands = map[string]struct{}{
+	"dhcp":    {},
+	"ifopen":  {},
+	"ifconf":  {},
+	"ifclose": {},
+	"ifstat":  {},
+	"route":   {},
+	"ntp":     {},
+	"sleep":   {},
+	"params":  {},
+	"param":   {},
+	"imgstat": {},
+	"show":    {},
+	"colour":  {},
+	"cpair":   {},
+	"console": {},
+}
+
+// exec executes sc and returns whether it succeeded.
+func (p *parser) exec(ctx context.Context, sc *script) (bool, error) {
+	for sc.pc = 0; sc.pc < len(sc.lines) && !sc.done; sc.pc++ {
+		line := sc.lines[sc.pc]
+		if len(line) == 0 || line[0] == '#' || line[0] == ':' {
+			continue
+		}
+		if p.steps++; p.steps > maxSteps {
+			return false, errTooManySteps
+		}
+
+		args, err := split(line)
+		if err != nil {
+			p.log.Printf("ipxe: line %d: %v", sc.pc+1, err)
+			return false, nil
+		}
+		ok, err := p.execLine(ctx, sc, args)
+		if err != nil {
+			return false, err
+		}
+		// Like iPXE, a failing command that is not handled with ||
+		// ends the script.
+		if !ok {
+			return false, nil
+		}
+	}
+	if sc.done {
+		return sc.status, nil
+	}
+	return true, nil
+}
+
+// execLine executes commands joined by || and &&.
+func (p *parser) execLine(ctx context.Context, sc *script, args []string) (bool, error) {
+	ok := true
+	var op string
+	for {
+		i := 0
+		for i < len(args) && args[i] != "||" && args[i] != "&&" {
+			i++
+		}
+		if op == "" || (op == "||" && !ok) || (op == "&&" && ok) {
+			// Like iPXE, settings are expanded right before each
+			// command runs, so choose x && goto ${x} works.
+			cmd := make([]string, i)
+			for j, arg := range args[:i] {
+				cmd[j] = expand(arg, p.settings)
+			}
+			var err error
+			if ok, err = p.execCommand(ctx, sc, cmd); err != nil {
+				return false, err
+			}
+		}
+		if i == len(args) || sc.done {
+			return ok, nil
+		}
+		op, args = args[i], args[i+1:]
+	}
+}
+
+func (p *parser) execCommand(ctx context.Context, sc *script, args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	if cmd, ok := commands[args[0]]; ok {
+		return cmd(p, ctx, sc, args)
+	}
+	if _, ok := ignoredCommands[args[0]]; ok {
+		return true, nil
+	}
+	p.log.Printf("ipxe: unsupported command %q", strings.Join(args, " "))
+	return false, nil
+}
+
+// set implements set <setting> [<value>...].
+func (p *parser) set(ctx context.Context, sc *script, args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, nil
+	}
+	p.settings.set(args[1], strings.Join(args[2:], " "))
+	return true, nil
+}
+
+// clear implements clear <setting>.
+func (p *parser) clear(ctx context.Context, sc *script, args []string) (bool, error) {
+	if len(args) != 2 {
+		return false, nil
+	}
+	p.settings.set(args[1], "")
+	return true, nil
+}
+
+// inc implements inc <setting> [<increment>].
+func (p *parser) inc(ctx context.Context, sc *script, args []string) (bool, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return false, nil
+	}
+	by := int64(1)
+	if len(args) == 3 {
+		n, err := strconv.ParseInt(args[2], 0, 64)
+		if err != nil {
+			return false, nil
+		}
+		by = n
+	}
+	v, _ := p.settings.get(args[1])
+	n, _ := strconv.ParseInt(v, 0, 64)
+	p.settings.set(args[1], strconv.FormatInt(n+by, 10))
+	return true, nil
+}
+
+// isset implements isset <value>, which succeeds if value is not empty.
+func (p *parser) isset(ctx context.Context, sc *script, args []string) (bool, error) {
+	return len(args) == 2 && len(args[1]) > 0, nil
+}
+
+// iseq implements iseq <value1> <value2>.
+func (p *parser) iseq(ctx context.Context, sc *script, args []string) (bool, error) {
+	return len(args) == 3 && args[1] == args[2], nil
+}
+
+// goTo implements goto <label>.
+func (p *parser) goTo(ctx context.Context, sc *script, args []string) (bool, error) {
+	if len(args) != 2 {
+		return false, nil
+	}
+	i, ok := sc.label(args[1])
+	if !ok {
+		p.log.Printf("ipxe: no such label %q", args[1])
+		return false, nil
+	}
+	sc.pc = i
+	return true, nil
+}
+
+// exit implements exit [<status>].
+func (p *parser) exit(ctx context.Context, sc *script, args []string) (bool, error) {
+	sc.done = true
+	sc.status = len(args) < 2 || args[1] == "0"
+	return true, nil
+}
+
+// echo implements echo [-n] [<text>...].
+func (p *parser) echo(ctx context.Context, sc *script, args []string) (bool, error) {
+	_, rest, err := getopt(args[1:], options{"n": "n", "s": "s"})
+	if err != nil {
+		return false, nil
+	}
+	p.log.Printf("%s", strings.Join(rest, " "))
+	return true, nil
+}
+
+// stop implements commands that never return, like reboot.
+func (p *parser) stop(ctx context.Context, sc *script, args []string) (bool, error) {
+	return false, errStop
+}
+
+// imgselect implements imgselect and kernel: imgselect [<options>] <uri>
+// [<args>...].
+func (p *parser) imgselect(ctx context.Context, sc *script, args []string) (bool, error) {
+	opts, rest, err := getopt(args[1:], imageOptions)
+	if err != nil || len(rest) == 0 {
+		return false, nil
+	}
+	// Unlike iPXE, drop the previous kernel, so it does not end up as an
+	// initrd of this one.
+	if p.selected != nil {
+		p.free(p.selected)
+	}
+	img, err := p.fetch(sc, rest[0], opts)
+	if err != nil {
+		p.log.Printf("ipxe: %s: %v", args[0], err)
+		return false, nil
+	}
+	img.cmdline = strings.Join(rest[1:], " ")
+	p.selected = img
+	return true, nil
+}
+
+// imgfetch implements imgfetch, initrd and module: imgfetch [<options>]
+// <uri> [<args>...].
+func (p *parser) imgfetch(ctx context.Context, sc *script, args []string) (bool, error) {
+	opts, rest, err := getopt(args[1:], imageOptions)
+	if err != nil || len(rest) == 0 {
+		return false, nil
+	}
+	// Older u-root scripts concatenate initrds with a comma.
+	names := []string{rest[0]}
+	if args[0] == "initrd" {
+		names = strings.Split(rest[0], ",")
+	}
+	for _, name := range names {
+		img, err := p.fetch(sc, name, opts)
+		if err != nil {
+			p.log.Printf("ipxe: %s: %v", args[0], err)
+			return false, nil
+		}
+		img.module = args[0] == "module"
+		img.cmdline = strings.Join(rest[1:], " ")
+	}
+	return true, nil
+}
+
+// imgargs implements imgargs <image> [<args>...].
+func (p *parser) imgargs(ctx context.Context, sc *script, args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, nil
+	}
+	img := p.image(args[1])
+	if img == nil {
+		return false, nil
+	}
+	img.cmdline = strings.Join(args[2:], " ")
+	return true, nil
+}
+
+// imgfree implements imgfree [<image>].
+func (p *parser) imgfree(ctx context.Context, sc *script, args []string) (bool, error) {
+	if len(args) == 1 {
+		p.images = nil
+		p.selected = nil
+		return true, nil
+	}
+	img := p.image(args[1])
+	if img == nil {
+		return false, nil
+	}
+	p.free(img)
+	return true, nil
+}
+
+// imgexec implements boot, imgexec and chain: imgexec [<options>]
+// [<uri|image> [<args>...]].
+//
+// A script is executed, anything else is booted.
+func (p *parser) imgexec(ctx context.Context, sc *script, args []string) (bool, error) {
+	opts, rest, err := getopt(args[1:], imageOptions)
+	if err != nil {
+		return false, nil
+	}
+	probe := false
+	if len(rest) > 0 {
+		if img := p.image(rest[0]); img != nil {
+			p.selected = img
+			if len(rest) > 1 {
+				img.cmdline = strings.Join(rest[1:], " ")
+			}
+		} else if ok, err := p.imgselect(ctx, sc, args); !ok || err != nil {
+			return ok, err
+		} else {
+			// Only freshly fetched URIs are checked for being a
+			// script, so kernels are not downloaded while parsing.
+			probe = true
+		}
+	}
+	if p.selected == nil {
+		p.log.Printf("ipxe: %s: no image selected", args[0])
+		return false, nil
+	}
+	_, replace := opts["replace"]
+
+	if probe && isScript(p.selected) {
+		ok, err := p.execScript(ctx, p.selected)
+		if replace {
+			sc.done, sc.status = true, ok
+		}
+		return ok, err
+	}
+
+	if err := p.boot(); err != nil {
+		return false, err
+	}
+	if replace {
+		sc.done = true
+	}
+	// We only know about the image, we did not boot it.
+	return false, nil
+}
+
+// isScript returns whether img is an iPXE script.
+//
+// Only the magic at the start of img is read. img.file caches what it
+// fetched, so a kernel is downloaded once, when it is loaded.
+func isScript(img *image) bool {
+	magic := make([]byte, len("#!ipxe"))
+	n, err := img.file.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return false
+	}
+	return n == len(magic) && string(magic) == "#!ipxe"
+}
+
+// execScript executes the script img and returns whether it succeeded.
+func (p *parser) execScript(ctx context.Context, img *image) (bool, error) {
+	if p.depth >= maxDepth {
+		return false, fmt.Errorf("scripts nested more than %d deep", maxDepth)
+	}
+
+	config, ok := p.scripts[img.url.String()]
+	if !ok {
+		data, err := uio.ReadAll(img.file)
+		if err != nil {
+			p.log.Printf("ipxe: could not read %s: %v", img.url, err)
+			return false, nil
+		}
+		config = string(data)
+		p.scripts[img.url.String()] = config
+	}
+	// The script is no longer needed once it runs.
+	p.free(img)
+
+	p.depth++
+	defer func() { p.depth-- }()
+	return p.exec(ctx, newScript(config, dir(img.url)))
+}
+
+// menu implements menu [--name <name>] [--delete] [<title>].
+func (p *parser) menu(ctx context.Context, sc *script, args []string) (bool, error) {
+	opts, rest, err := getopt(args[1:], options{"n": "name=", "name": "name=", "d": "delete", "delete": "delete"})
+	if err != nil {
+		return false, nil
+	}
+	name := opts["name"]
+	if _, ok := opts["delete"]; ok {
+		delete(p.menus, name)
+		return true, nil
+	}
+	p.menus[name] = &menu{title: strings.Join(rest, " ")}
+	return true, nil
+}
+
+// item implements item [--menu <menu>] [--key <key>] [--default] [--gap]
+// [<label> [<text>...]].
+func (p *parser) item(ctx context.Context, sc *script, args []string) (bool, error) {
+	opts, rest, err := getopt(args[1:], options{
+		"m": "menu=", "menu": "menu=",
+		"k": "key=", "key": "key=",
+		"d": "default", "default": "default",
+		"g": "gap", "gap": "gap",
+	})
+	if err != nil {
+		return false, nil
+	}
+	m, ok := p.menus[opts["menu"]]
+	if !ok {
+		return false, nil
+	}
+	it := item{}
+	_, it.isDefault = opts["default"]
+	_, it.gap = opts["gap"]
+	if len(rest) == 0 {
+		it.gap = true
+	} else if it.gap {
+		it.text = strings.Join(rest, " ")
+	} else {
+		it.label, it.text = rest[0], strings.Join(rest[1:], " ")
+	}
+	m.items = append(m.items, it)
+	return true, nil
+}
+
+// choose implements choose [--menu <menu>] [--default <label>] [--timeout
+// <timeout>] [--keep] <setting>.
+//
+// The default item is chosen, except in the first menu when a different
+// choice was requested.
+func (p *parser) choose(ctx context.Context, sc *script, args []string) (bool, error) {
+	opts, rest, err := getopt(args[1:], options{
+		"m": "menu=", "menu": "menu=",
+		"d": "default=", "default": "default=",
+		"t": "timeout=", "timeout": "timeout=",
+		"k": "keep", "keep": "keep",
+	})
+	if err != nil || len(rest) != 1 {
+		return false, nil
+	}
+	m, ok := p.menus[opts["menu"]]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := opts["keep"]; !ok {
+		delete(p.menus, opts["menu"])
+	}
+
+	want, ok := opts["default"]
+	if p.firstMenu == nil && len(p.choice) > 0 {
+		want, ok = p.choice, true
+	}
+	var chosen *item
+	for i, it := range m.items {
+		if it.gap {
+			continue
+		}
+		if (ok && it.label == want) || (!ok && it.isDefault) {
+			chosen = &m.items[i]
+			break
+		}
+		if chosen == nil {
+			chosen = &m.items[i]
+		}
+	}
+	if chosen == nil {
+		return false, nil
+	}
+
+	if p.firstMenu == nil {
+		m.chosen = chosen.label
+		p.firstMenu = m
+		p.name = chosen.text
+	}
+	p.settings.set(rest[0], chosen.label)
+	return true, nil
+}
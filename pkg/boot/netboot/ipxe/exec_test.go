@@ -0,0 +1,392 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipxe
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/ulog/ulogtest"
+)
+
+// wantImage describes a booted image by URLs rather than content.
+type wantImage struct {
+	name    string
+	kernel  string
+	cmdline string
+	initrds []string
+	modules []string
+}
+
+func fileURL(t *testing.T, f interface{}) string {
+	t.Helper()
+	cf, ok := f.(curl.File)
+	if !ok {
+		t.Fatalf("%v is %T, not a curl.File", f, f)
+	}
+	return cf.URL().String()
+}
+
+func checkImages(t *testing.T, imgs []boot.OSImage, want []wantImage) {
+	t.Helper()
+	if len(imgs) != len(want) {
+		t.Fatalf("got %d images %v, want %d", len(imgs), imgs, len(want))
+	}
+	for i, img := range imgs {
+		var got wantImage
+		switch img := img.(type) {
+		case *boot.LinuxImage:
+			got.name, got.cmdline = img.Name, img.Cmdline
+			got.kernel = fileURL(t, img.Kernel)
+			// CatInitrds names the reader after its parts.
+			if img.Initrd != nil {
+				got.initrds = []string{img.Initrd.(interface{ String() string }).String()}
+			}
+		case *boot.MultibootImage:
+			got.name, got.cmdline = img.Name, img.Cmdline
+			got.kernel = fileURL(t, img.Kernel)
+			for _, m := range img.Modules {
+				got.modules = append(got.modules, m.Cmdline+"="+fileURL(t, m.Module))
+			}
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("image %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestScripts(t *testing.T) {
+	settings := Settings{
+		"net0/mac":  "52:54:00:12:34:56",
+		"net0/ip":   "10.0.0.5",
+		"net0/uuid": "",
+	}
+	for _, tt := range []struct {
+		desc  string
+		files map[string]string
+		want  []wantImage
+	}{
+		{
+			desc: "settings",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+set base http://host/images
+set args console=ttyS0 ip=${ip}
+kernel ${base}/${net0/mac:hexhyp}/vmlinuz ${args} mac=${netX/mac:hexraw}
+boot
+`,
+			},
+			want: []wantImage{
+				{
+					kernel:  "http://host/images/52-54-00-12-34-56/vmlinuz",
+					cmdline: "console=ttyS0 ip=10.0.0.5 mac=525400123456",
+				},
+			},
+		},
+		{
+			desc: "chain with settings in the URL",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+chain next.ipxe?mac=${net0/mac}
+`,
+				"/next.ipxe": `#!ipxe
+kernel /vmlinuz
+initrd /initrd.img
+imgargs vmlinuz quiet
+boot
+`,
+			},
+			want: []wantImage{
+				{
+					kernel:  "http://host/vmlinuz",
+					cmdline: "quiet",
+					initrds: []string{"http://host/initrd.img"},
+				},
+			},
+		},
+		{
+			desc: "chain kernel",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+imgfetch --name rd initrd.img
+chain vmlinuz initrd=rd
+`,
+			},
+			want: []wantImage{
+				{
+					kernel:  "http://host/vmlinuz",
+					cmdline: "initrd=rd",
+					initrds: []string{"http://host/initrd.img"},
+				},
+			},
+		},
+		{
+			desc: "boot fallback",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+:retry
+isset ${hostname} || goto nohost
+kernel /host/${hostname}/vmlinuz
+boot || goto retry
+:nohost
+iseq ${net0/ip} 10.0.0.5 && set hostname five || set hostname other
+kernel /default/vmlinuz
+boot || goto retry
+`,
+			},
+			want: []wantImage{
+				{kernel: "http://host/default/vmlinuz"},
+				{kernel: "http://host/host/five/vmlinuz"},
+			},
+		},
+		{
+			desc: "exit in chained script",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+chain --autofree other.ipxe || goto failed
+kernel vmlinuz-ok
+boot
+:failed
+kernel vmlinuz-failed
+boot
+`,
+				"/other.ipxe": `#!ipxe
+exit 1
+kernel vmlinuz-unreachable
+`,
+			},
+			want: []wantImage{
+				{kernel: "http://host/vmlinuz-failed"},
+			},
+		},
+		{
+			desc: "multiboot",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+kernel xen.gz dom0_mem=1024M
+module vmlinuz root=/dev/sda1
+module initrd.img
+boot
+`,
+			},
+			want: []wantImage{
+				{
+					kernel:  "http://host/xen.gz",
+					cmdline: "dom0_mem=1024M",
+					modules: []string{
+						"vmlinuz root=/dev/sda1=http://host/vmlinuz",
+						"initrd.img=http://host/initrd.img",
+					},
+				},
+			},
+		},
+		{
+			desc: "menu",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+:start
+menu Boot menu
+item --gap Operating systems
+item linux Linux
+item rescue Rescue
+item --gap Tools
+item shell iPXE shell
+item retry Retry
+choose --default rescue --timeout 5000 target && goto ${target}
+
+:linux
+kernel linux/vmlinuz
+boot || goto start
+
+:rescue
+kernel rescue/vmlinuz rescue
+boot || goto start
+
+:shell
+shell
+
+:retry
+goto start
+`,
+			},
+			want: []wantImage{
+				{name: "Rescue", kernel: "http://host/rescue/vmlinuz", cmdline: "rescue"},
+				{name: "Linux", kernel: "http://host/linux/vmlinuz"},
+			},
+		},
+		{
+			desc: "unknown command",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+kernel vmlinuz
+frobnicate
+boot
+`,
+			},
+			want: nil,
+		},
+		{
+			desc: "kernel without boot",
+			files: map[string]string{
+				"/boot.ipxe": `#!ipxe
+dhcp
+kernel vmlinuz
+`,
+			},
+			want: []wantImage{
+				{kernel: "http://host/vmlinuz"},
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			fs := curl.NewMockScheme("http")
+			for path, content := range tt.files {
+				fs.Add("host", path, content)
+			}
+			s := make(curl.Schemes)
+			s.Register(fs.Scheme, fs)
+
+			imgs, err := ParseConfig(context.Background(), ulogtest.Logger{TB: t}, &url.URL{Scheme: "http", Host: "host", Path: "/boot.ipxe"}, s, settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkImages(t, imgs, tt.want)
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	s := Settings{
+		"name":     "mac",
+		"net0/mac": "00:11:22:33:44:55",
+		"greeting": "hello world",
+	}
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{
+		{"${greeting}!", "hello world!"},
+		{"${unset}x", "x"},
+		{"${net0/${name}:hexhyp}", "00-11-22-33-44-55"},
+		{"${mac}", "00:11:22:33:44:55"},
+		{"${greeting:uristring}", "hello%20world"},
+		{"${", "${"},
+	} {
+		if got := expand(tt.in, s); got != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string
+	}{
+		{"kernel  vmlinuz\tquiet", []string{"kernel", "vmlinuz", "quiet"}},
+		{`set msg "hello world" # comment`, []string{"set", "msg", "hello world"}},
+		{`iseq '' x`, []string{"iseq", "", "x"}},
+		{"echo a#b", []string{"echo", "a#b"}},
+	} {
+		got, err := split(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("split(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := split(`echo "foo`); err == nil {
+		t.Errorf("split of unterminated quote succeeded")
+	}
+}
+
+func TestLeaseSettings(t *testing.T) {
+	m, err := dhcpv4.New(
+		dhcpv4.WithYourIP(net.IP{10, 0, 0, 5}),
+		dhcpv4.WithServerIP(net.IP{10, 0, 0, 1}),
+		dhcpv4.WithNetmask(net.IPv4Mask(255, 255, 255, 0)),
+		dhcpv4.WithRouter(net.IP{10, 0, 0, 254}),
+		dhcpv4.WithDNS(net.IP{10, 0, 0, 53}),
+		dhcpv4.WithOption(dhcpv4.OptHostName("node1")),
+		dhcpv4.WithOption(dhcpv4.OptBootFileName("boot.ipxe")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := LeaseSettings(dhclient.NewPacket4(nil, m))
+	want := Settings{
+		"net0/ip":          "10.0.0.5",
+		"net0/netmask":     "255.255.255.0",
+		"net0/gateway":     "10.0.0.254",
+		"net0/dns":         "10.0.0.53",
+		"net0/next-server": "10.0.0.1",
+		"net0/hostname":    "node1",
+		"net0/filename":    "boot.ipxe",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LeaseSettings() = %v, want %v", got, want)
+	}
+}
+
+// readCounter is a MockScheme that counts the bytes read of each URL.
+type readCounter struct {
+	*curl.MockScheme
+	read map[string]int
+}
+
+func (r *readCounter) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
+	f, err := r.MockScheme.Fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReaderAt{ReaderAt: f, read: r.read, url: u.String()}, nil
+}
+
+type countingReaderAt struct {
+	io.ReaderAt
+	read map[string]int
+	url  string
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.ReaderAt.ReadAt(p, off)
+	c.read[c.url] += n
+	return n, err
+}
+
+func TestChainProbe(t *testing.T) {
+	fs := &readCounter{MockScheme: curl.NewMockScheme("http"), read: make(map[string]int)}
+	fs.Add("host", "/boot.ipxe", "#!ipxe\nchain vmlinuz console=ttyS0\n")
+	fs.Add("host", "/vmlinuz", "MZ and a whole lot more kernel")
+	s := make(curl.Schemes)
+	s.Register(fs.Scheme, fs)
+
+	imgs, err := ParseConfig(context.Background(), ulogtest.Logger{TB: t}, &url.URL{Scheme: "http", Host: "host", Path: "/boot.ipxe"}, s, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImages(t, imgs, []wantImage{
+		{kernel: "http://host/vmlinuz", cmdline: "console=ttyS0"},
+	})
+
+	// Checking whether the kernel is a script only reads its magic.
+	kernel := &url.URL{Scheme: "http", Host: "host", Path: "/vmlinuz"}
+	if got, want := fs.read[kernel.String()], len("#!ipxe"); got != want {
+		t.Errorf("read %d bytes of the kernel while parsing, want %d", got, want)
+	}
+
+	// Loading the kernel reuses the fetched file.
+	buf := make([]byte, 100)
+	imgs[0].(*boot.LinuxImage).Kernel.ReadAt(buf, 0)
+	if got := fs.NumCalled(kernel); got != 1 {
+		t.Errorf("kernel was fetched %d times, want 1", got)
+	}
+}
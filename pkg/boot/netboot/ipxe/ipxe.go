@@ -2,7 +2,13 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package ipxe implements a trivial IPXE config file parser.
+// Package ipxe implements an iPXE script interpreter.
+//
+// Scripts are executed like iPXE would, but booting an image only records
+// it and then fails, as if the image could not be booted. Scripts that fall
+// back to other images (boot || goto fallback) thus yield all of them, in
+// order of preference. Menus are explored by running the script once for
+// every item of the first menu shown.
 package ipxe
 
 import (
@@ -15,6 +21,7 @@ import (
 	"strings"
 
 	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/multiboot"
 	"github.com/u-root/u-root/pkg/curl"
 	"github.com/u-root/u-root/pkg/uio"
 	"github.com/u-root/u-root/pkg/ulog"
@@ -26,69 +33,155 @@ var (
 	ErrNotIpxeScript = errors.New("config file is not ipxe as it does not start with #!ipxe")
 )
 
-// parser encapsulates a parsed ipxe configuration file.
-//
-// We currently only support kernel and initrd commands.
+// image is an image downloaded by the script.
+type image struct {
+	name    string
+	url     *url.URL
+	file    io.ReaderAt
+	cmdline string
+
+	// module is set for images loaded with the module command, which
+	// make the boot a multiboot boot.
+	module bool
+}
+
+// parser executes iPXE scripts.
 type parser struct {
-	bootImage *boot.LinuxImage
+	log     ulog.Logger
+	schemes curl.Schemes
 
-	// wd is the current working directory.
-	//
-	// Relative file paths are interpreted relative to this URL.
-	wd *url.URL
+	settings Settings
 
-	log ulog.Logger
+	// images are all images fetched, in order.
+	images []*image
 
-	schemes curl.Schemes
+	// selected is the image the boot command boots.
+	selected *image
+
+	// booted are the images the script tried to boot.
+	booted []boot.OSImage
+
+	// keys identify the images in booted, to detect retry loops.
+	keys     []string
+	bootKeys map[string]bool
+
+	menus map[string]*menu
+
+	// choice is the item to choose in the first menu instead of the
+	// default one.
+	choice string
+
+	// firstMenu is the first menu chosen from, and name the text of the
+	// item chosen in it, which becomes the name of booted images.
+	firstMenu *menu
+	name      string
+
+	// scripts caches scripts by URL, as they are fetched again for every
+	// menu item.
+	scripts map[string]string
+
+	steps int
+	depth int
 }
 
-// ParseConfig returns a new configuration with the file at URL and default
-// schemes.
+// ParseConfig executes the iPXE script at configURL and returns all images
+// it boots.
 //
 // `s` is used to get files referred to by URLs in the configuration.
-func ParseConfig(ctx context.Context, l ulog.Logger, configURL *url.URL, s curl.Schemes) (*boot.LinuxImage, error) {
-	c := &parser{
-		schemes: s,
-		log:     l,
-	}
-	if err := c.getAndParseFile(ctx, configURL); err != nil {
+// settings are available to the script, e.g. as ${net0/mac}; see
+// LeaseSettings.
+func ParseConfig(ctx context.Context, l ulog.Logger, configURL *url.URL, s curl.Schemes, settings Settings) ([]boot.OSImage, error) {
+	p := newParser(l, s, settings, make(map[string]string))
+	config, err := p.getScript(ctx, configURL)
+	if err != nil {
 		return nil, err
 	}
-	return c.bootImage, nil
+	l.Printf("Got ipxe config file %s:\n%s\n", configURL, config)
+
+	p.run(ctx, configURL, config)
+	images := p.booted
+	keys := p.bootKeys
+	if p.firstMenu == nil {
+		return images, nil
+	}
+
+	// The first run took the default menu item, now take the others.
+	for _, it := range p.firstMenu.items {
+		if it.gap || it.label == p.firstMenu.chosen {
+			continue
+		}
+		q := newParser(l, s, settings, p.scripts)
+		q.choice = it.label
+		q.run(ctx, configURL, config)
+		for i, img := range q.booted {
+			if key := q.keys[i]; !keys[key] {
+				keys[key] = true
+				images = append(images, img)
+			}
+		}
+	}
+	return images, nil
 }
 
-// getAndParse parses the config file downloaded from `url` and fills in `c`.
-func (c *parser) getAndParseFile(ctx context.Context, u *url.URL) error {
-	r, err := c.schemes.Fetch(ctx, u)
+func newParser(l ulog.Logger, s curl.Schemes, settings Settings, scripts map[string]string) *parser {
+	p := &parser{
+		log:      l,
+		schemes:  s,
+		settings: defaultSettings(),
+		bootKeys: make(map[string]bool),
+		menus:    make(map[string]*menu),
+		scripts:  scripts,
+	}
+	for k, v := range settings {
+		p.settings[k] = v
+	}
+	return p
+}
+
+// getScript fetches the iPXE script at u.
+func (p *parser) getScript(ctx context.Context, u *url.URL) (string, error) {
+	if config, ok := p.scripts[u.String()]; ok {
+		return config, nil
+	}
+	r, err := p.schemes.Fetch(ctx, u)
 	if err != nil {
-		return err
+		return "", err
 	}
 	data, err := uio.ReadAll(r)
 	if err != nil {
-		return err
+		return "", err
 	}
 	config := string(data)
 	if !strings.HasPrefix(config, "#!ipxe") {
-		return ErrNotIpxeScript
+		return "", ErrNotIpxeScript
 	}
-	c.log.Printf("Got ipxe config file %s:\n%s\n", r, config)
+	p.scripts[u.String()] = config
+	return config, nil
+}
 
-	// Parent dir of the config file.
-	c.wd = &url.URL{
-		Scheme: u.Scheme,
-		Host:   u.Host,
-		Path:   path.Dir(u.Path),
+// run executes the top-level script config fetched from u.
+func (p *parser) run(ctx context.Context, u *url.URL, config string) {
+	sc := newScript(config, dir(u))
+	ok, err := p.exec(ctx, sc)
+	switch {
+	case err == errStop:
+	case err != nil:
+		p.log.Printf("ipxe: stopped executing %s: %v", u, err)
+
+	case ok && !sc.done && p.selected != nil:
+		// Scripts commonly end in boot, but a script that just loads
+		// a kernel is booted too.
+		p.boot()
 	}
-	return c.parseIpxe(config)
 }
 
-// getFile parses `surl` and returns an io.Reader for the requested url.
-func (c *parser) getFile(surl string) (io.ReaderAt, error) {
-	u, err := parseURL(surl, c.wd)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse URL %q: %v", surl, err)
+// dir returns the parent directory of u.
+func dir(u *url.URL) *url.URL {
+	return &url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   path.Dir(u.Path),
 	}
-	return c.schemes.LazyFetch(u)
 }
 
 func parseURL(name string, wd *url.URL) (*url.URL, error) {
@@ -116,62 +209,115 @@ func parseURL(name string, wd *url.URL) (*url.URL, error) {
 	return u, nil
 }
 
-// parseIpxe parses `config` and constructs a BootImage for `c`.
-func (c *parser) parseIpxe(config string) error {
-	// A trivial ipxe script parser.
-	// Currently only supports kernel and initrd commands.
-	c.bootImage = &boot.LinuxImage{}
+// fetch returns an image for the file at name, replacing any image of the
+// same name.
+func (p *parser) fetch(sc *script, name string, opts map[string]string) (*image, error) {
+	u, err := parseURL(name, sc.wd)
+	if err != nil {
+		return nil, err
+	}
+	f, err := p.schemes.LazyFetch(u)
+	if err != nil {
+		return nil, err
+	}
+	img := &image{
+		name: path.Base(u.Path),
+		url:  u,
+		file: f,
+	}
+	if n, ok := opts["name"]; ok {
+		img.name = n
+	}
+	if old := p.image(img.name); old != nil {
+		p.free(old)
+	}
+	p.images = append(p.images, img)
+	return img, nil
+}
 
-	for _, line := range strings.Split(config, "\n") {
-		// Skip blank lines and comment lines.
-		line = strings.TrimSpace(line)
-		if line == "" || line[0] == '#' {
-			continue
+// image returns the image called name.
+func (p *parser) image(name string) *image {
+	for _, img := range p.images {
+		if img.name == name {
+			return img
 		}
+	}
+	return nil
+}
 
-		args := strings.Fields(line)
-		if len(args) == 0 {
-			continue
+// free removes img.
+func (p *parser) free(img *image) {
+	for i, other := range p.images {
+		if other == img {
+			p.images = append(p.images[:i:i], p.images[i+1:]...)
+			break
 		}
-		cmd := strings.ToLower(args[0])
-
-		switch cmd {
-		case "kernel":
-			if len(args) > 1 {
-				k, err := c.getFile(args[1])
-				if err != nil {
-					return err
-				}
-				c.bootImage.Kernel = k
-			}
+	}
+	if p.selected == img {
+		p.selected = nil
+	}
+}
 
-			// Add cmdline if there are any.
-			if len(args) > 2 {
-				c.bootImage.Cmdline = strings.Join(args[2:], " ")
-			}
+// errStop stops the execution of all scripts.
+var errStop = errors.New("stop")
 
-		case "initrd":
-			if len(args) > 1 {
-				var initrds []io.ReaderAt
-				for _, f := range strings.Split(args[1], ",") {
-					i, err := c.getFile(f)
-					if err != nil {
-						return err
-					}
-					initrds = append(initrds, i)
-				}
-				c.bootImage.Initrd = boot.CatInitrds(initrds...)
-			}
+// boot records the selected image as booted. Like iPXE, all other images
+// are passed along: as modules if any were loaded with module, and as
+// initrds otherwise.
+func (p *parser) boot() error {
+	kernel := p.selected
+	var others []*image
+	multi := false
+	key := []string{kernel.url.String(), kernel.cmdline}
+	for _, img := range p.images {
+		if img != kernel {
+			others = append(others, img)
+			multi = multi || img.module
+			key = append(key, img.url.String(), img.cmdline)
+		}
+	}
 
-		case "boot":
-			// Stop parsing at this point, we should go ahead and
-			// boot.
-			return nil
+	// A script that boots the same image twice is retrying. Any
+	// fallbacks have been seen by then.
+	k := strings.Join(key, " ")
+	if p.bootKeys[k] {
+		return errStop
+	}
+	p.bootKeys[k] = true
+	p.keys = append(p.keys, k)
 
-		default:
-			c.log.Printf("Ignoring unsupported ipxe cmd: %s", line)
+	if multi {
+		mi := &boot.MultibootImage{
+			Name:    p.name,
+			Kernel:  kernel.file,
+			Cmdline: kernel.cmdline,
+		}
+		for _, img := range others {
+			cmdline := img.name
+			if len(img.cmdline) > 0 {
+				cmdline += " " + img.cmdline
+			}
+			mi.Modules = append(mi.Modules, multiboot.Module{
+				Module:  img.file,
+				Cmdline: cmdline,
+			})
 		}
+		p.booted = append(p.booted, mi)
+		return nil
 	}
 
+	li := &boot.LinuxImage{
+		Name:    p.name,
+		Kernel:  kernel.file,
+		Cmdline: kernel.cmdline,
+	}
+	if len(others) > 0 {
+		var initrds []io.ReaderAt
+		for _, img := range others {
+			initrds = append(initrds, img.file)
+		}
+		li.Initrd = boot.CatInitrds(initrds...)
+	}
+	p.booted = append(p.booted, li)
 	return nil
 }
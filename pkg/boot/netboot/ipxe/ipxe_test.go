@@ -307,7 +307,7 @@ func TestIpxeConfig(t *testing.T) {
 				Host:   "someplace.com",
 				Path:   "/foobar/pxefiles/ipxeconfig",
 			},
-			want: &boot.LinuxImage{},
+			want: nil,
 		},
 		{
 			desc: "valid config with kernel cmdline args",
@@ -390,7 +390,7 @@ func TestIpxeConfig(t *testing.T) {
 		},
 	} {
 		t.Run(fmt.Sprintf("Test [%02d] %s", i, tt.desc), func(t *testing.T) {
-			got, err := ParseConfig(context.Background(), ulogtest.Logger{t}, tt.curl, tt.schemeFunc())
+			imgs, err := ParseConfig(context.Background(), ulogtest.Logger{TB: t}, tt.curl, tt.schemeFunc(), nil)
 			if !reflect.DeepEqual(err, tt.err) {
 				t.Errorf("ParseConfig() got %v, want %v", err, tt.err)
 				return
@@ -398,6 +398,16 @@ func TestIpxeConfig(t *testing.T) {
 				return
 			}
 			want := tt.want
+			if want == nil {
+				if len(imgs) != 0 {
+					t.Errorf("ParseConfig() = %v, want no images", imgs)
+				}
+				return
+			}
+			if len(imgs) != 1 {
+				t.Fatalf("ParseConfig() = %v, want 1 image", imgs)
+			}
+			got := imgs[0].(*boot.LinuxImage)
 
 			// Same kernel?
 			if !uio.ReaderAtEqual(got.Kernel, want.Kernel) {
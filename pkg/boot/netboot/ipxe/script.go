@@ -0,0 +1,177 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipxe
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// script is an iPXE script being executed.
+type script struct {
+	lines []string
+
+	// pc is the index of the line being executed.
+	pc int
+
+	// done is set by exit to stop the script.
+	done   bool
+	status bool
+
+	// wd is the directory of the script.
+	//
+	// Relative file paths are interpreted relative to this URL.
+	wd *url.URL
+}
+
+// newScript splits config into lines, joining lines that end in a
+// backslash with the next one.
+func newScript(config string, wd *url.URL) *script {
+	s := &script{wd: wd}
+	var cont string
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, "\\") {
+			cont += strings.TrimSuffix(line, "\\")
+			continue
+		}
+		s.lines = append(s.lines, cont+line)
+		cont = ""
+	}
+	if len(cont) > 0 {
+		s.lines = append(s.lines, cont)
+	}
+	return s
+}
+
+// label returns the line index of :name.
+func (s *script) label(name string) (int, bool) {
+	for i, line := range s.lines {
+		if f := strings.Fields(line); len(f) > 0 && f[0] == ":"+name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// maxExpansions bounds setting expansion, as values may expand to further
+// settings.
+const maxExpansions = 1000
+
+// expand replaces ${setting} references in line with their values. Like
+// iPXE, the innermost reference is expanded first, so ${${name}} works, and
+// unknown settings expand to nothing.
+func expand(line string, s Settings) string {
+	for n := 0; n < maxExpansions; n++ {
+		start, end := -1, -1
+		for i := 0; i < len(line); i++ {
+			if strings.HasPrefix(line[i:], "${") {
+				start = i
+			} else if line[i] == '}' && start >= 0 {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			break
+		}
+		v, _ := s.get(line[start+2 : end])
+		line = line[:start] + v + line[end+1:]
+	}
+	return line
+}
+
+// split splits a line into arguments at white space. Quotes group
+// words into one argument, and a # at the start of an argument starts a
+// comment.
+func split(line string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool
+		quote byte
+	)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case c == '#' && !inArg:
+			return args, nil
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// options describes the options a command accepts. Short and long option
+// names map to the canonical name, which ends in "=" if the option takes
+// a value.
+type options map[string]string
+
+var imageOptions = options{
+	"n": "name=", "name": "name=",
+	"t": "timeout=", "timeout": "timeout=",
+	"a": "autofree", "autofree": "autofree",
+	"r": "replace", "replace": "replace",
+}
+
+// getopt parses the options at the start of args and returns them by
+// canonical name together with the remaining arguments.
+func getopt(args []string, spec options) (map[string]string, []string, error) {
+	opts := make(map[string]string)
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		var value string
+		hasValue := false
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value, hasValue = name[:i], name[i+1:], true
+		}
+		canon, ok := spec[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown option %q", arg)
+		}
+		if !strings.HasSuffix(canon, "=") {
+			opts[canon] = ""
+			continue
+		}
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, nil, fmt.Errorf("option %q needs a value", arg)
+			}
+			value, args = args[0], args[1:]
+		}
+		opts[strings.TrimSuffix(canon, "=")] = value
+	}
+	return opts, args, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipxe
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/dhclient"
+)
+
+// Settings are iPXE settings such as "net0/mac" or "hostname".
+//
+// Like in iPXE, a setting without a scope, e.g. "ip", refers to the global
+// setting if there is one and to the net0 setting otherwise. "netX" is an
+// alias for net0, the only interface we know about.
+type Settings map[string]string
+
+// LeaseSettings returns the net0 settings iPXE would have derived from the
+// DHCP lease, e.g. net0/mac, net0/ip and net0/filename.
+func LeaseSettings(lease dhclient.Lease) Settings {
+	s := make(Settings)
+	set := func(name, value string) {
+		if len(value) > 0 {
+			s["net0/"+name] = value
+		}
+	}
+	setIP := func(name string, ip net.IP) {
+		if ip != nil && !ip.IsUnspecified() {
+			set(name, ip.String())
+		}
+	}
+
+	if link := lease.Link(); link != nil {
+		set("mac", link.Attrs().HardwareAddr.String())
+		set("ifname", link.Attrs().Name)
+	}
+
+	p4, p6 := lease.Message()
+	if p4 != nil {
+		setIP("ip", p4.YourIPAddr)
+		if mask := p4.SubnetMask(); mask != nil {
+			setIP("netmask", net.IP(mask))
+		}
+		if r := p4.Router(); len(r) > 0 {
+			setIP("gateway", r[0])
+		}
+		if dns := p4.DNS(); len(dns) > 0 {
+			setIP("dns", dns[0])
+		}
+		setIP("next-server", p4.ServerIPAddr)
+		set("domain", p4.DomainName())
+		set("hostname", p4.HostName())
+		set("root-path", p4.RootPath())
+		if f := strings.TrimRight(p4.BootFileNameOption(), "\x00"); len(f) > 0 {
+			set("filename", f)
+		} else {
+			set("filename", p4.BootFileName)
+		}
+	}
+	if p6 != nil {
+		if dns := p6.Options.DNS(); len(dns) > 0 {
+			setIP("dns6", dns[0])
+		}
+		set("filename", p6.Options.BootFileURL())
+	}
+	return s
+}
+
+// defaultSettings returns the settings iPXE defines on its own.
+func defaultSettings() Settings {
+	s := Settings{
+		"buildarch": runtime.GOARCH,
+		"platform":  "pcbios",
+	}
+	switch runtime.GOARCH {
+	case "amd64":
+		s["buildarch"] = "x86_64"
+	case "386":
+		s["buildarch"] = "i386"
+	case "arm":
+		s["buildarch"] = "arm32"
+	}
+	if _, err := os.Stat("/sys/firmware/efi"); err == nil {
+		s["platform"] = "efi"
+	}
+	return s
+}
+
+// splitType splits a setting name like "net0/mac:hexhyp" into the name and
+// the type. The scope "netX" is resolved to net0.
+func splitType(name string) (string, string) {
+	var typ string
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name, typ = name[:i], name[i+1:]
+	}
+	if strings.HasPrefix(name, "netX/") {
+		name = "net0/" + strings.TrimPrefix(name, "netX/")
+	}
+	return name, typ
+}
+
+// get returns the value of the setting name, which may have a type suffix
+// such as ":hexhyp".
+func (s Settings) get(name string) (string, bool) {
+	name, typ := splitType(name)
+	v, ok := s[name]
+	if !ok && !strings.Contains(name, "/") {
+		v, ok = s["net0/"+name]
+	}
+	if !ok {
+		return "", false
+	}
+
+	switch typ {
+	case "hexhyp":
+		v = strings.Replace(v, ":", "-", -1)
+	case "hexraw":
+		v = strings.Replace(v, ":", "", -1)
+	case "uristring":
+		v = strings.Replace(url.QueryEscape(v), "+", "%20", -1)
+	}
+	return v, true
+}
+
+// set sets the setting name, ignoring any type suffix. An empty value
+// deletes the setting.
+func (s Settings) set(name, value string) {
+	name, _ = splitType(name)
+	if len(value) == 0 {
+		delete(s, name)
+	} else {
+		s[name] = value
+	}
+}
@@ -51,23 +51,18 @@ func BootImages(ctx context.Context, l ulog.Logger, s curl.Schemes, lease dhclie
 	if p4, ok := lease.(*dhclient.Packet4); ok {
 		ip = p4.Lease().IP
 	}
-	return getBootImages(ctx, l, s, uri, lease.Link().Attrs().HardwareAddr, ip), nil
+	return getBootImages(ctx, l, s, uri, lease.Link().Attrs().HardwareAddr, ip, ipxe.LeaseSettings(lease)), nil
 }
 
 // getBootImages attempts to parse the file at uri as an ipxe config and returns
-// the ipxe boot image. Otherwise falls back to pxe and uses the uri directory,
+// the ipxe boot images. Otherwise falls back to pxe and uses the uri directory,
 // ip, and mac address to search for pxe configs.
-func getBootImages(ctx context.Context, l ulog.Logger, schemes curl.Schemes, uri *url.URL, mac net.HardwareAddr, ip net.IP) []boot.OSImage {
-	var images []boot.OSImage
-
+func getBootImages(ctx context.Context, l ulog.Logger, schemes curl.Schemes, uri *url.URL, mac net.HardwareAddr, ip net.IP, settings ipxe.Settings) []boot.OSImage {
 	// Attempt to read the given boot path as an ipxe config file.
-	ipc, err := ipxe.ParseConfig(ctx, l, uri, schemes)
+	images, err := ipxe.ParseConfig(ctx, l, uri, schemes, settings)
 	if err != nil {
 		l.Printf("Parsing boot files as iPXE failed, trying other formats...: %v", err)
 	}
-	if ipc != nil {
-		images = append(images, ipc)
-	}
 
 	// Fallback to pxe boot.
 	wd := &url.URL{
@@ -380,6 +380,16 @@ func (c *parser) append(ctx context.Context, config string) error {
 				e.Initrd = boot.CatInitrds(initrds...)
 			}
 
+		case "fdt", "devicetree":
+			// U-Boot's extlinux.conf extension for arm kernels.
+			if e, ok := c.linuxEntries[c.curEntry]; ok {
+				d, err := c.getFile(arg)
+				if err != nil {
+					return err
+				}
+				e.DTB = d
+			}
+
 		case "append":
 			switch c.scope {
 			case scopeGlobal:
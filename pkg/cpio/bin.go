@@ -0,0 +1,137 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const binMagic = 070707
+
+var (
+	// Bin is the old binary CPIO record format, little-endian.
+	Bin RecordFormat = bin{order: binary.LittleEndian}
+
+	// BinBigEndian is the old binary CPIO record format, big-endian.
+	BinBigEndian RecordFormat = bin{order: binary.BigEndian}
+)
+
+// bin implements RecordFormat for the old binary format, which stores the
+// fields of oldHeader as 16-bit words. Its readers accept either byte order.
+type bin struct {
+	order binary.ByteOrder
+}
+
+// binHeader is the layout of a bin header. 32-bit fields are stored most
+// significant word first, whatever the byte order.
+type binHeader struct {
+	Magic    uint16
+	Dev      uint16
+	Ino      uint16
+	Mode     uint16
+	UID      uint16
+	GID      uint16
+	NLink    uint16
+	Rdev     uint16
+	MTime    [2]uint16
+	NameSize uint16
+	FileSize [2]uint16
+}
+
+func (bin) headerLen() int {
+	return 26
+}
+
+func (bin) align() int64 {
+	return 2
+}
+
+func (b bin) encode(h oldHeader) ([]byte, error) {
+	for _, f := range []struct {
+		name string
+		v    uint64
+		bits uint
+	}{
+		{"dev", h.Dev, 16},
+		{"ino", h.Ino, 16},
+		{"mode", h.Mode, 16},
+		{"uid", h.UID, 16},
+		{"gid", h.GID, 16},
+		{"nlink", h.NLink, 16},
+		{"rdev", h.Rdev, 16},
+		{"mtime", h.MTime, 32},
+		{"namesize", h.NameSize, 16},
+		{"filesize", h.FileSize, 32},
+	} {
+		if err := fits(f.name, f.v, f.bits); err != nil {
+			return nil, err
+		}
+	}
+
+	bh := binHeader{
+		Magic:    binMagic,
+		Dev:      uint16(h.Dev),
+		Ino:      uint16(h.Ino),
+		Mode:     uint16(h.Mode),
+		UID:      uint16(h.UID),
+		GID:      uint16(h.GID),
+		NLink:    uint16(h.NLink),
+		Rdev:     uint16(h.Rdev),
+		MTime:    [2]uint16{uint16(h.MTime >> 16), uint16(h.MTime)},
+		NameSize: uint16(h.NameSize),
+		FileSize: [2]uint16{uint16(h.FileSize >> 16), uint16(h.FileSize)},
+	}
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, b.order, bh); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (bin) decode(b []byte) (oldHeader, error) {
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint16(b) == binMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint16(b) == binMagic:
+		order = binary.BigEndian
+	default:
+		return oldHeader{}, fmt.Errorf("magic got %#x, want %#o in either byte order", b[:2], binMagic)
+	}
+
+	var bh binHeader
+	if err := binary.Read(bytes.NewReader(b), order, &bh); err != nil {
+		return oldHeader{}, err
+	}
+	return oldHeader{
+		Dev:      uint64(bh.Dev),
+		Ino:      uint64(bh.Ino),
+		Mode:     uint64(bh.Mode),
+		UID:      uint64(bh.UID),
+		GID:      uint64(bh.GID),
+		NLink:    uint64(bh.NLink),
+		Rdev:     uint64(bh.Rdev),
+		MTime:    uint64(bh.MTime[0])<<16 | uint64(bh.MTime[1]),
+		NameSize: uint64(bh.NameSize),
+		FileSize: uint64(bh.FileSize[0])<<16 | uint64(bh.FileSize[1]),
+	}, nil
+}
+
+// Reader implements RecordFormat.Reader.
+func (b bin) Reader(r io.ReaderAt) RecordReader {
+	return newOldReader(b, r)
+}
+
+// Writer implements RecordFormat.Writer.
+func (b bin) Writer(w io.Writer) RecordWriter {
+	return newOldWriter(b, w)
+}
+
+func init() {
+	formatMap["bin"] = Bin
+}
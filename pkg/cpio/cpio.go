@@ -4,7 +4,8 @@
 
 // Package cpio implements utilities for reading and writing cpio archives.
 //
-// Currently, only newc-formatted cpio archives are supported through cpio.Newc.
+// The newc, crc, odc and bin record formats are supported through cpio.Newc,
+// cpio.CRC, cpio.ODC and cpio.Bin. Detect finds the format of an archive.
 //
 // Reading from or writing to a file:
 //
@@ -32,6 +33,8 @@
 package cpio
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
@@ -135,6 +138,31 @@ func Format(name string) (RecordFormat, error) {
 	return op, nil
 }
 
+// Detect returns the RecordFormat of the archive in r, judging by the magic
+// number of its first record.
+func Detect(r io.ReaderAt) (RecordFormat, error) {
+	magic := make([]byte, magicLen)
+	n, err := r.ReadAt(magic, 0)
+	if n < 2 {
+		return nil, fmt.Errorf("can not read magic number: %v", err)
+	}
+	magic = magic[:n]
+
+	switch {
+	case bytes.Equal(magic, []byte(newcMagic)):
+		return Newc, nil
+	case bytes.Equal(magic, []byte(crcMagic)):
+		return CRC, nil
+	case bytes.Equal(magic, []byte(odcMagic)):
+		return ODC, nil
+	case binary.LittleEndian.Uint16(magic) == binMagic:
+		return Bin, nil
+	case binary.BigEndian.Uint16(magic) == binMagic:
+		return BinBigEndian, nil
+	}
+	return nil, fmt.Errorf("unknown cpio magic number %q", magic)
+}
+
 func modeFromLinux(mode uint64) os.FileMode {
 	m := os.FileMode(mode & 0777)
 	switch mode & S_IFMT {
@@ -16,12 +16,17 @@ import (
 
 const (
 	newcMagic = "070701"
+	crcMagic  = "070702"
 	magicLen  = 6
 )
 
 var (
 	// Newc is the newc CPIO record format.
 	Newc RecordFormat = newc{magic: newcMagic}
+
+	// CRC is the crc CPIO record format. It is newc with a checksum of
+	// the contents of regular files, which the reader verifies.
+	CRC RecordFormat = newc{magic: crcMagic}
 )
 
 type header struct {
@@ -73,11 +78,33 @@ func (h header) Info() Info {
 	return i
 }
 
-// newc implements RecordFormat for the newc format.
+// newc implements RecordFormat for the newc and crc formats.
 type newc struct {
 	magic string
 }
 
+func (n newc) checksummed() bool {
+	return n.magic == crcMagic
+}
+
+// checksum returns the crc format checksum of r: the sum of its bytes.
+func checksum(r io.Reader) (uint32, error) {
+	var sum uint32
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			sum += uint32(b)
+		}
+		if err == io.EOF {
+			return sum, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
 // round4 returns the next multiple of 4 close to n.
 func round4(n int64) int64 {
 	return (n + 3) &^ 0x3
@@ -127,6 +154,13 @@ func (w *writer) WriteRecord(f Record) error {
 		hdr.FileSize = 0
 	}
 	hdr.CRC = 0
+	if w.n.checksummed() && f.ReaderAt != nil && f.Mode&S_IFMT == S_IFREG {
+		sum, err := checksum(uio.Reader(f))
+		if err != nil {
+			return err
+		}
+		hdr.CRC = sum
+	}
 	if err := binary.Write(buf, binary.BigEndian, hdr); err != nil {
 		return err
 	}
@@ -246,6 +280,15 @@ func (r *reader) ReadRecord() (Record, error) {
 	recLen := uint64(r.pos - recPos)
 	filePos := r.pos
 	content := io.NewSectionReader(r.r, r.pos, int64(hdr.FileSize))
+	if r.n.checksummed() && info.Mode&S_IFMT == S_IFREG {
+		sum, err := checksum(content)
+		if err != nil {
+			return Record{}, fmt.Errorf("reader: checksumming %q: %v", info.Name, err)
+		}
+		if sum != hdr.CRC {
+			return Record{}, fmt.Errorf("reader: %q has checksum %#x, want %#x", info.Name, sum, hdr.CRC)
+		}
+	}
 	r.pos = round4(r.pos + int64(hdr.FileSize))
 	return Record{
 		Info:     info,
@@ -258,4 +301,5 @@ func (r *reader) ReadRecord() (Record, error) {
 
 func init() {
 	formatMap["newc"] = Newc
+	formatMap["crc"] = CRC
 }
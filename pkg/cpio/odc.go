@@ -0,0 +1,92 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpio
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const odcMagic = "070707"
+
+var (
+	// ODC is the POSIX portable ASCII ("odc") CPIO record format.
+	ODC RecordFormat = odc{}
+)
+
+// odc implements RecordFormat for the odc format, which stores the fields of
+// oldHeader as octal numbers of 6 or 11 digits.
+type odc struct{}
+
+// odcFields are the widths of the odc header fields, in octal digits, in the
+// order they appear.
+var odcFields = []struct {
+	name   string
+	digits int
+	field  func(*oldHeader) *uint64
+}{
+	{"dev", 6, func(h *oldHeader) *uint64 { return &h.Dev }},
+	{"ino", 6, func(h *oldHeader) *uint64 { return &h.Ino }},
+	{"mode", 6, func(h *oldHeader) *uint64 { return &h.Mode }},
+	{"uid", 6, func(h *oldHeader) *uint64 { return &h.UID }},
+	{"gid", 6, func(h *oldHeader) *uint64 { return &h.GID }},
+	{"nlink", 6, func(h *oldHeader) *uint64 { return &h.NLink }},
+	{"rdev", 6, func(h *oldHeader) *uint64 { return &h.Rdev }},
+	{"mtime", 11, func(h *oldHeader) *uint64 { return &h.MTime }},
+	{"namesize", 6, func(h *oldHeader) *uint64 { return &h.NameSize }},
+	{"filesize", 11, func(h *oldHeader) *uint64 { return &h.FileSize }},
+}
+
+func (odc) headerLen() int {
+	return 76
+}
+
+func (odc) align() int64 {
+	return 1
+}
+
+func (odc) encode(h oldHeader) ([]byte, error) {
+	b := []byte(odcMagic)
+	for _, f := range odcFields {
+		v := *f.field(&h)
+		if err := fits(f.name, v, uint(3*f.digits)); err != nil {
+			return nil, err
+		}
+		b = append(b, fmt.Sprintf("%0*o", f.digits, v)...)
+	}
+	return b, nil
+}
+
+func (odc) decode(b []byte) (oldHeader, error) {
+	var h oldHeader
+	if magic := string(b[:magicLen]); magic != odcMagic {
+		return h, fmt.Errorf("magic got %q, want %q", magic, odcMagic)
+	}
+	b = b[magicLen:]
+	for _, f := range odcFields {
+		v, err := strconv.ParseUint(string(b[:f.digits]), 8, 64)
+		if err != nil {
+			return h, fmt.Errorf("%s: %v", f.name, err)
+		}
+		*f.field(&h) = v
+		b = b[f.digits:]
+	}
+	return h, nil
+}
+
+// Reader implements RecordFormat.Reader.
+func (o odc) Reader(r io.ReaderAt) RecordReader {
+	return newOldReader(o, r)
+}
+
+// Writer implements RecordFormat.Writer.
+func (o odc) Writer(w io.Writer) RecordWriter {
+	return newOldWriter(o, w)
+}
+
+func init() {
+	formatMap["odc"] = ODC
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpio
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// oldHeader holds the fields of the odc and bin formats, which differ only in
+// how they are encoded.
+type oldHeader struct {
+	Dev      uint64
+	Ino      uint64
+	Mode     uint64
+	UID      uint64
+	GID      uint64
+	NLink    uint64
+	Rdev     uint64
+	MTime    uint64
+	NameSize uint64
+	FileSize uint64
+}
+
+// oldFormat encodes and decodes oldHeaders.
+type oldFormat interface {
+	// headerLen is the length of an encoded header.
+	headerLen() int
+
+	// align is what the header plus name, and the file contents, are
+	// padded to a multiple of.
+	align() int64
+
+	encode(h oldHeader) ([]byte, error)
+	decode(b []byte) (oldHeader, error)
+}
+
+// mkdev encodes a device number like glibc's makedev, which is how Linux
+// cpio implementations store device numbers in the old formats.
+func mkdev(major, minor uint64) uint64 {
+	return (major&0xfff)<<8 | (major&^0xfff)<<32 | minor&0xff | (minor&^0xff)<<12
+}
+
+// splitdev decodes a device number encoded by mkdev.
+func splitdev(dev uint64) (major, minor uint64) {
+	return (dev>>8)&0xfff | (dev>>32)&^0xfff, dev&0xff | (dev>>12)&^0xff
+}
+
+// fits returns an error if v does not fit into a field of bits bits.
+func fits(name string, v uint64, bits uint) error {
+	if v >= 1<<bits {
+		return fmt.Errorf("%s %d does not fit into %d bits", name, v, bits)
+	}
+	return nil
+}
+
+func roundUp(n, align int64) int64 {
+	return (n + align - 1) / align * align
+}
+
+type inodeKey struct {
+	major, minor, ino uint64
+}
+
+type oldWriter struct {
+	f   oldFormat
+	w   io.Writer
+	pos int64
+
+	// inodes renumbers inodes, which rarely fit into the old formats'
+	// small fields, while keeping hard links together.
+	inodes map[inodeKey]uint64
+}
+
+func newOldWriter(f oldFormat, w io.Writer) RecordWriter {
+	return NewDedupWriter(&oldWriter{
+		f:      f,
+		w:      w,
+		inodes: make(map[inodeKey]uint64),
+	})
+}
+
+func (w *oldWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.pos += int64(n)
+	return n, err
+}
+
+func (w *oldWriter) pad() error {
+	if o := roundUp(w.pos, w.f.align()); o != w.pos {
+		if _, err := w.Write(make([]byte, o-w.pos)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *oldWriter) inode(i Info) uint64 {
+	if i.Ino == 0 {
+		return 0
+	}
+	k := inodeKey{i.Major, i.Minor, i.Ino}
+	ino, ok := w.inodes[k]
+	if !ok {
+		ino = uint64(len(w.inodes)) + 1
+		w.inodes[k] = ino
+	}
+	return ino
+}
+
+// WriteRecord implements RecordWriter.
+//
+// Inode numbers are renumbered from 1 in the order they first appear.
+func (w *oldWriter) WriteRecord(f Record) error {
+	h := oldHeader{
+		Dev:      mkdev(f.Major, f.Minor),
+		Ino:      w.inode(f.Info),
+		Mode:     f.Mode,
+		UID:      f.UID,
+		GID:      f.GID,
+		NLink:    f.NLink,
+		Rdev:     mkdev(f.Rmajor, f.Rminor),
+		MTime:    f.MTime,
+		NameSize: uint64(len(f.Name)) + 1,
+		FileSize: f.FileSize,
+	}
+	if f.ReaderAt == nil {
+		h.FileSize = 0
+	}
+	hdr, err := w.f.encode(h)
+	if err != nil {
+		return fmt.Errorf("WriteRecord: %s: %v", f.Name, err)
+	}
+
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	if _, err := w.Write(append([]byte(f.Name), 0)); err != nil {
+		return err
+	}
+	if err := w.pad(); err != nil {
+		return err
+	}
+
+	if f.ReaderAt == nil {
+		return nil
+	}
+	m, err := io.Copy(w, uio.Reader(f))
+	if err != nil {
+		return err
+	}
+	if m != int64(f.FileSize) {
+		return fmt.Errorf("WriteRecord: %s: wrote %d bytes of file instead of %d bytes; archive is now corrupt", f.Name, m, f.FileSize)
+	}
+	if c, ok := f.ReaderAt.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return w.pad()
+}
+
+type oldReader struct {
+	f   oldFormat
+	r   io.ReaderAt
+	pos int64
+}
+
+func newOldReader(f oldFormat, r io.ReaderAt) RecordReader {
+	return EOFReader{&oldReader{f: f, r: r}}
+}
+
+func (r *oldReader) read(p []byte) error {
+	n, err := r.r.ReadAt(p, r.pos)
+	if err == io.EOF && n == 0 {
+		return io.EOF
+	}
+	if n != len(p) {
+		return fmt.Errorf("ReadAt(pos = %d): got %d, want %d bytes; error %v", r.pos, n, len(p), err)
+	}
+	r.pos += int64(n)
+	return nil
+}
+
+// ReadRecord implements RecordReader.
+func (r *oldReader) ReadRecord() (Record, error) {
+	recPos := r.pos
+
+	buf := make([]byte, r.f.headerLen())
+	if err := r.read(buf); err != nil {
+		return Record{}, err
+	}
+	h, err := r.f.decode(buf)
+	if err != nil {
+		return Record{}, fmt.Errorf("reader: %v", err)
+	}
+	if h.NameSize == 0 {
+		return Record{}, fmt.Errorf("reader: record at %d has no name", recPos)
+	}
+
+	name := make([]byte, h.NameSize)
+	if err := r.read(name); err != nil {
+		return Record{}, err
+	}
+	r.pos = roundUp(r.pos, r.f.align())
+
+	info := Info{
+		Ino:      h.Ino,
+		Mode:     h.Mode,
+		UID:      h.UID,
+		GID:      h.GID,
+		NLink:    h.NLink,
+		MTime:    h.MTime,
+		FileSize: h.FileSize,
+		Name:     string(name[:h.NameSize-1]),
+	}
+	info.Major, info.Minor = splitdev(h.Dev)
+	info.Rmajor, info.Rminor = splitdev(h.Rdev)
+
+	recLen := uint64(r.pos - recPos)
+	filePos := r.pos
+	content := io.NewSectionReader(r.r, r.pos, int64(h.FileSize))
+	r.pos = roundUp(r.pos+int64(h.FileSize), r.f.align())
+	return Record{
+		Info:     info,
+		ReaderAt: content,
+		RecLen:   recLen,
+		RecPos:   recPos,
+		FilePos:  filePos,
+	}, nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpio
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func formatTestRecords() []Record {
+	file := StaticRecord([]byte("hello world\n"), Info{
+		Ino:   1,
+		Mode:  S_IFREG | 0644,
+		UID:   1000,
+		GID:   100,
+		NLink: 2,
+		MTime: 1600000000,
+		Major: 8,
+		Minor: 1,
+		Name:  "d/a",
+	})
+	link := file
+	link.Name = "d/hard"
+	odd := StaticRecord([]byte("x"), Info{Ino: 2, Mode: S_IFREG | 0600, NLink: 1, Name: "d/odd"})
+	return []Record{
+		Directory("d", 0755),
+		file,
+		link,
+		odd,
+		Symlink("d/l", "a"),
+		CharDev("dev/null", 0666, 1, 3),
+	}
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	for name, f := range map[string]RecordFormat{
+		"newc":  Newc,
+		"crc":   CRC,
+		"odc":   ODC,
+		"bin":   Bin,
+		"binbe": BinBigEndian,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := f.Writer(&buf)
+			if err := WriteRecords(w, formatTestRecords()); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteTrailer(w); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Detect(bytes.NewReader(buf.Bytes()))
+			if err != nil || got != f {
+				t.Errorf("Detect() = %v, %v, want %v", got, err, f)
+			}
+
+			recs, err := ReadAllRecords(f.Reader(bytes.NewReader(buf.Bytes())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := formatTestRecords(); !AllEqual(recs, want) {
+				t.Errorf("read back\n%v\nwant\n%v", recs, want)
+			}
+		})
+	}
+}
+
+func TestReadBinEitherOrder(t *testing.T) {
+	var buf bytes.Buffer
+	w := BinBigEndian.Writer(&buf)
+	if err := WriteRecords(w, formatTestRecords()); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := ReadAllRecords(Bin.Reader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := formatTestRecords(); !AllEqual(recs, want) {
+		t.Errorf("read back\n%v\nwant\n%v", recs, want)
+	}
+}
+
+func TestOldFormatsRenumberInodes(t *testing.T) {
+	recs := []Record{
+		StaticFile("a", "a", 0644),
+		StaticFile("b", "b", 0644),
+		StaticFile("c", "a", 0644),
+	}
+	recs[0].Ino, recs[1].Ino, recs[2].Ino = 1234567, 7654321, 1234567
+
+	var buf bytes.Buffer
+	if err := WriteRecords(ODC.Writer(&buf), recs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadAllRecords(ODC.Reader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []uint64{1, 2, 1} {
+		if got[i].Ino != want {
+			t.Errorf("%s: ino got %d, want %d", got[i].Name, got[i].Ino, want)
+		}
+	}
+}
+
+func TestOldFormatsOverflow(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		f    RecordFormat
+		info Info
+	}{
+		{name: "bin uid", f: Bin, info: Info{Name: "a", UID: 1 << 16}},
+		{name: "bin mtime", f: Bin, info: Info{Name: "a", MTime: 1 << 32}},
+		{name: "odc gid", f: ODC, info: Info{Name: "a", GID: 1 << 18}},
+		{name: "odc rdev", f: ODC, info: Info{Name: "a", Rmajor: 4096}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.f.Writer(ioutil.Discard).WriteRecord(StaticRecord(nil, tt.info)); err == nil {
+				t.Errorf("WriteRecord(%v) succeeded, want error", tt.info)
+			}
+		})
+	}
+}
+
+func TestCRCMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteRecords(CRC.Writer(&buf), formatTestRecords()); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	i := bytes.Index(b, []byte("hello"))
+	b[i] = 'j'
+
+	if _, err := ReadAllRecords(CRC.Reader(bytes.NewReader(b))); err == nil {
+		t.Errorf("ReadAllRecords() succeeded on corrupted archive, want error")
+	}
+}
+
+// The testdata archives were written by bsdcpio -H odc and -H bin.
+func TestReadBSDCPIO(t *testing.T) {
+	want := map[string]string{
+		"d":      "",
+		"d/a":    "hello world\n",
+		"d/hard": "hello world\n",
+		"d/l":    "a",
+		"d/odd":  "x",
+	}
+	for _, name := range []string{"odc", "bin"} {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open("testdata/" + name + ".cpio")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			format, err := Detect(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recs, err := ReadAllRecords(format.Reader(f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != len(want) {
+				t.Errorf("got %d records, want %d", len(recs), len(want))
+			}
+			for _, r := range recs {
+				content, err := ioutil.ReadAll(io.NewSectionReader(r, 0, int64(r.FileSize)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if w, ok := want[r.Name]; !ok || string(content) != w {
+					t.Errorf("%s: got %q, want %q", r.Name, content, w)
+				}
+			}
+			if recs[0].Mode != S_IFDIR|0755 || recs[3].Mode != S_IFLNK|0777 {
+				t.Errorf("modes got %#o and %#o", recs[0].Mode, recs[3].Mode)
+			}
+			if recs[1].Ino != recs[2].Ino || recs[1].NLink != 2 {
+				t.Errorf("hard link %v and %v do not match", recs[1].Info, recs[2].Info)
+			}
+		})
+	}
+}
+
+func TestDetectUnknown(t *testing.T) {
+	for _, b := range []string{"", "0", "070708", "hello!"} {
+		if f, err := Detect(bytes.NewReader([]byte(b))); err == nil {
+			t.Errorf("Detect(%q) = %v, want error", b, f)
+		}
+	}
+}
@@ -158,7 +158,7 @@ type Config struct {
 	V4ServerAddr *net.UDPAddr
 }
 
-func lease4(ctx context.Context, iface netlink.Link, c Config) (Lease, error) {
+func (c Config) clientOpts4() []nclient4.ClientOpt {
 	mods := []nclient4.ClientOpt{
 		nclient4.WithTimeout(c.Timeout),
 		nclient4.WithRetry(c.Retries),
@@ -172,23 +172,30 @@ func lease4(ctx context.Context, iface netlink.Link, c Config) (Lease, error) {
 	if c.V4ServerAddr != nil {
 		mods = append(mods, nclient4.WithServerAddr(c.V4ServerAddr))
 	}
-	client, err := nclient4.New(iface.Attrs().Name, mods...)
-	if err != nil {
-		return nil, err
-	}
-	defer client.Close()
+	return mods
+}
 
+// modifiers4 returns the modifiers of DHCPv4 requests.
+func (c Config) modifiers4() []dhcpv4.Modifier {
 	// Prepend modifiers with default options, so they can be overriden.
-	reqmods := append(
+	return append(
 		[]dhcpv4.Modifier{
 			dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXE UROOT")),
 			dhcpv4.WithRequestedOptions(dhcpv4.OptionSubnetMask),
 			dhcpv4.WithNetboot,
 		},
 		c.Modifiers4...)
+}
+
+func lease4(ctx context.Context, iface netlink.Link, c Config) (Lease, error) {
+	client, err := nclient4.New(iface.Attrs().Name, c.clientOpts4()...)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
 
 	log.Printf("Attempting to get DHCPv4 lease on %s", iface.Attrs().Name)
-	_, p, err := client.Request(ctx, reqmods...)
+	_, p, err := client.Request(ctx, c.modifiers4()...)
 	if err != nil {
 		return nil, err
 	}
@@ -198,6 +205,33 @@ func lease4(ctx context.Context, iface netlink.Link, c Config) (Lease, error) {
 	return packet, nil
 }
 
+func (c Config) clientOpts6() []nclient6.ClientOpt {
+	mods := []nclient6.ClientOpt{
+		nclient6.WithTimeout(c.Timeout),
+		nclient6.WithRetry(c.Retries),
+	}
+	switch c.LogLevel {
+	case LogSummary:
+		mods = append(mods, nclient6.WithSummaryLogger())
+	case LogDebug:
+		mods = append(mods, nclient6.WithDebugLogger())
+	}
+	if c.V6ServerAddr != nil {
+		mods = append(mods, nclient6.WithBroadcastAddr(c.V6ServerAddr))
+	}
+	return mods
+}
+
+// modifiers6 returns the modifiers of DHCPv6 requests.
+func (c Config) modifiers6() []dhcpv6.Modifier {
+	// Prepend modifiers with default options, so they can be overriden.
+	return append(
+		[]dhcpv6.Modifier{
+			dhcpv6.WithNetboot,
+		},
+		c.Modifiers6...)
+}
+
 func lease6(ctx context.Context, iface netlink.Link, c Config, linkUpTimeout time.Duration) (Lease, error) {
 	// For ipv6, we cannot bind to the port until Duplicate Address
 	// Detection (DAD) is complete which is indicated by the link being no
@@ -224,34 +258,14 @@ func lease6(ctx context.Context, iface netlink.Link, c Config, linkUpTimeout tim
 		}
 	}
 
-	mods := []nclient6.ClientOpt{
-		nclient6.WithTimeout(c.Timeout),
-		nclient6.WithRetry(c.Retries),
-	}
-	switch c.LogLevel {
-	case LogSummary:
-		mods = append(mods, nclient6.WithSummaryLogger())
-	case LogDebug:
-		mods = append(mods, nclient6.WithDebugLogger())
-	}
-	if c.V6ServerAddr != nil {
-		mods = append(mods, nclient6.WithBroadcastAddr(c.V6ServerAddr))
-	}
-	client, err := nclient6.New(iface.Attrs().Name, mods...)
+	client, err := nclient6.New(iface.Attrs().Name, c.clientOpts6()...)
 	if err != nil {
 		return nil, err
 	}
 	defer client.Close()
 
-	// Prepend modifiers with default options, so they can be overriden.
-	reqmods := append(
-		[]dhcpv6.Modifier{
-			dhcpv6.WithNetboot,
-		},
-		c.Modifiers6...)
-
 	log.Printf("Attempting to get DHCPv6 lease on %s", iface.Attrs().Name)
-	p, err := client.RapidSolicit(ctx, reqmods...)
+	p, err := client.RapidSolicit(ctx, c.modifiers6()...)
 	if err != nil {
 		return nil, err
 	}
@@ -280,7 +294,7 @@ func (n NetworkProtocol) String() string {
 	case NetBoth:
 		return "IPv4+IPv6"
 	}
-	return fmt.Sprintf("unknown network protocol (%#x)", n)
+	return fmt.Sprintf("unknown network protocol (%#x)", int(n))
 }
 
 // Result is the result of a particular DHCP attempt.
@@ -5,11 +5,13 @@
 package dhclient
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
@@ -134,6 +136,30 @@ func (p *Packet4) Lease() *net.IPNet {
 	}
 }
 
+// Lifetime returns how long after the lease was granted it should be renewed
+// (T1) and rebound (T2), and when it expires. Without the T1 and T2 options,
+// they are half and seven eighths of the lease time (RFC 2131 Section 4.4.5).
+// Infinite leases return Infinite for all three.
+func (p *Packet4) Lifetime() (t1, t2, valid time.Duration) {
+	valid = p.P.IPAddressLeaseTime(Infinite)
+	if valid >= Infinite {
+		return Infinite, Infinite, Infinite
+	}
+	t1 = p.durationOption(dhcpv4.OptionRenewTimeValue, valid/2)
+	t2 = p.durationOption(dhcpv4.OptionRebindingTimeValue, valid*7/8)
+	return t1, t2, valid
+}
+
+// durationOption returns the option with the given code, a number of
+// seconds, or def if the option is not there.
+func (p *Packet4) durationOption(code dhcpv4.OptionCode, def time.Duration) time.Duration {
+	v := p.P.Options.Get(code)
+	if len(v) != 4 {
+		return def
+	}
+	return time.Duration(binary.BigEndian.Uint32(v)) * time.Second
+}
+
 var (
 	// ErrNoBootFile represents that no pxe boot file was found.
 	ErrNoBootFile = errors.New("no boot file name present in DHCP message")
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 )
@@ -165,3 +166,46 @@ func TestISCSIBoot(t *testing.T) {
 		})
 	}
 }
+
+func TestLifetime4(t *testing.T) {
+	for i, tt := range []struct {
+		message       *dhcpv4.DHCPv4
+		t1, t2, valid time.Duration
+	}{
+		{
+			message: mustNew(t),
+			t1:      Infinite,
+			t2:      Infinite,
+			valid:   Infinite,
+		},
+		{
+			message: mustNew(t, dhcpv4.WithLeaseTime(3600)),
+			t1:      30 * time.Minute,
+			t2:      52*time.Minute + 30*time.Second,
+			valid:   time.Hour,
+		},
+		{
+			message: mustNew(t,
+				dhcpv4.WithLeaseTime(3600),
+				dhcpv4.WithGeneric(dhcpv4.OptionRenewTimeValue, []byte{0, 0, 0x03, 0x84}),
+				dhcpv4.WithGeneric(dhcpv4.OptionRebindingTimeValue, []byte{0, 0, 0x07, 0x08}),
+			),
+			t1:    15 * time.Minute,
+			t2:    30 * time.Minute,
+			valid: time.Hour,
+		},
+		{
+			message: mustNew(t, dhcpv4.WithLeaseTime(0xffffffff)),
+			t1:      Infinite,
+			t2:      Infinite,
+			valid:   Infinite,
+		},
+	} {
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			t1, t2, valid := NewPacket4(nil, tt.message).Lifetime()
+			if t1 != tt.t1 || t2 != tt.t2 || valid != tt.valid {
+				t.Errorf("Lifetime() = (%v, %v, %v), want (%v, %v, %v)", t1, t2, valid, tt.t1, tt.t2, tt.valid)
+			}
+		})
+	}
+}
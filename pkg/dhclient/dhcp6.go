@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
@@ -68,8 +69,8 @@ func (p *Packet6) Configure() error {
 			// "Observed Incorrect Implementation Behavior".)
 			Mask: net.CIDRMask(128, 128),
 		},
-		PreferedLft: int(l.PreferredLifetime),
-		ValidLft:    int(l.ValidLifetime),
+		PreferedLft: int(l.PreferredLifetime / time.Second),
+		ValidLft:    int(l.ValidLifetime / time.Second),
 		// Optimistic DAD (Duplicate Address Detection) means we can
 		// use the address before DAD is complete. The DHCP server's
 		// job was to give us a unique IP so there is little risk of a
@@ -103,6 +104,27 @@ func (p *Packet6) Lease() *dhcpv6.OptIAAddress {
 	return iana.Options.OneAddress()
 }
 
+// Lifetime returns how long after the lease was granted it should be renewed
+// (T1) and rebound (T2), and when its address expires. If the server left T1
+// and T2 to the client, they are half and four fifths of the preferred
+// lifetime (RFC 8415 Section 21.4). Infinite leases return Infinite for all
+// three.
+func (p *Packet6) Lifetime() (t1, t2, valid time.Duration) {
+	l := p.Lease()
+	if l == nil || l.ValidLifetime >= Infinite {
+		return Infinite, Infinite, Infinite
+	}
+	iana := p.p.Options.OneIANA()
+	t1, t2, valid = iana.T1, iana.T2, l.ValidLifetime
+	if t1 == 0 {
+		t1 = l.PreferredLifetime / 2
+	}
+	if t2 == 0 {
+		t2 = l.PreferredLifetime * 4 / 5
+	}
+	return t1, t2, valid
+}
+
 // DNS returns DNS servers assigned.
 func (p *Packet6) DNS() []net.IP {
 	return p.p.Options.DNS()
@@ -0,0 +1,68 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+func TestLifetime6(t *testing.T) {
+	addr := func(preferred, valid time.Duration) *dhcpv6.OptIAAddress {
+		return &dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("fd00::2"), PreferredLifetime: preferred, ValidLifetime: valid}
+	}
+	for i, tt := range []struct {
+		iana          *dhcpv6.OptIANA
+		t1, t2, valid time.Duration
+	}{
+		{
+			iana:  &dhcpv6.OptIANA{},
+			t1:    Infinite,
+			t2:    Infinite,
+			valid: Infinite,
+		},
+		{
+			iana: &dhcpv6.OptIANA{
+				T1:      10 * time.Minute,
+				T2:      20 * time.Minute,
+				Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{addr(30*time.Minute, time.Hour)}},
+			},
+			t1:    10 * time.Minute,
+			t2:    20 * time.Minute,
+			valid: time.Hour,
+		},
+		{
+			iana: &dhcpv6.OptIANA{
+				Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{addr(30*time.Minute, time.Hour)}},
+			},
+			t1:    15 * time.Minute,
+			t2:    24 * time.Minute,
+			valid: time.Hour,
+		},
+		{
+			iana: &dhcpv6.OptIANA{
+				Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{addr(Infinite, Infinite)}},
+			},
+			t1:    Infinite,
+			t2:    Infinite,
+			valid: Infinite,
+		},
+	} {
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			m, err := dhcpv6.NewMessage(dhcpv6.WithOption(tt.iana))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t1, t2, valid := NewPacket6(nil, m).Lifetime()
+			if t1 != tt.t1 || t2 != tt.t2 || valid != tt.valid {
+				t.Errorf("Lifetime() = (%v, %v, %v), want (%v, %v, %v)", t1, t2, valid, tt.t1, tt.t2, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Infinite is the lifetime of leases that never expire.
+const Infinite = 0xffffffff * time.Second
+
+// errRejected means the server declined to extend or confirm a lease: a
+// DHCPv4 NAK, or a DHCPv6 NoBinding or NotOnLink status.
+var errRejected = errors.New("server rejected the lease")
+
+// EventType is what happened to a lease of a LeaseManager.
+type EventType int
+
+// Event types.
+const (
+	// EventBound means a new lease was obtained and configured.
+	EventBound EventType = iota
+
+	// EventRenewed means the lease was extended by the server that
+	// granted it, at T1.
+	EventRenewed
+
+	// EventRebound means the lease was extended by any server, at T2.
+	EventRebound
+
+	// EventExpired means the lease expired, or the server rejected it, and
+	// its address was removed. A new lease is obtained when the link is
+	// up.
+	EventExpired
+
+	// EventReleased means the lease was released and its address removed
+	// because the manager stopped.
+	EventReleased
+
+	// EventLinkDown means the link went down. The lease is kept until it
+	// expires.
+	EventLinkDown
+
+	// EventLinkUp means the link came back up. The lease, if there is
+	// one, is confirmed with the server.
+	EventLinkUp
+
+	// EventConfirmed means the server confirmed the lease after the link
+	// came back up.
+	EventConfirmed
+
+	// EventFailed means obtaining, extending, configuring or releasing a
+	// lease failed. The manager keeps trying until the lease expires.
+	EventFailed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventBound:
+		return "bound"
+	case EventRenewed:
+		return "renewed"
+	case EventRebound:
+		return "rebound"
+	case EventExpired:
+		return "expired"
+	case EventReleased:
+		return "released"
+	case EventLinkDown:
+		return "link down"
+	case EventLinkUp:
+		return "link up"
+	case EventConfirmed:
+		return "confirmed"
+	case EventFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("unknown event type (%d)", int(t))
+}
+
+// Event is something that happened to a lease of a LeaseManager.
+type Event struct {
+	Type EventType
+
+	// Protocol is the IP protocol of the lease.
+	Protocol NetworkProtocol
+
+	// Interface is the network interface of the lease.
+	Interface netlink.Link
+
+	// Lease is the lease the event is about, if there is one.
+	Lease Lease
+
+	// Err is why the lease failed or was rejected.
+	Err error
+}
+
+func (e *Event) String() string {
+	s := fmt.Sprintf("%s %s: %s", e.Interface.Attrs().Name, e.Protocol, e.Type)
+	if e.Lease != nil {
+		s += fmt.Sprintf(": %s", e.Lease)
+	}
+	if e.Err != nil {
+		s += fmt.Sprintf(": %v", e.Err)
+	}
+	return s
+}
+
+// leaseClient is the protocol-specific part of a LeaseManager.
+type leaseClient interface {
+	// obtain gets a new lease.
+	obtain(ctx context.Context) (Lease, error)
+
+	// renew extends l with the server that granted it.
+	renew(ctx context.Context, l Lease) (Lease, error)
+
+	// rebind extends l with any server.
+	rebind(ctx context.Context, l Lease) (Lease, error)
+
+	// confirm checks that l is still valid on the link, after the link
+	// came back up, and returns it or its replacement.
+	confirm(ctx context.Context, l Lease) (Lease, error)
+
+	// release gives l back to the server.
+	release(l Lease) error
+
+	// configure adds l's configuration to the interface, and unconfigure
+	// removes its address.
+	configure(l Lease) error
+	unconfigure(l Lease) error
+}
+
+// LeaseManager obtains leases on links and keeps them: it renews them at T1,
+// rebinds them at T2, obtains new ones when they expire, confirms them when a
+// link comes back up, and releases them when it stops.
+type LeaseManager struct {
+	ifs           []netlink.Link
+	ipv4, ipv6    bool
+	c             Config
+	linkUpTimeout time.Duration
+
+	events chan *Event
+
+	// MinRetry is the least time between attempts to obtain or extend a
+	// lease. Attempts to extend a lease are spread over the time until T2
+	// or expiry, as in RFC 2131 Section 4.4.5.
+	MinRetry time.Duration
+
+	// For tests.
+	newClient func(iface netlink.Link, p NetworkProtocol) leaseClient
+	subscribe func(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error
+	ifUp      func(ifname string, linkUpTimeout time.Duration) (netlink.Link, error)
+}
+
+// NewLeaseManager returns a manager of DHCPv4 leases, if ipv4 is true, and
+// DHCPv6 leases, if ipv6 is true, on each of ifs. Run starts it.
+func NewLeaseManager(ifs []netlink.Link, ipv4, ipv6 bool, c Config, linkUpTimeout time.Duration) *LeaseManager {
+	m := &LeaseManager{
+		ifs:           ifs,
+		ipv4:          ipv4,
+		ipv6:          ipv6,
+		c:             c,
+		linkUpTimeout: linkUpTimeout,
+		events:        make(chan *Event, 3*len(ifs)),
+		MinRetry:      time.Minute,
+		subscribe:     netlink.LinkSubscribe,
+		ifUp:          IfUp,
+	}
+	m.newClient = func(iface netlink.Link, p NetworkProtocol) leaseClient {
+		if p == NetIPv4 {
+			return &client4{iface: iface, c: m.c}
+		}
+		return &client6{iface: iface, c: m.c, linkUpTimeout: m.linkUpTimeout}
+	}
+	return m
+}
+
+// Events returns the events of all leases. It is closed when Run returns.
+//
+// Events must be read until it is closed; the leases wait for their events
+// to be read.
+func (m *LeaseManager) Events() <-chan *Event {
+	return m.events
+}
+
+// Run manages the leases until ctx is done, and then releases them.
+func (m *LeaseManager) Run(ctx context.Context) error {
+	defer close(m.events)
+
+	updates := make(chan netlink.LinkUpdate, 16)
+	done := make(chan struct{})
+	defer close(done)
+	if err := m.subscribe(updates, done); err != nil {
+		return fmt.Errorf("could not subscribe to link updates: %v", err)
+	}
+
+	var protocols []NetworkProtocol
+	if m.ipv4 {
+		protocols = append(protocols, NetIPv4)
+	}
+	if m.ipv6 {
+		protocols = append(protocols, NetIPv6)
+	}
+
+	var wg sync.WaitGroup
+	links := make(map[int][]chan bool)
+	for _, iface := range m.ifs {
+		for _, p := range protocols {
+			// The channel holds the latest state of the link.
+			up := make(chan bool, 1)
+			links[iface.Attrs().Index] = append(links[iface.Attrs().Index], up)
+			s := &leaseState{m: m, iface: iface, protocol: p, client: m.newClient(iface, p)}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.run(ctx, up)
+			}()
+		}
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				updates = nil
+				continue
+			}
+			isUp := u.Attrs().Flags&net.FlagUp != 0 &&
+				(u.Attrs().OperState == netlink.OperUp || u.Attrs().OperState == netlink.OperUnknown)
+			for _, ch := range links[u.Attrs().Index] {
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- isUp
+			}
+
+		case <-finished:
+			return nil
+		}
+	}
+}
+
+// leaseState is the state of the lease of one protocol on one link.
+type leaseState struct {
+	m        *LeaseManager
+	iface    netlink.Link
+	protocol NetworkProtocol
+	client   leaseClient
+
+	up    bool
+	lease Lease
+
+	// renewAt, rebindAt and expireAt are zero for infinite leases.
+	renewAt, rebindAt, expireAt time.Time
+
+	// wake is when to step next, never if zero.
+	wake time.Time
+}
+
+func (s *leaseState) emit(t EventType, l Lease, err error) {
+	s.m.events <- &Event{Type: t, Protocol: s.protocol, Interface: s.iface, Lease: l, Err: err}
+}
+
+func (s *leaseState) run(ctx context.Context, linkUp <-chan bool) {
+	s.up = true
+	if _, err := s.m.ifUp(s.iface.Attrs().Name, s.m.linkUpTimeout); err != nil {
+		s.emit(EventFailed, nil, err)
+		s.up = false
+	}
+	s.wake = time.Now()
+
+	for s.wait(ctx, linkUp) {
+	}
+	if s.lease != nil {
+		if err := s.client.release(s.lease); err != nil {
+			s.emit(EventFailed, s.lease, err)
+		}
+		s.drop(EventReleased, nil)
+	}
+}
+
+// wait waits for the next thing to do and does it. It returns false when ctx
+// is done.
+func (s *leaseState) wait(ctx context.Context, linkUp <-chan bool) bool {
+	var timer <-chan time.Time
+	if !s.wake.IsZero() {
+		t := time.NewTimer(time.Until(s.wake))
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+
+	case up := <-linkUp:
+		if up == s.up {
+			return true
+		}
+		s.up = up
+		if !up {
+			s.emit(EventLinkDown, s.lease, nil)
+			s.wake = s.expireAt
+			return true
+		}
+		s.emit(EventLinkUp, s.lease, nil)
+		if s.lease != nil {
+			switch l, err := s.client.confirm(ctx, s.lease); {
+			case err == errRejected:
+				s.drop(EventExpired, err)
+			case err != nil:
+				// Without an answer, the lease is still ours
+				// (RFC 8415 Section 18.2.3).
+			default:
+				s.bind(l, EventConfirmed)
+			}
+		}
+		s.wake = time.Now()
+
+	case <-timer:
+		s.step(ctx)
+	}
+	return true
+}
+
+// step does what is due: obtaining, renewing or rebinding the lease, or
+// dropping it when it expires.
+func (s *leaseState) step(ctx context.Context) {
+	now := time.Now()
+	switch {
+	case s.lease == nil && !s.up:
+		s.wake = time.Time{}
+
+	case s.lease == nil:
+		l, err := s.client.obtain(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.emit(EventFailed, nil, err)
+			s.wake = time.Now().Add(s.m.MinRetry)
+			return
+		}
+		s.bind(l, EventBound)
+
+	case !s.expireAt.IsZero() && !now.Before(s.expireAt):
+		s.drop(EventExpired, nil)
+		s.wake = now
+
+	case !s.up:
+		s.wake = s.expireAt
+
+	case !s.rebindAt.IsZero() && !now.Before(s.rebindAt):
+		s.extend(ctx, s.client.rebind, EventRebound, s.expireAt)
+
+	case !s.renewAt.IsZero() && !now.Before(s.renewAt):
+		s.extend(ctx, s.client.renew, EventRenewed, s.rebindAt)
+
+	default:
+		s.wake = s.renewAt
+	}
+}
+
+// extend renews or rebinds the lease. If that fails, it tries again after
+// half the time until the deadline, but not sooner than MinRetry, and not
+// later than the deadline.
+func (s *leaseState) extend(ctx context.Context, f func(context.Context, Lease) (Lease, error), t EventType, deadline time.Time) {
+	l, err := f(ctx, s.lease)
+	switch {
+	case err == errRejected:
+		s.drop(EventExpired, err)
+		s.wake = time.Now()
+	case err != nil:
+		s.emit(EventFailed, s.lease, err)
+		now := time.Now()
+		wait := deadline.Sub(now) / 2
+		if wait < s.m.MinRetry {
+			wait = s.m.MinRetry
+		}
+		s.wake = now.Add(wait)
+		if deadline.Before(s.wake) {
+			s.wake = deadline
+		}
+	default:
+		s.bind(l, t)
+	}
+}
+
+// bind configures l, makes it the lease, and emits t.
+func (s *leaseState) bind(l Lease, t EventType) {
+	if err := s.client.configure(l); err != nil {
+		s.emit(EventFailed, l, err)
+	}
+	s.lease = l
+
+	now := time.Now()
+	t1, t2, valid := Infinite, Infinite, Infinite
+	if lt, ok := l.(interface {
+		Lifetime() (t1, t2, valid time.Duration)
+	}); ok {
+		t1, t2, valid = lt.Lifetime()
+	}
+	s.renewAt, s.rebindAt, s.expireAt = after(now, t1), after(now, t2), after(now, valid)
+	s.wake = s.renewAt
+	s.emit(t, l, nil)
+}
+
+// drop removes the lease's address and forgets it.
+func (s *leaseState) drop(t EventType, err error) {
+	if uerr := s.client.unconfigure(s.lease); uerr != nil {
+		s.emit(EventFailed, s.lease, uerr)
+	}
+	s.emit(t, s.lease, err)
+	s.lease = nil
+	s.renewAt, s.rebindAt, s.expireAt = time.Time{}, time.Time{}, time.Time{}
+}
+
+func after(t time.Time, d time.Duration) time.Time {
+	if d >= Infinite {
+		return time.Time{}
+	}
+	return t.Add(d)
+}
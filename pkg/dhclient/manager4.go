@@ -0,0 +1,131 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+	"github.com/vishvananda/netlink"
+)
+
+// client4 keeps DHCPv4 leases, as described in RFC 2131 Section 4.4.
+type client4 struct {
+	iface netlink.Link
+	c     Config
+}
+
+var _ leaseClient = &client4{}
+
+func (c *client4) obtain(ctx context.Context) (Lease, error) {
+	return lease4(ctx, c.iface, c.c)
+}
+
+// server returns the address of the server that granted l.
+func (c *client4) server(l *Packet4) *net.UDPAddr {
+	addr := &net.UDPAddr{IP: l.P.ServerIdentifier(), Port: dhcpv4.ServerPort}
+	if c.c.V4ServerAddr != nil {
+		addr.Port = c.c.V4ServerAddr.Port
+	}
+	if addr.IP == nil {
+		return c.broadcast()
+	}
+	return addr
+}
+
+// broadcast returns the address of all servers.
+func (c *client4) broadcast() *net.UDPAddr {
+	if c.c.V4ServerAddr != nil {
+		return c.c.V4ServerAddr
+	}
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ServerPort}
+}
+
+// request sends a DHCPREQUEST to server and returns the lease in its ACK.
+func (c *client4) request(ctx context.Context, server *net.UDPAddr, mods ...dhcpv4.Modifier) (Lease, error) {
+	client, err := nclient4.New(c.iface.Attrs().Name, c.c.clientOpts4()...)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	mods = append([]dhcpv4.Modifier{
+		dhcpv4.WithHwAddr(c.iface.Attrs().HardwareAddr),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+	}, append(mods, c.c.modifiers4()...)...)
+	req, err := dhcpv4.New(mods...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.SendAndRead(ctx, server, req, func(m *dhcpv4.DHCPv4) bool {
+		return m.MessageType() == dhcpv4.MessageTypeAck || m.MessageType() == dhcpv4.MessageTypeNak
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.MessageType() == dhcpv4.MessageTypeNak {
+		return nil, errRejected
+	}
+	return NewPacket4(c.iface, resp), nil
+}
+
+// renew sends a DHCPREQUEST for l's address to its server, as in the
+// RENEWING state.
+func (c *client4) renew(ctx context.Context, l Lease) (Lease, error) {
+	p := l.(*Packet4)
+	return c.request(ctx, c.server(p), dhcpv4.WithClientIP(p.P.YourIPAddr))
+}
+
+// rebind broadcasts a DHCPREQUEST for l's address, as in the REBINDING
+// state.
+func (c *client4) rebind(ctx context.Context, l Lease) (Lease, error) {
+	p := l.(*Packet4)
+	return c.request(ctx, c.broadcast(), dhcpv4.WithClientIP(p.P.YourIPAddr))
+}
+
+// confirm broadcasts a DHCPREQUEST with l's address as the requested
+// address, as in the INIT-REBOOT state.
+func (c *client4) confirm(ctx context.Context, l Lease) (Lease, error) {
+	p := l.(*Packet4)
+	return c.request(ctx, c.broadcast(), dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(p.P.YourIPAddr)))
+}
+
+// release sends a DHCPRELEASE to l's server. Servers do not answer it.
+func (c *client4) release(l Lease) error {
+	p := l.(*Packet4)
+	msg, err := dhcpv4.New(
+		dhcpv4.WithHwAddr(c.iface.Attrs().HardwareAddr),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRelease),
+		dhcpv4.WithClientIP(p.P.YourIPAddr),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(p.P.ServerIdentifier())),
+	)
+	if err != nil {
+		return err
+	}
+	conn, err := nclient4.NewRawUDPConn(c.iface.Attrs().Name, dhcpv4.ClientPort)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.WriteTo(msg.ToBytes(), c.server(p)); err != nil {
+		return fmt.Errorf("could not send DHCPRELEASE: %v", err)
+	}
+	return nil
+}
+
+func (c *client4) configure(l Lease) error {
+	return l.Configure()
+}
+
+func (c *client4) unconfigure(l Lease) error {
+	addr := &netlink.Addr{IPNet: l.(*Packet4).Lease()}
+	if err := netlink.AddrDel(c.iface, addr); err != nil {
+		return fmt.Errorf("delete %s from %v: %v", addr, c.iface.Attrs().Name, err)
+	}
+	return nil
+}
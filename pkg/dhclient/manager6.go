@@ -0,0 +1,168 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/dhcpv6/nclient6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/vishvananda/netlink"
+)
+
+// client6 keeps DHCPv6 leases, as described in RFC 8415 Section 18.2.
+type client6 struct {
+	iface         netlink.Link
+	c             Config
+	linkUpTimeout time.Duration
+}
+
+var _ leaseClient = &client6{}
+
+func (c *client6) obtain(ctx context.Context) (Lease, error) {
+	return lease6(ctx, c.iface, c.c, c.linkUpTimeout)
+}
+
+// exchange sends a message of type t about l's IA_NA and returns the reply.
+// The message goes to l's server if withServer is true. With
+// zeroLifetimes, the IA_NA's times and the lifetimes of its addresses are
+// zero, as in Confirm and Release messages.
+func (c *client6) exchange(ctx context.Context, l Lease, t dhcpv6.MessageType, withServer, zeroLifetimes bool, mods ...dhcpv6.Modifier) (*dhcpv6.Message, error) {
+	p := l.(*Packet6)
+	cid, na := p.p.Options.ClientID(), p.p.Options.OneIANA()
+	if cid == nil || na == nil {
+		return nil, errors.New("lease has no client ID or IA_NA")
+	}
+
+	msg, err := dhcpv6.NewMessage()
+	if err != nil {
+		return nil, err
+	}
+	msg.MessageType = t
+	msg.AddOption(dhcpv6.OptClientID(*cid))
+	if withServer {
+		sid := p.p.Options.ServerID()
+		if sid == nil {
+			return nil, errors.New("lease has no server ID")
+		}
+		msg.AddOption(dhcpv6.OptServerID(*sid))
+	}
+	msg.AddOption(dhcpv6.OptElapsedTime(0))
+
+	ia := &dhcpv6.OptIANA{IaId: na.IaId, T1: na.T1, T2: na.T2}
+	if zeroLifetimes {
+		ia.T1, ia.T2 = 0, 0
+	}
+	for _, a := range na.Options.Addresses() {
+		addr := &dhcpv6.OptIAAddress{IPv6Addr: a.IPv6Addr, PreferredLifetime: a.PreferredLifetime, ValidLifetime: a.ValidLifetime}
+		if zeroLifetimes {
+			addr.PreferredLifetime, addr.ValidLifetime = 0, 0
+		}
+		ia.Options.Add(addr)
+	}
+	msg.AddOption(ia)
+	for _, mod := range mods {
+		mod(msg)
+	}
+
+	client, err := nclient6.New(c.iface.Attrs().Name, c.c.clientOpts6()...)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	dest := c.c.V6ServerAddr
+	if dest == nil {
+		dest = &net.UDPAddr{IP: dhcpv6.AllDHCPRelayAgentsAndServers, Port: dhcpv6.DefaultServerPort}
+	}
+	return client.SendAndRead(ctx, dest, msg, nclient6.IsMessageType(dhcpv6.MessageTypeReply))
+}
+
+// status returns the status code of the reply to a message about an IA_NA.
+func status(reply *dhcpv6.Message) iana.StatusCode {
+	if s := reply.Options.Status(); s != nil && s.StatusCode != iana.StatusSuccess {
+		return s.StatusCode
+	}
+	if ia := reply.Options.OneIANA(); ia != nil {
+		if s := ia.Options.Status(); s != nil {
+			return s.StatusCode
+		}
+	}
+	return iana.StatusSuccess
+}
+
+// extend sends a Renew or Rebind message for l and returns the extended
+// lease.
+func (c *client6) extend(ctx context.Context, l Lease, t dhcpv6.MessageType) (Lease, error) {
+	reply, err := c.exchange(ctx, l, t, t == dhcpv6.MessageTypeRenew, false, c.c.modifiers6()...)
+	if err != nil {
+		return nil, err
+	}
+	switch s := status(reply); s {
+	case iana.StatusSuccess:
+	case iana.StatusNoBinding, iana.StatusNotOnLink:
+		return nil, errRejected
+	default:
+		return nil, fmt.Errorf("%s: status %s", t, s)
+	}
+	p := NewPacket6(c.iface, reply)
+	if p.Lease() == nil {
+		return nil, errRejected
+	}
+	return p, nil
+}
+
+func (c *client6) renew(ctx context.Context, l Lease) (Lease, error) {
+	return c.extend(ctx, l, dhcpv6.MessageTypeRenew)
+}
+
+func (c *client6) rebind(ctx context.Context, l Lease) (Lease, error) {
+	return c.extend(ctx, l, dhcpv6.MessageTypeRebind)
+}
+
+// confirm sends a Confirm message for l. Any server may answer whether l's
+// addresses are still on the link.
+func (c *client6) confirm(ctx context.Context, l Lease) (Lease, error) {
+	reply, err := c.exchange(ctx, l, dhcpv6.MessageTypeConfirm, false, true)
+	if err != nil {
+		return nil, err
+	}
+	switch s := status(reply); s {
+	case iana.StatusSuccess:
+		return l, nil
+	case iana.StatusNotOnLink:
+		return nil, errRejected
+	default:
+		return nil, fmt.Errorf("CONFIRM: status %s", s)
+	}
+}
+
+// release sends a Release message for l to its server.
+func (c *client6) release(l Lease) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.c.Timeout)
+	defer cancel()
+	_, err := c.exchange(ctx, l, dhcpv6.MessageTypeRelease, true, true)
+	return err
+}
+
+func (c *client6) configure(l Lease) error {
+	return l.Configure()
+}
+
+func (c *client6) unconfigure(l Lease) error {
+	a := l.(*Packet6).Lease()
+	if a == nil {
+		return nil
+	}
+	addr := &netlink.Addr{IPNet: &net.IPNet{IP: a.IPv6Addr, Mask: net.CIDRMask(128, 128)}}
+	if err := netlink.AddrDel(c.iface, addr); err != nil {
+		return fmt.Errorf("delete %s from %v: %v", addr, c.iface.Attrs().Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/vishvananda/netlink"
+)
+
+type fakeLease struct {
+	n             int
+	t1, t2, valid time.Duration
+}
+
+func (l *fakeLease) String() string                           { return fmt.Sprintf("lease %d", l.n) }
+func (l *fakeLease) Configure() error                         { return nil }
+func (l *fakeLease) Boot() (*url.URL, error)                  { return nil, ErrNoBootFile }
+func (l *fakeLease) ISCSIBoot() (*net.TCPAddr, string, error) { return nil, "", ErrNoRootPath }
+func (l *fakeLease) Link() netlink.Link                       { return nil }
+func (l *fakeLease) Message() (*dhcpv4.DHCPv4, *dhcpv6.Message) {
+	return nil, nil
+}
+func (l *fakeLease) Lifetime() (time.Duration, time.Duration, time.Duration) {
+	return l.t1, l.t2, l.valid
+}
+
+// fakeClient grants leases with the lifetimes of lease, and fails the
+// operations with errors set.
+type fakeClient struct {
+	lease fakeLease
+
+	mu         sync.Mutex
+	n          int
+	calls      map[string]int
+	renewErr   error
+	rebindErr  error
+	confirmErr error
+}
+
+func (c *fakeClient) call(op string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	c.calls[op]++
+}
+
+func (c *fakeClient) count(op string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[op]
+}
+
+func (c *fakeClient) grant(err error) (Lease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	c.n++
+	l := c.lease
+	l.n = c.n
+	return &l, nil
+}
+
+func (c *fakeClient) obtain(ctx context.Context) (Lease, error) {
+	c.call("obtain")
+	return c.grant(nil)
+}
+
+func (c *fakeClient) renew(ctx context.Context, l Lease) (Lease, error) {
+	c.call("renew")
+	return c.grant(c.renewErr)
+}
+
+func (c *fakeClient) rebind(ctx context.Context, l Lease) (Lease, error) {
+	c.call("rebind")
+	return c.grant(c.rebindErr)
+}
+
+func (c *fakeClient) confirm(ctx context.Context, l Lease) (Lease, error) {
+	c.call("confirm")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.confirmErr != nil {
+		return nil, c.confirmErr
+	}
+	return l, nil
+}
+
+func (c *fakeClient) release(l Lease) error {
+	c.call("release")
+	return nil
+}
+
+func (c *fakeClient) configure(l Lease) error {
+	c.call("configure")
+	return nil
+}
+
+func (c *fakeClient) unconfigure(l Lease) error {
+	c.call("unconfigure")
+	return nil
+}
+
+var testLink = &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Index: 7, Name: "eth0"}}
+
+// startManager runs a LeaseManager of IPv4 leases on testLink from c. Link
+// updates sent to the returned channel are passed on to the manager.
+func startManager(t *testing.T, c *fakeClient) (*LeaseManager, chan<- netlink.LinkUpdate, context.CancelFunc) {
+	m := NewLeaseManager([]netlink.Link{testLink}, true, false, Config{}, time.Second)
+	m.MinRetry = time.Millisecond
+	m.newClient = func(netlink.Link, NetworkProtocol) leaseClient { return c }
+	m.ifUp = func(string, time.Duration) (netlink.Link, error) { return testLink, nil }
+	updates := make(chan netlink.LinkUpdate)
+	m.subscribe = func(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
+		go func() {
+			for {
+				select {
+				case u := <-updates:
+					ch <- u
+				case <-done:
+					return
+				}
+			}
+		}()
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		if err := m.Run(ctx); err != nil {
+			t.Errorf("Run() = %v", err)
+		}
+	}()
+	return m, updates, cancel
+}
+
+// expect reads events until it has seen want in order, skipping events of
+// other types in between.
+func expect(t *testing.T, events <-chan *Event, want ...EventType) []*Event {
+	t.Helper()
+	var got []*Event
+	timeout := time.After(10 * time.Second)
+	for len(want) > 0 {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed while waiting for %v", want)
+			}
+			if e.Type == want[0] {
+				got = append(got, e)
+				want = want[1:]
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+	return got
+}
+
+// stop stops the manager and checks that it releases the lease.
+func stop(t *testing.T, m *LeaseManager, c *fakeClient, cancel context.CancelFunc) {
+	t.Helper()
+	cancel()
+	var last *Event
+	for e := range m.Events() {
+		last = e
+	}
+	if last == nil || last.Type != EventReleased {
+		t.Errorf("last event = %v, want %v", last, EventReleased)
+	}
+	if c.count("release") != 1 {
+		t.Errorf("release called %d times, want 1", c.count("release"))
+	}
+}
+
+func TestLeaseManagerRenew(t *testing.T) {
+	c := &fakeClient{lease: fakeLease{t1: 20 * time.Millisecond, t2: time.Hour, valid: time.Hour}}
+	m, _, cancel := startManager(t, c)
+
+	got := expect(t, m.Events(), EventBound, EventRenewed, EventRenewed)
+	if got[0].Lease.String() != "lease 1" || got[2].Lease.String() != "lease 3" {
+		t.Errorf("leases = %v, %v, want lease 1, lease 3", got[0].Lease, got[2].Lease)
+	}
+	if got[0].Protocol != NetIPv4 || got[0].Interface != testLink {
+		t.Errorf("event = %v, want IPv4 on %s", got[0], testLink.Name)
+	}
+	stop(t, m, c, cancel)
+	if c.count("rebind") != 0 {
+		t.Errorf("rebind called %d times, want 0", c.count("rebind"))
+	}
+}
+
+func TestLeaseManagerExpire(t *testing.T) {
+	c := &fakeClient{
+		lease:     fakeLease{t1: 20 * time.Millisecond, t2: 50 * time.Millisecond, valid: 100 * time.Millisecond},
+		renewErr:  errors.New("no answer"),
+		rebindErr: errors.New("no answer"),
+	}
+	m, _, cancel := startManager(t, c)
+
+	expect(t, m.Events(), EventBound, EventFailed, EventExpired, EventBound)
+	if n := c.count("renew"); n < 2 {
+		t.Errorf("renew called %d times, want retries", n)
+	}
+	if n := c.count("rebind"); n < 2 {
+		t.Errorf("rebind called %d times, want retries", n)
+	}
+	if n := c.count("unconfigure"); n < 1 {
+		t.Errorf("unconfigure called %d times, want at least 1", n)
+	}
+	stop(t, m, c, cancel)
+}
+
+func TestLeaseManagerRejected(t *testing.T) {
+	c := &fakeClient{
+		lease:    fakeLease{t1: 20 * time.Millisecond, t2: time.Hour, valid: time.Hour},
+		renewErr: errRejected,
+	}
+	m, _, cancel := startManager(t, c)
+
+	got := expect(t, m.Events(), EventBound, EventExpired, EventBound)
+	if got[1].Err != errRejected {
+		t.Errorf("expired event error = %v, want %v", got[1].Err, errRejected)
+	}
+	if c.count("rebind") != 0 {
+		t.Errorf("rebind called %d times, want 0", c.count("rebind"))
+	}
+	stop(t, m, c, cancel)
+}
+
+func linkUpdate(up bool) netlink.LinkUpdate {
+	attrs := netlink.LinkAttrs{Index: testLink.Index, Name: testLink.Name, OperState: netlink.OperDown}
+	if up {
+		attrs.Flags = net.FlagUp
+		attrs.OperState = netlink.OperUp
+	}
+	return netlink.LinkUpdate{Link: &netlink.Dummy{LinkAttrs: attrs}}
+}
+
+func TestLeaseManagerLink(t *testing.T) {
+	c := &fakeClient{lease: fakeLease{t1: Infinite, t2: Infinite, valid: Infinite}}
+	m, updates, cancel := startManager(t, c)
+
+	expect(t, m.Events(), EventBound)
+	updates <- linkUpdate(false)
+	expect(t, m.Events(), EventLinkDown)
+	updates <- linkUpdate(true)
+	expect(t, m.Events(), EventLinkUp, EventConfirmed)
+
+	c.mu.Lock()
+	c.confirmErr = errRejected
+	c.mu.Unlock()
+	updates <- linkUpdate(false)
+	expect(t, m.Events(), EventLinkDown)
+	updates <- linkUpdate(true)
+	got := expect(t, m.Events(), EventLinkUp, EventExpired, EventBound)
+	if got[2].Lease.String() != "lease 2" {
+		t.Errorf("new lease = %v, want lease 2", got[2].Lease)
+	}
+	if n := c.count("confirm"); n != 2 {
+		t.Errorf("confirm called %d times, want 2", n)
+	}
+	stop(t, m, c, cancel)
+}
+
+func TestLeaseManagerExpireWhileDown(t *testing.T) {
+	c := &fakeClient{lease: fakeLease{t1: time.Hour, t2: time.Hour, valid: 50 * time.Millisecond}}
+	m, updates, cancel := startManager(t, c)
+
+	expect(t, m.Events(), EventBound)
+	updates <- linkUpdate(false)
+	expect(t, m.Events(), EventLinkDown, EventExpired)
+	if n := c.count("obtain"); n != 1 {
+		t.Errorf("obtain called %d times while the link was down, want 1", n)
+	}
+	updates <- linkUpdate(true)
+	expect(t, m.Events(), EventLinkUp, EventBound)
+	if n := c.count("confirm"); n != 0 {
+		t.Errorf("confirm called %d times without a lease, want 0", n)
+	}
+	stop(t, m, c, cancel)
+}
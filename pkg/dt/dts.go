@@ -0,0 +1,837 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// ParseDTS compiles device tree source, as printed by PrintDTS or written for
+// dtc, to an FDT.
+//
+// The C preprocessor is not run, so #include and macros are not supported;
+// neither are /include/, character literals and arithmetic expressions in
+// cells. Everything else is: labels, references to them as phandles (&label
+// in cells) or paths (&label elsewhere), /bits/, /delete-node/,
+// /delete-property/ and extending nodes with &label { ... }.
+//
+// As with dtc -@, labelled nodes are given phandles and listed in
+// /__symbols__, so that overlays can be applied to the result. Sources marked /plugin/ are
+// compiled to overlays: &label { ... } becomes a fragment, and references to
+// labels not in the overlay are listed in /__fixups__ to be resolved by
+// ApplyOverlay.
+func ParseDTS(r io.Reader) (*FDT, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &dtsParser{
+		lex: dtsLexer{src: src, line: 1},
+		fdt: &FDT{
+			Header: Header{
+				Magic:           Magic,
+				Version:         17,
+				LastCompVersion: 16,
+			},
+			ReserveEntries: []ReserveEntry{},
+			RootNode:       &Node{},
+		},
+		values: make(map[propKey][]dtsChunk),
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if err := p.resolve(); err != nil {
+		return nil, err
+	}
+	return p.fdt, nil
+}
+
+type dtsTokenKind int
+
+const (
+	dtsEOF dtsTokenKind = iota
+	// dtsWord is a node or property name, or a number.
+	dtsWord
+	// dtsLabel is a label definition, without the colon.
+	dtsLabel
+	// dtsRef is a reference, &label or &{/path}, without the &.
+	dtsRef
+	dtsString
+	// dtsDirective is a keyword such as /dts-v1/, slashes included.
+	dtsDirective
+	// dtsPunct is a single character: one of {}<>[]=;, or / for the root.
+	dtsPunct
+)
+
+type dtsToken struct {
+	kind dtsTokenKind
+	text string
+	line int
+}
+
+func (t dtsToken) String() string {
+	switch t.kind {
+	case dtsEOF:
+		return "end of file"
+	case dtsString:
+		return strconv.Quote(t.text)
+	case dtsLabel:
+		return t.text + ":"
+	case dtsRef:
+		return "&" + t.text
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type dtsLexer struct {
+	src  []byte
+	pos  int
+	line int
+	peek *dtsToken
+}
+
+func isDTSWordChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		strings.IndexByte(",._+*#?@-", c) >= 0
+}
+
+func (l *dtsLexer) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("dts:%d: %s", l.line, fmt.Sprintf(format, v...))
+}
+
+// skipSpace skips white space and comments.
+func (l *dtsLexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '/' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '/':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '*':
+			end := strings.Index(string(l.src[l.pos+2:]), "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			comment := l.src[l.pos : l.pos+2+end+2]
+			l.line += strings.Count(string(comment), "\n")
+			l.pos += len(comment)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *dtsLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.src) && isDTSWordChar(l.src[l.pos]) {
+		l.pos++
+	}
+	return string(l.src[start:l.pos])
+}
+
+// Peek returns the next token without consuming it.
+func (l *dtsLexer) Peek() (dtsToken, error) {
+	if l.peek == nil {
+		t, err := l.scan()
+		if err != nil {
+			return dtsToken{}, err
+		}
+		l.peek = &t
+	}
+	return *l.peek, nil
+}
+
+// Next consumes and returns the next token.
+func (l *dtsLexer) Next() (dtsToken, error) {
+	t, err := l.Peek()
+	l.peek = nil
+	return t, err
+}
+
+func (l *dtsLexer) scan() (dtsToken, error) {
+	if err := l.skipSpace(); err != nil {
+		return dtsToken{}, err
+	}
+	t := dtsToken{line: l.line}
+	if l.pos >= len(l.src) {
+		t.kind = dtsEOF
+		return t, nil
+	}
+
+	switch c := l.src[l.pos]; {
+	case c == '"':
+		l.pos++
+		s, err := l.stringLiteral()
+		t.kind, t.text = dtsString, s
+		return t, err
+
+	case c == '&':
+		l.pos++
+		t.kind = dtsRef
+		if l.pos < len(l.src) && l.src[l.pos] == '{' {
+			end := strings.IndexByte(string(l.src[l.pos:]), '}')
+			if end < 0 {
+				return t, l.errorf("unterminated path reference")
+			}
+			t.text = string(l.src[l.pos+1 : l.pos+end])
+			l.pos += end + 1
+			return t, nil
+		}
+		if t.text = l.word(); t.text == "" {
+			return t, l.errorf("& must be followed by a label or {path}")
+		}
+		return t, nil
+
+	case c == '/':
+		// Either a directive or the root node.
+		end := l.pos + 1
+		for end < len(l.src) && (('a' <= l.src[end] && l.src[end] <= 'z') || l.src[end] == '-' || ('0' <= l.src[end] && l.src[end] <= '9')) {
+			end++
+		}
+		if end > l.pos+1 && end < len(l.src) && l.src[end] == '/' {
+			t.kind, t.text = dtsDirective, string(l.src[l.pos:end+1])
+			l.pos = end + 1
+			return t, nil
+		}
+		l.pos++
+		t.kind, t.text = dtsPunct, "/"
+		return t, nil
+
+	case isDTSWordChar(c) && c != ',':
+		// Names may contain commas, but don't start with one.
+		t.kind, t.text = dtsWord, l.word()
+		if l.pos < len(l.src) && l.src[l.pos] == ':' {
+			l.pos++
+			t.kind = dtsLabel
+		}
+		return t, nil
+
+	case strings.IndexByte("{}<>[]=;,", c) >= 0:
+		l.pos++
+		t.kind, t.text = dtsPunct, string(c)
+		return t, nil
+	}
+	return t, l.errorf("unexpected character %q", l.src[l.pos])
+}
+
+// stringLiteral reads the rest of a string literal after the opening quote.
+func (l *dtsLexer) stringLiteral() (string, error) {
+	var s []byte
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+			return "", l.errorf("unterminated string")
+		}
+		c := l.src[l.pos]
+		l.pos++
+		if c == '"' {
+			return string(s), nil
+		}
+		if c != '\\' {
+			s = append(s, c)
+			continue
+		}
+		if l.pos >= len(l.src) {
+			return "", l.errorf("unterminated string")
+		}
+		c = l.src[l.pos]
+		l.pos++
+		switch c {
+		case 'a':
+			s = append(s, '\a')
+		case 'b':
+			s = append(s, '\b')
+		case 'f':
+			s = append(s, '\f')
+		case 'n':
+			s = append(s, '\n')
+		case 'r':
+			s = append(s, '\r')
+		case 't':
+			s = append(s, '\t')
+		case 'v':
+			s = append(s, '\v')
+		case 'x':
+			n := 0
+			for n < 2 && l.pos+n < len(l.src) && strings.IndexByte("0123456789abcdefABCDEF", l.src[l.pos+n]) >= 0 {
+				n++
+			}
+			if n == 0 {
+				return "", l.errorf("\\x must be followed by hex digits")
+			}
+			v, _ := strconv.ParseUint(string(l.src[l.pos:l.pos+n]), 16, 8)
+			s = append(s, byte(v))
+			l.pos += n
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := 1
+			for n < 3 && l.pos-1+n < len(l.src) && '0' <= l.src[l.pos-1+n] && l.src[l.pos-1+n] <= '7' {
+				n++
+			}
+			v, err := strconv.ParseUint(string(l.src[l.pos-1:l.pos-1+n]), 8, 8)
+			if err != nil {
+				return "", l.errorf("bad octal escape: %v", err)
+			}
+			s = append(s, byte(v))
+			l.pos += n - 1
+		default:
+			// Includes \\ and \".
+			s = append(s, c)
+		}
+	}
+}
+
+// dtsChunk is part of a property value: either literal data or a reference
+// to be resolved once the whole tree is known.
+type dtsChunk struct {
+	data []byte
+
+	// ref is a label, or a path if it starts with "/".
+	ref string
+	// path means ref is replaced with the path of the node it refers to,
+	// rather than its phandle.
+	path bool
+	line int
+}
+
+type propKey struct {
+	node *Node
+	name string
+}
+
+type dtsLabelDef struct {
+	name string
+	node *Node
+}
+
+type dtsParser struct {
+	lex    dtsLexer
+	fdt    *FDT
+	plugin bool
+
+	// labels are the node labels in order of definition.
+	labels []dtsLabelDef
+
+	// values are the property values. Properties are added to their node
+	// when they are parsed, and their values filled in by resolve.
+	values map[propKey][]dtsChunk
+
+	fragments int
+}
+
+func (p *dtsParser) expect(text string) error {
+	t, err := p.lex.Next()
+	if err != nil {
+		return err
+	}
+	if t.kind != dtsPunct && t.kind != dtsDirective || t.text != text {
+		return fmt.Errorf("dts:%d: expected %q, got %v", t.line, text, t)
+	}
+	return nil
+}
+
+func (p *dtsParser) expectWord() (dtsToken, error) {
+	t, err := p.lex.Next()
+	if err != nil {
+		return t, err
+	}
+	if t.kind != dtsWord {
+		return t, fmt.Errorf("dts:%d: expected a name or number, got %v", t.line, t)
+	}
+	return t, nil
+}
+
+func (p *dtsParser) label(name string) *Node {
+	for i := len(p.labels) - 1; i >= 0; i-- {
+		if p.labels[i].name == name {
+			return p.labels[i].node
+		}
+	}
+	return nil
+}
+
+// lookup returns the node a reference to a label or path refers to.
+func (p *dtsParser) lookup(ref string) (*Node, bool) {
+	if strings.HasPrefix(ref, "/") {
+		return p.fdt.NodeByPath(ref)
+	}
+	n := p.label(ref)
+	return n, n != nil
+}
+
+func (p *dtsParser) parse() error {
+	if err := p.expect("/dts-v1/"); err != nil {
+		return err
+	}
+	if err := p.expect(";"); err != nil {
+		return err
+	}
+
+	for {
+		t, err := p.lex.Next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case t.kind == dtsEOF:
+			return nil
+
+		case t.kind == dtsDirective && t.text == "/dts-v1/":
+			err = p.expect(";")
+
+		case t.kind == dtsDirective && t.text == "/plugin/":
+			p.plugin = true
+			err = p.expect(";")
+
+		case t.kind == dtsDirective && t.text == "/memreserve/":
+			var r ReserveEntry
+			if r.Address, err = p.number(64); err != nil {
+				return err
+			}
+			if r.Size, err = p.number(64); err != nil {
+				return err
+			}
+			p.fdt.ReserveEntries = append(p.fdt.ReserveEntries, r)
+			err = p.expect(";")
+
+		case t.kind == dtsDirective && t.text == "/delete-node/":
+			ref, err := p.lex.Next()
+			if err != nil {
+				return err
+			}
+			if ref.kind != dtsRef {
+				return fmt.Errorf("dts:%d: expected a reference, got %v", ref.line, ref)
+			}
+			n, ok := p.lookup(ref.text)
+			if !ok {
+				return fmt.Errorf("dts:%d: reference to undefined node %v", ref.line, ref)
+			}
+			if parent, ok := p.fdt.parent(n); ok {
+				parent.Children = removeNode(parent.Children, n)
+			}
+			err = p.expect(";")
+
+		case t.kind == dtsPunct && t.text == "/":
+			err = p.parseNode(p.fdt.RootNode)
+
+		case t.kind == dtsRef && p.plugin:
+			err = p.parseFragment(t)
+
+		case t.kind == dtsRef:
+			n, ok := p.lookup(t.text)
+			if !ok {
+				return fmt.Errorf("dts:%d: reference to undefined node %v", t.line, t)
+			}
+			err = p.parseNode(n)
+
+		default:
+			return fmt.Errorf("dts:%d: unexpected %v", t.line, t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseFragment wraps the body of an &label { ... } or &{/path} { ... } in an
+// overlay fragment, as dtc does.
+func (p *dtsParser) parseFragment(target dtsToken) error {
+	frag := &Node{Name: fmt.Sprintf("fragment@%d", p.fragments)}
+	p.fragments++
+	if err := p.fdt.RootNode.AddChild(frag); err != nil {
+		return fmt.Errorf("dts:%d: %v", target.line, err)
+	}
+	if strings.HasPrefix(target.text, "/") {
+		frag.SetString("target-path", target.text)
+	} else {
+		frag.UpdateProperty("target", nil)
+		p.values[propKey{frag, "target"}] = []dtsChunk{{ref: target.text, line: target.line}}
+	}
+	overlay := &Node{Name: "__overlay__"}
+	frag.Children = append(frag.Children, overlay)
+	return p.parseNode(overlay)
+}
+
+// parseNode parses a node body, including the closing semicolon, into n.
+// Properties and children n already has are overridden or merged.
+func (p *dtsParser) parseNode(n *Node) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for {
+		var labels []string
+		t, err := p.lex.Next()
+		for err == nil && t.kind == dtsLabel {
+			labels = append(labels, t.text)
+			t, err = p.lex.Next()
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case t.kind == dtsPunct && t.text == "}":
+			return p.expect(";")
+
+		case t.kind == dtsDirective && t.text == "/delete-node/":
+			name, err := p.expectWord()
+			if err != nil {
+				return err
+			}
+			n.RemoveChild(name.text)
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+
+		case t.kind == dtsDirective && t.text == "/delete-property/":
+			name, err := p.expectWord()
+			if err != nil {
+				return err
+			}
+			n.RemoveProperty(name.text)
+			delete(p.values, propKey{n, name.text})
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+
+		case t.kind == dtsWord:
+			next, err := p.lex.Peek()
+			if err != nil {
+				return err
+			}
+			if next.kind == dtsPunct && next.text == "{" {
+				c, ok := n.Child(t.text)
+				if !ok {
+					c = &Node{Name: t.text}
+					n.Children = append(n.Children, c)
+				}
+				for _, l := range labels {
+					p.labels = append(p.labels, dtsLabelDef{l, c})
+				}
+				if err := p.parseNode(c); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := p.parseProperty(n, t.text); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("dts:%d: unexpected %v in node %q", t.line, t, n.Name)
+		}
+	}
+}
+
+// parseProperty parses a property value, if any, and the semicolon after it.
+func (p *dtsParser) parseProperty(n *Node, name string) error {
+	chunks := []dtsChunk{}
+	t, err := p.lex.Next()
+	if err != nil {
+		return err
+	}
+	if t.kind == dtsPunct && t.text == "=" {
+		for {
+			c, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, c...)
+			if t, err = p.lex.Next(); err != nil {
+				return err
+			}
+			if t.kind != dtsPunct || t.text != "," {
+				break
+			}
+		}
+	}
+	if t.kind != dtsPunct || t.text != ";" {
+		return fmt.Errorf("dts:%d: expected \";\" after property %q, got %v", t.line, name, t)
+	}
+	n.UpdateProperty(name, nil)
+	p.values[propKey{n, name}] = chunks
+	return nil
+}
+
+// parseValue parses one comma-separated part of a property value.
+func (p *dtsParser) parseValue() ([]dtsChunk, error) {
+	t, err := p.lex.Next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.kind == dtsString:
+		return []dtsChunk{{data: append([]byte(t.text), 0)}}, nil
+
+	case t.kind == dtsRef:
+		return []dtsChunk{{ref: t.text, path: true, line: t.line}}, nil
+
+	case t.kind == dtsPunct && t.text == "<":
+		return p.parseCells(32)
+
+	case t.kind == dtsDirective && t.text == "/bits/":
+		w, err := p.expectWord()
+		if err != nil {
+			return nil, err
+		}
+		bits, err := strconv.Atoi(w.text)
+		if err != nil || (bits != 8 && bits != 16 && bits != 32 && bits != 64) {
+			return nil, fmt.Errorf("dts:%d: /bits/ must be 8, 16, 32 or 64, not %v", w.line, w)
+		}
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		return p.parseCells(bits)
+
+	case t.kind == dtsPunct && t.text == "[":
+		var data []byte
+		for {
+			t, err := p.lex.Next()
+			if err != nil {
+				return nil, err
+			}
+			if t.kind == dtsPunct && t.text == "]" {
+				return []dtsChunk{{data: data}}, nil
+			}
+			if t.kind == dtsLabel {
+				continue
+			}
+			b, err := hex.DecodeString(t.text)
+			if t.kind != dtsWord || err != nil {
+				return nil, fmt.Errorf("dts:%d: expected hex bytes, got %v", t.line, t)
+			}
+			data = append(data, b...)
+		}
+	}
+	return nil, fmt.Errorf("dts:%d: expected a property value, got %v", t.line, t)
+}
+
+// parseCells parses the cells of a <...> value after the <.
+func (p *dtsParser) parseCells(bits int) ([]dtsChunk, error) {
+	var chunks []dtsChunk
+	data := []byte{}
+	for {
+		t, err := p.lex.Peek()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case t.kind == dtsPunct && t.text == ">":
+			p.lex.Next()
+			return append(chunks, dtsChunk{data: data}), nil
+
+		case t.kind == dtsLabel:
+			p.lex.Next()
+
+		case t.kind == dtsRef:
+			p.lex.Next()
+			if bits != 32 {
+				return nil, fmt.Errorf("dts:%d: references are only allowed in 32-bit cells", t.line)
+			}
+			chunks = append(chunks, dtsChunk{data: data}, dtsChunk{ref: t.text, line: t.line})
+			data = []byte{}
+
+		default:
+			v, err := p.number(bits)
+			if err != nil {
+				return nil, err
+			}
+			switch bits {
+			case 8:
+				data = append(data, byte(v))
+			case 16:
+				data = append(data, 0, 0)
+				binary.BigEndian.PutUint16(data[len(data)-2:], uint16(v))
+			case 32:
+				data = append(data, 0, 0, 0, 0)
+				binary.BigEndian.PutUint32(data[len(data)-4:], uint32(v))
+			case 64:
+				data = append(data, 0, 0, 0, 0, 0, 0, 0, 0)
+				binary.BigEndian.PutUint64(data[len(data)-8:], v)
+			}
+		}
+	}
+}
+
+// number parses an integer that fits in the given number of bits. As in C,
+// 0x starts a hex number and 0 an octal one; negative numbers are two's
+// complement.
+func (p *dtsParser) number(bits int) (uint64, error) {
+	t, err := p.expectWord()
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimRight(strings.ToUpper(t.text), "UL")
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	v, err := strconv.ParseUint(s, 0, bits)
+	if err != nil {
+		return 0, fmt.Errorf("dts:%d: bad %d-bit number %v", t.line, bits, t)
+	}
+	if neg {
+		v = -v & (1<<uint(bits) - 1)
+	}
+	return v, nil
+}
+
+func removeNode(nodes []*Node, n *Node) []*Node {
+	for i, c := range nodes {
+		if c == n {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+// resolve fills in the property values, now that every node and label is
+// known, and adds /__symbols__ and, for overlays, /__fixups__ and
+// /__local_fixups__.
+func (p *dtsParser) resolve() error {
+	// Fill in values without references first, so that phandles given
+	// explicitly are known before new ones are assigned.
+	for k, chunks := range p.values {
+		if len(chunks) == 1 && chunks[0].ref == "" || len(chunks) == 0 {
+			if prop, ok := k.node.LookProperty(k.name); ok {
+				prop.Value = []byte{}
+				if len(chunks) == 1 {
+					prop.Value = append(prop.Value, chunks[0].data...)
+				}
+			}
+		}
+	}
+	paths := p.fdt.paths()
+	nextPHandle := p.fdt.MaxPHandle() + 1
+
+	// Only labels of nodes still in the tree count.
+	var labels []dtsLabelDef
+	for _, l := range p.labels {
+		if _, ok := paths[l.node]; ok {
+			labels = append(labels, l)
+		}
+	}
+	p.labels = labels
+
+	type fixup struct {
+		path, prop string
+		off        int
+	}
+	var fixups []fixup
+	fixupLabels := map[string][]string{}
+	var fixupOrder []string
+
+	var err error
+	p.fdt.RootNode.Walk(func(n *Node) error {
+		for i := range n.Properties {
+			prop := &n.Properties[i]
+			chunks, ok := p.values[propKey{n, prop.Name}]
+			if !ok {
+				continue
+			}
+			value := []byte{}
+			for _, c := range chunks {
+				if c.ref == "" {
+					value = append(value, c.data...)
+					continue
+				}
+				target, ok := p.lookup(c.ref)
+				switch {
+				case !ok && p.plugin && !c.path && !strings.HasPrefix(c.ref, "/"):
+					// Resolved by ApplyOverlay.
+					ref := fmt.Sprintf("%s:%s:%d", paths[n], prop.Name, len(value))
+					if _, ok := fixupLabels[c.ref]; !ok {
+						fixupOrder = append(fixupOrder, c.ref)
+					}
+					fixupLabels[c.ref] = append(fixupLabels[c.ref], ref)
+					value = append(value, 0xff, 0xff, 0xff, 0xff)
+				case !ok:
+					err = fmt.Errorf("dts:%d: reference to undefined node &%s", c.line, c.ref)
+					return err
+				case c.path:
+					value = append(value, paths[target]...)
+					value = append(value, 0)
+				default:
+					ph, ok := target.PHandle()
+					if !ok {
+						ph = nextPHandle
+						nextPHandle++
+						target.SetPHandle("phandle", ph)
+					}
+					if p.plugin {
+						fixups = append(fixups, fixup{paths[n], prop.Name, len(value)})
+					}
+					value = append(value, 0, 0, 0, 0)
+					binary.BigEndian.PutUint32(value[len(value)-4:], uint32(ph))
+				}
+			}
+			// SetPHandle above may have appended to n.Properties.
+			n.Properties[i].Value = value
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	root := p.fdt.RootNode
+	if len(p.labels) > 0 {
+		symbols := childOrNew(root, "__symbols__")
+		for _, l := range p.labels {
+			symbols.SetString(l.name, paths[l.node])
+			// Overlays refer to labelled nodes by phandle.
+			if _, ok := l.node.PHandle(); !ok {
+				l.node.SetPHandle("phandle", nextPHandle)
+				nextPHandle++
+			}
+		}
+	}
+	if len(fixupOrder) > 0 {
+		n := childOrNew(root, "__fixups__")
+		for _, l := range fixupOrder {
+			n.SetStringList(l, fixupLabels[l]...)
+		}
+	}
+	if len(fixups) > 0 {
+		local := childOrNew(root, "__local_fixups__")
+		for _, f := range fixups {
+			n := local
+			for _, name := range strings.Split(f.path, "/") {
+				if name != "" {
+					n = childOrNew(n, name)
+				}
+			}
+			off := make([]byte, 4)
+			binary.BigEndian.PutUint32(off, uint32(f.off))
+			if prop, ok := n.LookProperty(f.prop); ok {
+				prop.Value = append(prop.Value, off...)
+			} else {
+				n.UpdateProperty(f.prop, off)
+			}
+		}
+	}
+	return nil
+}
+
+// childOrNew returns the named child of n, adding it if n has none.
+func childOrNew(n *Node, name string) *Node {
+	if c, ok := n.Child(name); ok {
+		return c
+	}
+	c := &Node{Name: name}
+	n.Children = append(n.Children, c)
+	return c
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrintParseRoundTrip(t *testing.T) {
+	f, err := os.Open("testdata/fdt.dtb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := ReadFDT(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cover the values that are neither strings nor cells.
+	want.ReserveEntries = append(want.ReserveEntries, ReserveEntry{Address: 0x40000000, Size: 0x1000})
+	want.RootNode.UpdateProperty("odd", []byte{1, 2, 3})
+	want.RootNode.UpdateProperty("quoted", []byte("a \"b\" \\c\x00\x00"))
+
+	var dts bytes.Buffer
+	if err := want.PrintDTS(&dts); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseDTS(&dts)
+	if err != nil {
+		t.Fatalf("ParseDTS(PrintDTS()) = %v; dts:\n%s", err, dts.String())
+	}
+	if !reflect.DeepEqual(got.ReserveEntries, want.ReserveEntries) {
+		t.Errorf("reserve entries = %v, want %v", got.ReserveEntries, want.ReserveEntries)
+	}
+	if !reflect.DeepEqual(got.RootNode, want.RootNode) {
+		var gotDTS bytes.Buffer
+		got.PrintDTS(&gotDTS)
+		t.Errorf("ParseDTS(PrintDTS()) =\n%s\nwant\n%s", gotDTS.String(), dts.String())
+	}
+
+	var wantDTB, gotDTB bytes.Buffer
+	if _, err := want.Write(&wantDTB); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := got.Write(&gotDTB); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotDTB.Bytes(), wantDTB.Bytes()) {
+		t.Errorf("compiled DTB differs from the original")
+	}
+}
+
+func TestParseDTS(t *testing.T) {
+	const src = `/dts-v1/;
+/memreserve/ 0x1000 4096;
+
+/* The root. */
+/ {
+	#address-cells = <2>;
+	compatible = "acme,board", "acme,soc";
+	model = "Acme \x41\102 board\n";
+	interrupt-parent = <&gic>;
+
+	gic: interrupt-controller@8000000 {
+		interrupt-controller;
+		reg = <0x0 0x8000000 0x0 0x10000>;
+	};
+
+	uart0: serial@9000000 {
+		clocks = <&clk 1>, <&clk 2>;
+		mac = [00 11 2233];
+		bits8 = /bits/ 8 <1 0xff>;
+		bits16 = /bits/ 16 <0x1234>;
+		bits64 = /bits/ 64 <0x123456789>;
+		neg = <(-1)>;
+		status = "disabled";
+	};
+
+	clk: clock {
+		phandle = <7>;
+	};
+
+	aliases {
+		serial0 = &uart0;
+		bypath = &{/clock};
+	};
+
+	old {
+	};
+};
+
+&uart0 {
+	status = "okay";
+	/delete-property/ bits16;
+};
+
+/ {
+	/delete-node/ old;
+	chosen {
+		stdout-path = "serial0:115200n8";
+	};
+};
+`
+	_, err := ParseDTS(strings.NewReader(src))
+	if err == nil || !strings.Contains(err.Error(), "dts:22:") {
+		t.Fatalf("ParseDTS() = %v, want an error about the expression on line 22", err)
+	}
+
+	fdt, err := ParseDTS(strings.NewReader(strings.Replace(src, "<(-1)>", "<-1>", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []ReserveEntry{{Address: 0x1000, Size: 0x1000}}; !reflect.DeepEqual(fdt.ReserveEntries, want) {
+		t.Errorf("reserve entries = %v, want %v", fdt.ReserveEntries, want)
+	}
+
+	root := fdt.RootNode
+	for _, tt := range []struct {
+		path string
+		prop string
+		want []byte
+	}{
+		{"/", "#address-cells", []byte{0, 0, 0, 2}},
+		{"/", "compatible", []byte("acme,board\x00acme,soc\x00")},
+		{"/", "model", []byte("Acme AB board\n\x00")},
+		// gic is the first node to need a phandle that doesn't have
+		// one.
+		{"/", "interrupt-parent", []byte{0, 0, 0, 8}},
+		{"/interrupt-controller@8000000", "phandle", []byte{0, 0, 0, 8}},
+		{"/interrupt-controller@8000000", "interrupt-controller", []byte{}},
+		{"/serial@9000000", "clocks", []byte{0, 0, 0, 7, 0, 0, 0, 1, 0, 0, 0, 7, 0, 0, 0, 2}},
+		{"/serial@9000000", "mac", []byte{0, 0x11, 0x22, 0x33}},
+		{"/serial@9000000", "bits8", []byte{1, 0xff}},
+		{"/serial@9000000", "bits64", []byte{0, 0, 0, 1, 0x23, 0x45, 0x67, 0x89}},
+		{"/serial@9000000", "neg", []byte{0xff, 0xff, 0xff, 0xff}},
+		{"/serial@9000000", "status", []byte("okay\x00")},
+		{"/aliases", "serial0", []byte("/serial@9000000\x00")},
+		{"/aliases", "bypath", []byte("/clock\x00")},
+		{"/__symbols__", "gic", []byte("/interrupt-controller@8000000\x00")},
+		{"/__symbols__", "uart0", []byte("/serial@9000000\x00")},
+		{"/__symbols__", "clk", []byte("/clock\x00")},
+	} {
+		n, ok := fdt.NodeByPath(tt.path)
+		if !ok {
+			t.Errorf("no node %q", tt.path)
+			continue
+		}
+		p, ok := n.LookProperty(tt.prop)
+		if !ok {
+			t.Errorf("%s has no property %q", tt.path, tt.prop)
+			continue
+		}
+		if !bytes.Equal(p.Value, tt.want) {
+			t.Errorf("%s:%s = %q, want %q", tt.path, tt.prop, p.Value, tt.want)
+		}
+	}
+
+	serial, _ := fdt.NodeByPath("/serial")
+	if serial.Properties[5].Name != "status" {
+		t.Errorf("status moved when it was overridden: %v", serial.Properties)
+	}
+	if _, ok := serial.LookProperty("bits16"); ok {
+		t.Errorf("bits16 was not deleted")
+	}
+	if ph, ok := serial.PHandle(); !ok || ph != 9 {
+		t.Errorf("labelled node has phandle %d, %t, want 9", ph, ok)
+	}
+	if _, ok := root.Child("old"); ok {
+		t.Errorf("/old was not deleted")
+	}
+	if _, ok := root.Child("chosen"); !ok {
+		t.Errorf("second root node was not merged")
+	}
+}
+
+func TestParseDTSErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"no version", "/ { };", `dts:1: expected "/dts-v1/"`},
+		{"unterminated", "/dts-v1/;\n/ {\n\tfoo = \"bar;\n};", "dts:3: unterminated string"},
+		{"missing semicolon", "/dts-v1/;\n/ { foo = <1> }", `dts:2: expected ";" after property "foo"`},
+		{"undefined label", "/dts-v1/;\n/ { foo = <&bar>; };", "dts:2: reference to undefined node &bar"},
+		{"undefined node", "/dts-v1/;\n&bar { };", "dts:2: reference to undefined node &bar"},
+		{"bad number", "/dts-v1/;\n/ { foo = <0x1g>; };", "bad 32-bit number"},
+		{"too big", "/dts-v1/;\n/ { foo = /bits/ 8 <256>; };", "bad 8-bit number"},
+		{"bad bytes", "/dts-v1/;\n/ { foo = [123]; };", "expected hex bytes"},
+		{"bad bits", "/dts-v1/;\n/ { foo = /bits/ 7 <1>; };", "/bits/ must be"},
+		{"comment", "/dts-v1/;\n/* ", "unterminated comment"},
+		{"character", "/dts-v1/;\n/ { foo = 'a'; };", "unexpected character"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDTS(strings.NewReader(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseDTS() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
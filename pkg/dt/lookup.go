@@ -0,0 +1,176 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"errors"
+	"strings"
+)
+
+// errFound stops a Walk early.
+var errFound = errors.New("found")
+
+// NodeByPath returns the node at the given path, e.g. "/cpus/cpu@0".
+//
+// As in Linux and libfdt, a path component without a unit address matches
+// a node with one, e.g. "/memory" matches "/memory@40000000", and a path that
+// does not start with "/" starts with an alias from /aliases.
+func (fdt *FDT) NodeByPath(path string) (*Node, bool) {
+	if fdt.RootNode == nil {
+		return nil, false
+	}
+	n := fdt.RootNode
+	if !strings.HasPrefix(path, "/") {
+		alias := path
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			alias, path = path[:i], path[i:]
+		} else {
+			path = ""
+		}
+		aliases, ok := n.Child("aliases")
+		if !ok {
+			return nil, false
+		}
+		p, ok := aliases.LookProperty(alias)
+		if !ok {
+			return nil, false
+		}
+		target, err := p.AsString()
+		if err != nil || !strings.HasPrefix(target, "/") {
+			return nil, false
+		}
+		if n, ok = fdt.NodeByPath(target); !ok {
+			return nil, false
+		}
+	}
+
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		c, ok := n.childByPathComponent(name)
+		if !ok {
+			return nil, false
+		}
+		n = c
+	}
+	return n, true
+}
+
+func (n *Node) childByPathComponent(name string) (*Node, bool) {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c, true
+		}
+		if !strings.Contains(name, "@") && strings.HasPrefix(c.Name, name+"@") {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// NodeByPHandle returns the node with the given phandle.
+func (fdt *FDT) NodeByPHandle(ph PHandle) (*Node, bool) {
+	var found *Node
+	if fdt.RootNode == nil {
+		return nil, false
+	}
+	fdt.RootNode.Walk(func(n *Node) error {
+		if v, ok := n.PHandle(); ok && v == ph {
+			found = n
+			return errFound
+		}
+		return nil
+	})
+	return found, found != nil
+}
+
+// FindCompatible returns all nodes compatible with c, in depth-first order.
+func (fdt *FDT) FindCompatible(c string) []*Node {
+	var nodes []*Node
+	if fdt.RootNode == nil {
+		return nil
+	}
+	fdt.RootNode.Walk(func(n *Node) error {
+		if n.IsCompatible(c) {
+			nodes = append(nodes, n)
+		}
+		return nil
+	})
+	return nodes
+}
+
+// RemoveNode removes the node at the given path, and everything below it,
+// and returns whether it existed. The root node cannot be removed.
+func (fdt *FDT) RemoveNode(path string) bool {
+	n, ok := fdt.NodeByPath(path)
+	if !ok || n == fdt.RootNode {
+		return false
+	}
+	parent, ok := fdt.parent(n)
+	if !ok {
+		return false
+	}
+	for i, c := range parent.Children {
+		if c == n {
+			parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// MaxPHandle returns the largest phandle in the tree, or 0 if there is none.
+func (fdt *FDT) MaxPHandle() PHandle {
+	var max PHandle
+	if fdt.RootNode == nil {
+		return 0
+	}
+	fdt.RootNode.Walk(func(n *Node) error {
+		if v, ok := n.PHandle(); ok && v > max && v != invalidPHandle {
+			max = v
+		}
+		return nil
+	})
+	return max
+}
+
+// invalidPHandle is the placeholder phandle of unresolved references in
+// overlays.
+const invalidPHandle PHandle = 0xffffffff
+
+func (fdt *FDT) parent(child *Node) (*Node, bool) {
+	var found *Node
+	fdt.RootNode.Walk(func(n *Node) error {
+		for _, c := range n.Children {
+			if c == child {
+				found = n
+				return errFound
+			}
+		}
+		return nil
+	})
+	return found, found != nil
+}
+
+// paths returns the path of every node in the tree.
+func (fdt *FDT) paths() map[*Node]string {
+	paths := make(map[*Node]string)
+	var walk func(n *Node, path string)
+	walk = func(n *Node, path string) {
+		paths[n] = path
+		prefix := path
+		if prefix == "/" {
+			prefix = ""
+		}
+		for _, c := range n.Children {
+			walk(c, prefix+"/"+c.Name)
+		}
+	}
+	if fdt.RootNode != nil {
+		walk(fdt.RootNode, "/")
+	}
+	return paths
+}
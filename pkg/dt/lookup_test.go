@@ -0,0 +1,80 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	fdt := mustParseDTS(t, `/dts-v1/;
+/ {
+	aliases {
+		serial0 = "/soc/serial@1000";
+	};
+	soc {
+		serial@1000 {
+			compatible = "ns16550a";
+			phandle = <1>;
+		};
+		serial@2000 {
+			compatible = "vendor,uart", "ns16550a";
+		};
+		reserved-memory {
+			phandle = <4>;
+		};
+	};
+};
+`)
+
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{"/", ""},
+		{"/soc", "soc"},
+		{"/soc/serial@2000", "serial@2000"},
+		{"/soc/serial", "serial@1000"},
+		{"serial0", "serial@1000"},
+		{"/soc//serial@1000/", "serial@1000"},
+		{"/soc/serial@3000", "!"},
+		{"/soc/serial@2000/x", "!"},
+		{"serial1", "!"},
+	} {
+		n, ok := fdt.NodeByPath(tt.path)
+		if tt.want == "!" {
+			if ok {
+				t.Errorf("NodeByPath(%q) = %q, want none", tt.path, n.Name)
+			}
+		} else if !ok || n.Name != tt.want {
+			t.Errorf("NodeByPath(%q) = %v, %t, want %q", tt.path, n, ok, tt.want)
+		}
+	}
+
+	if n, ok := fdt.NodeByPHandle(4); !ok || n.Name != "reserved-memory" {
+		t.Errorf("NodeByPHandle(4) = %v, %t, want reserved-memory", n, ok)
+	}
+	if _, ok := fdt.NodeByPHandle(2); ok {
+		t.Errorf("NodeByPHandle(2) found a node")
+	}
+	if got := fdt.MaxPHandle(); got != 4 {
+		t.Errorf("MaxPHandle() = %d, want 4", got)
+	}
+
+	nodes := fdt.FindCompatible("ns16550a")
+	if len(nodes) != 2 || nodes[0].Name != "serial@1000" || nodes[1].Name != "serial@2000" {
+		t.Errorf("FindCompatible(ns16550a) = %v, want both serial ports", nodes)
+	}
+
+	if !fdt.RemoveNode("/soc/reserved-memory") {
+		t.Errorf("RemoveNode(/soc/reserved-memory) = false, want true")
+	}
+	if _, ok := fdt.NodeByPath("/soc/reserved-memory"); ok {
+		t.Errorf("/soc/reserved-memory was not removed")
+	}
+	if fdt.RemoveNode("/") || fdt.RemoveNode("/soc/reserved-memory") {
+		t.Errorf("RemoveNode() removed the root or a missing node")
+	}
+}
@@ -67,6 +67,150 @@ func (n *Node) Walk(f func(*Node) error) error {
 	return nil
 }
 
+// Child returns the direct child of n with the given name.
+func (n *Node) Child(name string) (*Node, bool) {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// LookProperty returns the property of n with the given name.
+func (n *Node) LookProperty(name string) (*Property, bool) {
+	for i := range n.Properties {
+		if n.Properties[i].Name == name {
+			return &n.Properties[i], true
+		}
+	}
+	return nil, false
+}
+
+// UpdateProperty sets the value of the property with the given name, adding
+// it if n does not have it yet.
+func (n *Node) UpdateProperty(name string, value []byte) {
+	if p, ok := n.LookProperty(name); ok {
+		p.Value = value
+		return
+	}
+	n.Properties = append(n.Properties, Property{Name: name, Value: value})
+}
+
+// RemoveProperty removes the property with the given name and returns
+// whether n had it.
+func (n *Node) RemoveProperty(name string) bool {
+	for i := range n.Properties {
+		if n.Properties[i].Name == name {
+			n.Properties = append(n.Properties[:i], n.Properties[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddChild adds c as the last child of n. It is an error if n already has a
+// child with c's name.
+func (n *Node) AddChild(c *Node) error {
+	if _, ok := n.Child(c.Name); ok {
+		return fmt.Errorf("node %q already has a child %q", n.Name, c.Name)
+	}
+	n.Children = append(n.Children, c)
+	return nil
+}
+
+// RemoveChild removes the direct child with the given name and returns
+// whether n had it.
+func (n *Node) RemoveChild(name string) bool {
+	for i, c := range n.Children {
+		if c.Name == name {
+			n.Children = append(n.Children[:i], n.Children[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PHandle returns the phandle of n, if it has one.
+func (n *Node) PHandle() (PHandle, bool) {
+	for _, name := range []string{"phandle", "linux,phandle"} {
+		if p, ok := n.LookProperty(name); ok {
+			if v, err := p.AsPHandle(); err == nil {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// IsCompatible returns whether n's compatible property lists c.
+func (n *Node) IsCompatible(c string) bool {
+	p, ok := n.LookProperty("compatible")
+	if !ok {
+		return false
+	}
+	strs, err := p.AsStringList()
+	if err != nil {
+		return false
+	}
+	for _, s := range strs {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// SetEmpty sets the named property to <empty>, as used for boolean
+// properties.
+func (n *Node) SetEmpty(name string) {
+	n.UpdateProperty(name, []byte{})
+}
+
+// SetU32 sets the named property to a <u32>.
+func (n *Node) SetU32(name string, v uint32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	n.UpdateProperty(name, b)
+}
+
+// SetU64 sets the named property to a <u64>.
+func (n *Node) SetU64(name string, v uint64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	n.UpdateProperty(name, b)
+}
+
+// SetString sets the named property to a <string>.
+func (n *Node) SetString(name, s string) {
+	n.UpdateProperty(name, append([]byte(s), 0))
+}
+
+// SetStringList sets the named property to a <stringlist>.
+func (n *Node) SetStringList(name string, strs ...string) {
+	b := []byte{}
+	for _, s := range strs {
+		b = append(b, s...)
+		b = append(b, 0)
+	}
+	n.UpdateProperty(name, b)
+}
+
+// SetPHandle sets the named property to a <phandle>.
+func (n *Node) SetPHandle(name string, v PHandle) {
+	n.SetU32(name, uint32(v))
+}
+
+// SetCells sets the named property to a <prop-encoded-array> of 32-bit
+// cells, as used by e.g. reg and ranges.
+func (n *Node) SetCells(name string, cells ...uint32) {
+	b := make([]byte, 4*len(cells))
+	for i, c := range cells {
+		binary.BigEndian.PutUint32(b[4*i:], c)
+	}
+	n.UpdateProperty(name, b)
+}
+
 // Property is a name-value pair. Note the PropertyType of Value is not
 // encoded.
 type Property struct {
@@ -194,7 +338,7 @@ func (p *Property) AsStringList() ([]string, error) {
 	}
 	value := p.Value
 	strs := []string{}
-	for len(p.Value) > 0 {
+	for len(value) > 0 {
 		nextNull := bytes.IndexByte(value, 0) // cannot be -1
 		var str []byte
 		str, value = value[:nextNull], value[nextNull+1:]
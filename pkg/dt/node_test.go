@@ -0,0 +1,112 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodeProperties(t *testing.T) {
+	chosen := &Node{Name: "chosen"}
+	root := &Node{
+		Children: []*Node{
+			{Name: "cpus"},
+			chosen,
+		},
+	}
+
+	if n, ok := root.Child("chosen"); !ok || n != chosen {
+		t.Errorf("Child(chosen) = %v, %t, want %v", n, ok, chosen)
+	}
+	if _, ok := root.Child("memory"); ok {
+		t.Errorf("Child(memory) found a node")
+	}
+
+	chosen.UpdateProperty("bootargs", []byte("console=ttyS0\x00"))
+	chosen.UpdateProperty("linux,initrd-start", []byte{0, 0, 0, 1})
+	chosen.UpdateProperty("bootargs", []byte("quiet\x00"))
+	want := []Property{
+		{Name: "bootargs", Value: []byte("quiet\x00")},
+		{Name: "linux,initrd-start", Value: []byte{0, 0, 0, 1}},
+	}
+	if !reflect.DeepEqual(chosen.Properties, want) {
+		t.Errorf("properties = %v, want %v", chosen.Properties, want)
+	}
+
+	p, ok := chosen.LookProperty("bootargs")
+	if !ok {
+		t.Fatalf("LookProperty(bootargs) not found")
+	}
+	if s, err := p.AsString(); err != nil || s != "quiet" {
+		t.Errorf("bootargs = %q, %v, want quiet", s, err)
+	}
+
+	if !chosen.RemoveProperty("bootargs") {
+		t.Errorf("RemoveProperty(bootargs) = false, want true")
+	}
+	if chosen.RemoveProperty("bootargs") {
+		t.Errorf("RemoveProperty(bootargs) = true after removing it")
+	}
+	if !reflect.DeepEqual(chosen.Properties, want[1:]) {
+		t.Errorf("properties = %v, want %v", chosen.Properties, want[1:])
+	}
+}
+
+func TestNodeChildren(t *testing.T) {
+	n := &Node{Name: "soc"}
+	if err := n.AddChild(&Node{Name: "uart@1000"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.AddChild(&Node{Name: "uart@1000"}); err == nil {
+		t.Errorf("AddChild() added a second uart@1000")
+	}
+	if !n.RemoveChild("uart@1000") {
+		t.Errorf("RemoveChild(uart@1000) = false, want true")
+	}
+	if n.RemoveChild("uart@1000") || len(n.Children) != 0 {
+		t.Errorf("RemoveChild(uart@1000) did not remove it: %v", n.Children)
+	}
+}
+
+func TestNodeSetters(t *testing.T) {
+	n := &Node{}
+	n.SetEmpty("dma-coherent")
+	n.SetU32("#size-cells", 2)
+	n.SetU64("linux,initrd-start", 0x1122334455667788)
+	n.SetString("bootargs", "quiet")
+	n.SetStringList("compatible", "a", "b")
+	n.SetPHandle("phandle", 3)
+	n.SetCells("reg", 1, 2)
+
+	for _, tt := range []struct {
+		prop string
+		typ  PropertyType
+		want interface{}
+	}{
+		{"dma-coherent", EmptyType, Empty{}},
+		{"#size-cells", U32Type, uint32(2)},
+		{"linux,initrd-start", U64Type, uint64(0x1122334455667788)},
+		{"bootargs", StringType, "quiet"},
+		{"compatible", StringListType, []string{"a", "b"}},
+		{"phandle", PHandleType, PHandle(3)},
+		{"reg", PropEncodedArrayType, []byte{0, 0, 0, 1, 0, 0, 0, 2}},
+	} {
+		p, ok := n.LookProperty(tt.prop)
+		if !ok {
+			t.Errorf("no property %q", tt.prop)
+			continue
+		}
+		if got, err := p.AsType(tt.typ); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, %v, want %v", tt.prop, got, err, tt.want)
+		}
+	}
+	if ph, ok := n.PHandle(); !ok || ph != 3 {
+		t.Errorf("PHandle() = %v, %t, want 3", ph, ok)
+	}
+	if !n.IsCompatible("b") || n.IsCompatible("c") {
+		t.Errorf("IsCompatible() does not match compatible = \"a\", \"b\"")
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ApplyOverlay applies a device tree overlay, as compiled by dtc -@ or
+// ParseDTS from a /plugin/ source, to fdt.
+//
+// As in libfdt, the overlay's phandles are renumbered past fdt's, its
+// references to labels in fdt are resolved through fdt's /__symbols__, and
+// the __overlay__ node of each fragment is merged into the fragment's
+// target. The overlay's symbols are added to fdt's /__symbols__.
+//
+// The overlay is modified and its nodes become part of fdt. If an error is
+// returned, fdt may have been partially modified.
+func (fdt *FDT) ApplyOverlay(overlay *FDT) error {
+	if fdt.RootNode == nil || overlay.RootNode == nil {
+		return fmt.Errorf("overlay: device tree has no root node")
+	}
+	ov := overlay.RootNode
+
+	delta := uint32(fdt.MaxPHandle())
+	if err := overlay.renumberPHandles(delta); err != nil {
+		return err
+	}
+	if err := fdt.resolveFixups(overlay); err != nil {
+		return err
+	}
+
+	for _, frag := range ov.Children {
+		content, ok := frag.Child("__overlay__")
+		if !ok {
+			continue
+		}
+		target, path, err := fdt.fragmentTarget(frag)
+		if err != nil {
+			return err
+		}
+		mergeNode(target, content)
+
+		// Symbols pointing into the fragment now point into fdt.
+		if symbols, ok := ov.Child("__symbols__"); ok {
+			prefix := "/" + frag.Name + "/__overlay__"
+			for _, sym := range symbols.Properties {
+				s, err := sym.AsString()
+				if err != nil || (s != prefix && !strings.HasPrefix(s, prefix+"/")) {
+					continue
+				}
+				s = strings.TrimSuffix(path, "/") + strings.TrimPrefix(s, prefix)
+				if s == "" {
+					s = "/"
+				}
+				childOrNew(fdt.RootNode, "__symbols__").SetString(sym.Name, s)
+			}
+		}
+	}
+	return nil
+}
+
+// renumberPHandles adds delta to every phandle in the overlay and to every
+// reference to them listed in /__local_fixups__.
+func (fdt *FDT) renumberPHandles(delta uint32) error {
+	if delta == 0 {
+		return nil
+	}
+	var err error
+	fdt.RootNode.Walk(func(n *Node) error {
+		for _, name := range []string{"phandle", "linux,phandle"} {
+			p, ok := n.LookProperty(name)
+			if !ok {
+				continue
+			}
+			var v uint32
+			if v, err = p.AsU32(); err != nil {
+				return err
+			}
+			if PHandle(v) == invalidPHandle || v+delta < v || PHandle(v+delta) == invalidPHandle {
+				err = fmt.Errorf("overlay: phandle %#x of %q cannot be renumbered", v, n.Name)
+				return err
+			}
+			n.SetU32(name, v+delta)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	local, ok := fdt.RootNode.Child("__local_fixups__")
+	if !ok {
+		return nil
+	}
+	// __local_fixups__ mirrors the tree: each property lists the offsets
+	// of the references in the same property of the same node.
+	var fixup func(fixups, n *Node) error
+	fixup = func(fixups, n *Node) error {
+		for _, f := range fixups.Properties {
+			p, ok := n.LookProperty(f.Name)
+			if !ok || len(f.Value)%4 != 0 {
+				return fmt.Errorf("overlay: bad local fixup %q of %q", f.Name, n.Name)
+			}
+			for i := 0; i < len(f.Value); i += 4 {
+				off := binary.BigEndian.Uint32(f.Value[i:])
+				if uint64(off)+4 > uint64(len(p.Value)) {
+					return fmt.Errorf("overlay: local fixup %q of %q at %d is out of bounds", f.Name, n.Name, off)
+				}
+				v := binary.BigEndian.Uint32(p.Value[off:])
+				binary.BigEndian.PutUint32(p.Value[off:], v+delta)
+			}
+		}
+		for _, fc := range fixups.Children {
+			c, ok := n.Child(fc.Name)
+			if !ok {
+				return fmt.Errorf("overlay: local fixup for missing node %q", fc.Name)
+			}
+			if err := fixup(fc, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fixup(local, fdt.RootNode)
+}
+
+// resolveFixups fills in the overlay's references to labels in fdt.
+func (fdt *FDT) resolveFixups(overlay *FDT) error {
+	fixups, ok := overlay.RootNode.Child("__fixups__")
+	if !ok {
+		return nil
+	}
+	symbols, ok := fdt.RootNode.Child("__symbols__")
+	if !ok && len(fixups.Properties) > 0 {
+		return fmt.Errorf("overlay: device tree has no __symbols__ node; was it compiled with -@?")
+	}
+	for _, f := range fixups.Properties {
+		sym, ok := symbols.LookProperty(f.Name)
+		if !ok {
+			return fmt.Errorf("overlay: label %q is not defined", f.Name)
+		}
+		path, err := sym.AsString()
+		if err != nil {
+			return fmt.Errorf("overlay: symbol %q: %v", f.Name, err)
+		}
+		target, ok := fdt.NodeByPath(path)
+		if !ok {
+			return fmt.Errorf("overlay: label %q refers to missing node %q", f.Name, path)
+		}
+		ph, ok := target.PHandle()
+		if !ok {
+			return fmt.Errorf("overlay: node %q has no phandle", path)
+		}
+
+		refs, err := f.AsStringList()
+		if err != nil {
+			return fmt.Errorf("overlay: fixup %q: %v", f.Name, err)
+		}
+		for _, ref := range refs {
+			// path:property:offset
+			parts := strings.Split(ref, ":")
+			if len(parts) != 3 {
+				return fmt.Errorf("overlay: bad fixup %q", ref)
+			}
+			off, err := strconv.ParseUint(parts[2], 10, 32)
+			if err != nil {
+				return fmt.Errorf("overlay: bad fixup %q", ref)
+			}
+			n, ok := overlay.NodeByPath(parts[0])
+			if !ok {
+				return fmt.Errorf("overlay: fixup %q: no such node", ref)
+			}
+			p, ok := n.LookProperty(parts[1])
+			if !ok || off+4 > uint64(len(p.Value)) {
+				return fmt.Errorf("overlay: fixup %q: no such property or offset", ref)
+			}
+			binary.BigEndian.PutUint32(p.Value[off:], uint32(ph))
+		}
+	}
+	return nil
+}
+
+// fragmentTarget returns the node a fragment applies to and its path.
+func (fdt *FDT) fragmentTarget(frag *Node) (*Node, string, error) {
+	if p, ok := frag.LookProperty("target"); ok {
+		ph, err := p.AsPHandle()
+		if err != nil {
+			return nil, "", fmt.Errorf("overlay: %s: %v", frag.Name, err)
+		}
+		n, ok := fdt.NodeByPHandle(ph)
+		if !ok {
+			return nil, "", fmt.Errorf("overlay: %s: no node with phandle %#x", frag.Name, ph)
+		}
+		return n, fdt.paths()[n], nil
+	}
+	if p, ok := frag.LookProperty("target-path"); ok {
+		path, err := p.AsString()
+		if err != nil {
+			return nil, "", fmt.Errorf("overlay: %s: %v", frag.Name, err)
+		}
+		n, ok := fdt.NodeByPath(path)
+		if !ok {
+			return nil, "", fmt.Errorf("overlay: %s: no node %q", frag.Name, path)
+		}
+		// Aliases and unit-address-less names resolve to the real path.
+		return n, fdt.paths()[n], nil
+	}
+	return nil, "", fmt.Errorf("overlay: %s has no target", frag.Name)
+}
+
+// mergeNode merges the properties and children of src into dst. Properties
+// in src replace those in dst.
+func mergeNode(dst, src *Node) {
+	for _, p := range src.Properties {
+		dst.UpdateProperty(p.Name, p.Value)
+	}
+	for _, c := range src.Children {
+		if d, ok := dst.Child(c.Name); ok {
+			mergeNode(d, c)
+		} else {
+			dst.Children = append(dst.Children, c)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const overlayBase = `/dts-v1/;
+/ {
+	soc {
+		gpio: gpio@1000 {
+			gpio-controller;
+		};
+		i2c1: i2c@2000 {
+			status = "disabled";
+		};
+	};
+	aliases {
+		i2c1 = &{/soc/i2c@2000};
+	};
+};
+`
+
+const overlaySource = `/dts-v1/;
+/plugin/;
+
+&i2c1 {
+	status = "okay";
+	#address-cells = <1>;
+
+	mux: mux@70 {
+		reg = <0x70>;
+	};
+	sensor@48 {
+		reg = <0x48>;
+		parent = <&mux>;
+		reset-gpios = <&gpio 3 0>, <&gpio 4 0>;
+	};
+};
+
+&{/soc} {
+	led {
+		gpios = <&gpio 5 0>;
+	};
+};
+`
+
+func mustParseDTS(t *testing.T, src string) *FDT {
+	t.Helper()
+	fdt, err := ParseDTS(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fdt
+}
+
+func TestParseOverlay(t *testing.T) {
+	ov := mustParseDTS(t, overlaySource)
+	for _, tt := range []struct {
+		path string
+		prop string
+		want []byte
+	}{
+		{"/fragment@0", "target", []byte{0xff, 0xff, 0xff, 0xff}},
+		{"/fragment@1", "target-path", []byte("/soc\x00")},
+		{"/fragment@0/__overlay__/mux@70", "phandle", []byte{0, 0, 0, 1}},
+		{"/fragment@0/__overlay__/sensor@48", "parent", []byte{0, 0, 0, 1}},
+		{"/__symbols__", "mux", []byte("/fragment@0/__overlay__/mux@70\x00")},
+		{"/__fixups__", "i2c1", []byte("/fragment@0:target:0\x00")},
+		{"/__fixups__", "gpio", []byte("/fragment@0/__overlay__/sensor@48:reset-gpios:0\x00" +
+			"/fragment@0/__overlay__/sensor@48:reset-gpios:12\x00" +
+			"/fragment@1/__overlay__/led:gpios:0\x00")},
+		{"/__local_fixups__/fragment@0/__overlay__/sensor@48", "parent", []byte{0, 0, 0, 0}},
+	} {
+		n, ok := ov.NodeByPath(tt.path)
+		if !ok {
+			t.Errorf("no node %q", tt.path)
+			continue
+		}
+		p, ok := n.LookProperty(tt.prop)
+		if !ok {
+			t.Errorf("%s has no property %q", tt.path, tt.prop)
+			continue
+		}
+		if !bytes.Equal(p.Value, tt.want) {
+			t.Errorf("%s:%s = %q, want %q", tt.path, tt.prop, p.Value, tt.want)
+		}
+	}
+}
+
+func TestApplyOverlay(t *testing.T) {
+	base := mustParseDTS(t, overlayBase)
+	// Give the base a phandle the overlay's have to be renumbered past.
+	i2c, _ := base.NodeByPath("/soc/i2c@2000")
+	i2c.SetPHandle("phandle", 5)
+
+	// Round-trip the overlay through a DTB, as it would be loaded.
+	var dtb bytes.Buffer
+	if _, err := mustParseDTS(t, overlaySource).Write(&dtb); err != nil {
+		t.Fatal(err)
+	}
+	ov, err := ReadFDT(bytes.NewReader(dtb.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.ApplyOverlay(ov); err != nil {
+		t.Fatal(err)
+	}
+
+	gpio, _ := base.NodeByPath("/soc/gpio@1000")
+	gpioPH, ok := gpio.PHandle()
+	if !ok {
+		t.Fatalf("gpio has no phandle")
+	}
+	for _, tt := range []struct {
+		path string
+		prop string
+		want []byte
+	}{
+		{"/soc/i2c@2000", "status", []byte("okay\x00")},
+		{"/soc/i2c@2000", "#address-cells", []byte{0, 0, 0, 1}},
+		{"/soc/i2c@2000/mux@70", "phandle", []byte{0, 0, 0, 6}},
+		{"/soc/i2c@2000/sensor@48", "parent", []byte{0, 0, 0, 6}},
+		{"/soc/i2c@2000/sensor@48", "reset-gpios", []byte{0, 0, 0, byte(gpioPH), 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, byte(gpioPH), 0, 0, 0, 4, 0, 0, 0, 0}},
+		{"/soc/led", "gpios", []byte{0, 0, 0, byte(gpioPH), 0, 0, 0, 5, 0, 0, 0, 0}},
+		{"/__symbols__", "mux", []byte("/soc/i2c@2000/mux@70\x00")},
+		{"/__symbols__", "gpio", []byte("/soc/gpio@1000\x00")},
+	} {
+		n, ok := base.NodeByPath(tt.path)
+		if !ok {
+			t.Errorf("no node %q", tt.path)
+			continue
+		}
+		p, ok := n.LookProperty(tt.prop)
+		if !ok {
+			t.Errorf("%s has no property %q", tt.path, tt.prop)
+			continue
+		}
+		if !bytes.Equal(p.Value, tt.want) {
+			t.Errorf("%s:%s = %q, want %q", tt.path, tt.prop, p.Value, tt.want)
+		}
+	}
+	if _, ok := base.RootNode.Child("fragment@0"); ok {
+		t.Errorf("fragments were copied into the device tree")
+	}
+}
+
+func TestApplyOverlayErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		base string
+		want string
+	}{
+		{
+			name: "no symbols",
+			base: "/dts-v1/;\n/ { };",
+			want: "no __symbols__ node",
+		},
+		{
+			name: "undefined label",
+			base: "/dts-v1/;\n/ { gpio: gpio { }; };",
+			want: `label "i2c1" is not defined`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mustParseDTS(t, tt.base).ApplyOverlay(mustParseDTS(t, overlaySource))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ApplyOverlay() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
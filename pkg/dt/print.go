@@ -5,12 +5,105 @@
 package dt
 
 import (
-	"errors"
+	"bytes"
+	"fmt"
 	"io"
+	"strings"
 )
 
 // PrintDTS prints the FDT in the .dts format.
-// TODO: not yet implemented
+//
+// Property values are printed as strings, cells or bytes depending on what
+// they look like. Whatever is chosen, ParseDTS compiles the output back to
+// the same nodes, properties and memory reservations.
 func (fdt *FDT) PrintDTS(f io.Writer) error {
-	return errors.New("not yet implemented")
+	var b bytes.Buffer
+	b.WriteString("/dts-v1/;\n\n")
+	for _, r := range fdt.ReserveEntries {
+		fmt.Fprintf(&b, "/memreserve/ %#016x %#016x;\n", r.Address, r.Size)
+	}
+	if len(fdt.ReserveEntries) > 0 {
+		b.WriteString("\n")
+	}
+	if fdt.RootNode != nil {
+		printNode(&b, fdt.RootNode, 0)
+	}
+	_, err := f.Write(b.Bytes())
+	return err
+}
+
+func printNode(b *bytes.Buffer, n *Node, depth int) {
+	indent := strings.Repeat("    ", depth)
+	name := n.Name
+	if depth == 0 {
+		name = "/"
+	}
+	fmt.Fprintf(b, "%s%s {\n", indent, name)
+	for _, p := range n.Properties {
+		if v := formatValue(&p); v != "" {
+			fmt.Fprintf(b, "%s    %s = %s;\n", indent, p.Name, v)
+		} else {
+			fmt.Fprintf(b, "%s    %s;\n", indent, p.Name)
+		}
+	}
+	for _, c := range n.Children {
+		printNode(b, c, depth+1)
+	}
+	fmt.Fprintf(b, "%s};\n", indent)
+}
+
+// formatValue formats the value of p as it would appear after the = in a
+// .dts file, or returns "" for an empty property.
+func formatValue(p *Property) string {
+	if len(p.Value) == 0 {
+		return ""
+	}
+	switch p.PredictType() {
+	case StringType, StringListType:
+		strs, err := p.AsStringList()
+		if err != nil {
+			break
+		}
+		quoted := make([]string, len(strs))
+		for i, s := range strs {
+			quoted[i] = quoteString(s)
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	var s strings.Builder
+	if len(p.Value)%4 == 0 {
+		s.WriteString("<")
+		for i := 0; i < len(p.Value); i += 4 {
+			if i > 0 {
+				s.WriteString(" ")
+			}
+			fmt.Fprintf(&s, "0x%02x%02x%02x%02x", p.Value[i], p.Value[i+1], p.Value[i+2], p.Value[i+3])
+		}
+		s.WriteString(">")
+		return s.String()
+	}
+	s.WriteString("[")
+	for i, v := range p.Value {
+		if i > 0 {
+			s.WriteString(" ")
+		}
+		fmt.Fprintf(&s, "%02x", v)
+	}
+	s.WriteString("]")
+	return s.String()
+}
+
+// quoteString quotes a printable ASCII string the way dtc does.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
 }
@@ -127,6 +127,12 @@ func (c Environ) String() string {
 type BuildOpts struct {
 	// NoStrip builds an unstripped binary.
 	NoStrip bool
+	// Reproducible builds a binary that does not depend on where it was
+	// built: file system paths are trimmed and the build ID is empty.
+	Reproducible bool
+	// Incremental reuses packages from Go's build cache instead of
+	// rebuilding all of them.
+	Incremental bool
 	// ExtraArgs to `go build`.
 	ExtraArgs []string
 }
@@ -145,15 +151,31 @@ func (c Environ) Build(importPath string, binaryPath string, opts BuildOpts) err
 // BuildDir compiles the package in the directory `dirPath`, writing the build
 // object to `binaryPath`.
 func (c Environ) BuildDir(dirPath string, binaryPath string, opts BuildOpts) error {
-	args := []string{
-		"build",
-		"-a", // Force rebuilding of packages.
+	return c.build(dirPath, ".", binaryPath, opts)
+}
+
+// build compiles pkg as seen from dirPath, writing the build object to
+// binaryPath.
+func (c Environ) build(dirPath, pkg, binaryPath string, opts BuildOpts) error {
+	args := []string{"build"}
+	if !opts.Incremental {
+		args = append(args, "-a") // Force rebuilding of packages.
+	}
+	args = append(args,
 		"-o", binaryPath,
 		"-installsuffix", "uroot",
 		"-gcflags=all=-l", // Disable "function inlining" to get a smaller binary
-	}
+	)
+	var ldflags []string
 	if !opts.NoStrip {
-		args = append(args, `-ldflags=-s -w`) // Strip all symbols.
+		ldflags = append(ldflags, "-s", "-w") // Strip all symbols.
+	}
+	if opts.Reproducible {
+		args = append(args, "-trimpath")
+		ldflags = append(ldflags, "-buildid=")
+	}
+	if len(ldflags) > 0 {
+		args = append(args, "-ldflags="+strings.Join(ldflags, " "))
 	}
 	if len(c.BuildTags) > 0 {
 		args = append(args, []string{"-tags", strings.Join(c.BuildTags, " ")}...)
@@ -161,8 +183,7 @@ func (c Environ) BuildDir(dirPath string, binaryPath string, opts BuildOpts) err
 	if opts.ExtraArgs != nil {
 		args = append(args, opts.ExtraArgs...)
 	}
-	// We always set the working directory, so this is always '.'.
-	args = append(args, ".")
+	args = append(args, pkg)
 
 	cmd := c.GoCmd(args...)
 	cmd.Dir = dirPath
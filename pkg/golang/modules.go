@@ -0,0 +1,321 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/tools/go/packages"
+)
+
+// Lookup loads the packages matching patterns with go/packages, resolving
+// them as the go command would in dir. dir may be empty for the current
+// directory.
+//
+// An error is returned if any package or dependency loaded failed to load.
+func (c Environ) Lookup(mode packages.LoadMode, dir string, patterns ...string) ([]*packages.Package, error) {
+	return c.lookup(mode, dir, nil, patterns...)
+}
+
+func (c Environ) lookup(mode packages.LoadMode, dir string, flags []string, patterns ...string) ([]*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode:       mode,
+		Env:        append(append(os.Environ(), c.Env()...), "GOMODCACHE="+modCache()),
+		Dir:        dir,
+		BuildFlags: flags,
+	}
+	if len(c.BuildTags) > 0 {
+		cfg.BuildFlags = append(cfg.BuildFlags, "-tags", strings.Join(c.BuildTags, " "))
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		for _, e := range p.Errors {
+			errs = append(errs, e.Error())
+		}
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to load %v: %s", patterns, strings.Join(errs, "; "))
+	}
+	return pkgs, nil
+}
+
+// modCache returns the module cache directory of the default environment.
+//
+// Modules stay in the same cache even if an Environ names different GOPATHs
+// for packages outside of any module.
+func modCache() string {
+	if d := os.Getenv("GOMODCACHE"); d != "" {
+		return d
+	}
+	return filepath.Join(filepath.SplitList(build.Default.GOPATH)[0], "pkg", "mod")
+}
+
+// SplitVersion splits a package specifier of the form module@version/path
+// into the module version it names and the import path module/path.
+//
+// ok is false if spec does not name a version.
+func SplitVersion(spec string) (mod module.Version, importPath string, ok bool) {
+	i := strings.Index(spec, "@")
+	if i < 0 {
+		return module.Version{}, spec, false
+	}
+	mod.Path, importPath = spec[:i], spec[:i]
+	mod.Version = spec[i+1:]
+	if j := strings.Index(mod.Version, "/"); j >= 0 {
+		importPath += mod.Version[j:]
+		mod.Version = mod.Version[:j]
+	}
+	return mod, importPath, true
+}
+
+// CommandName returns the name of the command built from the package
+// specified by spec, the last element of its import path.
+func CommandName(spec string) string {
+	_, importPath, _ := SplitVersion(spec)
+	return path.Base(importPath)
+}
+
+// InTree reports whether the packages specified by specs are all in GOPATH or
+// in the main module, so that they can be built where they are instead of in
+// a workspace. Built in place, packages are resolved with the go command's
+// own settings, including the main module's vendor directory.
+func (c Environ) InTree(specs []string) (bool, error) {
+	for _, spec := range specs {
+		if _, _, ok := SplitVersion(spec); ok {
+			return false, nil
+		}
+	}
+	pkgs, err := c.Lookup(packages.NeedName|packages.NeedModule, "", specs...)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range pkgs {
+		if p.Module != nil && !p.Module.Main {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// zeroVersion is the version required of modules that are replaced by a
+// directory, as the go command writes it.
+const zeroVersion = "v0.0.0-00010101000000-000000000000"
+
+// WorkspaceModule is the module path of workspaces.
+const WorkspaceModule = "u-root-workspace"
+
+// A Workspace is a synthetic main module that requires the modules of a set
+// of packages. Packages from different modules are built in a workspace
+// with one consistent set of dependency versions, and the replace
+// directives of all local modules apply to all of them.
+type Workspace struct {
+	Env Environ
+
+	// Dir holds the workspace's go.mod.
+	Dir string
+
+	mod *modfile.File
+}
+
+// NewWorkspace creates a workspace in dir for the packages specified by
+// specs, which are either import paths resolved from the current directory
+// or of the form module@version/path (see SplitVersion).
+//
+// It returns the workspace and the import paths of the packages.
+func (c Environ) NewWorkspace(dir string, specs []string) (*Workspace, []string, error) {
+	w := &Workspace{Env: c, Dir: dir, mod: &modfile.File{}}
+	if err := w.mod.AddModuleStmt(WorkspaceModule); err != nil {
+		return nil, nil, err
+	}
+	if err := w.mod.AddGoStmt("1.15"); err != nil {
+		return nil, nil, err
+	}
+
+	// Replacements of the current module apply to everything built from it.
+	gomod, err := c.GoCmd("env", "GOMOD").Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not find current module: %v", err)
+	}
+	if f := strings.TrimSpace(string(gomod)); f != "" && f != os.DevNull {
+		if err := w.addReplaces(f); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var local, importPaths []string
+	for _, spec := range specs {
+		if mod, p, ok := SplitVersion(spec); ok {
+			if err := w.Require(mod.Path, mod.Version); err != nil {
+				return nil, nil, err
+			}
+			importPaths = append(importPaths, p)
+		} else {
+			local = append(local, spec)
+			importPaths = append(importPaths, spec)
+		}
+	}
+	if len(local) > 0 {
+		pkgs, err := c.Lookup(packages.NeedName|packages.NeedModule, "", local...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range pkgs {
+			if err := w.addModule(p.Module); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return w, importPaths, w.WriteModFile()
+}
+
+// addModule adds m, as the go command resolved it, to the workspace.
+func (w *Workspace) addModule(m *packages.Module) error {
+	switch {
+	case m == nil:
+		// Standard library or GOPATH package.
+		return nil
+
+	case m.Main:
+		if err := w.Require(m.Path, zeroVersion); err != nil {
+			return err
+		}
+		if err := w.Replace(module.Version{Path: m.Path}, module.Version{Path: m.Dir}); err != nil {
+			return err
+		}
+		return w.addReplaces(m.GoMod)
+
+	case m.Replace != nil:
+		v := m.Version
+		if v == "" {
+			v = zeroVersion
+		}
+		if err := w.Require(m.Path, v); err != nil {
+			return err
+		}
+		if m.Replace.Version == "" {
+			if err := w.Replace(module.Version{Path: m.Path}, module.Version{Path: m.Replace.Dir}); err != nil {
+				return err
+			}
+			return w.addReplaces(m.Replace.GoMod)
+		}
+		return w.Replace(module.Version{Path: m.Path}, module.Version{Path: m.Replace.Path, Version: m.Replace.Version})
+
+	default:
+		return w.Require(m.Path, m.Version)
+	}
+}
+
+// addReplaces adds the replace directives of the go.mod file at path.
+func (w *Workspace) addReplaces(path string) error {
+	if path == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := modfile.ParseLax(path, b, nil)
+	if err != nil {
+		return err
+	}
+	for _, r := range f.Replace {
+		n := r.New
+		if n.Version == "" && !filepath.IsAbs(n.Path) {
+			n.Path = filepath.Join(filepath.Dir(path), n.Path)
+		}
+		if err := w.Replace(r.Old, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Require adds a requirement of version of the module path. If the module
+// is already required, the higher version is kept.
+func (w *Workspace) Require(path, version string) error {
+	for _, r := range w.mod.Require {
+		if r.Mod.Path == path && semver.Compare(version, r.Mod.Version) <= 0 {
+			return nil
+		}
+	}
+	return w.mod.AddRequire(path, version)
+}
+
+// Replace replaces old with new. If new has no version, new.Path is a
+// directory. If old has no version, all versions of it are replaced.
+//
+// Replacing a module twice with different replacements is an error.
+func (w *Workspace) Replace(old, new module.Version) error {
+	if new.Version == "" {
+		abs, err := filepath.Abs(new.Path)
+		if err != nil {
+			return err
+		}
+		new.Path = abs
+	}
+	for _, r := range w.mod.Replace {
+		if r.Old != old {
+			continue
+		}
+		if r.New != new {
+			return fmt.Errorf("conflicting replacements for module %s: %s and %s", old, r.New, new)
+		}
+		return nil
+	}
+	return w.mod.AddReplace(old.Path, old.Version, new.Path, new.Version)
+}
+
+// Override replaces all versions of the module path with the directory
+// dir, dropping any replacements of it added before.
+func (w *Workspace) Override(path, dir string) error {
+	for _, r := range w.mod.Replace {
+		if r.Old.Path == path {
+			if err := w.mod.DropReplace(path, r.Old.Version); err != nil {
+				return err
+			}
+		}
+	}
+	w.mod.Cleanup()
+	return w.Replace(module.Version{Path: path}, module.Version{Path: dir})
+}
+
+// WriteModFile writes the workspace's go.mod.
+func (w *Workspace) WriteModFile() error {
+	w.mod.Cleanup()
+	b, err := w.mod.Format()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(w.Dir, "go.mod"), b, 0644)
+}
+
+// workspaceFlags are the go command flags used in the workspace. The go command may
+// add requirements of the workspace's modules' dependencies to its go.mod.
+var workspaceFlags = []string{"-mod=mod"}
+
+// Lookup loads the packages matching patterns in the workspace.
+func (w *Workspace) Lookup(mode packages.LoadMode, patterns ...string) ([]*packages.Package, error) {
+	return w.Env.lookup(mode, w.Dir, workspaceFlags, patterns...)
+}
+
+// Build compiles the package given by importPath in the workspace, writing
+// the build object to binaryPath.
+func (w *Workspace) Build(importPath, binaryPath string, opts BuildOpts) error {
+	opts.ExtraArgs = append(append([]string{}, workspaceFlags...), opts.ExtraArgs...)
+	return w.Env.build(w.Dir, importPath, binaryPath, opts)
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"testing"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestSplitVersion(t *testing.T) {
+	for _, tt := range []struct {
+		spec       string
+		mod        module.Version
+		importPath string
+		ok         bool
+		name       string
+	}{
+		{
+			spec:       "github.com/u-root/u-root/cmds/core/ls",
+			importPath: "github.com/u-root/u-root/cmds/core/ls",
+			name:       "ls",
+		},
+		{
+			spec:       "github.com/u-root/cpu@v1.0.0/cmds/cpud",
+			mod:        module.Version{Path: "github.com/u-root/cpu", Version: "v1.0.0"},
+			importPath: "github.com/u-root/cpu/cmds/cpud",
+			ok:         true,
+			name:       "cpud",
+		},
+		{
+			spec:       "github.com/u-root/gobusybox/src@v0.1.0",
+			mod:        module.Version{Path: "github.com/u-root/gobusybox/src", Version: "v0.1.0"},
+			importPath: "github.com/u-root/gobusybox/src",
+			ok:         true,
+			name:       "src",
+		},
+	} {
+		mod, importPath, ok := SplitVersion(tt.spec)
+		if mod != tt.mod || importPath != tt.importPath || ok != tt.ok {
+			t.Errorf("SplitVersion(%q) = %v, %q, %v; want %v, %q, %v", tt.spec, mod, importPath, ok, tt.mod, tt.importPath, tt.ok)
+		}
+		if got := CommandName(tt.spec); got != tt.name {
+			t.Errorf("CommandName(%q) = %q, want %q", tt.spec, got, tt.name)
+		}
+	}
+}
+
+func TestWorkspaceModFile(t *testing.T) {
+	w := &Workspace{mod: &modfile.File{Syntax: &modfile.FileSyntax{}}}
+	for _, r := range []module.Version{
+		{Path: "example.com/a", Version: "v1.2.0"},
+		{Path: "example.com/a", Version: "v1.10.0"},
+		{Path: "example.com/a", Version: "v1.3.0"},
+	} {
+		if err := w.Require(r.Path, r.Version); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.mod.Require) != 1 || w.mod.Require[0].Mod.Version != "v1.10.0" {
+		t.Errorf("requirements = %v, want only example.com/a v1.10.0", w.mod.Require)
+	}
+
+	old := module.Version{Path: "example.com/b"}
+	if err := w.Replace(old, module.Version{Path: "/src/b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Replace(old, module.Version{Path: "/src/b"}); err != nil {
+		t.Errorf("replacing the same way twice: %v", err)
+	}
+	if err := w.Replace(old, module.Version{Path: "/other/b"}); err == nil {
+		t.Errorf("conflicting replacement succeeded")
+	}
+	if err := w.Override(old.Path, "/copy/b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.mod.Replace) != 1 || w.mod.Replace[0].New.Path != "/copy/b" {
+		t.Errorf("replacements after Override = %v, want only example.com/b => /copy/b", w.mod.Replace)
+	}
+}
+
+func TestInTree(t *testing.T) {
+	for _, tt := range []struct {
+		specs []string
+		want  bool
+	}{
+		{specs: []string{"github.com/u-root/u-root/cmds/core/ls", "github.com/u-root/u-root/pkg/bb/bbmain/cmd"}, want: true},
+		{specs: []string{"github.com/u-root/u-root/cmds/core/ls", "github.com/u-root/cpu@v1.0.0/cmds/cpud"}, want: false},
+	} {
+		got, err := Default().InTree(tt.specs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("InTree(%v) = %v, want %v", tt.specs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// fruReadLen is the number of bytes asked for in each Read FRU Data
+	// request. It is halved whenever the BMC says it is too many.
+	fruReadLen = 32
+
+	fruHeaderLen = 8
+
+	// fruEndOfFields marks the end of the fields of an info area.
+	fruEndOfFields = 0xC1
+)
+
+// fruEpoch is the time that FRU manufacturing dates count from.
+var fruEpoch = time.Date(1996, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// FRUInventoryAreaInfo is the response to a Get FRU Inventory Area Info
+// command.
+type FRUInventoryAreaInfo struct {
+	Size uint16
+
+	// WordAccess is set if the device is accessed in words, not bytes.
+	WordAccess bool
+}
+
+// GetFRUInventoryAreaInfo returns the size of the inventory area of FRU
+// device id.
+func (i *IPMI) GetFRUInventoryAreaInfo(id uint8) (*FRUInventoryAreaInfo, error) {
+	data, err := i.SendRecv(_IPMI_NETFN_STORAGE, BMC_GET_FRU_INV_AREA_INFO, []byte{id})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLen(data, 4); err != nil {
+		return nil, err
+	}
+	return &FRUInventoryAreaInfo{
+		Size:       binary.LittleEndian.Uint16(data[1:]),
+		WordAccess: data[3]&0x1 != 0,
+	}, nil
+}
+
+// ReadFRUData reads up to n bytes at offset off of the inventory area of FRU
+// device id. For devices accessed in words, off and n count words.
+func (i *IPMI) ReadFRUData(id uint8, off uint16, n uint8) ([]byte, error) {
+	req := []byte{id, 0, 0, n}
+	binary.LittleEndian.PutUint16(req[1:], off)
+
+	data, err := i.SendRecv(_IPMI_NETFN_STORAGE, BMC_READ_FRU_DATA, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLen(data, 2); err != nil {
+		return nil, err
+	}
+	return data[2:], nil
+}
+
+// ReadFRU reads the whole inventory area of FRU device id.
+func (i *IPMI) ReadFRU(id uint8) ([]byte, error) {
+	info, err := i.GetFRUInventoryAreaInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	unit := 1
+	if info.WordAccess {
+		unit = 2
+	}
+
+	size := int(info.Size)
+	buf := make([]byte, 0, size)
+	chunk := fruReadLen
+	for len(buf) < size {
+		n := size - len(buf)
+		if n > chunk {
+			n = chunk
+		}
+		if n -= n % unit; n == 0 {
+			n = unit
+		}
+		data, err := i.ReadFRUData(id, uint16(len(buf)/unit), uint8(n/unit))
+		switch {
+		case err == nil:
+		case chunk > unit && (errors.Is(err, CCCannotReturnRequestedBytes) ||
+			errors.Is(err, CCRequestDataLengthInvalid) || errors.Is(err, CCRequestDataLengthExceeded)):
+			chunk /= 2
+			continue
+		default:
+			return nil, fmt.Errorf("reading FRU %d at offset %d: %v", id, len(buf), err)
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("reading FRU %d: no data at offset %d", id, len(buf))
+		}
+		buf = append(buf, data...)
+	}
+	return buf[:size], nil
+}
+
+// GetFRU reads and parses the inventory area of FRU device id.
+func (i *IPMI) GetFRU(id uint8) (*FRU, error) {
+	data, err := i.ReadFRU(id)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFRU(data)
+}
+
+// FRU is the parsed information of a FRU inventory area, as defined in the
+// Platform Management FRU Information Storage Definition v1.0. Areas the
+// device does not have are nil.
+type FRU struct {
+	Chassis *FRUChassisInfo
+	Board   *FRUBoardInfo
+	Product *FRUProductInfo
+}
+
+// FRUChassisInfo is the chassis info area.
+type FRUChassisInfo struct {
+	// Type is an SMBIOS chassis type.
+	Type         uint8
+	PartNumber   string
+	SerialNumber string
+	Custom       []string
+}
+
+// FRUBoardInfo is the board info area.
+type FRUBoardInfo struct {
+	Language uint8
+	// MfgDate is the zero Time if it is unspecified.
+	MfgDate      time.Time
+	Manufacturer string
+	ProductName  string
+	SerialNumber string
+	PartNumber   string
+	FRUFileID    string
+	Custom       []string
+}
+
+// FRUProductInfo is the product info area.
+type FRUProductInfo struct {
+	Language     uint8
+	Manufacturer string
+	Name         string
+	PartNumber   string
+	Version      string
+	SerialNumber string
+	AssetTag     string
+	FRUFileID    string
+	Custom       []string
+}
+
+// checksum reports whether the bytes of b add up to zero.
+func checksum(b []byte) bool {
+	var sum uint8
+	for _, c := range b {
+		sum += c
+	}
+	return sum == 0
+}
+
+// ParseFRU parses a FRU inventory area.
+func ParseFRU(data []byte) (*FRU, error) {
+	if len(data) < fruHeaderLen {
+		return nil, fmt.Errorf("FRU data too short: %d bytes", len(data))
+	}
+	if v := data[0] & 0xf; v != 1 {
+		return nil, fmt.Errorf("unsupported FRU format version %d", v)
+	}
+	if !checksum(data[:fruHeaderLen]) {
+		return nil, errors.New("bad FRU common header checksum")
+	}
+
+	var fru FRU
+	if off := data[2]; off != 0 {
+		f, fixed, err := fruArea(data, off, 1)
+		if err != nil {
+			return nil, fmt.Errorf("chassis info area: %v", err)
+		}
+		fru.Chassis = &FRUChassisInfo{
+			Type:         fixed[0],
+			PartNumber:   f.next(),
+			SerialNumber: f.next(),
+			Custom:       f.rest(),
+		}
+		if f.err != nil {
+			return nil, fmt.Errorf("chassis info area: %v", f.err)
+		}
+	}
+	if off := data[3]; off != 0 {
+		f, fixed, err := fruArea(data, off, 4)
+		if err != nil {
+			return nil, fmt.Errorf("board info area: %v", err)
+		}
+		fru.Board = &FRUBoardInfo{
+			Language:     fixed[0],
+			Manufacturer: f.next(),
+			ProductName:  f.next(),
+			SerialNumber: f.next(),
+			PartNumber:   f.next(),
+			FRUFileID:    f.next(),
+			Custom:       f.rest(),
+		}
+		if f.err != nil {
+			return nil, fmt.Errorf("board info area: %v", f.err)
+		}
+		if mins := uint32(fixed[1]) | uint32(fixed[2])<<8 | uint32(fixed[3])<<16; mins != 0 {
+			fru.Board.MfgDate = fruEpoch.Add(time.Duration(mins) * time.Minute)
+		}
+	}
+	if off := data[4]; off != 0 {
+		f, fixed, err := fruArea(data, off, 1)
+		if err != nil {
+			return nil, fmt.Errorf("product info area: %v", err)
+		}
+		fru.Product = &FRUProductInfo{
+			Language:     fixed[0],
+			Manufacturer: f.next(),
+			Name:         f.next(),
+			PartNumber:   f.next(),
+			Version:      f.next(),
+			SerialNumber: f.next(),
+			AssetTag:     f.next(),
+			FRUFileID:    f.next(),
+			Custom:       f.rest(),
+		}
+		if f.err != nil {
+			return nil, fmt.Errorf("product info area: %v", f.err)
+		}
+	}
+	return &fru, nil
+}
+
+// fruArea checks the info area at offset off, given in multiples of 8 bytes.
+// It returns a reader for its fields and the fixed bytes that come before
+// them.
+func fruArea(data []byte, off uint8, fixedLen int) (*fruFields, []byte, error) {
+	start := int(off) * 8
+	if start+2 > len(data) {
+		return nil, nil, fmt.Errorf("offset %d out of range", start)
+	}
+	area := data[start:]
+	if v := area[0] & 0xf; v != 1 {
+		return nil, nil, fmt.Errorf("unsupported format version %d", v)
+	}
+	n := int(area[1]) * 8
+	if n < 2+fixedLen || n > len(area) {
+		return nil, nil, fmt.Errorf("bad length %d", n)
+	}
+	area = area[:n]
+	if !checksum(area) {
+		return nil, nil, errors.New("bad checksum")
+	}
+	return &fruFields{b: area[:n-1], pos: 2 + fixedLen}, area[2 : 2+fixedLen], nil
+}
+
+// fruFields reads the type/length encoded fields of an info area.
+type fruFields struct {
+	b   []byte
+	pos int
+	end bool
+	err error
+}
+
+// next returns the next field, or "" after the last one.
+func (f *fruFields) next() string {
+	if f.end || f.err != nil {
+		return ""
+	}
+	if f.pos >= len(f.b) {
+		f.err = errors.New("missing end of fields marker")
+		return ""
+	}
+	tl := f.b[f.pos]
+	if tl == fruEndOfFields {
+		f.end = true
+		return ""
+	}
+	n := int(tl & 0x3f)
+	if f.pos+1+n > len(f.b) {
+		f.err = fmt.Errorf("field at offset %d overruns the area", f.pos)
+		return ""
+	}
+	s := decodeString(tl>>6, f.b[f.pos+1:f.pos+1+n])
+	f.pos += 1 + n
+	return s
+}
+
+// rest returns the remaining, custom fields.
+func (f *fruFields) rest() []string {
+	var fields []string
+	for {
+		s := f.next()
+		if f.end || f.err != nil {
+			return fields
+		}
+		fields = append(fields, s)
+	}
+}
+
+// decodeString decodes a string of the given type, as used in type/length
+// bytes of FRU fields and sensor record IDs.
+func decodeString(typ uint8, b []byte) string {
+	switch typ {
+	case 0: // binary
+		return fmt.Sprintf("%x", b)
+	case 1: // BCD plus
+		const digits = "0123456789 -.:,_"
+		s := make([]byte, 0, 2*len(b))
+		for _, c := range b {
+			s = append(s, digits[c>>4], digits[c&0xf])
+		}
+		return string(s)
+	case 2: // 6-bit packed ASCII
+		var (
+			s    []byte
+			acc  uint32
+			bits uint
+		)
+		for _, c := range b {
+			acc |= uint32(c) << bits
+			for bits += 8; bits >= 6; bits -= 6 {
+				s = append(s, byte(acc&0x3f)+0x20)
+				acc >>= 6
+			}
+		}
+		return string(s)
+	}
+	return string(b)
+}
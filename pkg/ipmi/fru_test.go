@@ -0,0 +1,135 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fruInfoArea builds an info area holding fixed followed by 8-bit ASCII
+// fields.
+func fruInfoArea(fixed []byte, fields ...string) []byte {
+	a := append([]byte{1, 0}, fixed...)
+	for _, f := range fields {
+		a = append(a, 0xc0|byte(len(f)))
+		a = append(a, f...)
+	}
+	a = append(a, fruEndOfFields)
+	for len(a)%8 != 7 {
+		a = append(a, 0)
+	}
+	a[1] = byte((len(a) + 1) / 8)
+	return append(a, zeroSum(a))
+}
+
+func zeroSum(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return -sum
+}
+
+func testFRU() []byte {
+	chassis := fruInfoArea([]byte{0x17}, "CH-1", "CS123")
+	board := fruInfoArea([]byte{0, 0xa0, 0xdd, 0xbb}, "Acme", "Mainboard", "BS456", "BP-2", "", "rev A")
+	product := fruInfoArea([]byte{0}, "Acme", "Server", "PP-3", "1.0", "PS789", "asset", "")
+
+	hdr := []byte{1, 0, 1, byte(1 + len(chassis)/8), byte(1 + (len(chassis)+len(board))/8), 0, 0}
+	hdr = append(hdr, zeroSum(hdr))
+
+	fru := append(hdr, chassis...)
+	fru = append(fru, board...)
+	return append(fru, product...)
+}
+
+func TestGetFRU(t *testing.T) {
+	want := &FRU{
+		Chassis: &FRUChassisInfo{
+			Type:         0x17,
+			PartNumber:   "CH-1",
+			SerialNumber: "CS123",
+		},
+		Board: &FRUBoardInfo{
+			MfgDate:      time.Date(2019, 5, 29, 23, 28, 0, 0, time.UTC),
+			Manufacturer: "Acme",
+			ProductName:  "Mainboard",
+			SerialNumber: "BS456",
+			PartNumber:   "BP-2",
+			Custom:       []string{"rev A"},
+		},
+		Product: &FRUProductInfo{
+			Manufacturer: "Acme",
+			Name:         "Server",
+			PartNumber:   "PP-3",
+			Version:      "1.0",
+			SerialNumber: "PS789",
+			AssetTag:     "asset",
+		},
+	}
+
+	for _, tt := range []struct {
+		name string
+		bmc  *fakeBMC
+	}{
+		{name: "bytes", bmc: &fakeBMC{fru: testFRU()}},
+		{name: "small reads", bmc: &fakeBMC{fru: testFRU(), maxRead: 5}},
+		{name: "words", bmc: &fakeBMC{fru: testFRU(), fruWords: true, maxRead: 8}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			i := New(tt.bmc)
+			got, err := i.GetFRU(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetFRU() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseFRUErrors(t *testing.T) {
+	badHeader := testFRU()
+	badHeader[7]++
+	badArea := testFRU()
+	badArea[10]++
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "short", data: []byte{1, 0, 0}},
+		{name: "version", data: []byte{2, 0, 0, 0, 0, 0, 0, 0xfe}},
+		{name: "header checksum", data: badHeader},
+		{name: "area checksum", data: badArea},
+		{name: "area offset", data: []byte{1, 0, 4, 0, 0, 0, 0, 0xfb}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFRU(tt.data); err == nil {
+				t.Errorf("ParseFRU() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	for _, tt := range []struct {
+		typ  uint8
+		data []byte
+		want string
+	}{
+		{typ: 0, data: []byte{0xde, 0xad}, want: "dead"},
+		{typ: 1, data: []byte{0x12, 0xab, 0xcd}, want: "12 -.:"},
+		{typ: 2, data: []byte{0xf0, 0x5c, 0x47}, want: "PSU1"},
+		{typ: 3, data: []byte("Acme"), want: "Acme"},
+	} {
+		if got := decodeString(tt.typ, tt.data); got != tt.want {
+			t.Errorf("decodeString(%d, %x) = %q, want %q", tt.typ, tt.data, got, tt.want)
+		}
+	}
+}
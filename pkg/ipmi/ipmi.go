@@ -13,6 +13,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
@@ -34,6 +35,7 @@ const (
 
 	// Net functions
 	_IPMI_NETFN_CHASSIS   NetFn = 0x0
+	_IPMI_NETFN_SENSOR    NetFn = 0x4
 	_IPMI_NETFN_APP       NetFn = 0x6
 	_IPMI_NETFN_STORAGE   NetFn = 0xA
 	_IPMI_NETFN_TRANSPORT NetFn = 0xC
@@ -52,8 +54,22 @@ const (
 	// Chassis Device Commands
 	BMC_GET_CHASSIS_STATUS Command = 0x01
 
+	// Sensor Device Commands
+	BMC_GET_SENSOR_READING Command = 0x2D
+
+	// FRU Inventory Device Commands
+	BMC_GET_FRU_INV_AREA_INFO Command = 0x10
+	BMC_READ_FRU_DATA         Command = 0x11
+
+	// SDR Repository Device Commands
+	BMC_RESERVE_SDR_REPO Command = 0x22
+	BMC_GET_SDR          Command = 0x23
+
 	// SEL device Commands
-	BMC_GET_SEL_INFO Command = 0x40
+	BMC_GET_SEL_INFO  Command = 0x40
+	BMC_RESERVE_SEL   Command = 0x42
+	BMC_GET_SEL_ENTRY Command = 0x43
+	BMC_CLEAR_SEL     Command = 0x47
 
 	//LAN Device Commands
 	BMC_GET_LAN_CONFIG Command = 0x02
@@ -88,7 +104,95 @@ var (
 
 // IPMI represents access to the IPMI interface.
 type IPMI struct {
+	// File is the OpenIPMI device, if the IPMI was opened with Open.
 	*os.File
+
+	// t carries the requests.
+	t Transport
+}
+
+// Transport sends a request to a BMC and returns the response, starting with
+// the completion code.
+//
+// Transports are the OpenIPMI device (see Open), an RMCP+ session with a BMC
+// on the network (see DialLAN), or a fake BMC in tests. Transports that are
+// io.Closers are closed by IPMI.Close.
+type Transport interface {
+	SendRecv(netfn NetFn, cmd Command, data []byte) ([]byte, error)
+}
+
+// New returns an IPMI that sends its requests through t.
+func New(t Transport) *IPMI {
+	return &IPMI{t: t}
+}
+
+// Close closes the IPMI's transport.
+func (i *IPMI) Close() error {
+	if c, ok := i.t.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// dev is the Transport of the OpenIPMI device.
+type dev struct {
+	f *os.File
+}
+
+func (d dev) Close() error {
+	return d.f.Close()
+}
+
+// CompletionCode is the status byte that starts every response. Non-zero
+// codes are returned as errors.
+type CompletionCode byte
+
+// Completion codes are defined in IPMI v2.0 Table 5-2.
+const (
+	CCNodeBusy                   CompletionCode = 0xC0
+	CCInvalidCommand             CompletionCode = 0xC1
+	CCTimeout                    CompletionCode = 0xC3
+	CCOutOfSpace                 CompletionCode = 0xC4
+	CCReservationCanceled        CompletionCode = 0xC5
+	CCRequestDataTruncated       CompletionCode = 0xC6
+	CCRequestDataLengthInvalid   CompletionCode = 0xC7
+	CCRequestDataLengthExceeded  CompletionCode = 0xC8
+	CCParameterOutOfRange        CompletionCode = 0xC9
+	CCCannotReturnRequestedBytes CompletionCode = 0xCA
+	CCNotPresent                 CompletionCode = 0xCB
+	CCInvalidDataField           CompletionCode = 0xCC
+	CCUnspecified                CompletionCode = 0xFF
+)
+
+func (c CompletionCode) Error() string {
+	names := map[CompletionCode]string{
+		CCNodeBusy:                   "node busy",
+		CCInvalidCommand:             "invalid command",
+		CCTimeout:                    "timeout while processing command",
+		CCOutOfSpace:                 "out of space",
+		CCReservationCanceled:        "reservation canceled or invalid",
+		CCRequestDataTruncated:       "request data truncated",
+		CCRequestDataLengthInvalid:   "request data length invalid",
+		CCRequestDataLengthExceeded:  "request data field length limit exceeded",
+		CCParameterOutOfRange:        "parameter out of range",
+		CCCannotReturnRequestedBytes: "cannot return number of requested data bytes",
+		CCNotPresent:                 "requested sensor, data, or record not present",
+		CCInvalidDataField:           "invalid data field in request",
+		CCUnspecified:                "unspecified error",
+	}
+	if name, ok := names[c]; ok {
+		return fmt.Sprintf("completion code 0x%02x: %s", byte(c), name)
+	}
+	return fmt.Sprintf("completion code 0x%02x", byte(c))
+}
+
+// checkLen returns an error if a response, including its completion code, is
+// shorter than n bytes.
+func checkLen(data []byte, n int) error {
+	if len(data) < n {
+		return fmt.Errorf("response too short: got %d bytes, want at least %d", len(data), n)
+	}
+	return nil
 }
 
 // Command is the command code for a given message.
@@ -226,8 +330,34 @@ func ioctlGetRecv(fd, name uintptr, recv *recv) error {
 // response data. This is recommended for use unless the user must be able to
 // specify the data pointer and length on their own.
 func (i *IPMI) SendRecv(netfn NetFn, cmd Command, data []byte) ([]byte, error) {
+	buf, err := i.t.SendRecv(netfn, cmd, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLen(buf, 1); err != nil {
+		return nil, err
+	}
+	if buf[0] != 0 {
+		return nil, CompletionCode(buf[0])
+	}
+	return buf, nil
+}
+
+// RawSendRecv sends the IPMI message, receives the response, and returns the
+// response data.
+func (i *IPMI) RawSendRecv(msg Msg) ([]byte, error) {
+	var data []byte
+	if msg.DataLen > 0 {
+		data = (*[1 << 16]byte)(msg.Data)[:msg.DataLen:msg.DataLen]
+	}
+	return i.SendRecv(msg.Netfn, msg.Cmd, data)
+}
+
+// SendRecv sends a request through the OpenIPMI device and waits for its
+// response.
+func (d dev) SendRecv(netfn NetFn, cmd Command, data []byte) ([]byte, error) {
 	var dataPtr unsafe.Pointer
-	if data != nil {
+	if len(data) > 0 {
 		dataPtr = unsafe.Pointer(&data[0])
 	}
 	msg := Msg{
@@ -236,12 +366,7 @@ func (i *IPMI) SendRecv(netfn NetFn, cmd Command, data []byte) ([]byte, error) {
 		Data:    dataPtr,
 		DataLen: uint16(len(data)),
 	}
-	return i.RawSendRecv(msg)
-}
 
-// RawSendRecv sends the IPMI message, receives the response, and returns the
-// response data.
-func (i *IPMI) RawSendRecv(msg Msg) ([]byte, error) {
 	addr := &systemInterfaceAddr{
 		addrType: _IPMI_SYSTEM_INTERFACE_ADDR_TYPE,
 		channel:  _IPMI_BMC_CHANNEL,
@@ -255,7 +380,7 @@ func (i *IPMI) RawSendRecv(msg Msg) ([]byte, error) {
 
 	// Send request.
 	for {
-		switch err := ioctlSetReq(i.Fd(), _IPMICTL_SEND_COMMAND, req); {
+		switch err := ioctlSetReq(d.f.Fd(), _IPMICTL_SEND_COMMAND, req); {
 		case err == syscall.EINTR:
 			continue
 		case err != nil:
@@ -292,8 +417,6 @@ func (i *IPMI) RawSendRecv(msg Msg) ([]byte, error) {
 
 		if recv.msg.DataLen >= _IPMI_BUF_SIZE {
 			rerr = fmt.Errorf("data length received too large: %d > %d", recv.msg.DataLen, _IPMI_BUF_SIZE)
-		} else if buf[0] != 0 {
-			rerr = fmt.Errorf("invalid response, expected first byte of response to be 0, got: %v", buf[0])
 		} else {
 			result = buf[:recv.msg.DataLen:recv.msg.DataLen]
 			rerr = nil
@@ -302,11 +425,11 @@ func (i *IPMI) RawSendRecv(msg Msg) ([]byte, error) {
 	}
 
 	// Read response.
-	conn, err := i.File.SyscallConn()
+	conn, err := d.f.SyscallConn()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file rawconn: %v", err)
 	}
-	if err := i.File.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+	if err := d.f.SetReadDeadline(time.Now().Add(timeout)); err != nil {
 		return nil, fmt.Errorf("failed to set read deadline: %v", err)
 	}
 	if err := conn.Read(readMsg); err != nil {
@@ -0,0 +1,159 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// fakeBMC answers the storage and sensor commands from canned data, in place
+// of /dev/ipmi.
+type fakeBMC struct {
+	sdrs     [][]byte
+	readings map[uint8][]byte
+	sel      [][]byte
+	fru      []byte
+	fruWords bool
+
+	// maxRead limits the data returned by Get SDR and Read FRU Data.
+	maxRead int
+
+	// cancel cancels the SDR reservation before the next n Get SDR
+	// requests with a non-zero offset.
+	cancel int
+
+	reservation uint16
+	selCleared  bool
+	clearPolls  int
+}
+
+func cc(c CompletionCode) []byte {
+	return []byte{byte(c)}
+}
+
+func (f *fakeBMC) SendRecv(netfn NetFn, cmd Command, data []byte) ([]byte, error) {
+	switch {
+	case netfn == _IPMI_NETFN_STORAGE && (cmd == BMC_RESERVE_SDR_REPO || cmd == BMC_RESERVE_SEL):
+		f.reservation++
+		return []byte{0, byte(f.reservation), byte(f.reservation >> 8)}, nil
+
+	case netfn == _IPMI_NETFN_STORAGE && cmd == BMC_GET_SDR:
+		if len(data) != 6 {
+			return cc(CCRequestDataLengthInvalid), nil
+		}
+		res := binary.LittleEndian.Uint16(data[0:])
+		id := int(binary.LittleEndian.Uint16(data[2:]))
+		off, n := int(data[4]), int(data[5])
+		if off != 0 {
+			if f.cancel > 0 {
+				f.cancel--
+				f.reservation++
+			}
+			if res != f.reservation {
+				return cc(CCReservationCanceled), nil
+			}
+		}
+		if id >= len(f.sdrs) {
+			return cc(CCNotPresent), nil
+		}
+		if f.maxRead > 0 && n > f.maxRead {
+			return cc(CCCannotReturnRequestedBytes), nil
+		}
+		rec := f.sdrs[id]
+		if off+n > len(rec) {
+			n = len(rec) - off
+		}
+		next := id + 1
+		if next == len(f.sdrs) {
+			next = 0xffff
+		}
+		return append([]byte{0, byte(next), byte(next >> 8)}, rec[off:off+n]...), nil
+
+	case netfn == _IPMI_NETFN_SENSOR && cmd == BMC_GET_SENSOR_READING:
+		r, ok := f.readings[data[0]]
+		if !ok {
+			return cc(CCNotPresent), nil
+		}
+		return append([]byte{0}, r...), nil
+
+	case netfn == _IPMI_NETFN_STORAGE && cmd == BMC_GET_SEL_ENTRY:
+		id := int(binary.LittleEndian.Uint16(data[2:]))
+		if id >= len(f.sel) {
+			return cc(CCNotPresent), nil
+		}
+		next := id + 1
+		if next == len(f.sel) {
+			next = 0xffff
+		}
+		return append([]byte{0, byte(next), byte(next >> 8)}, f.sel[id]...), nil
+
+	case netfn == _IPMI_NETFN_STORAGE && cmd == BMC_CLEAR_SEL:
+		if binary.LittleEndian.Uint16(data) != f.reservation || string(data[2:5]) != "CLR" {
+			return cc(CCInvalidDataField), nil
+		}
+		if data[5] == 0xaa {
+			f.sel = nil
+			f.selCleared = true
+			return []byte{0, 0}, nil
+		}
+		f.clearPolls++
+		return []byte{0, 1}, nil
+
+	case netfn == _IPMI_NETFN_STORAGE && cmd == BMC_GET_FRU_INV_AREA_INFO:
+		var access byte
+		if f.fruWords {
+			access = 1
+		}
+		return []byte{0, byte(len(f.fru)), byte(len(f.fru) >> 8), access}, nil
+
+	case netfn == _IPMI_NETFN_STORAGE && cmd == BMC_READ_FRU_DATA:
+		off := int(binary.LittleEndian.Uint16(data[1:]))
+		n := int(data[3])
+		if f.fruWords {
+			off, n = off*2, n*2
+		}
+		if f.maxRead > 0 && n > f.maxRead {
+			return cc(CCCannotReturnRequestedBytes), nil
+		}
+		if off+n > len(f.fru) {
+			n = len(f.fru) - off
+		}
+		count := n
+		if f.fruWords {
+			count /= 2
+		}
+		return append([]byte{0, byte(count)}, f.fru[off:off+n]...), nil
+	}
+	return cc(CCInvalidCommand), nil
+}
+
+func TestCompletionCode(t *testing.T) {
+	i := New(&fakeBMC{})
+
+	_, err := i.SendRecv(_IPMI_NETFN_APP, BMC_GET_DEVICE_ID, nil)
+	if !errors.Is(err, CCInvalidCommand) {
+		t.Errorf("SendRecv() = %v, want %v", err, CCInvalidCommand)
+	}
+	if got, want := CCInvalidCommand.Error(), "completion code 0xc1: invalid command"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := CompletionCode(0x80).Error(), "completion code 0x80"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestRawCmd(t *testing.T) {
+	i := New(&fakeBMC{})
+
+	got, err := i.RawCmd([]byte{byte(_IPMI_NETFN_STORAGE), byte(BMC_RESERVE_SEL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 1, 0}; string(got) != string(want) {
+		t.Errorf("RawCmd() = %v, want %v", got, want)
+	}
+}
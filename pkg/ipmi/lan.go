@@ -0,0 +1,648 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"sync"
+	"time"
+)
+
+// The RMCP+ protocol (IPMI v2.0 "lanplus") is described in IPMI v2.0
+// sections 13.6 through 13.31.
+
+// LANPort is the default UDP port of RMCP+.
+const LANPort = "623"
+
+const (
+	_RMCP_VERSION      = 0x06
+	_RMCP_SEQ_NO_ACK   = 0xff
+	_RMCP_CLASS_IPMI   = 0x07
+	_AUTHTYPE_RMCPPLUS = 0x06
+
+	_RMCP_HEADER_LEN    = 4
+	_SESSION_HEADER_LEN = 12
+
+	// Commands that manage the session itself.
+	_SET_SESSION_PRIVILEGE_LEVEL Command = 0x3B
+	_CLOSE_SESSION               Command = 0x3C
+
+	// Addresses in the IPMI messages of the LAN channel.
+	_BMC_SLAVE_ADDR     = 0x20
+	_REMOTE_SOFTWARE_ID = 0x81
+
+	// keyLen is the length of the user key Kuid and of the constants the
+	// session keys K1 and K2 are derived from.
+	keyLen = 20
+)
+
+// payloadType is the type of an RMCP+ payload. The two top bits say whether
+// it is encrypted and authenticated.
+type payloadType byte
+
+const (
+	payloadIPMI                payloadType = 0x00
+	payloadOpenSessionRequest  payloadType = 0x10
+	payloadOpenSessionResponse payloadType = 0x11
+	payloadRAKP1               payloadType = 0x12
+	payloadRAKP2               payloadType = 0x13
+	payloadRAKP3               payloadType = 0x14
+	payloadRAKP4               payloadType = 0x15
+
+	payloadEncrypted     payloadType = 0x80
+	payloadAuthenticated payloadType = 0x40
+)
+
+// PrivilegeLevel is the privilege level of a session.
+type PrivilegeLevel byte
+
+// Privilege levels are defined in IPMI v2.0 Table 22-23.
+const (
+	PrivilegeCallback      PrivilegeLevel = 0x01
+	PrivilegeUser          PrivilegeLevel = 0x02
+	PrivilegeOperator      PrivilegeLevel = 0x03
+	PrivilegeAdministrator PrivilegeLevel = 0x04
+	PrivilegeOEM           PrivilegeLevel = 0x05
+)
+
+// CipherSuite picks the authentication, integrity and confidentiality
+// algorithms of a session, as listed in IPMI v2.0 Table 22-20.
+type CipherSuite byte
+
+// Supported cipher suites.
+const (
+	// CipherSuite3 is RAKP-HMAC-SHA1, HMAC-SHA1-96 and AES-CBC-128.
+	CipherSuite3 CipherSuite = 3
+
+	// CipherSuite17 is RAKP-HMAC-SHA256, HMAC-SHA256-128 and AES-CBC-128.
+	CipherSuite17 CipherSuite = 17
+)
+
+// suite holds the algorithms of a cipher suite.
+type suite struct {
+	auth, integrity, confidentiality byte
+
+	hash func() hash.Hash
+
+	// icvLen is the length of the RAKP 4 integrity check value and of the
+	// authentication code of every packet of the session.
+	icvLen int
+}
+
+var suites = map[CipherSuite]suite{
+	CipherSuite3:  {auth: 0x01, integrity: 0x01, confidentiality: 0x01, hash: sha1.New, icvLen: 12},
+	CipherSuite17: {auth: 0x03, integrity: 0x04, confidentiality: 0x01, hash: sha256.New, icvLen: 16},
+}
+
+func (s suite) hmac(key []byte, data ...[]byte) []byte {
+	m := hmac.New(s.hash, key)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+// RAKPStatus is the status code of the Open Session Response and of RAKP
+// messages 2 and 4. Non-zero codes are returned as errors.
+type RAKPStatus byte
+
+// RAKP status codes are defined in IPMI v2.0 Table 13-15.
+const (
+	RAKPInsufficientResources     RAKPStatus = 0x01
+	RAKPInvalidSessionID          RAKPStatus = 0x02
+	RAKPInvalidPayloadType        RAKPStatus = 0x03
+	RAKPInvalidAuthAlgorithm      RAKPStatus = 0x04
+	RAKPInvalidIntegrityAlgorithm RAKPStatus = 0x05
+	RAKPNoMatchingAuthPayload     RAKPStatus = 0x06
+	RAKPNoMatchingIntegrity       RAKPStatus = 0x07
+	RAKPInactiveSessionID         RAKPStatus = 0x08
+	RAKPInvalidRole               RAKPStatus = 0x09
+	RAKPUnauthorizedRole          RAKPStatus = 0x0A
+	RAKPInsufficientResourcesRole RAKPStatus = 0x0B
+	RAKPInvalidNameLength         RAKPStatus = 0x0C
+	RAKPUnauthorizedName          RAKPStatus = 0x0D
+	RAKPUnauthorizedGUID          RAKPStatus = 0x0E
+	RAKPInvalidIntegrityCheck     RAKPStatus = 0x0F
+	RAKPInvalidConfidentiality    RAKPStatus = 0x10
+	RAKPNoCipherSuiteMatch        RAKPStatus = 0x11
+)
+
+func (s RAKPStatus) Error() string {
+	names := map[RAKPStatus]string{
+		RAKPInsufficientResources:     "insufficient resources to create a session",
+		RAKPInvalidSessionID:          "invalid session ID",
+		RAKPInvalidPayloadType:        "invalid payload type",
+		RAKPInvalidAuthAlgorithm:      "invalid authentication algorithm",
+		RAKPInvalidIntegrityAlgorithm: "invalid integrity algorithm",
+		RAKPNoMatchingAuthPayload:     "no matching authentication payload",
+		RAKPNoMatchingIntegrity:       "no matching integrity payload",
+		RAKPInactiveSessionID:         "inactive session ID",
+		RAKPInvalidRole:               "invalid role",
+		RAKPUnauthorizedRole:          "unauthorized role or privilege level requested",
+		RAKPInsufficientResourcesRole: "insufficient resources to create a session at the requested role",
+		RAKPInvalidNameLength:         "invalid name length",
+		RAKPUnauthorizedName:          "unauthorized name",
+		RAKPUnauthorizedGUID:          "unauthorized GUID",
+		RAKPInvalidIntegrityCheck:     "invalid integrity check value",
+		RAKPInvalidConfidentiality:    "invalid confidentiality algorithm",
+		RAKPNoCipherSuiteMatch:        "no cipher suite match with proposed security algorithms",
+	}
+	if name, ok := names[s]; ok {
+		return fmt.Sprintf("RAKP status 0x%02x: %s", byte(s), name)
+	}
+	return fmt.Sprintf("RAKP status 0x%02x", byte(s))
+}
+
+// ErrAuth is returned by DialLAN if the BMC's RAKP 2 or 4 message does not
+// prove that it knows the user's password, usually because the password is
+// wrong.
+var ErrAuth = errors.New("BMC authentication failed; wrong password?")
+
+// LANConfig configures an RMCP+ session. The zero value is valid, for the
+// anonymous user without a password.
+type LANConfig struct {
+	Username string
+	Password string
+
+	// KG is the BMC key. If it is nil, the password is used.
+	KG []byte
+
+	// Privilege is the privilege level to request. The default is
+	// PrivilegeAdministrator.
+	Privilege PrivilegeLevel
+
+	// CipherSuite is CipherSuite3, the default, or CipherSuite17.
+	CipherSuite CipherSuite
+
+	// Timeout is how long to wait for each response. The default is one
+	// second.
+	Timeout time.Duration
+
+	// Retries is how often a request is resent when no response arrives in
+	// time. The default is 3.
+	Retries int
+}
+
+// keys are the session keys of an active session.
+type keys struct {
+	suite
+	k1, k2 []byte
+}
+
+// LAN is a Transport to a BMC on the network, through an RMCP+ session.
+type LAN struct {
+	conn net.Conn
+	c    LANConfig
+	keys *keys
+
+	// mu serializes requests.
+	mu sync.Mutex
+
+	// sidm is our session ID, sidc the BMC's.
+	sidm, sidc uint32
+
+	// seq is the session sequence number of the last packet we sent.
+	seq uint32
+
+	// rqSeq is the sequence number of the last IPMI request.
+	rqSeq byte
+
+	// tag is the message tag of the last session setup message.
+	tag byte
+}
+
+var _ Transport = &LAN{}
+
+// DialLAN opens an RMCP+ session with the BMC at addr, a host with an
+// optional port. c may be nil for the defaults.
+//
+// Use New to send IPMI commands through the session, and Close to end it.
+func DialLAN(addr string, c *LANConfig) (*LAN, error) {
+	l := &LAN{}
+	if c != nil {
+		l.c = *c
+	}
+	if l.c.Privilege == 0 {
+		l.c.Privilege = PrivilegeAdministrator
+	}
+	if l.c.CipherSuite == 0 {
+		l.c.CipherSuite = CipherSuite3
+	}
+	if l.c.Timeout == 0 {
+		l.c.Timeout = time.Second
+	}
+	if l.c.Retries == 0 {
+		l.c.Retries = 3
+	}
+	if len(l.c.Username) > 16 {
+		return nil, fmt.Errorf("user name %q longer than 16 bytes", l.c.Username)
+	}
+	if len(l.c.Password) > keyLen {
+		return nil, fmt.Errorf("password longer than %d bytes", keyLen)
+	}
+	s, ok := suites[l.c.CipherSuite]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cipher suite %d", l.c.CipherSuite)
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, LANPort)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l.conn = conn
+	if err := l.open(s); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening RMCP+ session with %s: %w", addr, err)
+	}
+	return l, nil
+}
+
+// open establishes the session: Open Session Request and Response, RAKP 1
+// through 4, and Set Session Privilege Level.
+func (l *LAN) open(s suite) error {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	l.sidm = binary.LittleEndian.Uint32(b[:]) | 1
+
+	resp, err := l.handshake(payloadOpenSessionRequest, payloadOpenSessionResponse, 36, func(tag byte) []byte {
+		return openSessionRequest(tag, l.c.Privilege, l.sidm, s)
+	})
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(resp[4:]) != l.sidm {
+		return fmt.Errorf("open session response for session 0x%08x, want 0x%08x", binary.LittleEndian.Uint32(resp[4:]), l.sidm)
+	}
+	l.sidc = binary.LittleEndian.Uint32(resp[8:])
+	if resp[16] != s.auth || resp[24] != s.integrity || resp[32] != s.confidentiality {
+		return fmt.Errorf("BMC picked algorithms %d/%d/%d instead of cipher suite %d", resp[16], resp[24], resp[32], l.c.CipherSuite)
+	}
+
+	// RAKP 1 and 2.
+	rm := make([]byte, 16)
+	if _, err := rand.Read(rm); err != nil {
+		return err
+	}
+	role := byte(l.c.Privilege)
+	name := []byte(l.c.Username)
+	resp, err = l.handshake(payloadRAKP1, payloadRAKP2, 40+s.hash().Size(), func(tag byte) []byte {
+		msg := []byte{tag, 0, 0, 0}
+		msg = appendUint32(msg, l.sidc)
+		msg = append(msg, rm...)
+		msg = append(msg, role, 0, 0, byte(len(name)))
+		return append(msg, name...)
+	})
+	if err != nil {
+		return err
+	}
+	rc, guid := resp[8:24], resp[24:40]
+	kuid := userKey(l.c.Password)
+	if want := s.hmac(kuid, le32(l.sidm), le32(l.sidc), rm, rc, guid, []byte{role, byte(len(name))}, name); !hmac.Equal(resp[40:40+len(want)], want) {
+		return ErrAuth
+	}
+
+	// RAKP 3 and 4.
+	sik := s.hmac(kg(l.c.KG, kuid), rm, rc, []byte{role, byte(len(name))}, name)
+	resp, err = l.handshake(payloadRAKP3, payloadRAKP4, 8+s.icvLen, func(tag byte) []byte {
+		msg := []byte{tag, 0, 0, 0}
+		msg = appendUint32(msg, l.sidc)
+		return append(msg, s.hmac(kuid, rc, le32(l.sidm), []byte{role, byte(len(name))}, name)...)
+	})
+	if err != nil {
+		return err
+	}
+	if want := s.hmac(sik, rm, le32(l.sidc), guid)[:s.icvLen]; !hmac.Equal(resp[8:8+s.icvLen], want) {
+		return ErrAuth
+	}
+
+	l.keys = sessionKeys(s, sik)
+	resp, err = l.SendRecv(_IPMI_NETFN_APP, _SET_SESSION_PRIVILEGE_LEVEL, []byte{role})
+	if err != nil {
+		return err
+	}
+	if err := checkLen(resp, 1); err != nil {
+		return err
+	}
+	if resp[0] != 0 {
+		return fmt.Errorf("setting session privilege level %d: %v", role, CompletionCode(resp[0]))
+	}
+	return nil
+}
+
+// handshake sends a session setup message built by req and returns the
+// response of type rt, which must be at least n bytes long and have status 0.
+func (l *LAN) handshake(pt, rt payloadType, n int, req func(tag byte) []byte) ([]byte, error) {
+	l.tag++
+	tag := l.tag
+	return l.exchange(func() ([]byte, error) {
+		return encodePacket(pt, 0, 0, req(tag), nil)
+	}, func(p payload) ([]byte, error) {
+		if p.typ != rt || len(p.data) < 2 || p.data[0] != tag {
+			return nil, nil
+		}
+		if p.data[1] != 0 {
+			return nil, RAKPStatus(p.data[1])
+		}
+		if len(p.data) < n {
+			return nil, fmt.Errorf("payload type 0x%02x too short: got %d bytes, want at least %d", byte(rt), len(p.data), n)
+		}
+		return p.data, nil
+	})
+}
+
+// SendRecv sends an IPMI request through the session and returns the
+// response, starting with the completion code.
+func (l *LAN) SendRecv(netfn NetFn, cmd Command, data []byte) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rqSeq = (l.rqSeq + 1) & 0x3f
+	rqSeq := l.rqSeq
+	msg := encodeRequest(netfn, cmd, rqSeq, data)
+	return l.exchange(func() ([]byte, error) {
+		l.seq++
+		return encodePacket(payloadIPMI, l.sidc, l.seq, msg, l.keys)
+	}, func(p payload) ([]byte, error) {
+		if p.typ != payloadIPMI || p.sid != l.sidm {
+			return nil, nil
+		}
+		rnetfn, rcmd, rseq, resp, err := decodeResponse(p.data)
+		if err != nil || rnetfn != netfn|1 || rcmd != cmd || rseq != rqSeq {
+			return nil, nil
+		}
+		return resp, nil
+	})
+}
+
+// exchange sends the packets built by req until match accepts a response,
+// trying l.c.Retries more times if none arrives in time. match returns nil,
+// nil for packets that are not responses to req, which are dropped.
+func (l *LAN) exchange(req func() ([]byte, error), match func(payload) ([]byte, error)) ([]byte, error) {
+	buf := make([]byte, 1024)
+	for try := 0; try <= l.c.Retries; try++ {
+		pkt, err := req()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := l.conn.Write(pkt); err != nil {
+			return nil, err
+		}
+		if err := l.conn.SetReadDeadline(time.Now().Add(l.c.Timeout)); err != nil {
+			return nil, err
+		}
+		for {
+			n, err := l.conn.Read(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			p, err := decodePacket(buf[:n], l.keys)
+			if err != nil {
+				continue
+			}
+			resp, err := match(p)
+			if err != nil {
+				return nil, err
+			}
+			if resp != nil {
+				return resp, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no response from %s after %d tries", l.conn.RemoteAddr(), l.c.Retries+1)
+}
+
+// Close closes the session and the connection.
+func (l *LAN) Close() error {
+	if l.keys != nil {
+		// Best effort: the BMC times the session out otherwise.
+		l.SendRecv(_IPMI_NETFN_APP, _CLOSE_SESSION, le32(l.sidc))
+	}
+	return l.conn.Close()
+}
+
+// userKey returns Kuid, the password padded with zeros.
+func userKey(password string) []byte {
+	k := make([]byte, keyLen)
+	copy(k, password)
+	return k
+}
+
+// kg returns the key the session integrity key is generated with: the BMC
+// key, or Kuid if there is none.
+func kg(bmcKey, kuid []byte) []byte {
+	if bmcKey == nil {
+		return kuid
+	}
+	k := make([]byte, keyLen)
+	copy(k, bmcKey)
+	return k
+}
+
+// sessionKeys derives the integrity key K1 and the AES key K2 from the
+// session integrity key.
+func sessionKeys(s suite, sik []byte) *keys {
+	return &keys{
+		suite: s,
+		k1:    s.hmac(sik, bytes.Repeat([]byte{0x01}, keyLen)),
+		k2:    s.hmac(sik, bytes.Repeat([]byte{0x02}, keyLen))[:aes.BlockSize],
+	}
+}
+
+func le32(v uint32) []byte {
+	return appendUint32(nil, v)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func openSessionRequest(tag byte, priv PrivilegeLevel, sidm uint32, s suite) []byte {
+	msg := []byte{tag, byte(priv), 0, 0}
+	msg = appendUint32(msg, sidm)
+	msg = append(msg, 0x00, 0, 0, 8, s.auth, 0, 0, 0)
+	msg = append(msg, 0x01, 0, 0, 8, s.integrity, 0, 0, 0)
+	return append(msg, 0x02, 0, 0, 8, s.confidentiality, 0, 0, 0)
+}
+
+// payload is a decoded RMCP+ packet.
+type payload struct {
+	// typ is the payload type without the encrypted and authenticated
+	// bits.
+	typ      payloadType
+	sid, seq uint32
+	data     []byte
+}
+
+// encodePacket returns the RMCP+ packet with the given payload. If k is not
+// nil, the payload is encrypted and the packet authenticated.
+func encodePacket(pt payloadType, sid, seq uint32, data []byte, k *keys) ([]byte, error) {
+	if k != nil {
+		pt |= payloadEncrypted | payloadAuthenticated
+		var err error
+		if data, err = encrypt(k.k2, data); err != nil {
+			return nil, err
+		}
+	}
+	pkt := []byte{_RMCP_VERSION, 0, _RMCP_SEQ_NO_ACK, _RMCP_CLASS_IPMI, _AUTHTYPE_RMCPPLUS, byte(pt)}
+	pkt = appendUint32(pkt, sid)
+	pkt = appendUint32(pkt, seq)
+	pkt = append(pkt, byte(len(data)), byte(len(data)>>8))
+	pkt = append(pkt, data...)
+	if k == nil {
+		return pkt, nil
+	}
+
+	// The integrity pad aligns the authenticated part to 4 bytes, counting
+	// the pad length and next header bytes.
+	pad := (4 - (_SESSION_HEADER_LEN+len(data)+2)%4) % 4
+	pkt = append(pkt, bytes.Repeat([]byte{0xff}, pad)...)
+	pkt = append(pkt, byte(pad), _RMCP_CLASS_IPMI)
+	return append(pkt, k.hmac(k.k1, pkt[_RMCP_HEADER_LEN:])[:k.icvLen]...), nil
+}
+
+// decodePacket checks and decodes an RMCP+ packet. If k is not nil, the
+// packet's authentication code is checked and its payload decrypted if it is
+// authenticated and encrypted; otherwise, authenticated packets are errors.
+func decodePacket(pkt []byte, k *keys) (payload, error) {
+	var p payload
+	if len(pkt) < _RMCP_HEADER_LEN+_SESSION_HEADER_LEN {
+		return p, fmt.Errorf("packet too short: %d bytes", len(pkt))
+	}
+	if pkt[0] != _RMCP_VERSION || pkt[3] != _RMCP_CLASS_IPMI || pkt[4] != _AUTHTYPE_RMCPPLUS {
+		return p, fmt.Errorf("not an RMCP+ packet: % x", pkt[:5])
+	}
+	pt := payloadType(pkt[5])
+	p.typ = pt &^ (payloadEncrypted | payloadAuthenticated)
+	p.sid = binary.LittleEndian.Uint32(pkt[6:])
+	p.seq = binary.LittleEndian.Uint32(pkt[10:])
+	n := int(binary.LittleEndian.Uint16(pkt[14:]))
+	end := _RMCP_HEADER_LEN + _SESSION_HEADER_LEN + n
+	if len(pkt) < end {
+		return p, fmt.Errorf("payload length %d exceeds packet", n)
+	}
+	p.data = pkt[_RMCP_HEADER_LEN+_SESSION_HEADER_LEN : end]
+
+	if pt&payloadAuthenticated != 0 {
+		if k == nil {
+			return p, errors.New("authenticated packet outside of a session")
+		}
+		pad := (4 - (_SESSION_HEADER_LEN+n+2)%4) % 4
+		trailer := end + pad + 2
+		if len(pkt) != trailer+k.icvLen {
+			return p, errors.New("bad integrity trailer length")
+		}
+		if want := k.hmac(k.k1, pkt[_RMCP_HEADER_LEN:trailer])[:k.icvLen]; !hmac.Equal(pkt[trailer:], want) {
+			return p, errors.New("bad authentication code")
+		}
+	} else if k != nil && p.typ == payloadIPMI {
+		return p, errors.New("unauthenticated packet in a session")
+	}
+	if pt&payloadEncrypted != 0 {
+		if k == nil {
+			return p, errors.New("encrypted packet outside of a session")
+		}
+		var err error
+		if p.data, err = decrypt(k.k2, p.data); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// encrypt encrypts data with AES-CBC-128, prefixed by the random IV.
+func encrypt(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	// The confidentiality pad is 1, 2, ..., followed by its length.
+	pad := (aes.BlockSize - (len(data)+1)%aes.BlockSize) % aes.BlockSize
+	out := make([]byte, aes.BlockSize, aes.BlockSize+len(data)+pad+1)
+	if _, err := rand.Read(out); err != nil {
+		return nil, err
+	}
+	out = append(out, data...)
+	for i := 1; i <= pad; i++ {
+		out = append(out, byte(i))
+	}
+	out = append(out, byte(pad))
+	cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], out[aes.BlockSize:])
+	return out, nil
+}
+
+// decrypt reverses encrypt.
+func decrypt(key, data []byte) ([]byte, error) {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("bad encrypted payload length %d", len(data))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+	pad := int(out[len(out)-1])
+	if pad >= aes.BlockSize {
+		return nil, fmt.Errorf("bad confidentiality pad length %d", pad)
+	}
+	out = out[:len(out)-1]
+	for i := 0; i < pad; i++ {
+		if out[len(out)-pad+i] != byte(i+1) {
+			return nil, errors.New("bad confidentiality pad")
+		}
+	}
+	return out[:len(out)-pad], nil
+}
+
+// ipmbChecksum returns the checksum that makes b sum to zero.
+func ipmbChecksum(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return -sum
+}
+
+// encodeRequest returns the IPMI request message for the BMC, as sent on
+// the LAN channel.
+func encodeRequest(netfn NetFn, cmd Command, rqSeq byte, data []byte) []byte {
+	msg := []byte{_BMC_SLAVE_ADDR, byte(netfn) << 2}
+	msg = append(msg, ipmbChecksum(msg))
+	msg = append(msg, _REMOTE_SOFTWARE_ID, rqSeq<<2, byte(cmd))
+	msg = append(msg, data...)
+	return append(msg, ipmbChecksum(msg[3:]))
+}
+
+// decodeResponse decodes an IPMI response message and returns its network
+// function, command, sequence number, and data starting with the completion
+// code.
+func decodeResponse(msg []byte) (NetFn, Command, byte, []byte, error) {
+	if len(msg) < 8 {
+		return 0, 0, 0, nil, fmt.Errorf("IPMI response too short: %d bytes", len(msg))
+	}
+	if ipmbChecksum(msg[:3]) != 0 || ipmbChecksum(msg[3:]) != 0 {
+		return 0, 0, 0, nil, errors.New("bad IPMI response checksum")
+	}
+	return NetFn(msg[1] >> 2), Command(msg[5]), msg[4] >> 2, msg[6 : len(msg)-1], nil
+}
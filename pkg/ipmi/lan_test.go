@@ -0,0 +1,329 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLANBMC is the BMC end of RMCP+ sessions on a local UDP socket. It
+// passes the IPMI requests of its sessions on to a Transport.
+type fakeLANBMC struct {
+	t        *testing.T
+	conn     net.PacketConn
+	username string
+	password string
+	bmc      Transport
+
+	// drop drops the nth packet received if it returns true, counting
+	// from 1.
+	drop func(n int) bool
+
+	mu       sync.Mutex
+	received int
+	closed   int
+	sessions map[uint32]*fakeSession
+}
+
+type fakeSession struct {
+	suite
+	sidm, sidc uint32
+	rm, rc     []byte
+	role       byte
+	name       []byte
+	keys       *keys
+	priv       byte
+}
+
+var fakeGUID = bytes.Repeat([]byte{0x42}, 16)
+
+func newFakeLANBMC(t *testing.T, username, password string, bmc Transport) *fakeLANBMC {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeLANBMC{
+		t:        t,
+		conn:     conn,
+		username: username,
+		password: password,
+		bmc:      bmc,
+		sessions: make(map[uint32]*fakeSession),
+	}
+	go f.serve()
+	t.Cleanup(func() { conn.Close() })
+	return f
+}
+
+func (f *fakeLANBMC) addr() string {
+	return f.conn.LocalAddr().String()
+}
+
+func (f *fakeLANBMC) serve() {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.received++
+		if f.drop != nil && f.drop(f.received) {
+			f.mu.Unlock()
+			continue
+		}
+		resp, err := f.handle(buf[:n])
+		f.mu.Unlock()
+		if err != nil {
+			f.t.Logf("fake BMC: %v", err)
+			continue
+		}
+		f.conn.WriteTo(resp, addr)
+	}
+}
+
+func (f *fakeLANBMC) handle(pkt []byte) ([]byte, error) {
+	sid := binary.LittleEndian.Uint32(pkt[6:])
+	s := f.sessions[sid]
+	var k *keys
+	if s != nil {
+		k = s.keys
+	}
+	p, err := decodePacket(pkt, k)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.typ {
+	case payloadOpenSessionRequest:
+		return f.openSession(p.data)
+	case payloadRAKP1, payloadRAKP3:
+		// Session setup messages are sent outside of the session.
+		s = f.sessions[binary.LittleEndian.Uint32(p.data[4:])]
+	}
+	if s == nil {
+		return nil, errors.New("no session")
+	}
+	switch p.typ {
+	case payloadRAKP1:
+		return f.rakp2(s, p.data)
+	case payloadRAKP3:
+		return f.rakp4(s, p.data)
+	case payloadIPMI:
+		if s.keys == nil {
+			return nil, errors.New("IPMI request before RAKP 3")
+		}
+		return f.ipmi(s, p.data)
+	}
+	return nil, errors.New("unexpected payload")
+}
+
+func (f *fakeLANBMC) openSession(req []byte) ([]byte, error) {
+	resp := []byte{req[0], 0, req[1], 0}
+	resp = append(resp, req[4:8]...)
+	var st suite
+	var ok bool
+	for _, s := range suites {
+		if s.auth == req[12] && s.integrity == req[20] && s.confidentiality == req[28] {
+			st, ok = s, true
+		}
+	}
+	if !ok {
+		resp[1] = byte(RAKPNoCipherSuiteMatch)
+		return encodePacket(payloadOpenSessionResponse, 0, 0, resp, nil)
+	}
+	s := &fakeSession{
+		suite: st,
+		sidm:  binary.LittleEndian.Uint32(req[4:]),
+		sidc:  uint32(0x1000 + len(f.sessions)),
+	}
+	f.sessions[s.sidc] = s
+	resp = appendUint32(resp, s.sidc)
+	resp = append(resp, req[8:32]...)
+	return encodePacket(payloadOpenSessionResponse, 0, 0, resp, nil)
+}
+
+func (f *fakeLANBMC) rakp2(s *fakeSession, req []byte) ([]byte, error) {
+	s.rm = append([]byte(nil), req[8:24]...)
+	s.role = req[24]
+	s.name = append([]byte(nil), req[28:28+int(req[27])]...)
+	s.rc = bytes.Repeat([]byte{0x17}, 16)
+	resp := []byte{req[0], 0, 0, 0}
+	resp = appendUint32(resp, s.sidm)
+	if string(s.name) != f.username {
+		resp[1] = byte(RAKPUnauthorizedName)
+		return encodePacket(payloadRAKP2, 0, 0, resp, nil)
+	}
+	resp = append(resp, s.rc...)
+	resp = append(resp, fakeGUID...)
+	resp = append(resp, s.hmac(userKey(f.password), le32(s.sidm), le32(s.sidc), s.rm, s.rc, fakeGUID, []byte{s.role, byte(len(s.name))}, s.name)...)
+	return encodePacket(payloadRAKP2, 0, 0, resp, nil)
+}
+
+func (f *fakeLANBMC) rakp4(s *fakeSession, req []byte) ([]byte, error) {
+	kuid := userKey(f.password)
+	resp := []byte{req[0], 0, 0, 0}
+	resp = appendUint32(resp, s.sidm)
+	if want := s.hmac(kuid, s.rc, le32(s.sidm), []byte{s.role, byte(len(s.name))}, s.name); !hmac.Equal(req[8:], want) {
+		resp[1] = byte(RAKPInvalidIntegrityCheck)
+		return encodePacket(payloadRAKP4, 0, 0, resp, nil)
+	}
+	sik := s.hmac(kuid, s.rm, s.rc, []byte{s.role, byte(len(s.name))}, s.name)
+	s.keys = sessionKeys(s.suite, sik)
+	resp = append(resp, s.hmac(sik, s.rm, le32(s.sidc), fakeGUID)[:s.icvLen]...)
+	return encodePacket(payloadRAKP4, 0, 0, resp, nil)
+}
+
+func (f *fakeLANBMC) ipmi(s *fakeSession, msg []byte) ([]byte, error) {
+	if ipmbChecksum(msg[:3]) != 0 || ipmbChecksum(msg[3:]) != 0 {
+		return nil, errors.New("bad checksum")
+	}
+	netfn, rqSeq, cmd, data := NetFn(msg[1]>>2), msg[4]>>2, Command(msg[5]), msg[6:len(msg)-1]
+
+	var resp []byte
+	switch {
+	case netfn == _IPMI_NETFN_APP && cmd == _SET_SESSION_PRIVILEGE_LEVEL:
+		s.priv = data[0]
+		resp = []byte{0, data[0]}
+	case netfn == _IPMI_NETFN_APP && cmd == _CLOSE_SESSION:
+		f.closed++
+		resp = []byte{0}
+	default:
+		var err error
+		if resp, err = f.bmc.SendRecv(netfn, cmd, data); err != nil {
+			return nil, err
+		}
+	}
+
+	out := []byte{_REMOTE_SOFTWARE_ID, byte(netfn|1) << 2}
+	out = append(out, ipmbChecksum(out))
+	out = append(out, _BMC_SLAVE_ADDR, rqSeq<<2, byte(cmd))
+	out = append(out, resp...)
+	out = append(out, ipmbChecksum(out[3:]))
+	return encodePacket(payloadIPMI, s.sidm, 1, out, s.keys)
+}
+
+func TestLAN(t *testing.T) {
+	for _, cs := range []CipherSuite{CipherSuite3, CipherSuite17} {
+		f := newFakeLANBMC(t, "admin", "secret", &fakeBMC{sel: testSEL()})
+		l, err := DialLAN(f.addr(), &LANConfig{
+			Username:    "admin",
+			Password:    "secret",
+			CipherSuite: cs,
+			Privilege:   PrivilegeOperator,
+		})
+		if err != nil {
+			t.Fatalf("DialLAN(suite %d) = %v", cs, err)
+		}
+		i := New(l)
+
+		entries, err := i.SELEntries()
+		if err != nil {
+			t.Errorf("SELEntries(suite %d) = %v", cs, err)
+		}
+		if len(entries) != len(testSEL()) {
+			t.Errorf("SELEntries(suite %d) returned %d entries, want %d", cs, len(entries), len(testSEL()))
+		}
+		if _, err := i.GetDeviceID(); !errors.Is(err, CCInvalidCommand) {
+			t.Errorf("GetDeviceID(suite %d) = %v, want %v", cs, err, CCInvalidCommand)
+		}
+
+		if err := i.Close(); err != nil {
+			t.Errorf("Close(suite %d) = %v", cs, err)
+		}
+		f.mu.Lock()
+		if f.closed != 1 {
+			t.Errorf("suite %d: BMC saw %d Close Session requests, want 1", cs, f.closed)
+		}
+		if s := f.sessions[l.sidc]; s == nil || s.priv != byte(PrivilegeOperator) {
+			t.Errorf("suite %d: session privilege not set to operator", cs)
+		}
+		f.mu.Unlock()
+	}
+}
+
+func TestLANAuth(t *testing.T) {
+	f := newFakeLANBMC(t, "admin", "secret", &fakeBMC{})
+	for _, tt := range []struct {
+		name string
+		c    LANConfig
+		want error
+	}{
+		{"wrong password", LANConfig{Username: "admin", Password: "guess"}, ErrAuth},
+		{"wrong user", LANConfig{Username: "root", Password: "secret"}, RAKPUnauthorizedName},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DialLAN(f.addr(), &tt.c); !errors.Is(err, tt.want) {
+				t.Errorf("DialLAN() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, err := DialLAN(f.addr(), &LANConfig{CipherSuite: 1}); err == nil || !strings.Contains(err.Error(), "unsupported cipher suite") {
+		t.Errorf("DialLAN(suite 1) = %v, want unsupported cipher suite", err)
+	}
+}
+
+func TestLANRetries(t *testing.T) {
+	f := newFakeLANBMC(t, "admin", "secret", &fakeBMC{sel: testSEL()})
+	// Lose the first try of every other exchange.
+	f.drop = func(n int) bool { return n%3 == 1 }
+	l, err := DialLAN(f.addr(), &LANConfig{
+		Username: "admin",
+		Password: "secret",
+		Timeout:  50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := New(l).SELEntries(); err != nil {
+		t.Errorf("SELEntries() = %v", err)
+	}
+
+	// Lose everything.
+	f.mu.Lock()
+	f.drop = func(int) bool { return true }
+	f.received = 0
+	f.mu.Unlock()
+	if _, err := New(l).SELEntries(); err == nil || !strings.Contains(err.Error(), "after 4 tries") {
+		t.Errorf("SELEntries() = %v, want no response after 4 tries", err)
+	}
+	f.mu.Lock()
+	if f.received != 4 {
+		t.Errorf("BMC received %d packets, want 4", f.received)
+	}
+	f.mu.Unlock()
+}
+
+func TestLANPacket(t *testing.T) {
+	k := sessionKeys(suites[CipherSuite17], bytes.Repeat([]byte{1}, 32))
+	for n := 0; n < 40; n++ {
+		data := bytes.Repeat([]byte{0xaa}, n)
+		pkt, err := encodePacket(payloadIPMI, 7, 9, data, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := decodePacket(pkt, k)
+		if err != nil {
+			t.Fatalf("decodePacket(%d bytes) = %v", n, err)
+		}
+		if p.typ != payloadIPMI || p.sid != 7 || p.seq != 9 || !bytes.Equal(p.data, data) {
+			t.Errorf("decodePacket(%d bytes) = %+v", n, p)
+		}
+
+		pkt[len(pkt)-1] ^= 1
+		if _, err := decodePacket(pkt, k); err == nil {
+			t.Errorf("decodePacket(%d bytes, corrupted) succeeded", n)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	sdrHeaderLen = 5
+
+	// sdrReadLen is the number of bytes asked for in each Get SDR request.
+	// Many BMCs can't return a whole record in one response, and some can't
+	// even return this much; then it is halved.
+	sdrReadLen = 16
+
+	// sdrRetries is how often a read is restarted after another requester
+	// cancelled our reservation.
+	sdrRetries = 3
+
+	// sdrLastRecord is the next record ID returned with the last record.
+	sdrLastRecord = 0xffff
+)
+
+// SDRType is the record type of a Sensor Data Record.
+type SDRType uint8
+
+// SDRType values are defined in IPMI v2.0 Table 43-1.
+const (
+	SDRTypeFullSensor                      SDRType = 0x01
+	SDRTypeCompactSensor                   SDRType = 0x02
+	SDRTypeEventOnly                       SDRType = 0x03
+	SDRTypeEntityAssociation               SDRType = 0x08
+	SDRTypeDeviceRelativeEntityAssociation SDRType = 0x09
+	SDRTypeGenericDeviceLocator            SDRType = 0x10
+	SDRTypeFRUDeviceLocator                SDRType = 0x11
+	SDRTypeMCDeviceLocator                 SDRType = 0x12
+	SDRTypeMCConfirmation                  SDRType = 0x13
+	SDRTypeBMCMessageChannelInfo           SDRType = 0x14
+	SDRTypeOEM                             SDRType = 0xC0
+)
+
+// SDR is a record read from the Sensor Data Record repository.
+type SDR struct {
+	RecordID uint16
+	Version  uint8
+	Type     SDRType
+
+	// Data is the record body that follows the 5 byte header.
+	Data []byte
+}
+
+// ReserveSDRRepository reserves the SDR repository, which is needed to read
+// records in several parts.
+func (i *IPMI) ReserveSDRRepository() (uint16, error) {
+	data, err := i.SendRecv(_IPMI_NETFN_STORAGE, BMC_RESERVE_SDR_REPO, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkLen(data, 3); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(data[1:]), nil
+}
+
+// getSDRData reads n bytes at offset off of the record with the given ID. It
+// returns the ID of the next record and the data.
+func (i *IPMI) getSDRData(res, id uint16, off, n uint8) (uint16, []byte, error) {
+	var req [6]byte
+	binary.LittleEndian.PutUint16(req[0:], res)
+	binary.LittleEndian.PutUint16(req[2:], id)
+	req[4] = off
+	req[5] = n
+
+	data, err := i.SendRecv(_IPMI_NETFN_STORAGE, BMC_GET_SDR, req[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := checkLen(data, 3); err != nil {
+		return 0, nil, err
+	}
+	return binary.LittleEndian.Uint16(data[1:]), data[3:], nil
+}
+
+// readSDR reads the record with the given ID in parts. If the reservation is
+// cancelled, it makes a new one in res and starts over.
+func (i *IPMI) readSDR(res *uint16, id uint16) (*SDR, uint16, error) {
+	var (
+		rec     []byte
+		next    uint16
+		want    = sdrHeaderLen
+		chunk   = sdrReadLen
+		retries int
+	)
+	for len(rec) < want {
+		if len(rec) > 0xff {
+			return nil, 0, fmt.Errorf("reading SDR 0x%04x: offset %d out of range", id, len(rec))
+		}
+		n := want - len(rec)
+		if n > chunk {
+			n = chunk
+		}
+		nxt, data, err := i.getSDRData(*res, id, uint8(len(rec)), uint8(n))
+		if errors.Is(err, CCReservationCanceled) && retries < sdrRetries {
+			retries++
+			if *res, err = i.ReserveSDRRepository(); err != nil {
+				return nil, 0, err
+			}
+			rec, want = nil, sdrHeaderLen
+			continue
+		}
+		if errors.Is(err, CCCannotReturnRequestedBytes) && chunk > 1 {
+			chunk /= 2
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading SDR 0x%04x: %v", id, err)
+		}
+		if len(data) == 0 {
+			return nil, 0, fmt.Errorf("reading SDR 0x%04x: no data at offset %d", id, len(rec))
+		}
+		next = nxt
+		rec = append(rec, data...)
+		if want == sdrHeaderLen && len(rec) >= sdrHeaderLen {
+			want += int(rec[4])
+		}
+	}
+	return &SDR{
+		RecordID: binary.LittleEndian.Uint16(rec[0:]),
+		Version:  rec[2],
+		Type:     SDRType(rec[3]),
+		Data:     rec[sdrHeaderLen:want],
+	}, next, nil
+}
+
+// GetSDR reads the record with the given ID from the SDR repository. Record
+// 0 is the first one. It also returns the ID of the next record, which is
+// 0xffff after the last one.
+func (i *IPMI) GetSDR(id uint16) (*SDR, uint16, error) {
+	res, err := i.ReserveSDRRepository()
+	if err != nil {
+		return nil, 0, err
+	}
+	return i.readSDR(&res, id)
+}
+
+// SDRs reads all records of the SDR repository.
+func (i *IPMI) SDRs() ([]*SDR, error) {
+	res, err := i.ReserveSDRRepository()
+	if err != nil {
+		return nil, err
+	}
+
+	var sdrs []*SDR
+	seen := make(map[uint16]bool)
+	for id := uint16(0); id != sdrLastRecord; {
+		if seen[id] {
+			return sdrs, fmt.Errorf("SDR 0x%04x is listed twice", id)
+		}
+		seen[id] = true
+
+		sdr, next, err := i.readSDR(&res, id)
+		if err != nil {
+			return sdrs, err
+		}
+		sdrs = append(sdrs, sdr)
+		id = next
+	}
+	return sdrs, nil
+}
+
+// AnalogDataFormat is how a sensor encodes its raw readings.
+type AnalogDataFormat uint8
+
+// AnalogDataFormat values are defined in IPMI v2.0 Table 43-1, Sensor Units 1.
+const (
+	AnalogDataFormatUnsigned       AnalogDataFormat = 0
+	AnalogDataFormatOnesComplement AnalogDataFormat = 1
+	AnalogDataFormatTwosComplement AnalogDataFormat = 2
+	AnalogDataFormatNone           AnalogDataFormat = 3
+)
+
+// Linearization is the function applied to a reading after the linear
+// conversion.
+type Linearization uint8
+
+// Linearization values are defined in IPMI v2.0 Table 43-1.
+const (
+	LinearizationLinear Linearization = 0x00
+	LinearizationLn     Linearization = 0x01
+	LinearizationLog10  Linearization = 0x02
+	LinearizationLog2   Linearization = 0x03
+	LinearizationE      Linearization = 0x04
+	LinearizationExp10  Linearization = 0x05
+	LinearizationExp2   Linearization = 0x06
+	LinearizationInv    Linearization = 0x07
+	LinearizationSqr    Linearization = 0x08
+	LinearizationCube   Linearization = 0x09
+	LinearizationSqrt   Linearization = 0x0A
+	LinearizationCbrt   Linearization = 0x0B
+)
+
+func (l Linearization) apply(y float64) (float64, error) {
+	switch l {
+	case LinearizationLinear:
+		return y, nil
+	case LinearizationLn:
+		return math.Log(y), nil
+	case LinearizationLog10:
+		return math.Log10(y), nil
+	case LinearizationLog2:
+		return math.Log2(y), nil
+	case LinearizationE:
+		return math.Exp(y), nil
+	case LinearizationExp10:
+		return math.Pow(10, y), nil
+	case LinearizationExp2:
+		return math.Exp2(y), nil
+	case LinearizationInv:
+		return 1 / y, nil
+	case LinearizationSqr:
+		return y * y, nil
+	case LinearizationCube:
+		return y * y * y, nil
+	case LinearizationSqrt:
+		return math.Sqrt(y), nil
+	case LinearizationCbrt:
+		return math.Cbrt(y), nil
+	}
+	return 0, fmt.Errorf("unsupported linearization 0x%02x", uint8(l))
+}
+
+// SensorRecord holds the fields of a full or compact sensor record that are
+// needed to read the sensor and make sense of its readings.
+type SensorRecord struct {
+	RecordID         uint16
+	Type             SDRType
+	OwnerID          uint8
+	OwnerLUN         uint8
+	Number           uint8
+	EntityID         uint8
+	EntityInstance   uint8
+	SensorType       SensorType
+	EventReadingType uint8
+
+	AnalogDataFormat AnalogDataFormat
+	RateUnit         uint8
+	ModifierUnitUse  uint8
+	Percentage       bool
+	BaseUnit         SensorUnit
+	ModifierUnit     SensorUnit
+
+	// Conversion factors, only set in full records.
+	Linearization Linearization
+	M             int16
+	B             int16
+	BExp          int8
+	RExp          int8
+
+	Name string
+}
+
+// signExtend interprets the low bits of v as a two's complement number.
+func signExtend(v int16, bits uint) int16 {
+	shift := 16 - bits
+	return v << shift >> shift
+}
+
+// SensorRecord parses a full or compact sensor record.
+func (s *SDR) SensorRecord() (*SensorRecord, error) {
+	var idOff int
+	switch s.Type {
+	case SDRTypeFullSensor:
+		idOff = 42
+	case SDRTypeCompactSensor:
+		idOff = 26
+	default:
+		return nil, fmt.Errorf("SDR 0x%04x is not a sensor record: type 0x%02x", s.RecordID, uint8(s.Type))
+	}
+	d := s.Data
+	if len(d) <= idOff {
+		return nil, fmt.Errorf("SDR 0x%04x is too short: %d bytes", s.RecordID, len(d))
+	}
+
+	r := &SensorRecord{
+		RecordID:         s.RecordID,
+		Type:             s.Type,
+		OwnerID:          d[0],
+		OwnerLUN:         d[1] & 0x3,
+		Number:           d[2],
+		EntityID:         d[3],
+		EntityInstance:   d[4],
+		SensorType:       SensorType(d[7]),
+		EventReadingType: d[8],
+		AnalogDataFormat: AnalogDataFormat(d[15] >> 6),
+		RateUnit:         (d[15] >> 3) & 0x7,
+		ModifierUnitUse:  (d[15] >> 1) & 0x3,
+		Percentage:       d[15]&0x1 != 0,
+		BaseUnit:         SensorUnit(d[16]),
+		ModifierUnit:     SensorUnit(d[17]),
+	}
+	if s.Type == SDRTypeFullSensor {
+		r.Linearization = Linearization(d[18] & 0x7f)
+		r.M = signExtend(int16(d[19])|int16(d[20]&0xc0)<<2, 10)
+		r.B = signExtend(int16(d[21])|int16(d[22]&0xc0)<<2, 10)
+		r.BExp = int8(signExtend(int16(d[24]&0xf), 4))
+		r.RExp = int8(signExtend(int16(d[24]>>4), 4))
+	}
+
+	tl := d[idOff]
+	n := int(tl & 0x1f)
+	if idOff+1+n > len(d) {
+		n = len(d) - idOff - 1
+	}
+	r.Name = decodeString(tl>>6, d[idOff+1:idOff+1+n])
+	return r, nil
+}
+
+// Convert converts a raw reading of the sensor to a value in its units, as
+// described in IPMI v2.0 36.3.
+func (r *SensorRecord) Convert(raw uint8) (float64, error) {
+	if r.Type != SDRTypeFullSensor {
+		return 0, errors.New("only full sensor records have conversion factors")
+	}
+	var x float64
+	switch r.AnalogDataFormat {
+	case AnalogDataFormatUnsigned:
+		x = float64(raw)
+	case AnalogDataFormatOnesComplement:
+		v := int(int8(raw))
+		if v < 0 {
+			v++
+		}
+		x = float64(v)
+	case AnalogDataFormatTwosComplement:
+		x = float64(int8(raw))
+	default:
+		return 0, errors.New("sensor has no analog readings")
+	}
+	y := (float64(r.M)*x + float64(r.B)*math.Pow10(int(r.BExp))) * math.Pow10(int(r.RExp))
+	return r.Linearization.apply(y)
+}
+
+// Unit returns the unit of the sensor's converted readings, e.g. "degrees C"
+// or "Watts/hour".
+func (r *SensorRecord) Unit() string {
+	u := r.BaseUnit.String()
+	switch r.ModifierUnitUse {
+	case 1:
+		u += "/" + r.ModifierUnit.String()
+	case 2:
+		u += "*" + r.ModifierUnit.String()
+	}
+	rates := []string{"", "/us", "/ms", "/s", "/minute", "/hour", "/day"}
+	if int(r.RateUnit) < len(rates) {
+		u += rates[r.RateUnit]
+	}
+	if r.Percentage {
+		if r.BaseUnit == 0 {
+			return "percent"
+		}
+		u = "% " + u
+	}
+	return u
+}
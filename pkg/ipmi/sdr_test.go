@@ -0,0 +1,245 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// fullRecord builds a full sensor record for a temperature sensor.
+func fullRecord(id uint16, number uint8, name string) []byte {
+	body := make([]byte, 43)
+	body[0] = 0x20 // BMC
+	body[2] = number
+	body[3] = 0x03 // processor
+	body[4] = 1
+	body[7] = byte(1)   // temperature
+	body[8] = 0x01      // threshold
+	body[15] = 0x2 << 6 // 2's complement
+	body[16] = 1        // degrees C
+	body[19] = 0xf4     // M = -12, 10 bits
+	body[20] = 0xc0
+	body[21] = 0x05 // B = 5
+	body[24] = 0xe1 // RExp = -2, BExp = 1
+	body[42] = 0xc0 | byte(len(name))
+	body = append(body, name...)
+	return append([]byte{byte(id), byte(id >> 8), 0x51, byte(SDRTypeFullSensor), byte(len(body))}, body...)
+}
+
+// compactRecord builds a compact sensor record for a discrete sensor.
+func compactRecord(id uint16, number uint8, name []byte) []byte {
+	body := make([]byte, 27)
+	body[0] = 0x20
+	body[1] = 0x01
+	body[2] = number
+	body[7] = 0x08 // power supply
+	body[8] = 0x6f // sensor-specific
+	body[15] = 0x3<<6 | 0x1
+	body[26] = 0x80 | byte(len(name)) // 6-bit packed ASCII
+	body = append(body, name...)
+	return append([]byte{byte(id), byte(id >> 8), 0x51, byte(SDRTypeCompactSensor), byte(len(body))}, body...)
+}
+
+func testSDRs() [][]byte {
+	return [][]byte{
+		fullRecord(0, 0x30, "CPU0 Temp"),
+		// "PSU1" in 6-bit packed ASCII.
+		compactRecord(1, 0x40, []byte{0xf0, 0x5c, 0x47}),
+		{2, 0, 0x51, byte(SDRTypeMCDeviceLocator), 3, 0x20, 0, 0},
+	}
+}
+
+func TestSDRs(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		bmc  *fakeBMC
+	}{
+		{name: "whole", bmc: &fakeBMC{sdrs: testSDRs()}},
+		{name: "small reads", bmc: &fakeBMC{sdrs: testSDRs(), maxRead: 3}},
+		{name: "cancelled reservation", bmc: &fakeBMC{sdrs: testSDRs(), cancel: 2}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			i := New(tt.bmc)
+			sdrs, err := i.SDRs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sdrs) != 3 {
+				t.Fatalf("SDRs() returned %d records, want 3", len(sdrs))
+			}
+			for n, sdr := range sdrs {
+				want := testSDRs()[n]
+				if sdr.RecordID != uint16(n) || sdr.Version != 0x51 || sdr.Type != SDRType(want[3]) ||
+					!reflect.DeepEqual(sdr.Data, want[5:]) {
+					t.Errorf("record %d = %+v, want %x", n, sdr, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetSDR(t *testing.T) {
+	i := New(&fakeBMC{sdrs: testSDRs()})
+
+	sdr, next, err := i.GetSDR(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sdr.Type != SDRTypeMCDeviceLocator || next != 0xffff {
+		t.Errorf("GetSDR(2) = %+v, 0x%04x, want MC device locator, 0xffff", sdr, next)
+	}
+	if _, _, err := i.GetSDR(3); err == nil {
+		t.Errorf("GetSDR(3) succeeded, want error")
+	}
+}
+
+func TestSensorRecord(t *testing.T) {
+	i := New(&fakeBMC{sdrs: testSDRs()})
+	sdrs, err := i.SDRs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := sdrs[0].SensorRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SensorRecord{
+		RecordID:         0,
+		Type:             SDRTypeFullSensor,
+		OwnerID:          0x20,
+		Number:           0x30,
+		EntityID:         3,
+		EntityInstance:   1,
+		SensorType:       1,
+		EventReadingType: 1,
+		AnalogDataFormat: AnalogDataFormatTwosComplement,
+		BaseUnit:         1,
+		M:                -12,
+		B:                5,
+		BExp:             1,
+		RExp:             -2,
+		Name:             "CPU0 Temp",
+	}
+	if !reflect.DeepEqual(full, want) {
+		t.Errorf("SensorRecord() = %+v, want %+v", full, want)
+	}
+	if got := full.Unit(); got != "degrees C" {
+		t.Errorf("Unit() = %q, want %q", got, "degrees C")
+	}
+
+	compact, err := sdrs[1].SensorRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compact.Name != "PSU1" || compact.OwnerLUN != 1 || compact.SensorType != 8 ||
+		compact.AnalogDataFormat != AnalogDataFormatNone || !compact.Percentage {
+		t.Errorf("SensorRecord() = %+v", compact)
+	}
+	if _, err := compact.Convert(1); err == nil {
+		t.Errorf("Convert() on a compact record succeeded, want error")
+	}
+
+	if _, err := sdrs[2].SensorRecord(); err == nil {
+		t.Errorf("SensorRecord() on an MC locator succeeded, want error")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		r    SensorRecord
+		raw  uint8
+		want float64
+	}{
+		{
+			name: "unsigned",
+			r:    SensorRecord{M: 2, B: 1, BExp: 1},
+			raw:  20,
+			want: 50,
+		},
+		{
+			name: "two's complement",
+			r:    SensorRecord{AnalogDataFormat: AnalogDataFormatTwosComplement, M: -12, B: 5, BExp: 1, RExp: -2},
+			raw:  0xfe, // -2
+			want: 0.74,
+		},
+		{
+			name: "one's complement",
+			r:    SensorRecord{AnalogDataFormat: AnalogDataFormatOnesComplement, M: 1},
+			raw:  0xfd, // -2
+			want: -2,
+		},
+		{
+			name: "inverse",
+			r:    SensorRecord{M: 1, Linearization: LinearizationInv},
+			raw:  4,
+			want: 0.25,
+		},
+		{
+			name: "square",
+			r:    SensorRecord{M: 3, Linearization: LinearizationSqr},
+			raw:  2,
+			want: 36,
+		},
+		{
+			name: "exp10",
+			r:    SensorRecord{M: 1, Linearization: LinearizationExp10},
+			raw:  3,
+			want: 1000,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.Type = SDRTypeFullSensor
+			got, err := tt.r.Convert(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Convert(0x%02x) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+
+	r := SensorRecord{Type: SDRTypeFullSensor, M: 1, Linearization: 0x70}
+	if _, err := r.Convert(1); err == nil {
+		t.Errorf("Convert() with non-linear sensor succeeded, want error")
+	}
+}
+
+func TestGetSensorReading(t *testing.T) {
+	i := New(&fakeBMC{
+		sdrs: testSDRs(),
+		readings: map[uint8][]byte{
+			0x30: {0xfe, 0xc0, 0x10},
+			0x40: {0x00, 0xe0, 0x02, 0x80},
+		},
+	})
+	sdrs, err := i.SDRs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, _ := sdrs[0].SensorRecord()
+	got, err := i.GetSensorReading(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Converted || math.Abs(got.Value-0.74) > 1e-9 || got.State != AboveUpperCritical ||
+		got.Unavailable || got.ScanningDisabled || got.EventMessagesDisabled {
+		t.Errorf("GetSensorReading(%q) = %+v", full.Name, got)
+	}
+
+	compact, _ := sdrs[1].SensorRecord()
+	got, err = i.GetSensorReading(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&SensorReading{Unavailable: true, State: 0x0002}); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSensorReading(%q) = %+v, want %+v", compact.Name, got, want)
+	}
+}
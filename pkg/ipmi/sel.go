@@ -0,0 +1,261 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	selRecordLen = 16
+
+	// selLastRecord is the next record ID returned with the last record.
+	selLastRecord = 0xffff
+
+	// selClearPoll is the interval at which ClearSEL checks whether the
+	// erasure has completed.
+	selClearPoll = 100 * time.Millisecond
+
+	// Timestamps at or below selPreInit count from BMC initialization
+	// rather than the epoch.
+	selPreInit = 0x20000000
+)
+
+// unmarshall is the inverse of marshall: it decodes a 16 byte SEL record into
+// the member of e that its record type selects.
+func (e *Event) unmarshall(data []byte) error {
+	if len(data) < selRecordLen {
+		return fmt.Errorf("SEL record too short: %d bytes", len(data))
+	}
+
+	buf := make([]byte, 42)
+	copy(buf[0:3], data[0:3])
+	switch t := data[2]; {
+	case t >= 0xE0:
+		copy(buf[29:42], data[3:16])
+	case t >= 0xC0:
+		copy(buf[16:29], data[3:16])
+	default:
+		copy(buf[3:16], data[3:16])
+	}
+	return binary.Read(bytes.NewReader(buf), binary.LittleEndian, e)
+}
+
+// ReserveSEL reserves the SEL, which is needed to clear it.
+func (i *IPMI) ReserveSEL() (uint16, error) {
+	data, err := i.SendRecv(_IPMI_NETFN_STORAGE, BMC_RESERVE_SEL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkLen(data, 3); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(data[1:]), nil
+}
+
+// GetSELEntry reads the SEL record with the given ID. Record 0 is the first
+// one. It also returns the ID of the next record, which is 0xffff after the
+// last one.
+func (i *IPMI) GetSELEntry(id uint16) (*Event, uint16, error) {
+	var req [6]byte
+	binary.LittleEndian.PutUint16(req[2:], id)
+	req[5] = 0xff // whole record
+
+	data, err := i.SendRecv(_IPMI_NETFN_STORAGE, BMC_GET_SEL_ENTRY, req[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkLen(data, 3+selRecordLen); err != nil {
+		return nil, 0, err
+	}
+
+	var e Event
+	if err := e.unmarshall(data[3:]); err != nil {
+		return nil, 0, err
+	}
+	return &e, binary.LittleEndian.Uint16(data[1:]), nil
+}
+
+// SELEntries reads all SEL records.
+func (i *IPMI) SELEntries() ([]*Event, error) {
+	var events []*Event
+	seen := make(map[uint16]bool)
+	for id := uint16(0); id != selLastRecord; {
+		if seen[id] {
+			return events, fmt.Errorf("SEL record 0x%04x is listed twice", id)
+		}
+		seen[id] = true
+
+		e, next, err := i.GetSELEntry(id)
+		// An empty SEL has no first record.
+		if id == 0 && errors.Is(err, CCNotPresent) {
+			return nil, nil
+		}
+		if err != nil {
+			return events, fmt.Errorf("reading SEL record 0x%04x: %v", id, err)
+		}
+		events = append(events, e)
+		id = next
+	}
+	return events, nil
+}
+
+// ClearSEL erases all SEL records and waits until the erasure is done.
+func (i *IPMI) ClearSEL() error {
+	res, err := i.ReserveSEL()
+	if err != nil {
+		return err
+	}
+
+	req := []byte{0, 0, 'C', 'L', 'R', 0xaa}
+	binary.LittleEndian.PutUint16(req, res)
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := i.SendRecv(_IPMI_NETFN_STORAGE, BMC_CLEAR_SEL, req)
+		if err != nil {
+			return err
+		}
+		if err := checkLen(data, 2); err != nil {
+			return err
+		}
+		if data[1]&0xf == 1 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the SEL to be erased")
+		}
+		time.Sleep(selClearPoll)
+
+		// Ask for the erasure status from now on.
+		req[5] = 0
+	}
+}
+
+// Time returns the time the event was logged. It is the zero Time for records
+// without a timestamp, and for events logged before the BMC clock was set.
+func (e *Event) Time() time.Time {
+	var ts uint32
+	switch {
+	case e.RecordType >= 0xE0:
+		return time.Time{}
+	case e.RecordType >= 0xC0:
+		ts = e.OEMTsEvent.Timestamp
+	default:
+		ts = e.StandardEvent.Timestamp
+	}
+	if ts <= selPreInit || ts == 0xffffffff {
+		return time.Time{}
+	}
+	return time.Unix(int64(ts), 0).UTC()
+}
+
+// Description describes what a standard event reports, e.g. "Upper Critical
+// going high".
+func (e *Event) Description() string {
+	typ := e.EventTypeDir & 0x7f
+	offset := e.EventData[0] & 0x0f
+	if names, ok := eventOffsetNames[typ]; ok && int(offset) < len(names) {
+		return names[offset]
+	}
+	switch {
+	case typ == 0x6f:
+		return fmt.Sprintf("Sensor-specific offset 0x%02x", offset)
+	case typ >= 0x70 && typ <= 0x7f:
+		return fmt.Sprintf("OEM event type 0x%02x offset 0x%02x", typ, offset)
+	}
+	return fmt.Sprintf("Event type 0x%02x offset 0x%02x", typ, offset)
+}
+
+// Asserted reports whether the event is an assertion rather than a
+// deassertion.
+func (e *Event) Asserted() bool {
+	return e.EventTypeDir&0x80 == 0
+}
+
+// String formats the event the way ipmitool's sel list does.
+func (e *Event) String() string {
+	ts := "Pre-Init   |         "
+	if t := e.Time(); !t.IsZero() {
+		ts = t.Format("01/02/2006 | 15:04:05")
+	}
+
+	switch {
+	case e.RecordType >= 0xE0:
+		return fmt.Sprintf("%4x | OEM record %02x | % x", e.RecordID, e.RecordType, e.OEMNontsDefinedData)
+	case e.RecordType >= 0xC0:
+		return fmt.Sprintf("%4x | %s | OEM record %02x | % x | % x", e.RecordID, ts, e.RecordType,
+			e.ManfID, e.OEMTsDefinedData)
+	}
+
+	dir := "Asserted"
+	if !e.Asserted() {
+		dir = "Deasserted"
+	}
+	return fmt.Sprintf("%4x | %s | %s #0x%02x | %s | %s", e.RecordID, ts, SensorType(e.SensorType),
+		e.SensorNum, e.Description(), dir)
+}
+
+// eventOffsetNames names the offsets of the threshold and generic event/reading
+// types, defined in IPMI v2.0 Table 42-2.
+var eventOffsetNames = map[uint8][]string{
+	0x01: {
+		"Lower Non-critical going low",
+		"Lower Non-critical going high",
+		"Lower Critical going low",
+		"Lower Critical going high",
+		"Lower Non-recoverable going low",
+		"Lower Non-recoverable going high",
+		"Upper Non-critical going low",
+		"Upper Non-critical going high",
+		"Upper Critical going low",
+		"Upper Critical going high",
+		"Upper Non-recoverable going low",
+		"Upper Non-recoverable going high",
+	},
+	0x02: {"Transition to Idle", "Transition to Active", "Transition to Busy"},
+	0x03: {"State Deasserted", "State Asserted"},
+	0x04: {"Predictive Failure Deasserted", "Predictive Failure Asserted"},
+	0x05: {"Limit Not Exceeded", "Limit Exceeded"},
+	0x06: {"Performance Met", "Performance Lags"},
+	0x07: {
+		"Transition to OK",
+		"Transition to Non-critical from OK",
+		"Transition to Critical from less severe",
+		"Transition to Non-recoverable from less severe",
+		"Transition to Non-critical from more severe",
+		"Transition to Critical from Non-recoverable",
+		"Transition to Non-recoverable",
+		"Monitor",
+		"Informational",
+	},
+	0x08: {"Device Absent", "Device Present"},
+	0x09: {"Device Disabled", "Device Enabled"},
+	0x0A: {
+		"Transition to Running",
+		"Transition to In Test",
+		"Transition to Power Off",
+		"Transition to On Line",
+		"Transition to Off Line",
+		"Transition to Off Duty",
+		"Transition to Degraded",
+		"Transition to Power Save",
+		"Install Error",
+	},
+	0x0B: {
+		"Fully Redundant",
+		"Redundancy Lost",
+		"Redundancy Degraded",
+		"Non-redundant: Sufficient from Redundant",
+		"Non-redundant: Sufficient from Insufficient",
+		"Non-redundant: Insufficient Resources",
+		"Redundancy Degraded from Fully Redundant",
+		"Redundancy Degraded from Non-redundant",
+	},
+	0x0C: {"D0 Power State", "D1 Power State", "D2 Power State", "D3 Power State"},
+}
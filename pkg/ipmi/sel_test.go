@@ -0,0 +1,80 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testSEL() [][]byte {
+	return [][]byte{
+		// Upper critical temperature, 2020-01-01 00:00:00 UTC.
+		{0x01, 0x00, 0x02, 0x00, 0xe1, 0x0b, 0x5e, 0x20, 0x00, 0x04, 0x01, 0x30, 0x01, 0x09, 0xff, 0xff},
+		// Power supply redundancy regained, before the clock was set.
+		{0x02, 0x00, 0x02, 0x00, 0x01, 0x00, 0x00, 0x20, 0x00, 0x04, 0x08, 0x40, 0x8b, 0x01, 0xff, 0xff},
+		// OEM timestamped.
+		{0x03, 0x00, 0xc1, 0x00, 0xe1, 0x0b, 0x5e, 0x57, 0x01, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06},
+		// OEM non-timestamped.
+		{0x04, 0x00, 0xe0, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d},
+	}
+}
+
+func TestSELEntries(t *testing.T) {
+	i := New(&fakeBMC{sel: testSEL()})
+
+	events, err := i.SELEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("SELEntries() returned %d events, want 4", len(events))
+	}
+
+	want := []string{
+		"   1 | 01/01/2020 | 00:00:00 | Temperature #0x30 | Upper Critical going high | Asserted",
+		"   2 | Pre-Init   |          | Power Supply #0x40 | Redundancy Lost | Deasserted",
+		"   3 | 01/01/2020 | 00:00:00 | OEM record c1 | 57 01 00 | 01 02 03 04 05 06",
+		"   4 | OEM record e0 | 01 02 03 04 05 06 07 08 09 0a 0b 0c 0d",
+	}
+	for n, e := range events {
+		if got := e.String(); got != want[n] {
+			t.Errorf("event %d = %q, want %q", n, got, want[n])
+		}
+		// Reading a record and writing it back gives the same bytes.
+		data, err := e.marshall()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, testSEL()[n]) {
+			t.Errorf("marshall(event %d) = %x, want %x", n, data, testSEL()[n])
+		}
+	}
+
+	if got, want := events[0].Time(), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Time() = %v, want %v", got, want)
+	}
+	if !events[1].Time().IsZero() || !events[3].Time().IsZero() {
+		t.Errorf("Time() of events without a valid timestamp are not zero")
+	}
+}
+
+func TestClearSEL(t *testing.T) {
+	bmc := &fakeBMC{sel: testSEL()}
+	i := New(bmc)
+
+	if err := i.ClearSEL(); err != nil {
+		t.Fatal(err)
+	}
+	if !bmc.selCleared || bmc.clearPolls != 1 {
+		t.Errorf("ClearSEL() cleared %v after %d polls, want true after 1", bmc.selCleared, bmc.clearPolls)
+	}
+
+	events, err := i.SELEntries()
+	if err != nil || len(events) != 0 {
+		t.Errorf("SELEntries() after ClearSEL() = %v, %v, want no events", events, err)
+	}
+}
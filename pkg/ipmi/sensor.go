@@ -0,0 +1,165 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+)
+
+// SensorReading is a reading returned by the Get Sensor Reading command.
+type SensorReading struct {
+	Raw uint8
+
+	// Value is Raw converted to the sensor's units. It is only valid if
+	// Converted is true.
+	Value     float64
+	Converted bool
+
+	EventMessagesDisabled bool
+	ScanningDisabled      bool
+	Unavailable           bool
+
+	// State holds the threshold comparison status for threshold sensors,
+	// and the asserted states for discrete sensors.
+	State uint16
+}
+
+// Threshold comparison bits of SensorReading.State.
+const (
+	BelowLowerNonCritical    = 1 << 0
+	BelowLowerCritical       = 1 << 1
+	BelowLowerNonRecoverable = 1 << 2
+	AboveUpperNonCritical    = 1 << 3
+	AboveUpperCritical       = 1 << 4
+	AboveUpperNonRecoverable = 1 << 5
+)
+
+// GetSensorReading reads the sensor described by r. Readings of full records
+// with analog data are converted to the record's units.
+//
+// Only sensors owned by the BMC, on LUN 0, can be read.
+func (i *IPMI) GetSensorReading(r *SensorRecord) (*SensorReading, error) {
+	data, err := i.SendRecv(_IPMI_NETFN_SENSOR, BMC_GET_SENSOR_READING, []byte{r.Number})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLen(data, 3); err != nil {
+		return nil, err
+	}
+
+	s := &SensorReading{
+		Raw:                   data[1],
+		EventMessagesDisabled: data[2]&0x80 == 0,
+		ScanningDisabled:      data[2]&0x40 == 0,
+		Unavailable:           data[2]&0x20 != 0,
+	}
+	if len(data) > 3 {
+		s.State = uint16(data[3])
+	}
+	if len(data) > 4 {
+		s.State |= uint16(data[4]&0x7f) << 8
+	}
+
+	if r.Type == SDRTypeFullSensor && r.AnalogDataFormat != AnalogDataFormatNone && !s.Unavailable {
+		if s.Value, err = r.Convert(s.Raw); err != nil {
+			return nil, err
+		}
+		s.Converted = true
+	}
+	return s, nil
+}
+
+// SensorType is the kind of thing a sensor monitors.
+type SensorType uint8
+
+func (t SensorType) String() string {
+	// Sensor types are defined in IPMI v2.0 Table 42-3.
+	names := []string{
+		"Reserved",
+		"Temperature",
+		"Voltage",
+		"Current",
+		"Fan",
+		"Physical Security",
+		"Platform Security",
+		"Processor",
+		"Power Supply",
+		"Power Unit",
+		"Cooling Device",
+		"Other Units-based Sensor",
+		"Memory",
+		"Drive Slot (Bay)",
+		"POST Memory Resize",
+		"System Firmware Progress",
+		"Event Logging Disabled",
+		"Watchdog 1",
+		"System Event",
+		"Critical Interrupt",
+		"Button / Switch",
+		"Module / Board",
+		"Microcontroller / Coprocessor",
+		"Add-in Card",
+		"Chassis",
+		"Chip Set",
+		"Other FRU",
+		"Cable / Interconnect",
+		"Terminator",
+		"System Boot / Restart Initiated",
+		"Boot Error",
+		"Base OS Boot / Installation Status",
+		"OS Stop / Shutdown",
+		"Slot / Connector",
+		"System ACPI Power State",
+		"Watchdog 2",
+		"Platform Alert",
+		"Entity Presence",
+		"Monitor ASIC / IC",
+		"LAN",
+		"Management Subsystem Health",
+		"Battery",
+		"Session Audit",
+		"Version Change",
+		"FRU State",
+	}
+	if int(t) < len(names) {
+		return names[t]
+	}
+	if t >= 0xC0 {
+		return "OEM"
+	}
+	return fmt.Sprintf("Unknown (0x%02x)", uint8(t))
+}
+
+// SensorUnit is the unit of a sensor's readings.
+type SensorUnit uint8
+
+func (u SensorUnit) String() string {
+	// Units are defined in IPMI v2.0 Table 43-15.
+	names := []string{
+		"unspecified", "degrees C", "degrees F", "degrees K", "Volts",
+		"Amps", "Watts", "Joules", "Coulombs", "VA",
+		"Nits", "lumen", "lux", "Candela", "kPa",
+		"PSI", "Newton", "CFM", "RPM", "Hz",
+		"microsecond", "millisecond", "second", "minute", "hour",
+		"day", "week", "mil", "inches", "feet",
+		"cu in", "cu feet", "mm", "cm", "m",
+		"cu cm", "cu m", "liters", "fluid ounce", "radians",
+		"steradians", "revolutions", "cycles", "gravities", "ounce",
+		"pound", "ft-lb", "oz-in", "gauss", "gilberts",
+		"henry", "millihenry", "farad", "microfarad", "ohms",
+		"siemens", "mole", "becquerel", "PPM", "reserved",
+		"Decibels", "DbA", "DbC", "gray", "sievert",
+		"color temp deg K", "bit", "kilobit", "megabit", "gigabit",
+		"byte", "kilobyte", "megabyte", "gigabyte", "word",
+		"dword", "qword", "line", "hit", "miss",
+		"retry", "reset", "overflow", "underrun", "collision",
+		"packets", "messages", "characters", "error", "correctable error",
+		"uncorrectable error", "fatal error", "grams",
+	}
+	if int(u) < len(names) {
+		return names[u]
+	}
+	return fmt.Sprintf("unit 0x%02x", uint8(u))
+}
@@ -5,17 +5,63 @@
 package libinit
 
 import (
+	"context"
 	"fmt"
+	"os"
 
+	"github.com/u-root/u-root/pkg/netconfig"
 	"github.com/u-root/u-root/pkg/ulog"
 	"github.com/vishvananda/netlink"
 )
 
+// NetConfigFile is the network config that NetInit applies if it exists.
+const NetConfigFile = "/etc/netconfig.yaml"
+
 // NetInit is u-root network initialization.
 func linuxNetInit() {
 	if err := loopbackUp(); err != nil {
 		ulog.KernelLog.Printf("Failed to initialize loopback: %v", err)
 	}
+
+	type source struct {
+		name string
+		c    *netconfig.Config
+	}
+	var sources []source
+	if _, err := os.Stat(NetConfigFile); err == nil {
+		if c, err := netconfig.ReadFile(NetConfigFile); err != nil {
+			ulog.KernelLog.Printf("Failed to read %s: %v", NetConfigFile, err)
+		} else {
+			sources = append(sources, source{NetConfigFile, c})
+		}
+	}
+	if c, err := netconfig.Cmdline(); err != nil {
+		ulog.KernelLog.Printf("Failed to parse the kernel command line's network config: %v", err)
+	} else if c != nil {
+		sources = append(sources, source{"the kernel command line", c})
+	}
+
+	// Getting DHCP leases can take long, so init only waits for the static
+	// parts of the configs. Configs with DHCP are applied again, whole, in
+	// the background.
+	var dhcp []source
+	for _, s := range sources {
+		if err := netconfig.Apply(context.Background(), s.c.WithoutDHCP()); err != nil {
+			ulog.KernelLog.Printf("Failed to configure the network from %s: %v", s.name, err)
+		}
+		if s.c.HasDHCP() {
+			dhcp = append(dhcp, s)
+		}
+	}
+	if len(dhcp) > 0 {
+		go func() {
+			for _, s := range dhcp {
+				if err := netconfig.Apply(context.Background(), s.c); err != nil {
+					ulog.KernelLog.Printf("Failed to configure the network from %s: %v", s.name, err)
+				}
+			}
+		}()
+	}
 }
 
 func loopbackUp() error {
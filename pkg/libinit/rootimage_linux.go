@@ -0,0 +1,104 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libinit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/u-root/u-root/pkg/cmdline"
+	mnt "github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/loop"
+	"github.com/u-root/u-root/pkg/ulog"
+	"github.com/u-root/u-root/pkg/uroot/initramfs"
+	"golang.org/x/sys/unix"
+)
+
+// rootImages are the root file system images SwitchRootImage looks for if
+// uroot.rootimage is not set.
+var rootImages = []string{"/rootfs.squashfs", "/rootfs.erofs"}
+
+// newRootDir is where SwitchRootImage mounts the root file system image.
+const newRootDir = "/newroot"
+
+// rootImageType returns the file system type of the squashfs or erofs image
+// at path.
+func rootImageType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var magic [4]byte
+	if _, err := f.ReadAt(magic[:], 0); err == nil && binary.LittleEndian.Uint32(magic[:]) == initramfs.SquashfsMagic {
+		return "squashfs", nil
+	}
+	if _, err := f.ReadAt(magic[:], 1024); err == nil && binary.LittleEndian.Uint32(magic[:]) == initramfs.ErofsMagic {
+		return "erofs", nil
+	}
+	return "", fmt.Errorf("%s is neither a squashfs nor an erofs image", path)
+}
+
+// SwitchRootImage makes a squashfs or erofs image in the initramfs the root
+// file system, and execs its init.
+//
+// The image is the file named by uroot.rootimage on the kernel command line,
+// or else the first of /rootfs.squashfs and /rootfs.erofs that exists. It is
+// mounted read-only from a loop device. Its init is /init, unless
+// uroot.rootinit names another.
+//
+// SwitchRootImage returns nil without doing anything if there is no image or
+// the root file system is not an initramfs. Otherwise it only returns on
+// error; on success, the initramfs is deleted and the image's init replaces
+// the calling process.
+func SwitchRootImage() error {
+	path, ok := cmdline.Flag("uroot.rootimage")
+	if !ok {
+		for _, p := range rootImages {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Statfs("/", &st); err != nil {
+		return err
+	}
+	// Statfs_t.Type is signed on some architectures.
+	if t := uint32(st.Type); t != unix.RAMFS_MAGIC && t != unix.TMPFS_MAGIC {
+		ulog.KernelLog.Printf("u-root init: not booting into %s, / is not an initramfs", path)
+		return nil
+	}
+
+	fstype, err := rootImageType(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(newRootDir, 0755); err != nil {
+		return err
+	}
+	l, err := loop.New(path, fstype, "")
+	if err != nil {
+		return fmt.Errorf("setting up a loop device for %s: %v", path, err)
+	}
+	if _, err := l.Mount(newRootDir, unix.MS_RDONLY); err != nil {
+		l.Free()
+		return fmt.Errorf("mounting %s: %v", path, err)
+	}
+
+	init, ok := cmdline.Flag("uroot.rootinit")
+	if !ok {
+		init = "/init"
+	}
+	ulog.KernelLog.Printf("u-root init: switching root to %s image %s", fstype, path)
+	return mnt.SwitchRoot(newRootDir, init)
+}
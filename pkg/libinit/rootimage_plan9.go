@@ -0,0 +1,10 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libinit
+
+// SwitchRootImage does nothing on Plan 9, which has no squashfs or erofs.
+func SwitchRootImage() error {
+	return nil
+}
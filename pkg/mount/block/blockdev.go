@@ -34,9 +34,10 @@ var (
 
 // BlockDev maps a device name to a BlockStat structure for a given block device
 type BlockDev struct {
-	Name   string
-	FSType string
-	FsUUID string
+	Name    string
+	FSType  string
+	FsUUID  string
+	FsLabel string
 }
 
 // Device makes sure the block device exists and returns a handle to it.
@@ -50,10 +51,14 @@ func Device(maybeDevpath string) (*BlockDev, error) {
 	}
 
 	devpath := filepath.Join("/dev/", devname)
+	b := &BlockDev{Name: devname}
 	if uuid, err := getFSUUID(devpath); err == nil {
-		return &BlockDev{Name: devname, FsUUID: uuid}, nil
+		b.FsUUID = uuid
 	}
-	return &BlockDev{Name: devname}, nil
+	if label, err := getFSLabel(devpath); err == nil {
+		b.FsLabel = label
+	}
+	return b, nil
 }
 
 // String implements fmt.Stringer.
@@ -288,6 +293,40 @@ func getFSUUID(devpath string) (string, error) {
 	return "", fmt.Errorf("unknown UUID (not vfat, ext4, nor xfs)")
 }
 
+func getFSLabel(devpath string) (string, error) {
+	file, err := os.Open(devpath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	for _, try := range []func(io.ReaderAt) (string, error){
+		tryFAT32Label,
+		tryFAT16Label,
+		tryEXT4Label,
+		tryXFSLabel,
+	} {
+		if label, err := try(file); err == nil {
+			return label, nil
+		}
+	}
+	return "", fmt.Errorf("unknown label (not vfat, ext4, nor xfs)")
+}
+
+// readLabel reads a fixed-size label field at off, trimming NUL and space
+// padding.
+func readLabel(file io.ReaderAt, off int64, size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := file.ReadAt(b, off); err != nil {
+		return "", err
+	}
+	label := strings.TrimRight(string(b), "\x00 ")
+	if len(label) == 0 {
+		return "", fmt.Errorf("no label")
+	}
+	return label, nil
+}
+
 // See https://www.nongnu.org/ext2-doc/ext2.html#DISK-ORGANISATION.
 const (
 	// Offset of superblock in partition.
@@ -302,6 +341,10 @@ const (
 	// Offset of UUID in superblock.
 	ext2SprblkUUIDOff  = 104
 	ext2SprblkUUIDSize = 16
+
+	// Offset of volume name in superblock.
+	ext2SprblkLabelOff  = 120
+	ext2SprblkLabelSize = 16
 )
 
 func tryEXT4(file io.ReaderAt) (string, error) {
@@ -328,6 +371,17 @@ func tryEXT4(file io.ReaderAt) (string, error) {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
 }
 
+func tryEXT4Label(file io.ReaderAt) (string, error) {
+	b := make([]byte, ext2SprblkMagicSize)
+	if _, err := file.ReadAt(b, ext2SprblkOff+ext2SprblkMagicOff); err != nil {
+		return "", err
+	}
+	if binary.LittleEndian.Uint16(b) != ext2SprblkMagic {
+		return "", fmt.Errorf("ext4 magic not found")
+	}
+	return readLabel(file, ext2SprblkOff+ext2SprblkLabelOff, ext2SprblkLabelSize)
+}
+
 // See https://de.wikipedia.org/wiki/File_Allocation_Table#Aufbau.
 const (
 	fat12Magic = "FAT12   "
@@ -340,6 +394,10 @@ const (
 	// Offset of filesystem ID / serial number. Treated as short filesystem UUID.
 	fat16IDOff  = 0x27
 	fat16IDSize = 4
+
+	// Offset of volume label.
+	fat16LabelOff  = 0x2b
+	fat16LabelSize = 11
 )
 
 func tryFAT16(file io.ReaderAt) (string, error) {
@@ -362,6 +420,24 @@ func tryFAT16(file io.ReaderAt) (string, error) {
 	return fmt.Sprintf("%02x%02x-%02x%02x", b[3], b[2], b[1], b[0]), nil
 }
 
+// fatNoLabel is the label mkfs.vfat writes when no label was given.
+const fatNoLabel = "NO NAME"
+
+func tryFAT16Label(file io.ReaderAt) (string, error) {
+	b := make([]byte, fat16MagicSize)
+	if _, err := file.ReadAt(b, fat16MagicOff); err != nil {
+		return "", err
+	}
+	if magic := string(b); magic != fat16Magic && magic != fat12Magic {
+		return "", fmt.Errorf("fat16 magic not found")
+	}
+	label, err := readLabel(file, fat16LabelOff, fat16LabelSize)
+	if err == nil && label == fatNoLabel {
+		return "", fmt.Errorf("no label")
+	}
+	return label, err
+}
+
 // See https://de.wikipedia.org/wiki/File_Allocation_Table#Aufbau.
 const (
 	fat32Magic = "FAT32   "
@@ -373,6 +449,10 @@ const (
 	// Offset of filesystem ID / serial number. Treated as short filesystem UUID.
 	fat32IDOff  = 67
 	fat32IDSize = 4
+
+	// Offset of volume label.
+	fat32LabelOff  = 0x47
+	fat32LabelSize = 11
 )
 
 func tryFAT32(file io.ReaderAt) (string, error) {
@@ -395,11 +475,28 @@ func tryFAT32(file io.ReaderAt) (string, error) {
 	return fmt.Sprintf("%02x%02x-%02x%02x", b[3], b[2], b[1], b[0]), nil
 }
 
+func tryFAT32Label(file io.ReaderAt) (string, error) {
+	b := make([]byte, fat32MagicSize)
+	if _, err := file.ReadAt(b, fat32MagicOff); err != nil {
+		return "", err
+	}
+	if string(b) != fat32Magic {
+		return "", fmt.Errorf("fat32 magic not found")
+	}
+	label, err := readLabel(file, fat32LabelOff, fat32LabelSize)
+	if err == nil && label == fatNoLabel {
+		return "", fmt.Errorf("no label")
+	}
+	return label, err
+}
+
 const (
 	xfsMagic     = "XFSB"
 	xfsMagicSize = 4
 	xfsUUIDOff   = 32
 	xfsUUIDSize  = 16
+	xfsLabelOff  = 108
+	xfsLabelSize = 12
 )
 
 func tryXFS(file io.ReaderAt) (string, error) {
@@ -422,6 +519,17 @@ func tryXFS(file io.ReaderAt) (string, error) {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
 }
 
+func tryXFSLabel(file io.ReaderAt) (string, error) {
+	b := make([]byte, xfsMagicSize)
+	if _, err := file.ReadAt(b, 0); err != nil {
+		return "", err
+	}
+	if string(b) != xfsMagic {
+		return "", fmt.Errorf("xfs magic not found")
+	}
+	return readLabel(file, xfsLabelOff, xfsLabelSize)
+}
+
 // BlockDevices is a list of block devices.
 type BlockDevices []*BlockDev
 
@@ -510,6 +618,18 @@ func (b BlockDevices) FilterFSUUID(fsuuid string) BlockDevices {
 	return partitions
 }
 
+// FilterFSLabel returns a list of BlockDev objects whose underlying block
+// device has a filesystem with the given label.
+func (b BlockDevices) FilterFSLabel(label string) BlockDevices {
+	partitions := make(BlockDevices, 0)
+	for _, device := range b {
+		if device.FsLabel == label {
+			partitions = append(partitions, device)
+		}
+	}
+	return partitions
+}
+
 // FilterName returns a list of BlockDev objects whose underlying
 // block device has a Name with the given Name
 func (b BlockDevices) FilterName(name string) BlockDevices {
@@ -5,7 +5,10 @@
 package block
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"reflect"
 	"testing"
 
@@ -110,3 +113,58 @@ func TestParsePCIBlockList(t *testing.T) {
 		})
 	}
 }
+
+func TestFSLabel(t *testing.T) {
+	ext4 := make([]byte, 4096)
+	binary.LittleEndian.PutUint16(ext4[ext2SprblkOff+ext2SprblkMagicOff:], ext2SprblkMagic)
+	copy(ext4[ext2SprblkOff+ext2SprblkLabelOff:], "rootfs")
+
+	fat32 := make([]byte, 512)
+	copy(fat32[fat32MagicOff:], fat32Magic)
+	copy(fat32[fat32LabelOff:], "EFI        ")
+
+	fat32NoName := make([]byte, 512)
+	copy(fat32NoName[fat32MagicOff:], fat32Magic)
+	copy(fat32NoName[fat32LabelOff:], "NO NAME    ")
+
+	xfs := make([]byte, 512)
+	copy(xfs, xfsMagic)
+	copy(xfs[xfsLabelOff:], "data")
+
+	for _, tt := range []struct {
+		name string
+		try  func(io.ReaderAt) (string, error)
+		dev  []byte
+		want string
+	}{
+		{name: "ext4", try: tryEXT4Label, dev: ext4, want: "rootfs"},
+		{name: "fat32", try: tryFAT32Label, dev: fat32, want: "EFI"},
+		{name: "fat32 no name", try: tryFAT32Label, dev: fat32NoName},
+		{name: "xfs", try: tryXFSLabel, dev: xfs, want: "data"},
+		{name: "wrong magic", try: tryEXT4Label, dev: xfs},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.try(bytes.NewReader(tt.dev))
+			if len(tt.want) == 0 {
+				if err == nil {
+					t.Errorf("label = %q, want error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("label = (%q, %v), want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterFSLabel(t *testing.T) {
+	devs := BlockDevices{
+		{Name: "sda1", FsLabel: "EFI"},
+		{Name: "sda2", FsLabel: "rootfs"},
+	}
+	got := devs.FilterFSLabel("rootfs")
+	if len(got) != 1 || got[0].Name != "sda2" {
+		t.Errorf("FilterFSLabel(rootfs) = %v, want [sda2]", got)
+	}
+}
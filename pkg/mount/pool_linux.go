@@ -0,0 +1,109 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mount
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Pool keeps track of mount points so that devices are only mounted once
+// and can be unmounted together.
+type Pool struct {
+	// MountPoints are all mount points in the pool.
+	MountPoints []*MountPoint
+
+	// mounters maps mounters mounted by the pool to their mount point.
+	mounters map[Mounter]*MountPoint
+
+	tmpDir string
+}
+
+// Add adds an existing mount point to the pool.
+func (p *Pool) Add(mp *MountPoint) {
+	p.MountPoints = append(p.MountPoints, mp)
+}
+
+// Mount mounts m in a temporary directory and adds it to the pool. If m was
+// already mounted by this pool, the existing mount point is returned.
+func (p *Pool) Mount(m Mounter, flags uintptr) (*MountPoint, error) {
+	if mp, ok := p.mounters[m]; ok {
+		return mp, nil
+	}
+	if len(p.tmpDir) == 0 {
+		dir, err := ioutil.TempDir("", "u-root-mounts")
+		if err != nil {
+			return nil, fmt.Errorf("cannot create tmpdir: %v", err)
+		}
+		p.tmpDir = dir
+	}
+	dir, err := ioutil.TempDir(p.tmpDir, "")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create tmpdir: %v", err)
+	}
+	mp, err := m.Mount(dir, flags)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if p.mounters == nil {
+		p.mounters = make(map[Mounter]*MountPoint)
+	}
+	p.mounters[m] = mp
+	p.Add(mp)
+	return mp, nil
+}
+
+// Lookup returns the mount point of m if it was mounted by this pool.
+func (p *Pool) Lookup(m Mounter) (*MountPoint, bool) {
+	mp, ok := p.mounters[m]
+	return mp, ok
+}
+
+// Unmount unmounts m if it was mounted by this pool and removes its mount
+// point from the pool.
+func (p *Pool) Unmount(m Mounter, flags uintptr) error {
+	mp, ok := p.mounters[m]
+	if !ok {
+		return fmt.Errorf("%v was not mounted by this pool", m)
+	}
+	if err := mp.Unmount(flags); err != nil {
+		return err
+	}
+	os.Remove(mp.Path)
+	delete(p.mounters, m)
+	for i, other := range p.MountPoints {
+		if other == mp {
+			p.MountPoints = append(p.MountPoints[:i], p.MountPoints[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// UnmountAll unmounts all mount points in the pool. It keeps going on errors
+// and returns the first one.
+func (p *Pool) UnmountAll(flags uintptr) error {
+	var firstErr error
+	for _, mp := range p.MountPoints {
+		if err := mp.Unmount(flags); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		// Only remove empty directories; never recurse into what may
+		// still be a mounted file system.
+		os.Remove(mp.Path)
+	}
+	p.MountPoints = nil
+	p.mounters = nil
+	if len(p.tmpDir) > 0 {
+		os.Remove(p.tmpDir)
+		p.tmpDir = ""
+	}
+	return firstErr
+}
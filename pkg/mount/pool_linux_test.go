@@ -0,0 +1,120 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mount
+
+import (
+	"os"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/testutil"
+)
+
+// tmpfs is a Mounter that mounts a fresh tmpfs and counts its mounts.
+type tmpfs struct {
+	mounts int
+}
+
+func (t *tmpfs) Mount(path string, flags uintptr) (*MountPoint, error) {
+	t.mounts++
+	return Mount("tmpfs", path, "tmpfs", "", flags)
+}
+
+func TestPoolMount(t *testing.T) {
+	testutil.SkipIfNotRoot(t)
+
+	var p Pool
+	a, b := &tmpfs{}, &tmpfs{}
+	mpA, err := p.Mount(a, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpB, err := p.Mount(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mpA.Path == mpB.Path {
+		t.Errorf("a and b are both mounted at %s", mpA.Path)
+	}
+
+	// Mounting a again returns the existing mount point.
+	again, err := p.Mount(a, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != mpA || a.mounts != 1 {
+		t.Errorf("Mount(a) again = %v after %d mounts, want %v after 1 mount", again, a.mounts, mpA)
+	}
+	if mp, ok := p.Lookup(a); !ok || mp != mpA {
+		t.Errorf("Lookup(a) = %v, %t, want %v, true", mp, ok, mpA)
+	}
+	if len(p.MountPoints) != 2 {
+		t.Errorf("pool has %d mount points, want 2", len(p.MountPoints))
+	}
+
+	tmpDir := p.tmpDir
+	if err := p.UnmountAll(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.MountPoints) != 0 {
+		t.Errorf("pool has %d mount points after UnmountAll, want 0", len(p.MountPoints))
+	}
+	if _, ok := p.Lookup(a); ok {
+		t.Errorf("Lookup(a) after UnmountAll found a mount point")
+	}
+	if _, err := os.Stat(tmpDir); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after UnmountAll: %v", tmpDir, err)
+	}
+}
+
+func TestPoolUnmount(t *testing.T) {
+	testutil.SkipIfNotRoot(t)
+
+	var p Pool
+	defer p.UnmountAll(0)
+
+	a, b := &tmpfs{}, &tmpfs{}
+	mpA, err := p.Mount(a, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpB, err := p.Mount(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Unmount(a, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mpA.Path); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after Unmount: %v", mpA.Path, err)
+	}
+	if len(p.MountPoints) != 1 || p.MountPoints[0] != mpB {
+		t.Errorf("pool has mount points %v, want [%v]", p.MountPoints, mpB)
+	}
+	if err := p.Unmount(a, 0); err == nil {
+		t.Errorf("Unmount(a) twice = nil, want error")
+	}
+
+	// a can be mounted again.
+	if _, err := p.Mount(a, 0); err != nil {
+		t.Fatal(err)
+	}
+	if a.mounts != 2 {
+		t.Errorf("a was mounted %d times, want 2", a.mounts)
+	}
+}
+
+func TestPoolAdd(t *testing.T) {
+	var p Pool
+	mp := &MountPoint{Path: "/foo"}
+	p.Add(mp)
+	if len(p.MountPoints) != 1 || p.MountPoints[0] != mp {
+		t.Errorf("pool has mount points %v, want [%v]", p.MountPoints, mp)
+	}
+	// Added mount points were not mounted by the pool.
+	if err := p.Unmount(&tmpfs{}, 0); err == nil {
+		t.Errorf("Unmount of unknown mounter = nil, want error")
+	}
+}
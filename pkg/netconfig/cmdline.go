@@ -0,0 +1,358 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconfig
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/cmdline"
+	"github.com/u-root/u-root/pkg/shlex"
+)
+
+// Cmdline returns the network configuration of the kernel command line, or
+// nil if it has none.
+func Cmdline() (*Config, error) {
+	return ParseCmdline(cmdline.FullCmdLine())
+}
+
+// ParseCmdline parses the network configuration in a kernel command line,
+// or returns nil if it has none. It understands these arguments, as
+// documented by the kernel's nfsroot.txt and dracut.cmdline(7):
+//
+//   ip={off|none|on|any|dhcp|bootp|both|single-dhcp|dhcp6|auto6|either6|link6}
+//   ip=<interface>:<autoconf>[:[<mtu>][:<macaddr>]]
+//   ip=<client-ip>:[<server-ip>]:[<gw-ip>]:[<netmask>]:[<hostname>]:[<interface>]:[<autoconf>][:[<mtu>][:<macaddr>]]
+//   ip=<client-ip>:[<server-ip>]:[<gw-ip>]:[<netmask>]:[<hostname>]:[<interface>]:[<autoconf>][:[<dns0-ip>][:<dns1-ip>]]
+//   nameserver=<ip>
+//   rd.route=<net>/<netmask>:<gateway>[:<interface>]
+//   vlan=<vlanname>:<phys>
+//   bond=<bondname>[:<slaves>[:<options>[:<mtu>]]]
+//   bridge=<bridgename>:<ports>
+//
+// ip= may be repeated for several interfaces. IPv6 addresses are enclosed in
+// brackets, and their netmask is a prefix length. An ip= without autoconf
+// method gets a DHCPv4 lease only if it has no client-ip.
+func ParseCmdline(line string) (*Config, error) {
+	c := &Config{}
+	found := false
+	for _, arg := range shlex.Argv(line) {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var err error
+		switch key, value := kv[0], kv[1]; key {
+		case "ip":
+			err = c.parseIP(value)
+		case "nameserver":
+			if net.ParseIP(value) == nil {
+				err = fmt.Errorf("invalid nameserver %q", value)
+			}
+			c.DNS.Servers = append(c.DNS.Servers, value)
+		case "rd.route":
+			err = c.parseRoute(value)
+		case "vlan":
+			err = c.parseVLAN(value)
+		case "bond":
+			err = c.parseBond(value)
+		case "bridge":
+			err = c.parseBridge(value)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", arg, err)
+		}
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// iface returns the interface named name, adding it if there is none.
+func (c *Config) iface(name string) *Interface {
+	if i := c.Interface(name); i != nil {
+		return i
+	}
+	i := &Interface{Name: name}
+	c.Interfaces = append(c.Interfaces, i)
+	return i
+}
+
+// splitFields splits s at colons that are not within brackets, and removes
+// the brackets around IPv6 addresses.
+func splitFields(s string) []string {
+	var fields []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	fields = append(fields, s[start:])
+	for i, f := range fields {
+		fields[i] = strings.TrimSuffix(strings.TrimPrefix(f, "["), "]")
+	}
+	return fields
+}
+
+// autoconf sets up i to get its address with method. It returns false if
+// method is not a method.
+func (i *Interface) autoconf(method string) (bool, error) {
+	switch method {
+	case "off", "none":
+	case "on", "any", "dhcp", "bootp", "both", "single-dhcp":
+		i.DHCP4 = true
+	case "dhcp6", "either6":
+		i.DHCP6 = true
+	case "auto6", "link6":
+		// The kernel does SLAAC and link-local addresses by itself
+		// once the link is up.
+	case "rarp", "ibft":
+		return true, fmt.Errorf("autoconf method %s is not supported", method)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c *Config) parseIP(value string) error {
+	f := splitFields(value)
+
+	// ip=<autoconf>
+	if len(f) == 1 {
+		i := &Interface{}
+		if ok, err := i.autoconf(f[0]); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("unknown autoconf method %q", f[0])
+		}
+		if i.DHCP4 || i.DHCP6 {
+			ci := c.iface("")
+			ci.DHCP4 = ci.DHCP4 || i.DHCP4
+			ci.DHCP6 = ci.DHCP6 || i.DHCP6
+		}
+		return nil
+	}
+
+	// ip=<interface>:<autoconf>[:[<mtu>][:<macaddr>]]
+	if ok, _ := (&Interface{}).autoconf(f[1]); ok {
+		i := c.iface(f[0])
+		if _, err := i.autoconf(f[1]); err != nil {
+			return err
+		}
+		return i.parseMTUAndMAC(f[2:])
+	}
+
+	for len(f) < 7 {
+		f = append(f, "")
+	}
+	clientIP, serverIP, gw, netmask, hostname, name, method := f[0], f[1], f[2], f[3], f[4], f[5], f[6]
+	i := c.iface(name)
+	if clientIP != "" {
+		addr, err := parseAddr(clientIP, netmask)
+		if err != nil {
+			return err
+		}
+		i.Addresses = append(i.Addresses, addr)
+	}
+	if serverIP != "" {
+		i.Server = serverIP
+	}
+	if gw != "" {
+		i.Routes = append(i.Routes, &Route{To: "default", Via: gw})
+	}
+	if hostname != "" {
+		c.Hostname = hostname
+	}
+	if method == "" && clientIP == "" {
+		method = "dhcp"
+	}
+	if ok, err := i.autoconf(method); err != nil {
+		return err
+	} else if !ok && method != "" {
+		return fmt.Errorf("unknown autoconf method %q", method)
+	}
+
+	rest := f[7:]
+	if len(rest) > 0 && (rest[0] == "" || net.ParseIP(rest[0]) == nil) {
+		return i.parseMTUAndMAC(rest)
+	}
+	// The kernel's third field is an NTP server.
+	for j, dns := range rest {
+		if j < 2 && dns != "" {
+			c.DNS.Servers = append(c.DNS.Servers, dns)
+		}
+	}
+	return nil
+}
+
+// parseMTUAndMAC parses the optional [<mtu>][:<macaddr>] fields of ip=. The
+// MAC address was split at its colons.
+func (i *Interface) parseMTUAndMAC(f []string) error {
+	if len(f) == 0 {
+		return nil
+	}
+	if f[0] != "" {
+		mtu, err := strconv.Atoi(f[0])
+		if err != nil {
+			return fmt.Errorf("invalid MTU %q", f[0])
+		}
+		i.MTU = mtu
+	}
+	if len(f) > 1 {
+		i.MAC = strings.Join(f[1:], ":")
+	}
+	return nil
+}
+
+// parseAddr returns ip with netmask in CIDR notation. netmask is either a
+// dotted IPv4 netmask or a prefix length. Without netmask, IPv4 addresses
+// get their classful netmask and IPv6 addresses a /64.
+func parseAddr(ip, netmask string) (string, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", fmt.Errorf("invalid IP %q", ip)
+	}
+	bits := 8 * net.IPv6len
+	if v4 := addr.To4(); v4 != nil {
+		addr, bits = v4, 8*net.IPv4len
+	}
+
+	var ones int
+	switch {
+	case netmask == "" && bits == 8*net.IPv6len:
+		ones = 64
+	case netmask == "":
+		ones, _ = addr.DefaultMask().Size()
+	case strings.Contains(netmask, "."):
+		m := net.ParseIP(netmask).To4()
+		if m == nil {
+			return "", fmt.Errorf("invalid netmask %q", netmask)
+		}
+		var b int
+		ones, b = net.IPMask(m).Size()
+		if b == 0 {
+			return "", fmt.Errorf("invalid netmask %q", netmask)
+		}
+	default:
+		var err error
+		ones, err = strconv.Atoi(netmask)
+		if err != nil || ones < 0 || ones > bits {
+			return "", fmt.Errorf("invalid netmask %q", netmask)
+		}
+	}
+	return fmt.Sprintf("%s/%d", addr, ones), nil
+}
+
+func (c *Config) parseRoute(value string) error {
+	f := splitFields(value)
+	if len(f) < 2 || len(f) > 3 {
+		return fmt.Errorf("want <net>/<netmask>:<gateway>[:<interface>]")
+	}
+	r := &Route{To: f[0], Via: f[1]}
+	if s := strings.SplitN(f[0], "/", 2); len(s) == 2 {
+		to, err := parseAddr(s[0], s[1])
+		if err != nil {
+			return err
+		}
+		r.To = to
+	}
+	if len(f) == 3 {
+		r.Dev = f[2]
+	}
+	c.Routes = append(c.Routes, r)
+	return nil
+}
+
+func (c *Config) parseVLAN(value string) error {
+	f := strings.Split(value, ":")
+	if len(f) != 2 || f[0] == "" || f[1] == "" {
+		return fmt.Errorf("want <vlanname>:<phys>")
+	}
+	// dracut allows vlan0005, vlan5, eth0.0005 and eth0.5.
+	name, id := f[0], ""
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		id = name[dot+1:]
+	} else {
+		id = strings.TrimPrefix(name, "vlan")
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("no VLAN ID in %q", name)
+	}
+	c.iface(name).VLAN = &VLAN{Link: f[1], ID: n}
+	return nil
+}
+
+func (c *Config) parseBond(value string) error {
+	f := strings.Split(value, ":")
+	name := f[0]
+	if name == "" {
+		name = "bond0"
+	}
+	b := &Bond{Slaves: []string{"eth0", "eth1"}}
+	if len(f) > 1 && f[1] != "" {
+		b.Slaves = strings.Split(f[1], ",")
+	}
+	if len(f) > 2 && f[2] != "" {
+		for _, opt := range strings.Split(f[2], ",") {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid bonding option %q", opt)
+			}
+			switch kv[0] {
+			case "mode":
+				b.Mode = kv[1]
+			case "miimon":
+				n, err := strconv.Atoi(kv[1])
+				if err != nil {
+					return fmt.Errorf("invalid miimon %q", kv[1])
+				}
+				b.MIIMon = n
+			default:
+				return fmt.Errorf("unsupported bonding option %q", kv[0])
+			}
+		}
+	}
+	i := c.iface(name)
+	i.Bond = b
+	if len(f) > 3 && f[3] != "" {
+		return i.parseMTUAndMAC(f[3:4])
+	}
+	return nil
+}
+
+func (c *Config) parseBridge(value string) error {
+	f := strings.Split(value, ":")
+	if len(f) > 2 {
+		return fmt.Errorf("want <bridgename>:<ports>")
+	}
+	name, ports := "br0", []string{"eth0"}
+	if f[0] != "" {
+		name = f[0]
+	}
+	if len(f) == 2 && f[1] != "" {
+		ports = strings.Split(f[1], ",")
+	}
+	c.iface(name).Bridge = &Bridge{Ports: ports}
+	return nil
+}
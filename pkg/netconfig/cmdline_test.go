@@ -0,0 +1,165 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCmdline(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		line string
+		want *Config
+	}{
+		{
+			name: "none",
+			line: "console=ttyS0 root=/dev/sda1",
+		},
+		{
+			name: "dhcp",
+			line: "ip=dhcp",
+			want: &Config{Interfaces: []*Interface{{DHCP4: true}}},
+		},
+		{
+			name: "off",
+			line: "ip=off",
+			want: &Config{},
+		},
+		{
+			name: "dhcp and dhcp6",
+			line: "ip=dhcp ip=dhcp6",
+			want: &Config{Interfaces: []*Interface{{DHCP4: true, DHCP6: true}}},
+		},
+		{
+			name: "interface autoconf",
+			line: "ip=eth1:dhcp6:9000:52:54:00:12:34:56",
+			want: &Config{Interfaces: []*Interface{{
+				Name:  "eth1",
+				DHCP6: true,
+				MTU:   9000,
+				MAC:   "52:54:00:12:34:56",
+			}}},
+		},
+		{
+			name: "kernel static",
+			line: "ip=10.0.2.15:10.0.2.2:10.0.2.1:255.255.255.0:node1:eth0:off:10.0.2.3:10.0.2.4:10.0.2.5",
+			want: &Config{
+				Hostname: "node1",
+				Interfaces: []*Interface{{
+					Name:      "eth0",
+					Addresses: []string{"10.0.2.15/24"},
+					Routes:    []*Route{{To: "default", Via: "10.0.2.1"}},
+					Server:    "10.0.2.2",
+				}},
+				DNS: DNS{Servers: []string{"10.0.2.3", "10.0.2.4"}},
+			},
+		},
+		{
+			name: "classful netmask and no device",
+			line: "ip=10.1.2.3::::::none",
+			want: &Config{Interfaces: []*Interface{{Addresses: []string{"10.1.2.3/8"}}}},
+		},
+		{
+			name: "no autoconf and no address",
+			line: "ip=::::node1:eth0",
+			want: &Config{
+				Hostname:   "node1",
+				Interfaces: []*Interface{{Name: "eth0", DHCP4: true}},
+			},
+		},
+		{
+			name: "ipv6 and mtu",
+			line: "ip=[fd00::2]::[fd00::1]:64::eth0:none:1400 ip=10.0.0.2:::24::eth0:none",
+			want: &Config{Interfaces: []*Interface{{
+				Name:      "eth0",
+				Addresses: []string{"fd00::2/64", "10.0.0.2/24"},
+				Routes:    []*Route{{To: "default", Via: "fd00::1"}},
+				MTU:       1400,
+			}}},
+		},
+		{
+			name: "dracut extras",
+			line: "bond=bond0:eth0,eth1:mode=active-backup,miimon=100:9000 vlan=bond0.5:bond0 bridge=br0:eth2 " +
+				"ip=10.0.5.2::10.0.5.1:24::bond0.5:none nameserver=10.0.5.1 rd.route=192.168.0.0/255.255.0.0:10.0.5.254",
+			want: &Config{
+				Interfaces: []*Interface{
+					{
+						Name: "bond0",
+						Bond: &Bond{Mode: "active-backup", MIIMon: 100, Slaves: []string{"eth0", "eth1"}},
+						MTU:  9000,
+					},
+					{
+						Name:      "bond0.5",
+						VLAN:      &VLAN{Link: "bond0", ID: 5},
+						Addresses: []string{"10.0.5.2/24"},
+						Routes:    []*Route{{To: "default", Via: "10.0.5.1"}},
+					},
+					{
+						Name:   "br0",
+						Bridge: &Bridge{Ports: []string{"eth2"}},
+					},
+				},
+				Routes: []*Route{{To: "192.168.0.0/16", Via: "10.0.5.254"}},
+				DNS:    DNS{Servers: []string{"10.0.5.1"}},
+			},
+		},
+		{
+			name: "vlan names",
+			line: "vlan=vlan0005:eth0 vlan=eth1.0012:eth1",
+			want: &Config{Interfaces: []*Interface{
+				{Name: "vlan0005", VLAN: &VLAN{Link: "eth0", ID: 5}},
+				{Name: "eth1.0012", VLAN: &VLAN{Link: "eth1", ID: 12}},
+			}},
+		},
+		{
+			name: "bond and bridge defaults",
+			line: "bond= bridge=",
+			want: &Config{Interfaces: []*Interface{
+				{Name: "bond0", Bond: &Bond{Slaves: []string{"eth0", "eth1"}}},
+				{Name: "br0", Bridge: &Bridge{Ports: []string{"eth0"}}},
+			}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCmdline(tt.line)
+			if err != nil {
+				t.Fatalf("ParseCmdline(%q) = %v", tt.line, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCmdline(%q) = %s, want %s", tt.line, dump(got), dump(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseCmdlineErrors(t *testing.T) {
+	for _, line := range []string{
+		"ip=foo",
+		"ip=rarp",
+		"ip=eth0:ibft",
+		"ip=10.0.0.300::::::none",
+		"ip=10.0.0.2:::255.0.255.0::eth0:none",
+		"ip=10.0.0.2:::33::eth0:none",
+		"ip=10.0.0.2::::::bogus",
+		"ip=eth0:dhcp:big",
+		"ip=eth0:dhcp:1500:52:54",
+		"nameserver=dns.example.com",
+		"rd.route=10.0.0.0/8",
+		"rd.route=10.0.0.0/8:gateway",
+		"vlan=eth0",
+		"vlan=eth0.x:eth0",
+		"vlan=eth0.5000:eth0",
+		"bond=bond0:eth0:mode=fastest",
+		"bond=bond0:eth0:lacp_rate=fast",
+		"bridge=br0:eth0:eth1",
+		"bond=br0 bridge=br0:eth0",
+	} {
+		if c, err := ParseCmdline(line); err == nil {
+			t.Errorf("ParseCmdline(%q) = %s, want error", line, dump(c))
+		}
+	}
+}
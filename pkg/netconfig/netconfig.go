@@ -0,0 +1,344 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netconfig configures the network from a declarative config.
+//
+// A config is either a YAML or JSON file:
+//
+//   hostname: node1
+//   interfaces:
+//   - name: bond0
+//     bond:
+//       mode: active-backup
+//       slaves: [eth0, eth1]
+//   - name: bond0.5
+//     vlan:
+//       link: bond0
+//       id: 5
+//     addresses: [10.0.5.2/24, fd00:5::2/64]
+//     routes:
+//     - to: default
+//       via: 10.0.5.1
+//   - name: eth2
+//     dhcp4: true
+//   dns:
+//     servers: [10.0.5.1]
+//     search: [example.com]
+//
+// or the ip=, nameserver=, rd.route=, vlan=, bond= and bridge= arguments of
+// the kernel command line, as understood by the kernel and dracut (see
+// ParseCmdline).
+package netconfig
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the network configuration of a machine.
+type Config struct {
+	// Hostname is the host name to set, if not empty.
+	Hostname string `yaml:"hostname,omitempty"`
+
+	// Interfaces are configured in order, after the virtual interfaces
+	// among them are created.
+	Interfaces []*Interface `yaml:"interfaces,omitempty"`
+
+	// Routes are added after the interfaces are configured. Routes that
+	// belong to an interface are better put in the interface's routes.
+	Routes []*Route `yaml:"routes,omitempty"`
+
+	// DNS is written to /etc/resolv.conf if not empty.
+	DNS DNS `yaml:"dns,omitempty"`
+}
+
+// Interface is the configuration of one network interface.
+type Interface struct {
+	// Name is the interface's name.
+	//
+	// An empty name stands for the interface the kernel would pick: the
+	// first physical interface for static addresses, and all physical
+	// interfaces for DHCP.
+	Name string `yaml:"name"`
+
+	// MAC is the hardware address to set, if not empty.
+	MAC string `yaml:"mac,omitempty"`
+
+	// MTU is the MTU to set, if not 0.
+	MTU int `yaml:"mtu,omitempty"`
+
+	// Addresses are the static addresses of the interface, in CIDR
+	// notation.
+	Addresses []string `yaml:"addresses,omitempty"`
+
+	// Routes are the routes through the interface.
+	Routes []*Route `yaml:"routes,omitempty"`
+
+	// DHCP4 and DHCP6 make the interface get a DHCPv4 or DHCPv6 lease.
+	DHCP4 bool `yaml:"dhcp4,omitempty"`
+	DHCP6 bool `yaml:"dhcp6,omitempty"`
+
+	// Server is the boot server of a statically configured interface,
+	// the server-ip of the kernel's ip= argument.
+	Server string `yaml:"server,omitempty"`
+
+	// At most one of VLAN, Bond and Bridge is set, if the interface is a
+	// virtual interface to be created.
+	VLAN   *VLAN   `yaml:"vlan,omitempty"`
+	Bond   *Bond   `yaml:"bond,omitempty"`
+	Bridge *Bridge `yaml:"bridge,omitempty"`
+}
+
+// VLAN is an 802.1Q VLAN interface.
+type VLAN struct {
+	// Link is the interface the VLAN is on.
+	Link string `yaml:"link"`
+
+	// ID is the VLAN ID.
+	ID int `yaml:"id"`
+}
+
+// Bond is a bonding interface.
+type Bond struct {
+	// Mode is the bonding mode, e.g. balance-rr or 802.3ad. It defaults
+	// to balance-rr.
+	Mode string `yaml:"mode,omitempty"`
+
+	// MIIMon is the link monitoring interval in milliseconds.
+	MIIMon int `yaml:"miimon,omitempty"`
+
+	// Slaves are the bonded interfaces.
+	Slaves []string `yaml:"slaves"`
+}
+
+// Bridge is a bridge interface.
+type Bridge struct {
+	// Ports are the bridged interfaces.
+	Ports []string `yaml:"ports"`
+}
+
+// Route is a static route.
+type Route struct {
+	// To is the destination in CIDR notation, or "default".
+	To string `yaml:"to"`
+
+	// Via is the gateway, if any.
+	Via string `yaml:"via,omitempty"`
+
+	// Dev is the interface of a route of Config.Routes. If empty, the
+	// kernel picks the interface through which Via is reachable.
+	Dev string `yaml:"dev,omitempty"`
+
+	// Metric is the route's priority. Lower is preferred.
+	Metric int `yaml:"metric,omitempty"`
+}
+
+// DNS is the resolver configuration.
+type DNS struct {
+	Servers []string `yaml:"servers,omitempty"`
+	Search  []string `yaml:"search,omitempty"`
+}
+
+// ReadFile reads and validates the config at path.
+func ReadFile(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses and validates the YAML or JSON config in data.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Interface returns the interface named name, or nil.
+func (c *Config) Interface(name string) *Interface {
+	for _, i := range c.Interfaces {
+		if i.Name == name {
+			return i
+		}
+	}
+	return nil
+}
+
+// HasDHCP returns whether any interface of c gets a DHCP lease.
+func (c *Config) HasDHCP() bool {
+	for _, i := range c.Interfaces {
+		if i.DHCP4 || i.DHCP6 {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutDHCP returns a copy of c whose interfaces do not get DHCP leases.
+func (c *Config) WithoutDHCP() *Config {
+	static := *c
+	static.Interfaces = nil
+	for _, i := range c.Interfaces {
+		si := *i
+		si.DHCP4, si.DHCP6 = false, false
+		static.Interfaces = append(static.Interfaces, &si)
+	}
+	return &static
+}
+
+// Validate checks that the addresses, routes and interface kinds in c make
+// sense.
+func (c *Config) Validate() error {
+	names := make(map[string]bool)
+	for _, i := range c.Interfaces {
+		if names[i.Name] {
+			return fmt.Errorf("interface %q configured twice", i.Name)
+		}
+		names[i.Name] = true
+		if err := i.validate(); err != nil {
+			if i.Name == "" {
+				return err
+			}
+			return fmt.Errorf("interface %s: %v", i.Name, err)
+		}
+	}
+	for _, r := range c.Routes {
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if r.Via == "" && r.Dev == "" {
+			return fmt.Errorf("route to %s has neither gateway nor dev", r.To)
+		}
+	}
+	for _, s := range c.DNS.Servers {
+		if net.ParseIP(s) == nil {
+			return fmt.Errorf("invalid DNS server %q", s)
+		}
+	}
+	return nil
+}
+
+func (i *Interface) validate() error {
+	kinds := 0
+	if i.VLAN != nil {
+		kinds++
+		if i.VLAN.Link == "" {
+			return fmt.Errorf("VLAN has no link")
+		}
+		if i.VLAN.ID < 1 || i.VLAN.ID > 4094 {
+			return fmt.Errorf("invalid VLAN ID %d", i.VLAN.ID)
+		}
+	}
+	if i.Bond != nil {
+		kinds++
+		if i.Bond.Mode != "" && bondMode(i.Bond.Mode) < 0 {
+			return fmt.Errorf("unknown bonding mode %q", i.Bond.Mode)
+		}
+	}
+	if i.Bridge != nil {
+		kinds++
+	}
+	if kinds > 1 {
+		return fmt.Errorf("only one of vlan, bond and bridge may be set")
+	}
+	if kinds > 0 && i.Name == "" {
+		return fmt.Errorf("virtual interfaces need a name")
+	}
+
+	if i.MAC != "" {
+		if _, err := net.ParseMAC(i.MAC); err != nil {
+			return err
+		}
+	}
+	if i.MTU < 0 {
+		return fmt.Errorf("invalid MTU %d", i.MTU)
+	}
+	for _, a := range i.Addresses {
+		if _, _, err := net.ParseCIDR(a); err != nil {
+			return err
+		}
+	}
+	if i.Server != "" && net.ParseIP(i.Server) == nil {
+		return fmt.Errorf("invalid server %q", i.Server)
+	}
+	for _, r := range i.Routes {
+		if r.Dev != "" && r.Dev != i.Name {
+			return fmt.Errorf("route to %s is on %s", r.To, r.Dev)
+		}
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Static returns whether the interface has static addresses.
+func (i *Interface) Static() bool {
+	return len(i.Addresses) > 0
+}
+
+func (r *Route) validate() error {
+	if _, err := r.dst(); err != nil {
+		return err
+	}
+	if r.Via != "" && net.ParseIP(r.Via) == nil {
+		return fmt.Errorf("route to %s: invalid gateway %q", r.To, r.Via)
+	}
+	if r.To == "default" && r.Via == "" {
+		return fmt.Errorf("default route has no gateway")
+	}
+	return nil
+}
+
+// dst returns the route's destination. The default route's is nil.
+func (r *Route) dst() (*net.IPNet, error) {
+	if r.To == "default" {
+		return nil, nil
+	}
+	_, dst, err := net.ParseCIDR(r.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route destination %q", r.To)
+	}
+	return dst, nil
+}
+
+// bondModes are the bonding modes by name, as in the kernel's bonding
+// driver.
+var bondModes = []string{
+	"balance-rr",
+	"active-backup",
+	"balance-xor",
+	"broadcast",
+	"802.3ad",
+	"balance-tlb",
+	"balance-alb",
+}
+
+// bondMode returns the number of the bonding mode named s, or -1. Modes may
+// also be given by number.
+func bondMode(s string) int {
+	for n, m := range bondModes {
+		if s == m || s == fmt.Sprint(n) {
+			return n
+		}
+	}
+	return -1
+}
@@ -0,0 +1,331 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	dhcpTimeout   = 5 * time.Second
+	dhcpRetries   = 3
+	linkUpTimeout = 30 * time.Second
+)
+
+// Apply configures the network as c describes. Existing virtual interfaces
+// are reused, and addresses and routes replaced, so that applying a config
+// twice is harmless.
+//
+// Apply goes on after errors, and returns all of them.
+func Apply(ctx context.Context, c *Config) error {
+	var errs []string
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	// Bonds and bridges need to exist before their ports are added, and
+	// VLANs may be on them.
+	for _, i := range c.Interfaces {
+		if i.Bond != nil || i.Bridge != nil {
+			check(addLink(i))
+		}
+	}
+	for _, i := range c.Interfaces {
+		if i.VLAN != nil {
+			check(addLink(i))
+		}
+	}
+
+	type protocols struct{ v4, v6 bool }
+	dhcp := make(map[protocols][]netlink.Link)
+	for _, i := range c.Interfaces {
+		links, err := i.Links()
+		if err != nil {
+			check(err)
+			continue
+		}
+		for _, l := range links {
+			check(configure(l, i))
+			if i.DHCP4 || i.DHCP6 {
+				p := protocols{i.DHCP4, i.DHCP6}
+				dhcp[p] = append(dhcp[p], l)
+			}
+		}
+	}
+
+	dc := dhclient.Config{
+		Timeout: dhcpTimeout,
+		Retries: dhcpRetries,
+	}
+	for p, links := range dhcp {
+		for result := range dhclient.SendRequests(ctx, links, p.v4, p.v6, dc, linkUpTimeout) {
+			if result.Err != nil {
+				check(fmt.Errorf("%s: %s: %v", result.Interface.Attrs().Name, result.Protocol, result.Err))
+			} else if err := result.Lease.Configure(); err != nil {
+				check(fmt.Errorf("%s: %v", result.Interface.Attrs().Name, err))
+			}
+		}
+	}
+
+	for _, r := range c.Routes {
+		var link netlink.Link
+		if r.Dev != "" {
+			var err error
+			if link, err = netlink.LinkByName(r.Dev); err != nil {
+				check(fmt.Errorf("route to %s: %v", r.To, err))
+				continue
+			}
+		}
+		check(addRoute(link, r))
+	}
+
+	// Static DNS settings win over those of DHCP leases.
+	if len(c.DNS.Servers) > 0 || len(c.DNS.Search) > 0 {
+		var servers []net.IP
+		for _, s := range c.DNS.Servers {
+			servers = append(servers, net.ParseIP(s))
+		}
+		check(dhclient.WriteDNSSettings(servers, c.DNS.Search, ""))
+	}
+
+	if c.Hostname != "" {
+		if err := unix.Sethostname([]byte(c.Hostname)); err != nil {
+			check(fmt.Errorf("could not set hostname %q: %v", c.Hostname, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// physicalLinks returns the network devices that are not virtual.
+func physicalLinks() ([]netlink.Link, error) {
+	all, err := netlink.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	var links []netlink.Link
+	for _, l := range all {
+		if l.Type() == "device" && l.Attrs().Flags&net.FlagLoopback == 0 {
+			links = append(links, l)
+		}
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("no network devices")
+	}
+	return links, nil
+}
+
+// Links returns the links i configures.
+func (i *Interface) Links() ([]netlink.Link, error) {
+	if i.Name != "" {
+		l, err := netlink.LinkByName(i.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", i.Name, err)
+		}
+		return []netlink.Link{l}, nil
+	}
+
+	links, err := physicalLinks()
+	if err != nil {
+		return nil, err
+	}
+	// Like the kernel, use the first device for a static address.
+	if i.Static() {
+		return links[:1], nil
+	}
+	return links, nil
+}
+
+// addLink creates the virtual interface i if it does not exist, and adds
+// its ports.
+func addLink(i *Interface) error {
+	link, err := netlink.LinkByName(i.Name)
+	if err != nil {
+		attrs := netlink.LinkAttrs{Name: i.Name}
+		switch {
+		case i.VLAN != nil:
+			parent, err := netlink.LinkByName(i.VLAN.Link)
+			if err != nil {
+				return fmt.Errorf("%s: VLAN link %s: %v", i.Name, i.VLAN.Link, err)
+			}
+			attrs.ParentIndex = parent.Attrs().Index
+			link = &netlink.Vlan{LinkAttrs: attrs, VlanId: i.VLAN.ID}
+		case i.Bond != nil:
+			b := netlink.NewLinkBond(attrs)
+			b.Mode = netlink.BOND_MODE_BALANCE_RR
+			if i.Bond.Mode != "" {
+				b.Mode = netlink.BondMode(bondMode(i.Bond.Mode))
+			}
+			if i.Bond.MIIMon > 0 {
+				b.Miimon = i.Bond.MIIMon
+			}
+			link = b
+		case i.Bridge != nil:
+			link = &netlink.Bridge{LinkAttrs: attrs}
+		}
+		if err := netlink.LinkAdd(link); err != nil {
+			return fmt.Errorf("could not add %s: %v", i.Name, err)
+		}
+		// Get the index the kernel gave the link.
+		if link, err = netlink.LinkByName(i.Name); err != nil {
+			return err
+		}
+	}
+
+	var ports []string
+	switch {
+	case i.Bond != nil:
+		ports = i.Bond.Slaves
+	case i.Bridge != nil:
+		ports = i.Bridge.Ports
+	}
+	for _, name := range ports {
+		port, err := netlink.LinkByName(name)
+		if err != nil {
+			return fmt.Errorf("%s: port %s: %v", i.Name, name, err)
+		}
+		if port.Attrs().MasterIndex == link.Attrs().Index {
+			continue
+		}
+		// Bonding only takes slaves that are down.
+		if err := netlink.LinkSetDown(port); err != nil {
+			return fmt.Errorf("%s: could not set %s down: %v", i.Name, name, err)
+		}
+		if err := netlink.LinkSetMaster(port, link); err != nil {
+			return fmt.Errorf("%s: could not add %s: %v", i.Name, name, err)
+		}
+		if err := netlink.LinkSetUp(port); err != nil {
+			return fmt.Errorf("%s: could not set %s up: %v", i.Name, name, err)
+		}
+	}
+	return nil
+}
+
+// configure sets up link with i's link settings and static addresses and
+// routes.
+func configure(link netlink.Link, i *Interface) error {
+	name := link.Attrs().Name
+	if i.MAC != "" {
+		mac, _ := net.ParseMAC(i.MAC)
+		if err := netlink.LinkSetHardwareAddr(link, mac); err != nil {
+			return fmt.Errorf("%s: could not set MAC address %s: %v", name, mac, err)
+		}
+	}
+	if i.MTU != 0 {
+		if err := netlink.LinkSetMTU(link, i.MTU); err != nil {
+			return fmt.Errorf("%s: could not set MTU %d: %v", name, i.MTU, err)
+		}
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("%s: could not set link up: %v", name, err)
+	}
+	for _, a := range i.Addresses {
+		addr, err := netlink.ParseAddr(a)
+		if err != nil {
+			return err
+		}
+		if err := netlink.AddrReplace(link, addr); err != nil {
+			return fmt.Errorf("%s: could not add %s: %v", name, a, err)
+		}
+	}
+	for _, r := range i.Routes {
+		if err := addRoute(link, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addRoute adds r through link. link may be nil if r has a gateway.
+func addRoute(link netlink.Link, r *Route) error {
+	dst, _ := r.dst()
+	route := &netlink.Route{
+		Dst:      dst,
+		Gw:       net.ParseIP(r.Via),
+		Priority: r.Metric,
+	}
+	if link != nil {
+		route.LinkIndex = link.Attrs().Index
+	}
+	if route.Gw == nil {
+		route.Scope = netlink.SCOPE_LINK
+	}
+	if err := netlink.RouteReplace(route); err != nil {
+		return fmt.Errorf("could not add route to %s: %v", r.To, err)
+	}
+	return nil
+}
+
+// Lease returns the static IPv4 configuration of i on link as a DHCPv4
+// lease, to netboot as if a DHCP server had handed it out. bootFile becomes
+// the lease's boot file name, which is fetched from i's server unless it is
+// a URL. Lease returns nil if i has no IPv4 address.
+func (c *Config) Lease(i *Interface, link netlink.Link, bootFile string) (*dhclient.Packet4, error) {
+	var addr *net.IPNet
+	for _, a := range i.Addresses {
+		ip, n, _ := net.ParseCIDR(a)
+		if ip.To4() != nil {
+			addr = &net.IPNet{IP: ip.To4(), Mask: n.Mask}
+			break
+		}
+	}
+	if addr == nil {
+		return nil, nil
+	}
+
+	mods := []dhcpv4.Modifier{
+		dhcpv4.WithHwAddr(link.Attrs().HardwareAddr),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeAck),
+		dhcpv4.WithYourIP(addr.IP),
+		dhcpv4.WithNetmask(addr.Mask),
+	}
+	if i.Server != "" {
+		mods = append(mods, dhcpv4.WithServerIP(net.ParseIP(i.Server)))
+	}
+	for _, r := range i.Routes {
+		if gw := net.ParseIP(r.Via).To4(); r.To == "default" && gw != nil {
+			mods = append(mods, dhcpv4.WithOption(dhcpv4.OptRouter(gw)))
+			break
+		}
+	}
+	var dns []net.IP
+	for _, s := range c.DNS.Servers {
+		if ip := net.ParseIP(s).To4(); ip != nil {
+			dns = append(dns, ip)
+		}
+	}
+	if len(dns) > 0 {
+		mods = append(mods, dhcpv4.WithOption(dhcpv4.OptDNS(dns...)))
+	}
+	if len(c.DNS.Search) > 0 {
+		mods = append(mods, dhcpv4.WithDomainSearchList(c.DNS.Search...))
+	}
+	if c.Hostname != "" {
+		mods = append(mods, dhcpv4.WithOption(dhcpv4.OptHostName(c.Hostname)))
+	}
+
+	m, err := dhcpv4.New(mods...)
+	if err != nil {
+		return nil, err
+	}
+	m.OpCode = dhcpv4.OpcodeBootReply
+	m.BootFileName = bootFile
+	return dhclient.NewPacket4(link, m), nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dump returns c as JSON, for error messages.
+func dump(c *Config) string {
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+func TestParse(t *testing.T) {
+	want := &Config{
+		Hostname: "node1",
+		Interfaces: []*Interface{
+			{
+				Name: "bond0",
+				Bond: &Bond{Mode: "802.3ad", Slaves: []string{"eth0", "eth1"}},
+			},
+			{
+				Name:      "bond0.5",
+				VLAN:      &VLAN{Link: "bond0", ID: 5},
+				Addresses: []string{"10.0.5.2/24", "fd00:5::2/64"},
+				Routes:    []*Route{{To: "default", Via: "10.0.5.1", Metric: 10}},
+			},
+			{
+				Name:  "eth2",
+				DHCP4: true,
+				MTU:   9000,
+			},
+		},
+		Routes: []*Route{{To: "192.168.0.0/16", Dev: "eth2"}},
+		DNS: DNS{
+			Servers: []string{"10.0.5.1"},
+			Search:  []string{"example.com"},
+		},
+	}
+
+	for _, tt := range []struct {
+		name string
+		data string
+	}{
+		{
+			name: "yaml",
+			data: `
+hostname: node1
+interfaces:
+- name: bond0
+  bond:
+    mode: 802.3ad
+    slaves: [eth0, eth1]
+- name: bond0.5
+  vlan:
+    link: bond0
+    id: 5
+  addresses: [10.0.5.2/24, "fd00:5::2/64"]
+  routes:
+  - to: default
+    via: 10.0.5.1
+    metric: 10
+- name: eth2
+  dhcp4: true
+  mtu: 9000
+routes:
+- to: 192.168.0.0/16
+  dev: eth2
+dns:
+  servers: [10.0.5.1]
+  search: [example.com]
+`,
+		},
+		{
+			name: "json",
+			data: `{
+  "hostname": "node1",
+  "interfaces": [
+    {"name": "bond0", "bond": {"mode": "802.3ad", "slaves": ["eth0", "eth1"]}},
+    {
+      "name": "bond0.5",
+      "vlan": {"link": "bond0", "id": 5},
+      "addresses": ["10.0.5.2/24", "fd00:5::2/64"],
+      "routes": [{"to": "default", "via": "10.0.5.1", "metric": 10}]
+    },
+    {"name": "eth2", "dhcp4": true, "mtu": 9000}
+  ],
+  "routes": [{"to": "192.168.0.0/16", "dev": "eth2"}],
+  "dns": {"servers": ["10.0.5.1"], "search": ["example.com"]}
+}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse() = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse() = %s, want %s", dump(got), dump(want))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		err  string
+	}{
+		{
+			data: "interfaces:\n- name: eth0\n  adresses: [10.0.0.2/24]\n",
+			err:  "field adresses not found",
+		},
+		{
+			data: "interfaces:\n- name: eth0\n  addresses: [10.0.0.2]\n",
+			err:  "invalid CIDR address",
+		},
+		{
+			data: "interfaces:\n- name: eth0\n- name: eth0\n",
+			err:  `interface "eth0" configured twice`,
+		},
+		{
+			data: "interfaces:\n- name: br0\n  bond: {slaves: [eth0]}\n  bridge: {ports: [eth1]}\n",
+			err:  "only one of vlan, bond and bridge",
+		},
+		{
+			data: "interfaces:\n- bridge: {ports: [eth1]}\n",
+			err:  "virtual interfaces need a name",
+		},
+		{
+			data: "interfaces:\n- name: eth0\n  routes:\n  - to: default\n",
+			err:  "default route has no gateway",
+		},
+		{
+			data: "routes:\n- to: 10.0.0.0/8\n",
+			err:  "neither gateway nor dev",
+		},
+		{
+			data: "dns:\n  servers: [ns.example.com]\n",
+			err:  "invalid DNS server",
+		},
+	} {
+		_, err := Parse([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) = %v, want error containing %q", tt.data, err, tt.err)
+		}
+	}
+}
+
+func TestWithoutDHCP(t *testing.T) {
+	c := &Config{Interfaces: []*Interface{
+		{Name: "eth0", Addresses: []string{"10.0.0.2/24"}},
+		{Name: "eth1", DHCP4: true, DHCP6: true},
+	}}
+	if !c.HasDHCP() {
+		t.Errorf("HasDHCP() = false, want true")
+	}
+	static := c.WithoutDHCP()
+	if static.HasDHCP() {
+		t.Errorf("WithoutDHCP().HasDHCP() = true, want false")
+	}
+	if len(static.Interfaces) != 2 || !static.Interfaces[0].Static() {
+		t.Errorf("WithoutDHCP() = %s, want both interfaces", dump(static))
+	}
+	if !c.Interfaces[1].DHCP4 {
+		t.Errorf("WithoutDHCP() changed the original config")
+	}
+}
@@ -46,22 +46,25 @@ func (p *Pty) Command(cmd string, args ...string) {
 // Start starts Command attached to a Pty. It sets
 // window size and other variables as needed. It does not
 // block.
+//
+// If the Pty has no TTY, the Pts keeps its default mode and
+// window size.
 func (p *Pty) Start() error {
-	tty, err := termios.New()
-	if err != nil {
-		return err
-	}
-
-	if p.WS, err = tty.GetWinSize(); err != nil {
-		return err
-	}
+	if p.TTY != nil {
+		var err error
+		if p.WS, err = p.TTY.GetWinSize(); err != nil {
+			return err
+		}
 
-	if p.Restorer, err = tty.Raw(); err != nil {
-		return err
+		if p.Restorer, err = p.TTY.Raw(); err != nil {
+			return err
+		}
 	}
 
 	if err := p.C.Start(); err != nil {
-		tty.Set(p.Restorer)
+		if p.TTY != nil {
+			p.TTY.Set(p.Restorer)
+		}
 		return err
 	}
 	p.Kid = p.C.Process.Pid
@@ -69,8 +72,10 @@ func (p *Pty) Start() error {
 	// We make a good faith effort to set the
 	// WinSize of the Pts, but it's not a deal breaker
 	// if we can't do it.
-	if err := termios.SetWinSize(p.Pts.Fd(), p.WS); err != nil {
-		fmt.Fprintf(p.C.Stderr, "SetWinSize of Pts: %v", err)
+	if p.WS != nil {
+		if err := termios.SetWinSize(p.Pts.Fd(), p.WS); err != nil {
+			fmt.Fprintf(p.C.Stderr, "SetWinSize of Pts: %v", err)
+		}
 	}
 
 	return nil
@@ -78,19 +83,27 @@ func (p *Pty) Start() error {
 
 // Run runs a Command attached to a Pty, waiting for completion and
 // managing stdio. It uses Wait to restore tty modes when it is done.
+//
+// If the Pty has no TTY, the Command's I/O is relayed to and from
+// os.Stdout and os.Stdin instead.
 func (p *Pty) Run() error {
 	if err := p.Start(); err != nil {
 		return err
 	}
 
-	go io.Copy(p.TTY, p.Ptm)
+	var in io.Reader = os.Stdin
+	var out io.Writer = os.Stdout
+	if p.TTY != nil {
+		in, out = p.TTY, p.TTY
+	}
+	go io.Copy(out, p.Ptm)
 
 	// The 1 byte for IO may seem weird, but ptys are for human interaction
 	// and, let's face it, we don't all type fast.
 	go func() {
 		var data [1]byte
 		for {
-			if _, err := p.TTY.Read(data[:]); err != nil {
+			if _, err := in.Read(data[:]); err != nil {
 				return
 			}
 			// Log the error but it may be transient.
@@ -102,9 +115,18 @@ func (p *Pty) Run() error {
 	return p.Wait()
 }
 
+// SetWinSize sets the window size of the Pty, e.g. when a remote
+// terminal is resized. The kernel signals the Command with SIGWINCH.
+// It works through the Ptm, so it works after the Pts is closed.
+func (p *Pty) SetWinSize(ws *termios.Winsize) error {
+	return termios.SetWinSize(p.Ptm.Fd(), ws)
+}
+
 // Wait waits for a previously started command to finish, and restores the
 // tty mode when it is done.
 func (p *Pty) Wait() error {
-	defer p.TTY.Set(p.Restorer)
+	if p.TTY != nil {
+		defer p.TTY.Set(p.Restorer)
+	}
 	return p.C.Wait()
 }
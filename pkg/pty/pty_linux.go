@@ -12,22 +12,29 @@
 package pty
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"syscall"
 	"unsafe"
 
 	"github.com/u-root/u-root/pkg/termios"
+	"golang.org/x/sys/unix"
 )
 
 // New returns a new Pty.
+//
+// Daemons like sshd have no controlling terminal. Their Pty has no TTY,
+// and they can only use its Ptm.
 func New() (*Pty, error) {
+	var restorer *termios.Termios
 	tty, err := termios.New()
-	if err != nil {
-		return nil, err
-	}
-	restorer, err := tty.Get()
-	if err != nil {
+	switch {
+	case err == nil:
+		if restorer, err = tty.Get(); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, unix.ENXIO):
 		return nil, err
 	}
 
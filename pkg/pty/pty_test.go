@@ -13,6 +13,8 @@ import (
 	"os"
 	"reflect"
 	"testing"
+
+	"github.com/u-root/u-root/pkg/termios"
 )
 
 func TestNew(t *testing.T) {
@@ -38,20 +40,24 @@ func TestRunRestoreTTYMode(t *testing.T) {
 	if err := p.Wait(); err != nil {
 		t.Error(err)
 	}
-	ti, err := p.TTY.Get()
-	if err != nil {
-		t.Fatalf("TestStart Get: want nil, got %v", err)
-	}
-	if !reflect.DeepEqual(ti, p.Restorer) {
-		tt, err := json.Marshal(ti)
+	// Without a controlling terminal, there is no tty mode to restore,
+	// but the command still runs on the pts.
+	if p.TTY != nil {
+		ti, err := p.TTY.Get()
 		if err != nil {
-			t.Fatalf("Can't marshall %v: %v", ti, err)
+			t.Fatalf("TestStart Get: want nil, got %v", err)
 		}
-		r, err := json.Marshal(p.Restorer)
-		if err != nil {
-			t.Fatalf("Can't marshall %v: %v", p.Restorer, err)
+		if !reflect.DeepEqual(ti, p.Restorer) {
+			tt, err := json.Marshal(ti)
+			if err != nil {
+				t.Fatalf("Can't marshall %v: %v", ti, err)
+			}
+			r, err := json.Marshal(p.Restorer)
+			if err != nil {
+				t.Fatalf("Can't marshall %v: %v", p.Restorer, err)
+			}
+			t.Errorf("TestStart: want termios from Get %s to be the same as termios from Start (%s) to be the same, they differ", tt, r)
 		}
-		t.Errorf("TestStart: want termios from Get %s to be the same as termios from Start (%s) to be the same, they differ", tt, r)
 	}
 	b := make([]byte, 1024)
 	n, err := p.Ptm.Read(b)
@@ -66,3 +72,25 @@ func TestRunRestoreTTYMode(t *testing.T) {
 		t.Errorf("bogus returned data: got %q, want %q", string(b[:n]), "hi\r\n")
 	}
 }
+
+func TestSetWinSize(t *testing.T) {
+	p, err := New()
+	if os.IsNotExist(err) {
+		t.Skipf("Failed to allocate /dev/pts device")
+	} else if err != nil {
+		t.Fatalf("New pty: want nil, got %v", err)
+	}
+
+	ws := &termios.Winsize{}
+	ws.Row, ws.Col = 42, 123
+	if err := p.SetWinSize(ws); err != nil {
+		t.Fatalf("SetWinSize: want nil, got %v", err)
+	}
+	got, err := termios.GetWinSize(p.Pts.Fd())
+	if err != nil {
+		t.Fatalf("GetWinSize: want nil, got %v", err)
+	}
+	if got.Row != ws.Row || got.Col != ws.Col {
+		t.Errorf("Pts window size: got %dx%d, want %dx%d", got.Col, got.Row, ws.Col, ws.Row)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qemu
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Arch is how QEMU emulates a machine of one GOARCH that boots Linux.
+type Arch struct {
+	// Binary is the QEMU system emulator.
+	Binary string
+
+	// Machine are the arguments choosing the machine, CPU and memory.
+	Machine []string
+
+	// KernelArgs send the kernel's console to the serial port QEMU
+	// writes to its standard output.
+	KernelArgs string
+}
+
+// Arches are the machines the integration tests boot, by GOARCH.
+var Arches = map[string]Arch{
+	"amd64": {
+		Binary:     "qemu-system-x86_64",
+		Machine:    []string{"-m", "1G"},
+		KernelArgs: "console=ttyS0 earlyprintk=ttyS0",
+	},
+	"arm": {
+		Binary:     "qemu-system-arm",
+		Machine:    []string{"-M", "virt", "-cpu", "cortex-a15", "-m", "1G"},
+		KernelArgs: "console=ttyAMA0",
+	},
+	"arm64": {
+		Binary:     "qemu-system-aarch64",
+		Machine:    []string{"-M", "virt", "-cpu", "cortex-a57", "-m", "1G"},
+		KernelArgs: "console=ttyAMA0",
+	},
+	"riscv64": {
+		Binary:     "qemu-system-riscv64",
+		Machine:    []string{"-M", "virt", "-bios", "default", "-m", "1G"},
+		KernelArgs: "console=ttyS0",
+	},
+	"ppc64le": {
+		Binary:     "qemu-system-ppc64",
+		Machine:    []string{"-M", "pseries", "-cpu", "POWER9", "-m", "1G"},
+		KernelArgs: "console=hvc0",
+	},
+}
+
+// ArchCmdline returns the QEMU binary and its first arguments for booting
+// goarch.
+//
+// The environment variable UROOT_QEMU_<GOARCH>, e.g. UROOT_QEMU_ARM64,
+// overrides the defaults from Arches like UROOT_QEMU does for Options.
+func ArchCmdline(goarch string) ([]string, error) {
+	if env := os.Getenv("UROOT_QEMU_" + strings.ToUpper(goarch)); env != "" {
+		return strings.Fields(env), nil
+	}
+	a, ok := Arches[goarch]
+	if !ok {
+		return nil, fmt.Errorf("no QEMU machine for GOARCH %q", goarch)
+	}
+	return append([]string{a.Binary}, a.Machine...), nil
+}
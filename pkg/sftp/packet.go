@@ -0,0 +1,232 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+var errShortPacket = errors.New("packet too short")
+
+// decoder reads the fields of a packet. The first error sticks, so that a
+// request can be decoded completely before checking it.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShortPacket
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) attrs() *attrs {
+	a := &attrs{flags: d.uint32()}
+	if a.flags&attrSize != 0 {
+		a.size = d.uint64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		a.uid, a.gid = d.uint32(), d.uint32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.perms = d.uint32()
+	}
+	if a.flags&attrACModTime != 0 {
+		a.atime, a.mtime = d.uint32(), d.uint32()
+	}
+	if a.flags&attrExtended != 0 {
+		// We know no extended attributes.
+		for n := d.uint32(); n > 0 && d.err == nil; n-- {
+			d.string()
+			d.string()
+		}
+	}
+	return a
+}
+
+// encoder builds a packet, leaving room for its length.
+type encoder struct {
+	b []byte
+}
+
+func newPacket(typ byte, id uint32) *encoder {
+	e := &encoder{b: make([]byte, 4, 64)}
+	e.byte(typ)
+	e.uint32(id)
+	return e
+}
+
+func (e *encoder) byte(v byte) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.b = append(e.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.uint32(uint32(v >> 32))
+	e.uint32(uint32(v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) attrs(a *attrs) {
+	e.uint32(a.flags)
+	if a.flags&attrSize != 0 {
+		e.uint64(a.size)
+	}
+	if a.flags&attrUIDGID != 0 {
+		e.uint32(a.uid)
+		e.uint32(a.gid)
+	}
+	if a.flags&attrPermissions != 0 {
+		e.uint32(a.perms)
+	}
+	if a.flags&attrACModTime != 0 {
+		e.uint32(a.atime)
+		e.uint32(a.mtime)
+	}
+}
+
+// bytes returns the packet with its length.
+func (e *encoder) bytes() []byte {
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+	return e.b
+}
+
+// Attribute flags.
+const (
+	attrSize        = 0x00000001
+	attrUIDGID      = 0x00000002
+	attrPermissions = 0x00000004
+	attrACModTime   = 0x00000008
+	attrExtended    = 0x80000000
+)
+
+// attrs are the attributes of a file. flags says which are set.
+type attrs struct {
+	flags        uint32
+	size         uint64
+	uid, gid     uint32
+	perms        uint32
+	atime, mtime uint32
+}
+
+// POSIX file types and mode bits, which SFTP uses for permissions.
+const (
+	modeFIFO   = 0010000
+	modeChar   = 0020000
+	modeDir    = 0040000
+	modeBlock  = 0060000
+	modeFile   = 0100000
+	modeLink   = 0120000
+	modeSocket = 0140000
+	modeSetuid = 0004000
+	modeSetgid = 0002000
+	modeSticky = 0001000
+)
+
+func fromFileMode(m os.FileMode) uint32 {
+	p := uint32(m.Perm())
+	switch {
+	case m.IsDir():
+		p |= modeDir
+	case m&os.ModeSymlink != 0:
+		p |= modeLink
+	case m&os.ModeNamedPipe != 0:
+		p |= modeFIFO
+	case m&os.ModeSocket != 0:
+		p |= modeSocket
+	case m&os.ModeCharDevice != 0:
+		p |= modeChar
+	case m&os.ModeDevice != 0:
+		p |= modeBlock
+	default:
+		p |= modeFile
+	}
+	if m&os.ModeSetuid != 0 {
+		p |= modeSetuid
+	}
+	if m&os.ModeSetgid != 0 {
+		p |= modeSetgid
+	}
+	if m&os.ModeSticky != 0 {
+		p |= modeSticky
+	}
+	return p
+}
+
+// toFileMode returns the permissions of p, for chmod.
+func toFileMode(p uint32) os.FileMode {
+	m := os.FileMode(p & 0777)
+	if p&modeSetuid != 0 {
+		m |= os.ModeSetuid
+	}
+	if p&modeSetgid != 0 {
+		m |= os.ModeSetgid
+	}
+	if p&modeSticky != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+func fileAttrs(fi os.FileInfo) *attrs {
+	a := &attrs{
+		flags: attrSize | attrPermissions | attrACModTime,
+		size:  uint64(fi.Size()),
+		perms: fromFileMode(fi.Mode()),
+		atime: uint32(fi.ModTime().Unix()),
+		mtime: uint32(fi.ModTime().Unix()),
+	}
+	if s, ok := sysStat(fi); ok {
+		a.flags |= attrUIDGID
+		a.uid, a.gid = s.uid, s.gid
+		a.atime = uint32(s.atime)
+	}
+	return a
+}
+
+// sysInfo is what the system tells about a file beyond os.FileInfo.
+type sysInfo struct {
+	uid, gid uint32
+	nlink    uint64
+	atime    int64
+}
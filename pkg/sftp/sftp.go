@@ -0,0 +1,634 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sftp implements the server side of the SSH File Transfer Protocol,
+// version 3, as described in draft-ietf-secsh-filexfer-02 and implemented by
+// OpenSSH.
+//
+// A Server serves the local file system to a single client, one request at a
+// time, on e.g. an SSH channel of the "sftp" subsystem. Relative paths are
+// relative to the working directory of the process.
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Packet types.
+const (
+	fxpInit          = 1
+	fxpVersion       = 2
+	fxpOpen          = 3
+	fxpClose         = 4
+	fxpRead          = 5
+	fxpWrite         = 6
+	fxpLstat         = 7
+	fxpFstat         = 8
+	fxpSetstat       = 9
+	fxpFsetstat      = 10
+	fxpOpendir       = 11
+	fxpReaddir       = 12
+	fxpRemove        = 13
+	fxpMkdir         = 14
+	fxpRmdir         = 15
+	fxpRealpath      = 16
+	fxpStat          = 17
+	fxpRename        = 18
+	fxpReadlink      = 19
+	fxpSymlink       = 20
+	fxpStatus        = 101
+	fxpHandle        = 102
+	fxpData          = 103
+	fxpName          = 104
+	fxpAttrs         = 105
+	fxpExtended      = 200
+	fxpExtendedReply = 201
+)
+
+// Status codes.
+const (
+	statusOK               = 0
+	statusEOF              = 1
+	statusNoSuchFile       = 2
+	statusPermissionDenied = 3
+	statusFailure          = 4
+	statusBadMessage       = 5
+	statusOpUnsupported    = 8
+)
+
+// Open flags.
+const (
+	openRead   = 0x01
+	openWrite  = 0x02
+	openAppend = 0x04
+	openCreat  = 0x08
+	openTrunc  = 0x10
+	openExcl   = 0x20
+)
+
+const (
+	version = 3
+
+	// maxPacket is the largest packet we take, like OpenSSH.
+	maxPacket = 256 * 1024
+
+	// maxData is the most data we return for a read.
+	maxData = maxPacket - 1024
+
+	// dirEntries is the most directory entries we return for a readdir.
+	dirEntries = 128
+)
+
+var (
+	errBadHandle   = errors.New("invalid handle")
+	errUnsupported = errors.New("operation unsupported")
+	errExists      = errors.New("file exists")
+	errIsDir       = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+)
+
+type handle struct {
+	f      *os.File
+	dir    bool
+	append bool
+}
+
+// Server is an SFTP server.
+type Server struct {
+	rw      io.ReadWriter
+	handles map[string]*handle
+	next    uint64
+}
+
+// NewServer returns a Server for the client at the other end of rw.
+func NewServer(rw io.ReadWriter) *Server {
+	return &Server{
+		rw:      rw,
+		handles: make(map[string]*handle),
+	}
+}
+
+// Serve serves requests until the client goes away, and closes the files
+// it left open. Serve returns nil if the client closed the connection.
+func (s *Server) Serve() error {
+	defer func() {
+		for _, h := range s.handles {
+			h.f.Close()
+		}
+		s.handles = make(map[string]*handle)
+	}()
+
+	for {
+		p, err := s.readPacket()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := s.rw.Write(s.respond(p)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) readPacket() ([]byte, error) {
+	var l [4]byte
+	if _, err := io.ReadFull(s.rw, l[:]); err != nil {
+		return nil, err
+	}
+	d := decoder{b: l[:]}
+	n := d.uint32()
+	if n == 0 || n > maxPacket {
+		return nil, fmt.Errorf("bad packet length %d", n)
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(s.rw, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// respond returns the response to request p.
+func (s *Server) respond(p []byte) []byte {
+	d := &decoder{b: p[1:]}
+	if p[0] == fxpInit {
+		// We speak version 3 whatever the client does.
+		r := newPacket(fxpVersion, version)
+		r.string("posix-rename@openssh.com")
+		r.string("1")
+		return r.bytes()
+	}
+
+	id := d.uint32()
+	switch p[0] {
+	case fxpOpen:
+		name, pflags, a := d.string(), d.uint32(), d.attrs()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		return s.open(id, name, pflags, a)
+
+	case fxpClose:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		h, err := s.handle(name)
+		if err != nil {
+			return status(id, err)
+		}
+		delete(s.handles, name)
+		return status(id, h.f.Close())
+
+	case fxpRead:
+		name, off, n := d.string(), d.uint64(), d.uint32()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		h, err := s.handle(name)
+		if err != nil {
+			return status(id, err)
+		}
+		return read(id, h, int64(off), n)
+
+	case fxpWrite:
+		name, off, data := d.string(), d.uint64(), d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		h, err := s.handle(name)
+		if err != nil {
+			return status(id, err)
+		}
+		if h.append {
+			_, err = h.f.WriteString(data)
+		} else {
+			_, err = h.f.WriteAt([]byte(data), int64(off))
+		}
+		return status(id, err)
+
+	case fxpLstat, fxpStat:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		stat := os.Stat
+		if p[0] == fxpLstat {
+			stat = os.Lstat
+		}
+		fi, err := stat(name)
+		if err != nil {
+			return status(id, err)
+		}
+		return attrsPacket(id, fi)
+
+	case fxpFstat:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		h, err := s.handle(name)
+		if err != nil {
+			return status(id, err)
+		}
+		fi, err := h.f.Stat()
+		if err != nil {
+			return status(id, err)
+		}
+		return attrsPacket(id, fi)
+
+	case fxpSetstat:
+		name, a := d.string(), d.attrs()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		return status(id, setstat(name, a))
+
+	case fxpFsetstat:
+		name, a := d.string(), d.attrs()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		h, err := s.handle(name)
+		if err != nil {
+			return status(id, err)
+		}
+		return status(id, fsetstat(h.f, a))
+
+	case fxpOpendir:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		return s.opendir(id, name)
+
+	case fxpReaddir:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		h, err := s.handle(name)
+		if err != nil {
+			return status(id, err)
+		}
+		if !h.dir {
+			return status(id, errNotDir)
+		}
+		return readdir(id, h)
+
+	case fxpRemove:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		fi, err := os.Lstat(name)
+		if err != nil {
+			return status(id, err)
+		}
+		if fi.IsDir() {
+			return status(id, errIsDir)
+		}
+		return status(id, os.Remove(name))
+
+	case fxpMkdir:
+		name, a := d.string(), d.attrs()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		perm := os.FileMode(0777)
+		if a.flags&attrPermissions != 0 {
+			perm = toFileMode(a.perms)
+		}
+		return status(id, os.Mkdir(name, perm))
+
+	case fxpRmdir:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		fi, err := os.Lstat(name)
+		if err != nil {
+			return status(id, err)
+		}
+		if !fi.IsDir() {
+			return status(id, errNotDir)
+		}
+		return status(id, os.Remove(name))
+
+	case fxpRealpath:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		if name == "" {
+			name = "."
+		}
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return status(id, err)
+		}
+		return namePacket(id, abs)
+
+	case fxpRename:
+		from, to := d.string(), d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		// Version 3 renames do not replace files; posix-rename does.
+		if _, err := os.Lstat(to); err == nil {
+			return status(id, errExists)
+		}
+		return status(id, os.Rename(from, to))
+
+	case fxpReadlink:
+		name := d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		target, err := os.Readlink(name)
+		if err != nil {
+			return status(id, err)
+		}
+		return namePacket(id, target)
+
+	case fxpSymlink:
+		// OpenSSH has the arguments the other way around from the
+		// draft, and every client follows OpenSSH.
+		target, link := d.string(), d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		return status(id, os.Symlink(target, link))
+
+	case fxpExtended:
+		ext := d.string()
+		if ext != "posix-rename@openssh.com" {
+			return status(id, errUnsupported)
+		}
+		from, to := d.string(), d.string()
+		if d.err != nil {
+			return status(id, d.err)
+		}
+		return status(id, os.Rename(from, to))
+	}
+	return status(id, errUnsupported)
+}
+
+func (s *Server) handle(name string) (*handle, error) {
+	h, ok := s.handles[name]
+	if !ok {
+		return nil, errBadHandle
+	}
+	return h, nil
+}
+
+func (s *Server) newHandle(h *handle) []byte {
+	s.next++
+	name := strconv.FormatUint(s.next, 10)
+	s.handles[name] = h
+	return []byte(name)
+}
+
+func (s *Server) open(id uint32, name string, pflags uint32, a *attrs) []byte {
+	var flags int
+	switch {
+	case pflags&openRead != 0 && pflags&openWrite != 0:
+		flags = os.O_RDWR
+	case pflags&openWrite != 0:
+		flags = os.O_WRONLY
+	default:
+		flags = os.O_RDONLY
+	}
+	if pflags&openAppend != 0 {
+		flags |= os.O_APPEND
+	}
+	if pflags&openCreat != 0 {
+		flags |= os.O_CREATE
+	}
+	if pflags&openTrunc != 0 {
+		flags |= os.O_TRUNC
+	}
+	if pflags&openExcl != 0 {
+		flags |= os.O_EXCL
+	}
+	perm := os.FileMode(0666)
+	if a.flags&attrPermissions != 0 {
+		perm = toFileMode(a.perms)
+	}
+
+	f, err := os.OpenFile(name, flags, perm)
+	if err != nil {
+		return status(id, err)
+	}
+	r := newPacket(fxpHandle, id)
+	r.string(string(s.newHandle(&handle{f: f, append: pflags&openAppend != 0})))
+	return r.bytes()
+}
+
+func (s *Server) opendir(id uint32, name string) []byte {
+	f, err := os.Open(name)
+	if err != nil {
+		return status(id, err)
+	}
+	fi, err := f.Stat()
+	if err == nil && !fi.IsDir() {
+		err = errNotDir
+	}
+	if err != nil {
+		f.Close()
+		return status(id, err)
+	}
+	r := newPacket(fxpHandle, id)
+	r.string(string(s.newHandle(&handle{f: f, dir: true})))
+	return r.bytes()
+}
+
+func read(id uint32, h *handle, off int64, n uint32) []byte {
+	if n > maxData {
+		n = maxData
+	}
+	b := make([]byte, n)
+	m, err := h.f.ReadAt(b, off)
+	if m == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return status(id, err)
+	}
+	r := newPacket(fxpData, id)
+	r.string(string(b[:m]))
+	return r.bytes()
+}
+
+func readdir(id uint32, h *handle) []byte {
+	fis, err := h.f.Readdir(dirEntries)
+	if len(fis) == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return status(id, err)
+	}
+	r := newPacket(fxpName, id)
+	r.uint32(uint32(len(fis)))
+	for _, fi := range fis {
+		r.string(fi.Name())
+		r.string(longName(fi))
+		r.attrs(fileAttrs(fi))
+	}
+	return r.bytes()
+}
+
+func setstat(name string, a *attrs) error {
+	if a.flags&attrSize != 0 {
+		if err := os.Truncate(name, int64(a.size)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrPermissions != 0 {
+		if err := os.Chmod(name, toFileMode(a.perms)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrACModTime != 0 {
+		if err := os.Chtimes(name, time.Unix(int64(a.atime), 0), time.Unix(int64(a.mtime), 0)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrUIDGID != 0 {
+		if err := os.Chown(name, int(a.uid), int(a.gid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fsetstat(f *os.File, a *attrs) error {
+	if a.flags&attrSize != 0 {
+		if err := f.Truncate(int64(a.size)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrPermissions != 0 {
+		if err := f.Chmod(toFileMode(a.perms)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrACModTime != 0 {
+		if err := os.Chtimes(f.Name(), time.Unix(int64(a.atime), 0), time.Unix(int64(a.mtime), 0)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrUIDGID != 0 {
+		if err := f.Chown(int(a.uid), int(a.gid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func status(id uint32, err error) []byte {
+	code := uint32(statusOK)
+	msg := "Success"
+	if err != nil {
+		msg = err.Error()
+		switch {
+		case err == io.EOF:
+			code, msg = statusEOF, "End of file"
+		case err == errShortPacket:
+			code = statusBadMessage
+		case err == errUnsupported:
+			code = statusOpUnsupported
+		case os.IsNotExist(err):
+			code = statusNoSuchFile
+		case os.IsPermission(err):
+			code = statusPermissionDenied
+		default:
+			code = statusFailure
+		}
+	}
+	r := newPacket(fxpStatus, id)
+	r.uint32(code)
+	r.string(msg)
+	r.string("")
+	return r.bytes()
+}
+
+func attrsPacket(id uint32, fi os.FileInfo) []byte {
+	r := newPacket(fxpAttrs, id)
+	r.attrs(fileAttrs(fi))
+	return r.bytes()
+}
+
+// namePacket returns a name response for a single name, as to realpath and
+// readlink.
+func namePacket(id uint32, name string) []byte {
+	r := newPacket(fxpName, id)
+	r.uint32(1)
+	r.string(name)
+	r.string(name)
+	r.attrs(&attrs{})
+	return r.bytes()
+}
+
+// longName returns the ls -l line for fi that clients show.
+func longName(fi os.FileInfo) string {
+	var uid, gid uint32
+	nlink := uint64(1)
+	if s, ok := sysStat(fi); ok {
+		uid, gid, nlink = s.uid, s.gid, s.nlink
+	}
+	t := fi.ModTime()
+	date := t.Format("Jan _2 15:04")
+	if time.Since(t) > 180*24*time.Hour || time.Until(t) > 24*time.Hour {
+		date = t.Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s %4d %-8d %-8d %8d %s %s", lsMode(fromFileMode(fi.Mode())), nlink, uid, gid, fi.Size(), date, fi.Name())
+}
+
+// lsMode returns POSIX mode p the way ls shows it.
+func lsMode(p uint32) string {
+	b := []byte("-rwxrwxrwx")
+	switch p & 0170000 {
+	case modeDir:
+		b[0] = 'd'
+	case modeLink:
+		b[0] = 'l'
+	case modeFIFO:
+		b[0] = 'p'
+	case modeSocket:
+		b[0] = 's'
+	case modeChar:
+		b[0] = 'c'
+	case modeBlock:
+		b[0] = 'b'
+	}
+	for i := uint(0); i < 9; i++ {
+		if p&(1<<(8-i)) == 0 {
+			b[i+1] = '-'
+		}
+	}
+	special := func(i int, set bool, c byte) {
+		if !set {
+			return
+		}
+		if b[i] == '-' {
+			c -= 'a' - 'A'
+		}
+		b[i] = c
+	}
+	special(3, p&modeSetuid != 0, 's')
+	special(6, p&modeSetgid != 0, 's')
+	special(9, p&modeSticky != 0, 't')
+	return string(b)
+}
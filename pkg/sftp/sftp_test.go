@@ -0,0 +1,307 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+type pipe struct {
+	io.Reader
+	io.Writer
+}
+
+// client is just enough of an SFTP client to test the server.
+type client struct {
+	t    *testing.T
+	rw   io.ReadWriter
+	id   uint32
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	c := &client{t: t, rw: pipe{cr, cw}, done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(pipe{sr, sw}).Serve()
+		sw.Close()
+	}()
+	return c
+}
+
+func (c *client) close() {
+	c.rw.(pipe).Writer.(*io.PipeWriter).Close()
+	if err := <-c.done; err != nil {
+		c.t.Errorf("Serve() = %v, want nil", err)
+	}
+}
+
+// call sends request typ with the fields of e, and returns the response
+// type and fields.
+func (c *client) call(typ byte, e *encoder) (byte, *decoder) {
+	c.t.Helper()
+	c.id++
+	p := newPacket(typ, c.id)
+	if typ == fxpInit {
+		p = newPacket(typ, version)
+	}
+	p.b = append(p.b, e.b...)
+	if _, err := c.rw.Write(p.bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+
+	s := &Server{rw: c.rw}
+	r, err := s.readPacket()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	d := &decoder{b: r[1:]}
+	if r[0] != fxpVersion {
+		if id := d.uint32(); id != c.id {
+			c.t.Fatalf("response id %d, want %d", id, c.id)
+		}
+	}
+	return r[0], d
+}
+
+func args(strs ...string) *encoder {
+	e := &encoder{}
+	for _, s := range strs {
+		e.string(s)
+	}
+	return e
+}
+
+// status calls a request that returns a status, and checks the status.
+func (c *client) status(want uint32, typ byte, e *encoder) {
+	c.t.Helper()
+	rt, d := c.call(typ, e)
+	if rt != fxpStatus {
+		c.t.Fatalf("request %d: got response %d, want status", typ, rt)
+	}
+	if code, msg := d.uint32(), d.string(); code != want {
+		c.t.Fatalf("request %d: got status %d (%s), want %d", typ, code, msg, want)
+	}
+}
+
+func (c *client) handle(typ byte, e *encoder) string {
+	c.t.Helper()
+	rt, d := c.call(typ, e)
+	if rt != fxpHandle {
+		c.t.Fatalf("request %d: got response %d (status %d), want handle", typ, rt, d.uint32())
+	}
+	return d.string()
+}
+
+func (c *client) attrs(typ byte, e *encoder) *attrs {
+	c.t.Helper()
+	rt, d := c.call(typ, e)
+	if rt != fxpAttrs {
+		c.t.Fatalf("request %d: got response %d (status %d), want attrs", typ, rt, d.uint32())
+	}
+	return d.attrs()
+}
+
+func (c *client) names(typ byte, e *encoder) []string {
+	c.t.Helper()
+	rt, d := c.call(typ, e)
+	if rt != fxpName {
+		c.t.Fatalf("request %d: got response %d (status %d), want name", typ, rt, d.uint32())
+	}
+	var names []string
+	for n := d.uint32(); n > 0; n-- {
+		names = append(names, d.string())
+		d.string()
+		d.attrs()
+	}
+	if d.err != nil {
+		c.t.Fatal(d.err)
+	}
+	return names
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+
+	c := newClient(t)
+	defer c.close()
+
+	rt, d := c.call(fxpInit, &encoder{})
+	if v := d.uint32(); rt != fxpVersion || v != version {
+		t.Fatalf("init: got response %d version %d, want %d version %d", rt, v, fxpVersion, version)
+	}
+
+	// Write a file.
+	e := args(file)
+	e.uint32(openWrite | openCreat | openTrunc)
+	e.attrs(&attrs{flags: attrPermissions, perms: 0640})
+	h := c.handle(fxpOpen, e)
+	e = args(h)
+	e.uint64(0)
+	e.string("hello ")
+	c.status(statusOK, fxpWrite, e)
+	e = args(h)
+	e.uint64(6)
+	e.string("world")
+	c.status(statusOK, fxpWrite, e)
+	if a := c.attrs(fxpFstat, args(h)); a.size != 11 {
+		t.Errorf("fstat: size %d, want 11", a.size)
+	}
+	c.status(statusOK, fxpClose, args(h))
+	c.status(statusFailure, fxpClose, args(h))
+
+	if b, err := ioutil.ReadFile(file); err != nil || string(b) != "hello world" {
+		t.Errorf("file has %q, %v, want %q", b, err, "hello world")
+	}
+	a := c.attrs(fxpStat, args(file))
+	if a.perms != modeFile|0640 || a.size != 11 || a.flags&attrACModTime == 0 {
+		t.Errorf("stat: %+v, want regular file of 11 bytes with permissions 0640", a)
+	}
+
+	// Append to it.
+	e = args(file)
+	e.uint32(openWrite | openAppend)
+	e.attrs(&attrs{})
+	h = c.handle(fxpOpen, e)
+	e = args(h)
+	e.uint64(0)
+	e.string("!")
+	c.status(statusOK, fxpWrite, e)
+	c.status(statusOK, fxpClose, args(h))
+
+	// Read it.
+	e = args(file)
+	e.uint32(openRead)
+	e.attrs(&attrs{})
+	h = c.handle(fxpOpen, e)
+	e = args(h)
+	e.uint64(6)
+	e.uint32(1024)
+	if rt, d := c.call(fxpRead, e); rt != fxpData || d.string() != "world!" {
+		t.Errorf("read: got response %d, want data %q", rt, "world!")
+	}
+	e = args(h)
+	e.uint64(12)
+	e.uint32(1024)
+	c.status(statusEOF, fxpRead, e)
+	c.status(statusOK, fxpClose, args(h))
+
+	// Change it.
+	e = args(file)
+	e.attrs(&attrs{flags: attrSize | attrPermissions | attrACModTime, size: 5, perms: 0600, atime: 1e9, mtime: 1e9})
+	c.status(statusOK, fxpSetstat, e)
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 5 || fi.Mode() != 0600 || fi.ModTime().Unix() != 1e9 {
+		t.Errorf("after setstat: size %d, mode %v, mtime %v; want 5, 0600, %d", fi.Size(), fi.Mode(), fi.ModTime().Unix(), int64(1e9))
+	}
+
+	// Directories and links.
+	sub := filepath.Join(dir, "sub")
+	e = args(sub)
+	e.attrs(&attrs{})
+	c.status(statusOK, fxpMkdir, e)
+	link := filepath.Join(dir, "link")
+	c.status(statusOK, fxpSymlink, args("file", link))
+	if got := c.names(fxpReadlink, args(link)); len(got) != 1 || got[0] != "file" {
+		t.Errorf("readlink: %q, want [file]", got)
+	}
+	if a := c.attrs(fxpLstat, args(link)); a.perms&0170000 != modeLink {
+		t.Errorf("lstat: permissions %o, want a link", a.perms)
+	}
+
+	h = c.handle(fxpOpendir, args(dir))
+	var names []string
+	for {
+		rt, d := c.call(fxpReaddir, args(h))
+		if rt == fxpStatus {
+			if code := d.uint32(); code != statusEOF {
+				t.Fatalf("readdir: status %d, want EOF", code)
+			}
+			break
+		}
+		for n := d.uint32(); n > 0; n-- {
+			names = append(names, d.string())
+			d.string()
+			d.attrs()
+		}
+	}
+	c.status(statusOK, fxpClose, args(h))
+	sort.Strings(names)
+	if want := []string{"file", "link", "sub"}; !equal(names, want) {
+		t.Errorf("readdir: %q, want %q", names, want)
+	}
+	c.status(statusFailure, fxpOpendir, args(file))
+
+	// Rename, remove.
+	moved := filepath.Join(sub, "moved")
+	c.status(statusOK, fxpRename, args(file, moved))
+	c.status(statusFailure, fxpRename, args(link, moved))
+	c.status(statusOK, fxpExtended, args("posix-rename@openssh.com", link, moved))
+	c.status(statusFailure, fxpRmdir, args(moved))
+	c.status(statusFailure, fxpRemove, args(sub))
+	c.status(statusOK, fxpRemove, args(moved))
+	c.status(statusOK, fxpRmdir, args(sub))
+	c.status(statusNoSuchFile, fxpStat, args(sub))
+
+	if got := c.names(fxpRealpath, args(filepath.Join(dir, "a", "..", "b"))); len(got) != 1 || got[0] != filepath.Join(dir, "b") {
+		t.Errorf("realpath: %q, want [%s]", got, filepath.Join(dir, "b"))
+	}
+	c.status(statusOpUnsupported, fxpExtended, args("statvfs@openssh.com", dir))
+	c.status(statusBadMessage, fxpStat, &encoder{})
+	e = args("nonesuch")
+	e.uint64(0)
+	e.uint32(1)
+	c.status(statusFailure, fxpRead, e)
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLsMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0644, "-rw-r--r--"},
+		{os.ModeDir | 0755, "drwxr-xr-x"},
+		{os.ModeSymlink | 0777, "lrwxrwxrwx"},
+		{os.ModeSetuid | 0755, "-rwsr-xr-x"},
+		{os.ModeSetgid | 0640, "-rw-r-S---"},
+		{os.ModeDir | os.ModeSticky | 0777, "drwxrwxrwt"},
+		{os.ModeDevice | os.ModeCharDevice | 0620, "crw--w----"},
+	} {
+		if got := lsMode(fromFileMode(tt.mode)); got != tt.want {
+			t.Errorf("lsMode(%v) = %q, want %q", tt.mode, got, tt.want)
+		}
+		if tt.mode&os.ModeType == 0 {
+			if got := toFileMode(fromFileMode(tt.mode)); got != tt.mode {
+				t.Errorf("toFileMode(fromFileMode(%v)) = %v", tt.mode, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"os"
+	"syscall"
+)
+
+func sysStat(fi os.FileInfo) (sysInfo, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return sysInfo{}, false
+	}
+	return sysInfo{
+		uid:   st.Uid,
+		gid:   st.Gid,
+		nlink: uint64(st.Nlink),
+		atime: int64(st.Atim.Sec),
+	}, true
+}
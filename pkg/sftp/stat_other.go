@@ -0,0 +1,13 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package sftp
+
+import "os"
+
+func sysStat(fi os.FileInfo) (sysInfo, bool) {
+	return sysInfo{}, false
+}
@@ -9,6 +9,7 @@
 package smbios
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -40,9 +41,78 @@ func ParseInfo(entryData, tableData []byte) (*Info, error) {
 		info.Tables = append(info.Tables, t)
 		tableData = remainder
 	}
+	ver := uint16(info.MajorVersion())<<8 | uint16(info.MinorVersion())
+	for _, t := range info.Tables {
+		t.ver = ver
+	}
 	return info, nil
 }
 
+// Marshal encodes the entry point and the tables, e.g. to pass them on to
+// another kernel or to write a dump. It is the inverse of ParseInfo.
+//
+// The lengths, counts and checksums in the entry point are updated to match
+// the tables, but StructTableAddr is left to the caller, as it depends on
+// where the tables end up. An end-of-table structure is added if the tables
+// do not end with one. If there are both a 32-bit and a 64-bit entry point,
+// the 64-bit one is returned.
+func (i *Info) Marshal() (entryData, tableData []byte, err error) {
+	if i.Entry32 == nil && i.Entry64 == nil {
+		return nil, nil, errors.New("no entry point")
+	}
+	var maxSize, maxHandle int
+	for _, t := range i.Tables {
+		b, err := t.MarshalBinary()
+		if err != nil {
+			return nil, nil, fmt.Errorf("table 0x%04X: %v", t.Handle, err)
+		}
+		tableData = append(tableData, b...)
+		if len(b) > maxSize {
+			maxSize = len(b)
+		}
+		if int(t.Handle) > maxHandle {
+			maxHandle = int(t.Handle)
+		}
+	}
+	numTables := len(i.Tables)
+	if numTables == 0 || i.Tables[numTables-1].Type != TableTypeEndOfTable {
+		eot, err := NewTable(TableTypeEndOfTable, uint16(maxHandle+1), nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, _ := eot.MarshalBinary()
+		tableData = append(tableData, b...)
+		numTables++
+	}
+
+	if e := i.Entry64; e != nil {
+		copy(e.Anchor[:], "_SM3_")
+		e.Length = 0x18
+		e.Revision = 1
+		e.StructMaxSize = uint32(len(tableData))
+		if entryData, err = e.MarshalBinary(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if e := i.Entry32; e != nil {
+		if len(tableData) > 0xffff || numTables > 0xffff {
+			return nil, nil, fmt.Errorf("%d bytes in %d tables is too much for a 32-bit entry point", len(tableData), numTables)
+		}
+		copy(e.Anchor[:], "_SM_")
+		copy(e.IntAnchor[:], "_DMI_")
+		e.Length = 0x1f
+		e.StructMaxSize = uint16(maxSize)
+		e.StructTableLength = uint16(len(tableData))
+		e.NumberOfStructs = uint16(numTables)
+		if i.Entry64 == nil {
+			if entryData, err = e.MarshalBinary(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return entryData, tableData, nil
+}
+
 // MajorVersion return major version of the SMBIOS spec.
 func (i *Info) MajorVersion() uint8 {
 	if i.Entry64 != nil {
@@ -156,6 +226,71 @@ func (i *Info) GetCacheInfo() ([]*CacheInfo, error) {
 	return res, nil
 }
 
+// GetPortConnectorInfo returns all the Port Connector Info (type 8) tables present.
+func (i *Info) GetPortConnectorInfo() ([]*PortConnectorInfo, error) {
+	var res []*PortConnectorInfo
+	for _, t := range i.GetTablesByType(TableTypePortConnectorInfo) {
+		v, err := NewPortConnectorInfo(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// GetSystemSlots returns all the System Slots (type 9) tables present.
+func (i *Info) GetSystemSlots() ([]*SystemSlots, error) {
+	var res []*SystemSlots
+	for _, t := range i.GetTablesByType(TableTypeSystemSlots) {
+		v, err := NewSystemSlots(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// GetOEMStrings returns all the OEM Strings (type 11) tables present.
+func (i *Info) GetOEMStrings() ([]*OEMStrings, error) {
+	var res []*OEMStrings
+	for _, t := range i.GetTablesByType(TableTypeOEMStrings) {
+		v, err := NewOEMStrings(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// GetSystemConfigurationOptions returns all the System Configuration Options (type 12) tables present.
+func (i *Info) GetSystemConfigurationOptions() ([]*SystemConfigurationOptions, error) {
+	var res []*SystemConfigurationOptions
+	for _, t := range i.GetTablesByType(TableTypeSystemConfigurationOptions) {
+		v, err := NewSystemConfigurationOptions(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// GetPhysicalMemoryArrays returns all the Physical Memory Array (type 16) tables present.
+func (i *Info) GetPhysicalMemoryArrays() ([]*PhysicalMemoryArray, error) {
+	var res []*PhysicalMemoryArray
+	for _, t := range i.GetTablesByType(TableTypePhysicalMemoryArray) {
+		v, err := NewPhysicalMemoryArray(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
 // GetMemoryDevices returns all the Memory Device (type 17) tables present.
 func (i *Info) GetMemoryDevices() ([]*MemoryDevice, error) {
 	var res []*MemoryDevice
@@ -169,6 +304,42 @@ func (i *Info) GetMemoryDevices() ([]*MemoryDevice, error) {
 	return res, nil
 }
 
+// GetMemoryArrayMappedAddresses returns all the Memory Array Mapped Address (type 19) tables present.
+func (i *Info) GetMemoryArrayMappedAddresses() ([]*MemoryArrayMappedAddress, error) {
+	var res []*MemoryArrayMappedAddress
+	for _, t := range i.GetTablesByType(TableTypeMemoryArrayMappedAddress) {
+		v, err := NewMemoryArrayMappedAddress(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// GetMemoryDeviceMappedAddresses returns all the Memory Device Mapped Address (type 20) tables present.
+func (i *Info) GetMemoryDeviceMappedAddresses() ([]*MemoryDeviceMappedAddress, error) {
+	var res []*MemoryDeviceMappedAddress
+	for _, t := range i.GetTablesByType(TableTypeMemoryDeviceMappedAddress) {
+		v, err := NewMemoryDeviceMappedAddress(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// GetSystemBootInfo returns the System Boot Info (type 32) table, if present.
+func (i *Info) GetSystemBootInfo() (*SystemBootInfo, error) {
+	bt := i.GetTablesByType(TableTypeSystemBootInfo)
+	if len(bt) == 0 {
+		return nil, ErrTableNotFound
+	}
+	// There can only be one of these.
+	return NewSystemBootInfo(bt[0])
+}
+
 // GetIPMIDeviceInfo returns all the IPMI Device Info (type 38) tables present.
 func (i *Info) GetIPMIDeviceInfo() ([]*IPMIDeviceInfo, error) {
 	var res []*IPMIDeviceInfo
@@ -182,6 +353,32 @@ func (i *Info) GetIPMIDeviceInfo() ([]*IPMIDeviceInfo, error) {
 	return res, nil
 }
 
+// GetSystemPowerSupplies returns all the System Power Supply (type 39) tables present.
+func (i *Info) GetSystemPowerSupplies() ([]*SystemPowerSupply, error) {
+	var res []*SystemPowerSupply
+	for _, t := range i.GetTablesByType(TableTypeSystemPowerSupply) {
+		v, err := NewSystemPowerSupply(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// GetOnboardDevicesExtendedInfo returns all the Onboard Devices Extended Info (type 41) tables present.
+func (i *Info) GetOnboardDevicesExtendedInfo() ([]*OnboardDevicesExtendedInfo, error) {
+	var res []*OnboardDevicesExtendedInfo
+	for _, t := range i.GetTablesByType(TableTypeOnboardDevicesExtendedInfo) {
+		v, err := NewOnboardDevicesExtendedInfo(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
 // GetTPMDevices returns all the TPM Device (type 43) tables present.
 func (i *Info) GetTPMDevices() ([]*TPMDevice, error) {
 	var res []*TPMDevice
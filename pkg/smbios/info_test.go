@@ -0,0 +1,143 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+type tableEncoder interface {
+	ToTable() (*Table, error)
+}
+
+func readDump(t *testing.T, path string) (entryData, tableData []byte) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dumps written by dmidecode have the entry point at 0 and the tables at 0x20.
+	return data[:0x20], data[0x20:]
+}
+
+func TestRoundTrip(t *testing.T) {
+	dumps, err := filepath.Glob("../../cmds/exp/dmidecode/testdata/*.bin")
+	if err != nil || len(dumps) == 0 {
+		t.Fatalf("no dumps found: %v", err)
+	}
+	for _, dump := range dumps {
+		t.Run(filepath.Base(dump), func(t *testing.T) {
+			entryData, tableData := readDump(t, dump)
+			info, err := ParseInfo(entryData, tableData)
+			if err != nil {
+				t.Fatalf("ParseInfo: %v", err)
+			}
+			var tables []*Table
+			for _, tt := range info.Tables {
+				pt, err := ParseTypedTable(tt)
+				if err != nil {
+					tables = append(tables, tt)
+					continue
+				}
+				nt, err := pt.(tableEncoder).ToTable()
+				if err != nil {
+					t.Fatalf("table 0x%04X: ToTable: %v", tt.Handle, err)
+				}
+				npt, err := ParseTypedTable(nt)
+				if err != nil {
+					t.Fatalf("table 0x%04X: ParseTypedTable: %v", tt.Handle, err)
+				}
+				// Strings may be deduplicated and reordered, so compare
+				// the decoded tables rather than the bytes.
+				if got, want := npt.String(), pt.String(); got != want {
+					t.Errorf("table 0x%04X: got\n%s\nwant\n%s", tt.Handle, got, want)
+				}
+				tables = append(tables, nt)
+			}
+			info.Tables = tables
+			ne, nd, err := info.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			ni, err := ParseInfo(ne, nd)
+			if err != nil {
+				t.Fatalf("ParseInfo of marshaled data: %v", err)
+			}
+			if len(ni.Tables) != len(info.Tables) {
+				t.Fatalf("got %d tables, want %d", len(ni.Tables), len(info.Tables))
+			}
+			for i := range ni.Tables {
+				if got, want := ni.Tables[i].String(), info.Tables[i].String(); got != want {
+					t.Errorf("table %d: got\n%s\nwant\n%s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	bios := &BIOSInfo{
+		Vendor:                 "u-root",
+		Version:                "1.0",
+		StartingAddressSegment: 0xe800,
+		ReleaseDate:            "01/01/2020",
+		ROMSize:                0x3f,
+		Characteristics:        BIOSCharacteristicsBIOSCharacteristicsAreNotSupported,
+	}
+	sys := &SystemInfo{
+		Manufacturer: "u-root",
+		ProductName:  "Test",
+		WakeupType:   WakeupTypePowerSwitch,
+	}
+	sys.Handle = 1
+	oem := &OEMStrings{Strings: []string{"foo", "bar"}}
+	oem.Handle = 2
+
+	info := &Info{Entry64: &Entry64{}}
+	for _, e := range []tableEncoder{bios, sys, oem} {
+		tt, err := e.ToTable()
+		if err != nil {
+			t.Fatalf("ToTable(%T): %v", e, err)
+		}
+		info.Tables = append(info.Tables, tt)
+	}
+	entryData, tableData, err := info.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	ni, err := ParseInfo(entryData, tableData)
+	if err != nil {
+		t.Fatalf("ParseInfo: %v", err)
+	}
+	if got, want := len(ni.Tables), 4; got != want {
+		t.Fatalf("got %d tables, want %d", got, want)
+	}
+	if ni.Tables[3].Type != TableTypeEndOfTable {
+		t.Errorf("last table is %s, want %s", ni.Tables[3].Type, TableTypeEndOfTable)
+	}
+	nb, err := ni.GetBIOSInfo()
+	if err != nil {
+		t.Fatalf("GetBIOSInfo: %v", err)
+	}
+	if nb.Vendor != bios.Vendor || nb.ReleaseDate != bios.ReleaseDate || nb.GetROMSizeBytes() != 4<<20 {
+		t.Errorf("got %+v", nb)
+	}
+	ns, err := ni.GetSystemInfo()
+	if err != nil {
+		t.Fatalf("GetSystemInfo: %v", err)
+	}
+	if ns.ProductName != "Test" || ns.SerialNumber != "Not Specified" || ns.WakeupType != WakeupTypePowerSwitch {
+		t.Errorf("got %+v", ns)
+	}
+	no, err := ni.GetOEMStrings()
+	if err != nil || len(no) != 1 {
+		t.Fatalf("GetOEMStrings: %v, %v", no, err)
+	}
+	if no[0].Count != 2 || no[0].Strings[1] != "bar" {
+		t.Errorf("got %+v", no[0])
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type fieldWriter interface {
+	WriteField(t *Table) error
+}
+
+var (
+	fieldWriterInterfaceType = reflect.TypeOf((*fieldWriter)(nil)).Elem()
+	tableType                = reflect.TypeOf(Table{})
+)
+
+// writeStruct is the inverse of parseStruct: it appends the fields of sp to
+// the structured part of t, adding strings to t as needed.
+//
+// Like parseStruct, it stops once limit bytes have been written, so that
+// fields a table did not have when it was parsed are not added to it. A limit
+// of 0 means all fields are written. The embedded Table is written as a
+// placeholder header, which toTable fills in.
+func writeStruct(t *Table, limit int, sp interface{}) error {
+	var sv reflect.Value
+	var ok bool
+	if sv, ok = sp.(reflect.Value); !ok {
+		sv = reflect.Indirect(reflect.ValueOf(sp))
+	}
+	svtn := sv.Type().Name()
+	for i := 0; i < sv.NumField() && (limit == 0 || t.Len() < limit); i++ {
+		f := sv.Type().Field(i)
+		fv := sv.Field(i)
+		ft := fv.Type()
+		if ft == tableType {
+			t.data = append(t.data, 0, 0, 0, 0)
+			continue
+		}
+		ignore := false
+		for _, tag := range strings.Split(f.Tag.Get(fieldTagKey), ",") {
+			tp := strings.Split(tag, "=")
+			switch tp[0] {
+			case "-":
+				ignore = true
+			case "skip":
+				numBytes, _ := strconv.Atoi(tp[1])
+				t.data = append(t.data, make([]byte, numBytes)...)
+			}
+		}
+		if ignore {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.Uint8:
+			t.data = append(t.data, uint8(fv.Uint()))
+		case reflect.Uint16:
+			t.data = append(t.data, 0, 0)
+			binary.LittleEndian.PutUint16(t.data[len(t.data)-2:], uint16(fv.Uint()))
+		case reflect.Uint32:
+			t.data = append(t.data, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint32(t.data[len(t.data)-4:], uint32(fv.Uint()))
+		case reflect.Uint64:
+			t.data = append(t.data, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint64(t.data[len(t.data)-8:], fv.Uint())
+		case reflect.String:
+			idx, err := t.addString(fv.String())
+			if err != nil {
+				return fmt.Errorf("%s.%s: %v", svtn, f.Name, err)
+			}
+			t.data = append(t.data, idx)
+		default:
+			if reflect.PtrTo(ft).Implements(fieldWriterInterfaceType) {
+				// fv may not be addressable, e.g. for a struct passed by value.
+				c := reflect.New(ft)
+				c.Elem().Set(fv)
+				if err := c.Interface().(fieldWriter).WriteField(t); err != nil {
+					return fmt.Errorf("%s.%s: %v", svtn, f.Name, err)
+				}
+				break
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := writeStruct(t, 0, fv); err != nil {
+					return err
+				}
+				break
+			}
+			return fmt.Errorf("%s.%s: unsupported type %s", svtn, f.Name, fv.Kind())
+		}
+	}
+	return nil
+}
+
+// newTable encodes the fixed-size fields of v, a typed table embedding orig,
+// into a new Table of type tt. Fields orig did not have are left out, unless
+// orig is empty, i.e. v was built from scratch.
+//
+// Types with variable-size parts append them to the returned table and then
+// call setLength.
+func newTable(tt TableType, orig *Table, v interface{}) (*Table, error) {
+	t := &Table{Header: Header{Type: tt, Handle: orig.Handle}, ver: orig.ver}
+	if err := writeStruct(t, orig.Len(), v); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// toTable encodes v, a typed table embedding orig, for types without
+// variable-size parts. Any data in orig after the known fields, e.g. from a
+// newer version of the spec, is kept.
+func toTable(tt TableType, orig *Table, v interface{}) (*Table, error) {
+	t, err := newTable(tt, orig, v)
+	if err != nil {
+		return nil, err
+	}
+	if t.Len() < orig.Len() {
+		// The data after the known fields may refer to strings, so keep
+		// all of orig's strings where they were.
+		t = &Table{Header: t.Header, strings: append([]string(nil), orig.strings...), ver: orig.ver}
+		if err := writeStruct(t, orig.Len(), v); err != nil {
+			return nil, err
+		}
+		t.data = append(t.data, orig.data[t.Len():]...)
+	}
+	if err := t.setLength(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -18,6 +18,7 @@ type Table struct {
 	Header
 	data    []byte   `smbios:"-"` // Structured part of the table.
 	strings []string `smbios:"-"` // Strings section.
+	ver     uint16   `smbios:"-"` // SMBIOS version (major << 8 | minor), if known.
 }
 
 var (
@@ -170,6 +171,88 @@ func ParseTable(data []byte) (*Table, []byte, error) {
 	return &Table{Header: h, data: structData, strings: strings}, data, err
 }
 
+// NewTable returns a table of type tt with the given handle, structured part
+// after the header and strings. It can be used to build table types this
+// package does not parse, e.g. OEM-specific ones.
+func NewTable(tt TableType, handle uint16, data []byte, strings []string) (*Table, error) {
+	t := &Table{
+		Header:  Header{Type: tt, Handle: handle},
+		data:    append([]byte{0, 0, 0, 0}, data...),
+		strings: append([]string(nil), strings...),
+	}
+	if err := t.setLength(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ToTable returns a copy of t. It lets Table be used like the typed tables.
+func (t *Table) ToTable() (*Table, error) {
+	return &Table{
+		Header:  t.Header,
+		data:    append([]byte(nil), t.data...),
+		strings: append([]string(nil), t.strings...),
+		ver:     t.ver,
+	}, nil
+}
+
+// MarshalBinary encodes the table, i.e. the structured part followed by the
+// strings. The header is taken from t.Header, apart from the length.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	if t.Len() < 4 || t.Len() > 0xff {
+		return nil, fmt.Errorf("invalid table length %d", t.Len())
+	}
+	data := append([]byte(nil), t.data...)
+	data[0] = uint8(t.Type)
+	data[1] = uint8(t.Len())
+	binary.LittleEndian.PutUint16(data[2:], t.Handle)
+	for _, s := range t.strings {
+		if s == "" || strings.IndexByte(s, 0) >= 0 {
+			return nil, fmt.Errorf("invalid string %q", s)
+		}
+		data = append(data, s...)
+		data = append(data, 0)
+	}
+	if len(t.strings) == 0 {
+		data = append(data, 0)
+	}
+	return append(data, 0), nil
+}
+
+// setLength updates the header of t after its structured part was built.
+func (t *Table) setLength() error {
+	if t.Len() < 4 || t.Len() > 0xff {
+		return fmt.Errorf("%s: invalid table length %d", t.Type, t.Len())
+	}
+	t.Length = uint8(t.Len())
+	t.data[0] = uint8(t.Type)
+	t.data[1] = t.Length
+	binary.LittleEndian.PutUint16(t.data[2:], t.Handle)
+	return nil
+}
+
+// addString adds s to the strings of t, if it is not there yet, and returns
+// its index. The empty string and "Not Specified", which GetStringAt returns
+// for index 0, are index 0.
+func (t *Table) addString(s string) (uint8, error) {
+	if s == "" || s == "Not Specified" {
+		return 0, nil
+	}
+	if strings.IndexByte(s, 0) >= 0 {
+		return 0, fmt.Errorf("string %q contains NUL", s)
+	}
+	for i, ts := range t.strings {
+		if ts == s {
+			return uint8(i + 1), nil
+		}
+	}
+	if len(t.strings) == 0xff {
+		return 0, errors.New("too many strings")
+	}
+	t.strings = append(t.strings, s)
+	return uint8(len(t.strings)), nil
+}
+
 func kmgt(v uint64) string {
 	switch {
 	case v >= 1024*1024*1024*1024 && v%(1024*1024*1024*1024) == 0:
@@ -184,3 +267,31 @@ func kmgt(v uint64) string {
 		return fmt.Sprintf("%d bytes", v)
 	}
 }
+
+func yesNo(v bool) string {
+	if v {
+		return "Yes"
+	}
+	return "No"
+}
+
+// dmiMemorySize formats a size the way dmidecode(8) does, in the largest
+// unit that is not zero, or in the unit below it if that is not zero either.
+// shift is the unit of v: 0 for bytes, 1 for kB, etc.
+func dmiMemorySize(v uint64, shift int) string {
+	units := []string{"bytes", "kB", "MB", "GB", "TB", "PB", "EB", "ZB"}
+	var split [7]uint64
+	for i := range split {
+		split[i] = (v >> (10 * uint(i))) & 0x3ff
+	}
+	i := len(split) - 1
+	for i > 0 && split[i] == 0 {
+		i--
+	}
+	size := split[i]
+	if i > 0 && split[i-1] != 0 {
+		i--
+		size = split[i] + split[i+1]<<10
+	}
+	return fmt.Sprintf("%d %s", size, units[i+shift])
+}
@@ -14,17 +14,27 @@ type TableType uint8
 
 // Supported table types.
 const (
-	TableTypeBIOSInfo       TableType = 0
-	TableTypeSystemInfo     TableType = 1
-	TableTypeBaseboardInfo  TableType = 2
-	TableTypeChassisInfo    TableType = 3
-	TableTypeProcessorInfo  TableType = 4
-	TableTypeCacheInfo      TableType = 7
-	TableTypeMemoryDevice   TableType = 17
-	TableTypeIPMIDeviceInfo TableType = 38
-	TableTypeTPMDevice      TableType = 43
-	TableTypeInactive       TableType = 126
-	TableTypeEndOfTable     TableType = 127
+	TableTypeBIOSInfo                   TableType = 0
+	TableTypeSystemInfo                 TableType = 1
+	TableTypeBaseboardInfo              TableType = 2
+	TableTypeChassisInfo                TableType = 3
+	TableTypeProcessorInfo              TableType = 4
+	TableTypeCacheInfo                  TableType = 7
+	TableTypePortConnectorInfo          TableType = 8
+	TableTypeSystemSlots                TableType = 9
+	TableTypeOEMStrings                 TableType = 11
+	TableTypeSystemConfigurationOptions TableType = 12
+	TableTypePhysicalMemoryArray        TableType = 16
+	TableTypeMemoryDevice               TableType = 17
+	TableTypeMemoryArrayMappedAddress   TableType = 19
+	TableTypeMemoryDeviceMappedAddress  TableType = 20
+	TableTypeSystemBootInfo             TableType = 32
+	TableTypeIPMIDeviceInfo             TableType = 38
+	TableTypeSystemPowerSupply          TableType = 39
+	TableTypeOnboardDevicesExtendedInfo TableType = 41
+	TableTypeTPMDevice                  TableType = 43
+	TableTypeInactive                   TableType = 126
+	TableTypeEndOfTable                 TableType = 127
 )
 
 func (t TableType) String() string {
@@ -41,10 +51,30 @@ func (t TableType) String() string {
 		return "Processor Information"
 	case TableTypeCacheInfo:
 		return "Cache Information"
+	case TableTypePortConnectorInfo:
+		return "Port Connector Information"
+	case TableTypeSystemSlots:
+		return "System Slot Information"
+	case TableTypeOEMStrings:
+		return "OEM Strings"
+	case TableTypeSystemConfigurationOptions:
+		return "System Configuration Options"
+	case TableTypePhysicalMemoryArray:
+		return "Physical Memory Array"
 	case TableTypeMemoryDevice:
 		return "Memory Device"
+	case TableTypeMemoryArrayMappedAddress:
+		return "Memory Array Mapped Address"
+	case TableTypeMemoryDeviceMappedAddress:
+		return "Memory Device Mapped Address"
+	case TableTypeSystemBootInfo:
+		return "System Boot Information"
 	case TableTypeIPMIDeviceInfo:
 		return "IPMI Device Information"
+	case TableTypeSystemPowerSupply:
+		return "System Power Supply"
+	case TableTypeOnboardDevicesExtendedInfo:
+		return "Onboard Device"
 	case TableTypeTPMDevice:
 		return "TPM Device"
 	case TableTypeInactive:
@@ -74,10 +104,30 @@ func ParseTypedTable(t *Table) (fmt.Stringer, error) {
 		return ParseProcessorInfo(t)
 	case TableTypeCacheInfo: // 7
 		return ParseCacheInfo(t)
+	case TableTypePortConnectorInfo: // 8
+		return NewPortConnectorInfo(t)
+	case TableTypeSystemSlots: // 9
+		return NewSystemSlots(t)
+	case TableTypeOEMStrings: // 11
+		return NewOEMStrings(t)
+	case TableTypeSystemConfigurationOptions: // 12
+		return NewSystemConfigurationOptions(t)
+	case TableTypePhysicalMemoryArray: // 16
+		return NewPhysicalMemoryArray(t)
 	case TableTypeMemoryDevice: // 17
 		return NewMemoryDevice(t)
+	case TableTypeMemoryArrayMappedAddress: // 19
+		return NewMemoryArrayMappedAddress(t)
+	case TableTypeMemoryDeviceMappedAddress: // 20
+		return NewMemoryDeviceMappedAddress(t)
+	case TableTypeSystemBootInfo: // 32
+		return NewSystemBootInfo(t)
 	case TableTypeIPMIDeviceInfo: // 38
 		return ParseIPMIDeviceInfo(t)
+	case TableTypeSystemPowerSupply: // 39
+		return NewSystemPowerSupply(t)
+	case TableTypeOnboardDevicesExtendedInfo: // 41
+		return NewOnboardDevicesExtendedInfo(t)
 	case TableTypeTPMDevice: // 43
 		return NewTPMDevice(t)
 	case TableTypeInactive: // 126
@@ -45,6 +45,11 @@ func ParseBIOSInfo(t *Table) (*BIOSInfo, error) {
 	return bi, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (bi *BIOSInfo) ToTable() (*Table, error) {
+	return toTable(TableTypeBIOSInfo, &bi.Table, bi)
+}
+
 // GetROMSizeBytes returns ROM size in bytes.
 func (bi *BIOSInfo) GetROMSizeBytes() uint64 {
 	if bi.ROMSize != 0xff {
@@ -0,0 +1,57 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OEMStrings is defined in DSP0134 7.12.
+type OEMStrings struct {
+	Table
+	Count   uint8    // 04h
+	Strings []string `smbios:"-"`
+}
+
+// NewOEMStrings parses a generic Table into OEMStrings.
+func NewOEMStrings(t *Table) (*OEMStrings, error) {
+	if t.Type != TableTypeOEMStrings {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0x5 {
+		return nil, errors.New("required fields missing")
+	}
+	oi := &OEMStrings{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, oi); err != nil {
+		return nil, err
+	}
+	oi.Strings = append([]string(nil), t.strings...)
+	return oi, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+// Count is set from Strings.
+func (oi *OEMStrings) ToTable() (*Table, error) {
+	if len(oi.Strings) > 0xff {
+		return nil, errors.New("too many strings")
+	}
+	return NewTable(TableTypeOEMStrings, oi.Handle, []byte{uint8(len(oi.Strings))}, oi.Strings)
+}
+
+func (oi *OEMStrings) String() string {
+	lines := []string{
+		oi.Header.String(),
+	}
+	for i := 1; i <= int(oi.Count); i++ {
+		s := "<BAD INDEX>"
+		if i <= len(oi.Strings) {
+			s = oi.Strings[i-1]
+		}
+		lines = append(lines, fmt.Sprintf("String %d: %s", i, s))
+	}
+	return strings.Join(lines, "\n\t")
+}
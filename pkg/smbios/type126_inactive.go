@@ -24,6 +24,11 @@ func NewInactiveTable(t *Table) (*InactiveTable, error) {
 	return &InactiveTable{Table: *t}, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (it *InactiveTable) ToTable() (*Table, error) {
+	return toTable(TableTypeInactive, &it.Table, it)
+}
+
 func (it *InactiveTable) String() string {
 	return it.Header.String()
 }
@@ -21,6 +21,11 @@ func NewEndOfTable(t *Table) (*EndOfTable, error) {
 	return &EndOfTable{Table: *t}, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (eot *EndOfTable) ToTable() (*Table, error) {
+	return toTable(TableTypeEndOfTable, &eot.Table, eot)
+}
+
 func (eot *EndOfTable) String() string {
 	return eot.Header.String()
 }
@@ -0,0 +1,57 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SystemConfigurationOptions is defined in DSP0134 7.13.
+type SystemConfigurationOptions struct {
+	Table
+	Count   uint8    // 04h
+	Options []string `smbios:"-"`
+}
+
+// NewSystemConfigurationOptions parses a generic Table into SystemConfigurationOptions.
+func NewSystemConfigurationOptions(t *Table) (*SystemConfigurationOptions, error) {
+	if t.Type != TableTypeSystemConfigurationOptions {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0x5 {
+		return nil, errors.New("required fields missing")
+	}
+	co := &SystemConfigurationOptions{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, co); err != nil {
+		return nil, err
+	}
+	co.Options = append([]string(nil), t.strings...)
+	return co, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+// Count is set from Options.
+func (co *SystemConfigurationOptions) ToTable() (*Table, error) {
+	if len(co.Options) > 0xff {
+		return nil, errors.New("too many options")
+	}
+	return NewTable(TableTypeSystemConfigurationOptions, co.Handle, []byte{uint8(len(co.Options))}, co.Options)
+}
+
+func (co *SystemConfigurationOptions) String() string {
+	lines := []string{
+		co.Header.String(),
+	}
+	for i := 1; i <= int(co.Count); i++ {
+		s := "<BAD INDEX>"
+		if i <= len(co.Options) {
+			s = co.Options[i-1]
+		}
+		lines = append(lines, fmt.Sprintf("Option %d: %s", i, s))
+	}
+	return strings.Join(lines, "\n\t")
+}
@@ -0,0 +1,189 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Much of this is auto-generated. If adding a new type, see README for instructions.
+
+// PhysicalMemoryArray is defined in DSP0134 7.17.
+type PhysicalMemoryArray struct {
+	Table
+	Location                MemoryArrayLocation        // 04h
+	Use                     MemoryArrayUse             // 05h
+	ErrorCorrection         MemoryArrayErrorCorrection // 06h
+	MaximumCapacity         uint32                     // 07h
+	ErrorInformationHandle  uint16                     // 0Bh
+	NumberOfMemoryDevices   uint16                     // 0Dh
+	ExtendedMaximumCapacity uint64                     // 0Fh
+}
+
+// NewPhysicalMemoryArray parses a generic Table into PhysicalMemoryArray.
+func NewPhysicalMemoryArray(t *Table) (*PhysicalMemoryArray, error) {
+	if t.Type != TableTypePhysicalMemoryArray {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0xf {
+		return nil, errors.New("required fields missing")
+	}
+	pa := &PhysicalMemoryArray{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, pa); err != nil {
+		return nil, err
+	}
+	return pa, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+func (pa *PhysicalMemoryArray) ToTable() (*Table, error) {
+	return toTable(TableTypePhysicalMemoryArray, &pa.Table, pa)
+}
+
+// GetMaximumCapacityBytes returns the maximum memory capacity of the array,
+// in bytes.
+func (pa *PhysicalMemoryArray) GetMaximumCapacityBytes() uint64 {
+	if pa.MaximumCapacity == 0x80000000 {
+		return pa.ExtendedMaximumCapacity
+	}
+	return uint64(pa.MaximumCapacity) * 1024
+}
+
+func (pa *PhysicalMemoryArray) String() string {
+	maxCap := "Unknown"
+	switch {
+	case pa.MaximumCapacity != 0x80000000:
+		maxCap = dmiMemorySize(uint64(pa.MaximumCapacity), 1)
+	case pa.Len() >= 0x17:
+		maxCap = dmiMemorySize(pa.ExtendedMaximumCapacity, 0)
+	}
+	lines := []string{
+		pa.Header.String(),
+		fmt.Sprintf("Location: %s", pa.Location),
+		fmt.Sprintf("Use: %s", pa.Use),
+		fmt.Sprintf("Error Correction Type: %s", pa.ErrorCorrection),
+		fmt.Sprintf("Maximum Capacity: %s", maxCap),
+		fmt.Sprintf("Error Information Handle: %s", errorHandle(pa.ErrorInformationHandle)),
+		fmt.Sprintf("Number Of Devices: %d", pa.NumberOfMemoryDevices),
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// errorHandle formats the handle of a memory error information structure.
+func errorHandle(h uint16) string {
+	switch h {
+	case 0xfffe:
+		return "Not Provided"
+	case 0xffff:
+		return "No Error"
+	}
+	return fmt.Sprintf("0x%04X", h)
+}
+
+// MemoryArrayLocation is defined in DSP0134 7.17.1.
+type MemoryArrayLocation uint8
+
+// MemoryArrayLocation values are defined in DSP0134 7.17.1.
+const (
+	MemoryArrayLocationOther                    MemoryArrayLocation = 0x01 // Other
+	MemoryArrayLocationUnknown                  MemoryArrayLocation = 0x02 // Unknown
+	MemoryArrayLocationSystemBoardOrMotherboard MemoryArrayLocation = 0x03 // System board or motherboard
+	MemoryArrayLocationISAAddonCard             MemoryArrayLocation = 0x04 // ISA add-on card
+	MemoryArrayLocationEISAAddonCard            MemoryArrayLocation = 0x05 // EISA add-on card
+	MemoryArrayLocationPCIAddonCard             MemoryArrayLocation = 0x06 // PCI add-on card
+	MemoryArrayLocationMCAAddonCard             MemoryArrayLocation = 0x07 // MCA add-on card
+	MemoryArrayLocationPCMCIAAddonCard          MemoryArrayLocation = 0x08 // PCMCIA add-on card
+	MemoryArrayLocationProprietaryAddonCard     MemoryArrayLocation = 0x09 // Proprietary add-on card
+	MemoryArrayLocationNuBus                    MemoryArrayLocation = 0x0a // NuBus
+	MemoryArrayLocationPC98C20AddonCard         MemoryArrayLocation = 0xa0 // PC-98/C20 add-on card
+	MemoryArrayLocationPC98C24AddonCard         MemoryArrayLocation = 0xa1 // PC-98/C24 add-on card
+	MemoryArrayLocationPC98EAddonCard           MemoryArrayLocation = 0xa2 // PC-98/E add-on card
+	MemoryArrayLocationPC98LocalBusAddonCard    MemoryArrayLocation = 0xa3 // PC-98/Local bus add-on card
+)
+
+func (v MemoryArrayLocation) String() string {
+	names := map[MemoryArrayLocation]string{
+		MemoryArrayLocationOther:                    "Other",
+		MemoryArrayLocationUnknown:                  "Unknown",
+		MemoryArrayLocationSystemBoardOrMotherboard: "System Board Or Motherboard",
+		MemoryArrayLocationISAAddonCard:             "ISA Add-on Card",
+		MemoryArrayLocationEISAAddonCard:            "EISA Add-on Card",
+		MemoryArrayLocationPCIAddonCard:             "PCI Add-on Card",
+		MemoryArrayLocationMCAAddonCard:             "MCA Add-on Card",
+		MemoryArrayLocationPCMCIAAddonCard:          "PCMCIA Add-on Card",
+		MemoryArrayLocationProprietaryAddonCard:     "Proprietary Add-on Card",
+		MemoryArrayLocationNuBus:                    "NuBus",
+		MemoryArrayLocationPC98C20AddonCard:         "PC-98/C20 Add-on Card",
+		MemoryArrayLocationPC98C24AddonCard:         "PC-98/C24 Add-on Card",
+		MemoryArrayLocationPC98EAddonCard:           "PC-98/E Add-on Card",
+		MemoryArrayLocationPC98LocalBusAddonCard:    "PC-98/Local Bus Add-on Card",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// MemoryArrayUse is defined in DSP0134 7.17.2.
+type MemoryArrayUse uint8
+
+// MemoryArrayUse values are defined in DSP0134 7.17.2.
+const (
+	MemoryArrayUseOther          MemoryArrayUse = 0x01 // Other
+	MemoryArrayUseUnknown        MemoryArrayUse = 0x02 // Unknown
+	MemoryArrayUseSystemMemory   MemoryArrayUse = 0x03 // System memory
+	MemoryArrayUseVideoMemory    MemoryArrayUse = 0x04 // Video memory
+	MemoryArrayUseFlashMemory    MemoryArrayUse = 0x05 // Flash memory
+	MemoryArrayUseNonvolatileRAM MemoryArrayUse = 0x06 // Non-volatile RAM
+	MemoryArrayUseCacheMemory    MemoryArrayUse = 0x07 // Cache memory
+)
+
+func (v MemoryArrayUse) String() string {
+	names := map[MemoryArrayUse]string{
+		MemoryArrayUseOther:          "Other",
+		MemoryArrayUseUnknown:        "Unknown",
+		MemoryArrayUseSystemMemory:   "System Memory",
+		MemoryArrayUseVideoMemory:    "Video Memory",
+		MemoryArrayUseFlashMemory:    "Flash Memory",
+		MemoryArrayUseNonvolatileRAM: "Non-volatile RAM",
+		MemoryArrayUseCacheMemory:    "Cache Memory",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// MemoryArrayErrorCorrection is defined in DSP0134 7.17.3.
+type MemoryArrayErrorCorrection uint8
+
+// MemoryArrayErrorCorrection values are defined in DSP0134 7.17.3.
+const (
+	MemoryArrayErrorCorrectionOther        MemoryArrayErrorCorrection = 0x01 // Other
+	MemoryArrayErrorCorrectionUnknown      MemoryArrayErrorCorrection = 0x02 // Unknown
+	MemoryArrayErrorCorrectionNone         MemoryArrayErrorCorrection = 0x03 // None
+	MemoryArrayErrorCorrectionParity       MemoryArrayErrorCorrection = 0x04 // Parity
+	MemoryArrayErrorCorrectionSinglebitECC MemoryArrayErrorCorrection = 0x05 // Single-bit ECC
+	MemoryArrayErrorCorrectionMultibitECC  MemoryArrayErrorCorrection = 0x06 // Multi-bit ECC
+	MemoryArrayErrorCorrectionCRC          MemoryArrayErrorCorrection = 0x07 // CRC
+)
+
+func (v MemoryArrayErrorCorrection) String() string {
+	names := map[MemoryArrayErrorCorrection]string{
+		MemoryArrayErrorCorrectionOther:        "Other",
+		MemoryArrayErrorCorrectionUnknown:      "Unknown",
+		MemoryArrayErrorCorrectionNone:         "None",
+		MemoryArrayErrorCorrectionParity:       "Parity",
+		MemoryArrayErrorCorrectionSinglebitECC: "Single-bit ECC",
+		MemoryArrayErrorCorrectionMultibitECC:  "Multi-bit ECC",
+		MemoryArrayErrorCorrectionCRC:          "CRC",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
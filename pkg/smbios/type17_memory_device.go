@@ -88,6 +88,11 @@ func NewMemoryDevice(t *Table) (*MemoryDevice, error) {
 	return md, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (md *MemoryDevice) ToTable() (*Table, error) {
+	return toTable(TableTypeMemoryDevice, &md.Table, md)
+}
+
 // GetSizeBytes returns size of the memory device, in bytes.
 func (md *MemoryDevice) GetSizeBytes() uint64 {
 	switch md.Size {
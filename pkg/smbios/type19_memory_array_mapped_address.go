@@ -0,0 +1,106 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Much of this is auto-generated. If adding a new type, see README for instructions.
+
+// MemoryArrayMappedAddress is defined in DSP0134 7.20.
+type MemoryArrayMappedAddress struct {
+	Table
+	StartingAddress         uint32 // 04h
+	EndingAddress           uint32 // 08h
+	MemoryArrayHandle       uint16 // 0Ch
+	PartitionWidth          uint8  // 0Eh
+	ExtendedStartingAddress uint64 // 0Fh
+	ExtendedEndingAddress   uint64 // 17h
+}
+
+// NewMemoryArrayMappedAddress parses a generic Table into MemoryArrayMappedAddress.
+func NewMemoryArrayMappedAddress(t *Table) (*MemoryArrayMappedAddress, error) {
+	if t.Type != TableTypeMemoryArrayMappedAddress {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0xf {
+		return nil, errors.New("required fields missing")
+	}
+	ma := &MemoryArrayMappedAddress{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, ma); err != nil {
+		return nil, err
+	}
+	return ma, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+func (ma *MemoryArrayMappedAddress) ToTable() (*Table, error) {
+	return toTable(TableTypeMemoryArrayMappedAddress, &ma.Table, ma)
+}
+
+// extendedAddress reports whether the extended address fields of a memory
+// mapped address table are used.
+func extendedAddress(t *Table, start uint32, extOff int) bool {
+	return start == 0xffffffff && t.Len() >= extOff+16
+}
+
+// GetStartingAddress returns the physical address of the start of the range
+// mapped to the array.
+func (ma *MemoryArrayMappedAddress) GetStartingAddress() uint64 {
+	if extendedAddress(&ma.Table, ma.StartingAddress, 0xf) {
+		return ma.ExtendedStartingAddress
+	}
+	return uint64(ma.StartingAddress) * 1024
+}
+
+// GetEndingAddress returns the physical address of the last byte of the range
+// mapped to the array.
+func (ma *MemoryArrayMappedAddress) GetEndingAddress() uint64 {
+	if extendedAddress(&ma.Table, ma.StartingAddress, 0xf) {
+		return ma.ExtendedEndingAddress
+	}
+	return uint64(ma.EndingAddress)*1024 + 1023
+}
+
+// mappedAddressLines formats the range of a memory mapped address table the
+// way dmidecode(8) does.
+func mappedAddressLines(extended bool, start, end uint32, extStart, extEnd uint64) []string {
+	if extended {
+		size := "Invalid"
+		if extStart != extEnd {
+			size = dmiMemorySize(extEnd-extStart+1, 0)
+		}
+		return []string{
+			fmt.Sprintf("Starting Address: 0x%016Xk", extStart),
+			fmt.Sprintf("Ending Address: 0x%016Xk", extEnd),
+			fmt.Sprintf("Range Size: %s", size),
+		}
+	}
+	size := "Invalid"
+	if end-start+1 != 0 {
+		size = dmiMemorySize(uint64(end-start+1), 1)
+	}
+	return []string{
+		fmt.Sprintf("Starting Address: 0x%08X%03X", start>>2, (start&3)<<10),
+		fmt.Sprintf("Ending Address: 0x%08X%03X", end>>2, ((end&3)<<10)+0x3ff),
+		fmt.Sprintf("Range Size: %s", size),
+	}
+}
+
+func (ma *MemoryArrayMappedAddress) String() string {
+	lines := []string{
+		ma.Header.String(),
+	}
+	lines = append(lines, mappedAddressLines(extendedAddress(&ma.Table, ma.StartingAddress, 0xf),
+		ma.StartingAddress, ma.EndingAddress, ma.ExtendedStartingAddress, ma.ExtendedEndingAddress)...)
+	lines = append(lines,
+		fmt.Sprintf("Physical Array Handle: 0x%04X", ma.MemoryArrayHandle),
+		fmt.Sprintf("Partition Width: %d", ma.PartitionWidth),
+	)
+	return strings.Join(lines, "\n\t")
+}
@@ -41,6 +41,17 @@ func ParseSystemInfo(t *Table) (*SystemInfo, error) {
 	return si, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (si *SystemInfo) ToTable() (*Table, error) {
+	return toTable(TableTypeSystemInfo, &si.Table, si)
+}
+
+// GetUUIDString returns the UUID formatted for the SMBIOS version of the
+// table, see UUID.String.
+func (si *SystemInfo) GetUUIDString() string {
+	return si.UUID.format(si.ver)
+}
+
 // ParseField parses UUD field within a table.
 func (u *UUID) ParseField(t *Table, off int) (int, error) {
 	ub, err := t.GetBytesAt(off, 16)
@@ -51,6 +62,12 @@ func (u *UUID) ParseField(t *Table, off int) (int, error) {
 	return off + 16, nil
 }
 
+// WriteField writes UUID field within a table.
+func (u *UUID) WriteField(t *Table) error {
+	t.data = append(t.data, u[:]...)
+	return nil
+}
+
 func (si *SystemInfo) String() string {
 	lines := []string{
 		si.Header.String(),
@@ -61,7 +78,7 @@ func (si *SystemInfo) String() string {
 	}
 	if si.Len() >= 8 { // 2.1+
 		lines = append(lines,
-			fmt.Sprintf("UUID: %s", si.UUID),
+			fmt.Sprintf("UUID: %s", si.GetUUIDString()),
 			fmt.Sprintf("Wake-up Type: %s", si.WakeupType),
 		)
 	}
@@ -78,6 +95,12 @@ func (si *SystemInfo) String() string {
 type UUID [16]byte
 
 func (u UUID) String() string {
+	return u.format(0)
+}
+
+// format formats the UUID the way dmidecode(8) does for SMBIOS version ver,
+// or the current one if ver is 0.
+func (u UUID) format(ver uint16) string {
 	if bytes.Equal(u[:], []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}) {
 		return "Not Settable"
 	}
@@ -86,7 +109,13 @@ func (u UUID) String() string {
 	}
 	// Note: First three fields use LE byte order, last two use BE (network).
 	// Reasons for this are described in 7.2.1 (basically: historic).
-	// dmidecode(8) only does this for 2.6+ SMBIOS versions but we don't make that distinction.
+	// Like dmidecode(8), assume that this is only done from SMBIOS 2.6 on.
+	if ver != 0 && ver < 0x0206 {
+		return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+			u[0], u[1], u[2], u[3], u[4], u[5], u[6], u[7],
+			u[8], u[9], u[10], u[11], u[12], u[13], u[14], u[15],
+		)
+	}
 	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
 		u[3], u[2], u[1], u[0],
 		u[5], u[4],
@@ -0,0 +1,98 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Much of this is auto-generated. If adding a new type, see README for instructions.
+
+// MemoryDeviceMappedAddress is defined in DSP0134 7.21.
+type MemoryDeviceMappedAddress struct {
+	Table
+	StartingAddress                uint32 // 04h
+	EndingAddress                  uint32 // 08h
+	MemoryDeviceHandle             uint16 // 0Ch
+	MemoryArrayMappedAddressHandle uint16 // 0Eh
+	PartitionRowPosition           uint8  // 10h
+	InterleavePosition             uint8  // 11h
+	InterleavedDataDepth           uint8  // 12h
+	ExtendedStartingAddress        uint64 // 13h
+	ExtendedEndingAddress          uint64 // 1Bh
+}
+
+// NewMemoryDeviceMappedAddress parses a generic Table into MemoryDeviceMappedAddress.
+func NewMemoryDeviceMappedAddress(t *Table) (*MemoryDeviceMappedAddress, error) {
+	if t.Type != TableTypeMemoryDeviceMappedAddress {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0x13 {
+		return nil, errors.New("required fields missing")
+	}
+	md := &MemoryDeviceMappedAddress{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+func (md *MemoryDeviceMappedAddress) ToTable() (*Table, error) {
+	return toTable(TableTypeMemoryDeviceMappedAddress, &md.Table, md)
+}
+
+// GetStartingAddress returns the physical address of the start of the range
+// mapped to the device.
+func (md *MemoryDeviceMappedAddress) GetStartingAddress() uint64 {
+	if extendedAddress(&md.Table, md.StartingAddress, 0x13) {
+		return md.ExtendedStartingAddress
+	}
+	return uint64(md.StartingAddress) * 1024
+}
+
+// GetEndingAddress returns the physical address of the last byte of the range
+// mapped to the device.
+func (md *MemoryDeviceMappedAddress) GetEndingAddress() uint64 {
+	if extendedAddress(&md.Table, md.StartingAddress, 0x13) {
+		return md.ExtendedEndingAddress
+	}
+	return uint64(md.EndingAddress)*1024 + 1023
+}
+
+func (md *MemoryDeviceMappedAddress) String() string {
+	lines := []string{
+		md.Header.String(),
+	}
+	lines = append(lines, mappedAddressLines(extendedAddress(&md.Table, md.StartingAddress, 0x13),
+		md.StartingAddress, md.EndingAddress, md.ExtendedStartingAddress, md.ExtendedEndingAddress)...)
+	rowPos := fmt.Sprintf("%d", md.PartitionRowPosition)
+	switch md.PartitionRowPosition {
+	case 0:
+		rowPos = outOfSpec
+	case 0xff:
+		rowPos = "Unknown"
+	}
+	lines = append(lines,
+		fmt.Sprintf("Physical Device Handle: 0x%04X", md.MemoryDeviceHandle),
+		fmt.Sprintf("Memory Array Mapped Address Handle: 0x%04X", md.MemoryArrayMappedAddressHandle),
+		fmt.Sprintf("Partition Row Position: %s", rowPos),
+	)
+	unknownOrNum := func(v uint8) string {
+		if v == 0xff {
+			return "Unknown"
+		}
+		return fmt.Sprintf("%d", v)
+	}
+	if md.InterleavePosition != 0 {
+		lines = append(lines, fmt.Sprintf("Interleave Position: %s", unknownOrNum(md.InterleavePosition)))
+	}
+	if md.InterleavedDataDepth != 0 {
+		lines = append(lines, fmt.Sprintf("Interleaved Data Depth: %s", unknownOrNum(md.InterleavedDataDepth)))
+	}
+	return strings.Join(lines, "\n\t")
+}
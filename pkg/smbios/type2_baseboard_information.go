@@ -52,11 +52,36 @@ func ParseBaseboardInfo(t *Table) (*BaseboardInfo, error) {
 				return nil, err
 			}
 			bi.ContainedObjectHandles = append(bi.ContainedObjectHandles, h)
+			off += 2
 		}
 	}
 	return bi, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+// NumberOfContainedObjectHandles is set from ContainedObjectHandles.
+func (bi *BaseboardInfo) ToTable() (*Table, error) {
+	t, err := newTable(TableTypeBaseboardInfo, &bi.Table, bi)
+	if err != nil {
+		return nil, err
+	}
+	if t.Len() == 0x0f {
+		if len(bi.ContainedObjectHandles) > 0xff {
+			return nil, errors.New("too many contained object handles")
+		}
+		t.data[0x0e] = uint8(len(bi.ContainedObjectHandles))
+		for _, h := range bi.ContainedObjectHandles {
+			t.data = append(t.data, uint8(h), uint8(h>>8))
+		}
+	} else if len(bi.ContainedObjectHandles) > 0 {
+		return nil, errors.New("table is too short for contained object handles")
+	}
+	if err := t.setLength(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
 func (bi *BaseboardInfo) String() string {
 	lines := []string{
 		bi.Header.String(),
@@ -64,15 +89,29 @@ func (bi *BaseboardInfo) String() string {
 		fmt.Sprintf("Product Name: %s", bi.Product),
 		fmt.Sprintf("Version: %s", bi.Version),
 		fmt.Sprintf("Serial Number: %s", bi.SerialNumber),
-		fmt.Sprintf("Asset Tag: %s", bi.AssetTag),
-		fmt.Sprintf("Features:\n%s", bi.BoardFeatures),
-		fmt.Sprintf("Location In Chassis: %s", bi.LocationInChassis),
-		fmt.Sprintf("Chassis Handle: 0x%04X", bi.ChassisHandle),
-		fmt.Sprintf("Type: %s", bi.BoardType),
-		fmt.Sprintf("Contained Object Handles: %d", bi.NumberOfContainedObjectHandles),
 	}
-	for _, h := range bi.ContainedObjectHandles {
-		lines = append(lines, fmt.Sprintf("0x%04X", h))
+	if bi.Len() >= 0x9 {
+		lines = append(lines, fmt.Sprintf("Asset Tag: %s", bi.AssetTag))
+	}
+	if bi.Len() >= 0xa {
+		if bi.BoardFeatures&0x1f == 0 {
+			lines = append(lines, "Features: None")
+		} else {
+			lines = append(lines, fmt.Sprintf("Features:\n%s", bi.BoardFeatures))
+		}
+	}
+	if bi.Len() >= 0xe {
+		lines = append(lines,
+			fmt.Sprintf("Location In Chassis: %s", bi.LocationInChassis),
+			fmt.Sprintf("Chassis Handle: 0x%04X", bi.ChassisHandle),
+			fmt.Sprintf("Type: %s", bi.BoardType),
+		)
+	}
+	if bi.Len() >= 0xf {
+		lines = append(lines, fmt.Sprintf("Contained Object Handles: %d", bi.NumberOfContainedObjectHandles))
+		for _, h := range bi.ContainedObjectHandles {
+			lines = append(lines, fmt.Sprintf("\t0x%04X", h))
+		}
 	}
 	return strings.Join(lines, "\n\t")
 }
@@ -148,5 +187,5 @@ func (v BoardType) String() string {
 	if name, ok := names[v]; ok {
 		return name
 	}
-	return fmt.Sprintf("%#x", uint8(v))
+	return outOfSpec
 }
@@ -0,0 +1,87 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Much of this is auto-generated. If adding a new type, see README for instructions.
+
+// SystemBootInfo is defined in DSP0134 7.33.
+type SystemBootInfo struct {
+	Table
+	BootStatus SystemBootStatus `smbios:"skip=6"` // 0Ah
+}
+
+// NewSystemBootInfo parses a generic Table into SystemBootInfo.
+func NewSystemBootInfo(t *Table) (*SystemBootInfo, error) {
+	if t.Type != TableTypeSystemBootInfo {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0xb {
+		return nil, errors.New("required fields missing")
+	}
+	bi := &SystemBootInfo{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, bi); err != nil {
+		return nil, err
+	}
+	return bi, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+func (bi *SystemBootInfo) ToTable() (*Table, error) {
+	return toTable(TableTypeSystemBootInfo, &bi.Table, bi)
+}
+
+func (bi *SystemBootInfo) String() string {
+	lines := []string{
+		bi.Header.String(),
+		fmt.Sprintf("Status: %s", bi.BootStatus),
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// SystemBootStatus is defined in DSP0134 7.33.2.
+type SystemBootStatus uint8
+
+// SystemBootStatus values are defined in DSP0134 7.33.2.
+const (
+	SystemBootStatusNoErrors                 SystemBootStatus = 0x00 // No errors detected
+	SystemBootStatusNoBootableMedia          SystemBootStatus = 0x01 // No bootable media
+	SystemBootStatusOSFailedToLoad           SystemBootStatus = 0x02 // "normal" operating system failed to load
+	SystemBootStatusFirmwareHardwareFailure  SystemBootStatus = 0x03 // Firmware-detected hardware failure
+	SystemBootStatusOSHardwareFailure        SystemBootStatus = 0x04 // Operating system-detected hardware failure
+	SystemBootStatusUserRequestedBoot        SystemBootStatus = 0x05 // User-requested boot
+	SystemBootStatusSecurityViolation        SystemBootStatus = 0x06 // System security violation
+	SystemBootStatusPreviouslyRequestedImage SystemBootStatus = 0x07 // Previously-requested image
+	SystemBootStatusWatchdogExpired          SystemBootStatus = 0x08 // System watchdog timer expired
+)
+
+func (v SystemBootStatus) String() string {
+	names := map[SystemBootStatus]string{
+		SystemBootStatusNoErrors:                 "No errors detected",
+		SystemBootStatusNoBootableMedia:          "No bootable media",
+		SystemBootStatusOSFailedToLoad:           "Operating system failed to load",
+		SystemBootStatusFirmwareHardwareFailure:  "Firmware-detected hardware failure",
+		SystemBootStatusOSHardwareFailure:        "Operating system-detected hardware failure",
+		SystemBootStatusUserRequestedBoot:        "User-requested boot",
+		SystemBootStatusSecurityViolation:        "System security violation",
+		SystemBootStatusPreviouslyRequestedImage: "Previously-requested image",
+		SystemBootStatusWatchdogExpired:          "System watchdog timer expired",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	switch {
+	case v >= 128 && v <= 191:
+		return "OEM-specific"
+	case v >= 192:
+		return "Product-specific"
+	}
+	return outOfSpec
+}
@@ -39,6 +39,11 @@ func ParseIPMIDeviceInfo(t *Table) (*IPMIDeviceInfo, error) {
 	return di, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (di *IPMIDeviceInfo) ToTable() (*Table, error) {
+	return toTable(TableTypeIPMIDeviceInfo, &di.Table, di)
+}
+
 func (di *IPMIDeviceInfo) String() string {
 	nvs := "Not Present"
 	if di.NVStorageDeviceAddress != 0xff {
@@ -0,0 +1,216 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Much of this is auto-generated. If adding a new type, see README for instructions.
+
+// SystemPowerSupply is defined in DSP0134 7.40.
+type SystemPowerSupply struct {
+	Table
+	PowerUnitGroup             uint8                      // 04h
+	Location                   string                     // 05h
+	DeviceName                 string                     // 06h
+	Manufacturer               string                     // 07h
+	SerialNumber               string                     // 08h
+	AssetTagNumber             string                     // 09h
+	ModelPartNumber            string                     // 0Ah
+	RevisionLevel              string                     // 0Bh
+	MaxPowerCapacity           uint16                     // 0Ch
+	PowerSupplyCharacteristics PowerSupplyCharacteristics // 0Eh
+	InputVoltageProbeHandle    uint16                     // 10h
+	CoolingDeviceHandle        uint16                     // 12h
+	InputCurrentProbeHandle    uint16                     // 14h
+}
+
+// NewSystemPowerSupply parses a generic Table into SystemPowerSupply.
+func NewSystemPowerSupply(t *Table) (*SystemPowerSupply, error) {
+	if t.Type != TableTypeSystemPowerSupply {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0x10 {
+		return nil, errors.New("required fields missing")
+	}
+	ps := &SystemPowerSupply{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, ps); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+func (ps *SystemPowerSupply) ToTable() (*Table, error) {
+	return toTable(TableTypeSystemPowerSupply, &ps.Table, ps)
+}
+
+func (ps *SystemPowerSupply) String() string {
+	lines := []string{
+		ps.Header.String(),
+	}
+	if ps.PowerUnitGroup != 0 {
+		lines = append(lines, fmt.Sprintf("Power Unit Group: %d", ps.PowerUnitGroup))
+	}
+	maxPower := "Unknown"
+	if ps.MaxPowerCapacity != 0x8000 {
+		maxPower = fmt.Sprintf("%d W", ps.MaxPowerCapacity)
+	}
+	c := ps.PowerSupplyCharacteristics
+	status := "Not Present"
+	if c.Present() {
+		status = fmt.Sprintf("Present, %s", c.Status())
+	}
+	lines = append(lines,
+		fmt.Sprintf("Location: %s", ps.Location),
+		fmt.Sprintf("Name: %s", ps.DeviceName),
+		fmt.Sprintf("Manufacturer: %s", ps.Manufacturer),
+		fmt.Sprintf("Serial Number: %s", ps.SerialNumber),
+		fmt.Sprintf("Asset Tag: %s", ps.AssetTagNumber),
+		fmt.Sprintf("Model Part Number: %s", ps.ModelPartNumber),
+		fmt.Sprintf("Revision: %s", ps.RevisionLevel),
+		fmt.Sprintf("Max Power Capacity: %s", maxPower),
+		fmt.Sprintf("Status: %s", status),
+		fmt.Sprintf("Type: %s", c.Type()),
+		fmt.Sprintf("Input Voltage Range Switching: %s", c.InputVoltageRangeSwitching()),
+		fmt.Sprintf("Plugged: %s", yesNo(!c.Unplugged())),
+		fmt.Sprintf("Hot Replaceable: %s", yesNo(c.HotReplaceable())),
+	)
+	if ps.Len() < 0x16 {
+		return strings.Join(lines, "\n\t")
+	}
+	if ps.InputVoltageProbeHandle != 0xffff {
+		lines = append(lines, fmt.Sprintf("Input Voltage Probe Handle: 0x%04X", ps.InputVoltageProbeHandle))
+	}
+	if ps.CoolingDeviceHandle != 0xffff {
+		lines = append(lines, fmt.Sprintf("Cooling Device Handle: 0x%04X", ps.CoolingDeviceHandle))
+	}
+	if ps.InputCurrentProbeHandle != 0xffff {
+		lines = append(lines, fmt.Sprintf("Input Current Probe Handle: 0x%04X", ps.InputCurrentProbeHandle))
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// PowerSupplyCharacteristics is defined in DSP0134 7.40.1.
+type PowerSupplyCharacteristics uint16
+
+// HotReplaceable returns true if the power supply is hot-replaceable.
+func (c PowerSupplyCharacteristics) HotReplaceable() bool {
+	return c&(1<<0) != 0
+}
+
+// Present returns true if the power supply is present.
+func (c PowerSupplyCharacteristics) Present() bool {
+	return c&(1<<1) != 0
+}
+
+// Unplugged returns true if the power supply is unplugged from the wall.
+func (c PowerSupplyCharacteristics) Unplugged() bool {
+	return c&(1<<2) != 0
+}
+
+// InputVoltageRangeSwitching returns the input voltage range switching.
+func (c PowerSupplyCharacteristics) InputVoltageRangeSwitching() PowerSupplyRangeSwitching {
+	return PowerSupplyRangeSwitching((c >> 3) & 0xf)
+}
+
+// Status returns the power supply status.
+func (c PowerSupplyCharacteristics) Status() PowerSupplyStatus {
+	return PowerSupplyStatus((c >> 7) & 0x7)
+}
+
+// Type returns the power supply type.
+func (c PowerSupplyCharacteristics) Type() PowerSupplyType {
+	return PowerSupplyType((c >> 10) & 0xf)
+}
+
+// PowerSupplyRangeSwitching is defined in DSP0134 7.40.1.
+type PowerSupplyRangeSwitching uint8
+
+// PowerSupplyRangeSwitching values are defined in DSP0134 7.40.1.
+const (
+	PowerSupplyRangeSwitchingOther         PowerSupplyRangeSwitching = 0x01 // Other
+	PowerSupplyRangeSwitchingUnknown       PowerSupplyRangeSwitching = 0x02 // Unknown
+	PowerSupplyRangeSwitchingManual        PowerSupplyRangeSwitching = 0x03 // Manual
+	PowerSupplyRangeSwitchingAutoSwitch    PowerSupplyRangeSwitching = 0x04 // Auto-switch
+	PowerSupplyRangeSwitchingWideRange     PowerSupplyRangeSwitching = 0x05 // Wide range
+	PowerSupplyRangeSwitchingNotApplicable PowerSupplyRangeSwitching = 0x06 // Not applicable
+)
+
+func (v PowerSupplyRangeSwitching) String() string {
+	names := map[PowerSupplyRangeSwitching]string{
+		PowerSupplyRangeSwitchingOther:         "Other",
+		PowerSupplyRangeSwitchingUnknown:       "Unknown",
+		PowerSupplyRangeSwitchingManual:        "Manual",
+		PowerSupplyRangeSwitchingAutoSwitch:    "Auto-switch",
+		PowerSupplyRangeSwitchingWideRange:     "Wide Range",
+		PowerSupplyRangeSwitchingNotApplicable: "N/A",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// PowerSupplyStatus is defined in DSP0134 7.40.1.
+type PowerSupplyStatus uint8
+
+// PowerSupplyStatus values are defined in DSP0134 7.40.1.
+const (
+	PowerSupplyStatusOther       PowerSupplyStatus = 0x01 // Other
+	PowerSupplyStatusUnknown     PowerSupplyStatus = 0x02 // Unknown
+	PowerSupplyStatusOK          PowerSupplyStatus = 0x03 // OK
+	PowerSupplyStatusNonCritical PowerSupplyStatus = 0x04 // Non-critical
+	PowerSupplyStatusCritical    PowerSupplyStatus = 0x05 // Critical; power supply has failed and has been taken off-line
+)
+
+func (v PowerSupplyStatus) String() string {
+	names := map[PowerSupplyStatus]string{
+		PowerSupplyStatusOther:       "Other",
+		PowerSupplyStatusUnknown:     "Unknown",
+		PowerSupplyStatusOK:          "OK",
+		PowerSupplyStatusNonCritical: "Non-critical",
+		PowerSupplyStatusCritical:    "Critical",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// PowerSupplyType is defined in DSP0134 7.40.1.
+type PowerSupplyType uint8
+
+// PowerSupplyType values are defined in DSP0134 7.40.1.
+const (
+	PowerSupplyTypeOther     PowerSupplyType = 0x01 // Other
+	PowerSupplyTypeUnknown   PowerSupplyType = 0x02 // Unknown
+	PowerSupplyTypeLinear    PowerSupplyType = 0x03 // Linear
+	PowerSupplyTypeSwitching PowerSupplyType = 0x04 // Switching
+	PowerSupplyTypeBattery   PowerSupplyType = 0x05 // Battery
+	PowerSupplyTypeUPS       PowerSupplyType = 0x06 // UPS
+	PowerSupplyTypeConverter PowerSupplyType = 0x07 // Converter
+	PowerSupplyTypeRegulator PowerSupplyType = 0x08 // Regulator
+)
+
+func (v PowerSupplyType) String() string {
+	names := map[PowerSupplyType]string{
+		PowerSupplyTypeOther:     "Other",
+		PowerSupplyTypeUnknown:   "Unknown",
+		PowerSupplyTypeLinear:    "Linear",
+		PowerSupplyTypeSwitching: "Switching",
+		PowerSupplyTypeBattery:   "Battery",
+		PowerSupplyTypeUPS:       "UPS",
+		PowerSupplyTypeConverter: "Converter",
+		PowerSupplyTypeRegulator: "Regulator",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
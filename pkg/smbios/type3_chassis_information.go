@@ -75,6 +75,45 @@ func ParseChassisInfo(t *Table) (*ChassisInfo, error) {
 	return si, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+// ContainedElementCount is set from ContainedElements, and the record length
+// is that of ChassisContainedElement.
+func (si *ChassisInfo) ToTable() (*Table, error) {
+	t, err := newTable(TableTypeChassisInfo, &si.Table, si)
+	if err != nil {
+		return nil, err
+	}
+	if t.Len() < 0x15 {
+		if len(si.ContainedElements) > 0 || si.SKUNumber != "" {
+			return nil, errors.New("table is too short for contained elements and SKU number")
+		}
+	} else {
+		if len(si.ContainedElements) > 0xff {
+			return nil, errors.New("too many contained elements")
+		}
+		t.data[0x13] = uint8(len(si.ContainedElements))
+		t.data[0x14] = 0
+		if len(si.ContainedElements) > 0 {
+			t.data[0x14] = uint8(binary.Size(ChassisContainedElement{}))
+		}
+		for _, e := range si.ContainedElements {
+			t.data = append(t.data, uint8(e.Type), e.Min, e.Max)
+		}
+		// Tables from before 2.7 have no SKU number.
+		if si.Len() == 0 || si.Len() > 0x15+int(si.ContainedElementCount)*int(si.ContainedElementsRecordLength) || si.SKUNumber != "" {
+			idx, err := t.addString(si.SKUNumber)
+			if err != nil {
+				return nil, err
+			}
+			t.data = append(t.data, idx)
+		}
+	}
+	if err := t.setLength(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
 func (si *ChassisInfo) String() string {
 	lockStr := "Not Present"
 	if si.Type&0x80 != 0 {
@@ -82,14 +121,19 @@ func (si *ChassisInfo) String() string {
 	}
 	lines := []string{
 		si.Header.String(),
+	}
+	if si.Len() < 0x9 {
+		return strings.Join(lines, "\n\t")
+	}
+	lines = append(lines,
 		fmt.Sprintf("Manufacturer: %s", si.Manufacturer),
 		fmt.Sprintf("Type: %s", si.Type),
 		fmt.Sprintf("Lock: %s", lockStr),
 		fmt.Sprintf("Version: %s", si.Version),
 		fmt.Sprintf("Serial Number: %s", si.SerialNumber),
 		fmt.Sprintf("Asset Tag: %s", si.AssetTagNumber),
-	}
-	if si.Len() >= 9 { // 2.1+
+	)
+	if si.Len() >= 0xd { // 2.1+
 		lines = append(lines,
 			fmt.Sprintf("Boot-up State: %s", si.BootupState),
 			fmt.Sprintf("Power Supply State: %s", si.PowerSupplyState),
@@ -97,7 +141,10 @@ func (si *ChassisInfo) String() string {
 			fmt.Sprintf("Security Status: %s", si.SecurityStatus),
 		)
 	}
-	if si.Len() >= 0xd { // 2.3+
+	if si.Len() >= 0x11 { // 2.3+
+		lines = append(lines, fmt.Sprintf("OEM Information: 0x%08X", si.OEMInfo))
+	}
+	if si.Len() >= 0x13 {
 		heightStr, numPCStr := "Unspecified", "Unspecified"
 		if si.Height != 0 {
 			heightStr = fmt.Sprintf("%d U", si.Height)
@@ -106,16 +153,21 @@ func (si *ChassisInfo) String() string {
 			numPCStr = fmt.Sprintf("%d", si.NumberOfPowerCords)
 		}
 		lines = append(lines,
-			fmt.Sprintf("OEM Information: 0x%08X", si.OEMInfo),
 			fmt.Sprintf("Height: %s", heightStr),
 			fmt.Sprintf("Number Of Power Cords: %s", numPCStr),
 		)
+	}
+	if si.Len() >= 0x15 {
 		lines = append(lines,
 			fmt.Sprintf("Contained Elements: %d", si.ContainedElementCount),
 		)
 		for _, e := range si.ContainedElements {
+			r := fmt.Sprintf("%d-%d", e.Min, e.Max)
+			if e.Min == e.Max {
+				r = fmt.Sprintf("%d", e.Min)
+			}
 			lines = append(lines,
-				fmt.Sprintf("\t%s %d-%d", e.Type, e.Min, e.Max),
+				fmt.Sprintf("\t%s (%s)", e.Type, r),
 			)
 		}
 	}
@@ -307,7 +359,64 @@ type ChassisElementType uint8
 
 func (v ChassisElementType) String() string {
 	if v&0x80 != 0 {
-		return TableType(v & 0x7f).String()
+		return structureTypeName(TableType(v & 0x7f))
 	}
 	return BoardType(v & 0x7f).String()
 }
+
+// structureTypeName returns the short name of a table type, as used by
+// dmidecode(8) when referring to other structures.
+func structureTypeName(t TableType) string {
+	names := []string{
+		"BIOS", // 0
+		"System",
+		"Base Board",
+		"Chassis",
+		"Processor",
+		"Memory Controller",
+		"Memory Module",
+		"Cache",
+		"Port Connector",
+		"System Slots",
+		"On Board Devices", // 10
+		"OEM Strings",
+		"System Configuration Options",
+		"BIOS Language",
+		"Group Associations",
+		"System Event Log",
+		"Physical Memory Array",
+		"Memory Device",
+		"32-bit Memory Error",
+		"Memory Array Mapped Address",
+		"Memory Device Mapped Address", // 20
+		"Built-in Pointing Device",
+		"Portable Battery",
+		"System Reset",
+		"Hardware Security",
+		"System Power Controls",
+		"Voltage Probe",
+		"Cooling Device",
+		"Temperature Probe",
+		"Electrical Current Probe",
+		"Out-of-band Remote Access", // 30
+		"Boot Integrity Services",
+		"System Boot",
+		"64-bit Memory Error",
+		"Management Device",
+		"Management Device Component",
+		"Management Device Threshold Data",
+		"Memory Channel",
+		"IPMI Device",
+		"Power Supply",
+		"Additional Information", // 40
+		"Onboard Device",
+		"Management Controller Host Interface",
+	}
+	if t >= 0x80 {
+		return "OEM-specific"
+	}
+	if int(t) < len(names) {
+		return names[t]
+	}
+	return outOfSpec
+}
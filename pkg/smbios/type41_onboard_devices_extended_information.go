@@ -0,0 +1,106 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Much of this is auto-generated. If adding a new type, see README for instructions.
+
+// OnboardDevicesExtendedInfo is defined in DSP0134 7.42.
+type OnboardDevicesExtendedInfo struct {
+	Table
+	ReferenceDesignation string            // 04h
+	DeviceType           OnboardDeviceType // 05h
+	DeviceTypeInstance   uint8             // 06h
+	SegmentGroupNumber   uint16            // 07h
+	BusNumber            uint8             // 09h
+	DeviceFunctionNumber uint8             // 0Ah
+}
+
+// NewOnboardDevicesExtendedInfo parses a generic Table into OnboardDevicesExtendedInfo.
+func NewOnboardDevicesExtendedInfo(t *Table) (*OnboardDevicesExtendedInfo, error) {
+	if t.Type != TableTypeOnboardDevicesExtendedInfo {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0xb {
+		return nil, errors.New("required fields missing")
+	}
+	od := &OnboardDevicesExtendedInfo{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, od); err != nil {
+		return nil, err
+	}
+	return od, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+func (od *OnboardDevicesExtendedInfo) ToTable() (*Table, error) {
+	return toTable(TableTypeOnboardDevicesExtendedInfo, &od.Table, od)
+}
+
+func (od *OnboardDevicesExtendedInfo) String() string {
+	status := "Disabled"
+	if od.DeviceType.Enabled() {
+		status = "Enabled"
+	}
+	lines := []string{
+		od.Header.String(),
+		fmt.Sprintf("Reference Designation: %s", od.ReferenceDesignation),
+		fmt.Sprintf("Type: %s", od.DeviceType),
+		fmt.Sprintf("Status: %s", status),
+		fmt.Sprintf("Type Instance: %d", od.DeviceTypeInstance),
+	}
+	if addr := busAddress(od.SegmentGroupNumber, od.BusNumber, od.DeviceFunctionNumber); addr != "" {
+		lines = append(lines, fmt.Sprintf("Bus Address: %s", addr))
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// OnboardDeviceType is defined in DSP0134 7.42.2. Bit 7 is the device status.
+type OnboardDeviceType uint8
+
+// OnboardDeviceType values are defined in DSP0134 7.42.2.
+const (
+	OnboardDeviceTypeOther          OnboardDeviceType = 0x01 // Other
+	OnboardDeviceTypeUnknown        OnboardDeviceType = 0x02 // Unknown
+	OnboardDeviceTypeVideo          OnboardDeviceType = 0x03 // Video
+	OnboardDeviceTypeSCSIController OnboardDeviceType = 0x04 // SCSI Controller
+	OnboardDeviceTypeEthernet       OnboardDeviceType = 0x05 // Ethernet
+	OnboardDeviceTypeTokenRing      OnboardDeviceType = 0x06 // Token Ring
+	OnboardDeviceTypeSound          OnboardDeviceType = 0x07 // Sound
+	OnboardDeviceTypePATAController OnboardDeviceType = 0x08 // PATA Controller
+	OnboardDeviceTypeSATAController OnboardDeviceType = 0x09 // SATA Controller
+	OnboardDeviceTypeSASController  OnboardDeviceType = 0x0a // SAS Controller
+
+	// OnboardDeviceTypeEnabled is set if the device is enabled.
+	OnboardDeviceTypeEnabled OnboardDeviceType = 0x80
+)
+
+// Enabled returns true if the device is enabled.
+func (v OnboardDeviceType) Enabled() bool {
+	return v&OnboardDeviceTypeEnabled != 0
+}
+
+func (v OnboardDeviceType) String() string {
+	names := map[OnboardDeviceType]string{
+		OnboardDeviceTypeOther:          "Other",
+		OnboardDeviceTypeUnknown:        "Unknown",
+		OnboardDeviceTypeVideo:          "Video",
+		OnboardDeviceTypeSCSIController: "SCSI Controller",
+		OnboardDeviceTypeEthernet:       "Ethernet",
+		OnboardDeviceTypeTokenRing:      "Token Ring",
+		OnboardDeviceTypeSound:          "Sound",
+		OnboardDeviceTypePATAController: "PATA Controller",
+		OnboardDeviceTypeSATAController: "SATA Controller",
+		OnboardDeviceTypeSASController:  "SAS Controller",
+	}
+	if name, ok := names[v&^OnboardDeviceTypeEnabled]; ok {
+		return name
+	}
+	return outOfSpec
+}
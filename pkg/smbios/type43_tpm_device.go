@@ -15,7 +15,7 @@ import (
 // TPMDevice is defined in DSP0134 7.44.
 type TPMDevice struct {
 	Table
-	VendorID         TPMDeviceVendorID        `smbios:"-,skip=4"` // 04h
+	VendorID         TPMDeviceVendorID        // 04h
 	MajorSpecVersion uint8                    // 08h
 	MinorSpecVersion uint8                    // 09h
 	FirmwareVersion1 uint32                   // 0Ah
@@ -37,11 +37,14 @@ func NewTPMDevice(t *Table) (*TPMDevice, error) {
 	if _, err := parseStruct(t, 0 /* off */, false /* complete */, di); err != nil {
 		return nil, err
 	}
-	vid, _ := di.GetBytesAt(4, 4)
-	copy(di.VendorID[:], vid)
 	return di, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (di *TPMDevice) ToTable() (*Table, error) {
+	return toTable(TableTypeTPMDevice, &di.Table, di)
+}
+
 func (di *TPMDevice) String() string {
 	lines := []string{
 		di.Header.String(),
@@ -69,6 +72,22 @@ func (di *TPMDevice) String() string {
 // TPMDeviceVendorID is defined in TCG Vendor ID Registry.
 type TPMDeviceVendorID [4]byte
 
+// ParseField parses TPM vendor ID field within a table.
+func (vid *TPMDeviceVendorID) ParseField(t *Table, off int) (int, error) {
+	b, err := t.GetBytesAt(off, 4)
+	if err != nil {
+		return off, err
+	}
+	copy(vid[:], b)
+	return off + 4, nil
+}
+
+// WriteField writes TPM vendor ID field within a table.
+func (vid *TPMDeviceVendorID) WriteField(t *Table) error {
+	t.data = append(t.data, vid[:]...)
+	return nil
+}
+
 func (vid TPMDeviceVendorID) String() string {
 	// DSP0134 specifies Vendor ID field as 4 BYTEs, not a DWORD, and gives an example value.
 	// But Infineon ignores it and puts their VID in LE byte order so it ends up backwards.
@@ -107,6 +107,11 @@ func (pi *ProcessorInfo) GetThreadCount() int {
 	return int(pi.ThreadCount)
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (pi *ProcessorInfo) ToTable() (*Table, error) {
+	return toTable(TableTypeProcessorInfo, &pi.Table, pi)
+}
+
 func (pi *ProcessorInfo) String() string {
 	freqStr := func(v uint16) string {
 		if v == 0 {
@@ -252,7 +257,11 @@ func (pi *ProcessorInfo) String() string {
 		if pi.GetThreadCount() > 0 {
 			lines = append(lines, fmt.Sprintf("Thread Count: %d", pi.GetThreadCount()))
 		}
-		lines = append(lines, fmt.Sprintf("Characteristics:\n%s", pi.Characteristics))
+		if pi.Characteristics&^(ProcessorCharacteristicsReserved|ProcessorCharacteristicsUnknown) == 0 {
+			lines = append(lines, "Characteristics: None")
+		} else {
+			lines = append(lines, fmt.Sprintf("Characteristics:\n%s", pi.Characteristics))
+		}
 	}
 	return strings.Join(lines, "\n\t")
 }
@@ -891,13 +900,8 @@ const (
 )
 
 func (v ProcessorCharacteristics) String() string {
+	// Like dmidecode(8), leave out the reserved and unknown bits.
 	var lines []string
-	if v&ProcessorCharacteristicsReserved != 0 {
-		lines = append(lines, "Reserved")
-	}
-	if v&ProcessorCharacteristicsUnknown != 0 {
-		lines = append(lines, "Unknown")
-	}
 	if v&ProcessorCharacteristics64bitCapable != 0 {
 		lines = append(lines, "64-bit capable")
 	}
@@ -45,6 +45,11 @@ func ParseCacheInfo(t *Table) (*CacheInfo, error) {
 	return ci, nil
 }
 
+// ToTable encodes the table, with any changes made to its fields.
+func (ci *CacheInfo) ToTable() (*Table, error) {
+	return toTable(TableTypeCacheInfo, &ci.Table, ci)
+}
+
 func cacheSizeBytes2Or1(size1 uint16, size2 uint32) uint64 {
 	mul2 := uint64(1024)
 	if size2&0x80000000 != 0 {
@@ -115,8 +120,8 @@ func (ci *CacheInfo) String() string {
 		fmt.Sprintf("Configuration: %s, %s, Level %d", enDis, sock, (ci.Configuration&7)+1),
 		fmt.Sprintf("Operational Mode: %s", om),
 		fmt.Sprintf("Location: %s", loc),
-		fmt.Sprintf("Installed Size: %s", kmgt(ci.GetInstalledSizeBytes())),
-		fmt.Sprintf("Maximum Size: %s", kmgt(ci.GetMaxSizeBytes())),
+		fmt.Sprintf("Installed Size: %s", dmiMemorySize(ci.GetInstalledSizeBytes()>>10, 1)),
+		fmt.Sprintf("Maximum Size: %s", dmiMemorySize(ci.GetMaxSizeBytes()>>10, 1)),
 		fmt.Sprintf("Supported SRAM Types:\n%s", ci.SupportedSRAMType),
 		fmt.Sprintf("Installed SRAM Type: %s", strings.TrimSpace(ci.CurrentSRAMType.String())),
 	}
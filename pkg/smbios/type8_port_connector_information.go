@@ -0,0 +1,245 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Much of this is auto-generated. If adding a new type, see README for instructions.
+
+// PortConnectorInfo is defined in DSP0134 7.9.
+type PortConnectorInfo struct {
+	Table
+	InternalReferenceDesignator string            // 04h
+	InternalConnectorType       PortConnectorType // 05h
+	ExternalReferenceDesignator string            // 06h
+	ExternalConnectorType       PortConnectorType // 07h
+	PortType                    PortType          // 08h
+}
+
+// NewPortConnectorInfo parses a generic Table into PortConnectorInfo.
+func NewPortConnectorInfo(t *Table) (*PortConnectorInfo, error) {
+	if t.Type != TableTypePortConnectorInfo {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0x9 {
+		return nil, errors.New("required fields missing")
+	}
+	pi := &PortConnectorInfo{Table: *t}
+	if _, err := parseStruct(t, 0 /* off */, false /* complete */, pi); err != nil {
+		return nil, err
+	}
+	return pi, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+func (pi *PortConnectorInfo) ToTable() (*Table, error) {
+	return toTable(TableTypePortConnectorInfo, &pi.Table, pi)
+}
+
+func (pi *PortConnectorInfo) String() string {
+	lines := []string{
+		pi.Header.String(),
+		fmt.Sprintf("Internal Reference Designator: %s", pi.InternalReferenceDesignator),
+		fmt.Sprintf("Internal Connector Type: %s", pi.InternalConnectorType),
+		fmt.Sprintf("External Reference Designator: %s", pi.ExternalReferenceDesignator),
+		fmt.Sprintf("External Connector Type: %s", pi.ExternalConnectorType),
+		fmt.Sprintf("Port Type: %s", pi.PortType),
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// PortConnectorType is defined in DSP0134 7.9.2.
+type PortConnectorType uint8
+
+// PortConnectorType values are defined in DSP0134 7.9.2.
+const (
+	PortConnectorTypeNone                       PortConnectorType = 0x00 // None
+	PortConnectorTypeCentronics                 PortConnectorType = 0x01 // Centronics
+	PortConnectorTypeMiniCentronics             PortConnectorType = 0x02 // Mini Centronics
+	PortConnectorTypeProprietary                PortConnectorType = 0x03 // Proprietary
+	PortConnectorTypeDB25PinMale                PortConnectorType = 0x04 // DB-25 pin male
+	PortConnectorTypeDB25PinFemale              PortConnectorType = 0x05 // DB-25 pin female
+	PortConnectorTypeDB15PinMale                PortConnectorType = 0x06 // DB-15 pin male
+	PortConnectorTypeDB15PinFemale              PortConnectorType = 0x07 // DB-15 pin female
+	PortConnectorTypeDB9PinMale                 PortConnectorType = 0x08 // DB-9 pin male
+	PortConnectorTypeDB9PinFemale               PortConnectorType = 0x09 // DB-9 pin female
+	PortConnectorTypeRJ11                       PortConnectorType = 0x0a // RJ-11
+	PortConnectorTypeRJ45                       PortConnectorType = 0x0b // RJ-45
+	PortConnectorType50PinMiniSCSI              PortConnectorType = 0x0c // 50-pin MiniSCSI
+	PortConnectorTypeMiniDIN                    PortConnectorType = 0x0d // Mini-DIN
+	PortConnectorTypeMicroDIN                   PortConnectorType = 0x0e // Micro-DIN
+	PortConnectorTypePS2                        PortConnectorType = 0x0f // PS/2
+	PortConnectorTypeInfrared                   PortConnectorType = 0x10 // Infrared
+	PortConnectorTypeHPHIL                      PortConnectorType = 0x11 // HP-HIL
+	PortConnectorTypeAccessBusUSB               PortConnectorType = 0x12 // Access Bus (USB)
+	PortConnectorTypeSSASCSI                    PortConnectorType = 0x13 // SSA SCSI
+	PortConnectorTypeCircularDIN8Male           PortConnectorType = 0x14 // Circular DIN-8 male
+	PortConnectorTypeCircularDIN8Female         PortConnectorType = 0x15 // Circular DIN-8 female
+	PortConnectorTypeOnBoardIDE                 PortConnectorType = 0x16 // On Board IDE
+	PortConnectorTypeOnBoardFloppy              PortConnectorType = 0x17 // On Board Floppy
+	PortConnectorType9PinDualInline             PortConnectorType = 0x18 // 9-pin Dual Inline (pin 10 cut)
+	PortConnectorType25PinDualInline            PortConnectorType = 0x19 // 25-pin Dual Inline (pin 26 cut)
+	PortConnectorType50PinDualInline            PortConnectorType = 0x1a // 50-pin Dual Inline
+	PortConnectorType68PinDualInline            PortConnectorType = 0x1b // 68-pin Dual Inline
+	PortConnectorTypeOnBoardSoundInputFromCDROM PortConnectorType = 0x1c // On Board Sound Input from CD-ROM
+	PortConnectorTypeMiniCentronicsType14       PortConnectorType = 0x1d // Mini-Centronics Type-14
+	PortConnectorTypeMiniCentronicsType26       PortConnectorType = 0x1e // Mini-Centronics Type-26
+	PortConnectorTypeMiniJackHeadphones         PortConnectorType = 0x1f // Mini-jack (headphones)
+	PortConnectorTypeBNC                        PortConnectorType = 0x20 // BNC
+	PortConnectorType1394                       PortConnectorType = 0x21 // 1394
+	PortConnectorTypeSASSATAPlugReceptacle      PortConnectorType = 0x22 // SAS/SATA Plug Receptacle
+	PortConnectorTypeUSBTypeCReceptacle         PortConnectorType = 0x23 // USB Type-C Receptacle
+	PortConnectorTypePC98                       PortConnectorType = 0xa0 // PC-98
+	PortConnectorTypePC98Hireso                 PortConnectorType = 0xa1 // PC-98Hireso
+	PortConnectorTypePCH98                      PortConnectorType = 0xa2 // PC-H98
+	PortConnectorTypePC98Note                   PortConnectorType = 0xa3 // PC-98Note
+	PortConnectorTypePC98Full                   PortConnectorType = 0xa4 // PC-98Full
+	PortConnectorTypeOther                      PortConnectorType = 0xff // Other
+)
+
+func (v PortConnectorType) String() string {
+	names := map[PortConnectorType]string{
+		PortConnectorTypeNone:                       "None",
+		PortConnectorTypeCentronics:                 "Centronics",
+		PortConnectorTypeMiniCentronics:             "Mini Centronics",
+		PortConnectorTypeProprietary:                "Proprietary",
+		PortConnectorTypeDB25PinMale:                "DB-25 male",
+		PortConnectorTypeDB25PinFemale:              "DB-25 female",
+		PortConnectorTypeDB15PinMale:                "DB-15 male",
+		PortConnectorTypeDB15PinFemale:              "DB-15 female",
+		PortConnectorTypeDB9PinMale:                 "DB-9 male",
+		PortConnectorTypeDB9PinFemale:               "DB-9 female",
+		PortConnectorTypeRJ11:                       "RJ-11",
+		PortConnectorTypeRJ45:                       "RJ-45",
+		PortConnectorType50PinMiniSCSI:              "50 Pin MiniSCSI",
+		PortConnectorTypeMiniDIN:                    "Mini DIN",
+		PortConnectorTypeMicroDIN:                   "Micro DIN",
+		PortConnectorTypePS2:                        "PS/2",
+		PortConnectorTypeInfrared:                   "Infrared",
+		PortConnectorTypeHPHIL:                      "HP-HIL",
+		PortConnectorTypeAccessBusUSB:               "Access Bus (USB)",
+		PortConnectorTypeSSASCSI:                    "SSA SCSI",
+		PortConnectorTypeCircularDIN8Male:           "Circular DIN-8 male",
+		PortConnectorTypeCircularDIN8Female:         "Circular DIN-8 female",
+		PortConnectorTypeOnBoardIDE:                 "On Board IDE",
+		PortConnectorTypeOnBoardFloppy:              "On Board Floppy",
+		PortConnectorType9PinDualInline:             "9 Pin Dual Inline (pin 10 cut)",
+		PortConnectorType25PinDualInline:            "25 Pin Dual Inline (pin 26 cut)",
+		PortConnectorType50PinDualInline:            "50 Pin Dual Inline",
+		PortConnectorType68PinDualInline:            "68 Pin Dual Inline",
+		PortConnectorTypeOnBoardSoundInputFromCDROM: "On Board Sound Input From CD-ROM",
+		PortConnectorTypeMiniCentronicsType14:       "Mini Centronics Type-14",
+		PortConnectorTypeMiniCentronicsType26:       "Mini Centronics Type-26",
+		PortConnectorTypeMiniJackHeadphones:         "Mini Jack (headphones)",
+		PortConnectorTypeBNC:                        "BNC",
+		PortConnectorType1394:                       "IEEE 1394",
+		PortConnectorTypeSASSATAPlugReceptacle:      "SAS/SATA Plug Receptacle",
+		PortConnectorTypeUSBTypeCReceptacle:         "USB Type-C Receptacle",
+		PortConnectorTypePC98:                       "PC-98",
+		PortConnectorTypePC98Hireso:                 "PC-98 Hireso",
+		PortConnectorTypePCH98:                      "PC-H98",
+		PortConnectorTypePC98Note:                   "PC-98 Note",
+		PortConnectorTypePC98Full:                   "PC-98 Full",
+		PortConnectorTypeOther:                      "Other",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// PortType is defined in DSP0134 7.9.3.
+type PortType uint8
+
+// PortType values are defined in DSP0134 7.9.3.
+const (
+	PortTypeNone                       PortType = 0x00 // None
+	PortTypeParallelPortXTATCompatible PortType = 0x01 // Parallel Port XT/AT Compatible
+	PortTypeParallelPortPS2            PortType = 0x02 // Parallel Port PS/2
+	PortTypeParallelPortECP            PortType = 0x03 // Parallel Port ECP
+	PortTypeParallelPortEPP            PortType = 0x04 // Parallel Port EPP
+	PortTypeParallelPortECPEPP         PortType = 0x05 // Parallel Port ECP/EPP
+	PortTypeSerialPortXTATCompatible   PortType = 0x06 // Serial Port XT/AT Compatible
+	PortTypeSerialPort16450Compatible  PortType = 0x07 // Serial Port 16450 Compatible
+	PortTypeSerialPort16550Compatible  PortType = 0x08 // Serial Port 16550 Compatible
+	PortTypeSerialPort16550ACompatible PortType = 0x09 // Serial Port 16550A Compatible
+	PortTypeSCSIPort                   PortType = 0x0a // SCSI Port
+	PortTypeMIDIPort                   PortType = 0x0b // MIDI Port
+	PortTypeJoyStickPort               PortType = 0x0c // Joy Stick Port
+	PortTypeKeyboardPort               PortType = 0x0d // Keyboard Port
+	PortTypeMousePort                  PortType = 0x0e // Mouse Port
+	PortTypeSSASCSI                    PortType = 0x0f // SSA SCSI
+	PortTypeUSB                        PortType = 0x10 // USB
+	PortTypeFireWire                   PortType = 0x11 // FireWire (IEEE P1394)
+	PortTypePCMCIATypeI                PortType = 0x12 // PCMCIA Type I
+	PortTypePCMCIATypeII               PortType = 0x13 // PCMCIA Type II
+	PortTypePCMCIATypeIII              PortType = 0x14 // PCMCIA Type III
+	PortTypeCardbus                    PortType = 0x15 // Cardbus
+	PortTypeAccessBusPort              PortType = 0x16 // Access Bus Port
+	PortTypeSCSIII                     PortType = 0x17 // SCSI II
+	PortTypeSCSIWide                   PortType = 0x18 // SCSI Wide
+	PortTypePC98                       PortType = 0x19 // PC-98
+	PortTypePC98Hireso                 PortType = 0x1a // PC-98-Hireso
+	PortTypePCH98                      PortType = 0x1b // PC-H98
+	PortTypeVideoPort                  PortType = 0x1c // Video Port
+	PortTypeAudioPort                  PortType = 0x1d // Audio Port
+	PortTypeModemPort                  PortType = 0x1e // Modem Port
+	PortTypeNetworkPort                PortType = 0x1f // Network Port
+	PortTypeSATA                       PortType = 0x20 // SATA
+	PortTypeSAS                        PortType = 0x21 // SAS
+	PortType8251Compatible             PortType = 0xa0 // 8251 Compatible
+	PortType8251FIFOCompatible         PortType = 0xa1 // 8251 FIFO Compatible
+	PortTypeOther                      PortType = 0xff // Other
+)
+
+func (v PortType) String() string {
+	names := map[PortType]string{
+		PortTypeNone:                       "None",
+		PortTypeParallelPortXTATCompatible: "Parallel Port XT/AT Compatible",
+		PortTypeParallelPortPS2:            "Parallel Port PS/2",
+		PortTypeParallelPortECP:            "Parallel Port ECP",
+		PortTypeParallelPortEPP:            "Parallel Port EPP",
+		PortTypeParallelPortECPEPP:         "Parallel Port ECP/EPP",
+		PortTypeSerialPortXTATCompatible:   "Serial Port XT/AT Compatible",
+		PortTypeSerialPort16450Compatible:  "Serial Port 16450 Compatible",
+		PortTypeSerialPort16550Compatible:  "Serial Port 16550 Compatible",
+		PortTypeSerialPort16550ACompatible: "Serial Port 16550A Compatible",
+		PortTypeSCSIPort:                   "SCSI Port",
+		PortTypeMIDIPort:                   "MIDI Port",
+		PortTypeJoyStickPort:               "Joystick Port",
+		PortTypeKeyboardPort:               "Keyboard Port",
+		PortTypeMousePort:                  "Mouse Port",
+		PortTypeSSASCSI:                    "SSA SCSI",
+		PortTypeUSB:                        "USB",
+		PortTypeFireWire:                   "Firewire (IEEE P1394)",
+		PortTypePCMCIATypeI:                "PCMCIA Type I",
+		PortTypePCMCIATypeII:               "PCMCIA Type II",
+		PortTypePCMCIATypeIII:              "PCMCIA Type III",
+		PortTypeCardbus:                    "Cardbus",
+		PortTypeAccessBusPort:              "Access Bus Port",
+		PortTypeSCSIII:                     "SCSI II",
+		PortTypeSCSIWide:                   "SCSI Wide",
+		PortTypePC98:                       "PC-98",
+		PortTypePC98Hireso:                 "PC-98 Hireso",
+		PortTypePCH98:                      "PC-H98",
+		PortTypeVideoPort:                  "Video Port",
+		PortTypeAudioPort:                  "Audio Port",
+		PortTypeModemPort:                  "Modem Port",
+		PortTypeNetworkPort:                "Network Port",
+		PortTypeSATA:                       "SATA",
+		PortTypeSAS:                        "SAS",
+		PortType8251Compatible:             "8251 Compatible",
+		PortType8251FIFOCompatible:         "8251 FIFO Compatible",
+		PortTypeOther:                      "Other",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
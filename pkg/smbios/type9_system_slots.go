@@ -0,0 +1,446 @@
+// Copyright 2016-2019 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Much of this is auto-generated. If adding a new type, see README for instructions.
+
+// SystemSlots is defined in DSP0134 7.10.
+type SystemSlots struct {
+	Table
+	SlotDesignation      string               // 04h
+	SlotType             SlotType             // 05h
+	SlotDataBusWidth     SlotDataBusWidth     // 06h
+	CurrentUsage         SlotUsage            // 07h
+	SlotLength           SlotLength           // 08h
+	SlotID               uint16               // 09h
+	SlotCharacteristics1 SlotCharacteristics1 // 0Bh
+	SlotCharacteristics2 SlotCharacteristics2 // 0Ch
+	SegmentGroupNumber   uint16               // 0Dh
+	BusNumber            uint8                // 0Fh
+	DeviceFunctionNumber uint8                // 10h
+	DataBusWidth         uint8                // 11h
+	PeerGroupingCount    uint8                // 12h
+	PeerGroups           []SlotPeerGroup      `smbios:"-"` // 13h
+}
+
+// SlotPeerGroup is defined in DSP0134 7.10.9.
+type SlotPeerGroup struct {
+	SegmentGroupNumber   uint16 // 00h
+	BusNumber            uint8  // 02h
+	DeviceFunctionNumber uint8  // 03h
+	DataBusWidth         uint8  // 04h
+}
+
+// NewSystemSlots parses a generic Table into SystemSlots.
+func NewSystemSlots(t *Table) (*SystemSlots, error) {
+	if t.Type != TableTypeSystemSlots {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0xc {
+		return nil, errors.New("required fields missing")
+	}
+	ss := &SystemSlots{Table: *t}
+	off, err := parseStruct(t, 0 /* off */, false /* complete */, ss)
+	if err != nil {
+		return nil, err
+	}
+	if ss.PeerGroupingCount > 0 {
+		if t.Len() < off+5*int(ss.PeerGroupingCount) {
+			return nil, errors.New("invalid data length")
+		}
+		for i := 0; i < int(ss.PeerGroupingCount); i++ {
+			var pg SlotPeerGroup
+			if off, err = parseStruct(t, off, true /* complete */, &pg); err != nil {
+				return nil, err
+			}
+			ss.PeerGroups = append(ss.PeerGroups, pg)
+		}
+	}
+	return ss, nil
+}
+
+// ToTable encodes the table, with any changes made to its fields.
+// PeerGroupingCount is set from PeerGroups.
+func (ss *SystemSlots) ToTable() (*Table, error) {
+	t, err := newTable(TableTypeSystemSlots, &ss.Table, ss)
+	if err != nil {
+		return nil, err
+	}
+	if t.Len() == 0x13 {
+		if len(ss.PeerGroups) > 0xff {
+			return nil, errors.New("too many peer groups")
+		}
+		t.data[0x12] = uint8(len(ss.PeerGroups))
+		for i := range ss.PeerGroups {
+			if err := writeStruct(t, 0, &ss.PeerGroups[i]); err != nil {
+				return nil, err
+			}
+		}
+	} else if len(ss.PeerGroups) > 0 {
+		return nil, errors.New("table is too short for peer groups")
+	}
+	if err := t.setLength(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// busAddress formats a PCI segment, bus, device and function the way
+// dmidecode(8) does. It returns "" if they are not set.
+func busAddress(segment uint16, bus, devfn uint8) string {
+	if segment == 0xffff && bus == 0xff && devfn == 0xff {
+		return ""
+	}
+	return fmt.Sprintf("%04x:%02x:%02x.%x", segment, bus, devfn>>3, devfn&7)
+}
+
+func (ss *SystemSlots) String() string {
+	lines := []string{
+		ss.Header.String(),
+		fmt.Sprintf("Designation: %s", ss.SlotDesignation),
+		fmt.Sprintf("Type: %s%s", ss.SlotDataBusWidth, ss.SlotType),
+		fmt.Sprintf("Current Usage: %s", ss.CurrentUsage),
+		fmt.Sprintf("Length: %s", ss.SlotLength),
+	}
+	switch ss.SlotType {
+	case SlotTypeMCA, SlotTypeEISA, SlotTypePCI, SlotTypePCI66MHzCapable, SlotTypeAGP,
+		SlotTypeAGP2X, SlotTypeAGP4X, SlotTypePCIX, SlotTypeAGP8X,
+		SlotTypePCIExpressGen2SFF8639, SlotTypePCIExpressGen3SFF8639,
+		SlotTypePCIExpressMini52pinWithBSKO, SlotTypePCIExpressMini52pinWithoutBSKO,
+		SlotTypePCIExpressMini76pin:
+		lines = append(lines, fmt.Sprintf("ID: %d", ss.SlotID&0xff))
+	case SlotTypePCCardPCMCIA:
+		lines = append(lines, fmt.Sprintf("ID: Adapter %d, Socket %d", ss.SlotID&0xff, ss.SlotID>>8))
+	default:
+		if ss.SlotType >= SlotTypePCIExpress && ss.SlotType <= SlotTypePCIExpressGen4x16 {
+			lines = append(lines, fmt.Sprintf("ID: %d", ss.SlotID&0xff))
+		}
+	}
+	lines = append(lines, "Characteristics:"+slotCharacteristics(ss.SlotCharacteristics1, ss.SlotCharacteristics2))
+	if ss.Len() >= 0x11 {
+		if ba := busAddress(ss.SegmentGroupNumber, ss.BusNumber, ss.DeviceFunctionNumber); ba != "" {
+			lines = append(lines, fmt.Sprintf("Bus Address: %s", ba))
+		}
+	}
+	if ss.Len() >= 0x13 {
+		lines = append(lines,
+			fmt.Sprintf("Data Bus Width: %d", ss.DataBusWidth),
+			fmt.Sprintf("Peer Devices: %d", ss.PeerGroupingCount),
+		)
+		for i, pg := range ss.PeerGroups {
+			lines = append(lines, fmt.Sprintf("Peer Device %d: %04x:%02x:%02x.%x (Width %d)",
+				i+1, pg.SegmentGroupNumber, pg.BusNumber, pg.DeviceFunctionNumber>>3, pg.DeviceFunctionNumber&7, pg.DataBusWidth))
+		}
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// SlotType is defined in DSP0134 7.10.1.
+type SlotType uint8
+
+// SlotType values are defined in DSP0134 7.10.1.
+const (
+	SlotTypeOther                          SlotType = 0x01 // Other
+	SlotTypeUnknown                        SlotType = 0x02 // Unknown
+	SlotTypeISA                            SlotType = 0x03 // ISA
+	SlotTypeMCA                            SlotType = 0x04 // MCA
+	SlotTypeEISA                           SlotType = 0x05 // EISA
+	SlotTypePCI                            SlotType = 0x06 // PCI
+	SlotTypePCCardPCMCIA                   SlotType = 0x07 // PC Card (PCMCIA)
+	SlotTypeVLVESA                         SlotType = 0x08 // VL-VESA
+	SlotTypeProprietary                    SlotType = 0x09 // Proprietary
+	SlotTypeProcessorCardSlot              SlotType = 0x0a // Processor Card Slot
+	SlotTypeProprietaryMemoryCardSlot      SlotType = 0x0b // Proprietary Memory Card Slot
+	SlotTypeIORiserCardSlot                SlotType = 0x0c // I/O Riser Card Slot
+	SlotTypeNuBus                          SlotType = 0x0d // NuBus
+	SlotTypePCI66MHzCapable                SlotType = 0x0e // PCI - 66MHz Capable
+	SlotTypeAGP                            SlotType = 0x0f // AGP
+	SlotTypeAGP2X                          SlotType = 0x10 // AGP 2X
+	SlotTypeAGP4X                          SlotType = 0x11 // AGP 4X
+	SlotTypePCIX                           SlotType = 0x12 // PCI-X
+	SlotTypeAGP8X                          SlotType = 0x13 // AGP 8X
+	SlotTypeM2Socket1DP                    SlotType = 0x14 // M.2 Socket 1-DP (Mechanical Key A)
+	SlotTypeM2Socket1SD                    SlotType = 0x15 // M.2 Socket 1-SD (Mechanical Key E)
+	SlotTypeM2Socket2                      SlotType = 0x16 // M.2 Socket 2 (Mechanical Key B)
+	SlotTypeM2Socket3                      SlotType = 0x17 // M.2 Socket 3 (Mechanical Key M)
+	SlotTypeMXMTypeI                       SlotType = 0x18 // MXM Type I
+	SlotTypeMXMTypeII                      SlotType = 0x19 // MXM Type II
+	SlotTypeMXMTypeIIIStandardConnector    SlotType = 0x1a // MXM Type III (standard connector)
+	SlotTypeMXMTypeIIIHEConnector          SlotType = 0x1b // MXM Type III (HE connector)
+	SlotTypeMXMTypeIV                      SlotType = 0x1c // MXM Type IV
+	SlotTypeMXM30TypeA                     SlotType = 0x1d // MXM 3.0 Type A
+	SlotTypeMXM30TypeB                     SlotType = 0x1e // MXM 3.0 Type B
+	SlotTypePCIExpressGen2SFF8639          SlotType = 0x1f // PCI Express Gen 2 SFF-8639
+	SlotTypePCIExpressGen3SFF8639          SlotType = 0x20 // PCI Express Gen 3 SFF-8639
+	SlotTypePCIExpressMini52pinWithBSKO    SlotType = 0x21 // PCI Express Mini 52-pin (CEM spec. 2.0) with bottom-side keep-outs
+	SlotTypePCIExpressMini52pinWithoutBSKO SlotType = 0x22 // PCI Express Mini 52-pin (CEM spec. 2.0) without bottom-side keep-outs
+	SlotTypePCIExpressMini76pin            SlotType = 0x23 // PCI Express Mini 76-pin (CEM spec. 2.0)
+	SlotTypePC98C20                        SlotType = 0xa0 // PC-98/C20
+	SlotTypePC98C24                        SlotType = 0xa1 // PC-98/C24
+	SlotTypePC98E                          SlotType = 0xa2 // PC-98/E
+	SlotTypePC98LocalBus                   SlotType = 0xa3 // PC-98/Local Bus
+	SlotTypePC98Card                       SlotType = 0xa4 // PC-98/Card
+	SlotTypePCIExpress                     SlotType = 0xa5 // PCI Express
+	SlotTypePCIExpressx1                   SlotType = 0xa6 // PCI Express x1
+	SlotTypePCIExpressx2                   SlotType = 0xa7 // PCI Express x2
+	SlotTypePCIExpressx4                   SlotType = 0xa8 // PCI Express x4
+	SlotTypePCIExpressx8                   SlotType = 0xa9 // PCI Express x8
+	SlotTypePCIExpressx16                  SlotType = 0xaa // PCI Express x16
+	SlotTypePCIExpressGen2                 SlotType = 0xab // PCI Express Gen 2
+	SlotTypePCIExpressGen2x1               SlotType = 0xac // PCI Express Gen 2 x1
+	SlotTypePCIExpressGen2x2               SlotType = 0xad // PCI Express Gen 2 x2
+	SlotTypePCIExpressGen2x4               SlotType = 0xae // PCI Express Gen 2 x4
+	SlotTypePCIExpressGen2x8               SlotType = 0xaf // PCI Express Gen 2 x8
+	SlotTypePCIExpressGen2x16              SlotType = 0xb0 // PCI Express Gen 2 x16
+	SlotTypePCIExpressGen3                 SlotType = 0xb1 // PCI Express Gen 3
+	SlotTypePCIExpressGen3x1               SlotType = 0xb2 // PCI Express Gen 3 x1
+	SlotTypePCIExpressGen3x2               SlotType = 0xb3 // PCI Express Gen 3 x2
+	SlotTypePCIExpressGen3x4               SlotType = 0xb4 // PCI Express Gen 3 x4
+	SlotTypePCIExpressGen3x8               SlotType = 0xb5 // PCI Express Gen 3 x8
+	SlotTypePCIExpressGen3x16              SlotType = 0xb6 // PCI Express Gen 3 x16
+	SlotTypePCIExpressGen4                 SlotType = 0xb8 // PCI Express Gen 4
+	SlotTypePCIExpressGen4x1               SlotType = 0xb9 // PCI Express Gen 4 x1
+	SlotTypePCIExpressGen4x2               SlotType = 0xba // PCI Express Gen 4 x2
+	SlotTypePCIExpressGen4x4               SlotType = 0xbb // PCI Express Gen 4 x4
+	SlotTypePCIExpressGen4x8               SlotType = 0xbc // PCI Express Gen 4 x8
+	SlotTypePCIExpressGen4x16              SlotType = 0xbd // PCI Express Gen 4 x16
+)
+
+func (v SlotType) String() string {
+	names := map[SlotType]string{
+		SlotTypeOther:                          "Other",
+		SlotTypeUnknown:                        "Unknown",
+		SlotTypeISA:                            "ISA",
+		SlotTypeMCA:                            "MCA",
+		SlotTypeEISA:                           "EISA",
+		SlotTypePCI:                            "PCI",
+		SlotTypePCCardPCMCIA:                   "PC Card (PCMCIA)",
+		SlotTypeVLVESA:                         "VLB",
+		SlotTypeProprietary:                    "Proprietary",
+		SlotTypeProcessorCardSlot:              "Processor Card",
+		SlotTypeProprietaryMemoryCardSlot:      "Proprietary Memory Card",
+		SlotTypeIORiserCardSlot:                "I/O Riser Card",
+		SlotTypeNuBus:                          "NuBus",
+		SlotTypePCI66MHzCapable:                "PCI-66",
+		SlotTypeAGP:                            "AGP",
+		SlotTypeAGP2X:                          "AGP 2x",
+		SlotTypeAGP4X:                          "AGP 4x",
+		SlotTypePCIX:                           "PCI-X",
+		SlotTypeAGP8X:                          "AGP 8x",
+		SlotTypeM2Socket1DP:                    "M.2 Socket 1-DP",
+		SlotTypeM2Socket1SD:                    "M.2 Socket 1-SD",
+		SlotTypeM2Socket2:                      "M.2 Socket 2",
+		SlotTypeM2Socket3:                      "M.2 Socket 3",
+		SlotTypeMXMTypeI:                       "MXM Type I",
+		SlotTypeMXMTypeII:                      "MXM Type II",
+		SlotTypeMXMTypeIIIStandardConnector:    "MXM Type III",
+		SlotTypeMXMTypeIIIHEConnector:          "MXM Type III-HE",
+		SlotTypeMXMTypeIV:                      "MXM Type IV",
+		SlotTypeMXM30TypeA:                     "MXM 3.0 Type A",
+		SlotTypeMXM30TypeB:                     "MXM 3.0 Type B",
+		SlotTypePCIExpressGen2SFF8639:          "PCI Express 2 SFF-8639",
+		SlotTypePCIExpressGen3SFF8639:          "PCI Express 3 SFF-8639",
+		SlotTypePCIExpressMini52pinWithBSKO:    "PCI Express Mini 52-pin with bottom-side keep-outs",
+		SlotTypePCIExpressMini52pinWithoutBSKO: "PCI Express Mini 52-pin without bottom-side keep-outs",
+		SlotTypePCIExpressMini76pin:            "PCI Express Mini 76-pin",
+		SlotTypePC98C20:                        "PC-98/C20",
+		SlotTypePC98C24:                        "PC-98/C24",
+		SlotTypePC98E:                          "PC-98/E",
+		SlotTypePC98LocalBus:                   "PC-98/Local Bus",
+		SlotTypePC98Card:                       "PC-98/Card",
+		SlotTypePCIExpress:                     "PCI Express",
+		SlotTypePCIExpressx1:                   "PCI Express x1",
+		SlotTypePCIExpressx2:                   "PCI Express x2",
+		SlotTypePCIExpressx4:                   "PCI Express x4",
+		SlotTypePCIExpressx8:                   "PCI Express x8",
+		SlotTypePCIExpressx16:                  "PCI Express x16",
+		SlotTypePCIExpressGen2:                 "PCI Express 2",
+		SlotTypePCIExpressGen2x1:               "PCI Express 2 x1",
+		SlotTypePCIExpressGen2x2:               "PCI Express 2 x2",
+		SlotTypePCIExpressGen2x4:               "PCI Express 2 x4",
+		SlotTypePCIExpressGen2x8:               "PCI Express 2 x8",
+		SlotTypePCIExpressGen2x16:              "PCI Express 2 x16",
+		SlotTypePCIExpressGen3:                 "PCI Express 3",
+		SlotTypePCIExpressGen3x1:               "PCI Express 3 x1",
+		SlotTypePCIExpressGen3x2:               "PCI Express 3 x2",
+		SlotTypePCIExpressGen3x4:               "PCI Express 3 x4",
+		SlotTypePCIExpressGen3x8:               "PCI Express 3 x8",
+		SlotTypePCIExpressGen3x16:              "PCI Express 3 x16",
+		SlotTypePCIExpressGen4:                 "PCI Express 4",
+		SlotTypePCIExpressGen4x1:               "PCI Express 4 x1",
+		SlotTypePCIExpressGen4x2:               "PCI Express 4 x2",
+		SlotTypePCIExpressGen4x4:               "PCI Express 4 x4",
+		SlotTypePCIExpressGen4x8:               "PCI Express 4 x8",
+		SlotTypePCIExpressGen4x16:              "PCI Express 4 x16",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// SlotDataBusWidth is defined in DSP0134 7.10.2.
+type SlotDataBusWidth uint8
+
+// SlotDataBusWidth values are defined in DSP0134 7.10.2.
+const (
+	SlotDataBusWidthOther   SlotDataBusWidth = 0x01 // Other
+	SlotDataBusWidthUnknown SlotDataBusWidth = 0x02 // Unknown
+	SlotDataBusWidth8Bit    SlotDataBusWidth = 0x03 // 8 bit
+	SlotDataBusWidth16Bit   SlotDataBusWidth = 0x04 // 16 bit
+	SlotDataBusWidth32Bit   SlotDataBusWidth = 0x05 // 32 bit
+	SlotDataBusWidth64Bit   SlotDataBusWidth = 0x06 // 64 bit
+	SlotDataBusWidth128Bit  SlotDataBusWidth = 0x07 // 128 bit
+	SlotDataBusWidth1X      SlotDataBusWidth = 0x08 // 1x or x1
+	SlotDataBusWidth2X      SlotDataBusWidth = 0x09 // 2x or x2
+	SlotDataBusWidth4X      SlotDataBusWidth = 0x0a // 4x or x4
+	SlotDataBusWidth8X      SlotDataBusWidth = 0x0b // 8x or x8
+	SlotDataBusWidth12X     SlotDataBusWidth = 0x0c // 12x or x12
+	SlotDataBusWidth16X     SlotDataBusWidth = 0x0d // 16x or x16
+	SlotDataBusWidth32X     SlotDataBusWidth = 0x0e // 32x or x32
+)
+
+// String returns the width as a prefix of the slot type, as dmidecode(8)
+// prints it, e.g. "x16 " or "" for Other and Unknown.
+func (v SlotDataBusWidth) String() string {
+	names := map[SlotDataBusWidth]string{
+		SlotDataBusWidthOther:   "",
+		SlotDataBusWidthUnknown: "",
+		SlotDataBusWidth8Bit:    "8-bit ",
+		SlotDataBusWidth16Bit:   "16-bit ",
+		SlotDataBusWidth32Bit:   "32-bit ",
+		SlotDataBusWidth64Bit:   "64-bit ",
+		SlotDataBusWidth128Bit:  "128-bit ",
+		SlotDataBusWidth1X:      "x1 ",
+		SlotDataBusWidth2X:      "x2 ",
+		SlotDataBusWidth4X:      "x4 ",
+		SlotDataBusWidth8X:      "x8 ",
+		SlotDataBusWidth12X:     "x12 ",
+		SlotDataBusWidth16X:     "x16 ",
+		SlotDataBusWidth32X:     "x32 ",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// SlotUsage is defined in DSP0134 7.10.3.
+type SlotUsage uint8
+
+// SlotUsage values are defined in DSP0134 7.10.3.
+const (
+	SlotUsageOther     SlotUsage = 0x01 // Other
+	SlotUsageUnknown   SlotUsage = 0x02 // Unknown
+	SlotUsageAvailable SlotUsage = 0x03 // Available
+	SlotUsageInUse     SlotUsage = 0x04 // In use
+)
+
+func (v SlotUsage) String() string {
+	names := map[SlotUsage]string{
+		SlotUsageOther:     "Other",
+		SlotUsageUnknown:   "Unknown",
+		SlotUsageAvailable: "Available",
+		SlotUsageInUse:     "In Use",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// SlotLength is defined in DSP0134 7.10.4.
+type SlotLength uint8
+
+// SlotLength values are defined in DSP0134 7.10.4.
+const (
+	SlotLengthOther   SlotLength = 0x01 // Other
+	SlotLengthUnknown SlotLength = 0x02 // Unknown
+	SlotLengthShort   SlotLength = 0x03 // Short Length
+	SlotLengthLong    SlotLength = 0x04 // Long Length
+)
+
+func (v SlotLength) String() string {
+	names := map[SlotLength]string{
+		SlotLengthOther:   "Other",
+		SlotLengthUnknown: "Unknown",
+		SlotLengthShort:   "Short",
+		SlotLengthLong:    "Long",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// SlotCharacteristics1 is defined in DSP0134 7.10.6.
+type SlotCharacteristics1 uint8
+
+// SlotCharacteristics1 fields are defined in DSP0134 7.10.6.
+const (
+	SlotCharacteristics1Unknown                           SlotCharacteristics1 = 1 << 0 // Characteristics unknown.
+	SlotCharacteristics1Provides50Volts                   SlotCharacteristics1 = 1 << 1 // Provides 5.0 volts.
+	SlotCharacteristics1Provides33Volts                   SlotCharacteristics1 = 1 << 2 // Provides 3.3 volts.
+	SlotCharacteristics1SlotsOpeningIsShared              SlotCharacteristics1 = 1 << 3 // Slot's opening is shared with another slot.
+	SlotCharacteristics1PCCardSlotSupportsPCCard16        SlotCharacteristics1 = 1 << 4 // PC Card slot supports PC Card-16.
+	SlotCharacteristics1PCCardSlotSupportsCardBus         SlotCharacteristics1 = 1 << 5 // PC Card slot supports CardBus.
+	SlotCharacteristics1PCCardSlotSupportsZoomVideo       SlotCharacteristics1 = 1 << 6 // PC Card slot supports Zoom Video.
+	SlotCharacteristics1PCCardSlotSupportsModemRingResume SlotCharacteristics1 = 1 << 7 // PC Card slot supports Modem Ring Resume.
+)
+
+// SlotCharacteristics2 is defined in DSP0134 7.10.7.
+type SlotCharacteristics2 uint8
+
+// SlotCharacteristics2 fields are defined in DSP0134 7.10.7.
+const (
+	SlotCharacteristics2PCISlotSupportsPME          SlotCharacteristics2 = 1 << 0 // PCI slot supports Power Management Event (PME#) signal.
+	SlotCharacteristics2SlotSupportsHotPlugDevices  SlotCharacteristics2 = 1 << 1 // Slot supports hot-plug devices.
+	SlotCharacteristics2PCISlotSupportsSMBusSignal  SlotCharacteristics2 = 1 << 2 // PCI slot supports SMBus signal.
+	SlotCharacteristics2PCIeSlotSupportsBifurcation SlotCharacteristics2 = 1 << 3 // PCIe slot supports bifurcation.
+)
+
+// slotCharacteristics formats both characteristics bytes as one list, the way
+// dmidecode(8) does.
+func slotCharacteristics(c1 SlotCharacteristics1, c2 SlotCharacteristics2) string {
+	if c1&SlotCharacteristics1Unknown != 0 {
+		return " Unknown"
+	}
+	if c1 == 0 && c2&0xf == 0 {
+		return " None"
+	}
+	var lines []string
+	names1 := []string{
+		"5.0 V is provided",
+		"3.3 V is provided",
+		"Opening is shared",
+		"PC Card-16 is supported",
+		"Cardbus is supported",
+		"Zoom Video is supported",
+		"Modem ring resume is supported",
+	}
+	for i, name := range names1 {
+		if c1&(1<<uint(i+1)) != 0 {
+			lines = append(lines, name)
+		}
+	}
+	names2 := []string{
+		"PME signal is supported",
+		"Hot-plug devices are supported",
+		"SMBus signal is supported",
+		"PCIe slot bifurcation is supported",
+	}
+	for i, name := range names2 {
+		if c2&(1<<uint(i)) != 0 {
+			lines = append(lines, name)
+		}
+	}
+	return "\n\t\t" + strings.Join(lines, "\n\t\t")
+}
@@ -104,9 +104,15 @@ func (t *TTYIO) Ctty(c *exec.Cmd) {
 	c.SysProcAttr.Ctty = int(t.f.Fd())
 }
 
+// clone returns a copy of term that can be changed without changing term.
+func clone(term *Termios) Termios {
+	t := *term.Termios
+	return Termios{Termios: &t}
+}
+
 // MakeRaw modifies Termio state so, if it used for an fd or tty, it will set it to raw mode.
 func MakeRaw(term *Termios) *Termios {
-	raw := *term
+	raw := clone(term)
 	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
 	raw.Oflag &^= unix.OPOST
 	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
@@ -121,7 +127,7 @@ func MakeRaw(term *Termios) *Termios {
 
 // MakeSerialBaud updates the Termios to set the baudrate
 func MakeSerialBaud(term *Termios, baud int) (*Termios, error) {
-	t := *term
+	t := clone(term)
 	rate, ok := baud2unixB[baud]
 	if !ok {
 		return nil, fmt.Errorf("%d: Unrecognized baud rate", baud)
@@ -143,7 +149,7 @@ func MakeSerialBaud(term *Termios, baud int) (*Termios, error) {
 // - Local ECHO is added (and handled by line editing)
 // - Map newline to carriage return newline on output
 func MakeSerialDefault(term *Termios) *Termios {
-	t := *term
+	t := clone(term)
 	/* Clear all except baud, stop bit and parity settings */
 	t.Cflag &= unix.CBAUD | unix.CSTOPB | unix.PARENB | unix.PARODD
 	/* Set: 8 bits; ignore Carrier Detect; enable receive */
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/u-root/u-root/pkg/testutil"
+	"golang.org/x/sys/unix"
 )
 
 func TestNew(t *testing.T) {
@@ -155,3 +156,15 @@ func TestString(t *testing.T) {
 	}
 
 }
+
+func TestMakeRaw(t *testing.T) {
+	term := &Termios{Termios: &unix.Termios{Iflag: unix.ICRNL, Lflag: unix.ECHO | unix.ICANON}}
+	raw := MakeRaw(term)
+	if raw.Lflag&(unix.ECHO|unix.ICANON) != 0 || raw.Iflag&unix.ICRNL != 0 {
+		t.Errorf("MakeRaw: got Iflag %#x Lflag %#x, want no ICRNL, ECHO or ICANON", raw.Iflag, raw.Lflag)
+	}
+	// Raw returns term to restore the tty with.
+	if term.Lflag != unix.ECHO|unix.ICANON || term.Iflag != unix.ICRNL {
+		t.Errorf("MakeRaw changed its argument to Iflag %#x Lflag %#x", term.Iflag, term.Lflag)
+	}
+}
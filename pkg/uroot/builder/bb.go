@@ -11,6 +11,7 @@ import (
 
 	"github.com/u-root/u-root/pkg/bb"
 	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/golang"
 	"github.com/u-root/u-root/pkg/uroot/initramfs"
 )
 
@@ -44,9 +45,13 @@ func (BBBuilder) DefaultBinaryDir() string {
 func (BBBuilder) Build(af *initramfs.Files, opts Opts) error {
 	// Build the busybox binary.
 	bbPath := filepath.Join(opts.TempDir, "bb")
-	if err := bb.BuildBusybox(opts.Env, opts.Packages, opts.NoStrip, bbPath); err != nil {
+	stats, err := bb.BuildBusybox(opts.Env, opts.Packages, opts.buildOpts(), opts.CacheDir, bbPath)
+	if err != nil {
 		return err
 	}
+	if opts.Logger != nil && opts.CacheDir != "" {
+		opts.Logger.Printf("bb cache: %v", stats)
+	}
 
 	if len(opts.BinaryDir) == 0 {
 		return fmt.Errorf("must specify binary directory")
@@ -58,12 +63,12 @@ func (BBBuilder) Build(af *initramfs.Files, opts Opts) error {
 
 	// Add symlinks for included commands to initramfs.
 	for _, pkg := range opts.Packages {
-		if _, ok := skip[path.Base(pkg)]; ok {
+		if _, ok := skip[golang.CommandName(pkg)]; ok {
 			continue
 		}
 
 		// Add a symlink /bbin/{cmd} -> /bbin/bb to our initramfs.
-		if err := af.AddRecord(cpio.Symlink(filepath.Join(opts.BinaryDir, path.Base(pkg)), "bb")); err != nil {
+		if err := af.AddRecord(cpio.Symlink(filepath.Join(opts.BinaryDir, golang.CommandName(pkg)), "bb")); err != nil {
 			return err
 		}
 	}
@@ -5,9 +5,13 @@
 package builder
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sync"
 
+	"golang.org/x/tools/go/packages"
+
 	"github.com/u-root/u-root/pkg/golang"
 	"github.com/u-root/u-root/pkg/uroot/initramfs"
 )
@@ -26,17 +30,46 @@ func (BinaryBuilder) DefaultBinaryDir() string {
 
 // Build implements Builder.Build.
 func (BinaryBuilder) Build(af *initramfs.Files, opts Opts) error {
-	result := make(chan error, len(opts.Packages))
+	// Packages in GOPATH or the main module are built in place, anything
+	// else in a workspace.
+	inTree, err := opts.Env.InTree(opts.Packages)
+	if err != nil {
+		return err
+	}
+	importPaths := opts.Packages
+	build := opts.Env.Build
+	if !inTree {
+		// Everything in TempDir goes into the archive, so the workspace
+		// is elsewhere.
+		dir, err := ioutil.TempDir("", "u-root-workspace")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		var ws *golang.Workspace
+		ws, importPaths, err = opts.Env.NewWorkspace(dir, opts.Packages)
+		if err != nil {
+			return err
+		}
+		// Resolve all packages once, so that the concurrent builds
+		// below need not update the workspace's go.mod.
+		if _, err := ws.Lookup(packages.NeedName, importPaths...); err != nil {
+			return err
+		}
+		build = ws.Build
+	}
+
+	result := make(chan error, len(importPaths))
 	var wg sync.WaitGroup
 
-	for _, pkg := range opts.Packages {
+	for _, pkg := range importPaths {
 		wg.Add(1)
 		go func(p string) {
 			defer wg.Done()
-			result <- opts.Env.Build(
+			result <- build(
 				p,
-				filepath.Join(opts.TempDir, opts.BinaryDir, filepath.Base(p)),
-				golang.BuildOpts{NoStrip: opts.NoStrip})
+				filepath.Join(opts.TempDir, opts.BinaryDir, golang.CommandName(p)),
+				opts.buildOpts())
 		}(pkg)
 	}
 
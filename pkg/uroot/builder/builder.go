@@ -6,6 +6,7 @@ package builder
 
 import (
 	"github.com/u-root/u-root/pkg/golang"
+	"github.com/u-root/u-root/pkg/ulog"
 	"github.com/u-root/u-root/pkg/uroot/initramfs"
 )
 
@@ -40,6 +41,26 @@ type Opts struct {
 
 	// NoStrip builds unstripped binaries.
 	NoStrip bool
+
+	// Reproducible builds binaries that do not depend on the build
+	// machine's file system paths.
+	Reproducible bool
+
+	// CacheDir, if not empty, is a persistent directory where the bb
+	// builder keeps rewritten packages between builds.
+	CacheDir string
+
+	// Logger, if not nil, is told how many commands the bb builder found
+	// in CacheDir.
+	Logger ulog.Logger
+}
+
+// buildOpts returns the options to build Go binaries with.
+func (o Opts) buildOpts() golang.BuildOpts {
+	return golang.BuildOpts{
+		NoStrip:      o.NoStrip,
+		Reproducible: o.Reproducible,
+	}
 }
 
 // Builder builds Go packages and adds the binaries to an initramfs.
@@ -89,6 +89,9 @@ func (sb SourceBuilder) Build(af *initramfs.Files, opts Opts) error {
 	log.Printf("Collecting package files and dependencies...")
 	deps := make(map[string]struct{})
 	for _, pkg := range opts.Packages {
+		if _, _, ok := golang.SplitVersion(pkg); ok {
+			return fmt.Errorf("source mode cannot build %q: module versions are only supported by the bb and binary builders", pkg)
+		}
 		name := path.Base(pkg)
 		if name == "installcommand" {
 			installcommand = pkg
@@ -147,7 +150,7 @@ func (sb SourceBuilder) Build(af *initramfs.Files, opts Opts) error {
 		return err
 	}
 	if !sb.FourBins {
-		if err := opts.Env.Build(installcommand, filepath.Join(opts.TempDir, opts.BinaryDir, "installcommand"), golang.BuildOpts{}); err != nil {
+		if err := opts.Env.Build(installcommand, filepath.Join(opts.TempDir, opts.BinaryDir, "installcommand"), golang.BuildOpts{Reproducible: opts.Reproducible}); err != nil {
 			return err
 		}
 	}
@@ -161,7 +164,8 @@ func (sb SourceBuilder) Build(af *initramfs.Files, opts Opts) error {
 func buildToolchain(opts Opts) error {
 	goBin := filepath.Join(opts.TempDir, "go/bin/go")
 	tcbo := golang.BuildOpts{
-		ExtraArgs: []string{"-tags", "cmd_go_bootstrap"},
+		Reproducible: opts.Reproducible,
+		ExtraArgs:    []string{"-tags", "cmd_go_bootstrap"},
 	}
 	if err := opts.Env.Build("cmd/go", goBin, tcbo); err != nil {
 		return err
@@ -170,7 +174,7 @@ func buildToolchain(opts Opts) error {
 	toolDir := filepath.Join(opts.TempDir, fmt.Sprintf("go/pkg/tool/%v_%v", opts.Env.GOOS, opts.Env.GOARCH))
 	for _, pkg := range []string{"compile", "link", "asm"} {
 		c := filepath.Join(toolDir, pkg)
-		if err := opts.Env.Build(fmt.Sprintf("cmd/%s", pkg), c, golang.BuildOpts{}); err != nil {
+		if err := opts.Env.Build(fmt.Sprintf("cmd/%s", pkg), c, golang.BuildOpts{Reproducible: opts.Reproducible}); err != nil {
 			return err
 		}
 	}
@@ -5,6 +5,7 @@
 package initramfs
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
@@ -19,13 +20,21 @@ var (
 
 	Dir = DirArchiver{}
 
+	Squashfs = SquashfsArchiver{}
+
+	Erofs = ErofsArchiver{}
+
 	// Archivers are the supported initramfs archivers at the moment.
 	//
-	// - cpio: writes the initramfs to a cpio.
-	// - dir:  writes the initramfs relative to a specified directory.
+	// - cpio:     writes the initramfs to a cpio.
+	// - dir:      writes the initramfs relative to a specified directory.
+	// - squashfs: writes the initramfs to a squashfs image.
+	// - erofs:    writes the initramfs to an erofs image.
 	Archivers = map[string]Archiver{
-		"cpio": CPIO,
-		"dir":  Dir,
+		"cpio":     CPIO,
+		"dir":      Dir,
+		"squashfs": Squashfs,
+		"erofs":    Erofs,
 	}
 )
 
@@ -53,6 +62,41 @@ func GetArchiver(name string) (Archiver, error) {
 	return archiver, nil
 }
 
+// ErrNoCompression is returned by WithCompressor for archivers that do not
+// support compression.
+var ErrNoCompression = errors.New("archive format does not support compression")
+
+// WithCompressor returns archiver a compressing its output with c.
+//
+// Only the cpio, squashfs and erofs archivers support compression.
+func WithCompressor(a Archiver, c Compressor) (Archiver, error) {
+	switch a := a.(type) {
+	case CPIOArchiver:
+		a.Compressor = c
+		return a, nil
+	case SquashfsArchiver:
+		a.Compressor = c
+		return a, nil
+	case ErofsArchiver:
+		a.Compressor = c
+		return a, nil
+	default:
+		return nil, fmt.Errorf("%T: %w", a, ErrNoCompression)
+	}
+}
+
+// OpenReader returns a Reader for the file system image or (possibly
+// compressed) cpio archive in r, detected by its magic number.
+func OpenReader(r io.ReaderAt) Reader {
+	if isSquashfs(r) {
+		return Squashfs.Reader(r)
+	}
+	if isErofs(r) {
+		return Erofs.Reader(r)
+	}
+	return CPIO.Reader(r)
+}
+
 // Writer is an initramfs archive that files can be written to.
 type Writer interface {
 	cpio.RecordWriter
@@ -86,6 +130,21 @@ type Opts struct {
 	// If this is false, the "init" file in BaseArchive will be renamed
 	// "inito" (for init-original) in the output archive.
 	UseExistingInit bool
+
+	// Reproducible normalizes the metadata of all records, so that the
+	// archive only depends on the paths, modes and contents of its files:
+	// records are written in sorted order with inode numbers counting up
+	// from 1, uid and gid 0, and SourceDateEpoch as their mtime. Hard
+	// links are written as copies.
+	Reproducible bool
+
+	// SourceDateEpoch is the mtime of all records if Reproducible is set,
+	// usually taken from $SOURCE_DATE_EPOCH.
+	SourceDateEpoch uint64
+
+	// Manifest, if not nil, receives a manifest of the written archive.
+	// See WriteManifest.
+	Manifest io.Writer
 }
 
 // Write uses the given options to determine which files to write to the output
@@ -124,8 +183,16 @@ func Write(opts *Opts) error {
 		}
 	}
 
-	if err := opts.Files.WriteTo(opts.OutputFile); err != nil {
+	w := opts.OutputFile
+	if opts.Manifest != nil {
+		w = &manifestWriter{Writer: w, m: opts.Manifest}
+	}
+	var n *normalizer
+	if opts.Reproducible {
+		n = &normalizer{mtime: opts.SourceDateEpoch}
+	}
+	if err := opts.Files.writeTo(w, n); err != nil {
 		return err
 	}
-	return opts.OutputFile.Finish()
+	return w.Finish()
 }
@@ -0,0 +1,151 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	Gzip = GzipCompressor{}
+	XZ   = XZCompressor{}
+	Zstd = ZstdCompressor{}
+	LZ4  = LZ4Compressor{}
+
+	// Compressors are the supported initramfs compression formats. All of
+	// them can be unpacked by Linux, if it was built with support for
+	// them.
+	Compressors = map[string]Compressor{
+		"gzip": Gzip,
+		"xz":   XZ,
+		"zstd": Zstd,
+		"lz4":  LZ4,
+	}
+)
+
+// Compressor is a compression format for initramfs archives.
+type Compressor interface {
+	// Writer returns a writer that compresses what is written to it into
+	// w. Closing it flushes the compressed data, but does not close w.
+	Writer(w io.Writer) (io.WriteCloser, error)
+
+	// Reader returns a reader that decompresses r.
+	Reader(r io.Reader) (io.Reader, error)
+
+	// Magic returns the bytes that compressed data starts with.
+	Magic() []byte
+}
+
+// GetCompressor finds a registered initramfs compressor by name.
+//
+// Good to use with command-line arguments.
+func GetCompressor(name string) (Compressor, error) {
+	c, ok := Compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("couldn't find compression format %q", name)
+	}
+	return c, nil
+}
+
+// detectCompressor returns the compressor whose magic data starts with, if
+// any.
+func detectCompressor(data []byte) Compressor {
+	for _, c := range Compressors {
+		if bytes.HasPrefix(data, c.Magic()) {
+			return c
+		}
+	}
+	return nil
+}
+
+// GzipCompressor compresses with gzip. The gzip header has no name or
+// modification time, so the output only depends on the input.
+type GzipCompressor struct{}
+
+// Writer implements Compressor.Writer.
+func (GzipCompressor) Writer(w io.Writer) (io.WriteCloser, error) {
+	return pgzip.NewWriterLevel(w, pgzip.BestCompression)
+}
+
+// Reader implements Compressor.Reader.
+func (GzipCompressor) Reader(r io.Reader) (io.Reader, error) {
+	return pgzip.NewReader(r)
+}
+
+// Magic implements Compressor.Magic.
+func (GzipCompressor) Magic() []byte {
+	return []byte{0x1f, 0x8b}
+}
+
+// XZCompressor compresses with xz, using the LZMA2 filter only and CRC32
+// checks, as the kernel's XZ decoder wants (see
+// Documentation/xz.txt in Linux).
+type XZCompressor struct{}
+
+// Writer implements Compressor.Writer.
+func (XZCompressor) Writer(w io.Writer) (io.WriteCloser, error) {
+	c := xz.WriterConfig{
+		DictCap:  1 << 20,
+		CheckSum: xz.CRC32,
+	}
+	return c.NewWriter(w)
+}
+
+// Reader implements Compressor.Reader.
+func (XZCompressor) Reader(r io.Reader) (io.Reader, error) {
+	return xz.NewReader(r)
+}
+
+// Magic implements Compressor.Magic.
+func (XZCompressor) Magic() []byte {
+	return []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+}
+
+// ZstdCompressor compresses with zstd.
+type ZstdCompressor struct{}
+
+// Writer implements Compressor.Writer.
+func (ZstdCompressor) Writer(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w,
+		zstd.WithEncoderLevel(zstd.SpeedBestCompression),
+		// A single encoder makes the output independent of the number
+		// of CPUs.
+		zstd.WithEncoderConcurrency(1))
+}
+
+// Reader implements Compressor.Reader.
+func (ZstdCompressor) Reader(r io.Reader) (io.Reader, error) {
+	return zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+}
+
+// Magic implements Compressor.Magic.
+func (ZstdCompressor) Magic() []byte {
+	return []byte{0x28, 0xb5, 0x2f, 0xfd}
+}
+
+// LZ4Compressor compresses with lz4, using the legacy frame format, which is
+// the only one the kernel unpacks.
+type LZ4Compressor struct{}
+
+// Writer implements Compressor.Writer.
+func (LZ4Compressor) Writer(w io.Writer) (io.WriteCloser, error) {
+	return newLZ4Writer(w), nil
+}
+
+// Reader implements Compressor.Reader.
+func (LZ4Compressor) Reader(r io.Reader) (io.Reader, error) {
+	return newLZ4Reader(r), nil
+}
+
+// Magic implements Compressor.Magic.
+func (LZ4Compressor) Magic() []byte {
+	return []byte{0x02, 0x21, 0x4c, 0x18}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/ulog/ulogtest"
+)
+
+func testRecords(prefix string) []cpio.Record {
+	return []cpio.Record{
+		cpio.Directory(prefix+"etc", 0755),
+		cpio.StaticFile(prefix+"etc/hostname", "u-root\n", 0644),
+		cpio.StaticFile(prefix+"init", strings.Repeat("#!/bin/sh\necho hello\n", 1000), 0755),
+		cpio.Symlink(prefix+"bin/sh", "elvish"),
+	}
+}
+
+func readAll(t *testing.T, r Reader) []cpio.Record {
+	t.Helper()
+	recs, err := cpio.ReadAllRecords(r)
+	if err != nil {
+		t.Fatalf("ReadAllRecords() = %v", err)
+	}
+	return recs
+}
+
+func TestCompressedArchiveRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "initramfs-compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, c := range Compressors {
+		t.Run(name, func(t *testing.T) {
+			ca := CPIOArchiver{RecordFormat: cpio.Newc, Compressor: c}
+			path := filepath.Join(dir, "initramfs.cpio."+name)
+			w, err := ca.OpenWriter(ulogtest.Logger{TB: t}, path, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cpio.WriteRecords(w, testRecords("")); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Finish(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			magic := make([]byte, len(c.Magic()))
+			if _, err := f.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, c.Magic()) {
+				t.Errorf("archive starts with %x (%v), want %x", magic, err, c.Magic())
+			}
+			if got := readAll(t, CPIO.Reader(f)); !cpio.AllEqual(got, testRecords("")) {
+				t.Errorf("read records %v, want %v", got, testRecords(""))
+			}
+		})
+	}
+}
+
+// archive returns an uncompressed newc archive of recs, padded to 512 bytes.
+func archive(t *testing.T, recs []cpio.Record) []byte {
+	t.Helper()
+	return formatArchive(t, cpio.Newc, recs)
+}
+
+func formatArchive(t *testing.T, format cpio.RecordFormat, recs []cpio.Record) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := format.Writer(&b)
+	if err := cpio.WriteRecords(w, recs); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpio.WriteTrailer(w); err != nil {
+		t.Fatal(err)
+	}
+	if pad := b.Len() % 512; pad != 0 {
+		b.Write(make([]byte, 512-pad))
+	}
+	return b.Bytes()
+}
+
+func compress(t *testing.T, c Compressor, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w, err := c.Writer(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestReaderSegments(t *testing.T) {
+	ucode := []cpio.Record{
+		cpio.Directory("kernel", 0755),
+		cpio.Directory("kernel/x86", 0755),
+		cpio.Directory("kernel/x86/microcode", 0755),
+		cpio.StaticFile("kernel/x86/microcode/GenuineIntel.bin", "microcode", 0644),
+	}
+	a := testRecords("a/")
+	b := testRecords("b/")
+
+	var all []cpio.Record
+	all = append(all, ucode...)
+	all = append(all, a...)
+	all = append(all, b...)
+
+	for name, c := range Compressors {
+		t.Run(name, func(t *testing.T) {
+			// An uncompressed microcode archive, followed by two
+			// compressed archives in one compressed stream.
+			data := archive(t, ucode)
+			data = append(data, compress(t, c, append(archive(t, a), archive(t, b)...))...)
+
+			if got := readAll(t, CPIO.Reader(bytes.NewReader(data))); !cpio.AllEqual(got, all) {
+				t.Errorf("read records %v, want %v", got, all)
+			}
+		})
+	}
+
+	t.Run("concatenated streams", func(t *testing.T) {
+		data := archive(t, ucode)
+		data = append(data, compress(t, Gzip, archive(t, a))...)
+		data = append(data, compress(t, Gzip, archive(t, b))...)
+
+		if got := readAll(t, CPIO.Reader(bytes.NewReader(data))); !cpio.AllEqual(got, all) {
+			t.Errorf("read records %v, want %v", got, all)
+		}
+	})
+
+	t.Run("uncompressed", func(t *testing.T) {
+		data := append(archive(t, ucode), archive(t, a)...)
+		if got, want := readAll(t, CPIO.Reader(bytes.NewReader(data))), append(ucode, a...); !cpio.AllEqual(got, want) {
+			t.Errorf("read records %v, want %v", got, want)
+		}
+	})
+
+	t.Run("other formats", func(t *testing.T) {
+		data := formatArchive(t, cpio.ODC, ucode)
+		data = append(data, compress(t, XZ, formatArchive(t, cpio.Bin, a))...)
+		if got, want := readAll(t, CPIO.Reader(bytes.NewReader(data))), append(ucode, a...); !cpio.AllEqual(got, want) {
+			t.Errorf("read records %v, want %v", got, want)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if got := readAll(t, CPIO.Reader(bytes.NewReader(nil))); len(got) != 0 {
+			t.Errorf("read records %v, want none", got)
+		}
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		data := append(archive(t, ucode), "garbage"...)
+		if _, err := cpio.ReadAllRecords(CPIO.Reader(bytes.NewReader(data))); err == nil || err == io.EOF {
+			t.Errorf("ReadAllRecords() = %v, want error", err)
+		}
+	})
+}
+
+func TestGetCompressor(t *testing.T) {
+	if c, err := GetCompressor("xz"); err != nil || c != XZ {
+		t.Errorf("GetCompressor(xz) = %v, %v, want %v", c, err, XZ)
+	}
+	if _, err := GetCompressor("bzip2"); err == nil {
+		t.Errorf("GetCompressor(bzip2) succeeded, want error")
+	}
+}
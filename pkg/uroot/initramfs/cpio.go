@@ -5,17 +5,23 @@
 package initramfs
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"os"
 
 	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/uio"
 	"github.com/u-root/u-root/pkg/ulog"
 )
 
 // CPIOArchiver is an implementation of Archiver for the cpio format.
 type CPIOArchiver struct {
 	cpio.RecordFormat
+
+	// Compressor, if set, compresses archives opened with OpenWriter.
+	Compressor Compressor
 }
 
 // OpenWriter opens `path` as the correct file type and returns an
@@ -35,24 +41,126 @@ func (ca CPIOArchiver) OpenWriter(l ulog.Logger, path, goos, goarch string) (Wri
 		return nil, err
 	}
 	l.Printf("Filename is %s", path)
-	return osWriter{ca.RecordFormat.Writer(f), f}, nil
+	if ca.Compressor == nil {
+		return osWriter{RecordWriter: ca.RecordFormat.Writer(f), f: f}, nil
+	}
+	c, err := ca.Compressor.Writer(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return osWriter{RecordWriter: ca.RecordFormat.Writer(c), c: c, f: f}, nil
 }
 
 // osWriter implements Writer.
 type osWriter struct {
 	cpio.RecordWriter
 
+	// c, if set, compresses the archive into f.
+	c io.Closer
 	f *os.File
 }
 
 // Finish implements Writer.Finish.
 func (o osWriter) Finish() error {
 	err := cpio.WriteTrailer(o)
+	if o.c != nil {
+		if cerr := o.c.Close(); err == nil {
+			err = cerr
+		}
+	}
 	o.f.Close()
 	return err
 }
 
 // Reader implements Archiver.Reader.
+//
+// Like the kernel, the Reader accepts several archives one after the other,
+// separated by zero padding. Each may be compressed with one of the
+// Compressors, e.g. an uncompressed early microcode archive followed by the
+// compressed initramfs. A compressed archive must be the last one, but may
+// itself hold several archives. The record format of each archive is
+// detected, so it need not be ca.RecordFormat.
 func (ca CPIOArchiver) Reader(r io.ReaderAt) Reader {
-	return ca.RecordFormat.Reader(r)
+	return &segmentReader{r: r}
+}
+
+// segmentReader reads the records of concatenated archives, skipping their
+// trailers.
+type segmentReader struct {
+	// r holds the archives, starting at pos. Once a compressed archive is
+	// found, r is replaced by the decompressed data.
+	r          io.ReaderAt
+	pos        int64
+	compressed bool
+
+	// cur reads the current archive, which starts at start.
+	cur   cpio.RecordReader
+	start int64
+}
+
+// ReadRecord implements cpio.RecordReader.
+func (s *segmentReader) ReadRecord() (cpio.Record, error) {
+	for {
+		if s.cur == nil {
+			if err := s.next(); err != nil {
+				return cpio.Record{}, err
+			}
+		}
+		rec, err := s.cur.ReadRecord()
+		if err != nil {
+			return cpio.Record{}, err
+		}
+		if rec.Name != cpio.Trailer {
+			return rec, nil
+		}
+		s.pos = s.start + rec.FilePos + int64(rec.FileSize)
+		s.cur = nil
+	}
+}
+
+// next finds the start of the next archive after the zero padding at pos.
+func (s *segmentReader) next() error {
+	buf := make([]byte, 512)
+	for {
+		n, err := s.r.ReadAt(buf, s.pos)
+		if n == 0 && err == io.EOF {
+			return io.EOF
+		}
+		if n == 0 && err != nil {
+			return err
+		}
+		data := bytes.TrimLeft(buf[:n], "\x00")
+		s.pos += int64(n - len(data))
+		if len(data) == 0 {
+			continue
+		}
+
+		if format, err := cpio.Detect(bytes.NewReader(data)); err == nil {
+			s.start = s.pos
+			s.cur = format.Reader(io.NewSectionReader(s.r, s.pos, math.MaxInt64-s.pos))
+			// Trailers end the archive, not the whole file.
+			if e, ok := s.cur.(cpio.EOFReader); ok {
+				s.cur = e.RecordReader
+			}
+			return nil
+		}
+
+		c := detectCompressor(data)
+		if c == nil || s.compressed {
+			return fmt.Errorf("unknown data at offset %d of initramfs: %x", s.pos, data[:min(len(data), 8)])
+		}
+		d, err := c.Reader(io.NewSectionReader(s.r, s.pos, math.MaxInt64-s.pos))
+		if err != nil {
+			return err
+		}
+		s.r, s.pos, s.compressed = uio.NewCachingReader(d), 0, true
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
@@ -0,0 +1,631 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+// ErofsMagic is the magic number of an erofs superblock, which starts
+// 1024 bytes into the image.
+const ErofsMagic uint32 = 0xe0f5e1e2
+
+// The erofs format, as Linux reads it; see
+// Documentation/filesystems/erofs.rst and fs/erofs/erofs_fs.h in Linux.
+const (
+	erofsBlockLog    = 12
+	erofsBlockSize   = 1 << erofsBlockLog
+	erofsSuperOffset = 1024
+
+	// Inodes are addressed by their nid, their offset from the start of
+	// the metadata in 32-byte slots.
+	erofsSlotSize = 32
+
+	erofsInodeSize        = 64
+	erofsCompactInodeSize = 32
+	// erofsMaxInline is the largest tail of a file stored right after
+	// its inode, in the same block.
+	erofsMaxInline = erofsBlockSize - erofsInodeSize
+
+	// erofsMaxExtent is the most a compressed block decompresses to.
+	erofsMaxExtent = 128 << 10
+
+	// erofsFeatureLZ4ZeroPadding says compressed data is at the end of
+	// its block, after zeros.
+	erofsFeatureLZ4ZeroPadding = 0x1
+
+	// Data layouts.
+	erofsFlatPlain         = 0
+	erofsCompressedFull    = 1
+	erofsFlatInline        = 2
+	erofsCompressedCompact = 3
+
+	// Types of logical clusters in compressed files.
+	erofsClusterPlain   = 0
+	erofsClusterHead    = 1
+	erofsClusterNonHead = 2
+)
+
+// Directory entry file types.
+const (
+	erofsFileTypeReg = 1 + iota
+	erofsFileTypeDir
+	erofsFileTypeChr
+	erofsFileTypeBlk
+	erofsFileTypeFifo
+	erofsFileTypeSock
+	erofsFileTypeSymlink
+)
+
+type erofsSuperblock struct {
+	Magic           uint32
+	Checksum        uint32
+	FeatureCompat   uint32
+	BlkSzBits       uint8
+	ExtSlots        uint8
+	RootNid         uint16
+	Inos            uint64
+	BuildTime       uint64
+	BuildTimeNsec   uint32
+	Blocks          uint32
+	MetaBlkAddr     uint32
+	XattrBlkAddr    uint32
+	UUID            [16]byte
+	VolumeName      [16]byte
+	FeatureIncompat uint32
+	U1              uint16
+	ExtraDevices    uint16
+	DevtSlotOff     uint16
+	Reserved        [38]byte
+}
+
+// erofsInode is an extended inode. U is the block address of the data, the
+// number of compressed blocks, or the device number.
+type erofsInode struct {
+	Format      uint16
+	XattrICount uint16
+	Mode        uint16
+	Reserved    uint16
+	Size        uint64
+	U           uint32
+	Ino         uint32
+	UID         uint32
+	GID         uint32
+	MTime       uint64
+	MTimeNsec   uint32
+	NLink       uint32
+	Reserved2   [16]byte
+}
+
+// erofsCompactInode is a compact inode, which has the build time of the
+// image as its mtime.
+type erofsCompactInode struct {
+	Format      uint16
+	XattrICount uint16
+	Mode        uint16
+	NLink       uint16
+	Size        uint32
+	Reserved    uint32
+	U           uint32
+	Ino         uint32
+	UID         uint16
+	GID         uint16
+	Reserved2   uint32
+}
+
+// erofsDirent is a directory entry. Its name starts at NameOff in the
+// directory block and ends where the next one starts.
+type erofsDirent struct {
+	Nid      uint64
+	NameOff  uint16
+	FileType uint8
+	Reserved uint8
+}
+
+// erofsMapHeader follows the inodes of compressed files, and is followed by
+// 8 bytes of padding and one erofsIndex per logical cluster.
+type erofsMapHeader struct {
+	FragmentOff   uint32
+	Advise        uint16
+	AlgorithmType uint8
+	ClusterBits   uint8
+}
+
+// erofsIndex describes a logical cluster of a compressed file. Head and
+// plain clusters start an extent at ClusterOfs, and U is the block it is
+// stored in. For non-head clusters, the low half of U is the distance to the
+// cluster of the extent's head, the high half the distance to the next
+// head.
+type erofsIndex struct {
+	Advise     uint16
+	ClusterOfs uint16
+	U          uint32
+}
+
+// ErofsArchiver is an implementation of Archiver for erofs images, which
+// Linux can mount read-only, e.g. as the root file system. Images are
+// written without mkfs.erofs.
+//
+// Hard links are stored as copies.
+type ErofsArchiver struct {
+	// Compressor, if set, compresses regular files of images opened
+	// with OpenWriter. Only LZ4 is supported, as it is the only
+	// compression all Linux versions with erofs read.
+	Compressor Compressor
+}
+
+// OpenWriter implements Archiver.OpenWriter.
+//
+// If `path` is empty, a default path of /tmp/initramfs.GOOS_GOARCH.erofs is
+// used.
+func (ea ErofsArchiver) OpenWriter(l ulog.Logger, path, goos, goarch string) (Writer, error) {
+	if len(path) == 0 && len(goos) == 0 && len(goarch) == 0 {
+		return nil, fmt.Errorf("passed no path, GOOS, and GOARCH to ErofsArchiver.OpenWriter")
+	}
+	if len(path) == 0 {
+		path = fmt.Sprintf("/tmp/initramfs.%s_%s.erofs", goos, goarch)
+	}
+	var compress bool
+	switch ea.Compressor.(type) {
+	case nil:
+	case LZ4Compressor:
+		compress = true
+	default:
+		return nil, fmt.Errorf("erofs images can only be compressed with lz4, not %T", ea.Compressor)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l.Printf("Filename is %s", path)
+	return &erofsWriter{f: f, compress: compress, root: newFSTree()}, nil
+}
+
+// erofsWriter implements Writer. The image is laid out once all records are
+// known.
+type erofsWriter struct {
+	f        *os.File
+	compress bool
+	root     *fsNode
+}
+
+// WriteRecord implements Writer.WriteRecord.
+func (w *erofsWriter) WriteRecord(r cpio.Record) error {
+	return w.root.add(r)
+}
+
+// Finish implements Writer.Finish.
+func (w *erofsWriter) Finish() error {
+	err := writeErofs(w.f, w.root, w.compress)
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// erofsImage lays out an image.
+//
+// The image starts with the superblock, followed by the data blocks of
+// regular files and symlinks, then the inodes, and then the data blocks of
+// directories, which need to know the nids of the inodes.
+type erofsImage struct {
+	w        *bufio.Writer
+	blocks   uint32
+	compress bool
+	table    []int32
+
+	files map[*fsNode]*erofsFile
+}
+
+// erofsFile is how a file is stored.
+type erofsFile struct {
+	layout  uint16
+	blkaddr uint32
+	// blocks is the number of blocks the data takes up.
+	blocks uint32
+
+	// tail is the end of the data, stored after the inode.
+	tail []byte
+	// indexes describe the extents of compressed data.
+	indexes []erofsIndex
+
+	// dir are the blocks of the entries of directories.
+	dir [][]erofsEntry
+
+	nid uint64
+}
+
+// erofsEntry is a directory entry.
+type erofsEntry struct {
+	name string
+	n    *fsNode
+}
+
+// metaSize is the size of the inode and what follows it.
+func (f *erofsFile) metaSize() int {
+	if f.layout == erofsCompressedFull {
+		return erofsInodeSize + binary.Size(erofsMapHeader{}) + 8 + len(f.indexes)*binary.Size(erofsIndex{})
+	}
+	return erofsInodeSize + len(f.tail)
+}
+
+// writeErofs writes the tree below root as an erofs image to f.
+func writeErofs(f io.WriteSeeker, root *fsNode, compress bool) error {
+	im := &erofsImage{
+		w:        bufio.NewWriter(f),
+		compress: compress,
+		table:    make([]int32, 1<<lz4HashLog),
+		files:    make(map[*fsNode]*erofsFile),
+	}
+	root.sort()
+
+	var inodes uint32
+	var mtime uint64
+	if err := root.walk(func(n *fsNode) error {
+		inodes++
+		n.ino = inodes
+		if n.MTime > mtime {
+			mtime = n.MTime
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// The superblock is in the first block.
+	im.write(make([]byte, erofsBlockSize))
+	if err := root.walk(im.writeData); err != nil {
+		return err
+	}
+
+	// Lay out the inodes. An inode and the data right after it must
+	// not cross a block boundary.
+	metaBlkAddr := im.blocks
+	var off int
+	if err := root.walk(func(n *fsNode) error {
+		f := im.files[n]
+		if n.isDir() {
+			f = im.dirFile(n)
+		}
+		need := f.metaSize()
+		if f.layout == erofsCompressedFull {
+			need = erofsInodeSize + binary.Size(erofsMapHeader{})
+		}
+		if off%erofsBlockSize+need > erofsBlockSize {
+			off = roundUp(off, erofsBlockSize)
+		}
+		f.nid = uint64(off / erofsSlotSize)
+		off = roundUp(off+f.metaSize(), erofsSlotSize)
+		return nil
+	}); err != nil {
+		return err
+	}
+	meta := make([]byte, roundUp(off, erofsBlockSize))
+	dirBlocks := metaBlkAddr + uint32(len(meta)/erofsBlockSize)
+
+	// Directories' blocks follow the inodes.
+	if err := root.walk(func(n *fsNode) error {
+		if f := im.files[n]; n.isDir() && f.blocks > 0 {
+			f.blkaddr = dirBlocks
+			dirBlocks += f.blocks
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := root.walk(func(n *fsNode) error {
+		return im.putInode(meta, n)
+	}); err != nil {
+		return err
+	}
+	im.write(meta)
+	if err := root.walk(func(n *fsNode) error {
+		if f := im.files[n]; n.isDir() && f.blocks > 0 {
+			for _, b := range f.dir[:f.blocks] {
+				im.write(im.dirBlock(b, true))
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := im.w.Flush(); err != nil {
+		return err
+	}
+
+	sb := erofsSuperblock{
+		Magic:     ErofsMagic,
+		BlkSzBits: erofsBlockLog,
+		// The root inode is the first one.
+		RootNid:     0,
+		Inos:        uint64(inodes),
+		BuildTime:   mtime,
+		Blocks:      im.blocks,
+		MetaBlkAddr: metaBlkAddr,
+	}
+	if compress {
+		sb.FeatureIncompat = erofsFeatureLZ4ZeroPadding
+	}
+	if _, err := f.Seek(erofsSuperOffset, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(f, binary.LittleEndian, sb)
+}
+
+func roundUp(n, to int) int {
+	return (n + to - 1) / to * to
+}
+
+// write writes whole blocks of b after the blocks written so far. Errors
+// are returned by the final flush.
+func (im *erofsImage) write(b []byte) {
+	im.w.Write(b)
+	if pad := len(b) % erofsBlockSize; pad != 0 {
+		im.w.Write(make([]byte, erofsBlockSize-pad))
+	}
+	im.blocks += uint32(roundUp(len(b), erofsBlockSize) / erofsBlockSize)
+}
+
+// writeData writes the data blocks of regular files and symlinks.
+func (im *erofsImage) writeData(n *fsNode) error {
+	switch n.Mode & cpio.S_IFMT {
+	case cpio.S_IFREG, cpio.S_IFLNK:
+	default:
+		im.files[n] = &erofsFile{}
+		return nil
+	}
+
+	data, err := n.contents()
+	n.close()
+	if err != nil {
+		return err
+	}
+	if im.compress && n.Mode&cpio.S_IFMT == cpio.S_IFREG && len(data) > erofsBlockSize {
+		if f := im.writeCompressed(data); f != nil {
+			im.files[n] = f
+			return nil
+		}
+	}
+	f := &erofsFile{}
+	im.writePlain(f, data)
+	im.files[n] = f
+	return nil
+}
+
+// writePlain writes data uncompressed, with its tail after the inode if it
+// fits there.
+func (im *erofsImage) writePlain(f *erofsFile, data []byte) {
+	full := len(data) / erofsBlockSize * erofsBlockSize
+	f.layout = erofsFlatPlain
+	if tail := len(data) - full; tail > 0 && tail <= erofsMaxInline {
+		f.layout = erofsFlatInline
+		f.tail = data[full:]
+		data = data[:full]
+	}
+	if len(data) > 0 {
+		f.blkaddr = im.blocks
+		f.blocks = uint32(roundUp(len(data), erofsBlockSize) / erofsBlockSize)
+		im.write(data)
+	}
+}
+
+// erofsExtent is a run of file data stored in one block.
+type erofsExtent struct {
+	start int
+	plain bool
+	block []byte
+}
+
+// writeCompressed writes data as lz4 compressed blocks, each holding an
+// extent of the data, and returns how it is stored, or nil if compressing
+// saves no blocks.
+//
+// Extents that do not compress to less than half are stored as one plain
+// block of data. Extents but the last are at least a block long, so each
+// logical cluster has at most one extent starting in it.
+func (im *erofsImage) writeCompressed(data []byte) *erofsFile {
+	var extents []erofsExtent
+	for pos := 0; pos < len(data); {
+		src := data[pos:]
+		if len(src) > erofsMaxExtent {
+			src = src[:erofsMaxExtent]
+		}
+		c, n := lz4CompressDestSize(nil, src, erofsBlockSize, im.table)
+		if n >= 2*erofsBlockSize || (n == len(data)-pos && n > erofsBlockSize) {
+			// Compressed data is at the end of its block.
+			block := make([]byte, erofsBlockSize-len(c), erofsBlockSize)
+			extents = append(extents, erofsExtent{start: pos, block: append(block, c...)})
+			pos += n
+			continue
+		}
+		if len(src) > erofsBlockSize {
+			src = src[:erofsBlockSize]
+		}
+		extents = append(extents, erofsExtent{start: pos, plain: true, block: src})
+		pos += len(src)
+	}
+	if len(extents) >= len(data)/erofsBlockSize {
+		return nil
+	}
+
+	f := &erofsFile{
+		layout:  erofsCompressedFull,
+		blocks:  uint32(len(extents)),
+		indexes: make([]erofsIndex, (len(data)+erofsBlockSize-1)/erofsBlockSize),
+	}
+	for i := range f.indexes {
+		f.indexes[i].Advise = erofsClusterNonHead
+	}
+	for i, e := range extents {
+		idx := &f.indexes[e.start/erofsBlockSize]
+		idx.Advise = erofsClusterHead
+		if e.plain {
+			idx.Advise = erofsClusterPlain
+		}
+		idx.ClusterOfs = uint16(e.start % erofsBlockSize)
+		idx.U = im.blocks
+		im.write(e.block)
+
+		// Point the clusters up to the next head at this one.
+		head := e.start / erofsBlockSize
+		next := len(f.indexes)
+		if i+1 < len(extents) {
+			next = extents[i+1].start / erofsBlockSize
+		}
+		for c := head + 1; c < next; c++ {
+			f.indexes[c].U = uint32(c-head) | uint32(next-c)<<16
+		}
+	}
+	return f
+}
+
+// erofsFileType returns the directory entry file type of mode.
+func erofsFileType(mode uint64) uint8 {
+	switch mode & cpio.S_IFMT {
+	case cpio.S_IFREG:
+		return erofsFileTypeReg
+	case cpio.S_IFDIR:
+		return erofsFileTypeDir
+	case cpio.S_IFCHR:
+		return erofsFileTypeChr
+	case cpio.S_IFBLK:
+		return erofsFileTypeBlk
+	case cpio.S_IFIFO:
+		return erofsFileTypeFifo
+	case cpio.S_IFSOCK:
+		return erofsFileTypeSock
+	case cpio.S_IFLNK:
+		return erofsFileTypeSymlink
+	}
+	return 0
+}
+
+// dirFile splits the entries of the directory n into blocks, and returns
+// how they are stored: the last block after the inode if it fits there.
+func (im *erofsImage) dirFile(n *fsNode) *erofsFile {
+	entries := []erofsEntry{{".", n}, {"..", n.parent}}
+	for _, c := range n.children {
+		entries = append(entries, erofsEntry{c.name, c})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	f := im.files[n]
+	var used int
+	for _, e := range entries {
+		size := binary.Size(erofsDirent{}) + len(e.name)
+		if len(f.dir) == 0 || used+size > erofsBlockSize {
+			f.dir = append(f.dir, nil)
+			used = 0
+		}
+		f.dir[len(f.dir)-1] = append(f.dir[len(f.dir)-1], e)
+		used += size
+	}
+
+	f.layout = erofsFlatPlain
+	f.blocks = uint32(len(f.dir))
+	if used <= erofsMaxInline {
+		f.layout = erofsFlatInline
+		f.blocks--
+		// The tail is filled in once the nids are known.
+		f.tail = make([]byte, used)
+	}
+	return f
+}
+
+// dirBlock returns a block of directory entries, padded to the block size if
+// full is set.
+func (im *erofsImage) dirBlock(entries []erofsEntry, full bool) []byte {
+	var b bytes.Buffer
+	nameOff := len(entries) * binary.Size(erofsDirent{})
+	for _, e := range entries {
+		binary.Write(&b, binary.LittleEndian, erofsDirent{
+			Nid:      im.files[e.n].nid,
+			NameOff:  uint16(nameOff),
+			FileType: erofsFileType(e.n.Mode),
+		})
+		nameOff += len(e.name)
+	}
+	for _, e := range entries {
+		b.WriteString(e.name)
+	}
+	if full {
+		b.Write(make([]byte, erofsBlockSize-b.Len()))
+	}
+	return b.Bytes()
+}
+
+// putInode puts the inode of n and what follows it into the metadata.
+func (im *erofsImage) putInode(meta []byte, n *fsNode) error {
+	f := im.files[n]
+	if n.isDir() && f.layout == erofsFlatInline {
+		f.tail = im.dirBlock(f.dir[len(f.dir)-1], false)
+	}
+
+	in := erofsInode{
+		Format: 1 | f.layout<<1,
+		Mode:   uint16(n.Mode),
+		Size:   n.FileSize,
+		U:      f.blkaddr,
+		Ino:    n.ino,
+		UID:    uint32(n.UID),
+		GID:    uint32(n.GID),
+		MTime:  n.MTime,
+		NLink:  1,
+	}
+	switch n.Mode & cpio.S_IFMT {
+	case cpio.S_IFDIR:
+		in.Size = uint64(f.blocks)*erofsBlockSize + uint64(len(f.tail))
+		in.NLink = uint32(2 + n.subdirs())
+	case cpio.S_IFREG:
+		if f.layout == erofsCompressedFull {
+			in.U = f.blocks
+		}
+	case cpio.S_IFCHR, cpio.S_IFBLK:
+		in.U = newEncodeDev(n.Rmajor, n.Rminor)
+		in.Size = 0
+	case cpio.S_IFIFO, cpio.S_IFSOCK:
+		in.Size = 0
+	}
+
+	w := &sliceWriter{b: meta, off: int(f.nid) * erofsSlotSize}
+	binary.Write(w, binary.LittleEndian, in)
+	if f.layout == erofsCompressedFull {
+		// The map header says extents are lz4 compressed into single
+		// blocks; it is followed by 8 bytes of padding.
+		binary.Write(w, binary.LittleEndian, erofsMapHeader{})
+		w.off += 8
+		binary.Write(w, binary.LittleEndian, f.indexes)
+	}
+	w.Write(f.tail)
+	return nil
+}
+
+// sliceWriter writes into a byte slice.
+type sliceWriter struct {
+	b   []byte
+	off int
+}
+
+// Write implements io.Writer.
+func (s *sliceWriter) Write(p []byte) (int, error) {
+	n := copy(s.b[s.off:], p)
+	s.off += n
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
@@ -0,0 +1,401 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/u-root/u-root/pkg/cpio"
+)
+
+// Reader implements Archiver.Reader.
+//
+// It reads erofs images with uncompressed files, and files compressed with
+// lz4 into single blocks with full indexes, as ErofsArchiver and
+// `mkfs.erofs -Elegacy-compress` write them. Extended attributes are
+// ignored.
+func (ErofsArchiver) Reader(r io.ReaderAt) Reader {
+	e, err := newErofsReader(r)
+	if err != nil {
+		return &recordList{err: err}
+	}
+	recs, err := e.records()
+	return &recordList{recs: recs, err: err}
+}
+
+// isErofs returns whether r has the erofs magic number where the superblock
+// would be.
+func isErofs(r io.ReaderAt) bool {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], erofsSuperOffset); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(magic[:]) == ErofsMagic
+}
+
+// erofsReader reads an erofs image.
+type erofsReader struct {
+	r  io.ReaderAt
+	sb erofsSuperblock
+	bs int64
+}
+
+func newErofsReader(r io.ReaderAt) (*erofsReader, error) {
+	e := &erofsReader{r: r}
+	if err := binary.Read(io.NewSectionReader(r, erofsSuperOffset, int64(binary.Size(e.sb))), binary.LittleEndian, &e.sb); err != nil {
+		return nil, fmt.Errorf("reading erofs superblock: %v", err)
+	}
+	if e.sb.Magic != ErofsMagic {
+		return nil, fmt.Errorf("not an erofs image: magic is %#x, want %#x", e.sb.Magic, ErofsMagic)
+	}
+	if e.sb.BlkSzBits < 9 || e.sb.BlkSzBits > 16 {
+		return nil, fmt.Errorf("invalid erofs block size 2^%d", e.sb.BlkSzBits)
+	}
+	if f := e.sb.FeatureIncompat &^ erofsFeatureLZ4ZeroPadding; f != 0 {
+		return nil, fmt.Errorf("unsupported erofs features %#x", f)
+	}
+	e.bs = 1 << e.sb.BlkSzBits
+	return e, nil
+}
+
+// erofsInodeInfo is an inode read from an image.
+type erofsInodeInfo struct {
+	cpio.Info
+	layout uint16
+	u      uint32
+	// pos is where the data after the inode and its xattrs starts.
+	pos int64
+}
+
+// inode reads the inode nid.
+func (e *erofsReader) inode(nid uint64) (*erofsInodeInfo, error) {
+	pos := int64(e.sb.MetaBlkAddr)*e.bs + int64(nid)*erofsSlotSize
+	var format [2]byte
+	if _, err := e.r.ReadAt(format[:], pos); err != nil {
+		return nil, fmt.Errorf("reading erofs inode %d: %v", nid, err)
+	}
+
+	in := &erofsInodeInfo{Info: cpio.Info{Ino: nid}}
+	f := binary.LittleEndian.Uint16(format[:])
+	in.layout = f >> 1 & 7
+	var xattrCount uint16
+	if f&1 == 1 {
+		var d erofsInode
+		if err := binary.Read(io.NewSectionReader(e.r, pos, erofsInodeSize), binary.LittleEndian, &d); err != nil {
+			return nil, fmt.Errorf("reading erofs inode %d: %v", nid, err)
+		}
+		xattrCount = d.XattrICount
+		in.Mode, in.NLink, in.FileSize, in.u = uint64(d.Mode), uint64(d.NLink), d.Size, d.U
+		in.UID, in.GID, in.MTime = uint64(d.UID), uint64(d.GID), d.MTime
+		pos += erofsInodeSize
+	} else {
+		var d erofsCompactInode
+		if err := binary.Read(io.NewSectionReader(e.r, pos, erofsCompactInodeSize), binary.LittleEndian, &d); err != nil {
+			return nil, fmt.Errorf("reading erofs inode %d: %v", nid, err)
+		}
+		xattrCount = d.XattrICount
+		in.Mode, in.NLink, in.FileSize, in.u = uint64(d.Mode), uint64(d.NLink), uint64(d.Size), d.U
+		in.UID, in.GID, in.MTime = uint64(d.UID), uint64(d.GID), e.sb.BuildTime
+		pos += erofsCompactInodeSize
+	}
+	if xattrCount > 0 {
+		// A 12 byte header and 4 byte slots.
+		pos += 12 + int64(xattrCount-1)*4
+	}
+	in.pos = pos
+
+	switch in.Mode & cpio.S_IFMT {
+	case cpio.S_IFCHR, cpio.S_IFBLK:
+		in.Rmajor, in.Rminor = newDecodeDev(in.u)
+		in.FileSize = 0
+	case cpio.S_IFIFO, cpio.S_IFSOCK:
+		in.FileSize = 0
+	case cpio.S_IFREG, cpio.S_IFDIR, cpio.S_IFLNK:
+	default:
+		return nil, fmt.Errorf("erofs inode %d has unknown mode %#o", nid, in.Mode)
+	}
+	return in, nil
+}
+
+// data returns a reader of the data of in.
+func (e *erofsReader) data(in *erofsInodeInfo) (io.ReaderAt, error) {
+	size := int64(in.FileSize)
+	switch in.layout {
+	case erofsFlatPlain:
+		return io.NewSectionReader(e.r, int64(in.u)*e.bs, size), nil
+	case erofsFlatInline:
+		// All but the last block are in the data blocks; the last
+		// block follows the inode.
+		full := (size + e.bs - 1) / e.bs * e.bs
+		if full > 0 {
+			full -= e.bs
+		}
+		if in.pos%e.bs+size-full > e.bs {
+			return nil, fmt.Errorf("erofs inode %d has inline data crossing a block", in.Ino)
+		}
+		return &erofsInlineFile{
+			blocks: io.NewSectionReader(e.r, int64(in.u)*e.bs, full),
+			tail:   io.NewSectionReader(e.r, in.pos, size-full),
+			full:   full,
+		}, nil
+	case erofsCompressedFull:
+		return e.compressed(in)
+	}
+	return nil, fmt.Errorf("erofs inode %d has unsupported data layout %d", in.Ino, in.layout)
+}
+
+// erofsInlineFile reads data whose last block follows the inode.
+type erofsInlineFile struct {
+	blocks, tail *io.SectionReader
+	full         int64
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *erofsInlineFile) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	if off < f.full {
+		k, err := f.blocks.ReadAt(p, off)
+		if k == len(p) || err != io.EOF {
+			return k, err
+		}
+		n = k
+	}
+	k, err := f.tail.ReadAt(p[n:], off+int64(n)-f.full)
+	return n + k, err
+}
+
+// erofsCompressedFile reads files compressed into extents.
+type erofsCompressedFile struct {
+	e       *erofsReader
+	ino     uint64
+	size    int64
+	extents []erofsExtentInfo
+
+	// cur is the index of the extent in buf.
+	cur int
+	buf []byte
+}
+
+type erofsExtentInfo struct {
+	start, end int64
+	plain      bool
+	block      int64
+}
+
+// compressed reads the extents of the compressed file in.
+func (e *erofsReader) compressed(in *erofsInodeInfo) (*erofsCompressedFile, error) {
+	pos := (in.pos + 7) / 8 * 8
+	var h erofsMapHeader
+	if err := binary.Read(io.NewSectionReader(e.r, pos, 8), binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("reading erofs inode %d: %v", in.Ino, err)
+	}
+	if h.Advise != 0 || h.AlgorithmType != 0 || h.ClusterBits != 0 {
+		return nil, fmt.Errorf("erofs inode %d uses unsupported compression settings", in.Ino)
+	}
+
+	size := int64(in.FileSize)
+	indexes := make([]erofsIndex, (size+e.bs-1)/e.bs)
+	if err := binary.Read(io.NewSectionReader(e.r, pos+16, int64(len(indexes))*8), binary.LittleEndian, indexes); err != nil {
+		return nil, fmt.Errorf("reading erofs inode %d: %v", in.Ino, err)
+	}
+
+	f := &erofsCompressedFile{e: e, ino: in.Ino, size: size, cur: -1}
+	for i, idx := range indexes {
+		switch idx.Advise & 3 {
+		case erofsClusterPlain, erofsClusterHead:
+			if int64(idx.ClusterOfs) >= e.bs {
+				return nil, fmt.Errorf("erofs inode %d has invalid cluster %d", in.Ino, i)
+			}
+			x := erofsExtentInfo{
+				start: int64(i)*e.bs + int64(idx.ClusterOfs),
+				plain: idx.Advise&3 == erofsClusterPlain,
+				block: int64(idx.U),
+			}
+			if n := len(f.extents); n > 0 {
+				f.extents[n-1].end = x.start
+			}
+			f.extents = append(f.extents, x)
+		case erofsClusterNonHead:
+		default:
+			return nil, fmt.Errorf("erofs inode %d has unsupported cluster type %d", in.Ino, idx.Advise&3)
+		}
+	}
+	if size > 0 && (len(f.extents) == 0 || f.extents[0].start != 0) {
+		return nil, fmt.Errorf("erofs inode %d does not start with an extent", in.Ino)
+	}
+	if n := len(f.extents); n > 0 {
+		f.extents[n-1].end = size
+	}
+	for _, x := range f.extents {
+		if x.end <= x.start {
+			return nil, fmt.Errorf("erofs inode %d has an empty extent at %d", in.Ino, x.start)
+		}
+	}
+	return f, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *erofsCompressedFile) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) && off < f.size {
+		i := sort.Search(len(f.extents), func(i int) bool {
+			return f.extents[i].end > off
+		})
+		if err := f.load(i); err != nil {
+			return n, err
+		}
+		c := copy(p[n:], f.buf[off-f.extents[i].start:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// load decompresses extent i into buf.
+func (f *erofsCompressedFile) load(i int) error {
+	if i == f.cur {
+		return nil
+	}
+	x := f.extents[i]
+	block := make([]byte, f.e.bs)
+	if _, err := f.e.r.ReadAt(block, x.block*f.e.bs); err != nil {
+		return fmt.Errorf("reading erofs inode %d: %v", f.ino, err)
+	}
+	want := int(x.end - x.start)
+	if x.plain {
+		if want > len(block) {
+			return fmt.Errorf("erofs inode %d has a plain extent of %d bytes", f.ino, want)
+		}
+		f.cur, f.buf = i, block[:want]
+		return nil
+	}
+	// Without zero padding, compressed data is followed by zeros
+	// instead, which do not decompress.
+	if f.e.sb.FeatureIncompat&erofsFeatureLZ4ZeroPadding == 0 {
+		return fmt.Errorf("erofs inode %d is compressed without zero padding, which is unsupported", f.ino)
+	}
+	b, err := lz4DecompressBlock(make([]byte, 0, want), bytes.TrimLeft(block, "\x00"), want)
+	if err == nil && len(b) != want {
+		err = errLZ4Corrupt
+	}
+	if err != nil {
+		return fmt.Errorf("decompressing erofs inode %d: %v", f.ino, err)
+	}
+	f.cur, f.buf = i, b
+	return nil
+}
+
+// dirents reads the entries of the directory in, but . and .., and returns
+// their names and nids.
+func (e *erofsReader) dirents(in *erofsInodeInfo) ([]string, []uint64, error) {
+	r, err := e.data(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make([]byte, in.FileSize)
+	if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("reading erofs directory %d: %v", in.Ino, err)
+	}
+
+	var names []string
+	var nids []uint64
+	direntSize := binary.Size(erofsDirent{})
+	for len(data) > 0 {
+		block := data
+		if int64(len(block)) > e.bs {
+			block = block[:e.bs]
+		}
+		data = data[len(block):]
+		if len(block) < direntSize {
+			return nil, nil, fmt.Errorf("erofs directory %d has a short block", in.Ino)
+		}
+		count := int(binary.LittleEndian.Uint16(block[8:])) / direntSize
+		if count == 0 || count*direntSize > len(block) {
+			return nil, nil, fmt.Errorf("erofs directory %d has an invalid block", in.Ino)
+		}
+		for i := 0; i < count; i++ {
+			d := block[i*direntSize:]
+			start := int(binary.LittleEndian.Uint16(d[8:]))
+			end := len(block)
+			if i+1 < count {
+				end = int(binary.LittleEndian.Uint16(d[direntSize+8:]))
+			}
+			if start < count*direntSize || start > end || end > len(block) {
+				return nil, nil, fmt.Errorf("erofs directory %d has an invalid entry", in.Ino)
+			}
+			name := block[start:end]
+			if i+1 == count {
+				// The last name of a block is padded with zeros.
+				name = bytes.TrimRight(name, "\x00")
+			}
+			if len(name) == 0 || bytes.IndexByte(name, '/') >= 0 {
+				return nil, nil, fmt.Errorf("erofs directory %d has invalid name %q", in.Ino, name)
+			}
+			if string(name) == "." || string(name) == ".." {
+				continue
+			}
+			names = append(names, string(name))
+			nids = append(nids, binary.LittleEndian.Uint64(d))
+		}
+	}
+	return names, nids, nil
+}
+
+// records returns the records of all files in the image, parents first.
+func (e *erofsReader) records() ([]cpio.Record, error) {
+	root, err := e.inode(uint64(e.sb.RootNid))
+	if err != nil {
+		return nil, err
+	}
+	if root.Mode&cpio.S_IFMT != cpio.S_IFDIR {
+		return nil, fmt.Errorf("erofs root inode is not a directory")
+	}
+
+	var recs []cpio.Record
+	// The depth limit stops directory loops in corrupt images.
+	var walk func(dir *erofsInodeInfo, name string, depth int) error
+	walk = func(dir *erofsInodeInfo, name string, depth int) error {
+		if depth > 256 {
+			return fmt.Errorf("erofs directories nested deeper than 256 at %s", name)
+		}
+		names, nids, err := e.dirents(dir)
+		if err != nil {
+			return err
+		}
+		for i, n := range names {
+			in, err := e.inode(nids[i])
+			if err != nil {
+				return err
+			}
+			in.Name = path.Join(name, n)
+			rec := cpio.Record{Info: in.Info}
+			switch in.Mode & cpio.S_IFMT {
+			case cpio.S_IFREG, cpio.S_IFLNK:
+				if rec.ReaderAt, err = e.data(in); err != nil {
+					return err
+				}
+			}
+			recs = append(recs, rec)
+			if in.Mode&cpio.S_IFMT == cpio.S_IFDIR {
+				if err := walk(in, in.Name, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root, "", 0); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/ulog/ulogtest"
+)
+
+func TestErofsRoundTrip(t *testing.T) {
+	uncompressed := checkImageRoundTrip(t, Erofs, imageRecords())
+	if len(uncompressed)%erofsBlockSize != 0 {
+		t.Errorf("image is %d bytes, want a multiple of %d", len(uncompressed), erofsBlockSize)
+	}
+	if again := checkImageRoundTrip(t, Erofs, imageRecords()); !bytes.Equal(uncompressed, again) {
+		t.Errorf("writing the same records twice gave different images")
+	}
+
+	compressed := checkImageRoundTrip(t, ErofsArchiver{Compressor: LZ4}, imageRecords())
+	if len(compressed) >= len(uncompressed) {
+		t.Errorf("compressed image is %d bytes, uncompressed %d", len(compressed), len(uncompressed))
+	}
+
+	for _, tt := range []struct {
+		name  string
+		image []byte
+	}{
+		{"uncompressed", uncompressed},
+		{"lz4", compressed},
+	} {
+		t.Run("fsck.erofs/"+tt.name, func(t *testing.T) {
+			dir, _ := runImageTool(t, tt.image, "fsck.erofs", "image")
+			os.RemoveAll(dir)
+		})
+	}
+}
+
+func TestErofsErrors(t *testing.T) {
+	if _, err := (ErofsArchiver{Compressor: Gzip}).OpenWriter(ulogtest.Logger{TB: t}, "", "linux", "amd64"); err == nil {
+		t.Errorf("OpenWriter with gzip succeeded")
+	}
+	if _, err := cpio.ReadAllRecords(Erofs.Reader(bytes.NewReader(archive(t, testRecords(""))))); err == nil {
+		t.Errorf("reading a cpio archive as erofs succeeded")
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	for _, a := range []Archiver{Squashfs, Erofs} {
+		image := checkImageRoundTrip(t, a, testRecords(""))
+		want := readAll(t, a.Reader(bytes.NewReader(image)))
+		if got := readAll(t, OpenReader(bytes.NewReader(image))); !cpio.AllEqual(got, want) {
+			t.Errorf("OpenReader(%T image) = %v, want %v", a, got, want)
+		}
+	}
+
+	image := archive(t, testRecords(""))
+	if got := readAll(t, OpenReader(bytes.NewReader(image))); !cpio.AllEqual(got, testRecords("")) {
+		t.Errorf("OpenReader(cpio archive) = %v, want %v", got, testRecords(""))
+	}
+}
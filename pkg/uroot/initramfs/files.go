@@ -13,6 +13,7 @@ import (
 	"sort"
 
 	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/uio"
 )
 
 // Files are host files and records to add to the resulting initramfs.
@@ -194,6 +195,12 @@ func (af *Files) fillInParents() {
 
 // WriteTo writes all records and files in `af` to `w`.
 func (af *Files) WriteTo(w Writer) error {
+	return af.writeTo(w, nil)
+}
+
+// writeTo writes all records and files in `af` to `w`, normalizing them with
+// n if it is not nil.
+func (af *Files) writeTo(w Writer, n *normalizer) error {
 	// Add parent directories when not added specifically.
 	af.fillInParents()
 	cr := cpio.NewRecorder()
@@ -202,12 +209,15 @@ func (af *Files) WriteTo(w Writer) error {
 	// same order.
 	for _, path := range af.sortedKeys() {
 		if record, ok := af.Records[path]; ok {
+			if n != nil {
+				record = n.normalize(record)
+			}
 			if err := w.WriteRecord(record); err != nil {
 				return err
 			}
 		}
 		if src, ok := af.Files[path]; ok {
-			if err := writeFile(w, cr, src, path); err != nil {
+			if err := writeFile(w, cr, n, src, path); err != nil {
 				return err
 			}
 		}
@@ -219,7 +229,7 @@ func (af *Files) WriteTo(w Writer) error {
 // archive `w` at path `dest`.
 //
 // If `src` is a directory, its children will be added to the archive as well.
-func writeFile(w Writer, r *cpio.Recorder, src, dest string) error {
+func writeFile(w Writer, r *cpio.Recorder, n *normalizer, src, dest string) error {
 	record, err := r.GetRecord(src)
 	if err != nil {
 		return err
@@ -227,7 +237,31 @@ func writeFile(w Writer, r *cpio.Recorder, src, dest string) error {
 
 	// Fix the name.
 	record.Name = dest
-	return w.WriteRecord(cpio.MakeReproducible(record))
+	if n == nil {
+		return w.WriteRecord(cpio.MakeReproducible(record))
+	}
+
+	// The Recorder leaves out the contents of hard links to files it has
+	// already seen. The normalizer gives them their own inode, so they
+	// need their contents.
+	if record.ReaderAt == nil && record.Mode&cpio.S_IFMT == cpio.S_IFREG {
+		record.ReaderAt = uio.NewLazyFile(src)
+	}
+	return w.WriteRecord(n.normalize(record))
+}
+
+// normalizer normalizes records for Opts.Reproducible.
+type normalizer struct {
+	mtime uint64
+	ino   uint64
+}
+
+func (n *normalizer) normalize(r cpio.Record) cpio.Record {
+	r = cpio.MakeReproducible(r)
+	r.MTime = n.mtime
+	n.ino++
+	r.Ino = n.ino
+	return r
 }
 
 // children calls `fn` on all direct children of directory `dir`.
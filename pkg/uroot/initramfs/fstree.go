@@ -0,0 +1,209 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/cpio"
+)
+
+// fsNode is a file in a file system image built from records, which the
+// squashfs and erofs writers lay out once all records are written.
+type fsNode struct {
+	cpio.Info
+
+	// data holds the contents of regular files and the target of
+	// symlinks.
+	data io.ReaderAt
+
+	// name is the base name of the file.
+	name     string
+	parent   *fsNode
+	children []*fsNode
+	byName   map[string]*fsNode
+
+	// ino is the inode number the image gives the file.
+	ino uint32
+}
+
+// newFSTree returns the root of an empty tree.
+func newFSTree() *fsNode {
+	root := &fsNode{Info: cpio.Info{Mode: cpio.S_IFDIR | 0755}}
+	root.parent = root
+	return root
+}
+
+func (n *fsNode) isDir() bool {
+	return n.Mode&cpio.S_IFMT == cpio.S_IFDIR
+}
+
+// add adds the file of r to the tree below root, replacing an earlier file
+// of the same name, as unpacking a cpio archive would. Missing parent
+// directories are added with mode 0755 and the mtime of r.
+func (root *fsNode) add(r cpio.Record) error {
+	switch r.Mode & cpio.S_IFMT {
+	case cpio.S_IFREG, cpio.S_IFDIR, cpio.S_IFLNK, cpio.S_IFCHR, cpio.S_IFBLK, cpio.S_IFIFO, cpio.S_IFSOCK:
+	default:
+		return fmt.Errorf("%s: unsupported file mode %#o", r.Name, r.Mode)
+	}
+
+	name := cpio.Normalize(r.Name)
+	if name == "." {
+		if r.Mode&cpio.S_IFMT != cpio.S_IFDIR {
+			return fmt.Errorf("%s: root is not a directory", r.Name)
+		}
+		root.Info = r.Info
+		return nil
+	}
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("%s: path is outside of the archive", r.Name)
+	}
+
+	elems := strings.Split(name, "/")
+	dir := root
+	for _, e := range elems[:len(elems)-1] {
+		c, ok := dir.byName[e]
+		if !ok {
+			c = &fsNode{Info: cpio.Info{Mode: cpio.S_IFDIR | 0755, MTime: r.MTime}}
+			dir.link(e, c)
+		} else if !c.isDir() {
+			return fmt.Errorf("%s: parent %s is not a directory", r.Name, e)
+		}
+		dir = c
+	}
+
+	base := elems[len(elems)-1]
+	n := &fsNode{Info: r.Info, data: r.ReaderAt}
+	if old, ok := dir.byName[base]; ok {
+		if old.isDir() && n.isDir() {
+			// Keep the directory's children.
+			old.Info = r.Info
+			return nil
+		}
+		for i, c := range dir.children {
+			if c == old {
+				dir.children = append(dir.children[:i], dir.children[i+1:]...)
+				break
+			}
+		}
+	}
+	if n.Mode&cpio.S_IFMT == cpio.S_IFREG && n.data == nil {
+		// Hard links to files already seen may come without contents.
+		n.FileSize = 0
+	}
+	dir.link(base, n)
+	return nil
+}
+
+// link adds c to the children of the directory n.
+func (n *fsNode) link(name string, c *fsNode) {
+	if n.byName == nil {
+		n.byName = make(map[string]*fsNode)
+	}
+	c.name, c.parent = name, n
+	n.byName[name] = c
+	n.children = append(n.children, c)
+}
+
+// sort sorts the children of all directories by name, byte by byte, the
+// order both squashfs and erofs want directory entries in.
+func (n *fsNode) sort() {
+	sort.Slice(n.children, func(i, j int) bool {
+		return n.children[i].name < n.children[j].name
+	})
+	for _, c := range n.children {
+		c.sort()
+	}
+}
+
+// walk calls fn for n and every file below it, parents first.
+func (n *fsNode) walk(fn func(*fsNode) error) error {
+	if err := fn(n); err != nil {
+		return err
+	}
+	for _, c := range n.children {
+		if err := c.walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subdirs returns the number of directories in n.
+func (n *fsNode) subdirs() int {
+	var d int
+	for _, c := range n.children {
+		if c.isDir() {
+			d++
+		}
+	}
+	return d
+}
+
+// contents returns the contents of a regular file or the target of a
+// symlink.
+func (n *fsNode) contents() ([]byte, error) {
+	b := make([]byte, n.FileSize)
+	if len(b) == 0 {
+		return b, nil
+	}
+	if _, err := n.readAt(b, 0); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readAt reads len(b) bytes of the contents of n at off.
+func (n *fsNode) readAt(b []byte, off int64) (int, error) {
+	k, err := n.data.ReadAt(b, off)
+	if k == len(b) {
+		return k, nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return k, fmt.Errorf("reading %s: %v", n.name, err)
+}
+
+// close closes the contents of n, if they can be closed.
+func (n *fsNode) close() {
+	if c, ok := n.data.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// newEncodeDev encodes a device number like Linux's new_encode_dev, as both
+// squashfs and erofs store them.
+func newEncodeDev(major, minor uint64) uint32 {
+	return uint32(minor&0xff | major<<8 | (minor&^0xff)<<12)
+}
+
+// newDecodeDev decodes a device number encoded by newEncodeDev.
+func newDecodeDev(dev uint32) (major, minor uint64) {
+	return uint64(dev&0xfff00) >> 8, uint64(dev&0xff) | uint64(dev>>12)&0xfff00
+}
+
+// recordList implements Reader for records read from an image.
+type recordList struct {
+	recs []cpio.Record
+	err  error
+}
+
+// ReadRecord implements cpio.RecordReader.
+func (l *recordList) ReadRecord() (cpio.Record, error) {
+	if l.err != nil {
+		return cpio.Record{}, l.err
+	}
+	if len(l.recs) == 0 {
+		return cpio.Record{}, io.EOF
+	}
+	r := l.recs[0]
+	l.recs = l.recs[1:]
+	return r, nil
+}
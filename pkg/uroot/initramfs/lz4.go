@@ -0,0 +1,353 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The legacy lz4 frame format is a magic number followed by blocks, each
+// holding up to 8 MiB of data and preceded by its compressed size. It is
+// what `lz4 -l` writes and what Linux's unlz4 reads.
+const (
+	lz4LegacyMagic     = 0x184c2102
+	lz4LegacyBlockSize = 8 << 20
+
+	lz4MinMatch     = 4
+	lz4LastLiterals = 5
+	// lz4MatchLimit is how close to the end of a block a match may start.
+	lz4MatchLimit = 12
+	lz4MaxOffset  = 65535
+	lz4HashLog    = 16
+)
+
+// lz4CompressBound is the largest compressed size of n bytes.
+func lz4CompressBound(n int) int {
+	return n + n/255 + 16
+}
+
+type lz4Writer struct {
+	w       io.Writer
+	buf     []byte
+	out     []byte
+	table   []int32
+	started bool
+	err     error
+}
+
+func newLZ4Writer(w io.Writer) *lz4Writer {
+	return &lz4Writer{
+		w:     w,
+		buf:   make([]byte, 0, lz4LegacyBlockSize),
+		out:   make([]byte, 4, 4+lz4CompressBound(lz4LegacyBlockSize)),
+		table: make([]int32, 1<<lz4HashLog),
+	}
+}
+
+// Write implements io.Writer.
+func (z *lz4Writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 && z.err == nil {
+		n := copy(z.buf[len(z.buf):cap(z.buf)], p)
+		z.buf = z.buf[:len(z.buf)+n]
+		p = p[n:]
+		written += n
+		if len(z.buf) == cap(z.buf) {
+			z.flush()
+		}
+	}
+	return written, z.err
+}
+
+func (z *lz4Writer) write(p []byte) {
+	if z.err == nil {
+		_, z.err = z.w.Write(p)
+	}
+}
+
+// flush compresses the buffered data into one block.
+func (z *lz4Writer) flush() {
+	if !z.started {
+		var magic [4]byte
+		binary.LittleEndian.PutUint32(magic[:], lz4LegacyMagic)
+		z.write(magic[:])
+		z.started = true
+	}
+	if len(z.buf) == 0 {
+		return
+	}
+
+	z.out = lz4CompressBlock(z.out[:4], z.buf, z.table)
+	binary.LittleEndian.PutUint32(z.out, uint32(len(z.out)-4))
+	z.write(z.out)
+	z.buf = z.buf[:0]
+}
+
+// Close implements io.Closer. It writes the remaining data, but does not
+// close the underlying writer.
+func (z *lz4Writer) Close() error {
+	z.flush()
+	return z.err
+}
+
+// lz4Hash hashes the 4 bytes at the start of b.
+func lz4Hash(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b) * 2654435761 >> (32 - lz4HashLog)
+}
+
+// lz4CompressBlock appends the lz4 block compression of src to dst. table
+// is scratch space of 1<<lz4HashLog entries.
+//
+// Matches are found greedily with a single hash table entry per position,
+// like LZ4's fast mode.
+func lz4CompressBlock(dst, src []byte, table []int32) []byte {
+	dst, _ = lz4CompressDestSize(dst, src, -1, table)
+	return dst
+}
+
+// lz4CompressDestSize is like lz4CompressBlock, but only compresses as much
+// of the start of src as fits into a block of at most size bytes, if size is
+// not negative. It returns how much of src the block holds. size must be at
+// least 13, so that any block fits.
+func lz4CompressDestSize(dst, src []byte, size int, table []int32) ([]byte, int) {
+	for i := range table {
+		table[i] = -1
+	}
+	start := len(dst)
+	fits := func(n int) bool {
+		return size < 0 || len(dst)-start+n <= size
+	}
+
+	var anchor int
+	end := len(src) - lz4LastLiterals
+	for i := 0; i+lz4MatchLimit <= len(src); {
+		h := lz4Hash(src[i:])
+		cand := int(table[h])
+		table[h] = int32(i)
+		if cand < 0 || i-cand > lz4MaxOffset ||
+			binary.LittleEndian.Uint32(src[cand:]) != binary.LittleEndian.Uint32(src[i:]) {
+			i++
+			continue
+		}
+
+		m := i + lz4MinMatch
+		for c := cand + lz4MinMatch; m < end && src[m] == src[c]; c++ {
+			m++
+		}
+		for i > anchor && cand > 0 && src[i-1] == src[cand-1] {
+			i--
+			cand--
+		}
+
+		// A block cut short must still end in literals far enough
+		// behind its last match, so leave room for them.
+		if !fits(lz4SequenceLen(i-anchor, m-i) + lz4SequenceLen(lz4MatchLimit, 0)) {
+			break
+		}
+		dst = lz4AppendSequence(dst, src[anchor:i], i-cand, m-i)
+		anchor, i = m, m
+	}
+
+	lits := len(src) - anchor
+	for !fits(lz4SequenceLen(lits, 0)) {
+		lits--
+	}
+	return lz4AppendSequence(dst, src[anchor:anchor+lits], 0, 0), anchor + lits
+}
+
+// lz4SequenceLen is the encoded size of a sequence of lits literals followed
+// by a match of matchLen bytes, if matchLen is not 0.
+func lz4SequenceLen(lits, matchLen int) int {
+	n := 1 + lits
+	if lits >= 15 {
+		n += (lits-15)/255 + 1
+	}
+	if matchLen > 0 {
+		n += 2
+		if ml := matchLen - lz4MinMatch; ml >= 15 {
+			n += (ml-15)/255 + 1
+		}
+	}
+	return n
+}
+
+// lz4AppendLen appends the continuation bytes of a length whose token nibble
+// is 15.
+func lz4AppendLen(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4AppendSequence appends literals followed by a match. A zero length
+// match ends the block.
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	var token byte
+	if len(literals) >= 15 {
+		token = 15 << 4
+	} else {
+		token = byte(len(literals)) << 4
+	}
+	if matchLen > 0 {
+		if ml := matchLen - lz4MinMatch; ml >= 15 {
+			token |= 15
+		} else {
+			token |= byte(ml)
+		}
+	}
+
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = lz4AppendLen(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if ml := matchLen - lz4MinMatch; ml >= 15 {
+		dst = lz4AppendLen(dst, ml-15)
+	}
+	return dst
+}
+
+var errLZ4Corrupt = errors.New("lz4: corrupt block")
+
+// lz4DecompressBlock appends the decompression of the lz4 block src to dst,
+// which may grow to at most max bytes.
+func lz4DecompressBlock(dst, src []byte, max int) ([]byte, error) {
+	readLen := func(i, n int) (int, int, error) {
+		if n != 15 {
+			return i, n, nil
+		}
+		for {
+			if i >= len(src) {
+				return 0, 0, errLZ4Corrupt
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return i, n, nil
+			}
+		}
+	}
+
+	var err error
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		var lits int
+		if i, lits, err = readLen(i, int(token>>4)); err != nil {
+			return nil, err
+		}
+		if i+lits > len(src) || len(dst)+lits > max {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+lits]...)
+		i += lits
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		var ml int
+		if i, ml, err = readLen(i, int(token&15)); err != nil {
+			return nil, err
+		}
+		ml += lz4MinMatch
+		if offset == 0 || offset > len(dst) || len(dst)+ml > max {
+			return nil, errLZ4Corrupt
+		}
+		// Matches may overlap the bytes they produce.
+		start := len(dst) - offset
+		for j := 0; j < ml; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+	return dst, nil
+}
+
+type lz4Reader struct {
+	r       io.Reader
+	started bool
+	in      []byte
+	out     []byte
+	pos     int
+	err     error
+}
+
+func newLZ4Reader(r io.Reader) *lz4Reader {
+	return &lz4Reader{r: r}
+}
+
+// Read implements io.Reader.
+func (z *lz4Reader) Read(p []byte) (int, error) {
+	for z.pos == len(z.out) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.readBlock()
+	}
+	n := copy(p, z.out[z.pos:])
+	z.pos += n
+	return n, nil
+}
+
+// readBlock decompresses the next block into z.out.
+func (z *lz4Reader) readBlock() error {
+	var size [4]byte
+	if !z.started {
+		if _, err := io.ReadFull(z.r, size[:]); err != nil {
+			return fmt.Errorf("lz4: reading magic: %v", err)
+		}
+		if m := binary.LittleEndian.Uint32(size[:]); m != lz4LegacyMagic {
+			return fmt.Errorf("lz4: magic got %#x, want %#x", m, lz4LegacyMagic)
+		}
+		z.started = true
+	}
+
+	for {
+		if _, err := io.ReadFull(z.r, size[:]); err == io.EOF {
+			return io.EOF
+		} else if err != nil {
+			return fmt.Errorf("lz4: reading block size: %v", err)
+		}
+		n := binary.LittleEndian.Uint32(size[:])
+		switch {
+		case n == lz4LegacyMagic:
+			// Another stream was appended.
+			continue
+		case n == 0:
+			// Padding follows the stream.
+			return io.EOF
+		case n > uint32(lz4CompressBound(lz4LegacyBlockSize)):
+			return fmt.Errorf("lz4: block size %d too large", n)
+		}
+
+		if cap(z.in) < int(n) {
+			z.in = make([]byte, n)
+		}
+		z.in = z.in[:n]
+		if _, err := io.ReadFull(z.r, z.in); err != nil {
+			return fmt.Errorf("lz4: reading block: %v", err)
+		}
+		out, err := lz4DecompressBlock(z.out[:0], z.in, lz4LegacyBlockSize)
+		if err != nil {
+			return err
+		}
+		z.out, z.pos = out, 0
+		return nil
+	}
+}
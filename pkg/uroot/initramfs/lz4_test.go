@@ -0,0 +1,148 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLZ4RoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(0)).Read(random)
+
+	// Mostly repetitive, with some noise, and more than one block.
+	var mixed bytes.Buffer
+	for mixed.Len() < lz4LegacyBlockSize+100000 {
+		mixed.WriteString("initramfs ")
+		mixed.Write(random[:mixed.Len()%7])
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty"},
+		{name: "short", data: []byte("hello")},
+		{name: "match limit", data: []byte("aaaaaaaaaaaaa")},
+		{name: "long run", data: bytes.Repeat([]byte{0}, 70000)},
+		{name: "long literals", data: random},
+		{name: "text", data: []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 500))},
+		{name: "multiple blocks", data: mixed.Bytes()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := compress(t, LZ4, tt.data)
+			if len(tt.data) > 1000 && len(tt.data) != len(random) && len(c) > len(tt.data)/2 {
+				t.Errorf("compressed %d bytes to %d", len(tt.data), len(c))
+			}
+
+			r, err := LZ4.Reader(bytes.NewReader(c))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("round trip of %d bytes gave %d different bytes", len(tt.data), len(got))
+			}
+		})
+	}
+}
+
+func TestLZ4CompressDestSize(t *testing.T) {
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(0)).Read(random)
+	text := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 2000))
+
+	table := make([]int32, 1<<lz4HashLog)
+	for _, tt := range []struct {
+		name string
+		data []byte
+		size int
+		// min is the least input the block must hold.
+		min int
+	}{
+		{name: "text", data: text, size: 4096, min: 8192},
+		{name: "random", data: random, size: 4096, min: 4000},
+		{name: "smallest", data: random, size: 13, min: 1},
+		{name: "everything fits", data: []byte("hello"), size: 4096, min: 5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, n := lz4CompressDestSize(nil, tt.data, tt.size, table)
+			if len(c) > tt.size {
+				t.Errorf("compressed into %d bytes, want at most %d", len(c), tt.size)
+			}
+			if n < tt.min {
+				t.Errorf("compressed %d bytes, want at least %d", n, tt.min)
+			}
+			got, err := lz4DecompressBlock(nil, c, len(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data[:n]) {
+				t.Errorf("decompressed %d bytes, want the first %d bytes of the input", len(got), n)
+			}
+		})
+	}
+}
+
+// words.txt.lz4 was made with `lz4 -l -9 words.txt`.
+func TestLZ4ReadLegacy(t *testing.T) {
+	want, err := ioutil.ReadFile("testdata/words.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ioutil.ReadFile("testdata/words.txt.lz4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{name: "single", data: c, want: want},
+		{name: "concatenated", data: append(append([]byte{}, c...), c...), want: append(append([]byte{}, want...), want...)},
+		{name: "padded", data: append(append([]byte{}, c...), 0, 0, 0, 0), want: want},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := LZ4.Reader(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("decompressed %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestLZ4Corrupt(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "bad magic", data: []byte{1, 2, 3, 4}},
+		{name: "truncated block", data: []byte{0x02, 0x21, 0x4c, 0x18, 10, 0, 0, 0, 0x10}},
+		{name: "bad offset", data: []byte{0x02, 0x21, 0x4c, 0x18, 4, 0, 0, 0, 0x10, 'a', 5, 0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := LZ4.Reader(bytes.NewReader(tt.data))
+			if _, err := ioutil.ReadAll(r); err == nil {
+				t.Errorf("ReadAll() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// manifestLine returns the manifest line of r.
+func manifestLine(r cpio.Record) (string, error) {
+	sum := "-"
+	if r.ReaderAt != nil && r.FileSize > 0 {
+		h := sha256.New()
+		if _, err := io.Copy(h, uio.Reader(r)); err != nil {
+			return "", fmt.Errorf("hashing %q: %v", r.Name, err)
+		}
+		sum = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return fmt.Sprintf("%06o %s %s\n", r.Mode, sum, r.Name), nil
+}
+
+// WriteManifest writes a manifest of the records in rr to w.
+//
+// The manifest has a line for each record with its mode in octal, the
+// SHA-256 of its contents (or - if it has none), and its name. Manifests of
+// two reproducible archives of the same files are the same, so diffing them
+// shows what differs between two archives.
+func WriteManifest(w io.Writer, rr cpio.RecordReader) error {
+	return cpio.ForEachRecord(rr, func(r cpio.Record) error {
+		l, err := manifestLine(r)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, l)
+		return err
+	})
+}
+
+// manifestWriter writes a manifest of the records written to it to m.
+type manifestWriter struct {
+	Writer
+	m io.Writer
+}
+
+// WriteRecord implements cpio.RecordWriter.
+func (mw *manifestWriter) WriteRecord(r cpio.Record) error {
+	l, err := manifestLine(r)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mw.m, l); err != nil {
+		return err
+	}
+	return mw.Writer.WriteRecord(r)
+}
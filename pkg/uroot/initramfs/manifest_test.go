@@ -0,0 +1,130 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/cpio"
+)
+
+// reproducibleArchive writes a reproducible archive of a fresh directory
+// holding the same files every time.
+func reproducibleArchive(t *testing.T, mtime time.Time) (archive, manifest []byte) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "initramfs-reproducible")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range []string{"b", "a", "c/d"} {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("file "+f), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "a"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := NewFiles()
+	if err := files.AddFile(dir, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.AddRecord(cpio.StaticFile("etc/motd", "hello", 0444)); err != nil {
+		t.Fatal(err)
+	}
+
+	var b, m bytes.Buffer
+	opts := &Opts{
+		Files:           files,
+		OutputFile:      trailerWriter{cpio.Newc.Writer(&b)},
+		Reproducible:    true,
+		SourceDateEpoch: 1600000000,
+		Manifest:        &m,
+	}
+	if err := Write(opts); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes(), m.Bytes()
+}
+
+// trailerWriter is a Writer whose Finish writes the trailer.
+type trailerWriter struct {
+	cpio.RecordWriter
+}
+
+func (w trailerWriter) Finish() error {
+	return cpio.WriteTrailer(w)
+}
+
+func TestWriteReproducible(t *testing.T) {
+	a1, m1 := reproducibleArchive(t, time.Unix(1000, 0))
+	a2, m2 := reproducibleArchive(t, time.Unix(2000, 0))
+	if !bytes.Equal(a1, a2) {
+		t.Errorf("archives of the same files differ")
+	}
+	if !bytes.Equal(m1, m2) {
+		t.Errorf("manifests of the same files differ:\n%s\n%s", m1, m2)
+	}
+
+	recs, err := cpio.ReadAllRecords(cpio.Newc.Reader(bytes.NewReader(a1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i, r := range recs {
+		names = append(names, r.Name)
+		if r.Ino != uint64(i+1) || r.MTime != 1600000000 || r.UID != 0 || r.GID != 0 {
+			t.Errorf("record %v not normalized", r.Info)
+		}
+		if r.Name == "x/link" && r.FileSize != uint64(len("file a")) {
+			t.Errorf("hard link x/link has %d bytes, want the contents of x/a", r.FileSize)
+		}
+	}
+	want := []string{"etc", "etc/motd", "x", "x/a", "x/b", "x/c", "x/c/d", "x/link"}
+	if len(names) != len(want) {
+		t.Fatalf("archive has %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("archive has %v, want %v", names, want)
+			break
+		}
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	recs := []cpio.Record{
+		cpio.Directory("etc", 0755),
+		cpio.StaticFile("etc/motd", "hello", 0444),
+		cpio.Symlink("init", "bbin/init"),
+		cpio.StaticFile("empty", "", 0644),
+	}
+	var b bytes.Buffer
+	if err := WriteManifest(&b, cpio.ArchiveFromRecords(recs).Reader()); err != nil {
+		t.Fatal(err)
+	}
+	want := `040755 - etc
+100444 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824 etc/motd
+120777 7183a0912b15e985ad7e3dde566a42af8a26e2eb1484da443c4cc3ea97c7dcbe init
+100644 - empty
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteManifest() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,821 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+// SquashfsMagic is the magic number a squashfs image starts with.
+const SquashfsMagic uint32 = 0x73717368
+
+// The squashfs 4.0 format, as Linux reads it; see
+// Documentation/filesystems/squashfs.rst and fs/squashfs/squashfs_fs.h in
+// Linux.
+const (
+	squashfsBlockLog     = 17
+	squashfsBlockSize    = 1 << squashfsBlockLog
+	squashfsMetadataSize = 8192
+	squashfsSuperSize    = 96
+
+	// squashfsMetaUncompressed marks uncompressed metadata blocks in
+	// their header.
+	squashfsMetaUncompressed = 1 << 15
+	// squashfsDataUncompressed marks uncompressed data blocks in their
+	// size.
+	squashfsDataUncompressed = 1 << 24
+
+	squashfsInvalidFrag  = 0xffffffff
+	squashfsInvalidXattr = 0xffffffff
+	squashfsInvalidTable = 0xffffffffffffffff
+
+	// Superblock flags.
+	squashfsUncompressedInodes = 0x1
+	squashfsUncompressedData   = 0x2
+	squashfsUncompressedFrags  = 0x8
+	squashfsNoFragments        = 0x10
+	squashfsNoXattrs           = 0x200
+	squashfsCompressorOptions  = 0x400
+	squashfsUncompressedIDs    = 0x800
+
+	// Compression IDs.
+	squashfsZlib = 1
+	squashfsXZ   = 4
+	squashfsLZ4  = 5
+	squashfsZstd = 6
+)
+
+// Inode types. Extended inodes are the basic type plus 7.
+const (
+	squashfsDirType = 1 + iota
+	squashfsFileType
+	squashfsSymlinkType
+	squashfsBlockDevType
+	squashfsCharDevType
+	squashfsFifoType
+	squashfsSocketType
+	squashfsLDirType
+	squashfsLFileType
+)
+
+type squashfsSuperblock struct {
+	Magic               uint32
+	Inodes              uint32
+	MkfsTime            uint32
+	BlockSize           uint32
+	Fragments           uint32
+	Compression         uint16
+	BlockLog            uint16
+	Flags               uint16
+	NoIDs               uint16
+	Major               uint16
+	Minor               uint16
+	RootInode           uint64
+	BytesUsed           uint64
+	IDTableStart        uint64
+	XattrTableStart     uint64
+	InodeTableStart     uint64
+	DirectoryTableStart uint64
+	FragmentTableStart  uint64
+	LookupTableStart    uint64
+}
+
+// squashfsInodeHeader starts every inode. Mode only holds the permission
+// bits; the type determines the file type.
+type squashfsInodeHeader struct {
+	Type  uint16
+	Mode  uint16
+	UID   uint16
+	GID   uint16
+	MTime uint32
+	Ino   uint32
+}
+
+type squashfsDirInode struct {
+	StartBlock uint32
+	NLink      uint32
+	FileSize   uint16
+	Offset     uint16
+	Parent     uint32
+}
+
+type squashfsLDirInode struct {
+	NLink      uint32
+	FileSize   uint32
+	StartBlock uint32
+	Parent     uint32
+	ICount     uint16
+	Offset     uint16
+	Xattr      uint32
+}
+
+// squashfsFileInode is followed by the sizes of its data blocks.
+type squashfsFileInode struct {
+	StartBlock uint32
+	Fragment   uint32
+	Offset     uint32
+	FileSize   uint32
+}
+
+// squashfsLFileInode is followed by the sizes of its data blocks.
+type squashfsLFileInode struct {
+	StartBlock uint64
+	FileSize   uint64
+	Sparse     uint64
+	NLink      uint32
+	Fragment   uint32
+	Offset     uint32
+	Xattr      uint32
+}
+
+// squashfsSymlinkInode is followed by the target.
+type squashfsSymlinkInode struct {
+	NLink uint32
+	Size  uint32
+}
+
+type squashfsDevInode struct {
+	NLink uint32
+	Rdev  uint32
+}
+
+type squashfsIPCInode struct {
+	NLink uint32
+}
+
+// squashfsDirHeader starts a run of directory entries whose inodes are in
+// the same metadata block.
+type squashfsDirHeader struct {
+	Count      uint32
+	StartBlock uint32
+	Ino        uint32
+}
+
+// squashfsDirEntry is followed by the name.
+type squashfsDirEntry struct {
+	Offset   uint16
+	InoDelta int16
+	Type     uint16
+	NameSize uint16
+}
+
+type squashfsFragment struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
+// squashfsCodec compresses the blocks of a squashfs image.
+type squashfsCodec struct {
+	id uint16
+
+	// options, if set, are written after the superblock.
+	options []byte
+
+	// compress is nil for uncompressed images.
+	compress   func(src []byte) ([]byte, error)
+	decompress func(src []byte, max int) ([]byte, error)
+}
+
+func newSquashfsCodec(id uint16) (*squashfsCodec, error) {
+	c := &squashfsCodec{id: id}
+	switch id {
+	case squashfsZlib:
+		c.compress = func(src []byte) ([]byte, error) {
+			var b bytes.Buffer
+			w, err := zlib.NewWriterLevel(&b, zlib.BestCompression)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(src); err != nil {
+				return nil, err
+			}
+			err = w.Close()
+			return b.Bytes(), err
+		}
+		c.decompress = func(src []byte, max int) ([]byte, error) {
+			r, err := zlib.NewReader(bytes.NewReader(src))
+			if err != nil {
+				return nil, err
+			}
+			return readMax(r, max)
+		}
+
+	case squashfsXZ:
+		// Linux decompresses with a dictionary of the block size.
+		conf := xz.WriterConfig{
+			DictCap:  squashfsBlockSize,
+			CheckSum: xz.CRC32,
+		}
+		c.compress = func(src []byte) ([]byte, error) {
+			var b bytes.Buffer
+			w, err := conf.NewWriter(&b)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(src); err != nil {
+				return nil, err
+			}
+			err = w.Close()
+			return b.Bytes(), err
+		}
+		c.decompress = func(src []byte, max int) ([]byte, error) {
+			r, err := xz.NewReader(bytes.NewReader(src))
+			if err != nil {
+				return nil, err
+			}
+			return readMax(r, max)
+		}
+
+	case squashfsLZ4:
+		// Linux wants options saying the lz4 block format is the
+		// legacy one, which is the one lz4CompressBlock writes.
+		c.options = []byte{1, 0, 0, 0, 0, 0, 0, 0}
+		table := make([]int32, 1<<lz4HashLog)
+		c.compress = func(src []byte) ([]byte, error) {
+			return lz4CompressBlock(nil, src, table), nil
+		}
+		c.decompress = func(src []byte, max int) ([]byte, error) {
+			return lz4DecompressBlock(nil, src, max)
+		}
+
+	case squashfsZstd:
+		// Linux decompresses with a window of the block size.
+		enc, err := zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstd.SpeedBestCompression),
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(squashfsBlockSize))
+		if err != nil {
+			return nil, err
+		}
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		c.compress = func(src []byte) ([]byte, error) {
+			return enc.EncodeAll(src, nil), nil
+		}
+		c.decompress = func(src []byte, max int) ([]byte, error) {
+			b, err := dec.DecodeAll(src, nil)
+			if err == nil && len(b) > max {
+				err = fmt.Errorf("block decompresses to more than %d bytes", max)
+			}
+			return b, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported squashfs compression %d", id)
+	}
+	return c, nil
+}
+
+// squashfsCodecFor returns the codec compressing like the initramfs
+// Compressor c, or not at all if c is nil.
+func squashfsCodecFor(c Compressor) (*squashfsCodec, error) {
+	switch c.(type) {
+	case nil:
+		codec, err := newSquashfsCodec(squashfsZlib)
+		if err != nil {
+			return nil, err
+		}
+		codec.compress = nil
+		return codec, nil
+	case GzipCompressor:
+		// squashfs calls zlib gzip.
+		return newSquashfsCodec(squashfsZlib)
+	case XZCompressor:
+		return newSquashfsCodec(squashfsXZ)
+	case LZ4Compressor:
+		return newSquashfsCodec(squashfsLZ4)
+	case ZstdCompressor:
+		return newSquashfsCodec(squashfsZstd)
+	}
+	return nil, fmt.Errorf("squashfs images can't be compressed with %T", c)
+}
+
+// block returns src compressed, or src itself if compressing does not
+// make it smaller.
+func (c *squashfsCodec) block(src []byte) ([]byte, bool, error) {
+	if c.compress == nil {
+		return src, false, nil
+	}
+	b, err := c.compress(src)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(b) >= len(src) {
+		return src, false, nil
+	}
+	return b, true, nil
+}
+
+// readMax reads all of r, which must be at most max bytes.
+func readMax(r io.Reader, max int) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err == nil && len(b) > max {
+		err = fmt.Errorf("block decompresses to more than %d bytes", max)
+	}
+	return b, err
+}
+
+// SquashfsArchiver is an implementation of Archiver for squashfs images,
+// which Linux can mount read-only, e.g. as the root file system. Images are
+// written without mksquashfs.
+//
+// Files are stored in 128 KiB blocks without fragments, and hard links are
+// stored as copies.
+type SquashfsArchiver struct {
+	// Compressor, if set, compresses the blocks of images opened with
+	// OpenWriter. gzip is stored as zlib, which squashfs calls gzip.
+	Compressor Compressor
+}
+
+// OpenWriter implements Archiver.OpenWriter.
+//
+// If `path` is empty, a default path of /tmp/initramfs.GOOS_GOARCH.squashfs
+// is used.
+func (sa SquashfsArchiver) OpenWriter(l ulog.Logger, path, goos, goarch string) (Writer, error) {
+	if len(path) == 0 && len(goos) == 0 && len(goarch) == 0 {
+		return nil, fmt.Errorf("passed no path, GOOS, and GOARCH to SquashfsArchiver.OpenWriter")
+	}
+	if len(path) == 0 {
+		path = fmt.Sprintf("/tmp/initramfs.%s_%s.squashfs", goos, goarch)
+	}
+	codec, err := squashfsCodecFor(sa.Compressor)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l.Printf("Filename is %s", path)
+	return &squashfsWriter{f: f, codec: codec, root: newFSTree()}, nil
+}
+
+// squashfsWriter implements Writer. The image is laid out once all records
+// are known.
+type squashfsWriter struct {
+	f     *os.File
+	codec *squashfsCodec
+	root  *fsNode
+}
+
+// WriteRecord implements Writer.WriteRecord.
+func (w *squashfsWriter) WriteRecord(r cpio.Record) error {
+	return w.root.add(r)
+}
+
+// Finish implements Writer.Finish.
+func (w *squashfsWriter) Finish() error {
+	err := writeSquashfs(w.f, w.root, w.codec)
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// squashfsMeta is a table of metadata blocks being written.
+type squashfsMeta struct {
+	codec *squashfsCodec
+	buf   []byte
+	out   []byte
+	// starts are the offsets of the blocks in out.
+	starts []int
+}
+
+// pos returns where the next byte written to m goes: the offset of its block
+// in the table and its offset in the uncompressed block.
+func (m *squashfsMeta) pos() (uint32, uint16) {
+	return uint32(len(m.out)), uint16(len(m.buf))
+}
+
+// Write implements io.Writer.
+func (m *squashfsMeta) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		c := copy(m.buf[len(m.buf):squashfsMetadataSize], p)
+		m.buf = m.buf[:len(m.buf)+c]
+		p = p[c:]
+		if len(m.buf) == squashfsMetadataSize {
+			if err := m.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flush writes the buffered data as a block.
+func (m *squashfsMeta) flush() error {
+	if len(m.buf) == 0 {
+		return nil
+	}
+	b, compressed, err := m.codec.block(m.buf)
+	if err != nil {
+		return err
+	}
+	h := uint16(len(b))
+	if !compressed {
+		h |= squashfsMetaUncompressed
+	}
+	m.starts = append(m.starts, len(m.out))
+	m.out = append(m.out, byte(h), byte(h>>8))
+	m.out = append(m.out, b...)
+	m.buf = m.buf[:0]
+	return nil
+}
+
+// write writes the binary representations of vs.
+func (m *squashfsMeta) write(vs ...interface{}) error {
+	for _, v := range vs {
+		if err := binary.Write(m, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// squashfsImage lays out an image.
+type squashfsImage struct {
+	w     *bufio.Writer
+	pos   int64
+	codec *squashfsCodec
+
+	inodes, dirs *squashfsMeta
+	ids          []uint32
+	idIndex      map[uint32]uint16
+	mtime        uint32
+
+	// data are the data blocks of regular files.
+	data map[*fsNode]squashfsData
+}
+
+type squashfsData struct {
+	start  uint64
+	sparse uint64
+	sizes  []uint32
+}
+
+// squashfsEntry is a directory entry.
+type squashfsEntry struct {
+	name string
+	ref  uint64
+	ino  uint32
+	typ  uint16
+}
+
+// writeSquashfs writes the tree below root as a squashfs image to f.
+func writeSquashfs(f io.WriteSeeker, root *fsNode, codec *squashfsCodec) error {
+	im := &squashfsImage{
+		w:       bufio.NewWriter(f),
+		codec:   codec,
+		inodes:  &squashfsMeta{codec: codec, buf: make([]byte, 0, squashfsMetadataSize)},
+		dirs:    &squashfsMeta{codec: codec, buf: make([]byte, 0, squashfsMetadataSize)},
+		idIndex: make(map[uint32]uint16),
+		data:    make(map[*fsNode]squashfsData),
+	}
+	root.sort()
+
+	// Inodes are numbered in the order they are written: children
+	// before their directory, as a directory's inode needs to know
+	// where its children's inodes are.
+	var inodes uint32
+	var number func(n *fsNode)
+	number = func(n *fsNode) {
+		for _, c := range n.children {
+			number(c)
+		}
+		inodes++
+		n.ino = inodes
+	}
+	number(root)
+
+	sb := squashfsSuperblock{
+		Magic:              SquashfsMagic,
+		Inodes:             inodes,
+		BlockSize:          squashfsBlockSize,
+		Compression:        codec.id,
+		BlockLog:           squashfsBlockLog,
+		Flags:              squashfsNoFragments | squashfsNoXattrs,
+		Major:              4,
+		XattrTableStart:    squashfsInvalidTable,
+		FragmentTableStart: squashfsInvalidTable,
+		LookupTableStart:   squashfsInvalidTable,
+	}
+	if codec.compress == nil {
+		sb.Flags |= squashfsUncompressedInodes | squashfsUncompressedData | squashfsUncompressedFrags | squashfsUncompressedIDs
+	}
+	im.write(make([]byte, squashfsSuperSize))
+	if codec.options != nil {
+		// The options are read before the decompressor is set up,
+		// so they are never compressed.
+		sb.Flags |= squashfsCompressorOptions
+		h := uint16(len(codec.options)) | squashfsMetaUncompressed
+		im.write([]byte{byte(h), byte(h >> 8)})
+		im.write(codec.options)
+	}
+
+	if err := root.walk(im.writeData); err != nil {
+		return err
+	}
+
+	ref, _, err := im.writeInode(root, inodes+1)
+	if err != nil {
+		return err
+	}
+	sb.RootInode = ref
+	sb.MkfsTime = im.mtime
+
+	if err := im.inodes.flush(); err != nil {
+		return err
+	}
+	if err := im.dirs.flush(); err != nil {
+		return err
+	}
+	sb.InodeTableStart = uint64(im.pos)
+	im.write(im.inodes.out)
+	sb.DirectoryTableStart = uint64(im.pos)
+	im.write(im.dirs.out)
+
+	ids := &squashfsMeta{codec: codec, buf: make([]byte, 0, squashfsMetadataSize)}
+	if err := ids.write(im.ids); err != nil {
+		return err
+	}
+	if err := ids.flush(); err != nil {
+		return err
+	}
+	idStart := im.pos
+	im.write(ids.out)
+	sb.IDTableStart = uint64(im.pos)
+	sb.NoIDs = uint16(len(im.ids))
+	for _, s := range ids.starts {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(idStart)+uint64(s))
+		im.write(b[:])
+	}
+
+	sb.BytesUsed = uint64(im.pos)
+	// Block devices, like loop devices, hold whole 4 KiB blocks.
+	if pad := im.pos % 4096; pad != 0 {
+		im.write(make([]byte, 4096-pad))
+	}
+	if err := im.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(f, binary.LittleEndian, sb)
+}
+
+// write writes b after the data written so far. Errors are returned by the
+// final flush.
+func (im *squashfsImage) write(b []byte) {
+	n, _ := im.w.Write(b)
+	im.pos += int64(n)
+}
+
+// id returns the index of id in the ID table.
+func (im *squashfsImage) id(id uint64) (uint16, error) {
+	if i, ok := im.idIndex[uint32(id)]; ok {
+		return i, nil
+	}
+	if len(im.ids) == 1<<16 {
+		return 0, fmt.Errorf("more than %d uids and gids", 1<<16)
+	}
+	i := uint16(len(im.ids))
+	im.ids = append(im.ids, uint32(id))
+	im.idIndex[uint32(id)] = i
+	return i, nil
+}
+
+// writeData writes the data blocks of a regular file.
+func (im *squashfsImage) writeData(n *fsNode) error {
+	if n.Mode&cpio.S_IFMT != cpio.S_IFREG {
+		return nil
+	}
+	defer n.close()
+
+	d := squashfsData{start: uint64(im.pos)}
+	buf := make([]byte, squashfsBlockSize)
+	for off := int64(0); off < int64(n.FileSize); off += squashfsBlockSize {
+		b := buf
+		if rest := int64(n.FileSize) - off; rest < squashfsBlockSize {
+			b = buf[:rest]
+		}
+		if _, err := n.readAt(b, off); err != nil {
+			return err
+		}
+		if len(b) == squashfsBlockSize && isZero(b) {
+			// A sparse block, which takes no space.
+			d.sizes = append(d.sizes, 0)
+			d.sparse += squashfsBlockSize
+			continue
+		}
+		c, compressed, err := im.codec.block(b)
+		if err != nil {
+			return err
+		}
+		size := uint32(len(c))
+		if !compressed {
+			size |= squashfsDataUncompressed
+		}
+		d.sizes = append(d.sizes, size)
+		im.write(c)
+	}
+	im.data[n] = d
+	return nil
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeInode writes the inode of n, and for directories the inodes below
+// it and the directory's entries, and returns the reference to the inode
+// and its basic type. parent is the inode number of n's parent.
+func (im *squashfsImage) writeInode(n *fsNode, parent uint32) (uint64, uint16, error) {
+	var entries []squashfsEntry
+	for _, c := range n.children {
+		ref, typ, err := im.writeInode(c, n.ino)
+		if err != nil {
+			return 0, 0, err
+		}
+		entries = append(entries, squashfsEntry{name: c.name, ref: ref, ino: c.ino, typ: typ})
+	}
+
+	uid, err := im.id(n.UID)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := im.id(n.GID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if uint32(n.MTime) > im.mtime {
+		im.mtime = uint32(n.MTime)
+	}
+	h := squashfsInodeHeader{
+		Mode:  uint16(n.Mode & 07777),
+		UID:   uid,
+		GID:   gid,
+		MTime: uint32(n.MTime),
+		Ino:   n.ino,
+	}
+
+	var body []interface{}
+	switch n.Mode & cpio.S_IFMT {
+	case cpio.S_IFDIR:
+		h.Type = squashfsDirType
+		block, offset := im.dirs.pos()
+		size, err := im.writeEntries(entries)
+		if err != nil {
+			return 0, 0, err
+		}
+		nlink := uint32(2 + n.subdirs())
+		// The size counts the . and .. entries squashfs does not store.
+		if size+3 <= 0xffff {
+			body = []interface{}{squashfsDirInode{
+				StartBlock: block,
+				NLink:      nlink,
+				FileSize:   uint16(size + 3),
+				Offset:     offset,
+				Parent:     parent,
+			}}
+		} else {
+			h.Type = squashfsLDirType
+			body = []interface{}{squashfsLDirInode{
+				NLink:      nlink,
+				FileSize:   uint32(size + 3),
+				StartBlock: block,
+				Parent:     parent,
+				Offset:     offset,
+				Xattr:      squashfsInvalidXattr,
+			}}
+		}
+
+	case cpio.S_IFREG:
+		h.Type = squashfsFileType
+		d := im.data[n]
+		if d.start <= 0xffffffff && n.FileSize <= 0xffffffff {
+			body = []interface{}{squashfsFileInode{
+				StartBlock: uint32(d.start),
+				Fragment:   squashfsInvalidFrag,
+				FileSize:   uint32(n.FileSize),
+			}, d.sizes}
+		} else {
+			h.Type = squashfsLFileType
+			body = []interface{}{squashfsLFileInode{
+				StartBlock: d.start,
+				FileSize:   n.FileSize,
+				Sparse:     d.sparse,
+				NLink:      1,
+				Fragment:   squashfsInvalidFrag,
+				Xattr:      squashfsInvalidXattr,
+			}, d.sizes}
+		}
+
+	case cpio.S_IFLNK:
+		h.Type = squashfsSymlinkType
+		target, err := n.contents()
+		if err != nil {
+			return 0, 0, err
+		}
+		n.close()
+		body = []interface{}{squashfsSymlinkInode{NLink: 1, Size: uint32(len(target))}, target}
+
+	case cpio.S_IFBLK, cpio.S_IFCHR:
+		h.Type = squashfsCharDevType
+		if n.Mode&cpio.S_IFMT == cpio.S_IFBLK {
+			h.Type = squashfsBlockDevType
+		}
+		body = []interface{}{squashfsDevInode{NLink: 1, Rdev: newEncodeDev(n.Rmajor, n.Rminor)}}
+
+	case cpio.S_IFIFO, cpio.S_IFSOCK:
+		h.Type = squashfsFifoType
+		if n.Mode&cpio.S_IFMT == cpio.S_IFSOCK {
+			h.Type = squashfsSocketType
+		}
+		body = []interface{}{squashfsIPCInode{NLink: 1}}
+	}
+
+	block, offset := im.inodes.pos()
+	if err := im.inodes.write(append([]interface{}{h}, body...)...); err != nil {
+		return 0, 0, err
+	}
+	typ := h.Type
+	if typ >= squashfsLDirType {
+		typ -= squashfsLDirType - squashfsDirType
+	}
+	return uint64(block)<<16 | uint64(offset), typ, nil
+}
+
+// writeEntries writes the entries of a directory and returns their size.
+//
+// Entries are in runs of at most 256 under a header naming the metadata
+// block their inodes are in, and the inode number their inode numbers are
+// relative to.
+func (im *squashfsImage) writeEntries(entries []squashfsEntry) (int, error) {
+	var size int
+	for i := 0; i < len(entries); {
+		first := entries[i]
+		j := i + 1
+		for ; j < len(entries) && j-i < 256; j++ {
+			e := entries[j]
+			if e.ref>>16 != first.ref>>16 {
+				break
+			}
+			if d := int64(e.ino) - int64(first.ino); d < -32768 || d > 32767 {
+				break
+			}
+		}
+
+		h := squashfsDirHeader{
+			Count:      uint32(j - i - 1),
+			StartBlock: uint32(first.ref >> 16),
+			Ino:        first.ino,
+		}
+		if err := im.dirs.write(h); err != nil {
+			return 0, err
+		}
+		size += binary.Size(h)
+		for _, e := range entries[i:j] {
+			if len(e.name) > 256 {
+				return 0, fmt.Errorf("file name %q is longer than 256 bytes", e.name)
+			}
+			de := squashfsDirEntry{
+				Offset:   uint16(e.ref),
+				InoDelta: int16(int64(e.ino) - int64(first.ino)),
+				Type:     e.typ,
+				NameSize: uint16(len(e.name) - 1),
+			}
+			if err := im.dirs.write(de, []byte(e.name)); err != nil {
+				return 0, err
+			}
+			size += binary.Size(de) + len(e.name)
+		}
+		i = j
+	}
+	return size, nil
+}
@@ -0,0 +1,489 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/u-root/u-root/pkg/cpio"
+)
+
+// Reader implements Archiver.Reader.
+//
+// It reads squashfs 4.0 images, including those mksquashfs writes with
+// fragments, as long as they are compressed with gzip, xz without filters,
+// lz4 or zstd. Extended attributes are ignored.
+func (SquashfsArchiver) Reader(r io.ReaderAt) Reader {
+	s, err := newSquashfsReader(r)
+	if err != nil {
+		return &recordList{err: err}
+	}
+	recs, err := s.records()
+	return &recordList{recs: recs, err: err}
+}
+
+// isSquashfs returns whether r starts with the squashfs magic number.
+func isSquashfs(r io.ReaderAt) bool {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(magic[:]) == SquashfsMagic
+}
+
+// squashfsReader reads a squashfs image.
+type squashfsReader struct {
+	r     io.ReaderAt
+	sb    squashfsSuperblock
+	codec *squashfsCodec
+	ids   []uint32
+	frags []squashfsFragment
+}
+
+func newSquashfsReader(r io.ReaderAt) (*squashfsReader, error) {
+	s := &squashfsReader{r: r}
+	if err := binary.Read(io.NewSectionReader(r, 0, squashfsSuperSize), binary.LittleEndian, &s.sb); err != nil {
+		return nil, fmt.Errorf("reading squashfs superblock: %v", err)
+	}
+	if s.sb.Magic != SquashfsMagic {
+		return nil, fmt.Errorf("not a squashfs image: magic is %#x, want %#x", s.sb.Magic, SquashfsMagic)
+	}
+	if s.sb.Major != 4 || s.sb.Minor != 0 {
+		return nil, fmt.Errorf("unsupported squashfs version %d.%d, want 4.0", s.sb.Major, s.sb.Minor)
+	}
+	if s.sb.BlockLog > 20 || s.sb.BlockSize != 1<<s.sb.BlockLog {
+		return nil, fmt.Errorf("invalid squashfs block size %d", s.sb.BlockSize)
+	}
+	var err error
+	if s.codec, err = newSquashfsCodec(s.sb.Compression); err != nil {
+		return nil, err
+	}
+
+	index, err := s.tableIndex(s.sb.IDTableStart, int(s.sb.NoIDs)*4)
+	if err != nil {
+		return nil, err
+	}
+	s.ids = make([]uint32, s.sb.NoIDs)
+	if err := s.readTable(index, s.ids); err != nil {
+		return nil, fmt.Errorf("reading squashfs id table: %v", err)
+	}
+
+	if s.sb.Fragments > 0 && s.sb.FragmentTableStart != squashfsInvalidTable {
+		index, err := s.tableIndex(s.sb.FragmentTableStart, int(s.sb.Fragments)*binary.Size(squashfsFragment{}))
+		if err != nil {
+			return nil, err
+		}
+		s.frags = make([]squashfsFragment, s.sb.Fragments)
+		if err := s.readTable(index, s.frags); err != nil {
+			return nil, fmt.Errorf("reading squashfs fragment table: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// tableIndex reads the locations of the metadata blocks of a table of size
+// bytes from start.
+func (s *squashfsReader) tableIndex(start uint64, size int) ([]uint64, error) {
+	index := make([]uint64, (size+squashfsMetadataSize-1)/squashfsMetadataSize)
+	if err := binary.Read(io.NewSectionReader(s.r, int64(start), int64(len(index))*8), binary.LittleEndian, index); err != nil {
+		return nil, fmt.Errorf("reading squashfs table index at %d: %v", start, err)
+	}
+	return index, nil
+}
+
+// readTable reads the table with the given index into v.
+func (s *squashfsReader) readTable(index []uint64, v interface{}) error {
+	if len(index) == 0 {
+		return nil
+	}
+	return binary.Read(s.meta(int64(index[0]), 0), binary.LittleEndian, v)
+}
+
+// metaBlock reads the metadata block at pos, and returns it and the
+// position of the next block.
+func (s *squashfsReader) metaBlock(pos int64) ([]byte, int64, error) {
+	var h [2]byte
+	if _, err := s.r.ReadAt(h[:], pos); err != nil {
+		return nil, 0, fmt.Errorf("reading squashfs metadata block at %d: %v", pos, err)
+	}
+	hdr := binary.LittleEndian.Uint16(h[:])
+	size := int64(hdr &^ squashfsMetaUncompressed)
+	if size == 0 || size > squashfsMetadataSize {
+		return nil, 0, fmt.Errorf("invalid squashfs metadata block size %d at %d", size, pos)
+	}
+	b, err := s.block(pos+2, size, hdr&squashfsMetaUncompressed == 0, squashfsMetadataSize)
+	return b, pos + 2 + size, err
+}
+
+// block reads the size bytes of a block at pos, decompressing them into at
+// most max bytes if compressed is set.
+func (s *squashfsReader) block(pos, size int64, compressed bool, max int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := s.r.ReadAt(b, pos); err != nil {
+		return nil, fmt.Errorf("reading squashfs block at %d: %v", pos, err)
+	}
+	if !compressed {
+		return b, nil
+	}
+	d, err := s.codec.decompress(b, max)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing squashfs block at %d: %v", pos, err)
+	}
+	return d, nil
+}
+
+// squashfsMetaReader reads metadata across metadata blocks.
+type squashfsMetaReader struct {
+	s   *squashfsReader
+	buf []byte
+	// next is the position of the next block.
+	next int64
+	// skip is how much of the next block to skip.
+	skip int
+}
+
+// meta returns a reader of the metadata from offset off in the block at pos.
+func (s *squashfsReader) meta(pos int64, off int) *squashfsMetaReader {
+	return &squashfsMetaReader{s: s, next: pos, skip: off}
+}
+
+// Read implements io.Reader.
+func (m *squashfsMetaReader) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		b, next, err := m.s.metaBlock(m.next)
+		if err != nil {
+			return 0, err
+		}
+		if m.skip > len(b) {
+			return 0, fmt.Errorf("squashfs metadata offset %d beyond block of %d bytes", m.skip, len(b))
+		}
+		m.buf, m.next, m.skip = b[m.skip:], next, 0
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// squashfsInode is an inode read from an image.
+type squashfsInode struct {
+	cpio.Info
+
+	// Directories' entries.
+	dirStart  uint32
+	dirOffset uint16
+	dirSize   uint32
+
+	// Regular files' data.
+	start      uint64
+	blocks     []uint32
+	frag       uint32
+	fragOffset uint32
+
+	target []byte
+}
+
+// inode reads the inode at ref.
+func (s *squashfsReader) inode(ref uint64) (*squashfsInode, error) {
+	m := s.meta(int64(s.sb.InodeTableStart+ref>>16), int(ref&0xffff))
+	read := func(vs ...interface{}) error {
+		for _, v := range vs {
+			if err := binary.Read(m, binary.LittleEndian, v); err != nil {
+				return fmt.Errorf("reading squashfs inode %#x: %v", ref, err)
+			}
+		}
+		return nil
+	}
+
+	var h squashfsInodeHeader
+	if err := read(&h); err != nil {
+		return nil, err
+	}
+	if int(h.UID) >= len(s.ids) || int(h.GID) >= len(s.ids) {
+		return nil, fmt.Errorf("squashfs inode %d has invalid uid or gid index", h.Ino)
+	}
+	in := &squashfsInode{Info: cpio.Info{
+		Ino:   uint64(h.Ino),
+		Mode:  uint64(h.Mode & 07777),
+		UID:   uint64(s.ids[h.UID]),
+		GID:   uint64(s.ids[h.GID]),
+		MTime: uint64(h.MTime),
+	}}
+
+	// Extended inodes also have an xattr index, which is ignored.
+	var xattr uint32
+	extended := h.Type >= squashfsLDirType
+	switch h.Type {
+	case squashfsDirType:
+		var d squashfsDirInode
+		if err := read(&d); err != nil {
+			return nil, err
+		}
+		in.Mode |= cpio.S_IFDIR
+		in.NLink = uint64(d.NLink)
+		in.dirStart, in.dirOffset, in.dirSize = d.StartBlock, d.Offset, uint32(d.FileSize)
+
+	case squashfsLDirType:
+		var d squashfsLDirInode
+		if err := read(&d); err != nil {
+			return nil, err
+		}
+		in.Mode |= cpio.S_IFDIR
+		in.NLink = uint64(d.NLink)
+		in.dirStart, in.dirOffset, in.dirSize = d.StartBlock, d.Offset, d.FileSize
+
+	case squashfsFileType, squashfsLFileType:
+		in.Mode |= cpio.S_IFREG
+		in.NLink = 1
+		if h.Type == squashfsFileType {
+			var f squashfsFileInode
+			if err := read(&f); err != nil {
+				return nil, err
+			}
+			in.start, in.FileSize, in.frag, in.fragOffset = uint64(f.StartBlock), uint64(f.FileSize), f.Fragment, f.Offset
+		} else {
+			var f squashfsLFileInode
+			if err := read(&f); err != nil {
+				return nil, err
+			}
+			in.NLink = uint64(f.NLink)
+			in.start, in.FileSize, in.frag, in.fragOffset = f.StartBlock, f.FileSize, f.Fragment, f.Offset
+		}
+		n := in.FileSize >> s.sb.BlockLog
+		if in.frag == squashfsInvalidFrag && in.FileSize%uint64(s.sb.BlockSize) != 0 {
+			n++
+		}
+		in.blocks = make([]uint32, n)
+		if err := read(in.blocks); err != nil {
+			return nil, err
+		}
+
+	case squashfsSymlinkType, squashfsSymlinkType + 7:
+		var l squashfsSymlinkInode
+		if err := read(&l); err != nil {
+			return nil, err
+		}
+		in.Mode |= cpio.S_IFLNK
+		in.NLink = uint64(l.NLink)
+		in.target = make([]byte, l.Size)
+		if err := read(in.target); err != nil {
+			return nil, err
+		}
+		in.FileSize = uint64(l.Size)
+
+	case squashfsBlockDevType, squashfsCharDevType, squashfsBlockDevType + 7, squashfsCharDevType + 7:
+		var d squashfsDevInode
+		if err := read(&d); err != nil {
+			return nil, err
+		}
+		in.Mode |= cpio.S_IFCHR
+		if h.Type == squashfsBlockDevType || h.Type == squashfsBlockDevType+7 {
+			in.Mode = in.Mode&^cpio.S_IFMT | cpio.S_IFBLK
+		}
+		in.NLink = uint64(d.NLink)
+		in.Rmajor, in.Rminor = newDecodeDev(d.Rdev)
+
+	case squashfsFifoType, squashfsSocketType, squashfsFifoType + 7, squashfsSocketType + 7:
+		var d squashfsIPCInode
+		if err := read(&d); err != nil {
+			return nil, err
+		}
+		in.Mode |= cpio.S_IFIFO
+		if h.Type == squashfsSocketType || h.Type == squashfsSocketType+7 {
+			in.Mode = in.Mode&^cpio.S_IFMT | cpio.S_IFSOCK
+		}
+		in.NLink = uint64(d.NLink)
+
+	default:
+		return nil, fmt.Errorf("squashfs inode %d has unknown type %d", h.Ino, h.Type)
+	}
+	if extended && h.Type != squashfsLDirType && h.Type != squashfsLFileType {
+		if err := read(&xattr); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// entries reads the entries of the directory d, and returns their names and
+// inode references.
+func (s *squashfsReader) entries(d *squashfsInode) ([]string, []uint64, error) {
+	// The size counts . and .., which are not stored.
+	if d.dirSize < 3 {
+		return nil, nil, nil
+	}
+	size := int(d.dirSize) - 3
+	m := s.meta(int64(s.sb.DirectoryTableStart)+int64(d.dirStart), int(d.dirOffset))
+
+	var names []string
+	var refs []uint64
+	for read := 0; read < size; {
+		var h squashfsDirHeader
+		if err := binary.Read(m, binary.LittleEndian, &h); err != nil {
+			return nil, nil, fmt.Errorf("reading squashfs directory %d: %v", d.Ino, err)
+		}
+		read += binary.Size(h)
+		if h.Count >= 256 {
+			return nil, nil, fmt.Errorf("squashfs directory %d has a run of %d entries", d.Ino, h.Count+1)
+		}
+		for i := uint32(0); i <= h.Count; i++ {
+			var e squashfsDirEntry
+			if err := binary.Read(m, binary.LittleEndian, &e); err != nil {
+				return nil, nil, fmt.Errorf("reading squashfs directory %d: %v", d.Ino, err)
+			}
+			if e.NameSize >= 256 {
+				return nil, nil, fmt.Errorf("squashfs directory %d has a name of %d bytes", d.Ino, e.NameSize+1)
+			}
+			name := make([]byte, e.NameSize+1)
+			if _, err := io.ReadFull(m, name); err != nil {
+				return nil, nil, fmt.Errorf("reading squashfs directory %d: %v", d.Ino, err)
+			}
+			if bytes.IndexByte(name, '/') >= 0 || string(name) == "." || string(name) == ".." {
+				return nil, nil, fmt.Errorf("squashfs directory %d has invalid name %q", d.Ino, name)
+			}
+			read += binary.Size(e) + len(name)
+			names = append(names, string(name))
+			refs = append(refs, uint64(h.StartBlock)<<16|uint64(e.Offset))
+		}
+	}
+	return names, refs, nil
+}
+
+// records returns the records of all files in the image, parents first.
+func (s *squashfsReader) records() ([]cpio.Record, error) {
+	root, err := s.inode(s.sb.RootInode)
+	if err != nil {
+		return nil, err
+	}
+	if root.Mode&cpio.S_IFMT != cpio.S_IFDIR {
+		return nil, fmt.Errorf("squashfs root inode is not a directory")
+	}
+
+	var recs []cpio.Record
+	// The depth limit stops directory loops in corrupt images.
+	var walk func(dir *squashfsInode, name string, depth int) error
+	walk = func(dir *squashfsInode, name string, depth int) error {
+		if depth > 256 {
+			return fmt.Errorf("squashfs directories nested deeper than 256 at %s", name)
+		}
+		names, refs, err := s.entries(dir)
+		if err != nil {
+			return err
+		}
+		for i, n := range names {
+			in, err := s.inode(refs[i])
+			if err != nil {
+				return err
+			}
+			in.Name = path.Join(name, n)
+			recs = append(recs, s.record(in))
+			if in.Mode&cpio.S_IFMT == cpio.S_IFDIR {
+				if err := walk(in, in.Name, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root, "", 0); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// record returns the record of in.
+func (s *squashfsReader) record(in *squashfsInode) cpio.Record {
+	switch in.Mode & cpio.S_IFMT {
+	case cpio.S_IFLNK:
+		return cpio.Record{ReaderAt: bytes.NewReader(in.target), Info: in.Info}
+	case cpio.S_IFREG:
+		f := &squashfsFile{s: s, in: in, cur: -1}
+		pos := int64(in.start)
+		for _, b := range in.blocks {
+			f.offsets = append(f.offsets, pos)
+			pos += int64(b &^ squashfsDataUncompressed)
+		}
+		return cpio.Record{ReaderAt: f, Info: in.Info}
+	}
+	return cpio.Record{Info: in.Info}
+}
+
+// squashfsFile reads the contents of a regular file.
+type squashfsFile struct {
+	s       *squashfsReader
+	in      *squashfsInode
+	offsets []int64
+
+	// cur is the index of the block in buf.
+	cur int64
+	buf []byte
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *squashfsFile) ReadAt(p []byte, off int64) (int, error) {
+	size := int64(f.in.FileSize)
+	var n int
+	for n < len(p) && off < size {
+		i := off >> f.s.sb.BlockLog
+		if err := f.load(i); err != nil {
+			return n, err
+		}
+		c := copy(p[n:], f.buf[off-i<<f.s.sb.BlockLog:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// load reads block i of the file into buf.
+func (f *squashfsFile) load(i int64) error {
+	if i == f.cur {
+		return nil
+	}
+	bs := int64(f.s.sb.BlockSize)
+	want := int64(f.in.FileSize) - i*bs
+	if want > bs {
+		want = bs
+	}
+
+	var b []byte
+	var err error
+	if i < int64(len(f.in.blocks)) {
+		size := f.in.blocks[i]
+		if size == 0 {
+			b = make([]byte, want)
+		} else {
+			b, err = f.s.block(f.offsets[i], int64(size&^squashfsDataUncompressed), size&squashfsDataUncompressed == 0, int(bs))
+		}
+	} else {
+		// The end of the file is in a fragment block.
+		if int(f.in.frag) >= len(f.s.frags) {
+			return fmt.Errorf("squashfs inode %d has invalid fragment %d", f.in.Ino, f.in.frag)
+		}
+		frag := f.s.frags[f.in.frag]
+		size := frag.Size
+		b, err = f.s.block(int64(frag.Start), int64(size&^squashfsDataUncompressed), size&squashfsDataUncompressed == 0, int(bs))
+		if err == nil {
+			if int64(f.in.fragOffset)+want > int64(len(b)) {
+				return fmt.Errorf("squashfs inode %d ends beyond its fragment", f.in.Ino)
+			}
+			b = b[f.in.fragOffset:]
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) < want {
+		return fmt.Errorf("squashfs inode %d has a short block %d", f.in.Ino, i)
+	}
+	f.cur, f.buf = i, b[:want]
+	return nil
+}
@@ -0,0 +1,293 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initramfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/ulog/ulogtest"
+)
+
+// imageRecords are the records of a file system image covering the corners
+// of the squashfs and erofs formats: all file types, files of several
+// blocks, sparse files, long names and directories of several blocks.
+func imageRecords() []cpio.Record {
+	random := make([]byte, 300000)
+	rand.New(rand.NewSource(0)).Read(random)
+
+	file := func(name, content string, mode uint64, uid, gid uint64) cpio.Record {
+		r := cpio.StaticFile(name, content, mode)
+		r.UID, r.GID, r.MTime = uid, gid, 1600000000
+		return r
+	}
+	recs := []cpio.Record{
+		cpio.Directory("etc", 0700),
+		file("etc/hostname", "u-root\n", 0644, 1000, 100),
+		file("bin/text", strings.Repeat("the quick brown fox jumps over the lazy dog\n", 10000), 0755, 0, 0),
+		file("bin/random", string(random), 04755, 0, 0),
+		file("bin/mixed", string(random[:5000])+strings.Repeat("u-root ", 50000)+string(random[:9000]), 0755, 0, 0),
+		file("zeros", string(make([]byte, 3*squashfsBlockSize+100)), 0600, 0, 0),
+		file("empty", "", 0644, 65534, 65534),
+		cpio.Symlink("bin/sh", "text"),
+		cpio.Symlink("bin/long", strings.Repeat("x/", 2000)),
+		cpio.CharDev("dev/null", 0666, 1, 3),
+		cpio.CharDev("dev/big", 0600, 300, 70000),
+		{Info: cpio.Info{Name: "dev/sda", Mode: cpio.S_IFBLK | 0660, Rmajor: 8}},
+		{Info: cpio.Info{Name: "run/fifo", Mode: cpio.S_IFIFO | 0600}},
+		{Info: cpio.Info{Name: "run/socket", Mode: cpio.S_IFSOCK | 0600}},
+		file("a/b/c/"+strings.Repeat("n", 255), "deep", 0644, 0, 0),
+		cpio.Directory("emptydir", 0755),
+	}
+	for i := 0; i < 700; i++ {
+		recs = append(recs, file(fmt.Sprintf("many/file-%04d", i), fmt.Sprint(i), 0644, uint64(i%3), 0))
+	}
+	// Replaced by the later record.
+	recs = append(recs, file("etc/hostname", "replaced\n", 0600, 0, 0))
+	return recs
+}
+
+// wantImageRecords are the records imageRecords read back as: in order,
+// with implicit parent directories taking the mtime of the record that
+// created them, and with later records replacing earlier ones.
+func wantImageRecords(recs []cpio.Record) map[string]cpio.Record {
+	want := make(map[string]cpio.Record)
+	for _, r := range recs {
+		for dir := filepath.Dir(r.Name); dir != "."; dir = filepath.Dir(dir) {
+			if _, ok := want[dir]; !ok {
+				d := cpio.Directory(dir, 0755)
+				d.MTime = r.MTime
+				want[dir] = d
+			}
+		}
+		want[r.Name] = r
+	}
+	return want
+}
+
+// checkImageRoundTrip writes recs to an image with a, reads it back, and
+// returns the image.
+func checkImageRoundTrip(t *testing.T, a Archiver, recs []cpio.Record) []byte {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "initramfs-image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image")
+	w, err := a.OpenWriter(ulogtest.Logger{TB: t}, path, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cpio.WriteRecords(w, recs); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Finish(); err != nil {
+		t.Fatalf("Finish() = %v", err)
+	}
+	image, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := readAll(t, a.Reader(bytes.NewReader(image)))
+	want := wantImageRecords(recs)
+	if len(got) != len(want) {
+		t.Errorf("read %d records, want %d", len(got), len(want))
+	}
+	seen := make(map[string]bool)
+	for _, g := range got {
+		w, ok := want[g.Name]
+		if !ok {
+			t.Errorf("read unexpected record %s", g.Name)
+			continue
+		}
+		if seen[g.Name] {
+			t.Errorf("read %s twice", g.Name)
+		}
+		seen[g.Name] = true
+		if dir := filepath.Dir(g.Name); dir != "." && !seen[dir] {
+			t.Errorf("read %s before its directory", g.Name)
+		}
+
+		if g.Mode != w.Mode || g.UID != w.UID || g.GID != w.GID || g.MTime != w.MTime ||
+			g.Rmajor != w.Rmajor || g.Rminor != w.Rminor {
+			t.Errorf("read %v, want %v", g.Info, w.Info)
+		}
+		if w.Mode&cpio.S_IFMT != cpio.S_IFREG && w.Mode&cpio.S_IFMT != cpio.S_IFLNK {
+			continue
+		}
+		if g.FileSize != w.FileSize {
+			t.Errorf("%s has size %d, want %d", g.Name, g.FileSize, w.FileSize)
+			continue
+		}
+		gc, err := contents(g)
+		if err != nil {
+			t.Errorf("reading %s: %v", g.Name, err)
+			continue
+		}
+		wc, _ := contents(w)
+		if !bytes.Equal(gc, wc) {
+			t.Errorf("%s has different contents", g.Name)
+		}
+	}
+	return image
+}
+
+// runImageTool writes image to a file named image in a new directory and runs
+// tool with args there. The test is skipped if tool is not installed or can
+// not read image's compression.
+func runImageTool(t *testing.T, image []byte, tool string, args ...string) (dir string, out []byte) {
+	t.Helper()
+	if _, err := exec.LookPath(tool); err != nil {
+		t.Skipf("%s is not installed", tool)
+	}
+	dir, err := ioutil.TempDir("", "initramfs-image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "image"), image, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(tool, args...)
+	cmd.Dir = dir
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		if bytes.Contains(out, []byte("unsupported")) {
+			t.Skipf("%s can not read the image: %s", tool, out)
+		}
+		t.Fatalf("%s %v: %v\n%s", tool, args, err, out)
+	}
+	return dir, out
+}
+
+// checkUnsquashfs checks that unsquashfs lists the files recs leave in image
+// and extracts their regular files' contents.
+func checkUnsquashfs(t *testing.T, image []byte, recs []cpio.Record) {
+	want := wantImageRecords(recs)
+	var names, files []string
+	for name, r := range want {
+		names = append(names, name)
+		if r.Mode&cpio.S_IFMT == cpio.S_IFREG {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(names)
+
+	dir, out := runImageTool(t, image, "unsquashfs", "-l", "image")
+	defer os.RemoveAll(dir)
+	var got []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if name := strings.TrimPrefix(line, "squashfs-root/"); name != line {
+			got = append(got, name)
+		}
+	}
+	sort.Strings(got)
+	if strings.Join(got, "\n") != strings.Join(names, "\n") {
+		t.Errorf("unsquashfs -l listed %v, want %v", got, names)
+	}
+
+	dir, _ = runImageTool(t, image, "unsquashfs", append([]string{"-d", "root", "image"}, files...)...)
+	defer os.RemoveAll(dir)
+	for _, name := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "root", name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if wc, _ := contents(want[name]); !bytes.Equal(b, wc) {
+			t.Errorf("unsquashfs extracted %s with different contents", name)
+		}
+	}
+}
+
+// contents returns the contents of r.
+func contents(r cpio.Record) ([]byte, error) {
+	return ioutil.ReadAll(io.NewSectionReader(r.ReaderAt, 0, int64(r.FileSize)))
+}
+
+func TestSquashfsRoundTrip(t *testing.T) {
+	var uncompressed int
+	for _, name := range []string{"", "gzip", "xz", "zstd", "lz4"} {
+		t.Run("compress="+name, func(t *testing.T) {
+			var c Compressor
+			if name != "" {
+				c = Compressors[name]
+			}
+			image := checkImageRoundTrip(t, SquashfsArchiver{Compressor: c}, imageRecords())
+			if len(image)%4096 != 0 {
+				t.Errorf("image is %d bytes, want a multiple of 4096", len(image))
+			}
+			if name == "" {
+				uncompressed = len(image)
+			} else if len(image) >= uncompressed {
+				t.Errorf("compressed image is %d bytes, uncompressed %d", len(image), uncompressed)
+			}
+
+			// Writing the same records must give the same image.
+			if again := checkImageRoundTrip(t, SquashfsArchiver{Compressor: c}, imageRecords()); !bytes.Equal(image, again) {
+				t.Errorf("writing the same records twice gave different images")
+			}
+
+			t.Run("unsquashfs", func(t *testing.T) {
+				checkUnsquashfs(t, image, imageRecords())
+			})
+		})
+	}
+}
+
+func TestSquashfsErrors(t *testing.T) {
+	if _, err := (SquashfsArchiver{Compressor: bogusCompressor{}}).OpenWriter(ulogtest.Logger{TB: t}, "", "linux", "amd64"); err == nil {
+		t.Errorf("OpenWriter with an unsupported compressor succeeded")
+	}
+
+	for _, tt := range []struct {
+		name string
+		recs []cpio.Record
+	}{
+		{"long name", []cpio.Record{cpio.StaticFile(strings.Repeat("n", 257), "", 0644)}},
+		{"parent is a file", []cpio.Record{cpio.StaticFile("a", "", 0644), cpio.StaticFile("a/b", "", 0644)}},
+		{"outside", []cpio.Record{cpio.StaticFile("../a", "", 0644)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "initramfs-image")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			w, err := Squashfs.OpenWriter(ulogtest.Logger{TB: t}, filepath.Join(dir, "image"), "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = cpio.WriteRecords(w, tt.recs)
+			if err == nil {
+				err = w.Finish()
+			}
+			if err == nil {
+				t.Errorf("writing %v succeeded", tt.recs)
+			}
+		})
+	}
+
+	if _, err := cpio.ReadAllRecords(Squashfs.Reader(bytes.NewReader(archive(t, testRecords(""))))); err == nil {
+		t.Errorf("reading a cpio archive as squashfs succeeded")
+	}
+}
+
+// bogusCompressor is a Compressor images can't be compressed with.
+type bogusCompressor struct {
+	Compressor
+}
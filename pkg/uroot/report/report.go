@@ -0,0 +1,312 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package report attributes the size of an initramfs to the commands and
+// files in it.
+//
+// The size of a bb binary is attributed using the linker symbol table of an
+// unstripped build of it: each symbol belongs to a Go package, and each
+// package's size is charged to the one command using it, or listed as
+// shared if several commands use it.
+package report
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/u-root/u-root/pkg/golang"
+)
+
+// Report is a size report of an initramfs.
+type Report struct {
+	// BBSize is the size of the bb binary in the archive.
+	BBSize int64 `json:"bb_size"`
+
+	// SymbolSize is the size of all symbols in the unstripped bb binary.
+	SymbolSize int64 `json:"symbol_size"`
+
+	// Commands are the commands in the bb binary, largest first.
+	Commands []Command `json:"commands"`
+
+	// Shared are the packages used by several commands, or by the bb
+	// binary's main package, largest first.
+	Shared []Package `json:"shared"`
+
+	// Unattributed is the size of symbols of no package, such as
+	// linker-generated tables.
+	Unattributed int64 `json:"unattributed"`
+
+	// ExtraFiles are the extra files in the archive.
+	ExtraFiles []File `json:"extra_files,omitempty"`
+}
+
+// Command is the part of the bb binary only one command needs.
+type Command struct {
+	Name       string `json:"name"`
+	ImportPath string `json:"import_path"`
+
+	// Size is the size of the command's packages.
+	Size int64 `json:"size"`
+
+	// Packages are the command's own package and the packages only it
+	// uses, largest first.
+	Packages []Package `json:"packages"`
+}
+
+// Package is the size of one Go package in the bb binary.
+type Package struct {
+	ImportPath string `json:"import_path"`
+	Size       int64  `json:"size"`
+
+	// Commands are the commands using a shared package. It is empty for
+	// packages the bb binary's main package uses.
+	Commands []string `json:"commands,omitempty"`
+}
+
+// File is an extra file in the archive.
+type File struct {
+	// Path is the file's path in the archive.
+	Path string `json:"path"`
+	// Source is the file's path on the host.
+	Source string `json:"source"`
+	Size   int64  `json:"size"`
+
+	// Libs are the libraries ldd pulled in for the file.
+	Libs []File `json:"libs,omitempty"`
+}
+
+// Read reads a report written by WriteJSON.
+func Read(r io.Reader) (*Report, error) {
+	var rep Report
+	if err := json.NewDecoder(r).Decode(&rep); err != nil {
+		return nil, fmt.Errorf("reading report: %v", err)
+	}
+	return &rep, nil
+}
+
+// WriteJSON writes r to w as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// symbolPackage returns the import path of the package the symbol name
+// belongs to, or "" if it belongs to none.
+func symbolPackage(name string) string {
+	// Type descriptors and itabs belong to the package of their type.
+	for _, prefix := range []string{"type:", "type.", "go:itab.", "go.itab."} {
+		if strings.HasPrefix(name, prefix) {
+			name = strings.TrimLeft(name[len(prefix):], "*")
+			break
+		}
+	}
+	// Type parameters and method receivers may contain other import
+	// paths.
+	end := len(name)
+	if i := strings.IndexAny(name, "[("); i >= 0 {
+		end = i
+	}
+	slash := strings.LastIndex(name[:end], "/")
+	dot := strings.Index(name[slash+1:end], ".")
+	if dot <= 0 {
+		return ""
+	}
+	pkg := name[:slash+1+dot]
+	if strings.ContainsAny(pkg, ":·") {
+		// Linker-generated symbols, such as go:string.* and gclocals·.
+		return ""
+	}
+	// The linker escapes dots in the last path element, e.g. of .bb
+	// packages, as %2e.
+	if p, err := url.PathUnescape(pkg); err == nil {
+		pkg = p
+	}
+	return pkg
+}
+
+// PackageSizes returns the total size of the symbols of each package in the
+// ELF binary at path. Symbols of no package are counted under "".
+//
+// Only symbols that take up space in the file count, so .bss is left out.
+func PackageSizes(path string) (map[string]int64, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	syms, err := f.Symbols()
+	if err == elf.ErrNoSymbols {
+		return nil, fmt.Errorf("%s has no symbol table; it must not be stripped", path)
+	} else if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64)
+	for _, s := range syms {
+		if s.Section <= elf.SHN_UNDEF || int(s.Section) >= len(f.Sections) {
+			continue
+		}
+		if sec := f.Sections[s.Section]; sec.Type != elf.SHT_PROGBITS || sec.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		sizes[symbolPackage(s.Name)] += int64(s.Size)
+	}
+	return sizes, nil
+}
+
+// bbMain is the main package of bb binaries. See pkg/bb.
+const bbMain = "github.com/u-root/u-root/pkg/bb/bbmain/cmd"
+
+// bbPackage is the import path of the rewritten package of the command at
+// importPath. See pkg/bb.
+func bbPackage(importPath string) string {
+	return path.Join(importPath, ".bb")
+}
+
+// attribute fills in r's commands and shared packages from the package
+// sizes, where deps maps each command's import path to all the packages it
+// uses, and mainDeps are the packages bbMain uses.
+func (r *Report) attribute(sizes map[string]int64, deps map[string][]string, mainDeps []string) {
+	main := make(map[string]bool)
+	for _, p := range mainDeps {
+		main[p] = true
+	}
+	users := make(map[string][]string)
+	for cmd, pkgs := range deps {
+		for _, p := range append([]string{bbPackage(cmd)}, pkgs...) {
+			users[p] = append(users[p], cmd)
+		}
+	}
+
+	cmds := make(map[string]*Command)
+	for cmd := range deps {
+		cmds[cmd] = &Command{Name: golang.CommandName(cmd), ImportPath: cmd}
+	}
+	for pkg, size := range sizes {
+		r.SymbolSize += size
+		u := users[pkg]
+		switch {
+		case pkg == "":
+			r.Unattributed += size
+		case main[pkg]:
+			r.Shared = append(r.Shared, Package{ImportPath: pkg, Size: size})
+		case len(u) == 1:
+			c := cmds[u[0]]
+			c.Size += size
+			c.Packages = append(c.Packages, Package{ImportPath: pkg, Size: size})
+		default:
+			var names []string
+			for _, cmd := range u {
+				names = append(names, golang.CommandName(cmd))
+			}
+			sort.Strings(names)
+			r.Shared = append(r.Shared, Package{ImportPath: pkg, Size: size, Commands: names})
+		}
+	}
+
+	for _, c := range cmds {
+		sortPackages(c.Packages)
+		r.Commands = append(r.Commands, *c)
+	}
+	sort.Slice(r.Commands, func(i, j int) bool {
+		if r.Commands[i].Size != r.Commands[j].Size {
+			return r.Commands[i].Size > r.Commands[j].Size
+		}
+		return r.Commands[i].Name < r.Commands[j].Name
+	})
+	sortPackages(r.Shared)
+}
+
+func sortPackages(p []Package) {
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].Size != p[j].Size {
+			return p[i].Size > p[j].Size
+		}
+		return p[i].ImportPath < p[j].ImportPath
+	})
+}
+
+// AddBusybox adds the sizes of the commands in a bb binary built from pkgs
+// to r.
+//
+// binaryPath must be an unstripped build of the bb binary. pkgs are resolved
+// as bb.BuildBusybox resolves them, in place if they are all in GOPATH or
+// the main module and in a workspace otherwise, so that each command's
+// dependencies are the ones linked into the binary.
+func (r *Report) AddBusybox(env golang.Environ, pkgs []string, binaryPath string) error {
+	sizes, err := PackageSizes(binaryPath)
+	if err != nil {
+		return err
+	}
+
+	specs := append([]string{bbMain}, pkgs...)
+	inTree, err := env.InTree(specs)
+	if err != nil {
+		return err
+	}
+	importPaths := specs
+	lookup := func(mode packages.LoadMode, patterns ...string) ([]*packages.Package, error) {
+		return env.Lookup(mode, "", patterns...)
+	}
+	if !inTree {
+		dir, err := ioutil.TempDir("", "u-root-report")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		var ws *golang.Workspace
+		ws, importPaths, err = env.NewWorkspace(dir, specs)
+		if err != nil {
+			return err
+		}
+		lookup = ws.Lookup
+	}
+	loaded, err := lookup(packages.NeedName|packages.NeedImports|packages.NeedDeps, importPaths...)
+	if err != nil {
+		return err
+	}
+
+	deps := make(map[string][]string)
+	for _, p := range loaded {
+		var d []string
+		packages.Visit([]*packages.Package{p}, nil, func(dp *packages.Package) {
+			d = append(d, dp.PkgPath)
+		})
+		deps[p.PkgPath] = d
+	}
+	mainDeps := deps[bbMain]
+	delete(deps, bbMain)
+	r.attribute(sizes, deps, mainDeps)
+	return nil
+}
+
+// FileSize returns the size of the file or directory tree at path.
+func FileSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
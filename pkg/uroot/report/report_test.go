@@ -0,0 +1,210 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/bb"
+	"github.com/u-root/u-root/pkg/golang"
+)
+
+func TestSymbolPackage(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"main.main", "main"},
+		{"runtime.mallocgc", "runtime"},
+		{"fmt.(*pp).doPrintf", "fmt"},
+		{"github.com/u-root/u-root/pkg/ls.LongStringer.FileString", "github.com/u-root/u-root/pkg/ls"},
+		{"github.com/u-root/u-root/cmds/core/ls/%2ebb.Main", "github.com/u-root/u-root/cmds/core/ls/.bb"},
+		{"gopkg.in/yaml%2ev2.Marshal", "gopkg.in/yaml.v2"},
+		{"type:*os.File", "os"},
+		{"type.*os.File", "os"},
+		{"go:itab.*os.File,io.Reader", "os"},
+		{"slices.Sort[[]string,string]", "slices"},
+		{"sync/atomic.(*Pointer[go.shape.struct { net/netip.isV6 bool }]).Load", "sync/atomic"},
+		{"go:string.*", ""},
+		{"gclocals·g2BeySu+wFnoycgXfElmcg==", ""},
+		{"runtime.text", "runtime"},
+		{"_rt0_amd64_linux", ""},
+	} {
+		if got := symbolPackage(tt.name); got != tt.want {
+			t.Errorf("symbolPackage(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	var r Report
+	r.attribute(map[string]int64{
+		"":                         10,
+		"runtime":                  1000,
+		"example.com/cmds/a/.bb":   5,
+		"example.com/cmds/b/.bb":   7,
+		"example.com/pkg/onlya":    50,
+		"example.com/pkg/both":     30,
+		"example.com/pkg/onlyb":    20,
+		"example.com/pkg/unlinked": 3,
+	}, map[string][]string{
+		"example.com/cmds/a": {"example.com/cmds/a", "runtime", "example.com/pkg/onlya", "example.com/pkg/both"},
+		"example.com/cmds/b": {"example.com/cmds/b", "runtime", "example.com/pkg/onlyb", "example.com/pkg/both"},
+	}, []string{"runtime"})
+
+	want := Report{
+		SymbolSize:   1125,
+		Unattributed: 10,
+		Commands: []Command{
+			{
+				Name:       "a",
+				ImportPath: "example.com/cmds/a",
+				Size:       55,
+				Packages: []Package{
+					{ImportPath: "example.com/pkg/onlya", Size: 50},
+					{ImportPath: "example.com/cmds/a/.bb", Size: 5},
+				},
+			},
+			{
+				Name:       "b",
+				ImportPath: "example.com/cmds/b",
+				Size:       27,
+				Packages: []Package{
+					{ImportPath: "example.com/pkg/onlyb", Size: 20},
+					{ImportPath: "example.com/cmds/b/.bb", Size: 7},
+				},
+			},
+		},
+		Shared: []Package{
+			{ImportPath: "runtime", Size: 1000},
+			{ImportPath: "example.com/pkg/both", Size: 30, Commands: []string{"a", "b"}},
+			{ImportPath: "example.com/pkg/unlinked", Size: 3},
+		},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("attribute() = %+v, want %+v", r, want)
+	}
+}
+
+// TestAddBusyboxGOPATH checks that a GOPATH build's report has the vendored
+// packages that were linked, not the upstream ones.
+func TestAddBusyboxGOPATH(t *testing.T) {
+	root, err := filepath.Abs("../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "u-root-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gopath := filepath.Join(dir, "gopath")
+	src := filepath.Join(gopath, "src", "github.com", "u-root")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(src, "u-root")); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range map[string]string{"GO111MODULE": "off", "GOFLAGS": ""} {
+		defer os.Setenv(k, os.Getenv(k))
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := golang.Default()
+	env.GOPATH = gopath
+
+	const cmd = "github.com/u-root/u-root/cmds/core/basename"
+	bin := filepath.Join(dir, "bb")
+	if _, err := bb.BuildBusybox(env, []string{cmd}, golang.BuildOpts{NoStrip: true}, "", bin); err != nil {
+		t.Fatal(err)
+	}
+	var r Report
+	if err := r.AddBusybox(env, []string{cmd}, bin); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(r.Commands))
+	}
+	const pflag = "github.com/u-root/u-root/vendor/github.com/spf13/pflag"
+	for _, p := range r.Commands[0].Packages {
+		if p.ImportPath == pflag {
+			if p.Size == 0 {
+				t.Errorf("%s has size 0", pflag)
+			}
+			return
+		}
+	}
+	t.Errorf("%s is not in the packages of %s: %+v", pflag, cmd, r.Commands[0].Packages)
+}
+
+func TestJSON(t *testing.T) {
+	want := &Report{
+		BBSize:     100,
+		SymbolSize: 80,
+		Commands: []Command{
+			{Name: "ls", ImportPath: "example.com/ls", Size: 40, Packages: []Package{{ImportPath: "example.com/ls/.bb", Size: 40}}},
+		},
+		Shared:       []Package{{ImportPath: "runtime", Size: 30}},
+		Unattributed: 10,
+		ExtraFiles: []File{
+			{Path: "bin/x", Source: "/bin/x", Size: 5, Libs: []File{{Path: "lib/libc.so", Source: "/lib/libc.so", Size: 9}}},
+		},
+	}
+	var b bytes.Buffer
+	if err := want.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read(WriteJSON(%+v)) = %+v", want, got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := &Report{
+		BBSize:   100,
+		Commands: []Command{{Name: "ls", Size: 40}, {Name: "cat", Size: 5}},
+		Shared:   []Package{{ImportPath: "runtime", Size: 30}},
+	}
+	new := &Report{
+		BBSize:     120,
+		Commands:   []Command{{Name: "ls", Size: 40}, {Name: "dd", Size: 25}},
+		Shared:     []Package{{ImportPath: "runtime", Size: 30}},
+		ExtraFiles: []File{{Path: "bin/x", Size: 1}},
+	}
+
+	var b strings.Builder
+	if err := Diff(&b, old, new); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"       +25           0 ->         25  command dd (added)\n" +
+		"       +20         100 ->        120  bb binary\n" +
+		"        -5           5 ->          0  command cat (removed)\n" +
+		"        +1           0 ->          1  file bin/x (added)\n"
+	if got := b.String(); got != want {
+		t.Errorf("Diff() =\n%s\nwant\n%s", got, want)
+	}
+
+	b.Reset()
+	if err := Diff(&b, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "no size changes\n"; got != want {
+		t.Errorf("Diff(old, old) = %q, want %q", got, want)
+	}
+}
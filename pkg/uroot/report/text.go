@@ -0,0 +1,121 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// WriteText writes a human-readable breakdown of r to w. Sizes are in bytes.
+func (r *Report) WriteText(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "%10d  bb binary\n", r.BBSize)
+	fmt.Fprintf(b, "%10d  symbols in unstripped bb binary\n", r.SymbolSize)
+
+	fmt.Fprintf(b, "\nCommands (own package and packages only they use):\n")
+	for _, c := range r.Commands {
+		fmt.Fprintf(b, "%10d  %s\n", c.Size, c.Name)
+		for _, p := range c.Packages {
+			fmt.Fprintf(b, "%10d      %s\n", p.Size, p.ImportPath)
+		}
+	}
+
+	var shared int64
+	for _, p := range r.Shared {
+		shared += p.Size
+	}
+	fmt.Fprintf(b, "\nShared packages (%d bytes):\n", shared)
+	for _, p := range r.Shared {
+		users := "bb"
+		if len(p.Commands) > 0 {
+			users = fmt.Sprintf("%d commands", len(p.Commands))
+		}
+		fmt.Fprintf(b, "%10d  %s (%s)\n", p.Size, p.ImportPath, users)
+	}
+	fmt.Fprintf(b, "%10d  unattributed\n", r.Unattributed)
+
+	if len(r.ExtraFiles) > 0 {
+		fmt.Fprintf(b, "\nExtra files:\n")
+		for _, f := range r.ExtraFiles {
+			fmt.Fprintf(b, "%10d  %s (%s)\n", f.Size, f.Path, f.Source)
+			for _, l := range f.Libs {
+				fmt.Fprintf(b, "%10d      %s (ldd)\n", l.Size, l.Path)
+			}
+		}
+	}
+	return b.Flush()
+}
+
+// sizes flattens r into named sizes to compare.
+func (r *Report) sizes() map[string]int64 {
+	m := map[string]int64{
+		"bb binary":    r.BBSize,
+		"unattributed": r.Unattributed,
+	}
+	for _, c := range r.Commands {
+		m["command "+c.Name] = c.Size
+	}
+	for _, p := range r.Shared {
+		m["shared "+p.ImportPath] = p.Size
+	}
+	for _, f := range r.ExtraFiles {
+		m["file "+f.Path] = f.Size
+		for _, l := range f.Libs {
+			m["lib "+l.Path] = l.Size
+		}
+	}
+	return m
+}
+
+// Diff writes the sizes that differ between the reports old and new to w,
+// largest change first, as the change, the old and the new size.
+func Diff(w io.Writer, old, new *Report) error {
+	o, n := old.sizes(), new.sizes()
+	type change struct {
+		name     string
+		old, new int64
+		in       string
+	}
+	var changes []change
+	for name, size := range n {
+		in := ""
+		was, ok := o[name]
+		if !ok {
+			in = " (added)"
+		}
+		if was != size || !ok {
+			changes = append(changes, change{name, was, size, in})
+		}
+	}
+	for name, size := range o {
+		if _, ok := n[name]; !ok {
+			changes = append(changes, change{name, size, 0, " (removed)"})
+		}
+	}
+	abs := func(c change) int64 {
+		if c.new < c.old {
+			return c.old - c.new
+		}
+		return c.new - c.old
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if abs(changes[i]) != abs(changes[j]) {
+			return abs(changes[i]) > abs(changes[j])
+		}
+		return changes[i].name < changes[j].name
+	})
+
+	b := bufio.NewWriter(w)
+	if len(changes) == 0 {
+		fmt.Fprintf(b, "no size changes\n")
+	}
+	for _, c := range changes {
+		fmt.Fprintf(b, "%+10d  %10d -> %10d  %s%s\n", c.new-c.old, c.old, c.new, c.name, c.in)
+	}
+	return b.Flush()
+}
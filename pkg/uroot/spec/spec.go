@@ -0,0 +1,488 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package spec reads declarative initramfs build specs.
+//
+// A spec is a YAML or JSON file describing what goes into an initramfs. Its
+// keys are named after the u-root command's flags:
+//
+//   commands:
+//   - builder: bb
+//     packages:
+//     - core
+//     - github.com/u-root/u-root/cmds/boot/systemboot
+//   files:
+//   - /usr/bin/flashrom:bin/flashrom
+//   ldd: true
+//   uinitcmd: systemboot
+//   format: cpio
+//   compress: xz
+//   output: initramfs.cpio.xz
+//
+//   boards:
+//     qemu:
+//       files:
+//       - qemu/startup.sh:etc/startup.sh
+//     qemu-debug:
+//       inherit: qemu
+//       no-strip: true
+//
+// Each board inherits the top-level config, or the board named by inherit,
+// and overrides what it sets. Commands and files are added to the inherited
+// ones; packages of a group with the same builder and dir go into the
+// inherited group.
+//
+// Relative paths of files, base and output are relative to the spec file's
+// directory.
+//
+// Errors in a spec are reported with the file and line they are on.
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/u-root/u-root/pkg/shlex"
+	"github.com/u-root/u-root/pkg/uroot"
+	"github.com/u-root/u-root/pkg/uroot/builder"
+	"github.com/u-root/u-root/pkg/uroot/initramfs"
+)
+
+// Commands is a group of Go commands built with one builder.
+type Commands struct {
+	// Builder is the name of the builder: bb, binary or source.
+	Builder string `yaml:"builder"`
+
+	// Packages are Go import paths, package directories or names of the
+	// u-root command's templates.
+	Packages []string `yaml:"packages"`
+
+	// BinaryDir is the initramfs directory of the binaries. If empty, it
+	// is the builder's default.
+	BinaryDir string `yaml:"dir,omitempty"`
+}
+
+// Config describes an initramfs. Fields that are nil are not set by the
+// config.
+type Config struct {
+	Commands []Commands `yaml:"commands,omitempty"`
+
+	// Files are extra files, as in uroot.Opts.ExtraFiles.
+	Files []string `yaml:"files,omitempty"`
+
+	// LDD adds the shared library dependencies of Files.
+	LDD *bool `yaml:"ldd,omitempty"`
+
+	InitCmd *string `yaml:"initcmd,omitempty"`
+
+	// UinitCmd is the uinit command followed by its arguments.
+	UinitCmd     *string `yaml:"uinitcmd,omitempty"`
+	DefaultShell *string `yaml:"defaultsh,omitempty"`
+
+	// Base is the path of the base archive.
+	Base    *string `yaml:"base,omitempty"`
+	UseInit *bool   `yaml:"useinit,omitempty"`
+
+	Output   *string `yaml:"output,omitempty"`
+	Format   *string `yaml:"format,omitempty"`
+	Compress *string `yaml:"compress,omitempty"`
+
+	NoStrip      *bool `yaml:"no-strip,omitempty"`
+	Reproducible *bool `yaml:"reproducible,omitempty"`
+}
+
+// Board is a named config in a spec.
+type Board struct {
+	// Inherit is the board this board inherits from. If empty, it
+	// inherits the top-level config.
+	Inherit string `yaml:"inherit,omitempty"`
+
+	Config `yaml:",inline"`
+}
+
+// Spec is a build spec file.
+type Spec struct {
+	Config `yaml:",inline"`
+
+	Boards map[string]*Board `yaml:"boards,omitempty"`
+
+	file  string
+	lines map[string]int
+}
+
+// Error is an error at a line of a spec file.
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+// ReadFile reads and validates the spec at path.
+func ReadFile(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(path, data)
+	if err != nil {
+		return nil, err
+	}
+	s.resolvePaths(filepath.Dir(path))
+	return s, nil
+}
+
+// Parse parses and validates the spec in data. name is the file name used in
+// errors.
+func Parse(name string, data []byte) (*Spec, error) {
+	s := &Spec{file: name, lines: make(map[string]int)}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil && err != io.EOF {
+		return nil, s.yamlError(err)
+	}
+
+	// yaml.v3 only has the positions of values in its node tree.
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, s.yamlError(err)
+	}
+	if len(root.Content) > 0 {
+		addLines(s.lines, root.Content[0], "")
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// yamlError turns the "line N: msg" errors of yaml.v3 into Errors.
+func (s *Spec) yamlError(err error) error {
+	var msgs []string
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		msgs = te.Errors
+	} else {
+		msgs = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	var line int
+	for i, msg := range msgs {
+		var n int
+		if _, err := fmt.Sscanf(msg, "line %d:", &n); err == nil {
+			msg = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+		}
+		if i == 0 {
+			line = n
+		} else {
+			// Only the first error gets the line of the Error.
+			msg = (&Error{File: s.file, Line: n, Err: errors.New(msg)}).Error()
+		}
+		msgs[i] = msg
+	}
+	return &Error{File: s.file, Line: line, Err: errors.New(strings.Join(msgs, "\n"))}
+}
+
+// addLines records the line of n and everything below it in lines, keyed by
+// their path from the top of the spec, e.g. "boards.qemu.commands[0]".
+func addLines(lines map[string]int, n *yaml.Node, path string) {
+	lines[path] = n.Line
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			addLines(lines, n.Content[i+1], key)
+			// Point at the key rather than the value, which may
+			// be on the next line.
+			lines[key] = n.Content[i].Line
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			addLines(lines, c, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// errorf returns an Error at the line of the value at path.
+func (s *Spec) errorf(path string, format string, args ...interface{}) error {
+	return &Error{File: s.file, Line: s.lines[path], Err: fmt.Errorf(format, args...)}
+}
+
+func (s *Spec) validate() error {
+	if err := s.validateConfig(&s.Config, ""); err != nil {
+		return err
+	}
+	for _, name := range s.boardNames() {
+		b := s.Boards[name]
+		path := "boards." + name
+		if b == nil {
+			b = &Board{}
+			s.Boards[name] = b
+		}
+		if b.Inherit != "" {
+			if _, ok := s.Boards[b.Inherit]; !ok {
+				return s.errorf(path+".inherit", "board %q inherits unknown board %q", name, b.Inherit)
+			}
+		}
+		if err := s.validateConfig(&b.Config, path+"."); err != nil {
+			return err
+		}
+	}
+	for _, name := range s.boardNames() {
+		if _, err := s.chain(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Spec) validateConfig(c *Config, prefix string) error {
+	for i, cmds := range c.Commands {
+		path := fmt.Sprintf("%scommands[%d]", prefix, i)
+		if _, err := builderByName(cmds.Builder); err != nil {
+			return s.errorf(path, "%v", err)
+		}
+		if len(cmds.Packages) == 0 {
+			return s.errorf(path, "%s commands have no packages", cmds.Builder)
+		}
+		for j, p := range cmds.Packages {
+			if strings.TrimSpace(p) == "" {
+				return s.errorf(fmt.Sprintf("%s.packages[%d]", path, j), "empty package")
+			}
+		}
+	}
+	for i, f := range c.Files {
+		if f == "" || strings.HasPrefix(f, ":") || strings.HasSuffix(f, ":") {
+			return s.errorf(fmt.Sprintf("%sfiles[%d]", prefix, i), "invalid file %q, want src or src:dst", f)
+		}
+	}
+	if c.Format != nil {
+		if _, err := initramfs.GetArchiver(*c.Format); err != nil {
+			return s.errorf(prefix+"format", "%v", err)
+		}
+	}
+	if c.Compress != nil && *c.Compress != "" {
+		if _, err := initramfs.GetCompressor(*c.Compress); err != nil {
+			return s.errorf(prefix+"compress", "%v", err)
+		}
+	}
+	return nil
+}
+
+func (s *Spec) boardNames() []string {
+	var names []string
+	for name := range s.Boards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chain returns the boards the board name inherits from, starting with the
+// board itself.
+func (s *Spec) chain(name string) ([]*Board, error) {
+	var boards []*Board
+	var names []string
+	for n := name; n != ""; n = s.Boards[n].Inherit {
+		names = append(names, n)
+		for _, seen := range names[:len(names)-1] {
+			if seen == n {
+				return nil, s.errorf("boards."+n+".inherit", "inheritance cycle %s", strings.Join(names, " -> "))
+			}
+		}
+		boards = append(boards, s.Boards[n])
+	}
+	return boards, nil
+}
+
+// resolvePaths makes the relative paths in s relative to dir.
+func (s *Spec) resolvePaths(dir string) {
+	configs := []*Config{&s.Config}
+	for _, b := range s.Boards {
+		configs = append(configs, &b.Config)
+	}
+	for _, c := range configs {
+		for i, f := range c.Files {
+			c.Files[i] = resolve(dir, f)
+		}
+		for _, p := range []*string{c.Base, c.Output} {
+			if p != nil && *p != "" && !filepath.IsAbs(*p) {
+				*p = filepath.Join(dir, *p)
+			}
+		}
+	}
+}
+
+// resolve makes the source of the extra file f relative to dir.
+func resolve(dir, f string) string {
+	parts := strings.SplitN(f, ":", 2)
+	if !filepath.IsAbs(parts[0]) {
+		parts[0] = filepath.Join(dir, parts[0])
+		if len(parts) == 1 {
+			// The archive path of "src" is src itself, so keep
+			// it as it was written.
+			parts = append(parts, filepath.Clean(f))
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// Board returns the config of the board name, with everything it inherits.
+// If name is empty, Board returns the top-level config.
+func (s *Spec) Board(name string) (*Config, error) {
+	c := &Config{}
+	c.Merge(&s.Config)
+	if name == "" {
+		return c, nil
+	}
+	if _, ok := s.Boards[name]; !ok {
+		return nil, &Error{File: s.file, Err: fmt.Errorf("no board %q; boards are %v", name, s.boardNames())}
+	}
+	boards, err := s.chain(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(boards) - 1; i >= 0; i-- {
+		c.Merge(&boards[i].Config)
+	}
+	return c, nil
+}
+
+// Merge overrides the fields of c with the fields o sets, and adds o's
+// commands and files to c's.
+func (c *Config) Merge(o *Config) {
+	for _, oc := range o.Commands {
+		c.addCommands(oc)
+	}
+	c.Files = append(c.Files, o.Files...)
+
+	mergeBool(&c.LDD, o.LDD)
+	mergeString(&c.InitCmd, o.InitCmd)
+	mergeString(&c.UinitCmd, o.UinitCmd)
+	mergeString(&c.DefaultShell, o.DefaultShell)
+	mergeString(&c.Base, o.Base)
+	mergeBool(&c.UseInit, o.UseInit)
+	mergeString(&c.Output, o.Output)
+	mergeString(&c.Format, o.Format)
+	mergeString(&c.Compress, o.Compress)
+	mergeBool(&c.NoStrip, o.NoStrip)
+	mergeBool(&c.Reproducible, o.Reproducible)
+}
+
+// addCommands adds the packages of cmds to the group with the same builder
+// and binary directory, or adds cmds as a new group.
+func (c *Config) addCommands(cmds Commands) {
+	for i, have := range c.Commands {
+		if have.Builder == cmds.Builder && have.BinaryDir == cmds.BinaryDir {
+			c.Commands[i].Packages = append(append([]string(nil), have.Packages...), cmds.Packages...)
+			return
+		}
+	}
+	cmds.Packages = append([]string(nil), cmds.Packages...)
+	c.Commands = append(c.Commands, cmds)
+}
+
+func mergeBool(dst **bool, src *bool) {
+	if src != nil {
+		v := *src
+		*dst = &v
+	}
+}
+
+func mergeString(dst **string, src *string) {
+	if src != nil {
+		v := *src
+		*dst = &v
+	}
+}
+
+func builderByName(name string) (builder.Builder, error) {
+	switch name {
+	case "bb":
+		return builder.BBBuilder{}, nil
+	case "binary":
+		return builder.BinaryBuilder{}, nil
+	case "source":
+		return builder.SourceBuilder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown builder %q, want bb, binary or source", name)
+	}
+}
+
+// UrootCommands returns c's commands, with each package transformed by
+// expand, e.g. to expand template names.
+func (c *Config) UrootCommands(expand func(pkgs []string) []string) ([]uroot.Commands, error) {
+	var cmds []uroot.Commands
+	for _, cc := range c.Commands {
+		b, err := builderByName(cc.Builder)
+		if err != nil {
+			return nil, err
+		}
+		pkgs := cc.Packages
+		if expand != nil {
+			pkgs = expand(pkgs)
+		}
+		cmds = append(cmds, uroot.Commands{
+			Builder:   b,
+			Packages:  pkgs,
+			BinaryDir: cc.BinaryDir,
+		})
+	}
+	return cmds, nil
+}
+
+// Apply sets the fields of opts that c sets, other than the commands.
+//
+// The base archive and output file are left to the caller to open.
+func (c *Config) Apply(opts *uroot.Opts) {
+	opts.ExtraFiles = append(opts.ExtraFiles, c.Files...)
+	if c.LDD != nil {
+		opts.SkipLDD = !*c.LDD
+	}
+	if c.InitCmd != nil {
+		opts.InitCmd = *c.InitCmd
+	}
+	if c.UinitCmd != nil {
+		opts.UinitCmd, opts.UinitArgs = "", nil
+		if args := shlex.Argv(*c.UinitCmd); len(args) > 0 {
+			opts.UinitCmd, opts.UinitArgs = args[0], args[1:]
+		}
+	}
+	if c.DefaultShell != nil {
+		opts.DefaultShell = *c.DefaultShell
+	}
+	if c.UseInit != nil {
+		opts.UseExistingInit = *c.UseInit
+	}
+	if c.NoStrip != nil {
+		opts.NoStrip = *c.NoStrip
+	}
+	if c.Reproducible != nil {
+		opts.Reproducible = *c.Reproducible
+	}
+	if c.Compress != nil {
+		// An empty name means no compression. Parse rejects unknown
+		// names.
+		opts.Compressor, _ = initramfs.GetCompressor(*c.Compress)
+	}
+}
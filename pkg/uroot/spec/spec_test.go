@@ -0,0 +1,247 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/uroot"
+	"github.com/u-root/u-root/pkg/uroot/builder"
+	"github.com/u-root/u-root/pkg/uroot/initramfs"
+)
+
+const testSpec = `# Boards of the lab.
+commands:
+- builder: bb
+  packages:
+  - core
+files:
+- /bin/bash
+uinitcmd: systemboot -dry-run
+format: cpio
+
+boards:
+  qemu:
+    commands:
+    - builder: bb
+      packages: [github.com/u-root/u-root/cmds/exp/dmidecode]
+    files:
+    - startup.sh:etc/startup.sh
+    compress: xz
+  qemu-debug:
+    inherit: qemu
+    commands:
+    - builder: binary
+      packages: [github.com/u-root/u-root/cmds/core/ls]
+    no-strip: true
+    ldd: false
+`
+
+func TestBoard(t *testing.T) {
+	s, err := Parse("test.yaml", []byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+	yes, no := true, false
+
+	for _, tt := range []struct {
+		board string
+		want  *Config
+	}{
+		{
+			board: "",
+			want: &Config{
+				Commands: []Commands{{Builder: "bb", Packages: []string{"core"}}},
+				Files:    []string{"/bin/bash"},
+				UinitCmd: str("systemboot -dry-run"),
+				Format:   str("cpio"),
+			},
+		},
+		{
+			board: "qemu",
+			want: &Config{
+				Commands: []Commands{{Builder: "bb", Packages: []string{"core", "github.com/u-root/u-root/cmds/exp/dmidecode"}}},
+				Files:    []string{"/bin/bash", "startup.sh:etc/startup.sh"},
+				UinitCmd: str("systemboot -dry-run"),
+				Format:   str("cpio"),
+				Compress: str("xz"),
+			},
+		},
+		{
+			board: "qemu-debug",
+			want: &Config{
+				Commands: []Commands{
+					{Builder: "bb", Packages: []string{"core", "github.com/u-root/u-root/cmds/exp/dmidecode"}},
+					{Builder: "binary", Packages: []string{"github.com/u-root/u-root/cmds/core/ls"}},
+				},
+				Files:    []string{"/bin/bash", "startup.sh:etc/startup.sh"},
+				LDD:      &no,
+				UinitCmd: str("systemboot -dry-run"),
+				Format:   str("cpio"),
+				Compress: str("xz"),
+				NoStrip:  &yes,
+			},
+		},
+	} {
+		got, err := s.Board(tt.board)
+		if err != nil {
+			t.Errorf("Board(%q) = %v", tt.board, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Board(%q) = %+v, want %+v", tt.board, got, tt.want)
+		}
+	}
+
+	// Building a board must not change the spec.
+	if c, _ := s.Board(""); len(c.Commands[0].Packages) != 1 {
+		t.Errorf("top-level packages = %v after building boards, want [core]", c.Commands[0].Packages)
+	}
+	if _, err := s.Board("arm"); err == nil {
+		t.Errorf("Board(arm) succeeded for a board not in the spec")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		spec string
+		want string
+	}{
+		{
+			name: "unknown builder",
+			spec: "commands:\n- builder: bb\n  packages: [x]\n- builder: gcc\n  packages: [y]\n",
+			want: `test.yaml:4: unknown builder "gcc", want bb, binary or source`,
+		},
+		{
+			name: "no packages",
+			spec: "commands:\n- builder: bb\n",
+			want: "test.yaml:2: bb commands have no packages",
+		},
+		{
+			name: "unknown field",
+			spec: "files: [a]\noutptu: x\n",
+			want: "test.yaml:2: field outptu not found in type spec.Spec",
+		},
+		{
+			name: "wrong type",
+			spec: "ldd: maybe\n",
+			want: "test.yaml:1: cannot unmarshal !!str `maybe` into bool",
+		},
+		{
+			name: "bad board compression",
+			spec: "boards:\n  qemu:\n    compress: zip\n",
+			want: `test.yaml:3: couldn't find compression format "zip"`,
+		},
+		{
+			name: "bad file",
+			spec: "files:\n- a\n- :b\n",
+			want: `test.yaml:3: invalid file ":b", want src or src:dst`,
+		},
+		{
+			name: "unknown parent",
+			spec: "boards:\n  qemu:\n    inherit: kvm\n",
+			want: `test.yaml:3: board "qemu" inherits unknown board "kvm"`,
+		},
+		{
+			name: "inheritance cycle",
+			spec: "boards:\n  a:\n    inherit: b\n  b:\n    inherit: a\n",
+			want: "test.yaml:3: inheritance cycle a -> b -> a",
+		},
+		{
+			name: "json",
+			spec: "{\n  \"format\": \"cpio\",\n  \"commands\": [{\"builder\": \"bin\", \"packages\": [\"x\"]}]\n}\n",
+			want: `test.yaml:3: unknown builder "bin", want bb, binary or source`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("test.yaml", []byte(tt.spec))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Parse() = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFileResolvesPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "u-root-spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spec.yaml")
+	spec := "files:\n- etc/motd\n- files/startup.sh:etc/startup.sh\n- /bin/bash\nbase: base.cpio\noutput: /tmp/out.cpio\n"
+	if err := ioutil.WriteFile(path, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []string{
+		filepath.Join(dir, "etc/motd") + ":etc/motd",
+		filepath.Join(dir, "files/startup.sh") + ":etc/startup.sh",
+		"/bin/bash",
+	}
+	if !reflect.DeepEqual(s.Files, wantFiles) {
+		t.Errorf("Files = %v, want %v", s.Files, wantFiles)
+	}
+	if want := filepath.Join(dir, "base.cpio"); *s.Base != want {
+		t.Errorf("Base = %q, want %q", *s.Base, want)
+	}
+	if want := "/tmp/out.cpio"; *s.Output != want {
+		t.Errorf("Output = %q, want %q", *s.Output, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	s, err := Parse("test.yaml", []byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Board("qemu-debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmds, err := c.UrootCommands(func(pkgs []string) []string {
+		if pkgs[0] == "core" {
+			pkgs = append([]string{"github.com/u-root/u-root/cmds/core/*"}, pkgs[1:]...)
+		}
+		return pkgs
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCmds := []uroot.Commands{
+		{Builder: builder.BBBuilder{}, Packages: []string{"github.com/u-root/u-root/cmds/core/*", "github.com/u-root/u-root/cmds/exp/dmidecode"}},
+		{Builder: builder.BinaryBuilder{}, Packages: []string{"github.com/u-root/u-root/cmds/core/ls"}},
+	}
+	if !reflect.DeepEqual(cmds, wantCmds) {
+		t.Errorf("UrootCommands() = %v, want %v", cmds, wantCmds)
+	}
+
+	opts := uroot.Opts{InitCmd: "init", DefaultShell: "elvish"}
+	c.Apply(&opts)
+	want := uroot.Opts{
+		ExtraFiles:   []string{"/bin/bash", "startup.sh:etc/startup.sh"},
+		SkipLDD:      true,
+		InitCmd:      "init",
+		UinitCmd:     "systemboot",
+		UinitArgs:    []string{"-dry-run"},
+		DefaultShell: "elvish",
+		NoStrip:      true,
+		Compressor:   initramfs.XZ,
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("Apply() = %+v, want %+v", opts, want)
+	}
+}
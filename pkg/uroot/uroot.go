@@ -10,12 +10,18 @@ package uroot
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"golang.org/x/mod/module"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/u-root/u-root/pkg/bb"
 	"github.com/u-root/u-root/pkg/cpio"
 	"github.com/u-root/u-root/pkg/golang"
 	"github.com/u-root/u-root/pkg/ldd"
@@ -23,6 +29,7 @@ import (
 	"github.com/u-root/u-root/pkg/ulog"
 	"github.com/u-root/u-root/pkg/uroot/builder"
 	"github.com/u-root/u-root/pkg/uroot/initramfs"
+	"github.com/u-root/u-root/pkg/uroot/report"
 )
 
 // These constants are used in DefaultRamfs.
@@ -171,6 +178,10 @@ type Opts struct {
 	// OutputFile is the archive output file.
 	OutputFile initramfs.Writer
 
+	// Compressor, if not nil, compresses the archive that OpenOutputFile
+	// opens as OutputFile.
+	Compressor initramfs.Compressor
+
 	// BaseArchive is an existing initramfs to include in the resulting
 	// initramfs.
 	BaseArchive initramfs.Reader
@@ -217,6 +228,48 @@ type Opts struct {
 
 	// NoStrip builds unstripped binaries.
 	NoStrip bool
+
+	// Reproducible builds an initramfs that only depends on its inputs,
+	// not on the build machine or the time of the build.
+	//
+	// Binaries are built with -trimpath and an empty build ID, and all
+	// records get normalized metadata as in initramfs.Opts.Reproducible.
+	Reproducible bool
+
+	// SourceDateEpoch is the mtime of all records if Reproducible is set.
+	SourceDateEpoch uint64
+
+	// Manifest, if not nil, receives a manifest of the initramfs as
+	// written by initramfs.WriteManifest.
+	Manifest io.Writer
+
+	// CacheDir, if not empty, is a persistent directory where the bb
+	// builder keeps rewritten packages between builds.
+	CacheDir string
+
+	// Report, if not nil, is filled in with a breakdown of the size of the
+	// bb binary and the ExtraFiles.
+	//
+	// The bb binary is built a second time without stripping it to read
+	// its symbol table, so Commands must include a BBBuilder.
+	Report *report.Report
+}
+
+// OpenOutputFile opens path as an archive in archiver's format for o.Env,
+// compressed with o.Compressor if it is set, and makes it o.OutputFile.
+func (o *Opts) OpenOutputFile(logger ulog.Logger, archiver initramfs.Archiver, path string) error {
+	if o.Compressor != nil {
+		var err error
+		if archiver, err = initramfs.WithCompressor(archiver, o.Compressor); err != nil {
+			return err
+		}
+	}
+	w, err := archiver.OpenWriter(logger, path, o.Env.GOOS, o.Env.GOARCH)
+	if err != nil {
+		return err
+	}
+	o.OutputFile = w
+	return nil
 }
 
 // CreateInitramfs creates an initramfs built to opts' specifications.
@@ -240,23 +293,45 @@ func CreateInitramfs(logger ulog.Logger, opts Opts) error {
 	}
 
 	// Add each build mode's commands to the archive.
+	reported := false
 	for _, cmds := range opts.Commands {
 		builderTmpDir, err := ioutil.TempDir(opts.TempDir, "builder")
 		if err != nil {
 			return err
 		}
+		_, isBB := cmds.Builder.(builder.BBBuilder)
+		wantReport := opts.Report != nil && isBB
 
 		// Build packages.
 		bOpts := builder.Opts{
-			Env:       opts.Env,
-			Packages:  cmds.Packages,
-			TempDir:   builderTmpDir,
-			BinaryDir: cmds.TargetDir(),
-			NoStrip:   opts.NoStrip,
+			Env:          opts.Env,
+			Packages:     cmds.Packages,
+			TempDir:      builderTmpDir,
+			BinaryDir:    cmds.TargetDir(),
+			NoStrip:      opts.NoStrip,
+			Reproducible: opts.Reproducible,
+			CacheDir:     opts.CacheDir,
+			Logger:       logger,
+		}
+		if wantReport && bOpts.CacheDir == "" {
+			// The report's unstripped build reuses the rewritten
+			// packages through the cache.
+			if bOpts.CacheDir, err = ioutil.TempDir(opts.TempDir, "bbcache"); err != nil {
+				return err
+			}
 		}
 		if err := cmds.Builder.Build(files, bOpts); err != nil {
 			return fmt.Errorf("error building: %v", err)
 		}
+		if wantReport {
+			if err := reportBusybox(opts.Report, bOpts); err != nil {
+				return fmt.Errorf("error reporting bb size: %v", err)
+			}
+			reported = true
+		}
+	}
+	if opts.Report != nil && !reported {
+		return fmt.Errorf("a size report needs commands built with the bb builder")
 	}
 
 	// Open the target initramfs file.
@@ -265,10 +340,18 @@ func CreateInitramfs(logger ulog.Logger, opts Opts) error {
 		OutputFile:      opts.OutputFile,
 		BaseArchive:     opts.BaseArchive,
 		UseExistingInit: opts.UseExistingInit,
+		Reproducible:    opts.Reproducible,
+		SourceDateEpoch: opts.SourceDateEpoch,
+		Manifest:        opts.Manifest,
 	}
 	if err := ParseExtraFiles(logger, archive.Files, opts.ExtraFiles, !opts.SkipLDD); err != nil {
 		return err
 	}
+	if opts.Report != nil {
+		if err := reportExtraFiles(logger, opts.Report, opts.ExtraFiles, !opts.SkipLDD); err != nil {
+			return err
+		}
+	}
 
 	if err := opts.addSymlinkTo(logger, archive, opts.UinitCmd, "bin/uinit"); err != nil {
 		return fmt.Errorf("%v: specify -uinitcmd=\"\" to ignore this error and build without a uinit", err)
@@ -295,6 +378,25 @@ func CreateInitramfs(logger ulog.Logger, opts Opts) error {
 	return nil
 }
 
+// reportBusybox adds the sizes of the bb binary built with opts to rep.
+func reportBusybox(rep *report.Report, opts builder.Opts) error {
+	fi, err := os.Stat(filepath.Join(opts.TempDir, "bb"))
+	if err != nil {
+		return err
+	}
+	rep.BBSize = fi.Size()
+
+	bOpts := golang.BuildOpts{
+		NoStrip:      true,
+		Reproducible: opts.Reproducible,
+	}
+	symsPath := filepath.Join(opts.TempDir, "bb.syms")
+	if _, err := bb.BuildBusybox(opts.Env, opts.Packages, bOpts, opts.CacheDir, symsPath); err != nil {
+		return err
+	}
+	return rep.AddBusybox(opts.Env, opts.Packages, symsPath)
+}
+
 func (o *Opts) addSymlinkTo(logger ulog.Logger, archive *initramfs.Opts, command string, source string) error {
 	if len(command) == 0 {
 		return nil
@@ -325,49 +427,170 @@ func (o *Opts) addSymlinkTo(logger ulog.Logger, archive *initramfs.Opts, command
 	return nil
 }
 
-// resolvePackagePath finds import paths for a single import path or directory string
-func resolvePackagePath(logger ulog.Logger, env golang.Environ, pkg string) ([]string, error) {
-	// Search the current working directory, as well GOROOT and GOPATHs
-	prefixes := append([]string{""}, env.SrcDirs()...)
-	// Resolve file system paths to package import paths.
-	for _, prefix := range prefixes {
-		path := filepath.Join(prefix, pkg)
-		matches, err := filepath.Glob(path)
-		if len(matches) == 0 || err != nil {
+// hasGlob reports whether s has any filepath.Match metacharacters.
+func hasGlob(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+// matchPackages returns the import paths of the packages matching the glob
+// pattern, listing the packages below the longest prefix without globs.
+func matchPackages(pattern string, lookup func(...string) ([]*packages.Package, error)) ([]string, error) {
+	elems := strings.Split(pattern, "/")
+	var prefix []string
+	for _, e := range elems {
+		if hasGlob(e) {
+			break
+		}
+		prefix = append(prefix, e)
+	}
+	if len(prefix) == 0 {
+		return nil, fmt.Errorf("glob %q must start with an import path", pattern)
+	}
+	pkgs, err := lookup(path.Join(prefix...) + "/...")
+	if err != nil {
+		return nil, err
+	}
+	var importPaths []string
+	for _, p := range pkgs {
+		if ok, _ := path.Match(pattern, p.PkgPath); ok {
+			importPaths = append(importPaths, p.PkgPath)
+		}
+	}
+	sort.Strings(importPaths)
+	return importPaths, nil
+}
+
+// resolveVersioned resolves a module@version/path specifier, where path may
+// be a glob, to specifiers of the packages it matches.
+func resolveVersioned(env golang.Environ, pkg string) ([]string, error) {
+	mod, importPath, _ := golang.SplitVersion(pkg)
+	if err := module.Check(mod.Path, mod.Version); err != nil {
+		return nil, fmt.Errorf("%q: %v", pkg, err)
+	}
+
+	dir, err := ioutil.TempDir("", "u-root-resolve")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	ws, _, err := env.NewWorkspace(dir, []string{pkg})
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(patterns ...string) ([]*packages.Package, error) {
+		return ws.Lookup(packages.NeedName, patterns...)
+	}
+
+	var importPaths []string
+	if hasGlob(importPath) {
+		importPaths, err = matchPackages(importPath, lookup)
+	} else {
+		_, err = lookup(importPath)
+		importPaths = []string{importPath}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var specs []string
+	for _, p := range importPaths {
+		specs = append(specs, mod.String()+strings.TrimPrefix(p, mod.Path))
+	}
+	return specs, nil
+}
+
+// resolveDirs finds the import paths of the packages in dirs.
+func resolveDirs(logger ulog.Logger, env golang.Environ, dirs []string) []string {
+	var importPaths []string
+	// Usually, all directories are in the current module, and are
+	// resolved at once.
+	if pkgs, err := env.Lookup(packages.NeedName, "", dirs...); err == nil {
+		for _, p := range pkgs {
+			importPaths = append(importPaths, p.PkgPath)
+		}
+		return importPaths
+	}
+
+	for _, dir := range dirs {
+		pkgs, err := env.Lookup(packages.NeedName, dir, ".")
+		if err != nil {
+			logger.Printf("Skipping package %q: %v", dir, err)
 			continue
 		}
+		importPaths = append(importPaths, pkgs[0].PkgPath)
+	}
+	return importPaths
+}
 
-		var importPaths []string
-		for _, match := range matches {
+// resolveGOPATHDirs finds the import paths of the packages in dirs, which
+// are in a GOPATH.
+func resolveGOPATHDirs(logger ulog.Logger, env golang.Environ, dirs []string) []string {
+	var importPaths []string
+	for _, dir := range dirs {
+		p, err := env.PackageByPath(dir)
+		if err != nil {
+			logger.Printf("Skipping package %q: %v", dir, err)
+			continue
+		}
+		importPaths = append(importPaths, p.ImportPath)
+	}
+	return importPaths
+}
 
-			// Only match directories for building.
-			// Skip anything that is not a directory
-			fileInfo, _ := os.Stat(match)
-			if !fileInfo.IsDir() {
+// globDirs returns the directories matching the glob pattern.
+func globDirs(pattern string) []string {
+	matches, _ := filepath.Glob(pattern)
+	var dirs []string
+	for _, match := range matches {
+		// Only match directories for building.
+		// Skip anything that is not a directory
+		if fi, err := os.Stat(match); err == nil && fi.IsDir() {
+			abs, err := filepath.Abs(match)
+			if err != nil {
 				continue
 			}
+			dirs = append(dirs, abs)
+		}
+	}
+	return dirs
+}
 
-			p, err := env.PackageByPath(match)
-			if err != nil {
-				logger.Printf("Skipping package %q: %v", match, err)
-			} else if p.ImportPath == "." {
-				// TODO: I do not completely understand why
-				// this is triggered. This is only an issue
-				// while this function is run inside the
-				// process of a "go test".
-				importPaths = append(importPaths, pkg)
-			} else {
-				importPaths = append(importPaths, p.ImportPath)
-			}
+// resolvePackagePath finds import paths for a single import path or directory string
+func resolvePackagePath(logger ulog.Logger, env golang.Environ, pkg string) ([]string, error) {
+	if _, _, ok := golang.SplitVersion(pkg); ok {
+		return resolveVersioned(env, pkg)
+	}
+
+	// Resolve file system paths to package import paths.
+	if matches, _ := filepath.Glob(pkg); len(matches) > 0 {
+		return resolveDirs(logger, env, globDirs(pkg)), nil
+	}
+
+	// Resolve import paths as the go command does in the current
+	// directory.
+	lookup := func(patterns ...string) ([]*packages.Package, error) {
+		return env.Lookup(packages.NeedName, "", patterns...)
+	}
+	var importPaths []string
+	var err error
+	if hasGlob(pkg) {
+		importPaths, err = matchPackages(pkg, lookup)
+		if err == nil && len(importPaths) == 0 {
+			err = fmt.Errorf("no packages match")
 		}
+	} else if _, err = lookup(pkg); err == nil {
+		importPaths = []string{pkg}
+	}
+	if err == nil {
 		return importPaths, nil
 	}
 
-	// No file import paths found. Check if pkg still resolves as a package name.
-	if _, err := env.Package(pkg); err != nil {
-		return nil, fmt.Errorf("%q is neither package or path/glob: %v", pkg, err)
+	// Search GOPATHs for packages outside of any module.
+	for _, srcDir := range env.SrcDirs() {
+		if dirs := globDirs(filepath.Join(srcDir, pkg)); len(dirs) > 0 {
+			return resolveGOPATHDirs(logger, env, dirs), nil
+		}
 	}
-	return []string{pkg}, nil
+	return nil, fmt.Errorf("%q is neither package or path/glob: %v", pkg, err)
 }
 
 func resolveCommandOrPath(cmd string, cmds []Commands) (string, error) {
@@ -381,7 +604,7 @@ func resolveCommandOrPath(cmd string, cmds []Commands) (string, error) {
 	// build mode.
 	for _, c := range cmds {
 		for _, p := range c.Packages {
-			if name := path.Base(p); name == cmd {
+			if name := golang.CommandName(p); name == cmd {
 				return path.Join("/", c.TargetDir(), cmd), nil
 			}
 		}
@@ -399,8 +622,15 @@ func resolveCommandOrPath(cmd string, cmds []Commands) (string, error) {
 //   - globs of package imports, e.g. github.com/u-root/u-root/cmds/*
 //   - paths to package directories; e.g. $GOPATH/src/github.com/u-root/u-root/cmds/ls
 //   - globs of paths to package directories; e.g. ./cmds/*
+//   - module versions; e.g. github.com/org/repo@v1.2.3/cmds/ls, or
+//     github.com/org/repo@v1.2.3/cmds/* for all of its commands
 //   - if an entry starts with "-" it excludes the matching package(s)
 //
+// Import paths are resolved as the go command would in the current
+// directory. Packages named with a module version are returned in the
+// module@version/path form, which the bb and binary builders build in a
+// workspace module (see golang.Workspace).
+//
 // Directories may be relative or absolute, with or without globs.
 // Globs are resolved using filepath.Glob.
 func ResolvePackagePaths(logger ulog.Logger, env golang.Environ, pkgs []string) ([]string, error) {
@@ -444,33 +674,14 @@ func ResolvePackagePaths(logger ulog.Logger, env golang.Environ, pkgs []string)
 //
 // ParseExtraFiles will also add ldd-listed dependencies if lddDeps is true.
 func ParseExtraFiles(logger ulog.Logger, archive *initramfs.Files, extraFiles []string, lddDeps bool) error {
-	var err error
 	// Add files from command line.
 	for _, file := range extraFiles {
-		var src, dst string
-		parts := strings.SplitN(file, ":", 2)
-		if len(parts) == 2 {
-			// treat the entry with the new src:dst syntax
-			src = filepath.Clean(parts[0])
-			dst = filepath.Clean(parts[1])
-		} else {
-			// plain old syntax
-			// filepath.Clean interprets an empty string as CWD for no good reason.
-			if len(file) == 0 {
-				continue
-			}
-			src = filepath.Clean(file)
-			dst = src
-			if filepath.IsAbs(dst) {
-				dst, err = filepath.Rel("/", dst)
-				if err != nil {
-					return fmt.Errorf("cannot make path relative to /: %v: %v", dst, err)
-				}
-			}
-		}
-		src, err := filepath.Abs(src)
+		src, dst, err := parseExtraFile(file)
 		if err != nil {
-			return fmt.Errorf("couldn't find absolute path for %q: %v", src, err)
+			return err
+		}
+		if src == "" {
+			continue
 		}
 		if err := archive.AddFileNoFollow(src, dst); err != nil {
 			return fmt.Errorf("couldn't add %q to archive: %v", file, err)
@@ -500,6 +711,75 @@ func ParseExtraFiles(logger ulog.Logger, archive *initramfs.Files, extraFiles []
 	return nil
 }
 
+// parseExtraFile returns the absolute host path and the archive path of an
+// ExtraFiles entry. src is empty if the entry should be ignored.
+func parseExtraFile(file string) (src, dst string, err error) {
+	parts := strings.SplitN(file, ":", 2)
+	if len(parts) == 2 {
+		// treat the entry with the new src:dst syntax
+		src = filepath.Clean(parts[0])
+		dst = filepath.Clean(parts[1])
+	} else {
+		// plain old syntax
+		// filepath.Clean interprets an empty string as CWD for no good reason.
+		if len(file) == 0 {
+			return "", "", nil
+		}
+		src = filepath.Clean(file)
+		dst = src
+		if filepath.IsAbs(dst) {
+			dst, err = filepath.Rel("/", dst)
+			if err != nil {
+				return "", "", fmt.Errorf("cannot make path relative to /: %v: %v", dst, err)
+			}
+		}
+	}
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't find absolute path for %q: %v", src, err)
+	}
+	return abs, dst, nil
+}
+
+// reportExtraFiles adds the sizes of extraFiles, and of their ldd-listed
+// dependencies if lddDeps is true, to rep.
+func reportExtraFiles(logger ulog.Logger, rep *report.Report, extraFiles []string, lddDeps bool) error {
+	for _, file := range extraFiles {
+		src, dst, err := parseExtraFile(file)
+		if err != nil {
+			return err
+		}
+		if src == "" {
+			continue
+		}
+		size, err := report.FileSize(src)
+		if err != nil {
+			return err
+		}
+		f := report.File{Path: dst, Source: src, Size: size}
+
+		if lddDeps {
+			libs, err := ldd.List([]string{src})
+			if err != nil {
+				logger.Printf("WARNING: couldn't report ldd dependencies for %q: %v", file, err)
+				libs = nil
+			}
+			for _, lib := range libs {
+				if lib == src {
+					continue
+				}
+				size, err := report.FileSize(lib)
+				if err != nil {
+					return err
+				}
+				f.Libs = append(f.Libs, report.File{Path: lib[1:], Source: lib, Size: size})
+			}
+		}
+		rep.ExtraFiles = append(rep.ExtraFiles, f)
+	}
+	return nil
+}
+
 // AddCommands adds commands to the build.
 func (o *Opts) AddCommands(c ...Commands) {
 	o.Commands = append(o.Commands, c...)
@@ -5,6 +5,8 @@
 package uroot
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -17,6 +19,7 @@ import (
 	"github.com/u-root/u-root/pkg/cpio"
 	"github.com/u-root/u-root/pkg/golang"
 	"github.com/u-root/u-root/pkg/uroot/builder"
+	"github.com/u-root/u-root/pkg/uroot/initramfs"
 	itest "github.com/u-root/u-root/pkg/uroot/initramfs/test"
 )
 
@@ -350,3 +353,56 @@ func TestCreateInitramfs(t *testing.T) {
 		})
 	}
 }
+
+func TestOpenOutputFileCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "initramfs.cpio.xz")
+	opts := Opts{Env: golang.Default(), Compressor: initramfs.XZ}
+	if err := opts.OpenOutputFile(log.New(os.Stderr, "", 0), initramfs.CPIO, path); err != nil {
+		t.Fatal(err)
+	}
+	want := cpio.StaticFile("etc/motd", "hello", 0644)
+	if err := opts.OutputFile.WriteRecord(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.OutputFile.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	magic := make([]byte, len(initramfs.XZ.Magic()))
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(magic, initramfs.XZ.Magic()) {
+		t.Errorf("archive starts with %x, want xz magic %x", magic, initramfs.XZ.Magic())
+	}
+	recs, err := cpio.ReadAllRecords(initramfs.OpenReader(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Name != want.Name {
+		t.Errorf("archive has records %v, want [%v]", recs, want)
+	}
+}
+
+func TestOpenOutputFileNotCompressible(t *testing.T) {
+	opts := Opts{Env: golang.Default(), Compressor: initramfs.XZ}
+	if err := opts.OpenOutputFile(log.New(os.Stderr, "", 0), initramfs.Dir, "/nonexistent"); !errors.Is(err, initramfs.ErrNoCompression) {
+		t.Errorf("OpenOutputFile(Dir) with a compressor = %v, want %v", err, initramfs.ErrNoCompression)
+	}
+
+	// Other errors of compressible archivers are not about compression.
+	if err := opts.OpenOutputFile(log.New(os.Stderr, "", 0), initramfs.CPIO, "/nonexistent/initramfs.cpio"); err == nil || errors.Is(err, initramfs.ErrNoCompression) {
+		t.Errorf("OpenOutputFile(CPIO) to a missing directory = %v, want an error opening the file", err)
+	}
+}
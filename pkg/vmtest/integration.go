@@ -75,6 +75,16 @@ type Options struct {
 
 	// Use virtual vfat rather than 9pfs
 	UseVVFAT bool
+
+	// Arch is the GOARCH of the VM. If empty, TestArch() is used.
+	Arch string
+}
+
+func (o *Options) arch() string {
+	if o.Arch != "" {
+		return o.Arch
+	}
+	return TestArch()
 }
 
 func last(s string) string {
@@ -142,6 +152,18 @@ func TestArch() string {
 	return "amd64"
 }
 
+// Kernel returns the kernel to boot for arch: $UROOT_KERNEL_<GOARCH>, e.g.
+// UROOT_KERNEL_ARM64, or else $UROOT_KERNEL if arch is TestArch().
+func Kernel(arch string) string {
+	if k := os.Getenv("UROOT_KERNEL_" + strings.ToUpper(arch)); k != "" {
+		return k
+	}
+	if arch == TestArch() {
+		return os.Getenv("UROOT_KERNEL")
+	}
+	return ""
+}
+
 // SkipWithoutQEMU skips the test when the QEMU environment variables are not
 // set. This is already called by QEMUTest(), so use if some expensive
 // operations are performed before calling QEMUTest().
@@ -233,17 +255,14 @@ func QEMU(o *Options) (*qemu.Options, error) {
 	if len(o.QEMUOpts.Kernel) == 0 {
 		// Copy kernel to o.TmpDir for tests involving kexec.
 		kernel := filepath.Join(o.TmpDir, "kernel")
-		if err := cp.Copy(os.Getenv("UROOT_KERNEL"), kernel); err != nil {
+		if err := cp.Copy(Kernel(o.arch()), kernel); err != nil {
 			return nil, err
 		}
 		o.QEMUOpts.Kernel = kernel
 	}
 
-	switch TestArch() {
-	case "amd64":
-		o.QEMUOpts.KernelArgs += " console=ttyS0 earlyprintk=ttyS0"
-	case "arm":
-		o.QEMUOpts.KernelArgs += " console=ttyAMA0"
+	if a, ok := qemu.Arches[o.arch()]; ok {
+		o.QEMUOpts.KernelArgs += " " + a.KernelArgs
 	}
 	o.QEMUOpts.KernelArgs += " uroot.vmtest"
 
@@ -251,7 +270,7 @@ func QEMU(o *Options) (*qemu.Options, error) {
 	if o.UseVVFAT {
 		dir = qemu.ReadOnlyDirectory{Dir: o.TmpDir}
 	} else {
-		dir = qemu.P9Directory{Dir: o.TmpDir, Arch: TestArch()}
+		dir = qemu.P9Directory{Dir: o.TmpDir, Arch: o.arch()}
 	}
 	o.QEMUOpts.Devices = append(o.QEMUOpts.Devices, qemu.VirtioRandom{}, dir)
 
@@ -338,11 +357,9 @@ func CreateTestInitramfs(dontSetEnv bool, o uroot.Opts, uinit, outputFile string
 		}
 		outputFile = f.Name()
 	}
-	w, err := initramfs.CPIO.OpenWriter(logger, outputFile, "", "")
-	if err != nil {
+	if err := o.OpenOutputFile(logger, initramfs.CPIO, outputFile); err != nil {
 		return "", fmt.Errorf("Failed to create initramfs writer: %v", err)
 	}
-	o.OutputFile = w
 
 	return outputFile, uroot.CreateInitramfs(logger, o)
 }
@@ -0,0 +1,202 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vmtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/golang"
+	"github.com/u-root/u-root/pkg/qemu"
+	"github.com/u-root/u-root/pkg/ulog/ulogtest"
+)
+
+// MatrixArches are the arches ArchMatrixTest boots if it is given none.
+var MatrixArches = []string{"amd64", "arm", "arm64", "riscv64", "ppc64le"}
+
+// MatrixTimeout is how long ArchMatrixTest waits for the smoke commands of
+// one arch to pass, scaled by qemu.TimeoutMultiplier. Emulating other
+// arches is slow.
+var MatrixTimeout = 5 * time.Minute
+
+// smokePassed is printed once all smoke commands succeeded. The command
+// printing it quotes part of it, so that the command itself never matches.
+const (
+	smokePassed    = "SMOKE TEST PASSED"
+	smokePassedCmd = `echo "SMOKE TEST" PASSED`
+)
+
+// ArchResult is how one arch of ArchMatrixTest did.
+type ArchResult struct {
+	Arch string
+
+	// Skipped is why the arch was not booted, if it was not.
+	Skipped string
+
+	// Err is why building the initramfs, booting it or running the smoke
+	// commands failed.
+	Err error
+
+	// Duration is how long building and booting the arch took.
+	Duration time.Duration
+}
+
+func (r ArchResult) String() string {
+	switch {
+	case r.Skipped != "":
+		return fmt.Sprintf("%-8s SKIP %s", r.Arch, r.Skipped)
+	case r.Err != nil:
+		return fmt.Sprintf("%-8s FAIL %v", r.Arch, r.Err)
+	default:
+		return fmt.Sprintf("%-8s ok   %v", r.Arch, r.Duration.Round(time.Second))
+	}
+}
+
+// ArchMatrixTest builds an initramfs for each of arches, or MatrixArches if
+// arches is nil, boots it in the arch's QEMU machine (see qemu.ArchCmdline)
+// with the arch's kernel (see Kernel), and runs the smoke commands in it
+// with the generic uinit.
+//
+// Every arch is a subtest, skipped if there is no kernel or QEMU for it. The
+// arches share the rewritten bb packages. The results are logged as a table
+// and returned.
+//
+// o, which may be nil, holds the options all arches start with. If it has no
+// commands to build, the core commands are built.
+func ArchMatrixTest(t *testing.T, arches []string, smoke []string, o *Options) []ArchResult {
+	if arches == nil {
+		arches = MatrixArches
+	}
+	if o == nil {
+		o = &Options{}
+	}
+	if len(o.Name) == 0 {
+		o.Name = callerName(2)
+	}
+
+	cacheDir := o.BuildOpts.CacheDir
+	if cacheDir == "" {
+		dir, err := ioutil.TempDir("", "vmtest-cache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		cacheDir = dir
+	}
+
+	results := make([]ArchResult, len(arches))
+	for i, arch := range arches {
+		t.Run(arch, func(t *testing.T) {
+			start := time.Now()
+			r := bootArch(t, arch, smoke, *o, cacheDir)
+			r.Duration = time.Since(start)
+			results[i] = r
+			if r.Skipped != "" {
+				t.Skip(r.Skipped)
+			}
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+		})
+	}
+
+	var table strings.Builder
+	fmt.Fprintf(&table, "%-8s Result\n", "Arch")
+	for _, r := range results {
+		fmt.Fprintln(&table, r)
+	}
+	t.Logf("Results of %s:\n%s", o.Name, table.String())
+	return results
+}
+
+// bootArch builds an initramfs for arch from o, boots it, and waits for the
+// smoke commands to pass.
+func bootArch(t *testing.T, arch string, smoke []string, o Options, cacheDir string) ArchResult {
+	r := ArchResult{Arch: arch}
+	kernel := Kernel(arch)
+	if kernel == "" {
+		r.Skipped = fmt.Sprintf("no kernel; set UROOT_KERNEL_%s", strings.ToUpper(arch))
+		return r
+	}
+	args, err := qemu.ArchCmdline(arch)
+	if err != nil {
+		r.Skipped = err.Error()
+		return r
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		r.Skipped = fmt.Sprintf("no QEMU: %v", err)
+		return r
+	}
+
+	tmpDir, err := ioutil.TempDir("", "uroot-integration-"+arch)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer func() {
+		if r.Err != nil {
+			t.Log("Keeping temp dir: ", tmpDir)
+		} else {
+			os.RemoveAll(tmpDir)
+		}
+	}()
+
+	env := golang.Default()
+	env.CgoEnabled = false
+	env.GOARCH = arch
+	o.BuildOpts.Env = env
+	o.BuildOpts.CacheDir = cacheDir
+	if len(o.BuildOpts.Commands) == 0 {
+		o.BuildOpts.AddBusyBoxCommands("github.com/u-root/u-root/cmds/core/*")
+	}
+	if len(o.Uinit) == 0 {
+		o.Uinit = "github.com/u-root/u-root/integration/testcmd/generic/uinit"
+	}
+	o.QEMUOpts.Initramfs = filepath.Join(tmpDir, "initramfs.cpio")
+	if _, err := CreateTestInitramfs(true, o.BuildOpts, o.Uinit, o.QEMUOpts.Initramfs); err != nil {
+		r.Err = fmt.Errorf("building initramfs: %v", err)
+		return r
+	}
+
+	o.Name = fmt.Sprintf("%s-%s", o.Name, arch)
+	o.Arch = arch
+	o.TmpDir = tmpDir
+	o.DontSetEnv = true
+	o.TestCmds = append(append([]string(nil), smoke...), smokePassedCmd)
+	if o.Logger == nil {
+		o.Logger = &ulogtest.Logger{TB: t}
+	}
+	if o.QEMUOpts.SerialOutput == nil {
+		o.QEMUOpts.SerialOutput = TestLineWriter(t, "serial")
+	}
+	o.QEMUOpts.QEMUPath = args[0]
+	o.QEMUOpts.Devices = append(append([]qemu.Device(nil), o.QEMUOpts.Devices...), qemu.ArbitraryArgs(args[1:]))
+
+	qOpts, err := QEMU(&o)
+	if err != nil {
+		r.Err = fmt.Errorf("preparing QEMU: %v", err)
+		return r
+	}
+	vm, err := qOpts.Start()
+	if err != nil {
+		r.Err = fmt.Errorf("starting QEMU: %v", err)
+		return r
+	}
+	defer func() {
+		vm.Close()
+		t.Logf("QEMU command line to reproduce %s:\n%s", o.Name, vm.CmdlineQuoted())
+	}()
+
+	if err := vm.ExpectTimeout(smokePassed, MatrixTimeout); err != nil {
+		r.Err = fmt.Errorf("smoke commands did not pass: %v", err)
+	}
+	return r
+}
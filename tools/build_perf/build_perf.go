@@ -9,10 +9,16 @@
 // - build_perf_user.csv
 // - build_perf_sys.csv
 // - build_perf_max_rss.csv
+//
+// With -bb, it instead measures building a busybox of the commands given as
+// arguments (by default, cmds/core/*) without a bb cache, with an empty one
+// and with a warm one, and writes build_perf_bb.csv with the times and bb
+// cache hits of each build.
 package main
 
 import (
 	"encoding/csv"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -22,6 +28,10 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/u-root/u-root/pkg/bb"
+	"github.com/u-root/u-root/pkg/golang"
+	"github.com/u-root/u-root/pkg/uroot"
 )
 
 const (
@@ -71,6 +81,8 @@ var descs = []csvDesc{
 
 var wg sync.WaitGroup
 
+var measureBB = flag.Bool("bb", false, "Measure busybox builds of the commands given as arguments with and without a bb cache")
+
 // Return a list of command names.
 func getCmdNames() ([]string, error) {
 	files, err := ioutil.ReadDir(os.ExpandEnv(cmdsPath))
@@ -98,7 +110,7 @@ func buildCmd(cmd string, gogc int) (*measurement, error) {
 		realTime: time.Since(start).Seconds(),
 		userTime: c.ProcessState.UserTime().Seconds(),
 		sysTime:  c.ProcessState.SystemTime().Seconds(),
-		maxRss:   c.ProcessState.SysUsage().(*syscall.Rusage).Maxrss,
+		maxRss:   int64(c.ProcessState.SysUsage().(*syscall.Rusage).Maxrss),
 	}, nil
 }
 
@@ -120,6 +132,84 @@ func measureBuilds(cmds []string, gogcs []int) {
 	}
 }
 
+// childUsage returns the user and system time used by waited-for children.
+func childUsage() (user, sys float64) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &ru); err != nil {
+		log.Fatal(err)
+	}
+	return time.Duration(ru.Utime.Nano()).Seconds(), time.Duration(ru.Stime.Nano()).Seconds()
+}
+
+// buildBB measures building a busybox of pkgs using the bb cache in cacheDir.
+func buildBB(env golang.Environ, pkgs []string, cacheDir, binaryPath string) (*measurement, bb.CacheStats, error) {
+	user, sys := childUsage()
+	start := time.Now()
+	stats, err := bb.BuildBusybox(env, pkgs, golang.BuildOpts{}, cacheDir, binaryPath)
+	if err != nil {
+		return nil, stats, err
+	}
+	m := &measurement{realTime: time.Since(start).Seconds()}
+	m.userTime, m.sysTime = childUsage()
+	m.userTime -= user
+	m.sysTime -= sys
+	return m, stats, nil
+}
+
+// measureBBBuilds writes the times of an uncached busybox build, a build
+// filling an empty cache, and a build with a warm cache to build_perf_bb.csv.
+func measureBBBuilds(cmds []string) {
+	if len(cmds) == 0 {
+		cmds = []string{"github.com/u-root/u-root/cmds/core/*"}
+	}
+	l := log.New(os.Stderr, "", log.LstdFlags)
+	env := golang.Default()
+	env.CgoEnabled = false
+	pkgs, err := uroot.ResolvePackagePaths(l, env, cmds)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "build_perf")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	bin := filepath.Join(dir, "bb")
+
+	f, err := os.Create("build_perf_bb.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"build", "real", "user", "sys", "cache hits", "cache misses"})
+	for _, b := range []struct {
+		name     string
+		cacheDir string
+	}{
+		{"uncached", ""},
+		{"cold cache", cacheDir},
+		{"warm cache", cacheDir},
+	} {
+		m, stats, err := buildBB(env, pkgs, b.cacheDir, bin)
+		if err != nil {
+			log.Fatalf("%s build of %d commands: %v", b.name, len(pkgs), err)
+		}
+		if b.cacheDir != "" {
+			fmt.Printf("%s build of %d commands: %.1fs, %v\n", b.name, len(pkgs), m.realTime, stats)
+		} else {
+			fmt.Printf("%s build of %d commands: %.1fs\n", b.name, len(pkgs), m.realTime)
+		}
+		w.Write([]string{b.name, fmt.Sprint(m.realTime), fmt.Sprint(m.userTime), fmt.Sprint(m.sysTime), fmt.Sprint(stats.Hits), fmt.Sprint(stats.Misses)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalln("error writing csv:", err)
+	}
+}
+
 func writeCsv(cmds []string, gogcs []int, d csvDesc) {
 	// Create the csv writer.
 	f, err := os.Create(d.filename)
@@ -165,6 +255,12 @@ func writeCsv(cmds []string, gogcs []int, d csvDesc) {
 }
 
 func main() {
+	flag.Parse()
+	if *measureBB {
+		measureBBBuilds(flag.Args())
+		return
+	}
+
 	// Get list of commands.
 	cmds, err := getCmdNames()
 	if err != nil {
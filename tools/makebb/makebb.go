@@ -16,7 +16,10 @@ import (
 	"github.com/u-root/u-root/pkg/uroot"
 )
 
-var outputPath = flag.String("o", "bb", "Path to busybox binary")
+var (
+	outputPath = flag.String("o", "bb", "Path to busybox binary")
+	cacheDir   = flag.String("cache-dir", "", "Directory to keep rewritten packages in between builds. Only changed packages are rewritten.")
+)
 
 func main() {
 	flag.Parse()
@@ -44,7 +47,11 @@ func main() {
 		l.Fatal(err)
 	}
 
-	if err := bb.BuildBusybox(env, pkgs, false /* noStrip */, o); err != nil {
+	stats, err := bb.BuildBusybox(env, pkgs, golang.BuildOpts{}, *cacheDir, o)
+	if err != nil {
 		l.Fatal(err)
 	}
+	if *cacheDir != "" {
+		l.Printf("bb cache: %v", stats)
+	}
 }
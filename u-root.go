@@ -5,19 +5,24 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/u-root/u-root/pkg/golang"
-	"github.com/u-root/u-root/pkg/shlex"
 	"github.com/u-root/u-root/pkg/uroot"
 	"github.com/u-root/u-root/pkg/uroot/builder"
 	"github.com/u-root/u-root/pkg/uroot/initramfs"
+	"github.com/u-root/u-root/pkg/uroot/report"
+	"github.com/u-root/u-root/pkg/uroot/spec"
 )
 
 // multiFlag is used for flags that support multiple invocations, e.g. -files
@@ -34,14 +39,20 @@ func (m *multiFlag) Set(value string) error {
 
 // Flags for u-root builder.
 var (
-	build, format, tmpDir, base, outputPath *string
-	uinitCmd, initCmd                       *string
-	defaultShell                            *string
-	useExistingInit                         *bool
-	fourbins                                *bool
-	noCommands                              *bool
-	extraFiles                              multiFlag
-	noStrip                                 *bool
+	build, format, compress, tmpDir, base, outputPath *string
+	uinitCmd, initCmd                                 *string
+	defaultShell                                      *string
+	useExistingInit                                   *bool
+	fourbins                                          *bool
+	noCommands                                        *bool
+	extraFiles                                        multiFlag
+	noStrip                                           *bool
+	reproducible                                      *bool
+	manifest                                          *string
+	cacheDir                                          *string
+	reportPath, reportBase                            *string
+	configPath, board                                 *string
+	arches                                            *string
 )
 
 func init() {
@@ -55,11 +66,12 @@ func init() {
 
 	fourbins = flag.Bool("fourbins", false, "build installcommand on boot, no ahead of time, so we have only four binares")
 	build = flag.String("build", "bb", "u-root build format (e.g. bb or source).")
-	format = flag.String("format", "cpio", "Archival format.")
+	format = flag.String("format", "cpio", "Archival format (cpio, dir, squashfs or erofs).")
+	compress = flag.String("compress", "", "Compression for the cpio archive or squashfs image (gzip, xz, zstd or lz4), or erofs image (lz4). Uncompressed by default.")
 
 	tmpDir = flag.String("tmpdir", "", "Temporary directory to put binaries in.")
 
-	base = flag.String("base", "", "Base archive to add files to. By default, this is a couple of directories like /bin, /etc, etc. u-root has a default internally supplied set of files; use base=/dev/null if you don't want any base files.")
+	base = flag.String("base", "", "Base archive to add files to, a cpio archive or a squashfs or erofs image. By default, this is a couple of directories like /bin, /etc, etc. u-root has a default internally supplied set of files; use base=/dev/null if you don't want any base files.")
 	useExistingInit = flag.Bool("useinit", false, "Use existing init from base archive (only if --base was specified).")
 	outputPath = flag.String("o", "", "Path to output initramfs file.")
 
@@ -72,6 +84,15 @@ func init() {
 	flag.Var(&extraFiles, "files", "Additional files, directories, and binaries (with their ldd dependencies) to add to archive. Can be speficified multiple times.")
 
 	noStrip = flag.Bool("no-strip", false, "Build unstripped binaries")
+
+	reproducible = flag.Bool("reproducible", false, "Build an initramfs that only depends on its inputs. All files get $SOURCE_DATE_EPOCH (or 0) as their modification time.")
+	cacheDir = flag.String("cache-dir", "", "Directory to keep rewritten bb packages in between builds. Only changed commands are rewritten.")
+	reportPath = flag.String("report", "", "Path to write a JSON report of the bb binary's size per command and of the extra files to. A text breakdown is printed to stdout. Requires -build=bb.")
+	reportBase = flag.String("report-base", "", "Path of a previous -report to print the size changes against.")
+	configPath = flag.String("config", "", "Path to a YAML or JSON build spec. Flags given on the command line override the spec; -files and packages are added to it. See pkg/uroot/spec.")
+	board = flag.String("board", "", "Board in the -config spec to build. By default, the spec's top-level config is built.")
+	arches = flag.String("arches", "", "Comma-separated GOARCHes to build an initramfs for each of, instead of only GOARCH, e.g. amd64,arm,arm64,riscv64,ppc64le. The arch is inserted before the extension of -o, -manifest and -report paths.")
+	manifest = flag.String("manifest", "", "Path to write a manifest of the initramfs to, with the mode, SHA-256 and path of each file.")
 }
 
 func main() {
@@ -127,31 +148,115 @@ func Main() error {
 			v, recommendedVersions, recommendedVersions[0])
 	}
 
-	archiver, err := initramfs.GetArchiver(*format)
+	c, err := buildConfig()
 	if err != nil {
 		return err
 	}
 
-	logger := log.New(os.Stderr, "", log.LstdFlags)
-	// Open the target initramfs file.
-	w, err := archiver.OpenWriter(logger, *outputPath, env.GOOS, env.GOARCH)
+	if *arches == "" {
+		return buildInitramfs(env, c, outputs{
+			initramfs: *c.Output,
+			manifest:  *manifest,
+			report:    *reportPath,
+			tempDir:   *tmpDir,
+			cacheDir:  *cacheDir,
+		})
+	}
+	return buildArches(env, c, strings.Split(*arches, ","))
+}
+
+// outputs are the paths one initramfs build writes to.
+type outputs struct {
+	initramfs, manifest, report string
+
+	// tempDir and cacheDir are the -tmpdir and -cache-dir of the build.
+	tempDir, cacheDir string
+}
+
+// buildArches builds the initramfs c describes for each of the arches,
+// reusing the rewritten bb packages between them, and prints which builds
+// succeeded. Output paths get the arch inserted before their extension.
+func buildArches(env golang.Environ, c *spec.Config, arches []string) error {
+	cache := *cacheDir
+	if cache == "" {
+		var err error
+		if cache, err = ioutil.TempDir("", "u-root-cache"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(cache)
+	}
+
+	var failed []string
+	results := make([]string, len(arches))
+	for i, arch := range arches {
+		env.GOARCH = arch
+		out := outputs{
+			initramfs: archPath(*c.Output, arch),
+			manifest:  archPath(*manifest, arch),
+			report:    archPath(*reportPath, arch),
+			cacheDir:  cache,
+		}
+		if *tmpDir != "" {
+			out.tempDir = filepath.Join(*tmpDir, arch)
+		}
+		log.Printf("Building initramfs for %s", arch)
+		start := time.Now()
+		if err := buildInitramfs(env, c, out); err != nil {
+			log.Printf("Building initramfs for %s failed: %v", arch, err)
+			results[i] = fmt.Sprintf("%-8s FAIL %v", arch, err)
+			failed = append(failed, arch)
+			continue
+		}
+		results[i] = fmt.Sprintf("%-8s ok   %-6v %s", arch, time.Since(start).Round(time.Second), out.initramfs)
+	}
+
+	fmt.Println("Arch     Result")
+	for _, r := range results {
+		fmt.Println(r)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("building initramfs failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// archPath inserts arch before the extension of path, if path is not empty.
+func archPath(path, arch string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + arch + ext
+}
+
+// buildInitramfs builds the initramfs c describes for env, writing it and
+// its manifest and report to out.
+func buildInitramfs(env golang.Environ, c *spec.Config, out outputs) error {
+	archiver, err := initramfs.GetArchiver(*c.Format)
 	if err != nil {
 		return err
 	}
+	if *c.Compress != "" {
+		if _, err := initramfs.GetCompressor(*c.Compress); err != nil {
+			return err
+		}
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
 
 	var baseFile initramfs.Reader
-	if *base != "" {
-		bf, err := os.Open(*base)
+	if *c.Base != "" {
+		bf, err := os.Open(*c.Base)
 		if err != nil {
 			return err
 		}
 		defer bf.Close()
-		baseFile = archiver.Reader(bf)
+		baseFile = initramfs.OpenReader(bf)
 	} else {
 		baseFile = uroot.DefaultRamfs().Reader()
 	}
 
-	tempDir := *tmpDir
+	tempDir := out.tempDir
 	if tempDir == "" {
 		var err error
 		tempDir, err = ioutil.TempDir("", "u-root")
@@ -165,73 +270,190 @@ func Main() error {
 		}
 	}
 
-	var (
-		c           []uroot.Commands
-		initCommand = *initCmd
-	)
-	if !*noCommands {
-		var b builder.Builder
-		switch *build {
-		case "bb":
-			b = builder.BBBuilder{}
-		case "binary":
-			b = builder.BinaryBuilder{}
-		case "source":
-			b = builder.SourceBuilder{
-				FourBins: *fourbins,
+	if *noCommands {
+		c.Commands = nil
+	} else if len(c.Commands) == 0 {
+		c.Commands = []spec.Commands{{
+			Builder:  *build,
+			Packages: []string{"github.com/u-root/u-root/cmds/core/*"},
+		}}
+	}
+	cmds, err := c.UrootCommands(expandTemplates)
+	if err != nil {
+		return err
+	}
+
+	opts := uroot.Opts{
+		Env:         env,
+		Commands:    cmds,
+		TempDir:     tempDir,
+		BaseArchive: baseFile,
+		CacheDir:    out.cacheDir,
+	}
+	c.Apply(&opts)
+	// Open the target initramfs file.
+	if err := opts.OpenOutputFile(logger, archiver, out.initramfs); errors.Is(err, initramfs.ErrNoCompression) {
+		return fmt.Errorf("archive format %q can not be compressed", *c.Format)
+	} else if err != nil {
+		return err
+	}
+	for i, cmds := range opts.Commands {
+		if _, ok := cmds.Builder.(builder.SourceBuilder); ok && *fourbins {
+			opts.Commands[i].Builder = builder.SourceBuilder{FourBins: true}
+			opts.InitCmd = "/go/bin/go"
+		}
+	}
+	if opts.Reproducible {
+		if sde := os.Getenv("SOURCE_DATE_EPOCH"); sde != "" {
+			opts.SourceDateEpoch, err = strconv.ParseUint(sde, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", sde, err)
 			}
-		default:
-			return fmt.Errorf("could not find builder %q", *build)
 		}
+	}
+	if out.manifest != "" {
+		m, err := os.Create(out.manifest)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		opts.Manifest = m
+	}
+	if out.report != "" {
+		opts.Report = &report.Report{}
+	}
+	if err := uroot.CreateInitramfs(logger, opts); err != nil {
+		return err
+	}
+	if opts.Report != nil {
+		return writeReport(opts.Report, out.report, *reportBase)
+	}
+	return nil
+}
 
+// expandTemplates replaces template names in pkgs with the template's
+// packages.
+func expandTemplates(pkgs []string) []string {
+	var expanded []string
+	for _, a := range pkgs {
+		p, ok := templates[a]
+		if !ok {
+			expanded = append(expanded, a)
+			continue
+		}
+		expanded = append(expanded, p...)
+	}
+	return expanded
+}
+
+// flagConfig returns the config the flags describe, using only the flags for
+// which use returns true. The packages given as arguments are called "args".
+func flagConfig(use func(name string) bool) *spec.Config {
+	c := &spec.Config{}
+	if use("args") && len(flag.Args()) > 0 {
 		// Resolve globs into package imports.
 		//
 		// Currently allowed formats:
 		//   Go package imports; e.g. github.com/u-root/u-root/cmds/ls (must be in $GOPATH)
 		//   Paths to Go package directories; e.g. $GOPATH/src/github.com/u-root/u-root/cmds/*
-		var pkgs []string
-		for _, a := range flag.Args() {
-			p, ok := templates[a]
-			if !ok {
-				pkgs = append(pkgs, a)
-				continue
-			}
-			pkgs = append(pkgs, p...)
+		//
+		// The command-line tool only allows specifying one build mode
+		// right now.
+		c.Commands = []spec.Commands{{Builder: *build, Packages: flag.Args()}}
+	}
+	if use("files") {
+		c.Files = extraFiles
+	}
+	for name, p := range map[string]**string{
+		"initcmd":   &c.InitCmd,
+		"uinitcmd":  &c.UinitCmd,
+		"defaultsh": &c.DefaultShell,
+		"base":      &c.Base,
+		"o":         &c.Output,
+		"format":    &c.Format,
+		"compress":  &c.Compress,
+	} {
+		if use(name) {
+			v := flag.Lookup(name).Value.String()
+			*p = &v
 		}
-		if len(pkgs) == 0 {
-			pkgs = []string{"github.com/u-root/u-root/cmds/core/*"}
+	}
+	for name, p := range map[string]**bool{
+		"useinit":      &c.UseInit,
+		"no-strip":     &c.NoStrip,
+		"reproducible": &c.Reproducible,
+	} {
+		if use(name) {
+			v := flag.Lookup(name).Value.(flag.Getter).Get().(bool)
+			*p = &v
 		}
+	}
+	return c
+}
 
-		if *fourbins && *build == "source" {
-			initCommand = "/go/bin/go"
+// buildConfig returns the config to build: the -config spec's -board on top
+// of the flags' defaults, with the flags given on the command line on top.
+func buildConfig() (*spec.Config, error) {
+	all := func(string) bool { return true }
+	if *configPath == "" {
+		if *board != "" {
+			return nil, fmt.Errorf("-board needs a -config spec")
 		}
+		return flagConfig(all), nil
+	}
 
-		// The command-line tool only allows specifying one build mode
-		// right now.
-		c = append(c, uroot.Commands{
-			Builder:  b,
-			Packages: pkgs,
-		})
+	set := map[string]bool{"args": len(flag.Args()) > 0}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	s, err := spec.ReadFile(*configPath)
+	if err != nil {
+		return nil, err
 	}
+	b, err := s.Board(*board)
+	if err != nil {
+		return nil, err
+	}
+	c := flagConfig(func(name string) bool { return !set[name] && name != "args" && name != "files" })
+	c.Merge(b)
+	c.Merge(flagConfig(func(name string) bool { return set[name] }))
+	return c, nil
+}
 
-	opts := uroot.Opts{
-		Env:             env,
-		Commands:        c,
-		TempDir:         tempDir,
-		ExtraFiles:      extraFiles,
-		OutputFile:      w,
-		BaseArchive:     baseFile,
-		UseExistingInit: *useExistingInit,
-		InitCmd:         initCommand,
-		DefaultShell:    *defaultShell,
-		NoStrip:         *noStrip,
-	}
-	uinitArgs := shlex.Argv(*uinitCmd)
-	if len(uinitArgs) > 0 {
-		opts.UinitCmd = uinitArgs[0]
-	}
-	if len(uinitArgs) > 1 {
-		opts.UinitArgs = uinitArgs[1:]
-	}
-	return uroot.CreateInitramfs(logger, opts)
+// writeReport writes rep as JSON to path, prints it to stdout, and prints
+// the changes from the report at basePath if it is set.
+func writeReport(rep *report.Report, path, basePath string) error {
+	var old *report.Report
+	if basePath != "" {
+		f, err := os.Open(basePath)
+		if err != nil {
+			return err
+		}
+		old, err = report.Read(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := rep.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := rep.WriteText(os.Stdout); err != nil {
+		return err
+	}
+	if old != nil {
+		fmt.Printf("\nChanges from %s:\n", basePath)
+		return report.Diff(os.Stdout, old, rep)
+	}
+	return nil
 }